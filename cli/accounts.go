@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// account is a saved ChatGPT account, as "pi-agent accounts" lists it.
+type account struct {
+	Name           string    `json:"name"`
+	Default        bool      `json:"default"`
+	AccountID      string    `json:"account_id,omitempty"`
+	TokenExpiresAt time.Time `json:"token_expires_at,omitzero"`
+}
+
+// accounts implements "pi-agent accounts": list, add and remove the named
+// ChatGPT accounts in the token store, and choose the default one that
+// chats use unless they name another.
+func accounts(fs *flag.FlagSet) func() {
+	dataDir := dataDirFlag(fs)
+	openStore := tokenStoreFlag(fs)
+	headless := fs.Bool("headless", false, "add: use device code flow for headless auth (no browser needed)")
+	asJSON := jsonFlag(fs)
+	configureUpstream := upstreamFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: pi-agent accounts [flags] [list | add NAME | remove NAME | default NAME]")
+		fs.PrintDefaults()
+	}
+
+	return func() {
+		ts, err := openStore(*dataDir)
+		if err != nil {
+			log.Fatalf("initializing token store: %v", err)
+		}
+		action, name := fs.Arg(0), fs.Arg(1)
+		if action != "" && action != "list" && (name == "" || fs.NArg() > 2) {
+			fs.Usage()
+			os.Exit(2)
+		}
+		switch action {
+		case "", "list":
+			out := []account{}
+			for _, name := range ts.Accounts() {
+				a, err := ts.Account(name)
+				if err != nil {
+					log.Fatal(err)
+				}
+				out = append(out, account{name, name == ts.Default(), a.AccountID(), a.ExpiresAt()})
+			}
+			if *asJSON {
+				printJSON(out)
+				return
+			}
+			if len(out) == 0 {
+				fmt.Println(`No accounts; add one with "pi-agent accounts add NAME".`)
+			}
+			for _, a := range out {
+				mark := " "
+				if a.Default {
+					mark = "*"
+				}
+				fmt.Printf("%s %-20s %s\n", mark, a.Name, a.AccountID)
+			}
+		case "add":
+			configureUpstream()
+			if err := authenticate(ts, name, *headless); err != nil {
+				log.Fatal(err)
+			}
+		case "remove":
+			if err := ts.Remove(name); err != nil {
+				log.Fatal(err)
+			}
+			if def := ts.Default(); def != "" {
+				fmt.Fprintf(os.Stderr, "Removed %s; the default account is %s.\n", name, def)
+			}
+		case "default":
+			if err := ts.SetDefault(name); err != nil {
+				log.Fatal(err)
+			}
+		default:
+			fs.Usage()
+			os.Exit(2)
+		}
+	}
+}
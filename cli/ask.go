@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pi-agent/client"
+	"pi-agent/engine"
+	"pi-agent/internal/store"
+	"pi-agent/internal/token"
+)
+
+// maxStdin caps how much piped input ask sends with the prompt.
+const maxStdin = 1 << 20
+
+// ask implements "pi-agent ask": a one-shot question, optionally about
+// piped input, e.g.
+//
+//	cat error.log | pi-agent ask "what's wrong?"
+//
+// It goes to the running agent if there is one, and otherwise straight to
+// the model using the saved credentials, without tools or history.
+func ask(fs *flag.FlagSet) func() {
+	api := serverFlags(fs)
+	conversation := fs.String("conversation", "ask", "conversation ID used on the running agent")
+	persona := fs.String("persona", "", "persona to answer as")
+	local := fs.Bool("local", false, "don't use the running agent, even if there is one")
+	dataDir := dataDirFlag(fs)
+	model := fs.String("model", "gpt-5.2", "model used without a running agent")
+	asJSON := jsonFlag(fs)
+	configureUpstream := upstreamFlags(fs)
+	openCredentials := credentialsFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: pi-agent ask [flags] prompt")
+		fs.PrintDefaults()
+	}
+
+	return func() {
+		configureUpstream()
+		prompt := strings.Join(fs.Args(), " ")
+		if fi, err := os.Stdin.Stat(); err == nil && fi.Mode()&os.ModeCharDevice == 0 {
+			data, err := io.ReadAll(io.LimitReader(os.Stdin, maxStdin))
+			if err != nil {
+				log.Fatal(err)
+			}
+			if input := strings.TrimSpace(string(data)); input != "" {
+				prompt = strings.TrimSpace(prompt + "\n\n```\n" + input + "\n```")
+			}
+		}
+		if prompt == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+
+		c := api()
+		if !*local {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			_, err := c.Health(ctx)
+			cancel()
+			if err == nil {
+				printReply(c, client.Request{Message: prompt, ConversationID: *conversation, Persona: *persona}, *asJSON)
+				return
+			}
+		}
+		ts, err := openCredentials(*dataDir)
+		if err != nil {
+			log.Fatalf("initializing token store: %v", err)
+		}
+		askModel(ts, *model, prompt, *asJSON)
+	}
+}
+
+// askModel answers prompt with an ephemeral engine, using ts and a
+// throwaway database.
+func askModel(ts token.Provider, model, prompt string, asJSON bool) {
+	if !ts.HasCredentials() {
+		log.Fatalf("no agent is running and there are no saved credentials; run pi-agent login first or set $%s", token.EnvAPIKey)
+	}
+	tmp, err := os.MkdirTemp("", "pi-agent-ask")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	db, err := store.Open(filepath.Join(tmp, "conversations.db"))
+	if err != nil {
+		log.Fatalf("opening database: %v", err)
+	}
+	defer db.Close()
+
+	eng := engine.New(engine.Config{
+		Model:        model,
+		SystemPrompt: "You are a helpful assistant answering a one-off question from the command line. Be concise.",
+	}, ts, db)
+	var emit func(string)
+	if !asJSON {
+		emit = func(s string) { fmt.Print(s) }
+	}
+	reply, err := eng.Chat(context.Background(), "ask", prompt, emit)
+	result := chatResult{Reply: &client.Reply{Content: reply}}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	if asJSON {
+		printJSON(result)
+	} else {
+		fmt.Println()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+		}
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
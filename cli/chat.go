@@ -0,0 +1,165 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pi-agent/client"
+	"pi-agent/internal/store"
+)
+
+// serverFlags registers the flags locating a running agent and returns a
+// function building a client from them.
+func serverFlags(fs *flag.FlagSet) func() *client.Client {
+	url := fs.String("url", client.DefaultURL, "base URL of the running agent")
+	socket := fs.String("socket", "", "Unix socket of the running agent; overrides -url")
+	return func() *client.Client {
+		if *socket != "" {
+			return client.NewUnix(*socket)
+		}
+		return client.New(*url)
+	}
+}
+
+// chatResult is the output of "pi-agent chat -json" and "pi-agent ask
+// -json".
+type chatResult struct {
+	ConversationID string `json:"conversation_id,omitempty"`
+	*client.Reply
+	Error string `json:"error,omitempty"`
+}
+
+// chatCommand implements "pi-agent chat": send a message to the running
+// agent and print the reply as it streams. The message is taken from the
+// arguments, or from stdin when there are none.
+func chatCommand(fs *flag.FlagSet) func() {
+	api := serverFlags(fs)
+	conversation := fs.String("conversation", "", "conversation ID (default: the agent's default conversation)")
+	persona := fs.String("persona", "", "persona to answer as")
+	account := fs.String("account", "", "ChatGPT account to answer with (see \"pi-agent accounts\"); default the server's default")
+	user := fs.String("user", "", "user sending the message")
+	asJSON := jsonFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: pi-agent chat [flags] [message]")
+		fs.PrintDefaults()
+	}
+
+	return func() {
+		message := strings.Join(fs.Args(), " ")
+		if message == "" {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				log.Fatal(err)
+			}
+			message = string(data)
+		}
+		if strings.TrimSpace(message) == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		req := client.Request{Message: message, ConversationID: *conversation, Persona: *persona, User: *user, Account: *account}
+		printReply(api(), req, *asJSON)
+	}
+}
+
+// printReply sends req and prints the reply, streaming it unless asJSON is
+// set. It exits non-zero if the request fails.
+func printReply(c *client.Client, req client.Request, asJSON bool) {
+	var onContent func(string)
+	if !asJSON {
+		onContent = func(s string) { fmt.Print(s) }
+	}
+	reply, err := c.Chat(context.Background(), req, onContent)
+	if reply == nil {
+		reply = &client.Reply{}
+	}
+	result := chatResult{ConversationID: req.ConversationID, Reply: reply}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	if asJSON {
+		printJSON(result)
+	} else {
+		if reply.Content != "" {
+			fmt.Println()
+		}
+		for _, c := range reply.Citations {
+			fmt.Printf("[%d] %s (%s)\n", c.Marker, c.Title, c.Source)
+		}
+		if reply.Fallback != "" {
+			fmt.Fprintf(os.Stderr, "note: answered by the fallback model (%s) because the primary provider failed; retry later for a full answer\n", reply.Fallback)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+		}
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// conversations implements "pi-agent conversations [id]".
+func conversations(fs *flag.FlagSet) func() {
+	dataDir := dataDirFlag(fs)
+	asJSON := jsonFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: pi-agent conversations [flags] [conversation id]")
+		fs.PrintDefaults()
+	}
+
+	return func() {
+		db, err := store.Open(filepath.Join(*dataDir, "conversations.db"))
+		if err != nil {
+			log.Fatalf("opening database: %v", err)
+		}
+		defer db.Close()
+
+		if id := fs.Arg(0); id != "" {
+			msgs, err := db.Messages(id)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if *asJSON {
+				type message struct {
+					Role      store.Role `json:"role"`
+					Content   string     `json:"content"`
+					AudioRef  string     `json:"audio_ref,omitempty"`
+					CreatedAt time.Time  `json:"created_at"`
+				}
+				out := []message{}
+				for _, m := range msgs {
+					out = append(out, message{m.Role, m.Content, m.AudioRef, m.CreatedAt})
+				}
+				printJSON(out)
+				return
+			}
+			for _, m := range msgs {
+				fmt.Printf("[%s] %s: %s\n\n", m.CreatedAt.Local().Format(time.DateTime), m.Role, m.Content)
+			}
+			return
+		}
+
+		convs, err := db.Conversations()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *asJSON {
+			if convs == nil {
+				convs = []store.Conversation{}
+			}
+			printJSON(convs)
+			return
+		}
+		for _, c := range convs {
+			fmt.Printf("%-40s %5d messages  last %s\n", c.ID, c.Messages, c.LastMessageAt.Local().Format(time.DateTime))
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Package cli is the pi-agent command line. Custom binaries that add
+// extensions through package sdk call Main from their own main function.
+package cli
+
+import (
+	"cmp"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pi-agent/internal/token"
+	"pi-agent/internal/upstream"
+)
+
+// command is a pi-agent subcommand. define registers the command's flags
+// and returns the function that runs it once they are parsed, so that
+// completion scripts can list flags without running anything.
+type command struct {
+	name    string
+	summary string
+	define  func(fs *flag.FlagSet) func()
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"serve", "run the agent (the default)", serve},
+		{"login", "authenticate with ChatGPT and save the credentials", login},
+		{"accounts", "list, add or remove ChatGPT accounts, or choose the default", accounts},
+		{"status", "show credential, database and server status", status},
+		{"chat", "send a message to the running agent", chatCommand},
+		{"ask", "ask a one-off question, optionally about piped input", ask},
+		{"wait", "wait until the running agent is ready", wait},
+		{"conversations", "list conversations, or show one", conversations},
+		{"compact", "summarize old history and vacuum the database", compact},
+		{"import", "import history from a ChatGPT, Open WebUI or JSONL export", importCommand},
+		{"export", "export conversations, people and bookmarks to a Markdown vault", export},
+		{"replay", "re-parse a recorded upstream transcript without calling the model", replay},
+		{"hash-password", "hash a web login password read from standard input", hashPassword},
+		{"doctor", "check configuration, database, credentials, network, devices and clock", doctorCommand},
+		{"completion", "print a bash, zsh or fish completion script", completion},
+	}
+}
+
+// Main runs the pi-agent command named by the program arguments.
+func Main() {
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		fs := flag.NewFlagSet("pi-agent "+name, flag.ExitOnError)
+		run := c.define(fs)
+		fs.Parse(args)
+		run()
+		return
+	}
+	fmt.Fprintf(os.Stderr, "pi-agent: unknown command %q\n\nCommands:\n", name)
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", c.name, c.summary)
+	}
+	os.Exit(2)
+}
+
+// dataDirFlag registers the -data-dir flag shared by most commands.
+func dataDirFlag(fs *flag.FlagSet) *string {
+	return fs.String("data-dir", defaultDataDir(), "directory for persistent data (tokens, database)")
+}
+
+// credentialsFlag registers -api-key and -token-backend. The returned
+// function opens the credentials for the model: the API key if there is
+// one, and otherwise the OAuth tokens "pi-agent login" saved in dataDir.
+func credentialsFlag(fs *flag.FlagSet) func(dataDir string) (token.Provider, error) {
+	key := fs.String("api-key", "", "OpenAI API key to use instead of the ChatGPT login, with api.openai.com (default $"+token.EnvAPIKey+"; prefer it, as flags show in ps)")
+	openStore := tokenStoreFlag(fs)
+	return func(dataDir string) (token.Provider, error) {
+		k := *key
+		if k == "" {
+			k = os.Getenv(token.EnvAPIKey)
+		}
+		if k != "" {
+			return token.APIKey(k), nil
+		}
+		return openStore(dataDir)
+	}
+}
+
+// tokenStoreFlag registers -token-backend. The returned function opens
+// the OAuth token store in dataDir with it.
+func tokenStoreFlag(fs *flag.FlagSet) func(dataDir string) (*token.Store, error) {
+	backend := fs.String("token-backend", cmp.Or(os.Getenv(token.EnvBackend), "file"), "where OAuth credentials are kept: "+strings.Join(token.Backends, ", ")+" (encrypted-file needs $"+token.EnvPassphrase+")")
+	return func(dataDir string) (*token.Store, error) {
+		return token.OpenStore(filepath.Join(dataDir, "token.json"), *backend)
+	}
+}
+
+// upstreamFlags registers the flags tuning connections to the model
+// provider. The returned function applies them and must be called before
+// the first request.
+func upstreamFlags(fs *flag.FlagSet) func() {
+	var o upstream.Options
+	fs.DurationVar(&o.ConnectTimeout, "upstream-connect-timeout", 15*time.Second, "time limit for connecting to the model provider, TLS included")
+	fs.DurationVar(&o.ReadTimeout, "upstream-read-timeout", 2*time.Minute, "how long a connection to the model provider may go silent before it is dropped")
+	fs.DurationVar(&o.IdleTimeout, "upstream-idle-timeout", 90*time.Second, "how long idle connections to the model provider are kept for reuse")
+	http2 := fs.Bool("upstream-http2", true, "use HTTP/2 to the model provider when offered")
+	fs.DurationVar(&o.DNSCacheTTL, "upstream-dns-ttl", 5*time.Minute, "how long DNS answers for the model provider are cached; negative disables the cache")
+	fs.StringVar(&o.IPFamily, "upstream-ip", "", `address family for the model provider: "prefer-ipv4", "ipv4", "ipv6", or empty for IPv6 first`)
+	fs.DurationVar(&o.FallbackDelay, "upstream-fallback-delay", 300*time.Millisecond, "how long to try the preferred address family before racing the other")
+	fs.StringVar(&o.Proxy, "upstream-proxy", "", "http://, https:// or socks5:// proxy for the model provider (default $HTTPS_PROXY)")
+	return func() {
+		o.DisableHTTP2 = !*http2
+		if err := upstream.Configure(o); err != nil {
+			log.Fatalf("configuring upstream connections: %v", err)
+		}
+	}
+}
+
+// jsonFlag registers the -json flag for machine-readable output.
+func jsonFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("json", false, "print machine-readable JSON")
+}
+
+// printJSON writes v to stdout as indented JSON.
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
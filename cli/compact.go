@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"pi-agent/internal/chat"
+	"pi-agent/internal/maintenance"
+	"pi-agent/internal/store"
+	"pi-agent/internal/token"
+)
+
+// compact implements "pi-agent compact": summarize old conversation
+// history, optimize the indexes and vacuum the database.
+func compact(fs *flag.FlagSet) func() {
+	dataDir := dataDirFlag(fs)
+	model := fs.String("model", "gpt-5.2", "OpenAI model used for summaries")
+	keep := fs.Int("keep", maintenance.DefaultPolicy.Keep, "recent messages to keep verbatim in each conversation")
+	minExcess := fs.Int("min-excess", maintenance.DefaultPolicy.MinExcess, "compact only conversations with at least this many messages beyond -keep")
+	historyDays := fs.Int("history-days", maintenance.DefaultPolicy.HistoryDays, "days to keep deleted messages and earlier versions of edited ones")
+	asJSON := jsonFlag(fs)
+	configureUpstream := upstreamFlags(fs)
+	openCredentials := credentialsFlag(fs)
+
+	return func() {
+		configureUpstream()
+		ts, err := openCredentials(*dataDir)
+		if err != nil {
+			log.Fatalf("initializing token store: %v", err)
+		}
+		if !ts.HasCredentials() {
+			log.Fatalf("no saved credentials; run pi-agent login first or set $%s", token.EnvAPIKey)
+		}
+		db, err := store.Open(filepath.Join(*dataDir, "conversations.db"))
+		if err != nil {
+			log.Fatalf("opening database: %v", err)
+		}
+		defer db.Close()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		c := maintenance.NewCompactor(db, completer(chat.ChatGPT{Tokens: ts}, *model, "You summarize conversation history."))
+		report, err := c.Compact(ctx, maintenance.Policy{Keep: *keep, MinExcess: *minExcess, HistoryDays: *historyDays})
+		if err != nil {
+			log.Fatalf("compacting: %v", err)
+		}
+		if *asJSON {
+			printJSON(report)
+			return
+		}
+		fmt.Printf("Compacted %d conversations, replacing %d messages.\n", report.Conversations, report.MessagesPruned)
+		if report.HistoryPurged > 0 {
+			fmt.Printf("Purged %d deleted messages older than %d days.\n", report.HistoryPurged, *historyDays)
+		}
+		fmt.Printf("Database: %s -> %s (%s reclaimed)\n", formatBytes(report.BytesBefore), formatBytes(report.BytesAfter), formatBytes(report.BytesReclaimed))
+	}
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20 || n <= -1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10 || n <= -1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
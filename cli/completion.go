@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// completion implements "pi-agent completion bash|zsh|fish". The scripts
+// are generated from the command table, so they stay in step with the
+// flags each command defines.
+func completion(fs *flag.FlagSet) func() {
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: pi-agent completion bash|zsh|fish")
+		fmt.Fprintln(fs.Output(), "\nFor example: source <(pi-agent completion bash)")
+	}
+	return func() {
+		switch fs.Arg(0) {
+		case "bash":
+			writeBash(os.Stdout)
+		case "zsh":
+			// zsh's bash compatibility layer runs the bash script as is.
+			fmt.Fprintln(os.Stdout, "autoload -U +X bashcompinit && bashcompinit")
+			writeBash(os.Stdout)
+		case "fish":
+			writeFish(os.Stdout)
+		default:
+			fs.Usage()
+			os.Exit(2)
+		}
+	}
+}
+
+// flagNames returns a command's flags, each with a leading dash.
+func flagNames(c command) []string {
+	fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	c.define(fs)
+	var names []string
+	fs.VisitAll(func(f *flag.Flag) { names = append(names, "-"+f.Name) })
+	return names
+}
+
+func writeBash(w io.Writer) {
+	var names []string
+	for _, c := range commands {
+		names = append(names, c.name)
+	}
+	fmt.Fprintf(w, `_pi_agent() {
+	local cur=${COMP_WORDS[COMP_CWORD]} cmd=serve
+	if [[ $COMP_CWORD -gt 1 && ${COMP_WORDS[1]} != -* ]]; then
+		cmd=${COMP_WORDS[1]}
+	fi
+	if [[ $COMP_CWORD -eq 1 && $cur != -* ]]; then
+		COMPREPLY=($(compgen -W %q -- "$cur"))
+		return
+	fi
+	case $cmd in
+`, strings.Join(names, " "))
+	for _, c := range commands {
+		words := flagNames(c)
+		if c.name == "completion" {
+			words = []string{"bash", "zsh", "fish"}
+		}
+		fmt.Fprintf(w, "\t%s) COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n", c.name, strings.Join(words, " "))
+	}
+	fmt.Fprint(w, `	esac
+}
+complete -o default -F _pi_agent pi-agent
+`)
+}
+
+func writeFish(w io.Writer) {
+	for _, c := range commands {
+		fmt.Fprintf(w, "complete -c pi-agent -f -n __fish_use_subcommand -a %s -d %q\n", c.name, c.summary)
+	}
+	for _, c := range commands {
+		cond := fmt.Sprintf("'__fish_seen_subcommand_from %s'", c.name)
+		if c.name == "serve" {
+			cond = "__fish_use_subcommand"
+		}
+		if c.name == "completion" {
+			fmt.Fprintf(w, "complete -c pi-agent -f -n %s -a 'bash zsh fish'\n", cond)
+			continue
+		}
+		fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+		c.define(fs)
+		fs.VisitAll(func(f *flag.Flag) {
+			fmt.Fprintf(w, "complete -c pi-agent -n %s -o %s -d %q\n", cond, f.Name, firstLine(f.Usage))
+		})
+	}
+}
+
+func firstLine(s string) string {
+	s, _, _ = strings.Cut(s, "\n")
+	return s
+}
@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"pi-agent/internal/doctor"
+)
+
+// doctorCommand implements "pi-agent doctor": check the environment and
+// suggest fixes. It exits with status 1 if any check failed.
+func doctorCommand(fs *flag.FlagSet) func() {
+	var o doctor.Options
+	fs.StringVar(&o.DataDir, "data-dir", defaultDataDir(), "directory for persistent data (tokens, database)")
+	fs.StringVar(&o.ConfigPath, "config", "", "JSON config file to check (default <data-dir>/config.json)")
+	fs.StringVar(&o.AudioBackend, "audio", "", `audio backend to check: "alsa", "pulse", or empty to skip`)
+	fs.StringVar(&o.AudioDevice, "audio-device", "", "audio output device that should be present")
+	fs.BoolVar(&o.QuickDB, "quick", false, "run the faster quick_check instead of a full database integrity check")
+	fs.BoolVar(&o.Offline, "offline", false, "skip the checks that need the network")
+	asJSON := jsonFlag(fs)
+	configureUpstream := upstreamFlags(fs)
+	openCredentials := credentialsFlag(fs)
+
+	return func() {
+		configureUpstream()
+		// The credentials check falls back to the token file if the
+		// configured store cannot be opened.
+		ts, err := openCredentials(o.DataDir)
+		if err != nil {
+			log.Printf("opening credentials: %v", err)
+		} else {
+			o.Tokens = ts
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		checks := doctor.Run(ctx, o)
+		if *asJSON {
+			printJSON(checks)
+		} else {
+			for _, c := range checks {
+				fmt.Printf("[%-4s] %-24s %s\n", c.Status, c.Name, c.Detail)
+				if c.Fix != "" {
+					fmt.Printf("       %-24s fix: %s\n", "", c.Fix)
+				}
+			}
+		}
+		if !doctor.Healthy(checks) {
+			os.Exit(1)
+		}
+	}
+}
+
+// selfTest logs the checks that did not pass, for serve at startup.
+func selfTest(ctx context.Context, o doctor.Options) {
+	for _, c := range doctor.Run(ctx, o) {
+		if c.Status != doctor.Warn && c.Status != doctor.Fail {
+			continue
+		}
+		if c.Fix != "" {
+			log.Printf("self-test: %s %s: %s; %s", c.Status, c.Name, c.Detail, c.Fix)
+		} else {
+			log.Printf("self-test: %s %s: %s", c.Status, c.Name, c.Detail)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"pi-agent/internal/store"
+	"pi-agent/internal/vault"
+)
+
+// export implements "pi-agent export": write conversations, people and
+// bookmarks into a Markdown vault once.
+func export(fs *flag.FlagSet) func() {
+	dataDir := dataDirFlag(fs)
+	asJSON := jsonFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: pi-agent export [flags] <vault directory>")
+		fs.PrintDefaults()
+	}
+
+	return func() {
+		if fs.NArg() != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		dir, err := expandPath(fs.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		db, err := store.Open(filepath.Join(*dataDir, "conversations.db"))
+		if err != nil {
+			log.Fatalf("opening database: %v", err)
+		}
+		defer db.Close()
+
+		report, err := vault.NewExporter(db, dir).Export()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *asJSON {
+			printJSON(report)
+			return
+		}
+		fmt.Printf("Wrote %d notes to %s (%d unchanged).\n", report.Written, dir, report.Unchanged)
+	}
+}
@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"pi-agent/internal/auth"
+)
+
+// hashPassword implements "pi-agent hash-password": read a password from
+// standard input and print the hash to put in a config auth user's
+// password_hash.
+func hashPassword(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprint(os.Stderr, "Password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		fmt.Fprintln(os.Stderr)
+		password := strings.TrimRight(line, "\r\n")
+		if password == "" {
+			if err != nil {
+				log.Fatalf("reading password: %v", err)
+			}
+			log.Fatal("empty password")
+		}
+		hash, err := auth.HashPassword(password)
+		if err != nil {
+			log.Fatalf("hashing password: %v", err)
+		}
+		fmt.Println(hash)
+	}
+}
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"pi-agent/internal/importer"
+	"pi-agent/internal/store"
+)
+
+// importCommand implements "pi-agent import": load conversation history
+// from another tool's export.
+func importCommand(fs *flag.FlagSet) func() {
+	dataDir := dataDirFlag(fs)
+	format := fs.String("format", importer.FormatAuto, "export format: auto, chatgpt, openwebui or jsonl")
+	asJSON := jsonFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: pi-agent import [flags] <export file>")
+		fs.PrintDefaults()
+	}
+
+	return func() {
+		if fs.NArg() != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		data, err := os.ReadFile(fs.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		db, err := store.Open(filepath.Join(*dataDir, "conversations.db"))
+		if err != nil {
+			log.Fatalf("opening database: %v", err)
+		}
+		defer db.Close()
+
+		report, err := importer.Import(db, *format, data)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *asJSON {
+			printJSON(report)
+			return
+		}
+		fmt.Printf("Imported %d conversations (%d messages) from a %s export; skipped %d already present.\n",
+			report.Conversations, report.Messages, report.Format, report.Skipped)
+	}
+}
@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"pi-agent/internal/chat"
+	"pi-agent/internal/store"
+)
+
+// replayRound is one recorded exchange as the chat parser reads it.
+type replayRound struct {
+	Round     int             `json:"round"`
+	Status    int             `json:"status"`
+	Request   json.RawMessage `json:"request,omitempty"`
+	Content   string          `json:"content"`
+	ToolCalls []chat.ToolCall `json:"tool_calls,omitempty"`
+	Completed bool            `json:"completed"`
+	Truncated bool            `json:"truncated,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// replay implements "pi-agent replay": run a recorded upstream transcript
+// back through the chat parser, without calling the model, and check the
+// result against the stored reply.
+func replay(fs *flag.FlagSet) func() {
+	dataDir := dataDirFlag(fs)
+	asJSON := jsonFlag(fs)
+	showRequest := fs.Bool("request", false, "also print the recorded request bodies")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: pi-agent replay [flags] <message id | SSE file>")
+		fmt.Fprintln(fs.Output(), "\nTranscripts are recorded by \"pi-agent serve -record-transcripts\". A file")
+		fmt.Fprintln(fs.Output(), "holds a raw Responses API event stream, e.g. captured with curl.")
+		fs.PrintDefaults()
+	}
+
+	return func() {
+		if fs.NArg() != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+
+		var exchanges []store.Exchange
+		var stored *store.Message
+		if id, err := strconv.ParseInt(fs.Arg(0), 10, 64); err == nil {
+			db, err := store.Open(filepath.Join(*dataDir, "conversations.db"))
+			if err != nil {
+				log.Fatalf("opening database: %v", err)
+			}
+			defer db.Close()
+			exchanges, err = db.Transcript(id)
+			if errors.Is(err, store.ErrNotFound) {
+				log.Fatalf("no transcript recorded for message %d", id)
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+			if stored, err = db.Message(id); err != nil && !errors.Is(err, store.ErrNotFound) {
+				log.Fatal(err)
+			}
+		} else {
+			data, err := os.ReadFile(fs.Arg(0))
+			if err != nil {
+				log.Fatal(err)
+			}
+			exchanges = []store.Exchange{{Status: 200, Response: data}}
+		}
+
+		var rounds []replayRound
+		var content strings.Builder
+		for _, x := range exchanges {
+			r := replayRound{Round: x.Round, Status: x.Status, Truncated: x.Truncated}
+			if *showRequest {
+				r.Request = x.Request
+			}
+			if x.Status != 200 {
+				r.Error = strings.TrimSpace(string(x.Response))
+			} else if err := chat.ParseStream(bytes.NewReader(x.Response), func(d chat.StreamDelta) {
+				switch {
+				case d.ToolCall != nil:
+					r.ToolCalls = append(r.ToolCalls, *d.ToolCall)
+				case d.Done:
+					r.Completed = true
+				default:
+					r.Content += d.Content
+				}
+			}); err != nil {
+				r.Error = err.Error()
+			}
+			content.WriteString(r.Content)
+			rounds = append(rounds, r)
+		}
+		// The engine stores what every round streamed, joined together.
+		matches := stored == nil || stored.Content == content.String()
+
+		if *asJSON {
+			out := map[string]any{"rounds": rounds}
+			if stored != nil {
+				out["message_id"] = stored.ID
+				out["matches_stored"] = matches
+			}
+			printJSON(out)
+		} else {
+			for _, r := range rounds {
+				fmt.Printf("--- round %d (HTTP %d)\n", r.Round, r.Status)
+				if len(r.Request) > 0 {
+					fmt.Printf("request: %s\n", r.Request)
+				}
+				if r.Content != "" {
+					fmt.Println(r.Content)
+				}
+				for _, c := range r.ToolCalls {
+					fmt.Printf("tool call %s %s(%s)\n", c.CallID, c.Name, c.Arguments)
+				}
+				switch {
+				case r.Error != "":
+					fmt.Printf("error: %s\n", r.Error)
+				case r.Truncated:
+					fmt.Println("(recording truncated)")
+				case !r.Completed:
+					fmt.Println("(stream ended without response.completed)")
+				}
+			}
+			if stored != nil {
+				if matches {
+					fmt.Printf("\nReplay matches stored message %d.\n", stored.ID)
+				} else {
+					fmt.Printf("\nReplay differs from stored message %d, which is:\n%s\n", stored.ID, stored.Content)
+				}
+			}
+		}
+		if !matches {
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"pi-agent/internal/store"
+	"pi-agent/internal/token"
+)
+
+// login implements "pi-agent login": run the OAuth flow, replacing any
+// saved credentials of the default account or the one -account names.
+func login(fs *flag.FlagSet) func() {
+	dataDir := dataDirFlag(fs)
+	openStore := tokenStoreFlag(fs)
+	account := fs.String("account", "", "save the credentials as this named account (see \"pi-agent accounts\")")
+	headless := fs.Bool("headless", false, "use device code flow for headless auth (no browser needed)")
+	asJSON := jsonFlag(fs)
+	configureUpstream := upstreamFlags(fs)
+
+	return func() {
+		configureUpstream()
+		ts, err := openStore(*dataDir)
+		if err != nil {
+			log.Fatalf("initializing token store: %v", err)
+		}
+		if err := authenticate(ts, *account, *headless); err != nil {
+			log.Fatal(err)
+		}
+		if *asJSON {
+			var p token.Provider = ts
+			if *account != "" {
+				if p, err = ts.Account(*account); err != nil {
+					log.Fatal(err)
+				}
+			}
+			printJSON(map[string]string{"account_id": p.AccountID()})
+		}
+	}
+}
+
+// statusReport is the output of "pi-agent status".
+type statusReport struct {
+	DataDir        string    `json:"data_dir"`
+	LoggedIn       bool      `json:"logged_in"`
+	APIKey         bool      `json:"api_key,omitempty"` // using an API key rather than a ChatGPT login
+	AccountID      string    `json:"account_id,omitempty"`
+	TokenExpiresAt time.Time `json:"token_expires_at,omitzero"`
+	Conversations  int       `json:"conversations"`
+	DatabaseBytes  int64     `json:"database_bytes"`
+	Server         string    `json:"server"` // "ok", or why it could not be reached
+}
+
+// status implements "pi-agent status".
+func status(fs *flag.FlagSet) func() {
+	dataDir := dataDirFlag(fs)
+	api := serverFlags(fs)
+	asJSON := jsonFlag(fs)
+	openCredentials := credentialsFlag(fs)
+
+	return func() {
+		r := statusReport{DataDir: *dataDir}
+		ts, err := openCredentials(*dataDir)
+		if err != nil {
+			log.Fatalf("initializing token store: %v", err)
+		}
+		r.LoggedIn = ts.HasCredentials()
+		r.APIKey = ts.IsAPIKey()
+		r.AccountID = ts.AccountID()
+		r.TokenExpiresAt = ts.ExpiresAt()
+
+		db, err := store.Open(filepath.Join(*dataDir, "conversations.db"))
+		if err != nil {
+			log.Fatalf("opening database: %v", err)
+		}
+		defer db.Close()
+		convs, err := db.Conversations()
+		if err != nil {
+			log.Fatal(err)
+		}
+		r.Conversations = len(convs)
+		if r.DatabaseBytes, err = db.Size(); err != nil {
+			log.Fatal(err)
+		}
+
+		r.Server = "ok"
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		if _, err := api().Health(ctx); err != nil {
+			r.Server = err.Error()
+		}
+
+		if *asJSON {
+			printJSON(r)
+			return
+		}
+		fmt.Printf("Data directory: %s\n", r.DataDir)
+		switch {
+		case r.APIKey:
+			fmt.Println("Logged in:      using an OpenAI API key")
+		case r.LoggedIn:
+			fmt.Printf("Logged in:      yes (account %s, token expires %s)\n", r.AccountID, r.TokenExpiresAt.Local().Format(time.DateTime))
+		default:
+			fmt.Println("Logged in:      no (run pi-agent login)")
+		}
+		fmt.Printf("Conversations:  %d\n", r.Conversations)
+		fmt.Printf("Database size:  %s\n", formatBytes(r.DatabaseBytes))
+		fmt.Printf("Server:         %s\n", r.Server)
+	}
+}
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+)
+
+// wait implements "pi-agent wait": block until the running agent reports
+// itself ready, for scripts and services ordered after it, e.g. as a
+// systemd ExecStartPre.
+func wait(fs *flag.FlagSet) func() {
+	api := serverFlags(fs)
+	timeout := fs.Duration("timeout", time.Minute, "give up after this long (0 waits forever)")
+	interval := fs.Duration("interval", time.Second, "time between health checks")
+	quiet := fs.Bool("quiet", false, "print nothing once the agent is ready")
+	asJSON := jsonFlag(fs)
+
+	return func() {
+		ctx := context.Background()
+		if *timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, *timeout)
+			defer cancel()
+		}
+		c := api()
+		if err := c.WaitUntilReady(ctx, *interval); err != nil {
+			log.Fatalf("agent not ready: %v", err)
+		}
+		if *quiet {
+			return
+		}
+		h, err := c.Health(ctx)
+		if err != nil {
+			log.Fatalf("agent not ready: %v", err)
+		}
+		if *asJSON {
+			printJSON(h)
+			return
+		}
+		if h.Version != "" {
+			fmt.Printf("ready (version %s, up %s)\n", h.Version, h.Uptime())
+		} else {
+			fmt.Printf("ready (up %s)\n", h.Uptime())
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Attachment is a file uploaded to the server for chat messages to refer
+// to.
+type Attachment struct {
+	ID          string    `json:"id"`
+	User        string    `json:"user,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Progress is called as an upload is sent with the bytes sent so far and
+// the total, or -1 if the total is not known.
+type Progress func(sent, total int64)
+
+// Upload stores body as an attachment named name for user, who is
+// ignored when the server signs users in. size is the body's length, or
+// -1 if unknown; onProgress, if non-nil, follows the upload.
+func (c *Client) Upload(ctx context.Context, user, name, contentType string, body io.Reader, size int64, onProgress Progress) (*Attachment, error) {
+	q := url.Values{"name": {name}}
+	if user != "" {
+		q.Set("user", user)
+	}
+	if onProgress != nil {
+		body = &progressReader{r: body, total: size, onProgress: onProgress}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/attachments?"+q.Encode(), body)
+	if err != nil {
+		return nil, err
+	}
+	if size >= 0 {
+		req.ContentLength = size
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return nil, readError(resp)
+	}
+	var a Attachment
+	if err := json.NewDecoder(resp.Body).Decode(&a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// UploadFile uploads the file at path as an attachment for user, typed by
+// its extension or, failing that, its first bytes.
+func (c *Client) UploadFile(ctx context.Context, user, path string, onProgress Progress) (*Attachment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		head := make([]byte, 512)
+		n, _ := io.ReadFull(f, head)
+		contentType = http.DetectContentType(head[:n])
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	return c.Upload(ctx, user, filepath.Base(path), contentType, f, info.Size(), onProgress)
+}
+
+// ChatFiles uploads files, such as photos for the model to look at, and
+// sends r with them attached. onProgress, if non-nil, is called for each
+// file as it uploads; onContent is as for Chat.
+func (c *Client) ChatFiles(ctx context.Context, r Request, paths []string, onProgress func(path string, sent, total int64), onContent func(string)) (*Reply, error) {
+	for _, path := range paths {
+		var progress Progress
+		if onProgress != nil {
+			progress = func(sent, total int64) { onProgress(path, sent, total) }
+		}
+		a, err := c.UploadFile(ctx, r.User, path, progress)
+		if err != nil {
+			return nil, fmt.Errorf("uploading %s: %w", path, err)
+		}
+		r.Attachments = append(r.Attachments, a.ID)
+	}
+	return c.Chat(ctx, r, onContent)
+}
+
+// Download writes an attachment's content to w and returns its name and
+// type as the server serves them.
+func (c *Client) Download(ctx context.Context, id string, w io.Writer) (*Attachment, error) {
+	resp, err := c.fetch(ctx, "/attachments/"+url.PathEscape(id), w)
+	if err != nil {
+		return nil, err
+	}
+	a := &Attachment{ID: id, ContentType: resp.Header.Get("Content-Type"), Size: resp.ContentLength}
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		a.Name = params["filename"]
+	}
+	return a, nil
+}
+
+// Chart writes the PNG chart of a recorded sensor over period, one of
+// "1h", "24h", "7d" and "30d", to w.
+func (c *Client) Chart(ctx context.Context, sensor, period string, w io.Writer) error {
+	_, err := c.fetch(ctx, "/charts/"+url.PathEscape(sensor)+".png?period="+url.QueryEscape(period), w)
+	return err
+}
+
+// fetch copies the body of a GET request to w.
+func (c *Client) fetch(ctx context.Context, path string, w io.Writer) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, readError(resp)
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// readError turns an error response's JSON body into an Error.
+func readError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var e struct{ Error string }
+	if json.Unmarshal(data, &e) != nil || e.Error == "" {
+		e.Error = string(bytes.TrimSpace(data))
+	}
+	return &Error{Status: resp.StatusCode, Message: e.Error}
+}
+
+type progressReader struct {
+	r          io.Reader
+	sent       int64
+	total      int64
+	onProgress Progress
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.sent += int64(n)
+		p.onProgress(p.sent, p.total)
+	}
+	return n, err
+}
@@ -0,0 +1,227 @@
+// Package client talks to a running pi-agent server over HTTP or its Unix
+// socket.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultURL is where a server started with the default flags listens.
+const DefaultURL = "http://localhost:8080"
+
+// Client is a pi-agent API client.
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// New returns a client for the server at baseURL, e.g.
+// "http://localhost:8080".
+func New(baseURL string) *Client {
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), http: http.DefaultClient}
+}
+
+// NewUnix returns a client dialing the server's Unix socket.
+func NewUnix(socket string) *Client {
+	return &Client{baseURL: "http://pi-agent", http: &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}}}
+}
+
+// Request is a chat message sent to the agent.
+type Request struct {
+	Message        string `json:"message"`
+	ConversationID string `json:"conversation_id,omitempty"`
+	Persona        string `json:"persona,omitempty"`
+	User           string `json:"user,omitempty"`
+	AudioRef       string `json:"audio_ref,omitempty"`
+	Speaker        string `json:"speaker,omitempty"` // the sender, in a translation relay
+	// Attachments are the IDs of uploaded files sent with the message;
+	// see Upload and ChatFiles.
+	Attachments []string `json:"attachments,omitempty"`
+	// Account names the server's ChatGPT account to answer with; empty
+	// uses its default.
+	Account string `json:"account,omitempty"`
+	// AdminPIN lets a user whose default persona is restricted pick
+	// another Persona.
+	AdminPIN string `json:"admin_pin,omitempty"`
+	// IdempotencyKey, if set, is sent as the Idempotency-Key header: a
+	// retry with the same key gets the first reply again rather than
+	// posting the message twice.
+	IdempotencyKey string `json:"-"`
+	// ConversationKey is the key of an encrypted conversation; see
+	// EncryptConversation.
+	ConversationKey []byte `json:"-"`
+}
+
+// Citation points at a knowledge-base passage the reply drew on.
+type Citation struct {
+	Marker     int     `json:"marker"`
+	DocumentID int64   `json:"document_id"`
+	ChunkID    int64   `json:"chunk_id"`
+	Source     string  `json:"source"`
+	Title      string  `json:"title"`
+	Score      float64 `json:"score"`
+}
+
+// CodeBlock describes a fenced code block in a reply. It can be saved or
+// run through /messages/{message_id}/code/{index}.
+type CodeBlock struct {
+	Index    int    `json:"index"`
+	Language string `json:"language"`
+	Filename string `json:"filename"`
+	Lines    int    `json:"lines"`
+}
+
+// Reply is the agent's complete answer to a Request.
+type Reply struct {
+	Content    string      `json:"reply"`
+	Citations  []Citation  `json:"citations,omitempty"`
+	MessageID  int64       `json:"message_id,omitempty"` // set if the reply has code blocks
+	CodeBlocks []CodeBlock `json:"code_blocks,omitempty"`
+	// Fallback names the local model that answered because the primary
+	// provider was unavailable, or is empty.
+	Fallback string `json:"fallback,omitempty"`
+	// Voice and Language are the text-to-speech voice and language the
+	// user's settings ask replies to be read in, if any.
+	Voice    string `json:"voice,omitempty"`
+	Language string `json:"language,omitempty"`
+	// Speaker is the participant a translation is for, in a translation
+	// relay.
+	Speaker string `json:"speaker,omitempty"`
+}
+
+// Error is returned when the server rejects a request or the reply fails
+// part way through the stream.
+type Error struct {
+	Status  int // HTTP status, or 0 if the error arrived in the stream
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Status == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%d %s: %s", e.Status, http.StatusText(e.Status), e.Message)
+}
+
+// Speech holds a user's voice settings.
+type Speech struct {
+	User      string   `json:"user"`
+	Languages []string `json:"languages"` // recognition hints, most used first
+	Voice     string   `json:"voice,omitempty"`
+	Language  string   `json:"language,omitempty"`
+}
+
+// Speech returns a user's voice settings, for configuring speech
+// recognition before their words are transcribed.
+func (c *Client) Speech(ctx context.Context, user string) (*Speech, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/speech?user="+url.QueryEscape(user), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e struct{ Error string }
+		json.NewDecoder(resp.Body).Decode(&e)
+		return nil, &Error{Status: resp.StatusCode, Message: e.Error}
+	}
+	var sp Speech
+	if err := json.NewDecoder(resp.Body).Decode(&sp); err != nil {
+		return nil, err
+	}
+	return &sp, nil
+}
+
+// Chat sends a message and waits for the reply. If onContent is non-nil it
+// is called with each piece of the reply as it streams in.
+func (c *Client) Chat(ctx context.Context, r Request, onContent func(string)) (*Reply, error) {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/chat", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.IdempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", r.IdempotencyKey)
+	}
+	setConversationKey(req, r.ConversationKey)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e struct{ Error string }
+		json.NewDecoder(resp.Body).Decode(&e)
+		return nil, &Error{Status: resp.StatusCode, Message: e.Error}
+	}
+
+	// The reply is an SSE stream of {"content"}, {"fallback"},
+	// {"citations"}, {"message_id", "code_blocks"}, {"speaker"} and
+	// {"error"} events ending with [DONE].
+	reply := Reply{Voice: resp.Header.Get("X-Speech-Voice"), Language: resp.Header.Get("X-Speech-Language")}
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		data, ok := strings.CutPrefix(sc.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			return &reply, nil
+		}
+		var ev struct {
+			Content    string      `json:"content"`
+			Citations  []Citation  `json:"citations"`
+			MessageID  int64       `json:"message_id"`
+			CodeBlocks []CodeBlock `json:"code_blocks"`
+			Fallback   string      `json:"fallback"`
+			Speaker    string      `json:"speaker"`
+			Error      string      `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return &reply, fmt.Errorf("invalid event %q: %w", data, err)
+		}
+		if ev.Error != "" {
+			return &reply, &Error{Message: ev.Error}
+		}
+		reply.Content += ev.Content
+		reply.Citations = append(reply.Citations, ev.Citations...)
+		if ev.Fallback != "" {
+			reply.Fallback = ev.Fallback
+		}
+		if ev.Speaker != "" {
+			reply.Speaker = ev.Speaker
+		}
+		if ev.MessageID != 0 {
+			reply.MessageID, reply.CodeBlocks = ev.MessageID, ev.CodeBlocks
+		}
+		if onContent != nil && ev.Content != "" {
+			onContent(ev.Content)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return &reply, err
+	}
+	return &reply, errors.New("stream ended before the reply was complete")
+}
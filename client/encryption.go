@@ -0,0 +1,57 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+)
+
+// KeySize is the length of a conversation key.
+const KeySize = 32
+
+// NewConversationKey returns a random conversation key. Whoever holds it
+// can read the conversation, and without it nobody can, so keep it safe:
+// the server does not store it.
+func NewConversationKey() []byte {
+	key := make([]byte, KeySize)
+	rand.Read(key)
+	return key
+}
+
+// EncryptConversation encrypts a conversation's messages with key, now
+// and from then on. Requests reading or adding to it must then carry the
+// key, as Request.ConversationKey.
+func (c *Client) EncryptConversation(ctx context.Context, conversationID string, key []byte) error {
+	return c.encryption(ctx, http.MethodPut, conversationID, key)
+}
+
+// DecryptConversation stores an encrypted conversation as plain text
+// again.
+func (c *Client) DecryptConversation(ctx context.Context, conversationID string, key []byte) error {
+	return c.encryption(ctx, http.MethodDelete, conversationID, key)
+}
+
+func (c *Client) encryption(ctx context.Context, method, conversationID string, key []byte) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+"/conversations/"+url.PathEscape(conversationID)+"/encryption", nil)
+	if err != nil {
+		return err
+	}
+	setConversationKey(req, key)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readError(resp)
+	}
+	return nil
+}
+
+func setConversationKey(req *http.Request, key []byte) {
+	if len(key) > 0 {
+		req.Header.Set("X-Conversation-Key", base64.StdEncoding.EncodeToString(key))
+	}
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Health is the server's report on itself.
+type Health struct {
+	Status        string            `json:"status"` // "ok" when ready
+	Version       string            `json:"version,omitempty"`
+	StartedAt     time.Time         `json:"started_at"`
+	UptimeSeconds int64             `json:"uptime_seconds"`
+	Checks        map[string]string `json:"checks,omitempty"` // "ok" or what is wrong, by check
+}
+
+// Uptime is how long the server has been running.
+func (h *Health) Uptime() time.Duration {
+	return time.Duration(h.UptimeSeconds) * time.Second
+}
+
+// Health fetches the server's health. A server that answers but is not
+// ready returns its report along with an *Error.
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/health", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var h Health
+	if err := json.NewDecoder(resp.Body).Decode(&h); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, &Error{Status: resp.StatusCode, Message: "health check failed"}
+		}
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK || h.Status != "ok" {
+		return &h, &Error{Status: resp.StatusCode, Message: h.problem()}
+	}
+	return &h, nil
+}
+
+// problem describes the failing checks.
+func (h *Health) problem() string {
+	for name, result := range h.Checks {
+		if result != "ok" {
+			return fmt.Sprintf("%s: %s", name, result)
+		}
+	}
+	return "server is " + h.Status
+}
+
+// WaitUntilReady polls the server's health every interval until it is
+// ready or ctx is done, for programs that start alongside the server.
+// It returns the last failure with ctx's error if the server never
+// becomes ready.
+func (c *Client) WaitUntilReady(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	var last error
+	for {
+		// Each poll is bounded so that a server that accepts connections
+		// but hangs does not stall the wait.
+		pollCtx, cancel := context.WithTimeout(ctx, max(interval, 5*time.Second))
+		_, err := c.Health(pollCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() == nil {
+			last = err
+		}
+		select {
+		case <-ctx.Done():
+			if last == nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("%w: %w", ctx.Err(), last)
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Transcript is the text the server's speech recognizer heard.
+type Transcript struct {
+	Text     string `json:"text"`
+	Language string `json:"language,omitempty"`
+	// Fallback names the recognizer that answered because the ones
+	// before it failed, or is empty.
+	Fallback string `json:"fallback,omitempty"`
+}
+
+// Transcribe sends a recording, best as 16 kHz mono WAV, to the server's
+// speech recognizer. user, if set, gives it the user's languages as
+// hints, and language, if set, names the one spoken instead.
+func (c *Client) Transcribe(ctx context.Context, user, language string, audio io.Reader) (*Transcript, error) {
+	q := url.Values{}
+	if user != "" {
+		q.Set("user", user)
+	}
+	if language != "" {
+		q.Set("language", language)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/speech/transcribe?"+q.Encode(), audio)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "audio/wav")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, readError(resp)
+	}
+	var t Transcript
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Utterance is text for the server to read aloud. User chooses the voice
+// and language from the user's voice settings; Voice and Language
+// override them.
+type Utterance struct {
+	Text     string `json:"text"`
+	User     string `json:"user,omitempty"`
+	Voice    string `json:"voice,omitempty"`
+	Language string `json:"language,omitempty"`
+}
+
+// Synthesize has the server's speech synthesizer read u, writes the audio
+// to w and returns its content type and, if a fallback synthesizer
+// answered, its name.
+func (c *Client) Synthesize(ctx context.Context, u Utterance, w io.Writer) (contentType, fallback string, err error) {
+	body, err := json.Marshal(u)
+	if err != nil {
+		return "", "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/speech/synthesize", bytes.NewReader(body))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", readError(resp)
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return "", "", err
+	}
+	return resp.Header.Get("Content-Type"), resp.Header.Get("X-Speech-Fallback"), nil
+}
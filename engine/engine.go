@@ -0,0 +1,801 @@
+// Package engine runs pi-agent conversations: it stores messages, builds
+// the system prompt, calls the model and any tools it asks for, and saves
+// the reply. The HTTP server is one front end to it; other programs can
+// embed it directly without running the server.
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"pi-agent/internal/audio"
+	"pi-agent/internal/chat"
+	"pi-agent/internal/config"
+	"pi-agent/internal/policy"
+	"pi-agent/internal/rag"
+	"pi-agent/internal/redact"
+	"pi-agent/internal/store"
+	"pi-agent/internal/token"
+	"pi-agent/internal/tools"
+)
+
+// maxToolRounds bounds how many consecutive rounds of tool calls a single
+// turn may trigger before the response is cut off.
+const maxToolRounds = 8
+
+// ErrAuth marks failures to obtain an upstream access token.
+var ErrAuth = errors.New("authentication error")
+
+// ErrPrivate marks turns in a private conversation that cannot be
+// answered because no local provider is available.
+var ErrPrivate = errors.New("private conversation")
+
+// ContextProvider returns live context appended to the system prompt on
+// every turn, or an empty string when there is nothing to add.
+type ContextProvider func(ctx context.Context) string
+
+// Observer is told about assistant replies as they are written, e.g. to
+// mirror them elsewhere. Its methods are called while the reply streams
+// and must not block.
+type Observer interface {
+	Delta(conversationID, content string) // a fragment of a reply
+	Reply(conversationID, content string) // a complete, stored reply
+}
+
+// ProgressObserver is an Observer that is also told how far each turn has
+// got, e.g. to show a typing indicator in a chat front end. Like the
+// Observer methods, Progress must not block.
+type ProgressObserver interface {
+	Progress(conversationID string, p Progress)
+}
+
+// Config holds engine configuration.
+type Config struct {
+	Model        string // OpenAI model, e.g. "gpt-4o"
+	SystemPrompt string // optional system prompt
+
+	// Provider is the model backend; by default the ChatGPT backend,
+	// authenticated with the engine's token store.
+	Provider chat.Provider
+	// Private answers conversations in privacy mode (see
+	// store.DB.SetPrivate), by default Provider; either way only its
+	// local part, as chat.LocalOnly finds it, is used, so private
+	// conversations never reach a cloud model.
+	Private chat.Provider
+	// Accounts, if set, returns the provider for a named account, for
+	// turns whose profile names one; without it they are refused.
+	Accounts func(name string) (chat.Provider, error)
+	// Redactor, if set, replaces secrets in the messages and tool outputs
+	// sent to providers that are not local with placeholders, and fills
+	// them back in as the reply streams.
+	Redactor *redact.Redactor
+
+	Tools     *tools.Registry // optional; tools offered to the model
+	Earcons   *audio.Earcons  // optional; plays cues while thinking and on errors
+	Knowledge *rag.Index      // optional; relevant passages are added to the system prompt
+	Profiles  config.Profiles // personas, per-user defaults and model tiers
+	Policy    *policy.Policy  // optional; enforces persona restrictions
+
+	PromptContext []ContextProvider // live context appended to the system prompt
+	Observers     []Observer        // told about every stored reply
+	Middleware    Middleware        // optional; may change prompts, replies and tool calls
+
+	// Variables, if set, fills in {{variables}} in the system prompt on
+	// every turn; see package promptvars.
+	Variables func(ctx context.Context, prompt string) string
+
+	// HistoryChars caps how much conversation history is sent with each
+	// request, newest messages first (default DefaultHistoryChars). Older
+	// messages are left to the compaction summary.
+	HistoryChars int
+
+	// RecordTranscripts keeps the raw upstream requests and responses
+	// behind each stored reply, for replaying with "pi-agent replay".
+	// They include the whole prompt, so this is for debugging only.
+	RecordTranscripts bool
+
+	// SuggestModel is the model Suggest asks for follow-up prompts,
+	// usually a cheap one; empty uses the turn's.
+	SuggestModel string
+}
+
+// DefaultHistoryChars is the default history budget, roughly 12k tokens.
+const DefaultHistoryChars = 48000
+
+// Engine runs conversational turns against the model.
+type Engine struct {
+	cfg    Config
+	db     *store.DB
+	closer func() error
+}
+
+// New creates an engine using the given credentials and database. The
+// credentials may be nil if cfg.Provider is set.
+func New(cfg Config, ts token.Provider, db *store.DB) *Engine {
+	if cfg.Provider == nil {
+		cfg.Provider = chat.ChatGPT{Tokens: ts}
+	}
+	if cfg.HistoryChars <= 0 {
+		cfg.HistoryChars = DefaultHistoryChars
+	}
+	return &Engine{cfg: cfg, db: db}
+}
+
+// Open creates an engine from a pi-agent data directory, using the API
+// key in $OPENAI_API_KEY or else the credentials saved by "pi-agent
+// login", and the conversation database there. The credentials are only
+// needed if cfg.Provider is unset. The engine must be closed when done.
+func Open(dataDir string, cfg Config) (*Engine, error) {
+	ts, err := token.Open(filepath.Join(dataDir, "token.json"), os.Getenv(token.EnvBackend), os.Getenv(token.EnvAPIKey))
+	if err != nil {
+		return nil, fmt.Errorf("initializing token store: %w", err)
+	}
+	if cfg.Provider == nil && !ts.HasCredentials() {
+		return nil, fmt.Errorf("%w: no saved credentials in %s", ErrAuth, dataDir)
+	}
+	db, err := store.Open(filepath.Join(dataDir, "conversations.db"))
+	if err != nil {
+		return nil, err
+	}
+	e := New(cfg, ts, db)
+	e.closer = db.Close
+	return e, nil
+}
+
+// Close releases the database opened by Open. It does nothing for engines
+// created with New.
+func (e *Engine) Close() error {
+	if e.closer == nil {
+		return nil
+	}
+	return e.closer()
+}
+
+// DB returns the engine's conversation database.
+func (e *Engine) DB() *store.DB { return e.db }
+
+// Provider returns the engine's model backend.
+func (e *Engine) Provider() chat.Provider { return e.cfg.Provider }
+
+// Turn is a conversational turn that has been accepted and is ready to be
+// sent to the model.
+type Turn struct {
+	convID    string
+	provider  chat.Provider
+	profile   Profile
+	message   string // the user message that started the turn
+	messages  []chat.Message
+	replyID   int64
+	citations []store.Citation
+	fallback  string
+	usage     chat.Usage
+	onTool    func(ToolEvent)
+	progress  func(Progress)
+	dryRun    bool        // not stored and offered no tools; see Prepare
+	room      *store.Room // set in rooms
+	speaker   string      // who sent the message, in rooms
+}
+
+// ToolEvent reports a tool the model called during a turn, once it has
+// run.
+type ToolEvent struct {
+	CallID    string        `json:"call_id"`
+	Name      string        `json:"name"`
+	Arguments string        `json:"arguments"`
+	Output    string        `json:"output"`
+	Duration  time.Duration `json:"-"`
+}
+
+// The stages of a turn, as Progress reports them.
+const (
+	StageQueued       = "queued"        // accepted, preparing the prompt
+	StageModelStarted = "model_started" // a request to the model is under way
+	StageToolRunning  = "tool_running"  // a tool the model asked for is running
+	StageTokens       = "tokens"        // the reply is streaming
+)
+
+// tokensEvery is how many more estimated reply tokens it takes to report
+// StageTokens again.
+const tokensEvery = 25
+
+// Progress reports how far a turn has got, so clients of slow models can
+// tell it is still alive.
+type Progress struct {
+	Stage string `json:"stage"`
+	// Tool names the tool in StageToolRunning.
+	Tool string `json:"tool,omitempty"`
+	// Round counts the requests to the model so far; it is 0 while
+	// queued.
+	Round int `json:"round,omitempty"`
+	// Tokens estimates the reply tokens written so far, at about four
+	// characters each.
+	Tokens int `json:"tokens_so_far"`
+}
+
+// ConversationID returns the conversation the turn belongs to.
+func (t *Turn) ConversationID() string { return t.convID }
+
+// ReplyID returns the ID of the stored reply, or 0 if there was none. It is
+// set once Run returns.
+func (t *Turn) ReplyID() int64 { return t.replyID }
+
+// Citations returns the retrieved passages the reply cited. It is set once
+// Run returns.
+func (t *Turn) Citations() []store.Citation { return t.citations }
+
+// Fallback names the fallback provider if it wrote any of the reply
+// because the primary provider failed, or is empty. It is set once Run
+// returns.
+func (t *Turn) Fallback() string { return t.fallback }
+
+// Usage returns the tokens the turn consumed over all its requests, as
+// far as the provider reports them. It is set once Run returns.
+func (t *Turn) Usage() chat.Usage { return t.usage }
+
+// Speaker returns the persona the reply is attributed to in a room with
+// personas, or "".
+func (t *Turn) Speaker() string {
+	if t.room == nil {
+		return ""
+	}
+	return t.profile.Persona
+}
+
+// OnTool sets a function Run calls after each tool call, before the
+// output is sent back to the model.
+func (t *Turn) OnTool(fn func(ToolEvent)) { t.onTool = fn }
+
+// OnProgress sets a function Run calls as the turn moves through its
+// stages and, every few tokens, as the reply streams.
+func (t *Turn) OnProgress(fn func(Progress)) { t.progress = fn }
+
+// report passes p to the turn's progress function and to the observers
+// that want it.
+func (e *Engine) report(t *Turn, p Progress) {
+	if t.progress != nil {
+		t.progress(p)
+	}
+	if t.dryRun {
+		return
+	}
+	for _, o := range e.cfg.Observers {
+		if po, ok := o.(ProgressObserver); ok {
+			po.Progress(t.convID, p)
+		}
+	}
+}
+
+// Start checks the persona's restrictions and the provider's credentials,
+// stores the user message and loads as much recent conversation history
+// as fits the history budget, from after its context break if it has
+// one. The model the conversation was switched to and its reply length
+// settings, if any, override the profile's.
+//
+// In a room the message is stored with its speaker, by default the
+// profile's user, and the history is attributed to its speakers.
+//
+// Credential failures wrap ErrAuth, private conversations without a
+// local provider ErrPrivate, messages the persona may not take
+// policy.ErrRestricted, and messages from someone a room does not admit
+// ErrNotMember.
+func (e *Engine) Start(ctx context.Context, user store.Message, p Profile) (*Turn, error) {
+	if err := e.Check(p, user.Content); err != nil {
+		return nil, err
+	}
+	provider, err := e.authorize(ctx, user.ConversationID, p.Account)
+	if err != nil {
+		return nil, err
+	}
+
+	if p, err = e.conversationModel(user.ConversationID, p); err != nil {
+		return nil, err
+	}
+	if p, err = e.replyLength(user.ConversationID, p); err != nil {
+		return nil, err
+	}
+
+	// In a room, messages are stored with who sent them.
+	convID, message := user.ConversationID, user.Content
+	room, err := e.db.Room(convID)
+	if errors.Is(err, store.ErrNotFound) {
+		room = nil
+	} else if err != nil {
+		return nil, err
+	}
+	if room != nil {
+		if user.Speaker == "" {
+			user.Speaker = p.User
+		}
+		if user.Speaker == "" {
+			return nil, fmt.Errorf("%w: say who is speaking with a user or speaker", ErrNotMember)
+		}
+		if !room.Admits(user.Speaker) {
+			return nil, fmt.Errorf("%w: %s", ErrNotMember, user.Speaker)
+		}
+	}
+
+	// Store the user message.
+	user.Role = store.RoleUser
+	if err := e.db.InsertMessage(&user); err != nil {
+		return nil, err
+	}
+
+	// Build the messages list from the recent conversation history.
+	history, err := e.history(convID)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []chat.Message
+	if room != nil {
+		messages = roomMessages(history, p.Persona)
+	} else {
+		for _, m := range history {
+			messages = append(messages, chat.Message{Role: string(m.Role), Content: m.Content})
+		}
+	}
+	return &Turn{convID: convID, provider: provider, profile: p, message: message, messages: messages, room: room, speaker: user.Speaker}, nil
+}
+
+// Check returns an error wrapping policy.ErrRestricted if the profile's
+// persona may not take a message now. Start and Prepare call it; front
+// ends that answer without the model call it themselves.
+func (e *Engine) Check(p Profile, message string) error {
+	if e.cfg.Policy == nil {
+		return nil
+	}
+	return e.cfg.Policy.Check(p.Persona, message)
+}
+
+// Prepare is like Start but stores nothing: the message is sent with the
+// conversation's recent history, and Run neither stores the reply nor
+// offers the model tools, whose side effects would happen once per
+// prepared turn. It is for comparing variants on the same input.
+func (e *Engine) Prepare(ctx context.Context, convID, message string, p Profile) (*Turn, error) {
+	if err := e.Check(p, message); err != nil {
+		return nil, err
+	}
+	provider, err := e.authorize(ctx, convID, p.Account)
+	if err != nil {
+		return nil, err
+	}
+	if p, err = e.replyLength(convID, p); err != nil {
+		return nil, err
+	}
+	history, err := e.history(convID)
+	if err != nil {
+		return nil, err
+	}
+	var messages []chat.Message
+	for _, m := range history {
+		messages = append(messages, chat.Message{Role: string(m.Role), Content: m.Content})
+	}
+	messages = append(messages, chat.Message{Role: string(store.RoleUser), Content: message})
+	return &Turn{convID: convID, provider: provider, profile: p, message: message, messages: messages, dryRun: true}, nil
+}
+
+// history returns the recent messages of a conversation that fit the
+// history budget, leaving out those before its context break, and its
+// pinned messages.
+func (e *Engine) history(convID string) ([]store.Message, error) {
+	history, err := e.db.RecentMessages(convID, e.cfg.HistoryChars)
+	if err != nil {
+		return nil, err
+	}
+	after, err := e.db.ContextStart(convID)
+	if err != nil {
+		return nil, err
+	}
+	if after > 0 {
+		history = slices.DeleteFunc(history, func(m store.Message) bool { return m.ID <= after })
+	}
+	// Pinned messages are always sent: those that fell out of the window
+	// go first, in the order they were written.
+	pinned, err := e.db.PinnedMessages(convID)
+	if err != nil {
+		return nil, err
+	}
+	pinned = slices.DeleteFunc(pinned, func(p store.Message) bool {
+		return slices.ContainsFunc(history, func(m store.Message) bool { return m.ID == p.ID })
+	})
+	return append(pinned, history...), nil
+}
+
+// conversationModel switches p to the model its conversation was
+// switched to, unless the persona may not use it.
+func (e *Engine) conversationModel(convID string, p Profile) (Profile, error) {
+	cp, err := e.db.ConversationProfile(convID)
+	if errors.Is(err, store.ErrNotFound) {
+		return p, nil
+	}
+	if err != nil {
+		return p, err
+	}
+	if cp.Model != "" {
+		if model, err := e.ResolveModel(p, cp.Model); err == nil {
+			p.Model = model
+		}
+	}
+	return p, nil
+}
+
+// replyLength applies the conversation's reply length settings, if it has
+// any, to p.
+func (e *Engine) replyLength(convID string, p Profile) (Profile, error) {
+	l, err := e.db.ReplyLength(convID)
+	if errors.Is(err, store.ErrNotFound) {
+		return p, nil
+	}
+	if err != nil {
+		return p, err
+	}
+	return withReplyLength(p, l), nil
+}
+
+// authorize returns the provider that may answer a conversation, once it
+// has checked its credentials: the local provider for private
+// conversations, failing with ErrPrivate if there is none, and otherwise
+// the named account's, if any, redacting secrets if a Redactor is set.
+// Credential failures and unknown accounts wrap ErrAuth.
+func (e *Engine) authorize(ctx context.Context, convID, account string) (chat.Provider, error) {
+	provider := e.cfg.Provider
+	private, err := e.db.Private(convID)
+	if err != nil {
+		return nil, err
+	}
+	if account != "" && !private {
+		if e.cfg.Accounts == nil {
+			return nil, fmt.Errorf("%w: accounts are not enabled", ErrAuth)
+		}
+		if provider, err = e.cfg.Accounts(account); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrAuth, err)
+		}
+	}
+	if private {
+		if provider = e.cfg.Private; provider == nil {
+			provider = e.cfg.Provider
+		}
+		provider = chat.LocalOnly(provider)
+		if provider == nil {
+			return nil, fmt.Errorf("%w: no local model provider is configured", ErrPrivate)
+		}
+	}
+	if a, ok := provider.(chat.Authorizer); ok {
+		if err := a.Authorize(ctx); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrAuth, err)
+		}
+	}
+	if l, ok := provider.(chat.Localer); e.cfg.Redactor != nil && !(ok && l.Local()) {
+		provider = e.cfg.Redactor.Provider(provider)
+	}
+	return provider, nil
+}
+
+// Run calls the model, running any requested tools, and stores the reply.
+// Content deltas are passed to emit as they arrive; emit may be nil.
+func (e *Engine) Run(ctx context.Context, t *Turn, emit func(content string)) (string, error) {
+	ctx, cancel := context.WithCancel(tools.WithUser(tools.WithConversation(ctx, t.convID), t.profile.User))
+	defer cancel()
+	e.report(t, Progress{Stage: StageQueued})
+	var transcript *chat.Transcript
+	if e.cfg.RecordTranscripts && !t.dryRun {
+		// Transcripts would keep an encrypted conversation in plain text.
+		if encrypted, err := e.db.Encrypted(t.convID); err == nil && !encrypted {
+			transcript = new(chat.Transcript)
+			ctx = chat.WithTranscript(ctx, transcript)
+		}
+	}
+
+	var toolDefs []chat.Tool
+	if e.cfg.Tools != nil && !t.dryRun {
+		for _, tl := range e.cfg.Tools.Tools() {
+			if e.toolScope(t.profile, tl.Name()) != "" {
+				continue
+			}
+			toolDefs = append(toolDefs, chat.Tool{
+				Type:        "function",
+				Name:        tl.Name(),
+				Description: tl.Description(),
+				Parameters:  tl.Parameters(),
+			})
+		}
+	}
+
+	var passages []store.Chunk
+	if e.cfg.Knowledge != nil {
+		var err error
+		if passages, err = e.cfg.Knowledge.Retrieve(t.message); err != nil {
+			log.Printf("retrieval error: %v", err)
+		}
+	}
+	instructions := e.instructions(ctx, t.profile.SystemPrompt, rag.Context(passages))
+	if t.room != nil {
+		instructions += "\n\n" + roomInstructions(t.room, t.profile.Persona)
+	}
+	if memories := e.memories(t.profile.User); memories != "" {
+		instructions += "\n\n" + memories
+	}
+	if length := lengthInstructions(t.profile); length != "" {
+		instructions += "\n\n" + length
+	}
+	messages := t.messages
+	if e.cfg.Middleware != nil {
+		p := &Prompt{TurnInfo: t.info(), Instructions: instructions, Message: t.message}
+		if err := e.cfg.Middleware.BeforePrompt(ctx, p); err != nil {
+			return "", err
+		}
+		instructions = p.Instructions
+		if n := len(messages); p.Message != t.message && n > 0 && messages[n-1].Role == string(store.RoleUser) {
+			content := p.Message
+			if t.room != nil {
+				content = t.speaker + ": " + content
+			}
+			messages = append(messages[:n-1:n-1], chat.Message{Role: string(store.RoleUser), Content: content})
+		}
+	}
+	e.PlayCue(audio.CueThinking)
+
+	var fullResponse strings.Builder
+	reported := 0
+	for round := 0; ; round++ {
+		e.report(t, Progress{Stage: StageModelStarted, Round: round + 1, Tokens: reported})
+		deltaCh, errCh := t.provider.Stream(ctx, chat.Request{
+			Model:           t.profile.Model,
+			Instructions:    instructions,
+			Messages:        messages,
+			Tools:           toolDefs,
+			MaxOutputTokens: t.profile.MaxOutputTokens,
+		})
+
+		var calls []*chat.ToolCall
+		for delta := range deltaCh {
+			if delta.Fallback != "" {
+				t.fallback = delta.Fallback
+			}
+			if u := delta.Usage; u != nil {
+				t.usage.InputTokens += u.InputTokens
+				t.usage.OutputTokens += u.OutputTokens
+			}
+			if delta.ToolCall != nil {
+				calls = append(calls, delta.ToolCall)
+				continue
+			}
+			if delta.Done || delta.Content == "" {
+				continue
+			}
+			fullResponse.WriteString(delta.Content)
+			if emit != nil {
+				emit(delta.Content)
+			}
+			if n := (fullResponse.Len() + 3) / 4; n >= reported+tokensEvery || reported == 0 {
+				reported = n
+				e.report(t, Progress{Stage: StageTokens, Round: round + 1, Tokens: n})
+			}
+			if !t.dryRun {
+				for _, o := range e.cfg.Observers {
+					o.Delta(t.convID, delta.Content)
+				}
+			}
+		}
+
+		// Check for stream errors.
+		if err := <-errCh; err != nil {
+			log.Printf("stream error: %v", err)
+			e.PlayCue(audio.CueError)
+			return "", err
+		}
+
+		if len(calls) == 0 {
+			break
+		}
+		if round == maxToolRounds {
+			log.Printf("tool loop exceeded %d rounds in conversation %s", maxToolRounds, t.convID)
+			break
+		}
+
+		// Run the requested tools and feed the results back to the model.
+		for _, call := range calls {
+			messages = append(messages, chat.Message{
+				Type:      "function_call",
+				CallID:    call.CallID,
+				Name:      call.Name,
+				Arguments: call.Arguments,
+			})
+			e.report(t, Progress{Stage: StageToolRunning, Tool: call.Name, Round: round + 1, Tokens: reported})
+			start := time.Now()
+			output := e.useTool(ctx, t, call)
+			if t.onTool != nil {
+				t.onTool(ToolEvent{CallID: call.CallID, Name: call.Name, Arguments: call.Arguments, Output: output, Duration: time.Since(start)})
+			}
+			messages = append(messages, chat.Message{
+				Type:   "function_call_output",
+				CallID: call.CallID,
+				Output: output,
+			})
+		}
+	}
+
+	// Store the assistant response.
+	resp := fullResponse.String()
+	if e.cfg.Middleware != nil && resp != "" {
+		r := &Response{TurnInfo: t.info(), Message: t.message, Reply: resp}
+		if err := e.cfg.Middleware.AfterResponse(ctx, r); err != nil {
+			log.Printf("middleware: %v", err)
+		} else {
+			resp = r.Reply
+		}
+	}
+	t.citations = rag.Cite(resp, passages)
+	if resp != "" && !t.dryRun {
+		m := &store.Message{ConversationID: t.convID, Role: store.RoleAssistant, Content: resp, Fallback: t.fallback}
+		if t.room != nil {
+			m.Speaker = t.profile.Persona
+		}
+		if err := e.db.AddCitedMessage(m, t.citations); err != nil {
+			log.Printf("db error saving response: %v", err)
+		}
+		t.replyID = m.ID
+		if transcript != nil && m.ID != 0 {
+			e.saveTranscript(m.ID, transcript)
+		}
+		e.Replied(t.convID, resp)
+	}
+	if e.cfg.Policy != nil && !t.dryRun {
+		e.cfg.Policy.Record(t.profile.Persona, t.usage.InputTokens+t.usage.OutputTokens)
+	}
+	return resp, nil
+}
+
+// Converse runs a complete turn without streaming and returns the reply.
+func (e *Engine) Converse(ctx context.Context, convID, message string, p Profile) (string, error) {
+	t, err := e.Start(ctx, store.Message{ConversationID: convID, Content: message}, p)
+	if err != nil {
+		return "", err
+	}
+	return e.Run(ctx, t, nil)
+}
+
+// Chat sends message to a conversation with the default profile and
+// returns the reply, passing it to emit as it streams if emit is non-nil.
+func (e *Engine) Chat(ctx context.Context, convID, message string, emit func(content string)) (string, error) {
+	p, _ := e.Profile("", "")
+	t, err := e.Start(ctx, store.Message{ConversationID: convID, Content: message}, p)
+	if err != nil {
+		return "", err
+	}
+	return e.Run(ctx, t, emit)
+}
+
+// instructions builds the system prompt from a base prompt, filling in
+// its variables and appending live context and any retrieved passages.
+func (e *Engine) instructions(ctx context.Context, systemPrompt, passages string) string {
+	if e.cfg.Variables != nil {
+		systemPrompt = e.cfg.Variables(ctx, systemPrompt)
+	}
+	parts := []string{systemPrompt}
+	for _, p := range e.cfg.PromptContext {
+		if c := p(ctx); c != "" {
+			parts = append(parts, c)
+		}
+	}
+	if passages != "" {
+		parts = append(parts, passages)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// memories lists what the user and the household asked to be remembered,
+// or returns "" if there is nothing.
+func (e *Engine) memories(user string) string {
+	list, err := e.db.Memories(user)
+	if err != nil {
+		log.Printf("db error: %v", err)
+		return ""
+	}
+	if len(list) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("You were asked to remember:")
+	for _, m := range list {
+		b.WriteString("\n- " + m.Content)
+	}
+	return b.String()
+}
+
+// Replied tells the observers about a reply stored in a conversation. Run
+// calls it; front ends that answer without the model, such as local
+// intents, call it themselves.
+func (e *Engine) Replied(convID, content string) {
+	for _, o := range e.cfg.Observers {
+		o.Reply(convID, content)
+	}
+}
+
+// saveTranscript stores the exchanges recorded for a reply.
+func (e *Engine) saveTranscript(messageID int64, t *chat.Transcript) {
+	var exchanges []store.Exchange
+	for _, x := range t.Exchanges() {
+		exchanges = append(exchanges, store.Exchange{Request: x.Request, Status: x.Status, Response: x.Response, Truncated: x.Truncated})
+	}
+	if len(exchanges) == 0 {
+		return
+	}
+	if err := e.db.AddTranscript(messageID, exchanges); err != nil {
+		log.Printf("db error saving transcript: %v", err)
+	}
+}
+
+// PlayCue plays an earcon if earcons are enabled.
+func (e *Engine) PlayCue(cue audio.Cue) {
+	if e.cfg.Earcons == nil {
+		return
+	}
+	if err := e.cfg.Earcons.Play(cue); err != nil {
+		log.Printf("earcon error: %v", err)
+	}
+}
+
+// AllowTool returns an error if p's persona or channel may not use a
+// tool in a conversation, recording the denial. Front ends doing a tool's
+// work without the model, such as local intents, ask it first.
+func (e *Engine) AllowTool(convID string, p Profile, tool string) error {
+	scope := e.toolScope(p, tool)
+	if scope == "" {
+		return nil
+	}
+	log.Printf("tool %s denied for %s", tool, scope)
+	denial := &store.ToolDenial{ConversationID: convID, User: p.User, Persona: p.Persona, Channel: p.Channel, Tool: tool, Scope: scope}
+	if err := e.db.AddToolDenial(denial); err != nil {
+		log.Printf("db error recording tool denial: %v", err)
+	}
+	return fmt.Errorf("tool %q may not be used here (restricted by %s)", tool, scope)
+}
+
+// useTool passes a tool call through the middleware, if any, and runs it.
+// Calls to tools the turn's persona or channel may not use are refused
+// and recorded, even though such tools are not offered.
+func (e *Engine) useTool(ctx context.Context, t *Turn, call *chat.ToolCall) string {
+	if err := e.AllowTool(t.convID, t.profile, call.Name); err != nil {
+		return "error: " + err.Error()
+	}
+	if e.cfg.Middleware == nil {
+		return e.callTool(ctx, call)
+	}
+	u := &ToolUse{TurnInfo: t.info(), Name: call.Name, Arguments: call.Arguments}
+	if err := e.cfg.Middleware.OnToolCall(ctx, u); err != nil {
+		log.Printf("tool %s: %v", call.Name, err)
+		return "error: " + err.Error()
+	}
+	if u.Output != "" {
+		return u.Output
+	}
+	if u.Arguments != call.Arguments {
+		changed := *call
+		changed.Arguments = u.Arguments
+		call = &changed
+	}
+	return e.callTool(ctx, call)
+}
+
+// callTool runs a tool call and returns its output. Failures are reported
+// to the model as text so it can explain or recover.
+func (e *Engine) callTool(ctx context.Context, call *chat.ToolCall) string {
+	if e.cfg.Tools == nil {
+		return fmt.Sprintf("error: unknown tool %q", call.Name)
+	}
+	out, err := e.cfg.Tools.Call(ctx, call.Name, json.RawMessage(call.Arguments))
+	if err != nil {
+		log.Printf("tool %s error: %v", call.Name, err)
+		return "error: " + err.Error()
+	}
+	return out
+}
@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrRejected marks turns and tool calls a Middleware refused.
+var ErrRejected = errors.New("rejected by middleware")
+
+// Middleware inspects and may change a turn at three points: before the
+// prompt goes to the model, when the reply is complete, and before each
+// tool call. Each method changes its argument in place.
+type Middleware interface {
+	// BeforePrompt may rewrite the instructions and the user message as
+	// sent to the model. The stored message is unchanged. An error
+	// aborts the turn.
+	BeforePrompt(ctx context.Context, p *Prompt) error
+	// AfterResponse may rewrite the reply before it is stored and passed
+	// to observers; the deltas have already streamed.
+	AfterResponse(ctx context.Context, r *Response) error
+	// OnToolCall may rewrite the arguments, or set Output to answer
+	// without running the tool. An error is reported to the model
+	// instead of running the tool.
+	OnToolCall(ctx context.Context, c *ToolUse) error
+}
+
+// TurnInfo describes the turn a hook runs in.
+type TurnInfo struct {
+	ConversationID string `json:"conversation_id"`
+	User           string `json:"user,omitempty"`
+	Persona        string `json:"persona,omitempty"`
+}
+
+// Prompt is what BeforePrompt sees and may change.
+type Prompt struct {
+	TurnInfo
+	Instructions string `json:"instructions"`
+	Message      string `json:"message"`
+}
+
+// Response is what AfterResponse sees and may change.
+type Response struct {
+	TurnInfo
+	Message string `json:"message"`
+	Reply   string `json:"reply"`
+}
+
+// ToolUse is what OnToolCall sees and may change.
+type ToolUse struct {
+	TurnInfo
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+	Output    string `json:"output,omitempty"`
+}
+
+func (t *Turn) info() TurnInfo {
+	return TurnInfo{ConversationID: t.convID, User: t.profile.User, Persona: t.profile.Persona}
+}
@@ -0,0 +1,230 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"pi-agent/internal/config"
+	"pi-agent/internal/policy"
+	"pi-agent/internal/store"
+)
+
+// Profile is the model and system prompt a turn runs with.
+type Profile struct {
+	Persona string
+	User    string // the user the turn is for, if known; tools see it
+	// Channel is the front end the turn came from, e.g. "telegram"; the
+	// profiles' channel_tools limit its tools. Callers set it.
+	Channel      string
+	Model        string
+	SystemPrompt string
+	// Speech is how voice front ends should read the reply, if the user
+	// has voice settings.
+	Speech *config.Speech
+	// Verbosity is the reply length preset, one of config.Verbosities or
+	// empty for "normal", and MaxOutputTokens the cap on each reply, or 0.
+	Verbosity       string
+	MaxOutputTokens int
+	// Account names the stored ChatGPT account the turn is answered
+	// with, rather than the default one; see Config.Accounts. Private
+	// conversations, answered locally, ignore it.
+	Account string
+}
+
+// verbosity is a reply length preset: what the model is told and the cap
+// on each reply, if the preset has one.
+type verbosity struct {
+	instructions string
+	maxTokens    int
+}
+
+var verbosities = map[string]verbosity{
+	"terse":    {"Keep replies short: one to three plain sentences without lists, headings or preambles, unless asked for more.", 200},
+	"normal":   {},
+	"detailed": {"Give thorough replies, explaining your reasoning and adding examples where they help.", 0},
+}
+
+// withReplyLength applies a conversation's reply length settings to p:
+// a verbosity of its own brings that preset's cap, and a cap of its own
+// replaces any other.
+func withReplyLength(p Profile, l *store.ReplyLength) Profile {
+	if l.Verbosity != "" {
+		p.Verbosity, p.MaxOutputTokens = l.Verbosity, verbosities[l.Verbosity].maxTokens
+	}
+	if l.MaxOutputTokens > 0 {
+		p.MaxOutputTokens = l.MaxOutputTokens
+	}
+	return p
+}
+
+// lengthInstructions tells the model how long its replies should be, or
+// returns "" if nothing limits them.
+func lengthInstructions(p Profile) string {
+	text := verbosities[p.Verbosity].instructions
+	if p.MaxOutputTokens > 0 {
+		if text != "" {
+			text += " "
+		}
+		text += fmt.Sprintf("Replies are cut off after %d tokens (about %d words), so finish well within that.", p.MaxOutputTokens, p.MaxOutputTokens*3/4)
+	}
+	return text
+}
+
+// Profile resolves the model and system prompt for a request. The tier is
+// taken from the user, then the persona, and is capped at the persona's
+// max tier; without a tier the default model is used. An unknown persona is
+// an error, while an unknown user simply gets the defaults.
+func (e *Engine) Profile(persona, user string) (Profile, error) {
+	p := Profile{User: user, Model: e.cfg.Model, SystemPrompt: e.cfg.SystemPrompt}
+	profiles := &e.cfg.Profiles
+
+	u, _ := profiles.User(user)
+	p.Speech = u.Speech
+	if persona == "" {
+		persona = u.Persona
+	}
+	var ps config.Persona
+	if persona != "" {
+		var ok bool
+		if ps, ok = profiles.Persona(persona); !ok {
+			return p, fmt.Errorf("unknown persona %q", persona)
+		}
+		p.Persona = ps.Name
+		if ps.SystemPrompt != "" {
+			p.SystemPrompt = ps.SystemPrompt
+		}
+		p.Verbosity, p.MaxOutputTokens = ps.Verbosity, verbosities[ps.Verbosity].maxTokens
+		if ps.MaxOutputTokens > 0 {
+			p.MaxOutputTokens = ps.MaxOutputTokens
+		}
+		if r := ps.Restrictions; r != nil && len(r.BlockedTopics) > 0 {
+			p.SystemPrompt += "\n\nDo not discuss these topics, even if asked indirectly; kindly suggest asking a parent instead: " +
+				strings.Join(r.BlockedTopics, ", ") + "."
+		}
+	}
+
+	tier := profiles.Tier(ps.Tier)
+	if t := profiles.Tier(u.Tier); t >= 0 {
+		tier = t
+	}
+	if limit := profiles.Tier(ps.MaxTier); limit >= 0 && tier > limit {
+		tier = limit
+	}
+	if tier >= 0 {
+		p.Model = profiles.ModelTiers[tier].Model
+	}
+	return p, nil
+}
+
+// toolScope returns what keeps p from using a tool, e.g. "persona kids"
+// or "channel telegram", or "" if p may use it.
+func (e *Engine) toolScope(p Profile, tool string) string {
+	profiles := &e.cfg.Profiles
+	if ps, ok := profiles.Persona(p.Persona); ok && ps.Tools != nil && !ps.Tools.Permits(tool) {
+		return "persona " + ps.Name
+	}
+	if scope, ok := profiles.ChannelTools[p.Channel]; ok && !scope.Permits(tool) {
+		return "channel " + p.Channel
+	}
+	return ""
+}
+
+// ResolveModel turns a model tier name or a model into the model p may
+// switch to. A persona with a max tier may only switch to the models of
+// the tiers up to it.
+func (e *Engine) ResolveModel(p Profile, model string) (string, error) {
+	profiles := &e.cfg.Profiles
+	tier := profiles.Tier(model)
+	if tier >= 0 {
+		model = profiles.ModelTiers[tier].Model
+	} else {
+		for i, t := range profiles.ModelTiers {
+			if t.Model == model {
+				tier = i
+				break
+			}
+		}
+	}
+	ps, _ := profiles.Persona(p.Persona)
+	if limit := profiles.Tier(ps.MaxTier); limit >= 0 && (tier < 0 || tier > limit) {
+		return "", fmt.Errorf("persona %s may not use models above the %s tier", p.Persona, ps.MaxTier)
+	}
+	return model, nil
+}
+
+// VariantProfile resolves a configured comparison variant. Its tier caps
+// do not apply: a comparison is an explicit choice of model.
+func (e *Engine) VariantProfile(name string) (Profile, error) {
+	v, ok := e.cfg.Profiles.Variant(name)
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown variant %q", name)
+	}
+	p, err := e.Profile(v.Persona, "")
+	if err != nil {
+		return p, err
+	}
+	if t := e.cfg.Profiles.Tier(v.Tier); t >= 0 {
+		p.Model = e.cfg.Profiles.ModelTiers[t].Model
+	}
+	if v.Model != "" {
+		p.Model = v.Model
+	}
+	if v.SystemPrompt != "" {
+		p.SystemPrompt = v.SystemPrompt
+	}
+	return p, nil
+}
+
+// Users returns the configured users.
+func (e *Engine) Users() []config.User {
+	return e.cfg.Profiles.Users
+}
+
+// Variants returns the names of the configured comparison variants.
+func (e *Engine) Variants() []string {
+	names := make([]string, len(e.cfg.Profiles.Variants))
+	for i, v := range e.cfg.Profiles.Variants {
+		names[i] = v.Name
+	}
+	return names
+}
+
+// CheckPersona returns an error wrapping policy.ErrRestricted if user may
+// not pick persona. Restrictions on a user's default persona, and its cap
+// on the model tier, follow the user: choosing a persona without them
+// takes the admin PIN.
+func (e *Engine) CheckPersona(user, persona, pin string) error {
+	profiles := &e.cfg.Profiles
+	u, _ := profiles.User(user)
+	if u.Persona == "" || persona == "" || persona == u.Persona {
+		return nil
+	}
+	def, _ := profiles.Persona(u.Persona)
+	ps, _ := profiles.Persona(persona)
+	limit, to := profiles.Tier(def.MaxTier), profiles.Tier(ps.MaxTier)
+	if def.Restrictions == nil && (limit < 0 || to >= 0 && to <= limit) {
+		return nil
+	}
+	if e.cfg.Policy != nil && e.cfg.Policy.Admin(pin) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s may only use the %s persona without the admin PIN", policy.ErrRestricted, user, u.Persona)
+}
+
+// CheckSwitch returns an error wrapping policy.ErrRestricted if a
+// conversation talking to p may not switch to persona, "" being the
+// user's default: leaving a persona with restrictions takes the admin PIN,
+// and so does a persona CheckPersona refuses.
+func (e *Engine) CheckSwitch(p Profile, persona, pin string) error {
+	if persona == "" {
+		u, _ := e.cfg.Profiles.User(p.User)
+		persona = u.Persona
+	}
+	if persona == p.Persona {
+		return nil
+	}
+	if pol := e.cfg.Policy; pol != nil && pol.Restricted(p.Persona) && !pol.Admin(pin) {
+		return fmt.Errorf("%w: leaving the %s persona takes the admin PIN", policy.ErrRestricted, p.Persona)
+	}
+	return e.CheckPersona(p.User, persona, pin)
+}
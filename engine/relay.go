@@ -0,0 +1,151 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"pi-agent/internal/chat"
+	"pi-agent/internal/store"
+)
+
+// relayContext is how many earlier messages of a relay are shown to the
+// model, so that pronouns and short replies translate correctly.
+const relayContext = 6
+
+// maxRelayTag bounds how much of a reply is held back looking for the
+// listener tag before it is streamed as is.
+const maxRelayTag = 64
+
+// Relay translates a message in a relay conversation for the other
+// participant instead of answering it, passing the translation to emit as
+// it streams, and stores both messages labelled with their speaker. The
+// sender is the participant user.Speaker names; if it names neither, the
+// model works out which language the message is in. Relay returns the
+// translation and the label of the participant it is for.
+func (e *Engine) Relay(ctx context.Context, r *store.Relay, user store.Message, p Profile, emit func(content string)) (reply, listener string, err error) {
+	if err := e.Check(p, user.Content); err != nil {
+		return "", "", err
+	}
+	provider, err := e.authorize(ctx, user.ConversationID, p.Account)
+	if err != nil {
+		return "", "", err
+	}
+	history, err := e.db.RecentMessages(user.ConversationID, e.cfg.HistoryChars)
+	if err != nil {
+		return "", "", err
+	}
+
+	a, b := r.Participants[0], r.Participants[1]
+	from := -1
+	for i, pt := range r.Participants {
+		if strings.EqualFold(pt.Label, strings.TrimSpace(user.Speaker)) {
+			from = i
+		}
+	}
+	instructions := fmt.Sprintf("You are interpreting between %s, who speaks %s, and %s, who speaks %s.", a.Label, a.Language, b.Label, b.Language)
+	if from >= 0 {
+		to := r.Participants[1-from]
+		instructions += fmt.Sprintf(" Translate %s's message into %s for %s.", r.Participants[from].Label, to.Language, to.Label)
+	} else {
+		instructions += fmt.Sprintf(" Translate the message into the other participant's language. Begin your reply with the label of the participant it is for in square brackets, [%s] or [%s].", a.Label, b.Label)
+	}
+	instructions += " Reply with the translation only, without quotes, notes or explanations, keeping the tone, names and numbers."
+	var said []string
+	for _, m := range history {
+		if m.Role == store.RoleUser && m.Speaker != "" {
+			said = append(said, m.Speaker+": "+m.Content)
+		}
+	}
+	if len(said) > relayContext {
+		said = said[len(said)-relayContext:]
+	}
+	if len(said) > 0 {
+		instructions += "\n\nThe conversation so far, for context:\n" + strings.Join(said, "\n")
+	}
+
+	deltaCh, errCh := provider.Stream(ctx, chat.Request{
+		Model:        p.Model,
+		Instructions: instructions,
+		Messages:     []chat.Message{{Role: string(store.RoleUser), Content: user.Content}},
+	})
+	var out, held strings.Builder
+	var fallback string
+	var tokens int
+	tagged := from >= 0
+	send := func(s string) {
+		if s == "" {
+			return
+		}
+		out.WriteString(s)
+		if emit != nil {
+			emit(s)
+		}
+		for _, o := range e.cfg.Observers {
+			o.Delta(user.ConversationID, s)
+		}
+	}
+	for delta := range deltaCh {
+		if delta.Fallback != "" {
+			fallback = delta.Fallback
+		}
+		if u := delta.Usage; u != nil {
+			tokens += u.InputTokens + u.OutputTokens
+		}
+		if delta.Done || delta.Content == "" {
+			continue
+		}
+		if tagged {
+			send(delta.Content)
+			continue
+		}
+		// Hold the start of the reply back until the listener tag is
+		// complete.
+		held.WriteString(delta.Content)
+		text := strings.TrimLeft(held.String(), " \n")
+		if tag, rest, ok := strings.Cut(text, "]"); ok && strings.HasPrefix(tag, "[") {
+			for i, pt := range r.Participants {
+				if strings.EqualFold(strings.TrimSpace(tag[1:]), pt.Label) {
+					from = 1 - i
+				}
+			}
+			tagged = true
+			send(strings.TrimLeft(rest, " \n"))
+		} else if len(text) > maxRelayTag || text != "" && !strings.HasPrefix(text, "[") {
+			tagged = true
+			send(text)
+		}
+	}
+	if !tagged {
+		send(strings.TrimSpace(held.String()))
+	}
+	streamErr := <-errCh
+
+	// Store the original even if the translation failed, so it is not
+	// lost from the conversation.
+	if from >= 0 {
+		user.Speaker = r.Participants[from].Label
+		listener = r.Participants[1-from].Label
+	}
+	user.Role = store.RoleUser
+	if err := e.db.InsertMessage(&user); err != nil {
+		return "", "", err
+	}
+	if streamErr != nil {
+		log.Printf("stream error: %v", streamErr)
+		return "", "", streamErr
+	}
+	reply = strings.TrimSpace(out.String())
+	if reply != "" {
+		m := &store.Message{ConversationID: user.ConversationID, Role: store.RoleAssistant, Content: reply, Fallback: fallback, Speaker: listener}
+		if err := e.db.InsertMessage(m); err != nil {
+			log.Printf("db error saving translation: %v", err)
+		}
+		e.Replied(user.ConversationID, reply)
+	}
+	if e.cfg.Policy != nil {
+		e.cfg.Policy.Record(p.Persona, tokens)
+	}
+	return reply, listener, nil
+}
@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"pi-agent/internal/chat"
+	"pi-agent/internal/store"
+)
+
+// ErrNotMember marks messages to a room from someone it does not admit.
+var ErrNotMember = errors.New("not a member of this room")
+
+// RoomPersona picks the persona of a room that answers a message: the
+// first one the message addresses by name, as "@name" or "name," at its
+// start, or else the room's first persona. It returns "" for rooms
+// without personas.
+func RoomPersona(r *store.Room, message string) string {
+	if len(r.Personas) == 0 {
+		return ""
+	}
+	first, at := r.Personas[0], len(message)
+	lower := strings.ToLower(message)
+	for _, p := range r.Personas {
+		name := regexp.QuoteMeta(strings.ToLower(p))
+		re := regexp.MustCompile(`(^|\s)@` + name + `\b|^\s*` + name + `\s*[,:]`)
+		if loc := re.FindStringIndex(lower); loc != nil && loc[0] < at {
+			first, at = p, loc[0]
+		}
+	}
+	return first
+}
+
+// roomMessages lays out a room's history for the persona answering it:
+// people's messages start with their names, as do those of the other
+// personas, which are shown as said to the persona rather than by it.
+func roomMessages(history []store.Message, persona string) []chat.Message {
+	var out []chat.Message
+	for _, m := range history {
+		switch {
+		case m.Role == store.RoleUser && m.Speaker != "":
+			out = append(out, chat.Message{Role: string(store.RoleUser), Content: m.Speaker + ": " + m.Content})
+		case m.Role == store.RoleAssistant && m.Speaker != "" && !strings.EqualFold(m.Speaker, persona):
+			out = append(out, chat.Message{Role: string(store.RoleUser), Content: m.Speaker + ": " + m.Content})
+		default:
+			out = append(out, chat.Message{Role: string(m.Role), Content: m.Content})
+		}
+	}
+	return out
+}
+
+// roomInstructions tells the model who is in the room.
+func roomInstructions(r *store.Room, persona string) string {
+	var b strings.Builder
+	b.WriteString("This is a group conversation")
+	if r.Name != "" {
+		fmt.Fprintf(&b, " in %q", r.Name)
+	}
+	if len(r.Members) > 0 {
+		fmt.Fprintf(&b, " with %s", strings.Join(r.Members, ", "))
+	}
+	b.WriteString(". Each message from a person starts with their name; address people by name when it is not clear whom you are answering, and do not start your replies with a name label.")
+	others := slices.DeleteFunc(slices.Clone(r.Personas), func(p string) bool { return strings.EqualFold(p, persona) })
+	if len(others) > 0 {
+		fmt.Fprintf(&b, " You are %s. Other assistants take part too: %s. Their messages also start with their names; do not answer for them.", persona, strings.Join(others, ", "))
+	}
+	return b.String()
+}
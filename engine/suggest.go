@@ -0,0 +1,69 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"pi-agent/internal/chat"
+	"pi-agent/internal/store"
+)
+
+// maxSuggestions and maxSuggestionChars bound the follow-ups Suggest
+// returns, so they fit on chips and small displays.
+const (
+	maxSuggestions     = 3
+	maxSuggestionChars = 80
+)
+
+const suggestInstructions = `Suggest two or three short follow-up messages the user might send next, in their voice and language, e.g. "How long does that take?". Each is at most eight words. Answer with a JSON array of strings and nothing else.`
+
+// Suggest asks the model for a few follow-up prompts to a reply of the
+// turn, for clients to offer as tappable chips. It uses the turn's
+// provider, so it honours privacy mode and redaction, with the model of
+// Config.SuggestModel if set. Replies it cannot make sense of give no
+// suggestions rather than an error.
+func (e *Engine) Suggest(ctx context.Context, t *Turn, reply string) ([]string, error) {
+	model := e.cfg.SuggestModel
+	if model == "" {
+		model = t.profile.Model
+	}
+	prompt := fmt.Sprintf("User: %s\n\nAssistant: %s", t.message, reply)
+	out, err := chat.Collect(ctx, t.provider, chat.Request{
+		Model:        model,
+		Instructions: suggestInstructions,
+		Messages:     []chat.Message{{Role: string(store.RoleUser), Content: prompt}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parseSuggestions(out), nil
+}
+
+// listMarker matches a bullet or number starting a line.
+var listMarker = regexp.MustCompile(`^\s*(?:[-*•]|\d+[.)])\s*`)
+
+// parseSuggestions reads a JSON array of strings from a model's answer,
+// tolerating text around it, or else one suggestion per line.
+func parseSuggestions(out string) []string {
+	var items []string
+	start, end := strings.Index(out, "["), strings.LastIndex(out, "]")
+	if start < 0 || end < start || json.Unmarshal([]byte(out[start:end+1]), &items) != nil {
+		items = strings.Split(out, "\n")
+	}
+	var list []string
+	for _, s := range items {
+		s = strings.Trim(strings.TrimSpace(listMarker.ReplaceAllString(s, "")), `"`)
+		if s == "" || utf8.RuneCountInString(s) > maxSuggestionChars {
+			continue
+		}
+		list = append(list, s)
+		if len(list) == maxSuggestions {
+			break
+		}
+	}
+	return list
+}
@@ -0,0 +1,267 @@
+// Package acme obtains and renews TLS certificates from an ACME CA such as
+// Let's Encrypt (RFC 8555), proving control of the domains with DNS-01
+// challenges so that hosts on a private LAN can have them.
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// maxResponse bounds the ACME responses read; certificate chains are a
+// few kilobytes.
+const maxResponse = 1 << 20
+
+// client speaks ACME to one CA with one account key.
+type client struct {
+	http      *http.Client
+	key       *ecdsa.PrivateKey
+	kid       string // the account URL, once registered
+	directory struct {
+		NewNonce   string `json:"newNonce"`
+		NewAccount string `json:"newAccount"`
+		NewOrder   string `json:"newOrder"`
+	}
+	nonce string
+}
+
+// problem is an ACME error document.
+type problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Status int    `json:"status"`
+}
+
+func (p *problem) Error() string {
+	return fmt.Sprintf("acme: %s (%s)", p.Detail, p.Type)
+}
+
+// order, authorization and challenge are the ACME resources the client
+// works through.
+type order struct {
+	Status         string   `json:"status"`
+	Authorizations []string `json:"authorizations"`
+	Finalize       string   `json:"finalize"`
+	Certificate    string   `json:"certificate"`
+	Error          *problem `json:"error"`
+}
+
+type authorization struct {
+	Status     string `json:"status"`
+	Identifier struct {
+		Value string `json:"value"`
+	} `json:"identifier"`
+	Wildcard   bool        `json:"wildcard"`
+	Challenges []challenge `json:"challenges"`
+}
+
+type challenge struct {
+	Type   string   `json:"type"`
+	URL    string   `json:"url"`
+	Token  string   `json:"token"`
+	Status string   `json:"status"`
+	Error  *problem `json:"error"`
+}
+
+func newClient(ctx context.Context, directoryURL string, key *ecdsa.PrivateKey) (*client, error) {
+	c := &client{http: &http.Client{Timeout: 30 * time.Second}, key: key}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, directoryURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("acme: fetching directory: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("acme: fetching directory: %s", resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponse)).Decode(&c.directory); err != nil {
+		return nil, fmt.Errorf("acme: decoding directory: %w", err)
+	}
+	if c.directory.NewNonce == "" || c.directory.NewAccount == "" || c.directory.NewOrder == "" {
+		return nil, errors.New("acme: directory is incomplete")
+	}
+	return c, nil
+}
+
+// register finds or creates the account for the client's key.
+func (c *client) register(ctx context.Context, email string) error {
+	req := map[string]any{"termsOfServiceAgreed": true}
+	if email != "" {
+		req["contact"] = []string{"mailto:" + email}
+	}
+	resp, err := c.post(ctx, c.directory.NewAccount, req, nil)
+	if err != nil {
+		return fmt.Errorf("registering account: %w", err)
+	}
+	c.kid = resp.Header.Get("Location")
+	if c.kid == "" {
+		return errors.New("acme: account has no URL")
+	}
+	return nil
+}
+
+// newOrder asks for a certificate for domains and returns the order and
+// its URL.
+func (c *client) newOrder(ctx context.Context, domains []string) (*order, string, error) {
+	ids := make([]map[string]string, len(domains))
+	for i, d := range domains {
+		ids[i] = map[string]string{"type": "dns", "value": d}
+	}
+	var o order
+	resp, err := c.post(ctx, c.directory.NewOrder, map[string]any{"identifiers": ids}, &o)
+	if err != nil {
+		return nil, "", fmt.Errorf("creating order: %w", err)
+	}
+	return &o, resp.Header.Get("Location"), nil
+}
+
+// keyAuthorization is what a challenge's token is answered with.
+func (c *client) keyAuthorization(token string) string {
+	h := sha256.Sum256(c.jwkJSON())
+	return token + "." + b64(h[:])
+}
+
+// dnsValue is the TXT record value answering a DNS-01 challenge.
+func (c *client) dnsValue(token string) string {
+	h := sha256.Sum256([]byte(c.keyAuthorization(token)))
+	return b64(h[:])
+}
+
+// get fetches a resource with POST-as-GET into v.
+func (c *client) get(ctx context.Context, url string, v any) (*http.Response, error) {
+	return c.post(ctx, url, nil, v)
+}
+
+// post sends a JWS-signed request and decodes a JSON response into v, if
+// v is non-nil. A nil payload makes it a POST-as-GET. A rejected nonce is
+// retried once with a fresh one.
+func (c *client) post(ctx context.Context, url string, payload, v any) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, body, err := c.send(ctx, url, payload)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode >= 400 {
+			p := &problem{Status: resp.StatusCode}
+			if json.Unmarshal(body, p) != nil || p.Type == "" {
+				return nil, fmt.Errorf("acme: %s: %s", url, resp.Status)
+			}
+			if p.Type == "urn:ietf:params:acme:error:badNonce" && attempt == 0 {
+				continue
+			}
+			return nil, p
+		}
+		if v != nil {
+			if b, ok := v.(*[]byte); ok {
+				*b = body
+			} else if err := json.Unmarshal(body, v); err != nil {
+				return nil, fmt.Errorf("acme: decoding %s: %w", url, err)
+			}
+		}
+		return resp, nil
+	}
+}
+
+func (c *client) send(ctx context.Context, url string, payload any) (*http.Response, []byte, error) {
+	if c.nonce == "" {
+		if err := c.fetchNonce(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+	body, err := c.sign(url, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/jose+json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("acme: %w", err)
+	}
+	defer resp.Body.Close()
+	c.nonce = resp.Header.Get("Replay-Nonce")
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return nil, nil, fmt.Errorf("acme: reading %s: %w", url, err)
+	}
+	return resp, data, nil
+}
+
+func (c *client) fetchNonce(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.directory.NewNonce, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("acme: fetching nonce: %w", err)
+	}
+	resp.Body.Close()
+	if c.nonce = resp.Header.Get("Replay-Nonce"); c.nonce == "" {
+		return errors.New("acme: no nonce in response")
+	}
+	return nil
+}
+
+// sign wraps payload in a flattened JWS signed with ES256, identifying the
+// key by its account URL once there is one and by the key itself before.
+func (c *client) sign(url string, payload any) ([]byte, error) {
+	protected := map[string]any{"alg": "ES256", "nonce": c.nonce, "url": url}
+	if c.kid != "" {
+		protected["kid"] = c.kid
+	} else {
+		protected["jwk"] = json.RawMessage(c.jwkJSON())
+	}
+	c.nonce = ""
+	header, err := json.Marshal(protected)
+	if err != nil {
+		return nil, err
+	}
+	var body []byte
+	if payload != nil {
+		if body, err = json.Marshal(payload); err != nil {
+			return nil, err
+		}
+	}
+	signed := b64(header) + "." + b64(body)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, c.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	sig := append(pad(r), pad(s)...)
+	return json.Marshal(map[string]string{"protected": b64(header), "payload": b64(body), "signature": b64(sig)})
+}
+
+// jwkJSON is the account's public key as a JWK with its members in the
+// order RFC 7638 thumbprints need.
+func (c *client) jwkJSON() []byte {
+	pub := c.key.Public().(*ecdsa.PublicKey)
+	return fmt.Appendf(nil, `{"crv":"P-256","kty":"EC","x":%q,"y":%q}`, b64(pad(pub.X)), b64(pad(pub.Y)))
+}
+
+// pad returns n as the 32 big-endian bytes of a P-256 coordinate.
+func pad(n *big.Int) []byte {
+	return n.FillBytes(make([]byte, 32))
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,128 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testKey is the P-256 key of RFC 7515 appendix A.3.
+func testKey() *ecdsa.PrivateKey {
+	x, _ := new(big.Int).SetString("f3f4a8dc5ab8e0d3e80a4fd5bcda3f54c984e4b9dd84fc2dd5ed9656b6c7bd00", 16)
+	key := &ecdsa.PrivateKey{D: x, PublicKey: ecdsa.PublicKey{Curve: elliptic.P256()}}
+	key.PublicKey.X, key.PublicKey.Y = elliptic.P256().ScalarBaseMult(x.Bytes())
+	return key
+}
+
+func TestJWK(t *testing.T) {
+	c := &client{key: testKey()}
+	// RFC 7638 fixes the members, their order and no whitespace.
+	jwk := string(c.jwkJSON())
+	if len(jwk) != len(`{"crv":"P-256","kty":"EC","x":"","y":""}`)+2*43 {
+		t.Errorf("jwk %s is not the canonical form", jwk)
+	}
+	thumb := sha256.Sum256([]byte(jwk))
+	if got, want := c.keyAuthorization("tok"), "tok."+b64(thumb[:]); got != want {
+		t.Errorf("keyAuthorization = %q, want %q", got, want)
+	}
+	digest := sha256.Sum256([]byte("tok." + b64(thumb[:])))
+	if got := c.dnsValue("tok"); got != b64(digest[:]) || len(got) != 43 {
+		t.Errorf("dnsValue = %q", got)
+	}
+}
+
+func TestPad(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"},
+		{1, "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAE"},
+		{0x0102, "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAQI"},
+	}
+	for _, tt := range tests {
+		if got := b64(pad(big.NewInt(tt.n))); got != tt.want {
+			t.Errorf("pad(%d) = %s, want %s", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestNewClientErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"unavailable", http.StatusServiceUnavailable, "", "acme: fetching directory: 503 Service Unavailable"},
+		{"not JSON", http.StatusOK, "<html>", "acme: decoding directory: invalid character '<' looking for beginning of value"},
+		{"incomplete", http.StatusOK, `{"newNonce":"n","newAccount":"a"}`, "acme: directory is incomplete"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+			_, err := newClient(context.Background(), srv.URL, testKey())
+			if got := errString(err); got != tt.want {
+				t.Errorf("err = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply func(w http.ResponseWriter)
+		want  string
+		posts int
+	}{
+		{"problem", func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"type":"urn:ietf:params:acme:error:rejectedIdentifier","detail":"forbidden domain"}`))
+		}, "acme: forbidden domain (urn:ietf:params:acme:error:rejectedIdentifier)", 1},
+		{"no problem document", func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusBadGateway)
+		}, "acme: URL: 502 Bad Gateway", 1},
+		{"bad nonce twice", func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"type":"urn:ietf:params:acme:error:badNonce","detail":"stale"}`))
+		}, "acme: stale (urn:ietf:params:acme:error:badNonce)", 2},
+		{"not JSON", func(w http.ResponseWriter) {
+			w.Write([]byte(`<html>`))
+		}, "acme: decoding URL: invalid character '<' looking for beginning of value", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var posts int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Replay-Nonce", "n")
+				if r.Method == http.MethodPost {
+					posts++
+					tt.reply(w)
+				}
+			}))
+			defer srv.Close()
+			c := &client{http: srv.Client(), key: testKey()}
+			c.directory.NewNonce = srv.URL
+			var v struct{}
+			_, err := c.post(context.Background(), srv.URL, map[string]string{}, &v)
+			want := strings.ReplaceAll(tt.want, "URL", srv.URL)
+			if got := errString(err); got != want {
+				t.Errorf("err = %q, want %q", got, want)
+			}
+			if posts != tt.posts {
+				t.Errorf("%d requests, want %d", posts, tt.posts)
+			}
+		})
+	}
+}
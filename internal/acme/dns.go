@@ -0,0 +1,214 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"pi-agent/internal/config"
+)
+
+// DNS publishes the TXT records answering DNS-01 challenges. Name is the
+// record's fully qualified name without the final dot, e.g.
+// "_acme-challenge.pi.home.example.com".
+type DNS interface {
+	Present(ctx context.Context, name, value string) error
+	CleanUp(ctx context.Context, name, value string) error
+}
+
+// NewDNS returns the configured provider.
+func NewDNS(cfg config.DNSProvider) (DNS, error) {
+	switch cfg.Provider {
+	case "cloudflare":
+		if cfg.TokenValue() == "" {
+			return nil, fmt.Errorf("tls.dns: $%s is empty", cfg.TokenEnv)
+		}
+		return &cloudflare{token: cfg.TokenValue(), records: make(map[string]cloudflareRecord)}, nil
+	case "duckdns":
+		if cfg.TokenValue() == "" {
+			return nil, fmt.Errorf("tls.dns: $%s is empty", cfg.TokenEnv)
+		}
+		return &duckDNS{token: cfg.TokenValue()}, nil
+	case "exec":
+		if len(cfg.Command) == 0 {
+			return nil, errors.New("tls.dns: the exec provider needs a command")
+		}
+		return execDNS(cfg.Command), nil
+	}
+	return nil, fmt.Errorf("tls.dns: unknown provider %q", cfg.Provider)
+}
+
+var dnsClient = &http.Client{Timeout: 30 * time.Second}
+
+// cloudflare manages records through the Cloudflare API, finding each
+// record's zone among the token's zones.
+type cloudflare struct {
+	token   string
+	mu      sync.Mutex
+	records map[string]cloudflareRecord // by name and value
+}
+
+type cloudflareRecord struct{ zone, id string }
+
+const cloudflareAPI = "https://api.cloudflare.com/client/v4"
+
+func (c *cloudflare) Present(ctx context.Context, name, value string) error {
+	zone, err := c.zone(ctx, name)
+	if err != nil {
+		return err
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	body := map[string]any{"type": "TXT", "name": name, "content": value, "ttl": 120}
+	if err := c.call(ctx, http.MethodPost, "/zones/"+zone+"/dns_records", body, &created); err != nil {
+		return fmt.Errorf("cloudflare: creating %s: %w", name, err)
+	}
+	c.mu.Lock()
+	c.records[name+" "+value] = cloudflareRecord{zone, created.ID}
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *cloudflare) CleanUp(ctx context.Context, name, value string) error {
+	c.mu.Lock()
+	rec, ok := c.records[name+" "+value]
+	delete(c.records, name+" "+value)
+	c.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	if err := c.call(ctx, http.MethodDelete, "/zones/"+rec.zone+"/dns_records/"+rec.id, nil, nil); err != nil {
+		return fmt.Errorf("cloudflare: deleting %s: %w", name, err)
+	}
+	return nil
+}
+
+// zone returns the ID of the zone name belongs to: the longest of its
+// parent domains that is a zone.
+func (c *cloudflare) zone(ctx context.Context, name string) (string, error) {
+	labels := strings.Split(name, ".")
+	for i := 1; i < len(labels)-1; i++ {
+		var zones []struct {
+			ID string `json:"id"`
+		}
+		candidate := strings.Join(labels[i:], ".")
+		if err := c.call(ctx, http.MethodGet, "/zones?name="+url.QueryEscape(candidate), nil, &zones); err != nil {
+			return "", fmt.Errorf("cloudflare: finding zone of %s: %w", name, err)
+		}
+		if len(zones) > 0 {
+			return zones[0].ID, nil
+		}
+	}
+	return "", fmt.Errorf("cloudflare: no zone for %s", name)
+}
+
+// call makes an API request and decodes its result into v.
+func (c *cloudflare) call(ctx context.Context, method, path string, body, v any) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, cloudflareAPI+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := dnsClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Success bool `json:"success"`
+		Errors  []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponse)).Decode(&out); err != nil {
+		return fmt.Errorf("%s: %w", resp.Status, err)
+	}
+	if !out.Success {
+		if len(out.Errors) > 0 {
+			return errors.New(out.Errors[0].Message)
+		}
+		return errors.New(resp.Status)
+	}
+	if v != nil {
+		return json.Unmarshal(out.Result, v)
+	}
+	return nil
+}
+
+// duckDNS sets the one TXT record DuckDNS keeps per account, for names
+// under duckdns.org.
+type duckDNS struct{ token string }
+
+func (d *duckDNS) Present(ctx context.Context, name, value string) error {
+	return d.update(ctx, name, url.Values{"txt": {value}})
+}
+
+func (d *duckDNS) CleanUp(ctx context.Context, name, value string) error {
+	return d.update(ctx, name, url.Values{"txt": {value}, "clear": {"true"}})
+}
+
+func (d *duckDNS) update(ctx context.Context, name string, q url.Values) error {
+	sub, ok := strings.CutSuffix(name, ".duckdns.org")
+	if !ok {
+		return fmt.Errorf("duckdns: %s is not under duckdns.org", name)
+	}
+	// DuckDNS takes the subdomain the account owns, the last label
+	// before duckdns.org.
+	q.Set("domains", sub[strings.LastIndexByte(sub, '.')+1:])
+	q.Set("token", d.token)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://www.duckdns.org/update?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := dnsClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("duckdns: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64))
+	if strings.TrimSpace(string(body)) != "OK" {
+		return fmt.Errorf("duckdns: update refused: %s", strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// execDNS runs a program to change records, for any other DNS host.
+type execDNS []string
+
+func (e execDNS) Present(ctx context.Context, name, value string) error {
+	return e.run(ctx, "present", name, value)
+}
+
+func (e execDNS) CleanUp(ctx context.Context, name, value string) error {
+	return e.run(ctx, "cleanup", name, value)
+}
+
+func (e execDNS) run(ctx context.Context, action, name, value string) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+	args := append(append([]string(nil), e[1:]...), action, name, value)
+	if out, err := exec.CommandContext(ctx, e[0], args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("dns %s %s: %w: %s", action, name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package acme
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"pi-agent/internal/config"
+)
+
+// redirect sends the DNS providers' requests to h for the rest of the
+// test, keeping their paths and queries.
+func redirect(t *testing.T, h http.HandlerFunc) {
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	target, _ := url.Parse(srv.URL)
+	saved := dnsClient
+	dnsClient = &http.Client{Transport: rewrite{target}}
+	t.Cleanup(func() { dnsClient = saved })
+}
+
+type rewrite struct{ target *url.URL }
+
+func (rw rewrite) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("X-Original-Host", r.URL.Host)
+	r.URL.Scheme, r.URL.Host = rw.target.Scheme, rw.target.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestNewDNS(t *testing.T) {
+	t.Setenv("TEST_DNS_TOKEN", "secret")
+	tests := []struct {
+		cfg  config.DNSProvider
+		want string // the error, if any
+	}{
+		{config.DNSProvider{Provider: "cloudflare", TokenEnv: "TEST_DNS_TOKEN"}, ""},
+		{config.DNSProvider{Provider: "duckdns", TokenEnv: "TEST_DNS_TOKEN"}, ""},
+		{config.DNSProvider{Provider: "exec", Command: []string{"/bin/true"}}, ""},
+		{config.DNSProvider{Provider: "cloudflare", TokenEnv: "TEST_DNS_UNSET"}, "tls.dns: $TEST_DNS_UNSET is empty"},
+		{config.DNSProvider{Provider: "duckdns"}, "tls.dns: $ is empty"},
+		{config.DNSProvider{Provider: "exec"}, "tls.dns: the exec provider needs a command"},
+		{config.DNSProvider{Provider: "route53"}, `tls.dns: unknown provider "route53"`},
+	}
+	for _, tt := range tests {
+		_, err := NewDNS(tt.cfg)
+		if got := errString(err); got != tt.want {
+			t.Errorf("NewDNS(%+v) = %q, want %q", tt.cfg, got, tt.want)
+		}
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func TestCloudflare(t *testing.T) {
+	var calls []string
+	redirect(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("Authorization = %q", got)
+		}
+		if got := r.Header.Get("X-Original-Host"); got != "api.cloudflare.com" {
+			t.Errorf("request to %s", got)
+		}
+		body, _ := io.ReadAll(r.Body)
+		calls = append(calls, r.Method+" "+r.URL.RequestURI()+" "+string(body))
+		switch {
+		case r.URL.Path == "/client/v4/zones" && r.URL.Query().Get("name") == "example.com":
+			w.Write([]byte(`{"success":true,"result":[{"id":"z1"}]}`))
+		case r.URL.Path == "/client/v4/zones":
+			w.Write([]byte(`{"success":true,"result":[]}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/client/v4/zones/z1/dns_records":
+			w.Write([]byte(`{"success":true,"result":{"id":"r9"}}`))
+		case r.Method == http.MethodDelete:
+			w.Write([]byte(`{"success":true,"result":{"id":"r9"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"success":false,"errors":[{"code":7003,"message":"Could not route"}]}`))
+		}
+	})
+	d := &cloudflare{token: "secret", records: make(map[string]cloudflareRecord)}
+	ctx := context.Background()
+	if err := d.Present(ctx, "_acme-challenge.pi.home.example.com", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.CleanUp(ctx, "_acme-challenge.pi.home.example.com", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	// Cleaning up a record that was never created does nothing.
+	if err := d.CleanUp(ctx, "_acme-challenge.pi.home.example.com", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"GET /client/v4/zones?name=pi.home.example.com ",
+		"GET /client/v4/zones?name=home.example.com ",
+		"GET /client/v4/zones?name=example.com ",
+		`POST /client/v4/zones/z1/dns_records {"content":"v1","name":"_acme-challenge.pi.home.example.com","ttl":120,"type":"TXT"}`,
+		"DELETE /client/v4/zones/z1/dns_records/r9 ",
+	}
+	if strings.Join(calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("calls:\n%s\nwant:\n%s", strings.Join(calls, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCloudflareErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply func(w http.ResponseWriter, r *http.Request)
+		want  string
+	}{
+		{"no zone", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"success":true,"result":[]}`))
+		}, "cloudflare: no zone for _acme-challenge.pi.example.com"},
+		{"API error", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"success":false,"errors":[{"code":10000,"message":"Authentication error"}]}`))
+		}, "cloudflare: finding zone of _acme-challenge.pi.example.com: Authentication error"},
+		{"failure without errors", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(`{"success":false}`))
+		}, "cloudflare: finding zone of _acme-challenge.pi.example.com: 502 Bad Gateway"},
+		{"not JSON", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(`<html>`))
+		}, "cloudflare: finding zone of _acme-challenge.pi.example.com: 502 Bad Gateway: invalid character '<' looking for beginning of value"},
+		{"creation refused", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost {
+				w.Write([]byte(`{"success":false,"errors":[{"message":"Record already exists."}]}`))
+				return
+			}
+			w.Write([]byte(`{"success":true,"result":[{"id":"z1"}]}`))
+		}, "cloudflare: creating _acme-challenge.pi.example.com: Record already exists."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redirect(t, tt.reply)
+			d := &cloudflare{token: "secret", records: make(map[string]cloudflareRecord)}
+			err := d.Present(context.Background(), "_acme-challenge.pi.example.com", "v")
+			if got := errString(err); got != tt.want {
+				t.Errorf("err = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDuckDNS(t *testing.T) {
+	var queries []url.Values
+	reply := "OK"
+	redirect(t, func(w http.ResponseWriter, r *http.Request) {
+		if host := r.Header.Get("X-Original-Host"); host != "www.duckdns.org" || r.URL.Path != "/update" {
+			t.Errorf("request to %s%s", host, r.URL.Path)
+		}
+		queries = append(queries, r.URL.Query())
+		w.Write([]byte(reply))
+	})
+	d := &duckDNS{token: "tok"}
+	ctx := context.Background()
+	if err := d.Present(ctx, "_acme-challenge.pi.duckdns.org", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.CleanUp(ctx, "_acme-challenge.pi.duckdns.org", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	want := []url.Values{
+		{"domains": {"pi"}, "token": {"tok"}, "txt": {"v1"}},
+		{"domains": {"pi"}, "token": {"tok"}, "txt": {"v1"}, "clear": {"true"}},
+	}
+	if !reflect.DeepEqual(queries, want) {
+		t.Errorf("queries = %v, want %v", queries, want)
+	}
+
+	reply = "KO"
+	if err := d.Present(ctx, "_acme-challenge.pi.duckdns.org", "v1"); errString(err) != "duckdns: update refused: KO" {
+		t.Errorf("refused update: err = %v", err)
+	}
+	if err := d.Present(ctx, "_acme-challenge.pi.example.com", "v1"); errString(err) != "duckdns: _acme-challenge.pi.example.com is not under duckdns.org" {
+		t.Errorf("foreign name: err = %v", err)
+	}
+	if len(queries) != 3 {
+		t.Errorf("%d requests, want no request for the foreign name", len(queries))
+	}
+}
+
+func TestExecDNS(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	script := filepath.Join(dir, "hook.sh")
+	os.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" >> \"$1\"\n[ \"$3\" != fail.example.com ] || { echo 'no such zone' >&2; exit 3; }\n"), 0o755)
+	d := execDNS{script, log}
+	ctx := context.Background()
+	if err := d.Present(ctx, "_acme-challenge.pi.example.com", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.CleanUp(ctx, "_acme-challenge.pi.example.com", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	err := d.Present(ctx, "fail.example.com", "v2")
+	if want := "dns present fail.example.com: exit status 3: no such zone"; errString(err) != want {
+		t.Errorf("err = %v, want %q", err, want)
+	}
+	data, _ := os.ReadFile(log)
+	want := log + " present _acme-challenge.pi.example.com v1\n" +
+		log + " cleanup _acme-challenge.pi.example.com v1\n" +
+		log + " present fail.example.com v2\n"
+	if string(data) != want {
+		t.Errorf("hook ran with:\n%s\nwant:\n%s", data, want)
+	}
+}
@@ -0,0 +1,296 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"pi-agent/internal/config"
+)
+
+// renewBefore is how long before it expires a certificate is renewed.
+const renewBefore = 30 * 24 * time.Hour
+
+// pollInterval and pollTimeout pace waiting for the CA to validate
+// challenges and issue the certificate.
+const (
+	pollInterval = 3 * time.Second
+	pollTimeout  = 5 * time.Minute
+)
+
+// Manager keeps a certificate for the configured domains in a directory,
+// obtaining it when there is none and renewing it before it expires.
+type Manager struct {
+	cfg config.TLS
+	dir string
+	dns DNS
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// NewManager creates a manager keeping its account key and certificate
+// in dir.
+func NewManager(cfg config.TLS, dir string) (*Manager, error) {
+	dns, err := NewDNS(cfg.DNS)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	m := &Manager{cfg: cfg, dir: dir, dns: dns}
+	if cert, err := tls.LoadX509KeyPair(m.path("cert.pem"), m.path("key.pem")); err == nil {
+		m.cert = &cert
+	} else if !errors.Is(err, os.ErrNotExist) {
+		log.Printf("tls: ignoring stored certificate: %v", err)
+	}
+	return m, nil
+}
+
+// TLSConfig returns a server configuration serving the current
+// certificate, so that renewals take effect without a restart.
+func (m *Manager) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			m.mu.RLock()
+			defer m.mu.RUnlock()
+			if m.cert == nil {
+				return nil, errors.New("no certificate yet")
+			}
+			return m.cert, nil
+		},
+	}
+}
+
+// HasCertificate reports whether there is a certificate to serve, even if
+// it is due for renewal.
+func (m *Manager) HasCertificate() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.cert != nil
+}
+
+// Renew obtains a certificate if there is none, it expires within 30
+// days, or it does not cover the configured domains.
+func (m *Manager) Renew(ctx context.Context) error {
+	m.mu.RLock()
+	cert := m.cert
+	m.mu.RUnlock()
+	if cert != nil && cert.Leaf != nil && time.Until(cert.Leaf.NotAfter) > renewBefore && covers(cert.Leaf, m.cfg.Domains) {
+		return nil
+	}
+	log.Printf("tls: requesting a certificate for %s", strings.Join(m.cfg.Domains, ", "))
+	certPEM, keyPEM, err := m.obtain(ctx)
+	if err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	issued, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("tls: issued certificate: %w", err)
+	}
+	if err := os.WriteFile(m.path("key.pem"), keyPEM, 0o600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(m.path("cert.pem"), certPEM, 0o644); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.cert = &issued
+	m.mu.Unlock()
+	log.Printf("tls: certificate valid until %s", issued.Leaf.NotAfter.Local().Format(time.DateOnly))
+	return nil
+}
+
+func covers(leaf *x509.Certificate, domains []string) bool {
+	for _, d := range domains {
+		if !slices.Contains(leaf.DNSNames, d) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Manager) path(name string) string {
+	return filepath.Join(m.dir, name)
+}
+
+// obtain runs an ACME order to completion and returns the certificate
+// chain and its new private key as PEM.
+func (m *Manager) obtain(ctx context.Context) (certPEM, keyPEM []byte, err error) {
+	account, err := m.accountKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := newClient(ctx, m.cfg.DirectoryURL, account)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := c.register(ctx, m.cfg.Email); err != nil {
+		return nil, nil, err
+	}
+	o, orderURL, err := c.newOrder(ctx, m.cfg.Domains)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, authURL := range o.Authorizations {
+		if err := m.authorize(ctx, c, authURL); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: m.cfg.Domains[0]},
+		DNSNames: m.cfg.Domains,
+	}, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := c.post(ctx, o.Finalize, map[string]string{"csr": b64(csr)}, o); err != nil {
+		return nil, nil, fmt.Errorf("finalizing order: %w", err)
+	}
+	if err := poll(ctx, func() (bool, error) {
+		if o.Status == "valid" {
+			return true, nil
+		}
+		if o.Status == "invalid" {
+			return false, orderError(o)
+		}
+		_, err := c.get(ctx, orderURL, o)
+		return false, err
+	}); err != nil {
+		return nil, nil, err
+	}
+	if _, err := c.get(ctx, o.Certificate, &certPEM); err != nil {
+		return nil, nil, fmt.Errorf("downloading certificate: %w", err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return certPEM, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+// authorize proves control of an authorization's domain with its DNS-01
+// challenge.
+func (m *Manager) authorize(ctx context.Context, c *client, authURL string) error {
+	var a authorization
+	if _, err := c.get(ctx, authURL, &a); err != nil {
+		return fmt.Errorf("fetching authorization: %w", err)
+	}
+	if a.Status == "valid" {
+		return nil
+	}
+	i := slices.IndexFunc(a.Challenges, func(ch challenge) bool { return ch.Type == "dns-01" })
+	if i < 0 {
+		return fmt.Errorf("%s: the CA offers no DNS-01 challenge", a.Identifier.Value)
+	}
+	ch := a.Challenges[i]
+	name := "_acme-challenge." + strings.TrimPrefix(a.Identifier.Value, "*.")
+	value := c.dnsValue(ch.Token)
+	if err := m.dns.Present(ctx, name, value); err != nil {
+		return err
+	}
+	defer func() {
+		if err := m.dns.CleanUp(context.WithoutCancel(ctx), name, value); err != nil {
+			log.Printf("tls: removing %s: %v", name, err)
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Duration(m.cfg.PropagationSeconds) * time.Second):
+	}
+	if _, err := c.post(ctx, ch.URL, struct{}{}, nil); err != nil {
+		return fmt.Errorf("answering challenge for %s: %w", a.Identifier.Value, err)
+	}
+	return poll(ctx, func() (bool, error) {
+		if _, err := c.get(ctx, authURL, &a); err != nil {
+			return false, err
+		}
+		switch a.Status {
+		case "valid":
+			return true, nil
+		case "pending", "processing":
+			return false, nil
+		}
+		for _, ch := range a.Challenges {
+			if ch.Type == "dns-01" && ch.Error != nil {
+				return false, fmt.Errorf("%s: %w", a.Identifier.Value, ch.Error)
+			}
+		}
+		return false, fmt.Errorf("%s: authorization %s", a.Identifier.Value, a.Status)
+	})
+}
+
+func orderError(o *order) error {
+	if o.Error != nil {
+		return o.Error
+	}
+	return errors.New("order is invalid")
+}
+
+// poll calls check until it reports done or fails, or pollTimeout passes.
+func poll(ctx context.Context, check func() (bool, error)) error {
+	deadline := time.Now().Add(pollTimeout)
+	for {
+		done, err := check()
+		if done || err != nil {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return errors.New("timed out waiting for the CA")
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// accountKey loads the ACME account key, creating it on first use.
+func (m *Manager) accountKey() (*ecdsa.PrivateKey, error) {
+	path := m.path("account.key")
+	if data, err := os.ReadFile(path); err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("%s: not PEM", path)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
@@ -0,0 +1,499 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"pi-agent/internal/config"
+)
+
+// fakeCA is an ACME server that checks every request's JWS and nonce,
+// validates DNS-01 challenges against a fakeDNS and issues certificates
+// from a throwaway root.
+type fakeCA struct {
+	t   *testing.T
+	srv *httptest.Server
+	dns *fakeDNS
+
+	mu         sync.Mutex
+	nonces     map[string]bool
+	nonceCount int
+	account    *ecdsa.PublicKey
+	accounts   int // newAccount requests
+	contact    []string
+	badNonce   int // requests still to reject with badNonce
+	domains    []string
+	tokens     []string
+	status     []string // of each authorization
+	orders     int
+	issued     []byte
+	caKey      *ecdsa.PrivateKey
+	caCert     *x509.Certificate
+	lifetime   time.Duration
+	tamperAuth bool // reports authorizations invalid regardless
+}
+
+func newFakeCA(t *testing.T, dns *fakeDNS) *fakeCA {
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Fake ACME Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, _ := x509.ParseCertificate(der)
+	ca := &fakeCA{t: t, dns: dns, nonces: map[string]bool{}, caKey: caKey, caCert: caCert, lifetime: 90 * 24 * time.Hour}
+	ca.srv = httptest.NewServer(http.HandlerFunc(ca.serve))
+	t.Cleanup(ca.srv.Close)
+	return ca
+}
+
+func (ca *fakeCA) directoryURL() string { return ca.srv.URL + "/directory" }
+
+func (ca *fakeCA) newNonce() string {
+	ca.nonceCount++
+	n := fmt.Sprintf("nonce-%d", ca.nonceCount)
+	ca.nonces[n] = true
+	return n
+}
+
+func (ca *fakeCA) problem(w http.ResponseWriter, status int, typ, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(problem{Type: "urn:ietf:params:acme:error:" + typ, Detail: detail, Status: status})
+}
+
+func (ca *fakeCA) serve(w http.ResponseWriter, r *http.Request) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	w.Header().Set("Replay-Nonce", ca.newNonce())
+	base := ca.srv.URL
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/directory":
+		json.NewEncoder(w).Encode(map[string]string{"newNonce": base + "/nonce", "newAccount": base + "/account", "newOrder": base + "/order"})
+		return
+	case r.Method == http.MethodHead && r.URL.Path == "/nonce":
+		return
+	case r.Method != http.MethodPost:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	payload, ok := ca.verify(w, r)
+	if !ok {
+		return
+	}
+	path := r.URL.Path
+	switch {
+	case path == "/account":
+		var req struct {
+			Agreed  bool     `json:"termsOfServiceAgreed"`
+			Contact []string `json:"contact"`
+		}
+		json.Unmarshal(payload, &req)
+		if !req.Agreed {
+			ca.problem(w, 403, "userActionRequired", "agree to the terms of service")
+			return
+		}
+		ca.accounts++
+		ca.contact = req.Contact
+		w.Header().Set("Location", base+"/account/1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"status":"valid"}`))
+	case path == "/order":
+		var req struct {
+			Identifiers []struct{ Type, Value string } `json:"identifiers"`
+		}
+		json.Unmarshal(payload, &req)
+		ca.orders++
+		ca.domains, ca.tokens, ca.status = nil, nil, nil
+		for i, id := range req.Identifiers {
+			if id.Type != "dns" {
+				ca.problem(w, 400, "unsupportedIdentifier", id.Type)
+				return
+			}
+			ca.domains = append(ca.domains, id.Value)
+			ca.tokens = append(ca.tokens, fmt.Sprintf("token-%d-%d", ca.orders, i))
+			ca.status = append(ca.status, "pending")
+		}
+		w.Header().Set("Location", base+"/order/1")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(ca.order())
+	case strings.HasPrefix(path, "/authz/"):
+		var i int
+		fmt.Sscan(path[len("/authz/"):], &i)
+		if len(payload) != 0 {
+			ca.problem(w, 400, "malformed", "authorizations are fetched with POST-as-GET")
+			return
+		}
+		json.NewEncoder(w).Encode(ca.authorization(i))
+	case strings.HasPrefix(path, "/chall/"):
+		var i int
+		fmt.Sscan(path[len("/chall/"):], &i)
+		if string(payload) != "{}" {
+			ca.problem(w, 400, "malformed", "challenge responses are {}")
+			return
+		}
+		ca.status[i] = ca.validate(i)
+		json.NewEncoder(w).Encode(ca.authorization(i).Challenges[1])
+	case path == "/order/1/finalize":
+		var req struct {
+			CSR string `json:"csr"`
+		}
+		json.Unmarshal(payload, &req)
+		der, _ := base64.RawURLEncoding.DecodeString(req.CSR)
+		csr, err := x509.ParseCertificateRequest(der)
+		if err != nil || csr.CheckSignature() != nil {
+			ca.problem(w, 400, "badCSR", "unparsable CSR")
+			return
+		}
+		if !slices.Equal(csr.DNSNames, ca.domains) {
+			ca.problem(w, 400, "badCSR", "CSR names do not match the order")
+			return
+		}
+		for i := range ca.domains {
+			if ca.status[i] != "valid" {
+				ca.problem(w, 403, "orderNotReady", "authorizations are not valid")
+				return
+			}
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(ca.orders + 1)),
+			Subject:      pkix.Name{CommonName: csr.Subject.CommonName},
+			DNSNames:     csr.DNSNames,
+			NotBefore:    time.Now().Add(-time.Minute),
+			NotAfter:     time.Now().Add(ca.lifetime),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		leaf, err := x509.CreateCertificate(rand.Reader, tmpl, ca.caCert, csr.PublicKey, ca.caKey)
+		if err != nil {
+			ca.t.Errorf("fake CA: issuing: %v", err)
+			ca.problem(w, 500, "serverInternal", err.Error())
+			return
+		}
+		ca.issued = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf}), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.caCert.Raw})...)
+		json.NewEncoder(w).Encode(ca.order())
+	case path == "/order/1":
+		json.NewEncoder(w).Encode(ca.order())
+	case path == "/cert/1":
+		if ca.issued == nil {
+			ca.problem(w, 404, "malformed", "no certificate")
+			return
+		}
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.Write(ca.issued)
+	default:
+		ca.problem(w, 404, "malformed", "no such resource "+path)
+	}
+}
+
+// verify checks a request's flattened JWS and returns its payload,
+// writing a problem and returning false if it is not acceptable.
+func (ca *fakeCA) verify(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if ct := r.Header.Get("Content-Type"); ct != "application/jose+json" {
+		ca.problem(w, 415, "malformed", "content type "+ct)
+		return nil, false
+	}
+	var jws struct{ Protected, Payload, Signature string }
+	if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+		ca.problem(w, 400, "malformed", err.Error())
+		return nil, false
+	}
+	dec := base64.RawURLEncoding
+	headerJSON, err1 := dec.DecodeString(jws.Protected)
+	payload, err2 := dec.DecodeString(jws.Payload)
+	sig, err3 := dec.DecodeString(jws.Signature)
+	var header struct {
+		Alg   string          `json:"alg"`
+		Nonce string          `json:"nonce"`
+		URL   string          `json:"url"`
+		KID   string          `json:"kid"`
+		JWK   json.RawMessage `json:"jwk"`
+	}
+	if err1 != nil || err2 != nil || err3 != nil || json.Unmarshal(headerJSON, &header) != nil {
+		ca.problem(w, 400, "malformed", "bad JWS encoding")
+		return nil, false
+	}
+	if header.Alg != "ES256" || len(sig) != 64 {
+		ca.problem(w, 400, "badSignatureAlgorithm", header.Alg)
+		return nil, false
+	}
+	if header.URL != ca.srv.URL+r.URL.Path {
+		ca.problem(w, 401, "unauthorized", "url "+header.URL)
+		return nil, false
+	}
+	if !ca.nonces[header.Nonce] {
+		ca.problem(w, 400, "badNonce", "nonce "+header.Nonce+" is unknown or used")
+		return nil, false
+	}
+	delete(ca.nonces, header.Nonce)
+	if ca.badNonce > 0 {
+		ca.badNonce--
+		ca.problem(w, 400, "badNonce", "try again")
+		return nil, false
+	}
+
+	var key *ecdsa.PublicKey
+	switch {
+	case r.URL.Path == "/account" && header.JWK != nil && header.KID == "":
+		var jwk struct{ Kty, Crv, X, Y string }
+		json.Unmarshal(header.JWK, &jwk)
+		x, _ := dec.DecodeString(jwk.X)
+		y, _ := dec.DecodeString(jwk.Y)
+		if jwk.Kty != "EC" || jwk.Crv != "P-256" || len(x) != 32 || len(y) != 32 {
+			ca.problem(w, 400, "badPublicKey", string(header.JWK))
+			return nil, false
+		}
+		key = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if ca.account != nil && !ca.account.Equal(key) {
+			ca.problem(w, 401, "unauthorized", "a different account key")
+			return nil, false
+		}
+		ca.account = key
+	case header.JWK == nil && header.KID == ca.srv.URL+"/account/1" && ca.account != nil:
+		key = ca.account
+	default:
+		ca.problem(w, 401, "malformed", "requests must carry a jwk (newAccount) or the account's kid")
+		return nil, false
+	}
+	digest := sha256.Sum256([]byte(jws.Protected + "." + jws.Payload))
+	if !ecdsa.Verify(key, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		ca.problem(w, 401, "unauthorized", "bad signature")
+		return nil, false
+	}
+	return payload, true
+}
+
+// validate checks the TXT record answering authorization i's challenge,
+// which must hold the key authorization's digest (RFC 8555 section 8.4).
+func (ca *fakeCA) validate(i int) string {
+	jwk := fmt.Sprintf(`{"crv":"P-256","kty":"EC","x":%q,"y":%q}`, b64(pad(ca.account.X)), b64(pad(ca.account.Y)))
+	thumb := sha256.Sum256([]byte(jwk))
+	want := sha256.Sum256([]byte(ca.tokens[i] + "." + b64(thumb[:])))
+	if !ca.tamperAuth && ca.dns.has("_acme-challenge."+strings.TrimPrefix(ca.domains[i], "*."), b64(want[:])) {
+		return "valid"
+	}
+	return "invalid"
+}
+
+func (ca *fakeCA) authorization(i int) authorization {
+	var a authorization
+	a.Identifier.Value = strings.TrimPrefix(ca.domains[i], "*.")
+	a.Wildcard = strings.HasPrefix(ca.domains[i], "*.")
+	a.Status = ca.status[i]
+	dnsChall := challenge{Type: "dns-01", URL: fmt.Sprintf("%s/chall/%d", ca.srv.URL, i), Token: ca.tokens[i], Status: ca.status[i]}
+	if a.Status == "invalid" {
+		dnsChall.Error = &problem{Type: "urn:ietf:params:acme:error:unauthorized", Detail: "no matching TXT record found"}
+	}
+	a.Challenges = []challenge{
+		{Type: "http-01", URL: ca.srv.URL + "/unused", Token: "http-token", Status: "pending"},
+		dnsChall,
+	}
+	return a
+}
+
+func (ca *fakeCA) order() order {
+	o := order{Status: "pending", Finalize: ca.srv.URL + "/order/1/finalize"}
+	for i := range ca.domains {
+		o.Authorizations = append(o.Authorizations, fmt.Sprintf("%s/authz/%d", ca.srv.URL, i))
+		if ca.status[i] == "invalid" {
+			o.Status = "invalid"
+		}
+	}
+	if ca.issued != nil {
+		o.Status, o.Certificate = "valid", ca.srv.URL+"/cert/1"
+	}
+	return o
+}
+
+// fakeDNS records the TXT records presented, and every change.
+type fakeDNS struct {
+	mu      sync.Mutex
+	records map[string]bool
+	log     []string
+}
+
+func (d *fakeDNS) Present(ctx context.Context, name, value string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.records == nil {
+		d.records = map[string]bool{}
+	}
+	d.records[name+" "+value] = true
+	d.log = append(d.log, "present "+name)
+	return nil
+}
+
+func (d *fakeDNS) CleanUp(ctx context.Context, name, value string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.records, name+" "+value)
+	d.log = append(d.log, "cleanup "+name)
+	return nil
+}
+
+func (d *fakeDNS) has(name, value string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.records[name+" "+value]
+}
+
+func newTestManager(t *testing.T, ca *fakeCA, dir string, domains ...string) *Manager {
+	t.Helper()
+	m, err := NewManager(config.TLS{
+		Domains:      domains,
+		Email:        "ops@example.com",
+		DirectoryURL: ca.directoryURL(),
+		DNS:          config.DNSProvider{Provider: "exec", Command: []string{"unused"}},
+	}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.dns = ca.dns
+	return m
+}
+
+func TestManagerRenew(t *testing.T) {
+	dns := &fakeDNS{}
+	ca := newFakeCA(t, dns)
+	ca.badNonce = 1 // the first signed request must be retried
+	dir := t.TempDir()
+	m := newTestManager(t, ca, dir, "pi.home.example.com", "*.pi.home.example.com")
+	if m.HasCertificate() {
+		t.Fatal("new manager has a certificate")
+	}
+	if _, err := m.TLSConfig().GetCertificate(nil); err == nil {
+		t.Error("served a certificate before having one")
+	}
+
+	if err := m.Renew(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !m.HasCertificate() {
+		t.Fatal("no certificate after renewing")
+	}
+	cert, err := m.TLSConfig().GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"pi.home.example.com", "*.pi.home.example.com"}; !slices.Equal(cert.Leaf.DNSNames, want) {
+		t.Errorf("certificate for %v, want %v", cert.Leaf.DNSNames, want)
+	}
+	if len(cert.Certificate) != 2 {
+		t.Errorf("chain of %d certificates, want the leaf and the root", len(cert.Certificate))
+	}
+	if got := strings.Join(ca.contact, ","); got != "mailto:ops@example.com" {
+		t.Errorf("account contact %q", got)
+	}
+	// Both authorizations share a record name; each is cleaned up.
+	if want := "present _acme-challenge.pi.home.example.com,cleanup _acme-challenge.pi.home.example.com,present _acme-challenge.pi.home.example.com,cleanup _acme-challenge.pi.home.example.com"; strings.Join(dns.log, ",") != want {
+		t.Errorf("DNS changes %q", dns.log)
+	}
+	if len(dns.records) != 0 {
+		t.Errorf("records left behind: %v", dns.records)
+	}
+	for _, name := range []string{"account.key", "key.pem", "cert.pem"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != "cert.pem" && info.Mode().Perm() != 0o600 {
+			t.Errorf("%s has mode %v, want 0600", name, info.Mode().Perm())
+		}
+	}
+
+	// A fresh certificate is kept, also by a new manager reading it back.
+	if err := m.Renew(context.Background()); err != nil || ca.orders != 1 {
+		t.Errorf("second renewal: %v, %d orders, want 1", err, ca.orders)
+	}
+	m2 := newTestManager(t, ca, dir, "pi.home.example.com", "*.pi.home.example.com")
+	if !m2.HasCertificate() {
+		t.Fatal("stored certificate not loaded")
+	}
+	if err := m2.Renew(context.Background()); err != nil || ca.orders != 1 {
+		t.Errorf("renewal after restart: %v, %d orders, want 1", err, ca.orders)
+	}
+
+	// A domain the certificate lacks means a new order with the same
+	// account.
+	m3 := newTestManager(t, ca, dir, "pi.home.example.com", "nas.home.example.com")
+	if err := m3.Renew(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if ca.orders != 2 || ca.accounts != 2 {
+		t.Errorf("%d orders and %d account requests, want 2 each", ca.orders, ca.accounts)
+	}
+}
+
+func TestManagerRenewsExpiring(t *testing.T) {
+	ca := newFakeCA(t, &fakeDNS{})
+	ca.lifetime = 20 * 24 * time.Hour // within the renewal window
+	m := newTestManager(t, ca, t.TempDir(), "pi.example.com")
+	for range 2 {
+		if err := m.Renew(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ca.orders != 2 {
+		t.Errorf("%d orders, want a renewal of the expiring certificate", ca.orders)
+	}
+}
+
+func TestManagerChallengeFails(t *testing.T) {
+	dns := &fakeDNS{}
+	ca := newFakeCA(t, dns)
+	ca.tamperAuth = true
+	m := newTestManager(t, ca, t.TempDir(), "pi.example.com")
+	err := m.Renew(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "pi.example.com: acme: no matching TXT record found (urn:ietf:params:acme:error:unauthorized)") {
+		t.Errorf("err = %v, want the challenge's error", err)
+	}
+	if m.HasCertificate() {
+		t.Error("certificate after a failed order")
+	}
+	if len(dns.records) != 0 {
+		t.Errorf("records left behind: %v", dns.records)
+	}
+}
+
+func TestNewManagerIgnoresBrokenCertificate(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "cert.pem"), []byte("garbage"), 0o644)
+	os.WriteFile(filepath.Join(dir, "key.pem"), []byte("garbage"), 0o600)
+	ca := newFakeCA(t, &fakeDNS{})
+	m := newTestManager(t, ca, dir, "pi.example.com")
+	if m.HasCertificate() {
+		t.Error("loaded a broken certificate")
+	}
+	os.WriteFile(filepath.Join(dir, "account.key"), []byte("garbage"), 0o600)
+	if err := m.Renew(context.Background()); err == nil || !strings.Contains(err.Error(), "not PEM") {
+		t.Errorf("err = %v, want the broken account key reported", err)
+	}
+}
@@ -0,0 +1,155 @@
+// Package approval queues actions the agent may only take once a person
+// has allowed them, such as running code or changing files.
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"pi-agent/internal/notify"
+	"pi-agent/internal/store"
+)
+
+// ErrDenied is returned when the policy refuses a kind of request outright.
+var ErrDenied = errors.New("not allowed by the approval policy")
+
+// Policies for a kind of request.
+const (
+	Ask   = "ask"   // wait for a person to decide (the default)
+	Allow = "allow" // carry it out straight away
+	Deny  = "deny"  // refuse it
+)
+
+// Handler carries out an approved action and returns a description of the
+// outcome.
+type Handler func(ctx context.Context, a *store.Approval) (string, error)
+
+// Queue holds approval requests and the handlers that carry them out.
+type Queue struct {
+	db       *store.DB
+	notifier notify.Notifier
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+	policy   map[string]string
+}
+
+// NewQueue creates a queue. The notifier, which may be nil, is told about
+// each new request.
+func NewQueue(db *store.DB, notifier notify.Notifier) *Queue {
+	return &Queue{db: db, notifier: notifier, handlers: make(map[string]Handler)}
+}
+
+// SetPolicy sets how each kind of request is treated; kinds not listed
+// wait for a decision.
+func (q *Queue) SetPolicy(policy map[string]string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.policy = policy
+}
+
+// Handle sets the handler for a kind of request.
+func (q *Queue) Handle(kind string, h Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[kind] = h
+}
+
+// Request queues an action for approval. The payload is marshaled to JSON
+// and passed to the kind's handler once approved. If the policy allows the
+// kind outright it is carried out before Request returns, and the returned
+// approval is no longer pending; see Outcome.
+func (q *Queue) Request(ctx context.Context, conversationID, kind, summary string, payload any) (*store.Approval, error) {
+	q.mu.RLock()
+	_, ok := q.handlers[kind]
+	policy := q.policy[kind]
+	q.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no handler for %q approvals", kind)
+	}
+	if policy == Deny {
+		return nil, fmt.Errorf("%s: %w", kind, ErrDenied)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	a := &store.Approval{ConversationID: conversationID, Kind: kind, Summary: summary, Payload: data}
+	if err := q.db.AddApproval(a); err != nil {
+		return nil, err
+	}
+	if policy == Allow {
+		return q.Decide(ctx, a.ID, true)
+	}
+	if q.notifier != nil {
+		msg := notify.Message{Title: fmt.Sprintf("Approval needed (#%d)", a.ID), Body: summary, Priority: notify.PriorityHigh, Tags: []string{"question"}}
+		if err := q.notifier.Notify(ctx, msg); err != nil {
+			log.Printf("approval %d: notify error: %v", a.ID, err)
+		}
+	}
+	return q.db.Approval(a.ID)
+}
+
+// Decide approves or rejects a pending request. An approved request is
+// carried out straight away; either way the outcome is recorded on the
+// request and posted to its conversation. It returns store.ErrDecided if
+// the request was already decided.
+func (q *Queue) Decide(ctx context.Context, id int64, approve bool) (*store.Approval, error) {
+	status := store.ApprovalRejected
+	if approve {
+		status = store.ApprovalApproved
+	}
+	if err := q.db.ClaimApproval(id, status); err != nil {
+		return nil, err
+	}
+	a, err := q.db.Approval(id)
+	if err != nil {
+		return nil, err
+	}
+
+	note := fmt.Sprintf("Rejected: %s", a.Summary)
+	if approve {
+		q.mu.RLock()
+		h := q.handlers[a.Kind]
+		q.mu.RUnlock()
+		var result string
+		if h == nil {
+			err = fmt.Errorf("no handler for %q approvals", a.Kind)
+		} else {
+			result, err = h(ctx, a)
+		}
+		if err != nil {
+			a.Status, a.Result = store.ApprovalFailed, err.Error()
+			note = fmt.Sprintf("Approved, but it failed: %s\n\n%s", a.Summary, a.Result)
+		} else {
+			a.Result = result
+			note = fmt.Sprintf("Approved and done: %s\n\n%s", a.Summary, a.Result)
+		}
+		if err := q.db.FinishApproval(id, a.Status, a.Result); err != nil {
+			return nil, err
+		}
+	}
+	if a.ConversationID != "" {
+		if err := q.db.AddMessage(a.ConversationID, store.RoleAssistant, note); err != nil {
+			log.Printf("approval %d: db error: %v", id, err)
+		}
+	}
+	return a, nil
+}
+
+// Outcome describes a request for the model: that it is waiting for
+// approval, or what happened if the policy let it through.
+func Outcome(a *store.Approval) string {
+	switch a.Status {
+	case store.ApprovalPending:
+		return fmt.Sprintf("Waiting for the user's approval as request #%d.", a.ID)
+	case store.ApprovalFailed:
+		return "Allowed by policy, but it failed: " + a.Result
+	default:
+		return "Allowed by policy and done. " + a.Result
+	}
+}
@@ -0,0 +1,270 @@
+// Package attachments keeps uploaded images, recordings and files on disk
+// within per-user and global quotas. Messages refer to attachments by ID,
+// and a garbage collector deletes the ones no stored message refers to.
+package attachments
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"pi-agent/internal/config"
+	"pi-agent/internal/store"
+)
+
+// ErrQuota marks uploads that would exceed a storage quota.
+var ErrQuota = errors.New("storage quota exceeded")
+
+// ErrTooLarge marks uploads over the size limit for a single file.
+var ErrTooLarge = errors.New("attachment too large")
+
+const mb = 1 << 20
+
+var idRe = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// Store saves attachments under a directory and records them in the
+// database.
+type Store struct {
+	db   *store.DB
+	dir  string
+	conf config.Attachments
+
+	mu sync.Mutex // makes each quota check and the upload it admits atomic
+}
+
+// New creates a store keeping files under dir, which is created if
+// needed.
+func New(db *store.DB, dir string, conf config.Attachments) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("creating attachment directory: %w", err)
+	}
+	return &Store{db: db, dir: dir, conf: conf}, nil
+}
+
+// path returns where an attachment's content is kept, spread over
+// subdirectories so none grows too large.
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id[:2], id)
+}
+
+// Save stores an upload for a user, failing with ErrTooLarge or ErrQuota
+// if it does not fit.
+func (s *Store) Save(user, name, contentType string, r io.Reader) (*store.Attachment, error) {
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	limit := int64(s.conf.MaxFileMB) * mb
+	src := r
+	if limit > 0 {
+		src = io.LimitReader(r, limit+1)
+	}
+	n, err := io.Copy(tmp, src)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("saving attachment: %w", err)
+	}
+	if limit > 0 && n > limit {
+		return nil, fmt.Errorf("%w: the limit is %d MB", ErrTooLarge, s.conf.MaxFileMB)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if quota := int64(s.conf.QuotaMB) * mb; quota > 0 {
+		used, err := s.db.AttachmentBytes()
+		if err != nil {
+			return nil, err
+		}
+		if used+n > quota {
+			return nil, fmt.Errorf("%w: %s of the %d MB for all users is in use", ErrQuota, megabytes(used), s.conf.QuotaMB)
+		}
+	}
+	if quota := int64(s.conf.UserQuota(user)) * mb; quota > 0 {
+		used, err := s.db.UserAttachmentBytes(user)
+		if err != nil {
+			return nil, err
+		}
+		if used+n > quota {
+			return nil, fmt.Errorf("%w: %s of your %d MB is in use", ErrQuota, megabytes(used), quota/mb)
+		}
+	}
+
+	a := &store.Attachment{ID: newID(), User: user, Name: filepath.Base(name), ContentType: contentType, Size: n}
+	if a.Name == "." || a.Name == string(filepath.Separator) {
+		a.Name = ""
+	}
+	path := s.path(a.ID)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+	if err := s.db.AddAttachment(a); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return a, nil
+}
+
+// Open returns an attachment and its content, which the caller must
+// close, or store.ErrNotFound.
+func (s *Store) Open(id string) (*store.Attachment, *os.File, error) {
+	if !idRe.MatchString(id) {
+		return nil, nil, store.ErrNotFound
+	}
+	a, err := s.db.Attachment(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(s.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, store.ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return a, f, nil
+}
+
+// Check returns store.ErrNotFound unless every ID names an attachment,
+// so a message is not stored with references to nothing.
+func (s *Store) Check(ids []string) error {
+	for _, id := range ids {
+		if !idRe.MatchString(id) {
+			return fmt.Errorf("%w: attachment %q", store.ErrNotFound, id)
+		}
+		if _, err := s.db.Attachment(id); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return fmt.Errorf("%w: attachment %q", store.ErrNotFound, id)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Report describes a garbage collection run.
+type Report struct {
+	Deleted int   `json:"deleted"` // attachments no message referred to
+	Bytes   int64 `json:"bytes"`   // space they took
+	Stray   int   `json:"stray"`   // files without a record, e.g. from interrupted uploads
+}
+
+// GC deletes the attachments older than the grace period that no stored
+// message refers to, and files left without a record.
+func (s *Store) GC(ctx context.Context) (*Report, error) {
+	cutoff := time.Now().Add(-time.Duration(s.conf.GCGraceHours) * time.Hour)
+	orphans, err := s.db.OrphanedAttachments(cutoff)
+	if err != nil {
+		return nil, err
+	}
+	var r Report
+	for _, a := range orphans {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err := os.Remove(s.path(a.ID)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		if err := s.db.DeleteAttachment(a.ID); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return nil, err
+		}
+		r.Deleted++
+		r.Bytes += a.Size
+	}
+
+	err = filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			return err
+		}
+		name := d.Name()
+		if idRe.MatchString(name) {
+			if _, err := s.db.Attachment(name); !errors.Is(err, store.ErrNotFound) {
+				return err
+			}
+		} else if !strings.HasPrefix(name, ".upload-") {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		r.Stray++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if r.Deleted > 0 || r.Stray > 0 {
+		log.Printf("attachments: deleted %d unreferenced (%s) and %d stray files", r.Deleted, megabytes(r.Bytes), r.Stray)
+	}
+	return &r, nil
+}
+
+// Usage is what attachments take up, overall and per user.
+type Usage struct {
+	Attachments int   `json:"attachments"`
+	Bytes       int64 `json:"bytes"`
+	QuotaBytes  int64 `json:"quota_bytes,omitempty"` // 0 if unlimited
+	// Unreferenced counts attachments no stored message refers to, which
+	// GC deletes once they are past the grace period.
+	Unreferenced      int         `json:"unreferenced"`
+	UnreferencedBytes int64       `json:"unreferenced_bytes"`
+	Users             []UserUsage `json:"users"`
+}
+
+// UserUsage is what a user's attachments take up.
+type UserUsage struct {
+	store.AttachmentUsage
+	QuotaBytes int64 `json:"quota_bytes,omitempty"` // 0 if unlimited
+}
+
+// Usage reports the storage used.
+func (s *Store) Usage() (*Usage, error) {
+	users, err := s.db.AttachmentUsage()
+	if err != nil {
+		return nil, err
+	}
+	orphans, err := s.db.OrphanedAttachments(time.Now().Add(time.Second))
+	if err != nil {
+		return nil, err
+	}
+	u := &Usage{QuotaBytes: int64(s.conf.QuotaMB) * mb, Unreferenced: len(orphans), Users: []UserUsage{}}
+	for _, a := range orphans {
+		u.UnreferencedBytes += a.Size
+	}
+	for _, au := range users {
+		u.Attachments += au.Attachments
+		u.Bytes += au.Bytes
+		u.Users = append(u.Users, UserUsage{AttachmentUsage: au, QuotaBytes: int64(s.conf.UserQuota(au.User)) * mb})
+	}
+	return u, nil
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func megabytes(n int64) string {
+	return fmt.Sprintf("%.1f MB", float64(n)/mb)
+}
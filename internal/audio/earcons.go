@@ -0,0 +1,153 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// Cue identifies a short audio cue played on agent events.
+type Cue string
+
+const (
+	CueWake     Cue = "wake"     // wake word acknowledged
+	CueThinking Cue = "thinking" // request sent to the model
+	CueError    Cue = "error"    // request failed
+	CueReminder Cue = "reminder" // reminder or timer due
+)
+
+// Cues lists all known cues.
+var Cues = []Cue{CueWake, CueThinking, CueError, CueReminder}
+
+// Earcons plays cues through a Mixer. Cues are loaded from <cue>.wav in a
+// user directory when present and fall back to a built-in synthesized set.
+type Earcons struct {
+	mixer   *Mixer
+	sounds  map[Cue][]byte
+	playing atomic.Bool
+	allow   atomic.Pointer[func(Cue) bool]
+}
+
+// NewEarcons loads cue sounds, preferring WAV files in dir (which may be
+// empty) over the built-in defaults.
+func NewEarcons(mixer *Mixer, dir string) (*Earcons, error) {
+	e := &Earcons{mixer: mixer, sounds: defaultCues()}
+	if dir == "" {
+		return e, nil
+	}
+	for _, cue := range Cues {
+		data, err := os.ReadFile(filepath.Join(dir, string(cue)+".wav"))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("loading %s cue: %w", cue, err)
+		}
+		e.sounds[cue] = data
+	}
+	return e, nil
+}
+
+// SetFilter makes Play skip cues for which allow returns false, e.g.
+// during quiet hours.
+func (e *Earcons) SetFilter(allow func(Cue) bool) { e.allow.Store(&allow) }
+
+// Play starts playing a cue in the background. Cues are short, so a cue
+// requested while another is still playing is dropped rather than queued.
+func (e *Earcons) Play(cue Cue) error {
+	data, ok := e.sounds[cue]
+	if !ok {
+		return fmt.Errorf("unknown cue %q", cue)
+	}
+	if allow := e.allow.Load(); allow != nil && !(*allow)(cue) {
+		return nil
+	}
+	if !e.playing.CompareAndSwap(false, true) {
+		return nil
+	}
+	go func() {
+		defer e.playing.Store(false)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := e.mixer.Play(ctx, bytes.NewReader(data)); err != nil {
+			log.Printf("playing %s cue: %v", cue, err)
+		}
+	}()
+	return nil
+}
+
+// note is a tone segment in a synthesized cue; a zero frequency is silence.
+type note struct {
+	freq float64
+	dur  time.Duration
+}
+
+func defaultCues() map[Cue][]byte {
+	const ms = time.Millisecond
+	return map[Cue][]byte{
+		CueWake:     synthesize(note{880, 90 * ms}, note{1320, 120 * ms}),
+		CueThinking: synthesize(note{660, 70 * ms}),
+		CueError:    synthesize(note{440, 150 * ms}, note{0, 40 * ms}, note{330, 250 * ms}),
+		CueReminder: synthesize(note{988, 120 * ms}, note{0, 80 * ms}, note{988, 120 * ms}, note{0, 80 * ms}, note{1319, 200 * ms}),
+	}
+}
+
+// synthesize renders notes as a 16 kHz mono 16-bit PCM WAV file.
+func synthesize(notes ...note) []byte {
+	const rate = 16000
+	var samples []int16
+	for _, n := range notes {
+		count := int(n.dur.Seconds() * rate)
+		fade := rate / 200 // 5ms attack/release to avoid clicks
+		for i := 0; i < count; i++ {
+			if n.freq == 0 {
+				samples = append(samples, 0)
+				continue
+			}
+			amp := 0.4
+			if i < fade {
+				amp *= float64(i) / float64(fade)
+			} else if i > count-fade {
+				amp *= float64(count-i) / float64(fade)
+			}
+			v := amp * math.Sin(2*math.Pi*n.freq*float64(i)/rate)
+			samples = append(samples, int16(v*math.MaxInt16))
+		}
+	}
+
+	dataLen := uint32(len(samples) * 2)
+	header := struct {
+		RIFF          [4]byte
+		Size          uint32
+		WAVE          [4]byte
+		Fmt           [4]byte
+		FmtSize       uint32
+		Format        uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+		Data          [4]byte
+		DataSize      uint32
+	}{
+		RIFF: [4]byte{'R', 'I', 'F', 'F'}, Size: 36 + dataLen,
+		WAVE: [4]byte{'W', 'A', 'V', 'E'}, Fmt: [4]byte{'f', 'm', 't', ' '},
+		FmtSize: 16, Format: 1, Channels: 1, SampleRate: rate,
+		ByteRate: rate * 2, BlockAlign: 2, BitsPerSample: 16,
+		Data: [4]byte{'d', 'a', 't', 'a'}, DataSize: dataLen,
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, header)
+	binary.Write(&buf, binary.LittleEndian, samples)
+	return buf.Bytes()
+}
@@ -0,0 +1,203 @@
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Backend selects the sound system used to control output.
+type Backend string
+
+const (
+	BackendALSA  Backend = "alsa"
+	BackendPulse Backend = "pulse"
+)
+
+// Device is an audio output device.
+type Device struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+}
+
+// Mixer controls output device selection and volume by shelling out to
+// amixer/aplay (ALSA) or pactl (PulseAudio/PipeWire).
+type Mixer struct {
+	backend Backend
+	control string // ALSA mixer control, e.g. "Master" or "PCM"
+
+	mu     sync.Mutex
+	device string // ALSA card (e.g. "hw:1") or Pulse sink; empty means default
+}
+
+// NewMixer creates a mixer for the given backend. The device may be empty
+// to use the system default. The control is only used by ALSA.
+func NewMixer(backend Backend, device, control string) (*Mixer, error) {
+	switch backend {
+	case BackendALSA, BackendPulse:
+	default:
+		return nil, fmt.Errorf("unsupported audio backend %q", backend)
+	}
+	if control == "" {
+		control = "Master"
+	}
+	return &Mixer{backend: backend, device: device, control: control}, nil
+}
+
+// Device returns the currently selected output device, or empty for the
+// system default.
+func (m *Mixer) Device() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.device
+}
+
+// SetDevice selects the output device used for volume control and playback.
+func (m *Mixer) SetDevice(ctx context.Context, device string) error {
+	if m.backend == BackendPulse && device != "" {
+		if _, err := run(ctx, "pactl", "set-default-sink", device); err != nil {
+			return err
+		}
+	}
+	m.mu.Lock()
+	m.device = device
+	m.mu.Unlock()
+	return nil
+}
+
+// Devices lists the available output devices.
+func (m *Mixer) Devices(ctx context.Context) ([]Device, error) {
+	if m.backend == BackendPulse {
+		out, err := run(ctx, "pactl", "list", "short", "sinks")
+		if err != nil {
+			return nil, err
+		}
+		return parsePulseSinks(out), nil
+	}
+	out, err := run(ctx, "aplay", "-l")
+	if err != nil {
+		return nil, err
+	}
+	return parseALSACards(out), nil
+}
+
+// Volume returns the current output volume as a percentage.
+func (m *Mixer) Volume(ctx context.Context) (int, error) {
+	var out []byte
+	var err error
+	if m.backend == BackendPulse {
+		out, err = run(ctx, "pactl", "get-sink-volume", m.pulseSink())
+	} else {
+		out, err = run(ctx, "amixer", m.alsaArgs("sget", m.control)...)
+	}
+	if err != nil {
+		return 0, err
+	}
+	match := percentRe.FindSubmatch(out)
+	if match == nil {
+		return 0, fmt.Errorf("could not parse volume from %q", strings.TrimSpace(string(out)))
+	}
+	return strconv.Atoi(string(match[1]))
+}
+
+// SetVolume sets the output volume to the given percentage (0-100).
+func (m *Mixer) SetVolume(ctx context.Context, percent int) error {
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("volume must be between 0 and 100, got %d", percent)
+	}
+	level := strconv.Itoa(percent) + "%"
+	var err error
+	if m.backend == BackendPulse {
+		_, err = run(ctx, "pactl", "set-sink-volume", m.pulseSink(), level)
+	} else {
+		_, err = run(ctx, "amixer", m.alsaArgs("sset", m.control, level)...)
+	}
+	return err
+}
+
+// Play plays WAV data on the selected output device, blocking until
+// playback finishes or ctx is cancelled.
+func (m *Mixer) Play(ctx context.Context, wav io.Reader) error {
+	var cmd *exec.Cmd
+	if m.backend == BackendPulse {
+		cmd = exec.CommandContext(ctx, "pacat", "--playback", "--file-format=wav", "--device="+m.pulseSink())
+	} else {
+		args := []string{"-q"}
+		if d := m.Device(); d != "" {
+			// aplay wants a PCM name rather than a control name.
+			args = append(args, "-D", "plug"+d)
+		}
+		cmd = exec.CommandContext(ctx, "aplay", append(args, "-")...)
+	}
+	cmd.Stdin = wav
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w: %s", cmd.Args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (m *Mixer) pulseSink() string {
+	if d := m.Device(); d != "" {
+		return d
+	}
+	return "@DEFAULT_SINK@"
+}
+
+func (m *Mixer) alsaArgs(args ...string) []string {
+	if d := m.Device(); d != "" {
+		return append([]string{"-D", d}, args...)
+	}
+	return args
+}
+
+var (
+	percentRe  = regexp.MustCompile(`(\d+)%`)
+	alsaCardRe = regexp.MustCompile(`^card (\d+): (\S+) \[(.*?)\], device (\d+): .*?\[(.*?)\]`)
+)
+
+func parseALSACards(out []byte) []Device {
+	var devices []Device
+	seen := make(map[string]bool)
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		m := alsaCardRe.FindStringSubmatch(sc.Text())
+		if m == nil || seen[m[1]] {
+			continue
+		}
+		seen[m[1]] = true
+		// amixer controls are per card, so list one entry per card.
+		devices = append(devices, Device{
+			ID:          "hw:" + m[1],
+			Description: fmt.Sprintf("%s - %s", m[3], m[5]),
+		})
+	}
+	return devices
+}
+
+func parsePulseSinks(out []byte) []Device {
+	var devices []Device
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		devices = append(devices, Device{ID: fields[1], Description: strings.Join(fields[2:], " ")})
+	}
+	return devices
+}
+
+func run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", name, err, strings.TrimSpace(string(out)))
+	}
+	return out, nil
+}
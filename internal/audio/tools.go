@@ -0,0 +1,37 @@
+package audio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"pi-agent/internal/tools"
+)
+
+// Tools returns the model-facing tools for reading and changing the volume.
+func (m *Mixer) Tools() []tools.Tool {
+	return []tools.Tool{
+		tools.New("get_volume", "Get the current speaker volume as a percentage.", tools.NoParams,
+			func(ctx context.Context, _ json.RawMessage) (string, error) {
+				v, err := m.Volume(ctx)
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("Volume is %d%%.", v), nil
+			}),
+		tools.New("set_volume", "Set the speaker volume to a percentage between 0 and 100.",
+			`{"type":"object","properties":{"percent":{"type":"integer","minimum":0,"maximum":100}},"required":["percent"]}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var in struct {
+					Percent int `json:"percent"`
+				}
+				if err := tools.Decode(args, &in); err != nil {
+					return "", err
+				}
+				if err := m.SetVolume(ctx, in.Percent); err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("Volume set to %d%%.", in.Percent), nil
+			}),
+	}
+}
@@ -0,0 +1,200 @@
+// Package auth logs browsers in to the HTTP API: with a local user name
+// and password, through an OpenID Connect provider, or by trusting the
+// user a single sign-on reverse proxy names in a header. Logins are
+// cookie sessions kept in the database.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"pi-agent/internal/config"
+	"pi-agent/internal/store"
+)
+
+// SessionCookie is the cookie holding a session.
+const SessionCookie = "pi_session"
+
+// ErrLogin is returned for a wrong user name or password.
+var ErrLogin = errors.New("wrong user name or password")
+
+// Manager authenticates requests and manages sessions.
+type Manager struct {
+	db          *store.DB
+	users       map[string]config.AuthUser // by lowercased name
+	oidc        *oidcClient
+	proxyHeader string
+	trusted     []netip.Prefix
+	ttl         time.Duration
+}
+
+// New returns a manager for the configured logins.
+func New(cfg *config.Auth, db *store.DB) (*Manager, error) {
+	m := &Manager{
+		db:          db,
+		users:       make(map[string]config.AuthUser),
+		proxyHeader: cfg.ProxyHeader,
+		ttl:         time.Duration(cfg.SessionHours) * time.Hour,
+	}
+	for _, u := range cfg.Users {
+		m.users[strings.ToLower(u.Name)] = u
+	}
+	for _, s := range cfg.TrustedProxies {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			a, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("auth.trusted_proxies: invalid network %q", s)
+			}
+			p = netip.PrefixFrom(a, a.BitLen())
+		}
+		m.trusted = append(m.trusted, p.Masked())
+	}
+	if cfg.OIDC != nil {
+		c, err := newOIDCClient(cfg.OIDC)
+		if err != nil {
+			return nil, err
+		}
+		m.oidc = c
+	}
+	return m, nil
+}
+
+// Passwords reports whether local password logins are configured.
+func (m *Manager) Passwords() bool { return len(m.users) > 0 }
+
+// OIDC reports whether OpenID Connect login is configured.
+func (m *Manager) OIDC() bool { return m.oidc != nil }
+
+// User returns the user a request is authenticated as: by its session
+// cookie, or by the proxy header if it comes from a trusted proxy. The
+// second result says how, "session" or "proxy".
+func (m *Manager) User(r *http.Request) (user, via string) {
+	if c, err := r.Cookie(SessionCookie); err == nil {
+		if s, err := m.db.Session(sessionID(c.Value)); err == nil {
+			return s.User, "session"
+		} else if !errors.Is(err, store.ErrNotFound) {
+			log.Printf("auth: %v", err)
+		}
+	}
+	if m.proxyHeader != "" && m.fromTrustedProxy(r) {
+		if u := strings.TrimSpace(r.Header.Get(m.proxyHeader)); u != "" {
+			return u, "proxy"
+		}
+	}
+	return "", ""
+}
+
+// loopback holds the loopback networks. Remote addresses are unmapped
+// before they are checked, so IPv4-mapped ones need not be listed.
+var loopback = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+
+// TrustsLoopback reports whether a trusted proxy network contains a
+// loopback address, so that anything connecting from the machine itself,
+// such as a tunnel, may claim to be any user.
+func (m *Manager) TrustsLoopback() bool {
+	for _, p := range m.trusted {
+		for _, l := range loopback {
+			if p.Overlaps(l) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (m *Manager) fromTrustedProxy(r *http.Request) bool {
+	ap, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	a := ap.Addr().Unmap().WithZone("")
+	for _, p := range m.trusted {
+		if p.Contains(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// Login checks a local user's password and starts a session.
+func (m *Manager) Login(w http.ResponseWriter, r *http.Request, name, password string) error {
+	u, ok := m.users[strings.ToLower(name)]
+	if !ok {
+		// Spend the same time as a real check, so names cannot be probed.
+		CheckPassword(dummyHash, password)
+		return ErrLogin
+	}
+	if !CheckPassword(u.PasswordHash, password) {
+		return ErrLogin
+	}
+	if Outdated(u.PasswordHash) {
+		log.Printf("auth: %s's password hash is outdated; replace it with one from \"pi-agent hash-password\"", u.Name)
+	}
+	return m.startSession(w, r, u.Name, "password")
+}
+
+// startSession saves a new session and sets its cookie.
+func (m *Manager) startSession(w http.ResponseWriter, r *http.Request, user, method string) error {
+	token := make([]byte, 32)
+	rand.Read(token)
+	value := base64.RawURLEncoding.EncodeToString(token)
+	s := &store.Session{ID: sessionID(value), User: user, Method: method, ExpiresAt: time.Now().Add(m.ttl)}
+	if err := m.db.AddSession(s); err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name: SessionCookie, Value: value, Path: "/", Expires: s.ExpiresAt,
+		HttpOnly: true, Secure: secure(r), SameSite: http.SameSiteLaxMode,
+	})
+	log.Printf("auth: %s logged in with %s", user, method)
+	return nil
+}
+
+// Logout ends the request's session and clears its cookie.
+func (m *Manager) Logout(w http.ResponseWriter, r *http.Request) error {
+	if c, err := r.Cookie(SessionCookie); err == nil {
+		if err := m.db.DeleteSession(sessionID(c.Value)); err != nil {
+			return err
+		}
+	}
+	http.SetCookie(w, &http.Cookie{Name: SessionCookie, Path: "/", MaxAge: -1, HttpOnly: true, Secure: secure(r), SameSite: http.SameSiteLaxMode})
+	return nil
+}
+
+// Cleanup removes expired sessions.
+func (m *Manager) Cleanup(context.Context) error {
+	_, err := m.db.DeleteExpiredSessions()
+	return err
+}
+
+// sessionID is what the database keeps of a session cookie.
+func sessionID(cookie string) string {
+	sum := sha256.Sum256([]byte(cookie))
+	return hex.EncodeToString(sum[:])
+}
+
+// secure reports whether the browser reached the server over HTTPS,
+// directly or through a TLS-terminating proxy.
+func secure(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// SafeRedirect returns next if it is a path on this server, and "/"
+// otherwise, so login redirects cannot send users elsewhere.
+func SafeRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"testing"
+
+	"pi-agent/internal/config"
+)
+
+func TestTrustsLoopback(t *testing.T) {
+	tests := []struct {
+		proxies []string
+		want    bool
+	}{
+		{nil, false},
+		{[]string{"192.168.1.10", "10.0.0.0/8"}, false},
+		{[]string{"127.0.0.1"}, true},
+		{[]string{"127.0.0.0/8"}, true},
+		{[]string{"10.0.0.0/8", "::1"}, true},
+		{[]string{"0.0.0.0/0"}, true},
+		{[]string{"::/0"}, true},
+		{[]string{"fd00::/8"}, false},
+	}
+	for _, tt := range tests {
+		m, err := New(&config.Auth{TrustedProxies: tt.proxies}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := m.TrustsLoopback(); got != tt.want {
+			t.Errorf("TrustsLoopback(%v) = %v, want %v", tt.proxies, got, tt.want)
+		}
+	}
+}
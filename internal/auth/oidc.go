@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"pi-agent/internal/config"
+)
+
+// oidcCookie carries a login's state, nonce and PKCE verifier from the
+// redirect to the provider until the callback.
+const oidcCookie = "pi_oidc"
+
+// oidcClient logs users in with the authorization code flow and PKCE.
+type oidcClient struct {
+	cfg    *config.OIDC
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *discovery
+	fetched   time.Time
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+}
+
+func newOIDCClient(cfg *config.OIDC) (*oidcClient, error) {
+	if _, err := url.Parse(cfg.Issuer); err != nil {
+		return nil, fmt.Errorf("auth.oidc.issuer: %w", err)
+	}
+	return &oidcClient{cfg: cfg, client: &http.Client{Timeout: 15 * time.Second}}, nil
+}
+
+// discover returns the provider's endpoints, refetched once a day.
+func (c *oidcClient) discover(ctx context.Context) (*discovery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.discovery != nil && time.Since(c.fetched) < 24*time.Hour {
+		return c.discovery, nil
+	}
+	u := strings.TrimSuffix(c.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("OIDC discovery: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OIDC discovery: %s returned %d", u, resp.StatusCode)
+	}
+	var d discovery
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&d); err != nil {
+		return nil, fmt.Errorf("OIDC discovery: %w", err)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" {
+		return nil, errors.New("OIDC discovery: missing authorization or token endpoint")
+	}
+	c.discovery, c.fetched = &d, time.Now()
+	return &d, nil
+}
+
+// OIDCLogin redirects the browser to the provider. After logging in the
+// user returns to next.
+func (m *Manager) OIDCLogin(w http.ResponseWriter, r *http.Request, next string) error {
+	if m.oidc == nil {
+		return errors.New("OIDC login is not configured")
+	}
+	d, err := m.oidc.discover(r.Context())
+	if err != nil {
+		return err
+	}
+	state, nonce, verifier := randomString(), randomString(), randomString()
+	challenge := sha256.Sum256([]byte(verifier))
+	value := url.Values{"state": {state}, "nonce": {nonce}, "verifier": {verifier}, "next": {SafeRedirect(next)}}
+	http.SetCookie(w, &http.Cookie{
+		Name: oidcCookie, Value: base64.RawURLEncoding.EncodeToString([]byte(value.Encode())),
+		Path: "/auth/oidc/", MaxAge: 600, HttpOnly: true, Secure: secure(r), SameSite: http.SameSiteLaxMode,
+	})
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {m.oidc.cfg.ClientID},
+		"redirect_uri":          {m.oidc.cfg.RedirectURL},
+		"scope":                 {"openid profile email"},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, d.AuthorizationEndpoint+sep+q.Encode(), http.StatusFound)
+	return nil
+}
+
+// OIDCCallback finishes a login the provider redirected back, starts a
+// session, and returns where to send the browser.
+func (m *Manager) OIDCCallback(w http.ResponseWriter, r *http.Request) (next string, err error) {
+	if m.oidc == nil {
+		return "", errors.New("OIDC login is not configured")
+	}
+	c, err := r.Cookie(oidcCookie)
+	if err != nil {
+		return "", errors.New("login expired, try again")
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcCookie, Path: "/auth/oidc/", MaxAge: -1, HttpOnly: true, Secure: secure(r), SameSite: http.SameSiteLaxMode})
+	raw, err := base64.RawURLEncoding.DecodeString(c.Value)
+	if err != nil {
+		return "", errors.New("login expired, try again")
+	}
+	saved, err := url.ParseQuery(string(raw))
+	if err != nil {
+		return "", errors.New("login expired, try again")
+	}
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		return "", fmt.Errorf("login refused: %s %s", e, q.Get("error_description"))
+	}
+	if subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(saved.Get("state"))) != 1 || saved.Get("state") == "" {
+		return "", errors.New("login state mismatch, try again")
+	}
+	claims, err := m.oidc.exchange(r.Context(), q.Get("code"), saved.Get("verifier"))
+	if err != nil {
+		return "", err
+	}
+	if claims["nonce"] != saved.Get("nonce") {
+		return "", errors.New("ID token nonce mismatch")
+	}
+	user, _ := claims[m.oidc.cfg.UserClaim].(string)
+	if user == "" {
+		user, _ = claims["email"].(string)
+	}
+	if user == "" {
+		return "", fmt.Errorf("ID token has no %s claim", m.oidc.cfg.UserClaim)
+	}
+	if allowed := m.oidc.cfg.AllowedUsers; len(allowed) > 0 && !slices.ContainsFunc(allowed, func(a string) bool { return strings.EqualFold(a, user) }) {
+		return "", fmt.Errorf("%s may not log in", user)
+	}
+	if err := m.startSession(w, r, user, "oidc"); err != nil {
+		return "", err
+	}
+	return SafeRedirect(saved.Get("next")), nil
+}
+
+// exchange trades an authorization code for an ID token and returns its
+// claims. The token comes straight from the provider's token endpoint
+// over TLS, so its signature is not checked again (OpenID Connect Core
+// 3.1.3.7); its issuer, audience and expiry are.
+func (c *oidcClient) exchange(ctx context.Context, code, verifier string) (map[string]any, error) {
+	if code == "" {
+		return nil, errors.New("no authorization code")
+	}
+	d, err := c.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecretValue()))
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("OIDC token request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OIDC token request error %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var tok struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tok); err != nil || tok.IDToken == "" {
+		return nil, errors.New("OIDC token response has no id_token")
+	}
+	parts := strings.Split(tok.IDToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed ID token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, errors.New("malformed ID token")
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errors.New("malformed ID token")
+	}
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != strings.TrimSuffix(c.cfg.Issuer, "/") {
+		return nil, fmt.Errorf("ID token issuer %q is not %q", iss, c.cfg.Issuer)
+	}
+	if !audience(claims["aud"], c.cfg.ClientID) {
+		return nil, errors.New("ID token is not for this client")
+	}
+	if exp, _ := claims["exp"].(float64); time.Unix(int64(exp), 0).Before(time.Now()) {
+		return nil, errors.New("ID token has expired")
+	}
+	return claims, nil
+}
+
+// audience reports whether an aud claim, a string or a list, includes
+// the client.
+func audience(aud any, client string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == client
+	case []any:
+		for _, a := range aud {
+			if a == client {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
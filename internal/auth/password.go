@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// bcryptCost is the bcrypt work factor for new hashes. Hashes record
+// their algorithm and cost, so either can change without invalidating
+// old ones; Outdated tells which to replace.
+const bcryptCost = 12
+
+// dummyHash is checked against when there is no such user, so that
+// unknown names take as long as wrong passwords.
+var dummyHash = fmt.Sprintf("$2b$%02d$%s", bcryptCost, strings.Repeat(".", 53))
+
+// HashPassword hashes a password for config.AuthUser with bcrypt, as
+// "$2b$<cost>$<salt><hash>". Passwords longer than the 72 bytes bcrypt
+// uses are refused.
+func HashPassword(password string) (string, error) {
+	if len(password) > maxBcryptPassword {
+		return "", errPasswordTooLong
+	}
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	return bcryptHash([]byte(password), bcryptCost, salt), nil
+}
+
+// CheckPassword reports whether password matches a hash made by
+// HashPassword, or by earlier versions as
+// "pbkdf2-sha256$<iterations>$<salt>$<key>".
+func CheckPassword(hash, password string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$2"):
+		return bcryptCheck(hash, []byte(password))
+	case strings.HasPrefix(hash, "pbkdf2-sha256$"):
+		return checkPBKDF2(hash, password)
+	}
+	return false
+}
+
+// Outdated reports whether a hash should be replaced by a new one from
+// HashPassword, because it uses an older algorithm or a lower cost.
+func Outdated(hash string) bool {
+	cost, _, err := parseBcrypt(hash)
+	return err != nil || cost < bcryptCost
+}
+
+func checkPBKDF2(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 {
+		return false
+	}
+	iter, err := strconv.Atoi(parts[1])
+	if err != nil || iter < 1 {
+		return false
+	}
+	enc := base64.RawStdEncoding
+	salt, err1 := enc.DecodeString(parts[2])
+	want, err2 := enc.DecodeString(parts[3])
+	if err1 != nil || err2 != nil || len(want) == 0 {
+		return false
+	}
+	got, err := pbkdf2.Key(sha256.New, password, salt, iter, len(want))
+	return err == nil && subtle.ConstantTimeCompare(got, want) == 1
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+// bcryptVectors are hashes made by OpenBSD's bcrypt; the first five are
+// its regression tests.
+var bcryptVectors = []struct {
+	password string
+	hash     string
+}{
+	{"", "$2a$06$DCq7YPn5Rq63x1Lad4cll.TV4S6ytwfsfvkgY8jIucDrjc8deX1s."},
+	{"a", "$2a$06$m0CrhHm10qJ3lXRY.5zDGO3rS2KdeeWLuGmsfGlMfOxih58VYVfxe"},
+	{"abc", "$2b$06$If6bvum7DFjUnE9p2uDeDu0YHzrHM6tf.iqN8.yx.jNN1ILEf7h0i"},
+	{"abcdefghijklmnopqrstuvwxyz", "$2a$06$.rCVZVOThsIa97pEDOxvGuRRgzG64bvtJ0938xuqzv18d3ZpQhstC"},
+	{"~!@#$%^&*()      ~!@#$%^&*()PNBFRD", "$2a$06$fPIsBO8qRqkjj273rfaOI.HtSV9jLDpTbZn782DC6/t7qT67P6FfO"},
+	{"correct horse battery staple", "$2b$04$abcdefghijklmnopqrstuu7EJV7kdjBBQxyb0HjTh9KS7.Lah/6CG"},
+	{strings.Repeat("x", 72), "$2b$05$CCCCCCCCCCCCCCCCCCCCC.D7RDOYXakZhsFmh/LdqQNx0kQ424AFS"},
+	{"Grüße", "$2y$04$abcdefghijklmnopqrstuuzzfwLY11Q0O66TF2XZ7FUib2Ngtn1va"},
+}
+
+func TestBcrypt(t *testing.T) {
+	for _, v := range bcryptVectors {
+		cost, salt, err := parseBcrypt(v.hash)
+		if err != nil {
+			t.Fatalf("parseBcrypt(%q): %v", v.hash, err)
+		}
+		if got := bcryptHash([]byte(v.password), cost, salt); got[4:] != v.hash[4:] {
+			t.Errorf("bcrypt(%q) = %s, want %s", v.password, got, v.hash)
+		}
+		if !CheckPassword(v.hash, v.password) {
+			t.Errorf("CheckPassword(%s, %q) = false", v.hash, v.password)
+		}
+		if CheckPassword(v.hash, v.password+"!") {
+			t.Errorf("CheckPassword(%s, %q) = true", v.hash, v.password+"!")
+		}
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$2b$12$") || len(hash) != 60 {
+		t.Errorf("hash %q is not a cost 12 bcrypt hash", hash)
+	}
+	if !CheckPassword(hash, "hunter2") || CheckPassword(hash, "hunter3") {
+		t.Error("CheckPassword does not tell the password from another")
+	}
+	if Outdated(hash) {
+		t.Error("new hash is outdated")
+	}
+	if again, _ := HashPassword("hunter2"); again == hash {
+		t.Error("two hashes of a password share a salt")
+	}
+	if _, err := HashPassword(strings.Repeat("x", 73)); err == nil {
+		t.Error("hashed a password longer than bcrypt uses")
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		want     bool
+	}{
+		{"legacy PBKDF2", "pbkdf2-sha256$1000$c2FsdHNhbHRzYWx0c2FsdA$RilxBxnvGa3JIyaXwlUUKmvuPzxjHerJeqIuhiIvKNU", "hunter2", true},
+		{"legacy PBKDF2, wrong password", "pbkdf2-sha256$1000$c2FsdHNhbHRzYWx0c2FsdA$RilxBxnvGa3JIyaXwlUUKmvuPzxjHerJeqIuhiIvKNU", "hunter3", false},
+		{"PBKDF2 without iterations", "pbkdf2-sha256$0$c2FsdHNhbHRzYWx0c2FsdA$RilxBxnvGa3JIyaXwlUUKmvuPzxjHerJeqIuhiIvKNU", "hunter2", false},
+		{"PBKDF2 missing a part", "pbkdf2-sha256$1000$RilxBxnvGa3JIyaXwlUUKmvuPzxjHerJeqIuhiIvKNU", "hunter2", false},
+		{"PBKDF2 empty key", "pbkdf2-sha256$1000$c2FsdHNhbHRzYWx0c2FsdA$", "hunter2", false},
+		{"unknown algorithm", "argon2id$v=19$m=65536,t=3,p=4$c2FsdA$aGFzaA", "hunter2", false},
+		{"plain text", "hunter2", "hunter2", false},
+		{"empty", "", "", false},
+		{"bcrypt version", "$2x$04$abcdefghijklmnopqrstuu7EJV7kdjBBQxyb0HjTh9KS7.Lah/6CG", "correct horse battery staple", false},
+		{"bcrypt cost too low", "$2b$03$abcdefghijklmnopqrstuu7EJV7kdjBBQxyb0HjTh9KS7.Lah/6CG", "correct horse battery staple", false},
+		{"bcrypt cost not a number", "$2b$1x$abcdefghijklmnopqrstuu7EJV7kdjBBQxyb0HjTh9KS7.Lah/6CG", "correct horse battery staple", false},
+		{"bcrypt truncated", "$2b$04$abcdefghijklmnopqrstuu7EJV7kdjBBQxyb0HjTh9KS7.Lah/6C", "correct horse battery staple", false},
+		{"bcrypt bad encoding", "$2b$04$abcdefghijklmnopqrstuu7EJV7kdjBBQxyb0HjTh9KS7.Lah/6C=", "correct horse battery staple", false},
+		{"bcrypt password too long", "$2b$05$CCCCCCCCCCCCCCCCCCCCC.D7RDOYXakZhsFmh/LdqQNx0kQ424AFS", strings.Repeat("x", 73), false},
+	}
+	for _, tt := range tests {
+		if got := CheckPassword(tt.hash, tt.password); got != tt.want {
+			t.Errorf("%s: CheckPassword = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOutdated(t *testing.T) {
+	tests := []struct {
+		hash string
+		want bool
+	}{
+		{"$2b$12$abcdefghijklmnopqrstuu7EJV7kdjBBQxyb0HjTh9KS7.Lah/6CG", false},
+		{"$2b$13$abcdefghijklmnopqrstuu7EJV7kdjBBQxyb0HjTh9KS7.Lah/6CG", false},
+		{"$2a$12$abcdefghijklmnopqrstuu7EJV7kdjBBQxyb0HjTh9KS7.Lah/6CG", false},
+		{"$2b$10$abcdefghijklmnopqrstuu7EJV7kdjBBQxyb0HjTh9KS7.Lah/6CG", true},
+		{"pbkdf2-sha256$600000$c2FsdHNhbHRzYWx0c2FsdA$RilxBxnvGa3JIyaXwlUUKmvuPzxjHerJeqIuhiIvKNU", true},
+	}
+	for _, tt := range tests {
+		if got := Outdated(tt.hash); got != tt.want {
+			t.Errorf("Outdated(%s) = %v, want %v", tt.hash, got, tt.want)
+		}
+	}
+}
+
+func TestDummyHash(t *testing.T) {
+	// Unknown users are checked against dummyHash, which must cost as
+	// much as a real hash and match nothing.
+	cost, _, err := parseBcrypt(dummyHash)
+	if err != nil || cost != bcryptCost {
+		t.Fatalf("dummyHash %s: cost %d, %v", dummyHash, cost, err)
+	}
+	if CheckPassword(dummyHash, "") {
+		t.Error("dummyHash matches the empty password")
+	}
+}
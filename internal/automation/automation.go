@@ -0,0 +1,404 @@
+// Package automation runs the automations declared in a YAML file: a
+// trigger (a cron schedule, an MQTT topic, a webhook or a Home Assistant
+// sensor crossing a threshold) renders a prompt, and the agent's reply is
+// kept in a conversation and optionally sent as a notification or to an
+// MQTT topic. The file is validated at startup and reloaded when it
+// changes; a reload that fails validation is logged and the running
+// automations are kept.
+package automation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"pi-agent/engine"
+	"pi-agent/internal/homeassistant"
+	"pi-agent/internal/mqtt"
+	"pi-agent/internal/notify"
+	"pi-agent/internal/rules"
+	"pi-agent/internal/schedule"
+)
+
+// reloadInterval is how often the file is checked for changes.
+const reloadInterval = 10 * time.Second
+
+// runTimeout bounds the model turn an automation starts.
+const runTimeout = 5 * time.Minute
+
+var priorities = map[string]notify.Priority{
+	"low": notify.PriorityLow, "default": notify.PriorityDefault,
+	"high": notify.PriorityHigh, "urgent": notify.PriorityUrgent,
+}
+
+// Config configures a Manager. Engine is required; the others enable the
+// triggers and deliveries that need them.
+type Config struct {
+	Path     string
+	Engine   *engine.Engine
+	Notifier notify.Notifier
+	MQTT     *mqtt.Client
+	HA       *homeassistant.Client
+	// SensorInterval is how often sensor triggers are evaluated.
+	SensorInterval time.Duration
+	// Wrap, if set, wraps each cron-triggered run, e.g. to skip it on
+	// battery.
+	Wrap func(name string, job func(ctx context.Context) error) func(ctx context.Context) error
+}
+
+// Event is what fired an automation, as its prompt template sees it.
+type Event struct {
+	Name    string
+	Trigger string
+	Time    time.Time
+	// Topic and Payload are the MQTT message or webhook body; Data is
+	// the payload decoded, if it is JSON.
+	Topic   string
+	Payload string
+	Data    any
+	// Entity and State are the sensor and the state that crossed the
+	// threshold.
+	Entity string
+	State  string
+}
+
+// Status reports on an automation.
+type Status struct {
+	Name      string     `json:"name"`
+	Trigger   string     `json:"trigger"`
+	Runs      int        `json:"runs"`
+	LastRun   *time.Time `json:"last_run,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// Manager runs the automations of a file and reloads them when it
+// changes.
+type Manager struct {
+	cfg  Config
+	caps Capabilities
+
+	mu        sync.Mutex
+	autos     []*automation
+	stamp     fileStamp
+	reloadErr string
+	stop      context.CancelFunc
+	status    map[string]*Status
+	busy      map[string]bool
+	sensors   map[string]*sensorState
+}
+
+// fileStamp identifies a version of the file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// sensorState tracks a sensor trigger's condition between evaluations.
+type sensorState struct {
+	seen, active, fired bool
+	since               time.Time
+}
+
+// New loads and validates the automations file. A missing file has no
+// automations until it is created.
+func New(cfg Config) (*Manager, error) {
+	if cfg.SensorInterval <= 0 {
+		cfg.SensorInterval = time.Minute
+	}
+	m := &Manager{
+		cfg:     cfg,
+		status:  make(map[string]*Status),
+		busy:    make(map[string]bool),
+		sensors: make(map[string]*sensorState),
+		caps: Capabilities{
+			MQTT:          cfg.MQTT != nil,
+			HomeAssistant: cfg.HA != nil,
+			Notify:        cfg.Notifier != nil,
+			Persona: func(name string) bool {
+				_, err := cfg.Engine.Profile(name, "")
+				return err == nil
+			},
+		},
+	}
+	autos, stamp, err := m.load()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.Path, err)
+	}
+	m.autos, m.stamp = autos, stamp
+	return m, nil
+}
+
+func (m *Manager) load() ([]*automation, fileStamp, error) {
+	info, err := os.Stat(m.cfg.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fileStamp{}, nil
+	}
+	if err != nil {
+		return nil, fileStamp{}, err
+	}
+	data, err := os.ReadFile(m.cfg.Path)
+	if err != nil {
+		return nil, fileStamp{}, err
+	}
+	autos, err := parse(data, m.caps)
+	return autos, fileStamp{info.ModTime(), info.Size()}, err
+}
+
+// Run starts the automations and reloads them when the file changes,
+// until ctx is cancelled.
+func (m *Manager) Run(ctx context.Context) {
+	m.mu.Lock()
+	m.start(ctx)
+	m.mu.Unlock()
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		m.reload(ctx)
+	}
+}
+
+func (m *Manager) reload(ctx context.Context) {
+	var stamp fileStamp
+	if info, err := os.Stat(m.cfg.Path); err == nil {
+		stamp = fileStamp{info.ModTime(), info.Size()}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if stamp == m.stamp {
+		return
+	}
+	autos, stamp, err := m.load()
+	m.stamp = stamp
+	if err != nil {
+		log.Printf("automations: not reloading %s: %v", m.cfg.Path, err)
+		m.reloadErr = err.Error()
+		return
+	}
+	m.reloadErr = ""
+	m.stop()
+	m.autos = autos
+	m.start(ctx)
+	log.Printf("automations: loaded %d from %s", len(autos), m.cfg.Path)
+}
+
+// start sets the current automations' triggers. It must be called with
+// m.mu held.
+func (m *Manager) start(ctx context.Context) {
+	ctx, m.stop = context.WithCancel(ctx)
+	var sensors []*automation
+	for _, a := range m.autos {
+		switch a.Trigger.Kind() {
+		case "cron":
+			job := func(ctx context.Context) error {
+				return m.run(ctx, a, Event{})
+			}
+			if m.cfg.Wrap != nil {
+				job = m.cfg.Wrap("automation-"+a.Name, job)
+			}
+			go schedule.Run(ctx, "automation-"+a.Name, a.spec, job)
+		case "mqtt":
+			unsubscribe := m.cfg.MQTT.Subscribe(a.Trigger.MQTT, func(topic string, payload []byte) {
+				go m.fire(a, Event{Topic: topic, Payload: string(payload), Data: decode(payload)})
+			})
+			context.AfterFunc(ctx, unsubscribe)
+		case "sensor":
+			sensors = append(sensors, a)
+		}
+	}
+	if len(sensors) > 0 {
+		go m.watchSensors(ctx, sensors)
+	}
+}
+
+// WebhookSecret returns the secret of a webhook automation.
+func (m *Manager) WebhookSecret(name string) (string, bool) {
+	if a := m.find(name); a != nil && a.Trigger.Webhook {
+		return a.Trigger.SecretValue(), true
+	}
+	return "", false
+}
+
+// Fire runs a webhook automation with a payload in the background. It
+// reports false if there is no such webhook automation.
+func (m *Manager) Fire(name string, payload []byte) bool {
+	a := m.find(name)
+	if a == nil || !a.Trigger.Webhook {
+		return false
+	}
+	go m.fire(a, Event{Payload: string(payload), Data: decode(payload)})
+	return true
+}
+
+func (m *Manager) find(name string) *automation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, a := range m.autos {
+		if a.Name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// List reports on the running automations, by name, and on the last
+// reload if it failed.
+func (m *Manager) List() (list []Status, reloadErr string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list = []Status{}
+	for _, a := range m.autos {
+		s := Status{Name: a.Name, Trigger: a.Trigger.Kind()}
+		if st := m.status[a.Name]; st != nil {
+			s.Runs, s.LastRun, s.LastError = st.Runs, st.LastRun, st.LastError
+		}
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, m.reloadErr
+}
+
+func (m *Manager) fire(a *automation, ev Event) {
+	if err := m.run(context.Background(), a, ev); err != nil {
+		log.Printf("automation %s: %v", a.Name, err)
+	}
+}
+
+// run sends the automation's prompt for ev and delivers the reply. An
+// automation still running from an earlier trigger is skipped.
+func (m *Manager) run(ctx context.Context, a *automation, ev Event) error {
+	m.mu.Lock()
+	if m.busy[a.Name] {
+		m.mu.Unlock()
+		return errors.New("still running, skipped")
+	}
+	m.busy[a.Name] = true
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.busy, a.Name)
+		m.mu.Unlock()
+	}()
+
+	// A reload stops the triggers, not the runs they started.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), runTimeout)
+	defer cancel()
+	ev.Name, ev.Trigger, ev.Time = a.Name, a.Trigger.Kind(), time.Now()
+	err := m.deliver(ctx, a, ev)
+
+	m.mu.Lock()
+	st := m.status[a.Name]
+	if st == nil {
+		st = &Status{}
+		m.status[a.Name] = st
+	}
+	st.Runs++
+	st.LastRun, st.LastError = &ev.Time, ""
+	if err != nil {
+		st.LastError = err.Error()
+	}
+	m.mu.Unlock()
+	return err
+}
+
+func (m *Manager) deliver(ctx context.Context, a *automation, ev Event) error {
+	var b strings.Builder
+	if err := a.prompt.Execute(&b, ev); err != nil {
+		return fmt.Errorf("rendering prompt: %w", err)
+	}
+	p, err := m.cfg.Engine.Profile(a.Persona, "")
+	if err != nil {
+		return err
+	}
+	reply, err := m.cfg.Engine.Converse(ctx, a.ConversationID, b.String(), p)
+	if err != nil {
+		return err
+	}
+	if reply == "" {
+		return nil
+	}
+	var errs []error
+	if a.Deliver.Notify {
+		msg := notify.Message{Title: a.Name, Body: reply, Priority: priorities[a.priority]}
+		if err := m.cfg.Notifier.Notify(ctx, msg); err != nil {
+			errs = append(errs, fmt.Errorf("notification failed: %w", err))
+		}
+	}
+	if a.Deliver.MQTT != "" {
+		if err := m.cfg.MQTT.Publish(ctx, a.Deliver.MQTT, []byte(reply), a.Deliver.Retain); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// watchSensors runs sensor automations when their comparison becomes
+// true and has held for their hold time, once per crossing. The first
+// evaluation only notes the current state, so a condition that is
+// already true at startup or after a reload does not fire.
+func (m *Manager) watchSensors(ctx context.Context, autos []*automation) {
+	ticker := time.NewTicker(m.cfg.SensorInterval)
+	defer ticker.Stop()
+	for {
+		states, err := m.cfg.HA.States(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("automations: %v", err)
+		}
+		byID := make(map[string]string, len(states))
+		for _, st := range states {
+			byID[st.EntityID] = st.State
+		}
+		now := time.Now()
+		m.mu.Lock()
+		for _, a := range autos {
+			value, ok := byID[a.Trigger.Sensor]
+			if err != nil || !ok || value == "unavailable" || value == "unknown" {
+				continue
+			}
+			t := a.Trigger
+			key := strings.Join([]string{a.Name, t.Sensor, t.Operator, t.Threshold}, "\x00")
+			st := m.sensors[key]
+			if st == nil {
+				st = &sensorState{}
+				m.sensors[key] = st
+			}
+			active := rules.Matches(t.Operator, value, t.Threshold)
+			switch {
+			case !st.seen:
+				st.seen, st.active, st.fired, st.since = true, active, active, now
+			case active != st.active:
+				st.active, st.fired, st.since = active, false, now
+			}
+			if st.active && !st.fired && now.Sub(st.since) >= a.hold {
+				st.fired = true
+				go m.fire(a, Event{Entity: t.Sensor, State: value})
+			}
+		}
+		m.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// decode returns payload as JSON, or nil if it is not.
+func decode(payload []byte) any {
+	var v any
+	if json.Unmarshal(payload, &v) != nil {
+		return nil
+	}
+	return v
+}
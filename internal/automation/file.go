@@ -0,0 +1,270 @@
+package automation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"pi-agent/internal/rules"
+	"pi-agent/internal/schedule"
+)
+
+// File is an automations file:
+//
+//	automations:
+//	  - name: morning-weather
+//	    trigger:
+//	      cron: "30 6 * * 1-5"
+//	    prompt: Summarize today's weather for my commute.
+//	    deliver:
+//	      notify: true
+//	  - name: doorbell
+//	    trigger:
+//	      mqtt: frigate/events
+//	    prompt: |
+//	      Describe this camera event in one sentence: {{.Payload}}
+//	    deliver:
+//	      mqtt: displays/hall/text
+type File struct {
+	Automations []Automation `json:"automations"`
+}
+
+// Automation is a trigger, the prompt it sends and where the reply goes.
+type Automation struct {
+	Name    string  `json:"name"`
+	Trigger Trigger `json:"trigger"`
+	// Prompt is a text/template rendered with the Event that fired.
+	Prompt string `json:"prompt"`
+	// Persona optionally selects the persona answering the prompt.
+	Persona string `json:"persona"`
+	// ConversationID is where the prompt and reply are kept (default
+	// automation-<name>).
+	ConversationID string   `json:"conversation_id"`
+	Deliver        Delivery `json:"deliver"`
+	// Disabled keeps an automation in the file without running it.
+	Disabled bool `json:"disabled"`
+}
+
+// Trigger sets off an automation. Exactly one of Cron, MQTT, Webhook and
+// Sensor is set.
+type Trigger struct {
+	// Cron is a five-field cron expression or a schedule such as
+	// "daily 07:30".
+	Cron string `json:"cron"`
+	// MQTT is a topic filter, with + and # wildcards; needs -mqtt-url.
+	MQTT string `json:"mqtt"`
+	// Webhook serves the automation at POST /hooks/automations/{name},
+	// authenticated like /hooks with Secret or the variable SecretEnv.
+	Webhook   bool   `json:"webhook"`
+	Secret    string `json:"secret"`
+	SecretEnv string `json:"secret_env"`
+	// Sensor is a Home Assistant entity compared with Operator and
+	// Threshold, as in rules; the automation runs when the comparison
+	// becomes true and has stayed true For (e.g. "10m"). Needs -ha-url.
+	Sensor    string `json:"sensor"`
+	Operator  string `json:"operator"`
+	Threshold string `json:"threshold"`
+	For       string `json:"for"`
+}
+
+// Kind names the trigger's type.
+func (t Trigger) Kind() string {
+	switch {
+	case t.Cron != "":
+		return "cron"
+	case t.MQTT != "":
+		return "mqtt"
+	case t.Webhook:
+		return "webhook"
+	case t.Sensor != "":
+		return "sensor"
+	}
+	return ""
+}
+
+// SecretValue returns the webhook secret, from the environment if
+// SecretEnv is set.
+func (t Trigger) SecretValue() string {
+	if t.SecretEnv != "" {
+		return os.Getenv(t.SecretEnv)
+	}
+	return t.Secret
+}
+
+// Delivery says where a reply goes besides the conversation.
+type Delivery struct {
+	// Notify sends the reply as a notification with Priority: "low",
+	// "default" (the default), "high" or "urgent".
+	Notify   bool   `json:"notify"`
+	Priority string `json:"priority"`
+	// MQTT publishes the reply to a topic, retained if Retain is set.
+	MQTT   string `json:"mqtt"`
+	Retain bool   `json:"retain"`
+}
+
+// Capabilities are what the server was started with, which some
+// triggers and deliveries need.
+type Capabilities struct {
+	MQTT, HomeAssistant, Notify bool
+	// Persona reports whether a persona exists.
+	Persona func(name string) bool
+}
+
+// automation is a validated Automation, ready to run.
+type automation struct {
+	Automation
+	prompt   *template.Template
+	spec     schedule.Spec
+	hold     time.Duration
+	priority string
+}
+
+// parse decodes an automations file and validates it against caps,
+// leaving out disabled automations.
+func parse(data []byte, caps Capabilities) ([]*automation, error) {
+	tree, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	if tree == nil {
+		return nil, nil
+	}
+	js, err := json.Marshal(tree)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.DisallowUnknownFields()
+	var f File
+	if err := dec.Decode(&f); err != nil {
+		return nil, err
+	}
+	var out []*automation
+	seen := map[string]bool{}
+	for i, a := range f.Automations {
+		if a.Name == "" {
+			return nil, fmt.Errorf("automation %d: name is required", i+1)
+		}
+		if seen[a.Name] {
+			return nil, fmt.Errorf("automation %q defined twice", a.Name)
+		}
+		seen[a.Name] = true
+		auto, err := validate(a, caps)
+		if err != nil {
+			return nil, fmt.Errorf("automation %q: %w", a.Name, err)
+		}
+		if !a.Disabled {
+			out = append(out, auto)
+		}
+	}
+	return out, nil
+}
+
+func validate(a Automation, caps Capabilities) (*automation, error) {
+	if strings.ContainsAny(a.Name, "/ ") {
+		return nil, errors.New("name cannot contain slashes or spaces")
+	}
+	auto := &automation{Automation: a, priority: a.Deliver.Priority}
+	t := a.Trigger
+	kinds := 0
+	for _, set := range []bool{t.Cron != "", t.MQTT != "", t.Webhook, t.Sensor != ""} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return nil, errors.New("trigger needs exactly one of cron, mqtt, webhook and sensor")
+	}
+	var err error
+	switch t.Kind() {
+	case "cron":
+		if auto.spec, err = schedule.Parse(t.Cron); err != nil {
+			return nil, err
+		}
+	case "mqtt":
+		if !caps.MQTT {
+			return nil, errors.New("mqtt triggers need -mqtt-url")
+		}
+		if err := validFilter(t.MQTT); err != nil {
+			return nil, err
+		}
+	case "webhook":
+		if t.SecretValue() == "" {
+			return nil, errors.New("webhook triggers need a secret or secret_env")
+		}
+	case "sensor":
+		if !caps.HomeAssistant {
+			return nil, errors.New("sensor triggers need -ha-url")
+		}
+		if !slices.Contains(rules.Operators, t.Operator) {
+			return nil, fmt.Errorf("operator must be one of %s", strings.Join(rules.Operators, " "))
+		}
+		if t.Threshold == "" {
+			return nil, errors.New("threshold is required")
+		}
+		if t.For != "" {
+			if auto.hold, err = time.ParseDuration(t.For); err != nil || auto.hold < 0 {
+				return nil, fmt.Errorf("invalid for %q", t.For)
+			}
+		}
+	}
+	if kind := t.Kind(); kind != "webhook" && (t.Secret != "" || t.SecretEnv != "") {
+		return nil, fmt.Errorf("secret applies to webhook triggers, not %s", kind)
+	}
+	if kind := t.Kind(); kind != "sensor" && (t.Operator != "" || t.Threshold != "" || t.For != "") {
+		return nil, fmt.Errorf("operator, threshold and for apply to sensor triggers, not %s", kind)
+	}
+
+	if strings.TrimSpace(a.Prompt) == "" {
+		return nil, errors.New("prompt is required")
+	}
+	if auto.prompt, err = template.New(a.Name).Option("missingkey=zero").Parse(a.Prompt); err != nil {
+		return nil, err
+	}
+	if a.Persona != "" && caps.Persona != nil && !caps.Persona(a.Persona) {
+		return nil, fmt.Errorf("unknown persona %q", a.Persona)
+	}
+	if auto.ConversationID == "" {
+		auto.ConversationID = "automation-" + a.Name
+	}
+
+	d := a.Deliver
+	if d.Notify && !caps.Notify {
+		return nil, errors.New("deliver.notify needs a notification target")
+	}
+	if auto.priority == "" {
+		auto.priority = "default"
+	} else if _, ok := priorities[auto.priority]; !ok {
+		return nil, errors.New("deliver.priority must be low, default, high or urgent")
+	}
+	if d.MQTT != "" {
+		if !caps.MQTT {
+			return nil, errors.New("deliver.mqtt needs -mqtt-url")
+		}
+		if strings.ContainsAny(d.MQTT, "+#") {
+			return nil, fmt.Errorf("deliver.mqtt %q: wildcards cannot be published to", d.MQTT)
+		}
+	}
+	return auto, nil
+}
+
+// validFilter checks an MQTT topic filter: # only as the last level, and
+// wildcards only as whole levels.
+func validFilter(filter string) error {
+	levels := strings.Split(filter, "/")
+	for i, l := range levels {
+		switch {
+		case l == "#" && i != len(levels)-1:
+			return fmt.Errorf("topic filter %q: # must be the last level", filter)
+		case l != "#" && l != "+" && strings.ContainsAny(l, "+#"):
+			return fmt.Errorf("topic filter %q: wildcards must fill a whole level", filter)
+		}
+	}
+	return nil
+}
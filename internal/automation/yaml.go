@@ -0,0 +1,366 @@
+package automation
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML parses the subset of YAML automation files need: block
+// mappings and sequences, plain and quoted scalars, flow sequences of
+// scalars, literal (|) and folded (>) blocks, and comments. Anchors,
+// flow mappings, multi-document files and multi-line plain scalars are
+// rejected or read literally. Scalars are strings except true, false and
+// null, as in YAML 1.2, so states such as on and off stay strings; that is
+// enough for decoding into structs through JSON.
+func parseYAML(data []byte) (any, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	p := &yamlParser{lines: strings.Split(text, "\n")}
+	for i, line := range p.lines {
+		if indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]; strings.Contains(indent, "\t") && strings.TrimSpace(line) != "" {
+			return nil, fmt.Errorf("line %d: tabs cannot indent YAML", i+1)
+		}
+	}
+	if ind, line, ok := p.peek(); ok && ind == 0 && line == "---" {
+		p.i++
+	}
+	v, err := p.block(0)
+	if err != nil {
+		return nil, err
+	}
+	if _, line, ok := p.peek(); ok {
+		return nil, p.errorf("unexpected %q", line)
+	}
+	return v, nil
+}
+
+type yamlParser struct {
+	lines []string
+	i     int
+}
+
+func (p *yamlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", p.i+1, fmt.Sprintf(format, args...))
+}
+
+// peek skips blank and comment lines and returns the next line's
+// indentation and content, without a trailing comment.
+func (p *yamlParser) peek() (indent int, line string, ok bool) {
+	for ; p.i < len(p.lines); p.i++ {
+		raw := p.lines[p.i]
+		trimmed := strings.TrimLeft(raw, " ")
+		content := strings.TrimSpace(stripComment(trimmed))
+		if content == "" {
+			continue
+		}
+		return len(raw) - len(trimmed), content, true
+	}
+	return 0, "", false
+}
+
+// block parses the node starting at the next line if it is indented at
+// least min, or returns nil.
+func (p *yamlParser) block(min int) (any, error) {
+	ind, line, ok := p.peek()
+	if !ok || ind < min {
+		return nil, nil
+	}
+	if isItem(line) {
+		return p.sequence(ind)
+	}
+	return p.mapping(ind)
+}
+
+func isItem(line string) bool {
+	return line == "-" || strings.HasPrefix(line, "- ")
+}
+
+func (p *yamlParser) sequence(ind int) ([]any, error) {
+	out := []any{}
+	for {
+		i, line, ok := p.peek()
+		if !ok || i < ind || i == ind && !isItem(line) {
+			return out, nil // a key after a sequence at its own indentation
+		}
+		if i > ind {
+			return nil, p.errorf("unexpected indentation")
+		}
+		rest := strings.TrimSpace(strings.TrimPrefix(line, "-"))
+		var item any
+		var err error
+		switch {
+		case rest == "":
+			p.i++
+			item, err = p.block(ind + 1)
+		case mappingKey(rest) >= 0 || isItem(rest):
+			// "- key: value" starts a mapping indented past the dash, and
+			// "- - item" a sequence; reparse the line as its first entry.
+			raw := p.lines[p.i]
+			at := len(raw) - len(strings.TrimLeft(raw[ind+1:], " "))
+			p.lines[p.i] = strings.Repeat(" ", at) + raw[at:]
+			item, err = p.block(at)
+		default:
+			item, err = p.scalar(rest, ind)
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, item)
+	}
+}
+
+func (p *yamlParser) mapping(ind int) (map[string]any, error) {
+	out := map[string]any{}
+	for {
+		i, line, ok := p.peek()
+		if !ok || i < ind || i == ind && isItem(line) {
+			return out, nil
+		}
+		if i > ind {
+			return nil, p.errorf("unexpected indentation")
+		}
+		colon := mappingKey(line)
+		if colon < 0 {
+			return nil, p.errorf("expected key: value, got %q", line)
+		}
+		key, err := unquote(strings.TrimSpace(line[:colon]))
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		if _, dup := out[key]; dup {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		rest := strings.TrimSpace(line[colon+1:])
+		var v any
+		if rest == "" {
+			p.i++
+			// A sequence may sit at the key's own indentation.
+			if j, next, ok := p.peek(); ok && j == ind && isItem(next) {
+				v, err = p.sequence(ind)
+			} else {
+				v, err = p.block(ind + 1)
+			}
+		} else {
+			v, err = p.scalar(rest, ind)
+		}
+		if err != nil {
+			return nil, err
+		}
+		out[key] = v
+	}
+}
+
+// mappingKey returns the index of the colon ending a mapping key in
+// line, or -1 if the line is not a key: value pair.
+func mappingKey(line string) int {
+	quote := byte(0)
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\'' && quote == '\'' && i+1 < len(line) && line[i+1] == '\'' {
+				i++ // '' is a quote inside single quotes
+			} else if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case i == 0 && (c == '"' || c == '\''):
+			quote = c
+		case c == ':' && (i+1 == len(line) || line[i+1] == ' '):
+			return i
+		case i == 0 && (c == '[' || c == '{' || c == '|' || c == '>'):
+			return -1
+		}
+	}
+	return -1
+}
+
+// scalar parses the value after a key or dash on the current line and
+// moves past it; block scalars continue on the lines indented past ind.
+func (p *yamlParser) scalar(s string, ind int) (any, error) {
+	v, err := p.inline(s)
+	if err != nil {
+		return nil, err // reported on the value's line
+	}
+	p.i++
+	if b, ok := v.(blockStyle); ok {
+		return p.blockScalar(string(b), ind), nil
+	}
+	return v, nil
+}
+
+// blockStyle is the indicator of a block scalar, e.g. "|-", whose lines
+// scalar has yet to read.
+type blockStyle string
+
+// inline converts a value written on one line.
+func (p *yamlParser) inline(s string) (any, error) {
+	switch {
+	case s == "|" || s == "|-" || s == "|+" || s == ">" || s == ">-" || s == ">+":
+		return blockStyle(s), nil
+	case strings.HasPrefix(s, "["):
+		if !strings.HasSuffix(s, "]") {
+			return nil, p.errorf("unterminated flow sequence")
+		}
+		out := []any{}
+		inner := strings.TrimSpace(s[1 : len(s)-1])
+		if inner == "" {
+			return out, nil
+		}
+		for _, item := range splitFlow(inner) {
+			v, err := plain(strings.TrimSpace(item))
+			if err != nil {
+				return nil, p.errorf("%v", err)
+			}
+			out = append(out, v)
+		}
+		return out, nil
+	case s == "{}":
+		return map[string]any{}, nil
+	case strings.HasPrefix(s, "{"):
+		return nil, p.errorf("flow mappings are not supported; use an indented block")
+	case strings.HasPrefix(s, "&") || strings.HasPrefix(s, "*"):
+		return nil, p.errorf("anchors and aliases are not supported")
+	}
+	v, err := plain(s)
+	if err != nil {
+		return nil, p.errorf("%v", err)
+	}
+	return v, nil
+}
+
+// blockScalar reads the lines of a | or > block indented past ind.
+func (p *yamlParser) blockScalar(style string, ind int) string {
+	var lines []string
+	blockInd := -1
+	for ; p.i < len(p.lines); p.i++ {
+		raw := p.lines[p.i]
+		trimmed := strings.TrimLeft(raw, " ")
+		if trimmed == "" {
+			lines = append(lines, "")
+			continue
+		}
+		n := len(raw) - len(trimmed)
+		if blockInd < 0 {
+			blockInd = n
+		}
+		if n <= ind || n < blockInd {
+			break
+		}
+		lines = append(lines, raw[blockInd:])
+	}
+	// Trailing blank lines belong to what follows, except under |+.
+	end := len(lines)
+	for end > 0 && lines[end-1] == "" {
+		end--
+	}
+	if style[0] == '>' {
+		var b strings.Builder
+		for i, l := range lines[:end] {
+			switch {
+			case i == 0:
+			case l == "" || strings.HasPrefix(l, " "):
+				b.WriteByte('\n')
+			case lines[i-1] == "":
+			default:
+				b.WriteByte(' ')
+			}
+			b.WriteString(l)
+		}
+		return chomp(b.String(), style, lines[end:])
+	}
+	return chomp(strings.Join(lines[:end], "\n"), style, lines[end:])
+}
+
+func chomp(s, style string, trailing []string) string {
+	switch {
+	case s == "":
+		return ""
+	case strings.HasSuffix(style, "-"):
+		return s
+	case strings.HasSuffix(style, "+"):
+		return s + "\n" + strings.Repeat("\n", len(trailing))
+	}
+	return s + "\n"
+}
+
+// plain converts a scalar, quoted or not.
+func plain(s string) (any, error) {
+	if s != "" && (s[0] == '"' || s[0] == '\'') {
+		return unquote(s)
+	}
+	switch s {
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	case "null", "Null", "NULL", "~", "":
+		return nil, nil
+	}
+	return s, nil
+}
+
+// unquote removes YAML quotes: double quotes take backslash escapes,
+// single quotes double themselves.
+func unquote(s string) (string, error) {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		u, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid double-quoted string %s", s)
+		}
+		return u, nil
+	}
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	if s != "" && (s[0] == '"' || s[0] == '\'') {
+		return "", fmt.Errorf("unterminated string %s", s)
+	}
+	return s, nil
+}
+
+// splitFlow splits the inside of a flow sequence at commas outside quotes.
+func splitFlow(s string) []string {
+	var out []string
+	quote, start := byte(0), 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			out = append(out, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(out, s[start:])
+}
+
+// stripComment removes a # comment, which starts a line or follows a
+// space, outside quotes.
+func stripComment(s string) string {
+	quote := byte(0)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\'' && quote == '\'' && i+1 < len(s) && s[i+1] == '\'' {
+				i++
+			} else if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case (c == '"' || c == '\'') && (i == 0 || strings.ContainsRune(" [,:-", rune(s[i-1]))):
+			quote = c
+		case c == '#' && (i == 0 || s[i-1] == ' '):
+			return s[:i]
+		}
+	}
+	return s
+}
@@ -0,0 +1,107 @@
+package automation
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want any
+	}{
+		{"empty", "", nil},
+		{"comments only", "# nothing\n\n  # here\n", nil},
+		{"document start", "---\nname: porch\n", map[string]any{"name": "porch"}},
+		{"scalars", "a: on\nb: true\nc: False\nd: null\ne: ~\nf:\ng: 21.5\n", map[string]any{
+			"a": "on", "b": true, "c": false, "d": nil, "e": nil, "f": nil, "g": "21.5",
+		}},
+		{"nested mappings", "trigger:\n  entity: sensor.door\n  when:\n    state: open\nname: door\n", map[string]any{
+			"trigger": map[string]any{"entity": "sensor.door", "when": map[string]any{"state": "open"}},
+			"name":    "door",
+		}},
+		{"sequence of scalars", "- one\n- two\n-   three\n", []any{"one", "two", "three"}},
+		{"sequence indented under key", "days:\n  - mon\n  - tue\n", map[string]any{"days": []any{"mon", "tue"}}},
+		{"sequence at key's indentation", "days:\n- mon\n- tue\nname: x\n", map[string]any{"days": []any{"mon", "tue"}, "name": "x"}},
+		{"sequence of mappings", "actions:\n  - service: light.turn_on\n    entity: light.porch\n  - service: notify\n    message: hi\n", map[string]any{
+			"actions": []any{
+				map[string]any{"service": "light.turn_on", "entity": "light.porch"},
+				map[string]any{"service": "notify", "message": "hi"},
+			},
+		}},
+		{"item on its own line", "-\n  a: 1\n- b\n", []any{map[string]any{"a": "1"}, "b"}},
+		{"nested sequences", "- - a\n  - b\n- c\n", []any{[]any{"a", "b"}, "c"}},
+		{"double quotes", `a: "x: y # z"` + "\n" + `b: "tab\there \"q\""` + "\n", map[string]any{"a": "x: y # z", "b": "tab\there \"q\""}},
+		{"single quotes", "a: 'it''s # fine'\nb: ''\n", map[string]any{"a": "it's # fine", "b": ""}},
+		{"quoted key", "\"a: b\": 1\n'c': 2\n", map[string]any{"a: b": "1", "c": "2"}},
+		{"quoted scalars stay strings", "a: \"true\"\nb: 'null'\n", map[string]any{"a": "true", "b": "null"}},
+		{"trailing comments", "a: b # comment\nc: d#e\n# whole line\n", map[string]any{"a": "b", "c": "d#e"}},
+		{"colon in value", "url: http://example.com:8123/x\ntime: 07:30\n", map[string]any{"url": "http://example.com:8123/x", "time": "07:30"}},
+		{"flow sequence", `a: [on, off, "x, y", 'z']` + "\nb: []\nc: {}\n", map[string]any{
+			"a": []any{"on", "off", "x, y", "z"}, "b": []any{}, "c": map[string]any{},
+		}},
+		{"quotes in flow sequence", `a: ["x\", y", 'it''s, ok']` + "\n", map[string]any{"a": []any{`x", y`, "it's, ok"}}},
+		{"literal block", "msg: |\n  line one\n    indented\n\n  line three\nnext: x\n", map[string]any{
+			"msg": "line one\n  indented\n\nline three\n", "next": "x",
+		}},
+		{"literal keeps #", "msg: |\n  # not a comment\n", map[string]any{"msg": "# not a comment\n"}},
+		{"literal strip", "msg: |-\n  a\n  b\n\n", map[string]any{"msg": "a\nb"}},
+		{"literal keep", "msg: |+\n  a\n\n\nnext: x\n", map[string]any{"msg": "a\n\n\n", "next": "x"}},
+		{"folded block", "msg: >\n  one\n  two\n\n  three\n", map[string]any{"msg": "one two\nthree\n"}},
+		{"folded strip", "msg: >-\n  one\n  two\n", map[string]any{"msg": "one two"}},
+		{"empty block", "msg: |\nnext: x\n", map[string]any{"msg": "", "next": "x"}},
+		{"block in sequence", "- |\n  a\n- b\n", []any{"a\n", "b"}},
+		{"CRLF", "a: 1\r\nb:\r\n  - c\r\n", map[string]any{"a": "1", "b": []any{"c"}}},
+		{"tabs inside values", "a: x\ty\n", map[string]any{"a": "x\ty"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("parseYAML(%q): %v", tt.in, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseYAML(%q) = %#v, want %#v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"tab indentation", "a:\n\tb: 1\n", "line 2: tabs cannot indent YAML"},
+		{"over-indented key", "a: 1\n  b: 2\n", "line 2: unexpected indentation"},
+		{"over-indented item", "- a\n  - b\n", "line 2: unexpected indentation"},
+		{"dedent between levels", "a:\n  b: 1\n c: 2\n", "line 3: unexpected indentation"},
+		{"not a mapping", "a: 1\njust text\n", `line 2: expected key: value, got "just text"`},
+		{"item after mapping", "a: 1\n- b\n", `line 2: unexpected "- b"`},
+		{"key after sequence", "- a\nb: 1\n", `line 2: unexpected "b: 1"`},
+		{"duplicate key", "a: 1\n# comment\na: 2\n", `line 3: duplicate key "a"`},
+		{"duplicate quoted key", "a: 1\n\"a\": 2\n", `line 2: duplicate key "a"`},
+		{"unterminated double quote", "a: 1\nb: \"open\n", `line 2: unterminated string "open`},
+		{"unterminated single quote", "b: 'open\n", `line 1: unterminated string 'open`},
+		{"bad escape", `a: "\q"` + "\n", `line 1: invalid double-quoted string "\q"`},
+		{"unterminated flow sequence", "a: [1, 2\n", "line 1: unterminated flow sequence"},
+		{"bad flow item", "a: [\"x]\n", `line 1: unterminated string "x`},
+		{"flow mapping", "a: {b: 1}\n", "line 1: flow mappings are not supported; use an indented block"},
+		{"anchor", "a: &x 1\n", "line 1: anchors and aliases are not supported"},
+		{"alias", "- *x\n", "line 1: anchors and aliases are not supported"},
+		{"error in nested list", "a:\n  - b: 1\n    c: [\n", "line 3: unterminated flow sequence"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML([]byte(tt.in))
+			if err == nil {
+				t.Fatalf("parseYAML(%q) = %#v, want error %q", tt.in, got, tt.want)
+			}
+			if err.Error() != tt.want {
+				t.Errorf("parseYAML(%q): error %q, want %q", tt.in, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package bookmarks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"pi-agent/internal/rag"
+	"pi-agent/internal/store"
+	"pi-agent/internal/tools"
+)
+
+// Kind is the document kind under which bookmarks are indexed.
+const Kind = "bookmark"
+
+// ErrInvalidURL is returned when saving something other than an http(s) URL.
+var ErrInvalidURL = errors.New("invalid URL")
+
+// Bookmarks saves web pages for later and makes their content searchable.
+type Bookmarks struct {
+	db    *store.DB
+	index *rag.Index
+}
+
+// New creates a bookmark store indexing into index.
+func New(db *store.DB, index *rag.Index) *Bookmarks {
+	return &Bookmarks{db: db, index: index}
+}
+
+// Save fetches rawURL, extracts its content and indexes it along with an
+// optional note. Saving a URL again refreshes its content.
+func (b *Bookmarks) Save(ctx context.Context, rawURL, note string) (*store.Document, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w %q", ErrInvalidURL, rawURL)
+	}
+	page, err := rag.Fetch(ctx, u.String())
+	if err != nil {
+		return nil, err
+	}
+	res, err := b.index.Add(Kind, u.String(), page.Title, note, page.Text)
+	if err != nil {
+		return nil, err
+	}
+	return res.Document, nil
+}
+
+// List returns all bookmarks, newest first.
+func (b *Bookmarks) List() ([]store.Document, error) {
+	return b.db.Documents(Kind)
+}
+
+// Delete removes a bookmark.
+func (b *Bookmarks) Delete(id int64) error {
+	doc, err := b.db.Document(id)
+	if err != nil {
+		return err
+	}
+	if doc.Kind != Kind {
+		return store.ErrNotFound
+	}
+	return b.db.DeleteDocument(id)
+}
+
+// Search returns saved passages matching query, optionally limited to
+// bookmarks saved in a date range.
+func (b *Bookmarks) Search(query string, since, until time.Time) ([]store.Chunk, error) {
+	return b.index.Search(query, 5, store.DocumentFilter{Kind: Kind, Since: since, Until: until})
+}
+
+// Tools returns the tools for saving and searching bookmarks.
+func (b *Bookmarks) Tools() []tools.Tool {
+	return []tools.Tool{
+		tools.New("save_bookmark",
+			"Save a web page to read later. The page is fetched and its content becomes searchable.",
+			`{"type":"object","properties":{
+				"url":{"type":"string","description":"The http or https URL to save"},
+				"note":{"type":"string","description":"Optional note on why it was saved"}
+			},"required":["url"]}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var p struct{ URL, Note string }
+				if err := tools.Decode(args, &p); err != nil {
+					return "", err
+				}
+				doc, err := b.Save(ctx, p.URL, p.Note)
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("Saved %q (%s).", doc.Title, doc.Source), nil
+			}),
+		tools.New("search_bookmarks",
+			"Search the content of saved bookmarks, e.g. to answer \"what did I save about Go generics last month?\". Dates are YYYY-MM-DD; work out ranges like \"last month\" from the current date.",
+			`{"type":"object","properties":{
+				"query":{"type":"string","description":"Keywords to search for"},
+				"since":{"type":"string","description":"Only bookmarks saved on or after this date"},
+				"until":{"type":"string","description":"Only bookmarks saved before this date"}
+			},"required":["query"]}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var p struct{ Query, Since, Until string }
+				if err := tools.Decode(args, &p); err != nil {
+					return "", err
+				}
+				since, err := rag.ParseDate(p.Since)
+				if err != nil {
+					return "", err
+				}
+				until, err := rag.ParseDate(p.Until)
+				if err != nil {
+					return "", err
+				}
+				chunks, err := b.Search(p.Query, since, until)
+				if err != nil {
+					return "", err
+				}
+				if len(chunks) == 0 {
+					return "No saved bookmarks match.", nil
+				}
+				var sb strings.Builder
+				for _, c := range chunks {
+					fmt.Fprintf(&sb, "%s (%s, saved %s)\n%s\n\n", c.Document.Title, c.Document.Source,
+						c.Document.CreatedAt.Local().Format("2006-01-02"), c.Text)
+				}
+				return strings.TrimSpace(sb.String()), nil
+			}),
+	}
+}
@@ -0,0 +1,270 @@
+// Package briefing composes a daily briefing for each user: the weather,
+// their calendar and reminders, news headlines and the notifications that
+// came in overnight, written up by the model in the order the user's
+// configuration gives, and optionally read aloud by Home Assistant.
+package briefing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"pi-agent/internal/config"
+	"pi-agent/internal/homeassistant"
+	"pi-agent/internal/notify"
+	"pi-agent/internal/store"
+	"pi-agent/internal/tools"
+)
+
+// overnight is how far back the notifications and news sections look
+// when there was no earlier briefing.
+const overnight = 12 * time.Hour
+
+// keepNotifications is how long recorded notifications are kept.
+const keepNotifications = 7 * 24 * time.Hour
+
+// Composer composes and delivers briefings.
+type Composer struct {
+	cfg      config.Briefing
+	db       *store.DB
+	complete func(ctx context.Context, prompt string) (string, error)
+	notifier notify.Notifier       // optional
+	ha       *homeassistant.Client // optional; reads spoken briefings aloud
+	speech   func(user string) *config.Speech
+	client   *http.Client
+
+	mu   sync.Mutex
+	last map[string]time.Time // when each user's last briefing was composed
+}
+
+// New returns a composer. The notifier and Home Assistant client may be
+// nil.
+func New(cfg config.Briefing, db *store.DB, complete func(ctx context.Context, prompt string) (string, error), n notify.Notifier, ha *homeassistant.Client) *Composer {
+	return &Composer{
+		cfg: cfg, db: db, complete: complete, notifier: n, ha: ha,
+		client: &http.Client{Timeout: 20 * time.Second},
+		last:   make(map[string]time.Time),
+	}
+}
+
+// UseSpeech has spoken briefings read in each user's voice and language,
+// as speech returns them.
+func (c *Composer) UseSpeech(speech func(user string) *config.Speech) {
+	c.speech = speech
+}
+
+// Record wraps next so that every notification is also recorded for the
+// notifications section.
+func Record(db *store.DB, next notify.Notifier) notify.Notifier {
+	return &recorder{db: db, next: next}
+}
+
+type recorder struct {
+	db   *store.DB
+	next notify.Notifier
+}
+
+func (r *recorder) Notify(ctx context.Context, msg notify.Message) error {
+	if !slices.Contains(msg.Tags, "briefing") {
+		n := store.Notification{User: msg.User, Title: msg.Title, Body: msg.Body, Priority: int(msg.Priority)}
+		if err := r.db.AddNotification(&n); err != nil {
+			log.Printf("db error recording notification: %v", err)
+		}
+	}
+	return r.next.Notify(ctx, msg)
+}
+
+// Job returns the scheduled job composing and delivering a user's
+// briefing.
+func (c *Composer) Job(u config.BriefingUser) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		start := time.Now()
+		text, err := c.Compose(ctx, u)
+		if err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.last[strings.ToLower(u.User)] = start
+		c.mu.Unlock()
+		return c.deliver(ctx, u, text)
+	}
+}
+
+// User returns the briefing configured for a user.
+func (c *Composer) User(name string) (config.BriefingUser, bool) {
+	for _, u := range c.cfg.Users {
+		if strings.EqualFold(u.User, name) {
+			return u, true
+		}
+	}
+	return config.BriefingUser{}, false
+}
+
+// Compose gathers the user's sections and has the model write the
+// briefing. Notifications and news are those since the last scheduled
+// briefing. A section whose source fails is reported as unavailable
+// rather than failing the briefing.
+func (c *Composer) Compose(ctx context.Context, u config.BriefingUser) (string, error) {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	c.mu.Lock()
+	since, ok := c.last[strings.ToLower(u.User)]
+	c.mu.Unlock()
+	if !ok {
+		since = now.Add(-overnight)
+	}
+
+	var events []event
+	var calErrs []error
+	if slices.Contains(u.Sections, "calendar") || slices.Contains(u.Sections, "reminders") {
+		events, calErrs = c.calendars(ctx, append(slices.Clone(c.cfg.Calendars), u.Calendars...))
+		for _, err := range calErrs {
+			log.Printf("briefing: %v", err)
+		}
+	}
+
+	var b strings.Builder
+	for _, section := range u.Sections {
+		var body string
+		var err error
+		switch section {
+		case "weather":
+			body, err = c.weather(ctx)
+		case "calendar":
+			body = describeEvents(on(events, today))
+			if body == "" && len(calErrs) > 0 {
+				err = errors.Join(calErrs...)
+			}
+		case "reminders":
+			body = describeTodos(due(events, today), today)
+			if body == "" && len(calErrs) > 0 {
+				err = errors.Join(calErrs...)
+			}
+		case "news":
+			var hs []headline
+			var errs []error
+			hs, errs = c.headlines(ctx, append(slices.Clone(c.cfg.Feeds), u.Feeds...), since)
+			for _, h := range hs {
+				body += fmt.Sprintf("- %s: %s\n", h.source, h.title)
+			}
+			if body == "" {
+				err = errors.Join(errs...)
+			}
+		case "notifications":
+			var ns []store.Notification
+			ns, err = c.db.NotificationsSince(u.User, since)
+			for _, n := range ns {
+				body += fmt.Sprintf("- %s %s: %s\n", n.CreatedAt.In(time.Local).Format("15:04"), n.Title, oneLine(n.Body))
+			}
+		}
+		if err != nil {
+			log.Printf("briefing: %s: %v", section, err)
+			body = "(unavailable)"
+		}
+		if body == "" {
+			body = "(nothing)"
+		}
+		fmt.Fprintf(&b, "## %s\n%s\n\n", section, strings.TrimSpace(body))
+	}
+
+	prompt := fmt.Sprintf(`Write %s's morning briefing for %s. Cover these sections in the order given, briefly and warmly, skipping any that have nothing in them or are unavailable. Use only the information below.`,
+		u.User, now.Format("Monday, January 2"))
+	if u.Instructions != "" {
+		prompt += "\n\n" + u.Instructions
+	}
+	text, err := c.complete(ctx, prompt+"\n\n"+b.String())
+	if err != nil {
+		return "", fmt.Errorf("composing briefing: %w", err)
+	}
+
+	if _, err := c.db.DeleteNotificationsBefore(now.Add(-keepNotifications)); err != nil {
+		log.Printf("briefing: %v", err)
+	}
+	return text, nil
+}
+
+// deliver stores, sends and speaks a briefing.
+func (c *Composer) deliver(ctx context.Context, u config.BriefingUser, text string) error {
+	if u.ConversationID != "" {
+		if err := c.db.AddMessage(u.ConversationID, store.RoleAssistant, text); err != nil {
+			log.Printf("db error saving briefing: %v", err)
+		}
+	}
+	var errs []error
+	if c.notifier != nil {
+		msg := notify.Message{Title: "Good morning, " + u.User, Body: text, User: u.User, Tags: []string{"briefing", "sunrise"}}
+		errs = append(errs, c.notifier.Notify(ctx, msg))
+	}
+	if u.MediaPlayer != "" && c.ha != nil {
+		errs = append(errs, c.speak(ctx, u, text))
+	}
+	return errors.Join(errs...)
+}
+
+// speak has the briefing rewritten for listening and read aloud on the
+// user's media player.
+func (c *Composer) speak(ctx context.Context, u config.BriefingUser, text string) error {
+	spoken, err := c.complete(ctx, "Rewrite this briefing to be read aloud by a speech synthesizer: plain sentences only, no lists, headings, markdown, emoji or URLs, and under a minute and a half to say.\n\n"+text)
+	if err != nil {
+		return fmt.Errorf("writing spoken briefing: %w", err)
+	}
+	data := map[string]any{
+		"entity_id":              c.cfg.TTSEntity,
+		"media_player_entity_id": u.MediaPlayer,
+		"message":                spoken,
+	}
+	if c.speech != nil {
+		if sp := c.speech(u.User); sp != nil {
+			if l := sp.TTSLanguage(); l != "" {
+				data["language"] = l
+			}
+			if sp.Voice != "" {
+				data["options"] = map[string]any{"voice": sp.Voice}
+			}
+		}
+	}
+	_, err = c.ha.CallService(ctx, "tts", "speak", data)
+	if err != nil {
+		return fmt.Errorf("speaking briefing: %w", err)
+	}
+	return nil
+}
+
+func oneLine(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > 200 {
+		return string(r[:200]) + "…"
+	}
+	return s
+}
+
+// Tools returns a tool composing a user's briefing on request.
+func (c *Composer) Tools() []tools.Tool {
+	return []tools.Tool{
+		tools.New("daily_briefing",
+			"Compose a user's daily briefing now: weather, calendar, reminders, news and overnight notifications, as configured for them.",
+			`{"type":"object","properties":{"user":{"type":"string","description":"The user the briefing is for"}},"required":["user"]}`,
+			c.briefingTool),
+	}
+}
+
+func (c *Composer) briefingTool(ctx context.Context, args json.RawMessage) (string, error) {
+	var p struct {
+		User string `json:"user"`
+	}
+	if err := json.Unmarshal(args, &p); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	u, ok := c.User(p.User)
+	if !ok {
+		return "", fmt.Errorf("no briefing is configured for %q", p.User)
+	}
+	return c.Compose(ctx, u)
+}
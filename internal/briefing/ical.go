@@ -0,0 +1,295 @@
+package briefing
+
+import (
+	"bufio"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An event is a calendar entry, or a to-do when todo is set.
+type event struct {
+	summary  string
+	location string
+	start    time.Time // for to-dos, when they are due
+	end      time.Time
+	allDay   bool
+	todo     bool
+	done     bool
+	rule     *rrule
+	exdates  []time.Time
+}
+
+// rrule is the subset of RFC 5545 recurrence rules the briefing
+// understands: a frequency and interval, optionally limited to weekdays
+// and ending at a date or after a count.
+type rrule struct {
+	freq     string // DAILY, WEEKLY, MONTHLY or YEARLY
+	interval int
+	until    time.Time
+	count    int
+	byDay    []time.Weekday
+}
+
+var icalDays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// parseICal reads the events and to-dos of an iCalendar file.
+func parseICal(r io.Reader) ([]event, error) {
+	lines, err := icalLines(r)
+	if err != nil {
+		return nil, err
+	}
+	var events []event
+	var cur *event
+	for _, l := range lines {
+		name, params, value := l.name, l.params, l.value
+		switch {
+		case name == "BEGIN" && (value == "VEVENT" || value == "VTODO"):
+			cur = &event{todo: value == "VTODO"}
+		case name == "END" && (value == "VEVENT" || value == "VTODO"):
+			if cur != nil && !cur.start.IsZero() {
+				if cur.end.IsZero() {
+					cur.end = cur.start
+					if cur.allDay {
+						cur.end = cur.start.AddDate(0, 0, 1)
+					}
+				}
+				events = append(events, *cur)
+			}
+			cur = nil
+		case cur == nil:
+		case name == "SUMMARY":
+			cur.summary = unescape(value)
+		case name == "LOCATION":
+			cur.location = unescape(value)
+		case name == "DTSTART" && !cur.todo, name == "DUE":
+			cur.start, cur.allDay = parseICalTime(params, value)
+		case name == "DTEND":
+			cur.end, _ = parseICalTime(params, value)
+		case name == "STATUS":
+			cur.done = value == "COMPLETED" || value == "CANCELLED"
+		case name == "COMPLETED":
+			cur.done = true
+		case name == "RRULE":
+			cur.rule = parseRRule(value)
+		case name == "EXDATE":
+			for v := range strings.SplitSeq(value, ",") {
+				t, _ := parseICalTime(params, v)
+				cur.exdates = append(cur.exdates, t)
+			}
+		}
+	}
+	return events, nil
+}
+
+// icalLine is an iCalendar content line, split into its name,
+// parameters and value.
+type icalLine struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// icalLines reads the content lines of an iCalendar file, unfolded.
+func icalLines(r io.Reader) ([]icalLine, error) {
+	var lines []icalLine
+	var line string
+	add := func() {
+		// The name and parameters end at the first colon outside a quoted
+		// parameter value, e.g. ALTREP="cid:part1@example.org".
+		colon := -1
+		quoted := false
+		for i := 0; i < len(line) && colon < 0; i++ {
+			switch line[i] {
+			case '"':
+				quoted = !quoted
+			case ':':
+				if !quoted {
+					colon = i
+				}
+			}
+		}
+		if colon < 0 {
+			return
+		}
+		head, value := line[:colon], line[colon+1:]
+		parts := strings.Split(head, ";")
+		params := make(map[string]string, len(parts)-1)
+		for _, p := range parts[1:] {
+			k, v, _ := strings.Cut(p, "=")
+			params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+		lines = append(lines, icalLine{strings.ToUpper(parts[0]), params, value})
+	}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		l := strings.TrimRight(sc.Text(), "\r")
+		if strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t") {
+			line += l[1:]
+			continue
+		}
+		add()
+		line = l
+	}
+	add()
+	return lines, sc.Err()
+}
+
+// parseICalTime parses a DATE or DATE-TIME value: UTC with a Z suffix, in
+// the zone its TZID names, or else local.
+func parseICalTime(params map[string]string, value string) (t time.Time, allDay bool) {
+	loc := time.Local
+	if tz := params["TZID"]; tz != "" {
+		if l, err := time.LoadLocation(tz); err == nil {
+			loc = l
+		}
+	}
+	switch {
+	case params["VALUE"] == "DATE" || len(value) == 8:
+		t, _ = time.ParseInLocation("20060102", value, time.Local)
+		return t, true
+	case strings.HasSuffix(value, "Z"):
+		t, _ = time.Parse("20060102T150405Z", value)
+	default:
+		t, _ = time.ParseInLocation("20060102T150405", value, loc)
+	}
+	return t, false
+}
+
+func parseRRule(value string) *rrule {
+	r := &rrule{interval: 1}
+	for part := range strings.SplitSeq(value, ";") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "FREQ":
+			r.freq = v
+		case "INTERVAL":
+			if n, err := strconv.Atoi(v); err == nil && n > 0 {
+				r.interval = n
+			}
+		case "COUNT":
+			r.count, _ = strconv.Atoi(v)
+		case "UNTIL":
+			r.until, _ = parseICalTime(nil, v)
+		case "BYDAY":
+			for d := range strings.SplitSeq(v, ",") {
+				// Ordinals such as 1MO (the first Monday) are not
+				// understood; the rule is then treated as every Monday.
+				if wd, ok := icalDays[strings.TrimLeft(d, "+-0123456789")]; ok {
+					r.byDay = append(r.byDay, wd)
+				}
+			}
+		}
+	}
+	switch r.freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+		return r
+	}
+	return nil
+}
+
+// occursOn returns the occurrence of a recurring event starting on day,
+// a local midnight, if there is one.
+func (e event) occursOn(day time.Time) (time.Time, bool) {
+	r := e.rule
+	first := e.start.In(day.Location())
+	start := time.Date(day.Year(), day.Month(), day.Day(), first.Hour(), first.Minute(), first.Second(), 0, day.Location())
+	firstDay := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, day.Location())
+	if day.Before(firstDay) || !r.until.IsZero() && start.After(r.until) {
+		return time.Time{}, false
+	}
+	days := int(day.Sub(firstDay).Hours()/24 + 0.5)
+	var n int // the number of the period day falls in
+	switch r.freq {
+	case "DAILY":
+		n = days
+	case "WEEKLY":
+		// Weeks start on Monday, the default WKST, so an event first on a
+		// Thursday every other week on Mondays and Thursdays skips the
+		// following Monday.
+		n = (days + (int(first.Weekday())+6)%7) / 7
+		if len(r.byDay) == 0 && day.Weekday() != first.Weekday() || len(r.byDay) > 0 && !slices.Contains(r.byDay, day.Weekday()) {
+			return time.Time{}, false
+		}
+	case "MONTHLY":
+		n = (day.Year()-first.Year())*12 + int(day.Month()-first.Month())
+		if day.Day() != first.Day() {
+			return time.Time{}, false
+		}
+	case "YEARLY":
+		n = day.Year() - first.Year()
+		if day.Month() != first.Month() || day.Day() != first.Day() {
+			return time.Time{}, false
+		}
+	}
+	if n%r.interval != 0 {
+		return time.Time{}, false
+	}
+	// With several weekdays a week, occurrences are not counted, so COUNT
+	// is ignored and the event repeats indefinitely.
+	if r.count > 0 && len(r.byDay) <= 1 && n/r.interval >= r.count {
+		return time.Time{}, false
+	}
+	for _, x := range e.exdates {
+		if x.Equal(start) || e.allDay && x.Equal(day) {
+			return time.Time{}, false
+		}
+	}
+	return start, true
+}
+
+// on returns the events taking place on day, a local midnight, sorted by
+// start time, with recurring events moved to their occurrence that day.
+func on(events []event, day time.Time) []event {
+	next := day.AddDate(0, 0, 1)
+	var out []event
+	for _, e := range events {
+		if e.todo {
+			continue
+		}
+		if e.rule != nil {
+			start, ok := e.occursOn(day)
+			if !ok {
+				continue
+			}
+			e.end, e.start = start.Add(e.end.Sub(e.start)), start
+			out = append(out, e)
+			continue
+		}
+		if e.start.Before(next) && e.end.After(day) {
+			out = append(out, e)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].allDay != out[j].allDay {
+			return out[i].allDay
+		}
+		return out[i].start.Before(out[j].start)
+	})
+	return out
+}
+
+// due returns the open to-dos due before the end of day, a local
+// midnight, overdue ones first.
+func due(events []event, day time.Time) []event {
+	next := day.AddDate(0, 0, 1)
+	var out []event
+	for _, e := range events {
+		if e.todo && !e.done && e.start.Before(next) {
+			out = append(out, e)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].start.Before(out[j].start) })
+	return out
+}
+
+func unescape(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
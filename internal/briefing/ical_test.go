@@ -0,0 +1,279 @@
+package briefing
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// calendar wraps lines in a VCALENDAR, with CRLF line endings.
+func calendar(lines ...string) string {
+	return strings.Join(append(append([]string{"BEGIN:VCALENDAR", "VERSION:2.0"}, lines...), "END:VCALENDAR", ""), "\r\n")
+}
+
+func local(y int, m time.Month, d, h, min int) time.Time {
+	return time.Date(y, m, d, h, min, 0, 0, time.Local)
+}
+
+func TestParseICal(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []event
+	}{
+		{"timed event", calendar(
+			"BEGIN:VEVENT",
+			"SUMMARY:Dentist",
+			"LOCATION:Main St. 4\\, 2nd floor",
+			"DTSTART:20260115T093000",
+			"DTEND:20260115T101500",
+			"END:VEVENT",
+		), []event{{summary: "Dentist", location: "Main St. 4, 2nd floor", start: local(2026, 1, 15, 9, 30), end: local(2026, 1, 15, 10, 15)}}},
+		{"UTC and zones", calendar(
+			"BEGIN:VEVENT",
+			"SUMMARY:Call",
+			"DTSTART:20260115T093000Z",
+			"DTEND;TZID=UTC:20260115T100000",
+			"END:VEVENT",
+		), []event{{summary: "Call", start: time.Date(2026, 1, 15, 9, 30, 0, 0, time.UTC), end: time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)}}},
+		{"all day without end", calendar(
+			"BEGIN:VEVENT",
+			"SUMMARY:Holiday",
+			"DTSTART;VALUE=DATE:20260501",
+			"END:VEVENT",
+		), []event{{summary: "Holiday", start: local(2026, 5, 1, 0, 0), end: local(2026, 5, 2, 0, 0), allDay: true}}},
+		{"timed without end", calendar(
+			"BEGIN:VEVENT",
+			"SUMMARY:Reminder",
+			"DTSTART:20260115T080000",
+			"END:VEVENT",
+		), []event{{summary: "Reminder", start: local(2026, 1, 15, 8, 0), end: local(2026, 1, 15, 8, 0)}}},
+		{"folded and escaped", "BEGIN:VEVENT\nSUMMARY:Team\n  meeting\\; bring\\nnotes\\\\slides\n\tplease\nDTSTART:20260115T080000\nEND:VEVENT\n",
+			[]event{{summary: "Team meeting; bring\nnotes\\slidesplease", start: local(2026, 1, 15, 8, 0), end: local(2026, 1, 15, 8, 0)}}},
+		{"lower-case names and quoted colon", calendar(
+			"BEGIN:VEVENT",
+			`summary;ALTREP="cid:part1@example.org";LANGUAGE=en:Launch`,
+			`DTSTART;TZID="UTC":20260115T080000`,
+			"END:VEVENT",
+		), []event{{summary: "Launch", start: time.Date(2026, 1, 15, 8, 0, 0, 0, time.UTC), end: time.Date(2026, 1, 15, 8, 0, 0, 0, time.UTC)}}},
+		{"recurrence", calendar(
+			"BEGIN:VEVENT",
+			"SUMMARY:Standup",
+			"DTSTART:20260105T091500",
+			"DTEND:20260105T093000",
+			"RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,-1TH;COUNT=10;UNTIL=20261231T000000Z",
+			"EXDATE:20260119T091500,20260202T091500",
+			"END:VEVENT",
+		), []event{{
+			summary: "Standup", start: local(2026, 1, 5, 9, 15), end: local(2026, 1, 5, 9, 30),
+			rule:    &rrule{freq: "WEEKLY", interval: 2, count: 10, until: time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC), byDay: []time.Weekday{time.Monday, time.Thursday}},
+			exdates: []time.Time{local(2026, 1, 19, 9, 15), local(2026, 2, 2, 9, 15)},
+		}}},
+		{"unknown frequency", calendar(
+			"BEGIN:VEVENT",
+			"SUMMARY:Odd",
+			"DTSTART:20260105T091500",
+			"RRULE:FREQ=HOURLY;INTERVAL=0",
+			"END:VEVENT",
+		), []event{{summary: "Odd", start: local(2026, 1, 5, 9, 15), end: local(2026, 1, 5, 9, 15)}}},
+		{"to-dos", calendar(
+			"BEGIN:VTODO",
+			"SUMMARY:Taxes",
+			"DTSTART:20260101T000000",
+			"DUE;VALUE=DATE:20260430",
+			"END:VTODO",
+			"BEGIN:VTODO",
+			"SUMMARY:Call mum",
+			"DUE:20260110T180000",
+			"STATUS:COMPLETED",
+			"END:VTODO",
+			"BEGIN:VTODO",
+			"SUMMARY:Someday",
+			"END:VTODO",
+		), []event{
+			{summary: "Taxes", start: local(2026, 4, 30, 0, 0), end: local(2026, 5, 1, 0, 0), allDay: true, todo: true},
+			{summary: "Call mum", start: local(2026, 1, 10, 18, 0), end: local(2026, 1, 10, 18, 0), todo: true, done: true},
+		}},
+		{"skips other components and broken lines", calendar(
+			"BEGIN:VTIMEZONE",
+			"DTSTART:19701025T030000",
+			"END:VTIMEZONE",
+			"no colon here",
+			"BEGIN:VEVENT",
+			"SUMMARY:Undated",
+			"END:VEVENT",
+		), nil},
+		{"empty", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseICal(strings.NewReader(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d events %+v, want %d", len(got), got, len(tt.want))
+			}
+			for i := range got {
+				if d := diffEvent(got[i], tt.want[i]); d != "" {
+					t.Errorf("event %d: %s", i, d)
+				}
+			}
+		})
+	}
+}
+
+// diffEvent describes how two events differ, or returns "".
+func diffEvent(got, want event) string {
+	var d []string
+	check := func(field string, ok bool, g, w any) {
+		if !ok {
+			d = append(d, field+": got "+fmtAny(g)+", want "+fmtAny(w))
+		}
+	}
+	check("summary", got.summary == want.summary, got.summary, want.summary)
+	check("location", got.location == want.location, got.location, want.location)
+	check("start", got.start.Equal(want.start), got.start, want.start)
+	check("end", got.end.Equal(want.end), got.end, want.end)
+	check("allDay", got.allDay == want.allDay, got.allDay, want.allDay)
+	check("todo", got.todo == want.todo, got.todo, want.todo)
+	check("done", got.done == want.done, got.done, want.done)
+	switch {
+	case (got.rule == nil) != (want.rule == nil):
+		check("rule", false, got.rule, want.rule)
+	case got.rule != nil:
+		g, w := *got.rule, *want.rule
+		check("rule", g.freq == w.freq && g.interval == w.interval && g.count == w.count && g.until.Equal(w.until) && fmtAny(g.byDay) == fmtAny(w.byDay), g, w)
+	}
+	same := len(got.exdates) == len(want.exdates)
+	for i := 0; same && i < len(got.exdates); i++ {
+		same = got.exdates[i].Equal(want.exdates[i])
+	}
+	check("exdates", same, got.exdates, want.exdates)
+	return strings.Join(d, "; ")
+}
+
+func fmtAny(v any) string {
+	if t, ok := v.(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	return fmt.Sprintf("%+v", v)
+}
+
+func TestOn(t *testing.T) {
+	// Monday 5 January 2026 to Sunday 1 February.
+	ics := calendar(
+		"BEGIN:VEVENT",
+		"SUMMARY:Standup",
+		"DTSTART:20260105T091500",
+		"DTEND:20260105T093000",
+		"RRULE:FREQ=DAILY;COUNT=3",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"SUMMARY:Gym",
+		"DTSTART:20260108T180000", // a Thursday
+		"DTEND:20260108T190000",
+		"RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"SUMMARY:Bins",
+		"DTSTART:20260107T070000", // a Wednesday
+		"RRULE:FREQ=WEEKLY;UNTIL=20260121T070000",
+		"EXDATE:20260114T070000",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"SUMMARY:Rent",
+		"DTSTART;VALUE=DATE:20260106",
+		"RRULE:FREQ=MONTHLY",
+		"EXDATE;VALUE=DATE:20260206",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"SUMMARY:Birthday",
+		"DTSTART;VALUE=DATE:20250110",
+		"RRULE:FREQ=YEARLY",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"SUMMARY:Trip",
+		"DTSTART;VALUE=DATE:20260112",
+		"DTEND;VALUE=DATE:20260115",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"SUMMARY:Late show",
+		"DTSTART:20260112T230000",
+		"DTEND:20260113T010000",
+		"END:VEVENT",
+		"BEGIN:VTODO",
+		"SUMMARY:Not an event",
+		"DUE:20260112T120000",
+		"END:VTODO",
+	)
+	events, err := parseICal(strings.NewReader(ics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		day  int // of January 2026
+		want []string
+	}{
+		{4, nil},
+		{5, []string{"Standup 09:15-09:30"}},
+		{6, []string{"Rent all day", "Standup 09:15-09:30"}},
+		{7, []string{"Bins 07:00-07:00", "Standup 09:15-09:30"}},
+		{8, []string{"Gym 18:00-19:00"}},
+		// Weeks start on Monday: the Monday after the first Thursday is
+		// in an off week.
+		{12, []string{"Trip all day", "Late show 23:00-01:00"}},
+		{13, []string{"Trip all day", "Late show 23:00-01:00"}},
+		{14, []string{"Trip all day"}},
+		{10, []string{"Birthday all day"}},
+		{15, nil},
+		{19, []string{"Gym 18:00-19:00"}},
+		{21, []string{"Bins 07:00-07:00"}},
+		{22, []string{"Gym 18:00-19:00"}},
+		{26, nil},
+		{28, nil},
+	}
+	for _, tt := range tests {
+		day := local(2026, 1, tt.day, 0, 0)
+		var got []string
+		for _, e := range on(events, day) {
+			if e.allDay {
+				got = append(got, e.summary+" all day")
+			} else {
+				got = append(got, e.summary+" "+e.start.Format("15:04")+"-"+e.end.Format("15:04"))
+			}
+		}
+		if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+			t.Errorf("January %d: %q, want %q", tt.day, got, tt.want)
+		}
+	}
+	// Standup's three days have passed, and Rent skips February.
+	if got := on(events, local(2026, 2, 6, 0, 0)); len(got) != 0 {
+		t.Errorf("February 6: %d events, want none", len(got))
+	}
+	if got := on(events, local(2026, 3, 6, 0, 0)); len(got) != 1 || got[0].summary != "Rent" {
+		t.Errorf("March 6: %+v, want Rent", got)
+	}
+}
+
+func TestDue(t *testing.T) {
+	events, err := parseICal(strings.NewReader(calendar(
+		"BEGIN:VTODO", "SUMMARY:Later", "DUE:20260120T120000", "END:VTODO",
+		"BEGIN:VTODO", "SUMMARY:Today", "DUE:20260115T170000", "END:VTODO",
+		"BEGIN:VTODO", "SUMMARY:Overdue", "DUE;VALUE=DATE:20260110", "END:VTODO",
+		"BEGIN:VTODO", "SUMMARY:Done", "DUE:20260101T120000", "COMPLETED:20260101T110000Z", "END:VTODO",
+		"BEGIN:VTODO", "SUMMARY:Cancelled", "DUE:20260101T120000", "STATUS:CANCELLED", "END:VTODO",
+		"BEGIN:VEVENT", "SUMMARY:Event", "DTSTART:20260115T080000", "END:VEVENT",
+	)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range due(events, local(2026, 1, 15, 0, 0)) {
+		got = append(got, e.summary)
+	}
+	if want := "Overdue, Today"; strings.Join(got, ", ") != want {
+		t.Errorf("due = %q, want %s", got, want)
+	}
+}
@@ -0,0 +1,245 @@
+package briefing
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxFeedBytes bounds how much of a calendar or feed is downloaded.
+const maxFeedBytes = 4 << 20
+
+// maxHeadlines caps the items taken from each feed.
+const maxHeadlines = 8
+
+// get fetches a URL, failing on non-2xx responses.
+func (c *Composer) get(ctx context.Context, u string) ([]byte, error) {
+	// webcal:// is how calendar apps share .ics links.
+	if rest, ok := strings.CutPrefix(u, "webcal://"); ok {
+		u = "https://" + rest
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "pi-agent")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxFeedBytes))
+}
+
+// redactURL drops the query and credentials from a URL for messages, as
+// private calendar links carry their secret in them.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "calendar"
+	}
+	return u.Host + u.Path
+}
+
+// weatherCodes describes WMO weather interpretation codes as Open-Meteo
+// reports them.
+var weatherCodes = map[int]string{
+	0: "clear sky", 1: "mainly clear", 2: "partly cloudy", 3: "overcast",
+	45: "fog", 48: "freezing fog",
+	51: "light drizzle", 53: "drizzle", 55: "heavy drizzle", 56: "freezing drizzle", 57: "heavy freezing drizzle",
+	61: "light rain", 63: "rain", 65: "heavy rain", 66: "freezing rain", 67: "heavy freezing rain",
+	71: "light snow", 73: "snow", 75: "heavy snow", 77: "snow grains",
+	80: "light showers", 81: "showers", 82: "violent showers", 85: "snow showers", 86: "heavy snow showers",
+	95: "thunderstorms", 96: "thunderstorms with hail", 99: "thunderstorms with heavy hail",
+}
+
+// weatherURL is the Open-Meteo forecast API, which needs no key.
+var weatherURL = "https://api.open-meteo.com/v1/forecast"
+
+// weather describes today's forecast.
+func (c *Composer) weather(ctx context.Context) (string, error) {
+	if c.cfg.Latitude == 0 && c.cfg.Longitude == 0 {
+		return "", nil
+	}
+	q := url.Values{
+		"latitude":      {fmt.Sprint(c.cfg.Latitude)},
+		"longitude":     {fmt.Sprint(c.cfg.Longitude)},
+		"current":       {"temperature_2m,weather_code"},
+		"daily":         {"weather_code,temperature_2m_max,temperature_2m_min,precipitation_probability_max,wind_speed_10m_max"},
+		"timezone":      {"auto"},
+		"forecast_days": {"1"},
+	}
+	data, err := c.get(ctx, weatherURL+"?"+q.Encode())
+	if err != nil {
+		return "", fmt.Errorf("weather: %w", err)
+	}
+	var f struct {
+		Current struct {
+			Temperature float64 `json:"temperature_2m"`
+			Code        int     `json:"weather_code"`
+		} `json:"current"`
+		Daily struct {
+			Code   []int     `json:"weather_code"`
+			Max    []float64 `json:"temperature_2m_max"`
+			Min    []float64 `json:"temperature_2m_min"`
+			Precip []float64 `json:"precipitation_probability_max"`
+			Wind   []float64 `json:"wind_speed_10m_max"`
+		} `json:"daily"`
+		Units struct {
+			Temperature string `json:"temperature_2m_max"`
+			Wind        string `json:"wind_speed_10m_max"`
+		} `json:"daily_units"`
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return "", fmt.Errorf("weather: %w", err)
+	}
+	d := f.Daily
+	if len(d.Code) == 0 || len(d.Max) == 0 || len(d.Min) == 0 {
+		return "", fmt.Errorf("weather: no forecast for today")
+	}
+	s := fmt.Sprintf("Now %.0f%s and %s. Today %s, %.0f to %.0f%s",
+		f.Current.Temperature, f.Units.Temperature, weatherCodes[f.Current.Code],
+		weatherCodes[d.Code[0]], d.Min[0], d.Max[0], f.Units.Temperature)
+	if len(d.Precip) > 0 {
+		s += fmt.Sprintf(", %.0f%% chance of precipitation", d.Precip[0])
+	}
+	if len(d.Wind) > 0 {
+		s += fmt.Sprintf(", wind up to %.0f %s", d.Wind[0], f.Units.Wind)
+	}
+	return s + ".", nil
+}
+
+// calendars downloads and parses calendars, skipping those that fail.
+func (c *Composer) calendars(ctx context.Context, urls []string) ([]event, []error) {
+	var events []event
+	var errs []error
+	for _, u := range urls {
+		data, err := c.get(ctx, u)
+		if err == nil {
+			var evs []event
+			if evs, err = parseICal(strings.NewReader(string(data))); err == nil {
+				events = append(events, evs...)
+				continue
+			}
+		}
+		errs = append(errs, fmt.Errorf("calendar %s: %w", redactURL(u), err))
+	}
+	return events, errs
+}
+
+func describeEvents(events []event) string {
+	var b strings.Builder
+	for _, e := range events {
+		switch {
+		case e.allDay:
+			b.WriteString("- all day: ")
+		default:
+			fmt.Fprintf(&b, "- %s–%s: ", e.start.In(time.Local).Format("15:04"), e.end.In(time.Local).Format("15:04"))
+		}
+		b.WriteString(e.summary)
+		if e.location != "" {
+			b.WriteString(" (" + e.location + ")")
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func describeTodos(todos []event, day time.Time) string {
+	var b strings.Builder
+	for _, t := range todos {
+		b.WriteString("- " + t.summary)
+		if t.start.Before(day) {
+			fmt.Fprintf(&b, " (overdue since %s)", t.start.In(time.Local).Format("Mon Jan 2"))
+		} else if !t.allDay {
+			fmt.Fprintf(&b, " (due %s)", t.start.In(time.Local).Format("15:04"))
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// feed is an RSS 2.0 or Atom document; only one of Items and Entries is
+// filled.
+type feed struct {
+	Title   string     `xml:"channel>title"`
+	Items   []feedItem `xml:"channel>item"`
+	Feed    string     `xml:"title"`
+	Entries []struct {
+		Title     string `xml:"title"`
+		Updated   string `xml:"updated"`
+		Published string `xml:"published"`
+	} `xml:"entry"`
+}
+
+type feedItem struct {
+	Title   string `xml:"title"`
+	PubDate string `xml:"pubDate"`
+}
+
+// headline is a feed item.
+type headline struct {
+	source, title string
+	published     time.Time
+}
+
+// headlines returns the first items of each feed published since the
+// given time. Items without a parseable date are kept.
+func (c *Composer) headlines(ctx context.Context, urls []string, since time.Time) ([]headline, []error) {
+	var out []headline
+	var errs []error
+	for _, u := range urls {
+		data, err := c.get(ctx, u)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("feed %s: %w", redactURL(u), err))
+			continue
+		}
+		var f feed
+		if err := xml.Unmarshal(data, &f); err != nil {
+			errs = append(errs, fmt.Errorf("feed %s: %w", redactURL(u), err))
+			continue
+		}
+		source := strings.TrimSpace(f.Title + f.Feed)
+		var items []headline
+		for _, it := range f.Items {
+			items = append(items, headline{source, strings.TrimSpace(it.Title), parseFeedTime(it.PubDate)})
+		}
+		for _, e := range f.Entries {
+			published := e.Published
+			if published == "" {
+				published = e.Updated
+			}
+			items = append(items, headline{source, strings.TrimSpace(e.Title), parseFeedTime(published)})
+		}
+		n := 0
+		for _, h := range items {
+			if n == maxHeadlines {
+				break
+			}
+			if h.title != "" && (h.published.IsZero() || h.published.After(since)) {
+				out = append(out, h)
+				n++
+			}
+		}
+	}
+	return out, errs
+}
+
+func parseFeedTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC1123Z, time.RFC1123, time.RFC3339, "Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
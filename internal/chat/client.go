@@ -9,6 +9,8 @@ import (
 	"io"
 	"net/http"
 	"strings"
+
+	"pi-agent/internal/upstream"
 )
 
 // ChatGPT backend endpoint for OAuth-authenticated requests.
@@ -16,25 +18,78 @@ import (
 // not the standard api.openai.com which requires a separate API key.
 const responsesURL = "https://chatgpt.com/backend-api/codex/responses"
 
-// Message is the OpenAI chat message format.
+// apiResponsesURL is the platform Responses API, for API keys.
+const apiResponsesURL = "https://api.openai.com/v1/responses"
+
+// Message is an item in the Responses API input array. Plain chat messages
+// set Role and Content; function calls and their results set Type along
+// with the call fields.
 type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Type      string `json:"type,omitempty"`
+	Role      string `json:"role,omitempty"`
+	Content   string `json:"content,omitempty"`
+	CallID    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	Output    string `json:"output,omitempty"`
+}
+
+// Tool is a function definition offered to the model.
+type Tool struct {
+	Type        string          `json:"type"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+// ToolCall is a function call requested by the model.
+type ToolCall struct {
+	CallID    string `json:"call_id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
 }
 
 // StreamDelta is a single token or content fragment from a streaming response.
+// A delta with a non-nil ToolCall carries a completed function call instead
+// of content.
 type StreamDelta struct {
-	Content string
-	Done    bool
+	Content  string
+	ToolCall *ToolCall
+	Done     bool
+	// Fallback is set on a delta without content, sent first, when a
+	// Failover provider's fallback produced the stream. It names the
+	// fallback.
+	Fallback string
+	// Usage is set on the Done delta by providers that report token
+	// counts.
+	Usage *Usage
+}
+
+// Usage counts the tokens a completion consumed.
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// Request describes a single completion call.
+type Request struct {
+	Model        string
+	Instructions string
+	Messages     []Message
+	Tools        []Tool
+	// MaxOutputTokens caps the reply's length; 0 leaves it to the model.
+	MaxOutputTokens int
 }
 
 // responsesRequest is the request body for the Responses API.
 type responsesRequest struct {
-	Model        string    `json:"model"`
-	Store        bool      `json:"store"`
-	Instructions string    `json:"instructions"`
-	Input        []Message `json:"input"`
-	Stream       bool      `json:"stream"`
+	Model           string    `json:"model"`
+	Store           bool      `json:"store"`
+	Instructions    string    `json:"instructions"`
+	Input           []Message `json:"input"`
+	Tools           []Tool    `json:"tools,omitempty"`
+	Stream          bool      `json:"stream"`
+	MaxOutputTokens int       `json:"max_output_tokens,omitempty"`
 }
 
 // StreamCompletion calls the ChatGPT backend Responses API in streaming mode
@@ -43,7 +98,17 @@ type responsesRequest struct {
 //
 // The accountID is the ChatGPT account ID extracted from the OAuth JWT,
 // required for the ChatGPT-Account-Id header.
-func StreamCompletion(ctx context.Context, token, accountID, model, instructions string, messages []Message) (<-chan StreamDelta, <-chan error) {
+func StreamCompletion(ctx context.Context, token, accountID string, r Request) (<-chan StreamDelta, <-chan error) {
+	return streamResponses(ctx, responsesURL, token, accountID, r)
+}
+
+// StreamAPICompletion is StreamCompletion against the platform API at
+// api.openai.com, authenticated with an API key.
+func StreamAPICompletion(ctx context.Context, apiKey string, r Request) (<-chan StreamDelta, <-chan error) {
+	return streamResponses(ctx, apiResponsesURL, apiKey, "", r)
+}
+
+func streamResponses(ctx context.Context, url, token, accountID string, r Request) (<-chan StreamDelta, <-chan error) {
 	deltaCh := make(chan StreamDelta, 64)
 	errCh := make(chan error, 1)
 
@@ -51,23 +116,26 @@ func StreamCompletion(ctx context.Context, token, accountID, model, instructions
 		defer close(deltaCh)
 		defer close(errCh)
 
+		instructions := r.Instructions
 		if strings.TrimSpace(instructions) == "" {
 			instructions = "You are a helpful assistant."
 		}
 
 		body, err := json.Marshal(responsesRequest{
-			Model:        model,
-			Store:        false,
-			Instructions: instructions,
-			Input:        messages,
-			Stream:       true,
+			Model:           r.Model,
+			Store:           false,
+			Instructions:    instructions,
+			Input:           r.Messages,
+			Tools:           r.Tools,
+			Stream:          true,
+			MaxOutputTokens: r.MaxOutputTokens,
 		})
 		if err != nil {
 			errCh <- fmt.Errorf("marshaling request: %w", err)
 			return
 		}
 
-		req, err := http.NewRequestWithContext(ctx, "POST", responsesURL, bytes.NewReader(body))
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
 		if err != nil {
 			errCh <- fmt.Errorf("creating request: %w", err)
 			return
@@ -78,62 +146,113 @@ func StreamCompletion(ctx context.Context, token, accountID, model, instructions
 			req.Header.Set("ChatGPT-Account-Id", accountID)
 		}
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := upstream.Client().Do(req)
 		if err != nil {
 			errCh <- fmt.Errorf("API request: %w", err)
 			return
 		}
 		defer resp.Body.Close()
 
+		var stream io.Reader = resp.Body
+		if t := transcriptFrom(ctx); t != nil {
+			stream = t.record(body, resp.StatusCode, stream)
+		}
 		if resp.StatusCode != http.StatusOK {
-			respBody, _ := io.ReadAll(resp.Body)
+			respBody, _ := io.ReadAll(stream)
 			errCh <- fmt.Errorf("API error %d: %s", resp.StatusCode, string(respBody))
 			return
 		}
 
-		// The Responses API uses SSE with typed events:
-		//   event: response.output_text.delta
-		//   data: {"type":"response.output_text.delta","delta":"..."}
-		//
-		//   event: response.completed
-		//   data: {"type":"response.completed","response":{...}}
-		scanner := bufio.NewScanner(resp.Body)
-		for scanner.Scan() {
-			line := scanner.Text()
-			if !strings.HasPrefix(line, "data: ") {
-				continue
-			}
-			data := strings.TrimPrefix(line, "data: ")
-
-			var event struct {
-				Type     string `json:"type"`
-				Delta    string `json:"delta"`
-				Response *struct {
-					Output []struct {
-						Content []struct {
-							Text string `json:"text"`
-						} `json:"content"`
-					} `json:"output"`
-				} `json:"response"`
+		if err := ParseStream(stream, func(d StreamDelta) { deltaCh <- d }); err != nil {
+			errCh <- err
+		}
+	}()
+
+	return deltaCh, errCh
+}
+
+// ParseStream reads a Responses API event stream, passing each delta to
+// emit, until the response completes or the stream ends. It is the parser
+// StreamCompletion uses, exposed so recorded transcripts can be replayed.
+func ParseStream(r io.Reader, emit func(StreamDelta)) error {
+	// The Responses API uses SSE with typed events:
+	//   event: response.output_text.delta
+	//   data: {"type":"response.output_text.delta","delta":"..."}
+	//
+	//   event: response.output_item.done
+	//   data: {"type":"response.output_item.done","item":{"type":"function_call",...}}
+	//
+	//   event: response.completed
+	//   data: {"type":"response.completed","response":{...}}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		data := strings.TrimPrefix(line, "data: ")
+
+		var event struct {
+			Type  string `json:"type"`
+			Delta string `json:"delta"`
+			Item  *struct {
+				Type      string `json:"type"`
+				CallID    string `json:"call_id"`
+				Name      string `json:"name"`
+				Arguments string `json:"arguments"`
+			} `json:"item"`
+			Response *struct {
+				Output []struct {
+					Content []struct {
+						Text string `json:"text"`
+					} `json:"content"`
+				} `json:"output"`
+				Usage *Usage `json:"usage"`
+			} `json:"response"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			continue // skip malformed chunks
+		}
+
+		switch event.Type {
+		case "response.output_text.delta":
+			if event.Delta != "" {
+				emit(StreamDelta{Content: event.Delta})
 			}
-			if err := json.Unmarshal([]byte(data), &event); err != nil {
-				continue // skip malformed chunks
+		case "response.output_item.done":
+			if event.Item != nil && event.Item.Type == "function_call" {
+				emit(StreamDelta{ToolCall: &ToolCall{
+					CallID:    event.Item.CallID,
+					Name:      event.Item.Name,
+					Arguments: event.Item.Arguments,
+				}})
 			}
-
-			switch event.Type {
-			case "response.output_text.delta":
-				if event.Delta != "" {
-					deltaCh <- StreamDelta{Content: event.Delta}
-				}
-			case "response.completed":
-				deltaCh <- StreamDelta{Done: true}
-				return
+		case "response.completed":
+			done := StreamDelta{Done: true}
+			if event.Response != nil {
+				done.Usage = event.Response.Usage
 			}
+			emit(done)
+			return nil
 		}
-		if err := scanner.Err(); err != nil {
-			errCh <- fmt.Errorf("reading stream: %w", err)
-		}
-	}()
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading stream: %w", err)
+	}
+	return nil
+}
 
-	return deltaCh, errCh
+// Complete runs a completion against the ChatGPT backend and returns the
+// full response text. Tool calls are not supported; any requested by the
+// model are ignored.
+func Complete(ctx context.Context, token, accountID string, r Request) (string, error) {
+	deltaCh, errCh := StreamCompletion(ctx, token, accountID, r)
+	var out strings.Builder
+	for delta := range deltaCh {
+		out.WriteString(delta.Content)
+	}
+	if err := <-errCh; err != nil {
+		return "", err
+	}
+	return out.String(), nil
 }
@@ -0,0 +1,75 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// Failover is a Provider that uses Fallback, typically a local model,
+// when Primary fails before streaming anything, e.g. because the network
+// or the subscription backend is down. A stream from the fallback starts
+// with a delta whose Fallback field is Name, so the reply can be flagged.
+type Failover struct {
+	Primary  Provider
+	Fallback Provider
+	Name     string // the fallback's name, e.g. "ollama"
+}
+
+// Authorize fails only if neither provider can be used.
+func (p Failover) Authorize(ctx context.Context) error {
+	a, ok := p.Primary.(Authorizer)
+	if !ok {
+		return nil
+	}
+	err := a.Authorize(ctx)
+	if err == nil {
+		return nil
+	}
+	if fa, ok := p.Fallback.(Authorizer); ok {
+		if ferr := fa.Authorize(ctx); ferr != nil {
+			return err
+		}
+	}
+	log.Printf("primary provider unavailable, using %s: %v", p.Name, err)
+	return nil
+}
+
+// Stream implements Provider.
+func (p Failover) Stream(ctx context.Context, r Request) (<-chan StreamDelta, <-chan error) {
+	deltaCh := make(chan StreamDelta, 64)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(deltaCh)
+		defer close(errCh)
+
+		primary, primaryErr := p.Primary.Stream(ctx, r)
+		started := false
+		for delta := range primary {
+			started = true
+			deltaCh <- delta
+		}
+		err := <-primaryErr
+		if err == nil || started || ctx.Err() != nil {
+			// A reply cannot be resumed on another model once it has
+			// partly been sent.
+			if err != nil {
+				errCh <- err
+			}
+			return
+		}
+
+		log.Printf("primary provider failed, answering with %s: %v", p.Name, err)
+		fallback, fallbackErr := p.Fallback.Stream(ctx, r)
+		deltaCh <- StreamDelta{Fallback: p.Name}
+		for delta := range fallback {
+			deltaCh <- delta
+		}
+		if ferr := <-fallbackErr; ferr != nil {
+			errCh <- fmt.Errorf("%w (fallback %s: %v)", err, p.Name, ferr)
+		}
+	}()
+
+	return deltaCh, errCh
+}
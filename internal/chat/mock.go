@@ -0,0 +1,221 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MockStep is one scripted answer of a Mock provider.
+type MockStep struct {
+	// Match picks the step for requests whose latest user message
+	// contains it; empty matches any request.
+	Match string `json:"match"`
+	// ToolCalls are requested before the reply, which follows once their
+	// outputs are sent back in the next request.
+	ToolCalls []ToolCall `json:"tool_calls"`
+	Reply     string     `json:"reply"`
+	// Error fails the stream with this message after ErrorAfter deltas
+	// of the reply.
+	Error      string `json:"error"`
+	ErrorAfter int    `json:"error_after"`
+	// Delay is waited before each delta, overriding the Mock's.
+	Delay time.Duration `json:"-"`
+	// Usage is reported with the end of the stream.
+	Usage *Usage `json:"usage"`
+	// Repeat keeps the step for later requests; otherwise it is used once.
+	Repeat bool `json:"repeat"`
+}
+
+// Mock is a Provider that answers from a script instead of a model, for
+// tests and demos without network access or credentials. Each request is
+// answered by the first unused step that matches it; a request no step
+// matches is answered by echoing the user's message. Replies are streamed
+// in chunks of ChunkSize runes.
+type Mock struct {
+	Steps     []MockStep
+	Delay     time.Duration // waited before each delta
+	ChunkSize int           // runes per delta; default 8
+
+	mu       sync.Mutex
+	used     []bool
+	pending  *MockStep // step whose tool calls await their outputs
+	requests []Request
+}
+
+// LoadMock reads a Mock script from a JSON file:
+//
+//	{
+//	  "delay": "20ms",
+//	  "steps": [
+//	    {"match": "time", "tool_calls": [{"call_id": "1", "name": "clock", "arguments": "{}"}], "reply": "It is noon."},
+//	    {"match": "fail", "error": "overloaded", "error_after": 2, "reply": "Partial answer"},
+//	    {"reply": "Hello!", "delay": "100ms", "repeat": true}
+//	  ]
+//	}
+func LoadMock(path string) (*Mock, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	type step struct {
+		MockStep
+		Delay string `json:"delay"`
+	}
+	var f struct {
+		Delay     string `json:"delay"`
+		ChunkSize int    `json:"chunk_size"`
+		Steps     []step `json:"steps"`
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	m := &Mock{ChunkSize: f.ChunkSize}
+	if m.Delay, err = parseDelay(f.Delay); err != nil {
+		return nil, fmt.Errorf("%s: delay: %w", path, err)
+	}
+	for i, s := range f.Steps {
+		if s.MockStep.Delay, err = parseDelay(s.Delay); err != nil {
+			return nil, fmt.Errorf("%s: steps[%d].delay: %w", path, i, err)
+		}
+		m.Steps = append(m.Steps, s.MockStep)
+	}
+	return m, nil
+}
+
+func parseDelay(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// Requests returns the requests the mock has received, oldest first.
+func (m *Mock) Requests() []Request {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Request(nil), m.requests...)
+}
+
+// Local implements Localer: a mock sends nothing anywhere.
+func (m *Mock) Local() bool { return true }
+
+// Stream implements Provider.
+func (m *Mock) Stream(ctx context.Context, r Request) (<-chan StreamDelta, <-chan error) {
+	step, calls := m.next(r)
+	deltaCh := make(chan StreamDelta, 64)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(deltaCh)
+		defer close(errCh)
+
+		delay := m.Delay
+		if step.Delay > 0 {
+			delay = step.Delay
+		}
+		send := func(d StreamDelta) error {
+			if delay > 0 {
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			select {
+			case deltaCh <- d:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if calls {
+			for _, c := range step.ToolCalls {
+				if err := send(StreamDelta{ToolCall: &c}); err != nil {
+					errCh <- err
+					return
+				}
+			}
+			deltaCh <- StreamDelta{Done: true}
+			return
+		}
+		for i, chunk := range m.chunks(step.Reply) {
+			if step.Error != "" && i == step.ErrorAfter {
+				break
+			}
+			if err := send(StreamDelta{Content: chunk}); err != nil {
+				errCh <- err
+				return
+			}
+		}
+		if step.Error != "" {
+			errCh <- errors.New(step.Error)
+			return
+		}
+		deltaCh <- StreamDelta{Done: true, Usage: step.Usage}
+	}()
+
+	return deltaCh, errCh
+}
+
+// next records a request and picks the step answering it, reporting
+// whether its tool calls are due rather than its reply.
+func (m *Mock) next(r Request) (MockStep, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = append(m.requests, r)
+
+	var latest string
+	for _, msg := range r.Messages {
+		if msg.Type == "" && msg.Role == "user" {
+			latest = msg.Content
+		}
+	}
+	if n := len(r.Messages); n > 0 && r.Messages[n-1].Type == "function_call_output" {
+		if s := m.pending; s != nil {
+			m.pending = nil
+			return *s, false
+		}
+		// Outputs without a scripted follow-up: report the last one.
+		return MockStep{Reply: "Tool result: " + r.Messages[n-1].Output}, false
+	}
+
+	if len(m.used) != len(m.Steps) {
+		m.used = make([]bool, len(m.Steps))
+	}
+	for i := range m.Steps {
+		s := &m.Steps[i]
+		if m.used[i] || !strings.Contains(latest, s.Match) {
+			continue
+		}
+		m.used[i] = !s.Repeat
+		if len(s.ToolCalls) > 0 && len(r.Tools) > 0 {
+			m.pending = s
+			return *s, true
+		}
+		return *s, false
+	}
+	return MockStep{Reply: "You said: " + latest}, false
+}
+
+// chunks splits a reply into deltas of ChunkSize runes.
+func (m *Mock) chunks(s string) []string {
+	size := m.ChunkSize
+	if size <= 0 {
+		size = 8
+	}
+	var out []string
+	runes := []rune(s)
+	for len(runes) > 0 {
+		n := min(size, len(runes))
+		out = append(out, string(runes[:n]))
+		runes = runes[n:]
+	}
+	return out
+}
@@ -0,0 +1,173 @@
+package chat
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultOllamaURL is where a local Ollama server listens by default.
+const DefaultOllamaURL = "http://localhost:11434"
+
+// Ollama is the Provider for a model served by Ollama, usually on the
+// same machine or LAN. Tools are not offered to it: small local models
+// call them unreliably, and function call items in the conversation are
+// left out.
+type Ollama struct {
+	URL string // default DefaultOllamaURL
+	// Model is the Ollama model to run, e.g. "llama3.2", whatever model
+	// the request names; empty uses the request's.
+	Model string
+}
+
+// Local reports whether the server is on this machine or a private
+// network, judging by its URL.
+func (p Ollama) Local() bool {
+	raw := p.URL
+	if raw == "" {
+		raw = DefaultOllamaURL
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast()
+	}
+	return host == "localhost" || !strings.Contains(host, ".") ||
+		strings.HasSuffix(host, ".local") || strings.HasSuffix(host, ".lan") || strings.HasSuffix(host, ".home.arpa")
+}
+
+// Unload asks the server to release the model from memory now rather than
+// when its keep-alive runs out; the next request loads it again. model is
+// used if p has none.
+func (p Ollama) Unload(ctx context.Context, model string) error {
+	if p.Model != "" {
+		model = p.Model
+	}
+	body, err := json.Marshal(map[string]any{"model": model, "keep_alive": 0})
+	if err != nil {
+		return fmt.Errorf("marshaling request: %w", err)
+	}
+	url := p.URL
+	if url == "" {
+		url = DefaultOllamaURL
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(url, "/")+"/api/generate", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ollama request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("ollama error %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
+
+type ollamaMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Stream implements Provider.
+func (p Ollama) Stream(ctx context.Context, r Request) (<-chan StreamDelta, <-chan error) {
+	deltaCh := make(chan StreamDelta, 64)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(deltaCh)
+		defer close(errCh)
+
+		model := p.Model
+		if model == "" {
+			model = r.Model
+		}
+		var messages []ollamaMessage
+		if strings.TrimSpace(r.Instructions) != "" {
+			messages = append(messages, ollamaMessage{Role: "system", Content: r.Instructions})
+		}
+		for _, m := range r.Messages {
+			if m.Type == "" && m.Content != "" {
+				messages = append(messages, ollamaMessage{Role: m.Role, Content: m.Content})
+			}
+		}
+		payload := map[string]any{"model": model, "messages": messages, "stream": true}
+		if r.MaxOutputTokens > 0 {
+			payload["options"] = map[string]any{"num_predict": r.MaxOutputTokens}
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			errCh <- fmt.Errorf("marshaling request: %w", err)
+			return
+		}
+
+		url := p.URL
+		if url == "" {
+			url = DefaultOllamaURL
+		}
+		req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(url, "/")+"/api/chat", bytes.NewReader(body))
+		if err != nil {
+			errCh <- fmt.Errorf("creating request: %w", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			errCh <- fmt.Errorf("ollama request: %w", err)
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			respBody, _ := io.ReadAll(resp.Body)
+			errCh <- fmt.Errorf("ollama error %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+			return
+		}
+
+		// The reply is one JSON object per line:
+		//   {"message":{"role":"assistant","content":"..."},"done":false}
+		//   {"done":true,"prompt_eval_count":26,"eval_count":290,...}
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			var chunk struct {
+				Message         ollamaMessage `json:"message"`
+				Done            bool          `json:"done"`
+				Error           string        `json:"error"`
+				PromptEvalCount int           `json:"prompt_eval_count"`
+				EvalCount       int           `json:"eval_count"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+				continue // skip malformed chunks
+			}
+			if chunk.Error != "" {
+				errCh <- fmt.Errorf("ollama: %s", chunk.Error)
+				return
+			}
+			if chunk.Message.Content != "" {
+				deltaCh <- StreamDelta{Content: chunk.Message.Content}
+			}
+			if chunk.Done {
+				deltaCh <- StreamDelta{Done: true, Usage: &Usage{InputTokens: chunk.PromptEvalCount, OutputTokens: chunk.EvalCount}}
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			errCh <- fmt.Errorf("reading stream: %w", err)
+		}
+	}()
+
+	return deltaCh, errCh
+}
@@ -0,0 +1,104 @@
+package chat
+
+import (
+	"context"
+	"strings"
+)
+
+// Provider is a model backend that streams completions.
+type Provider interface {
+	// Stream runs a completion, sending deltas to the first channel. Both
+	// channels are closed when the stream finishes; at most one error is
+	// sent.
+	Stream(ctx context.Context, r Request) (<-chan StreamDelta, <-chan error)
+}
+
+// Authorizer is implemented by providers that need credentials, so a turn
+// can be rejected before any of the reply has been streamed.
+type Authorizer interface {
+	Authorize(ctx context.Context) error
+}
+
+// Localer is implemented by providers that run on this machine or its
+// LAN, so that private conversations can be kept off the cloud.
+type Localer interface {
+	Local() bool
+}
+
+// LocalOnly returns the part of p that runs locally: p itself, the local
+// providers of a Failover, or nil if none does.
+func LocalOnly(p Provider) Provider {
+	switch l := p.(type) {
+	case Failover:
+		primary, fallback := LocalOnly(l.Primary), LocalOnly(l.Fallback)
+		switch {
+		case primary != nil && fallback != nil:
+			return Failover{Primary: primary, Fallback: fallback, Name: l.Name}
+		case primary != nil:
+			return primary
+		}
+		return fallback
+	case Localer:
+		if l.Local() {
+			return p
+		}
+	}
+	return nil
+}
+
+// TokenSource supplies credentials for OpenAI: OAuth tokens for the
+// ChatGPT backend, or an API key for the platform API.
+type TokenSource interface {
+	AccessToken(ctx context.Context) (string, error)
+	AccountID() string
+	IsAPIKey() bool
+}
+
+// ChatGPT is the Provider for OpenAI models, served by the ChatGPT backend
+// when authenticated with the subscription's OAuth tokens and by
+// api.openai.com when authenticated with an API key.
+type ChatGPT struct {
+	Tokens TokenSource
+}
+
+// Authorize checks that a valid access token can be obtained.
+func (p ChatGPT) Authorize(ctx context.Context) error {
+	_, err := p.Tokens.AccessToken(ctx)
+	return err
+}
+
+// Stream implements Provider.
+func (p ChatGPT) Stream(ctx context.Context, r Request) (<-chan StreamDelta, <-chan error) {
+	accessToken, err := p.Tokens.AccessToken(ctx)
+	if err != nil {
+		return failed(err)
+	}
+	if p.Tokens.IsAPIKey() {
+		return StreamAPICompletion(ctx, accessToken, r)
+	}
+	return StreamCompletion(ctx, accessToken, p.Tokens.AccountID(), r)
+}
+
+// failed returns closed channels reporting err.
+func failed(err error) (<-chan StreamDelta, <-chan error) {
+	deltaCh := make(chan StreamDelta)
+	errCh := make(chan error, 1)
+	errCh <- err
+	close(deltaCh)
+	close(errCh)
+	return deltaCh, errCh
+}
+
+// Collect runs a completion on p and returns the full response text. Tool
+// calls are not supported; any requested by the model are ignored.
+func Collect(ctx context.Context, p Provider, r Request) (string, error) {
+	deltaCh, errCh := p.Stream(ctx, r)
+	var out strings.Builder
+	for delta := range deltaCh {
+		out.WriteString(delta.Content)
+	}
+	if err := <-errCh; err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,82 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+// maxTranscriptBytes caps how much of each response a transcript keeps.
+const maxTranscriptBytes = 4 << 20
+
+// Exchange is one raw request to the ChatGPT backend and the response
+// events it streamed back, as sent and received.
+type Exchange struct {
+	Request   []byte // the JSON request body; credentials are sent as headers and not kept
+	Status    int
+	Response  []byte // the SSE stream, or the error body
+	Truncated bool   // the response was longer than the transcript keeps
+}
+
+// Transcript collects the raw exchanges made on behalf of a context, so a
+// reply can be reproduced later with ParseStream instead of a new request.
+// A turn that calls tools makes one exchange per round.
+type Transcript struct {
+	mu        sync.Mutex
+	exchanges []*exchangeBuf
+}
+
+type exchangeBuf struct {
+	Exchange
+	buf bytes.Buffer
+}
+
+type transcriptKey struct{}
+
+// WithTranscript returns a context whose ChatGPT backend requests are
+// recorded in t. Other providers are not recorded.
+func WithTranscript(ctx context.Context, t *Transcript) context.Context {
+	return context.WithValue(ctx, transcriptKey{}, t)
+}
+
+func transcriptFrom(ctx context.Context) *Transcript {
+	t, _ := ctx.Value(transcriptKey{}).(*Transcript)
+	return t
+}
+
+// record starts an exchange and returns a reader that copies what is read
+// from r into it.
+func (t *Transcript) record(request []byte, status int, r io.Reader) io.Reader {
+	x := &exchangeBuf{Exchange: Exchange{Request: request, Status: status}}
+	t.mu.Lock()
+	t.exchanges = append(t.exchanges, x)
+	t.mu.Unlock()
+	return io.TeeReader(r, writerFunc(func(p []byte) (int, error) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if room := maxTranscriptBytes - x.buf.Len(); len(p) > room {
+			x.buf.Write(p[:room])
+			x.Truncated = true
+		} else {
+			x.buf.Write(p)
+		}
+		return len(p), nil
+	}))
+}
+
+// Exchanges returns the exchanges recorded so far, oldest first.
+func (t *Transcript) Exchanges() []Exchange {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]Exchange, len(t.exchanges))
+	for i, x := range t.exchanges {
+		out[i] = x.Exchange
+		out[i].Response = bytes.Clone(x.buf.Bytes())
+	}
+	return out
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
@@ -0,0 +1,112 @@
+// Package codeblock finds fenced code blocks in Markdown replies.
+package codeblock
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Block is a fenced code block.
+type Block struct {
+	Index    int    `json:"index"`    // position among the reply's blocks, from 0
+	Language string `json:"language"` // from the info string; may be empty
+	Filename string `json:"filename"` // suggested name to save it as
+	Lines    int    `json:"lines"`
+	Code     string `json:"-"`
+}
+
+// extensions maps languages to file extensions for suggested filenames.
+var extensions = map[string]string{
+	"bash": "sh", "sh": "sh", "shell": "sh", "zsh": "sh",
+	"python": "py", "python3": "py", "py": "py",
+	"go": "go", "javascript": "js", "js": "js", "node": "js", "typescript": "ts", "ts": "ts",
+	"json": "json", "yaml": "yaml", "yml": "yaml", "toml": "toml", "ini": "ini",
+	"html": "html", "css": "css", "sql": "sql", "c": "c", "cpp": "cpp", "rust": "rs",
+	"dockerfile": "Dockerfile", "makefile": "Makefile", "systemd": "service", "nginx": "conf",
+}
+
+var (
+	fenceRe = regexp.MustCompile("^(\\s*)(```+|~~~+)\\s*(.*)$")
+	// nameRe matches a filename in the info string, either bare or as
+	// title=/file=/filename=.
+	nameRe = regexp.MustCompile(`^(?:(?:title|file|filename)=)?["']?([\w.-]+\.\w+|Dockerfile|Makefile)["']?$`)
+	// commentRe matches a first line naming the file, e.g. "# file: x.py"
+	// or "// main.go".
+	commentRe = regexp.MustCompile(`^(?:#|//|--|;|<!--)\s*(?:file(?:name)?:\s*)?([\w.-]+\.\w+)\s*(?:-->)?$`)
+)
+
+// Parse returns the fenced code blocks in text. An unterminated block at
+// the end is included.
+func Parse(text string) []Block {
+	var blocks []Block
+	var cur *Block
+	var fence string
+	var body []string
+	for line := range strings.SplitSeq(text, "\n") {
+		m := fenceRe.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if cur == nil {
+			if m == nil {
+				continue
+			}
+			cur = &Block{Index: len(blocks)}
+			fence = m[2]
+			info := strings.Fields(m[3])
+			for i, f := range info {
+				if i == 0 && !strings.Contains(f, "=") && !strings.Contains(f, ".") {
+					cur.Language = strings.ToLower(f)
+					continue
+				}
+				if n := nameRe.FindStringSubmatch(f); n != nil && cur.Filename == "" {
+					cur.Filename = path.Base(n[1])
+				}
+			}
+			body = body[:0]
+			continue
+		}
+		if m != nil && strings.HasPrefix(m[2], fence) && m[3] == "" {
+			blocks = append(blocks, finish(cur, body))
+			cur = nil
+			continue
+		}
+		body = append(body, line)
+	}
+	if cur != nil {
+		for len(body) > 0 && strings.TrimSpace(body[len(body)-1]) == "" {
+			body = body[:len(body)-1]
+		}
+		blocks = append(blocks, finish(cur, body))
+	}
+	return blocks
+}
+
+func finish(b *Block, body []string) Block {
+	b.Code = strings.Join(body, "\n")
+	if b.Code != "" {
+		b.Code += "\n"
+	}
+	b.Lines = len(body)
+	if b.Filename == "" && len(body) > 0 {
+		first := strings.TrimSpace(body[0])
+		if strings.HasPrefix(first, "#!") && len(body) > 1 {
+			first = strings.TrimSpace(body[1])
+		}
+		if m := commentRe.FindStringSubmatch(first); m != nil {
+			b.Filename = m[1]
+		}
+	}
+	if b.Filename == "" {
+		ext, ok := extensions[b.Language]
+		switch {
+		case !ok:
+			ext = "txt"
+		case ext == "Dockerfile" || ext == "Makefile":
+			b.Filename = ext
+		}
+		if b.Filename == "" {
+			b.Filename = fmt.Sprintf("snippet-%d.%s", b.Index+1, ext)
+		}
+	}
+	return *b
+}
@@ -0,0 +1,1541 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// File is the optional JSON configuration file. It holds structured
+// settings that do not fit on the command line; scalar settings remain
+// flags.
+type File struct {
+	Hooks       []Hook       `json:"hooks"`
+	EmailDigest *EmailDigest `json:"email_digest"`
+	// ApprovalPolicy maps approval kinds, such as "run_code" or "docker",
+	// to "ask" (the default), "allow" or "deny".
+	ApprovalPolicy map[string]string `json:"approval_policy"`
+	Kubernetes     *Kubernetes       `json:"kubernetes"`
+	LogWatch       *LogWatch         `json:"log_watch"`
+	QuietHours     *QuietHours       `json:"quiet_hours"`
+	Briefing       *Briefing         `json:"briefing"`
+	Lists          *Lists            `json:"lists"`
+	Auth           *Auth             `json:"auth"`
+	Redaction      *Redaction        `json:"redaction"`
+	Attachments    *Attachments      `json:"attachments"`
+	Power          *Power            `json:"power"`
+	Tunnel         *Tunnel           `json:"tunnel"`
+	TLS            *TLS              `json:"tls"`
+	Voice          *Voice            `json:"voice"`
+	Connectors     []Connector       `json:"connectors"`
+	Scripts        []Script          `json:"scripts"`
+	// PromptVariables names Home Assistant entities for system prompts,
+	// e.g. "temp.living_room": "sensor.living_room_temperature" makes
+	// {{temp.living_room}} show that sensor's current value.
+	PromptVariables map[string]string `json:"prompt_variables"`
+	// ContextTTLMinutes maps front ends, by the channel they send with
+	// chat requests (e.g. "voice", "telegram" or "web"; "fifo" for the
+	// FIFOs), to how long a conversation may be idle before its history
+	// stops being sent, so that yesterday's context does not color
+	// today's quick question. /continue brings it back. Channels not
+	// listed never expire.
+	ContextTTLMinutes map[string]int `json:"context_ttl_minutes"`
+	// AdminPIN authorizes temporarily lifting persona restrictions. Without
+	// it restrictions cannot be overridden.
+	AdminPIN string `json:"admin_pin"`
+	Profiles
+}
+
+// Profiles selects the system prompt, model and tools for a request from
+// its persona, user and channel.
+type Profiles struct {
+	// ModelTiers lists named model tiers from cheapest to most expensive.
+	ModelTiers []ModelTier `json:"model_tiers"`
+	Personas   []Persona   `json:"personas"`
+	Users      []User      `json:"users"`
+	// Variants are model and prompt combinations that can be compared
+	// side by side on the same input.
+	Variants []Variant `json:"variants"`
+	// ChannelTools limits the tools offered for requests from a front
+	// end, by the channel it sends (see ContextTTLMinutes), e.g. so that
+	// messages from Telegram cannot run shell commands.
+	ChannelTools map[string]ToolScope `json:"channel_tools"`
+}
+
+// ToolScope limits which tools may be used. Names may be path.Match
+// patterns, e.g. "ha_*".
+type ToolScope struct {
+	// Allow, if set, lists the only tools that may be used.
+	Allow []string `json:"allow"`
+	// Deny lists tools that may not be used, even if allowed.
+	Deny []string `json:"deny"`
+}
+
+// Permits reports whether the scope lets a tool be used.
+func (s *ToolScope) Permits(tool string) bool {
+	match := func(patterns []string) bool {
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, tool); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if len(s.Allow) > 0 && !match(s.Allow) {
+		return false
+	}
+	return !match(s.Deny)
+}
+
+func (s *ToolScope) validate(what string) error {
+	for _, list := range [][]string{s.Allow, s.Deny} {
+		for _, p := range list {
+			if _, err := path.Match(p, ""); err != nil || p == "" {
+				return fmt.Errorf("%s: invalid tool pattern %q", what, p)
+			}
+		}
+	}
+	return nil
+}
+
+// ModelTier names a model by cost class, e.g. "cheap" or "premium".
+type ModelTier struct {
+	Name  string `json:"name"`
+	Model string `json:"model"`
+}
+
+// Persona is a named assistant personality selected per request.
+type Persona struct {
+	Name string `json:"name"`
+	// SystemPrompt replaces the default system prompt.
+	SystemPrompt string `json:"system_prompt"`
+	// Tier is the default model tier for the persona.
+	Tier string `json:"tier"`
+	// MaxTier caps the tier a user override may select, so that e.g. the
+	// kids persona never runs on the premium model.
+	MaxTier string `json:"max_tier"`
+	// Restrictions limit when and how much the persona may be used, and
+	// what about, e.g. for the persona children talk to.
+	Restrictions *Restrictions `json:"restrictions"`
+	// Verbosity is one of Verbosities and sets how long the persona's
+	// replies are, e.g. "terse" for a voice assistant; empty is "normal".
+	Verbosity string `json:"verbosity"`
+	// MaxOutputTokens caps each reply, overriding the verbosity's cap;
+	// zero uses it.
+	MaxOutputTokens int `json:"max_output_tokens"`
+	// Tools limits the tools the persona may use, e.g. so that the kids
+	// persona cannot switch devices; by default it may use them all.
+	Tools *ToolScope `json:"tools"`
+}
+
+// Verbosities are the reply length presets, shortest first.
+var Verbosities = []string{"terse", "normal", "detailed"}
+
+// Restrictions are a persona's parental controls.
+type Restrictions struct {
+	// BlockedTopics are words or phrases, matched case-insensitively as
+	// whole words, that the persona refuses to discuss. The model is also
+	// told to steer clear of them.
+	BlockedTopics []string `json:"blocked_topics"`
+	// Windows are when the persona may be used, in local time; empty means
+	// any time.
+	Windows []Window `json:"windows"`
+	// DailyMessages and DailyTokens cap the persona's use per day; zero
+	// means no cap.
+	DailyMessages int `json:"daily_messages"`
+	DailyTokens   int `json:"daily_tokens"`
+}
+
+// User holds per-user defaults applied to that user's requests.
+type User struct {
+	Name string `json:"name"`
+	// Persona is used when a request names no persona.
+	Persona string `json:"persona"`
+	// Tier overrides the persona's tier, within its MaxTier.
+	Tier string `json:"tier"`
+	// Speech tells voice front ends how to hear and answer the user.
+	Speech *Speech `json:"speech"`
+}
+
+// Speech holds a user's voice settings, so that in a household speaking
+// several languages each speaker is recognized and answered in theirs.
+type Speech struct {
+	// Languages are BCP 47 tags of the languages the user speaks, most
+	// used first, given to speech recognition as hints.
+	Languages []string `json:"languages"`
+	// Voice names the text-to-speech voice replies are read in, e.g.
+	// "de_DE-thorsten-medium" for Piper.
+	Voice string `json:"voice"`
+	// Language is the language replies are read in, by default the first
+	// of Languages.
+	Language string `json:"language"`
+}
+
+// TTSLanguage returns the language replies are read in, or empty.
+func (s *Speech) TTSLanguage() string {
+	if s.Language != "" || len(s.Languages) == 0 {
+		return s.Language
+	}
+	return s.Languages[0]
+}
+
+// languageTag loosely matches a BCP 47 tag such as "en", "pt-BR" or
+// "zh-Hant-TW".
+var languageTag = regexp.MustCompile(`^[A-Za-z]{2,3}(?:-[A-Za-z0-9]{1,8})*$`)
+
+func (s *Speech) validate(what string) error {
+	for i, l := range s.Languages {
+		if !languageTag.MatchString(l) {
+			return fmt.Errorf("%s: speech.languages[%d]: %q is not a language tag such as en or pt-BR", what, i, l)
+		}
+	}
+	if s.Language != "" && !languageTag.MatchString(s.Language) {
+		return fmt.Errorf("%s: speech.language: %q is not a language tag such as en or pt-BR", what, s.Language)
+	}
+	return nil
+}
+
+// Variant is a named model and prompt combination for comparisons. It
+// starts from a persona (or the defaults) and overrides its model and
+// system prompt where set.
+type Variant struct {
+	Name         string `json:"name"`
+	Persona      string `json:"persona"`
+	Tier         string `json:"tier"`
+	Model        string `json:"model"` // overrides Tier
+	SystemPrompt string `json:"system_prompt"`
+}
+
+// Tier returns the index of a named tier in ModelTiers, or -1.
+func (f *Profiles) Tier(name string) int {
+	for i, t := range f.ModelTiers {
+		if t.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Persona returns the named persona.
+func (f *Profiles) Persona(name string) (Persona, bool) {
+	for _, p := range f.Personas {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Persona{}, false
+}
+
+// Variant returns the named variant.
+func (f *Profiles) Variant(name string) (Variant, bool) {
+	for _, v := range f.Variants {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return Variant{}, false
+}
+
+// User returns the named user.
+func (f *Profiles) User(name string) (User, bool) {
+	for _, u := range f.Users {
+		if strings.EqualFold(u.Name, name) {
+			return u, true
+		}
+	}
+	return User{}, false
+}
+
+// Speech returns the named user's voice settings, or nil.
+func (f *Profiles) Speech(user string) *Speech {
+	u, _ := f.User(user)
+	return u.Speech
+}
+
+// EmailDigest configures the read-only IMAP digest job. Mailboxes are
+// opened with EXAMINE and fetched with BODY.PEEK, so nothing is marked as
+// read or otherwise changed on the server.
+type EmailDigest struct {
+	// Server is the IMAPS host, optionally with a port (default 993).
+	Server   string `json:"server"`
+	Username string `json:"username"`
+	// Password is the account or app password. PasswordEnv names an
+	// environment variable to read it from instead.
+	Password    string `json:"password"`
+	PasswordEnv string `json:"password_env"`
+	// Schedule is when the briefing is sent, e.g. "daily 07:30".
+	Schedule string        `json:"schedule"`
+	Folders  []EmailFolder `json:"folders"`
+	// ConversationID, if set, also stores each briefing in a conversation
+	// so it can be discussed afterwards.
+	ConversationID string `json:"conversation_id"`
+	// RetentionDays is how long extracted text is kept after a digest
+	// (default 7).
+	RetentionDays int `json:"retention_days"`
+}
+
+// EmailFolder is a mailbox included in the digest.
+type EmailFolder struct {
+	Name string `json:"name"`
+	// MaxMessages caps how many unread messages are fetched per run,
+	// newest first (default 25).
+	MaxMessages int `json:"max_messages"`
+	// Instructions tell the summarizer how to treat this folder, e.g.
+	// "only mention invoices and payment reminders".
+	Instructions string `json:"instructions"`
+}
+
+// PasswordValue returns the configured password, resolving PasswordEnv.
+func (e *EmailDigest) PasswordValue() string {
+	if e.PasswordEnv != "" {
+		return os.Getenv(e.PasswordEnv)
+	}
+	return e.Password
+}
+
+// Briefing composes a morning message for each user from the weather,
+// their calendars and reminders, news feeds and the notifications that
+// came in overnight.
+type Briefing struct {
+	// Latitude and Longitude locate the weather forecast, from Open-Meteo.
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	// Calendars are iCalendar (.ics) URLs shared by every user. Their
+	// events fill the calendar section and their to-dos the reminders.
+	Calendars []string `json:"calendars"`
+	// Feeds are RSS or Atom URLs for the news section.
+	Feeds []string `json:"feeds"`
+	// TTSEntity is the Home Assistant text-to-speech entity, e.g.
+	// "tts.piper", that reads the spoken version on a user's media player.
+	TTSEntity string         `json:"tts_entity"`
+	Users     []BriefingUser `json:"users"`
+}
+
+// Briefing sections, in their default order.
+var BriefingSections = []string{"weather", "calendar", "reminders", "news", "notifications"}
+
+// BriefingUser is one user's briefing.
+type BriefingUser struct {
+	User string `json:"user"`
+	// Schedule is when the briefing is sent, e.g. "daily 07:00".
+	Schedule string `json:"schedule"`
+	// Sections lists the sections to include, in order (default all of
+	// BriefingSections).
+	Sections []string `json:"sections"`
+	// Calendars and Feeds are added to the shared ones for this user.
+	Calendars []string `json:"calendars"`
+	Feeds     []string `json:"feeds"`
+	// Instructions tell the composer about tone and emphasis, e.g. "keep
+	// it to five sentences".
+	Instructions string `json:"instructions"`
+	// ConversationID, if set, also stores each briefing in a conversation.
+	ConversationID string `json:"conversation_id"`
+	// MediaPlayer is a Home Assistant media player that reads the spoken
+	// version aloud, with the briefing's tts_entity.
+	MediaPlayer string `json:"media_player"`
+}
+
+func (b *Briefing) validate() error {
+	if len(b.Users) == 0 {
+		return errors.New("briefing: at least one user is required")
+	}
+	for i := range b.Users {
+		u := &b.Users[i]
+		if u.User == "" || u.Schedule == "" {
+			return fmt.Errorf("briefing.users[%d]: user and schedule are required", i)
+		}
+		if len(u.Sections) == 0 {
+			u.Sections = BriefingSections
+		}
+		for _, s := range u.Sections {
+			if !slices.Contains(BriefingSections, s) {
+				return fmt.Errorf("briefing for %s: unknown section %q, want one of %s", u.User, s, strings.Join(BriefingSections, ", "))
+			}
+		}
+		if u.MediaPlayer != "" && b.TTSEntity == "" {
+			return fmt.Errorf("briefing for %s: media_player needs briefing.tts_entity", u.User)
+		}
+	}
+	return nil
+}
+
+// Lists synchronizes the named lists kept by the list tools, such as the
+// shopping list, with outside services. Each list syncs with at most one.
+type Lists struct {
+	// HomeAssistant names the list mirrored to Home Assistant's shopping
+	// list, e.g. "shopping". It needs -ha-url.
+	HomeAssistant string   `json:"home_assistant"`
+	Todoist       *Todoist `json:"todoist"`
+}
+
+// Todoist mirrors lists to Todoist projects.
+type Todoist struct {
+	// Token is a Todoist API token. TokenEnv names an environment variable
+	// to read it from instead.
+	Token    string `json:"token"`
+	TokenEnv string `json:"token_env"`
+	// Projects maps list names to the IDs of the projects they mirror.
+	Projects map[string]string `json:"projects"`
+}
+
+// TokenValue returns the API token, resolving TokenEnv.
+func (t *Todoist) TokenValue() string {
+	if t.TokenEnv != "" {
+		return os.Getenv(t.TokenEnv)
+	}
+	return t.Token
+}
+
+func (l *Lists) validate() error {
+	if t := l.Todoist; t != nil {
+		if t.TokenValue() == "" {
+			return errors.New("lists.todoist: token or token_env is required")
+		}
+		if len(t.Projects) == 0 {
+			return errors.New("lists.todoist: projects is required")
+		}
+		for list := range t.Projects {
+			if strings.EqualFold(list, l.HomeAssistant) {
+				return fmt.Errorf("lists: %q cannot sync with both Home Assistant and Todoist", list)
+			}
+		}
+	}
+	return nil
+}
+
+// Auth requires browsers to log in before using the HTTP API, with a
+// local password, an OpenID Connect provider, or a user name a trusted
+// reverse proxy vouches for. Requests on the Unix socket are not asked.
+type Auth struct {
+	Users []AuthUser `json:"users"`
+	OIDC  *OIDC      `json:"oidc"`
+	// ProxyHeader names the header an SSO proxy such as Authelia or
+	// oauth2-proxy sets to the logged-in user, e.g. "Remote-User". It is
+	// only believed from TrustedProxies.
+	ProxyHeader    string   `json:"proxy_header"`
+	TrustedProxies []string `json:"trusted_proxies"`
+	// SessionHours is how long a login lasts (default 720, 30 days).
+	SessionHours int `json:"session_hours"`
+}
+
+// AuthUser is a local login. PasswordHash is made with
+// "pi-agent hash-password".
+type AuthUser struct {
+	Name         string `json:"name"`
+	PasswordHash string `json:"password_hash"`
+}
+
+// OIDC configures login with an OpenID Connect provider such as
+// Authelia, Keycloak or Google.
+type OIDC struct {
+	// Issuer is the provider's issuer URL; its discovery document is at
+	// <issuer>/.well-known/openid-configuration.
+	Issuer       string `json:"issuer"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	// ClientSecretEnv names an environment variable to read the secret
+	// from instead.
+	ClientSecretEnv string `json:"client_secret_env"`
+	// RedirectURL is this server's callback as registered with the
+	// provider, ending in /auth/oidc/callback.
+	RedirectURL string `json:"redirect_url"`
+	// UserClaim is the ID token claim used as the user name (default
+	// "preferred_username", falling back to "email").
+	UserClaim string `json:"user_claim"`
+	// AllowedUsers, if set, limits who may log in.
+	AllowedUsers []string `json:"allowed_users"`
+}
+
+// ClientSecretValue returns the client secret, from the environment if
+// ClientSecretEnv is set.
+func (o *OIDC) ClientSecretValue() string {
+	if o.ClientSecretEnv != "" {
+		return os.Getenv(o.ClientSecretEnv)
+	}
+	return o.ClientSecret
+}
+
+func (a *Auth) validate() error {
+	if len(a.Users) == 0 && a.OIDC == nil && a.ProxyHeader == "" {
+		return errors.New("auth: configure users, oidc or proxy_header")
+	}
+	seen := make(map[string]bool)
+	for i, u := range a.Users {
+		if u.Name == "" || seen[strings.ToLower(u.Name)] {
+			return fmt.Errorf("auth.users[%d]: a unique name is required", i)
+		}
+		seen[strings.ToLower(u.Name)] = true
+		if !strings.HasPrefix(u.PasswordHash, "$2") && !strings.HasPrefix(u.PasswordHash, "pbkdf2-sha256$") {
+			return fmt.Errorf("auth user %q: password_hash must come from \"pi-agent hash-password\"", u.Name)
+		}
+	}
+	if o := a.OIDC; o != nil {
+		if o.Issuer == "" || o.ClientID == "" || o.RedirectURL == "" {
+			return errors.New("auth.oidc: issuer, client_id and redirect_url are required")
+		}
+		if !strings.HasSuffix(o.RedirectURL, "/auth/oidc/callback") {
+			return errors.New("auth.oidc.redirect_url must end in /auth/oidc/callback")
+		}
+		if o.UserClaim == "" {
+			o.UserClaim = "preferred_username"
+		}
+	}
+	if a.ProxyHeader != "" && len(a.TrustedProxies) == 0 {
+		return errors.New("auth: proxy_header needs trusted_proxies")
+	}
+	if a.SessionHours <= 0 {
+		a.SessionHours = 720
+	}
+	return nil
+}
+
+// Redaction enables the scrubber that replaces secrets in messages and
+// tool outputs sent to cloud providers with placeholders, filling the
+// values back in locally. Built-in rules find common API keys, private
+// keys, passwords and card numbers.
+type Redaction struct {
+	Rules []RedactionRule `json:"rules"`
+	// Entropy is the randomness, in bits per character, above which a
+	// long token mixing upper and lower case letters and digits is taken
+	// for a secret (default DefaultRedactionEntropy); negative disables
+	// the check.
+	Entropy float64 `json:"entropy"`
+	// NoBuiltins leaves only Rules and the entropy check.
+	NoBuiltins bool `json:"no_builtins"`
+}
+
+// DefaultRedactionEntropy is the Redaction.Entropy used when none is set.
+const DefaultRedactionEntropy = 4.0
+
+// RedactionRule is an extra pattern of secrets.
+type RedactionRule struct {
+	// Name labels the placeholders, e.g. "badge" gives [REDACTED_BADGE_1].
+	Name string `json:"name"`
+	// Pattern is a regular expression. If it has groups only the first
+	// that matched is replaced, e.g. the digits of `door code:? (\d+)`.
+	Pattern string `json:"pattern"`
+}
+
+var redactionName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+func (r *Redaction) validate() error {
+	for i, rule := range r.Rules {
+		if !redactionName.MatchString(rule.Name) {
+			return fmt.Errorf("redaction.rules[%d]: name must be lower case letters, digits and underscores, got %q", i, rule.Name)
+		}
+		if _, err := regexp.Compile(rule.Pattern); err != nil || rule.Pattern == "" {
+			return fmt.Errorf("redaction.rules[%d]: invalid pattern %q", i, rule.Pattern)
+		}
+	}
+	if r.Entropy == 0 {
+		r.Entropy = DefaultRedactionEntropy
+	}
+	return nil
+}
+
+// Attachments limits the storage of uploaded images, recordings and
+// files. Sizes are in megabytes; zero is unlimited.
+type Attachments struct {
+	QuotaMB     int `json:"quota_mb"`      // all users together
+	UserQuotaMB int `json:"user_quota_mb"` // each user, unless in UserQuotas
+	// UserQuotas overrides UserQuotaMB for named users.
+	UserQuotas map[string]int `json:"user_quotas_mb"`
+	MaxFileMB  int            `json:"max_file_mb"` // default 25
+	// GCSchedule is when attachments no message refers to are deleted
+	// (default "daily 04:00"), once they are GCGraceHours old (default
+	// 24), which leaves time to send a message with an upload.
+	GCSchedule   string `json:"gc_schedule"`
+	GCGraceHours int    `json:"gc_grace_hours"`
+}
+
+// DefaultAttachments are the limits used without an attachments section.
+var DefaultAttachments = Attachments{MaxFileMB: 25, GCSchedule: "daily 04:00", GCGraceHours: 24}
+
+// UserQuota returns a user's quota in megabytes; zero is unlimited.
+func (a *Attachments) UserQuota(user string) int {
+	for name, mb := range a.UserQuotas {
+		if strings.EqualFold(name, user) {
+			return mb
+		}
+	}
+	return a.UserQuotaMB
+}
+
+func (a *Attachments) validate() error {
+	if a.QuotaMB < 0 || a.UserQuotaMB < 0 || a.MaxFileMB < 0 || a.GCGraceHours < 0 {
+		return errors.New("attachments: sizes and hours must not be negative")
+	}
+	for name, mb := range a.UserQuotas {
+		if mb < 0 {
+			return fmt.Errorf("attachments.user_quotas_mb %q: must not be negative", name)
+		}
+	}
+	if a.MaxFileMB == 0 {
+		a.MaxFileMB = DefaultAttachments.MaxFileMB
+	}
+	if a.GCSchedule == "" {
+		a.GCSchedule = DefaultAttachments.GCSchedule
+	}
+	if a.GCGraceHours == 0 {
+		a.GCGraceHours = DefaultAttachments.GCGraceHours
+	}
+	return nil
+}
+
+// Power connects to the UPS keeping the Pi running through outages: a
+// NUT server, a PiSugar HAT through its power manager, or a HAT with a
+// kernel driver under /sys/class/power_supply.
+type Power struct {
+	Source string `json:"source"` // "nut", "pisugar" or "sysfs"
+	// Address is the NUT server (default localhost:3493) or the PiSugar
+	// power manager (default 127.0.0.1:8423).
+	Address string `json:"address"`
+	// UPS is the NUT UPS name (default "ups"). Username and PasswordEnv,
+	// the variable holding the password, log in if the server requires it.
+	UPS         string `json:"ups"`
+	Username    string `json:"username"`
+	PasswordEnv string `json:"password_env"`
+	// Supply is the sysfs power supply, e.g. "battery"; by default the
+	// first battery or UPS found.
+	Supply      string `json:"supply"`
+	PollSeconds int    `json:"poll_seconds"` // default 30
+	// LowPowerFactor is how many times less often meters and presence
+	// are polled on battery (default 4). Scheduled jobs are skipped.
+	LowPowerFactor int `json:"low_power_factor"`
+	// LowBattery is the charge in percent that draws an urgent warning
+	// (default 20).
+	LowBattery float64 `json:"low_battery"`
+}
+
+// Tunnel exposes the agent off the LAN through an SSH reverse tunnel to a
+// server with a public address, so that no port has to be forwarded to
+// the Pi. The system ssh client keeps it open; it needs a key the server
+// accepts and the server's host key in known_hosts.
+type Tunnel struct {
+	// SSH is the server as user@host, or user@host:port for another port
+	// than 22.
+	SSH string `json:"ssh"`
+	// RemotePort is the port on the server forwarded to the agent's -addr,
+	// by default the same port. Unless the server allows GatewayPorts it
+	// listens on the server's loopback, for a reverse proxy there.
+	RemotePort int `json:"remote_port"`
+	// IdentityFile is the private key to log in with; by default ssh's.
+	IdentityFile string `json:"identity_file"`
+	// KnownHosts is the file holding the server's host key; by default
+	// ssh's. Unknown host keys are refused.
+	KnownHosts string `json:"known_hosts"`
+}
+
+func (t *Tunnel) validate() error {
+	user, host, ok := strings.Cut(t.SSH, "@")
+	if !ok || user == "" || host == "" {
+		return fmt.Errorf("tunnel.ssh: want user@host or user@host:port, got %q", t.SSH)
+	}
+	if t.RemotePort < 0 || t.RemotePort > 65535 {
+		return errors.New("tunnel.remote_port: must be a port number")
+	}
+	return nil
+}
+
+// TLS serves -addr over HTTPS with certificates from an ACME CA such as
+// Let's Encrypt. Domains are proven with DNS-01 challenges, so a private
+// LAN hostname the CA cannot reach still gets a certificate browsers
+// trust, as the PWA and Web Push need.
+type TLS struct {
+	// Domains are the names the certificate covers, e.g.
+	// ["pi.home.example.com"]; they need public DNS zones.
+	Domains []string `json:"domains"`
+	// Email is the contact the CA sends expiry warnings to; optional.
+	Email string `json:"email"`
+	// DirectoryURL is the CA's ACME directory, by default Let's Encrypt's.
+	DirectoryURL string `json:"directory_url"`
+	// DNS publishes the challenge TXT records.
+	DNS DNSProvider `json:"dns"`
+	// PropagationSeconds is how long to wait for a record to be served
+	// before asking the CA to check it (default 60).
+	PropagationSeconds int `json:"propagation_seconds"`
+}
+
+// DNSProvider publishes ACME challenge TXT records.
+type DNSProvider struct {
+	// Provider is "cloudflare", "duckdns" or "exec".
+	Provider string `json:"provider"`
+	// TokenEnv names the environment variable holding the Cloudflare
+	// API token (with Zone.DNS edit permission) or the DuckDNS token.
+	TokenEnv string `json:"token_env"`
+	// Command is the exec provider's program and arguments. It is run
+	// with "present" or "cleanup", the record's name and its value
+	// appended, e.g. ["/etc/pi-agent/dns-hook.sh"].
+	Command []string `json:"command"`
+}
+
+// Default ACME settings.
+const (
+	DefaultACMEDirectory  = "https://acme-v02.api.letsencrypt.org/directory"
+	DefaultDNSPropagation = 60
+)
+
+// TokenValue returns the provider's API token from TokenEnv.
+func (d *DNSProvider) TokenValue() string {
+	if d.TokenEnv == "" {
+		return ""
+	}
+	return os.Getenv(d.TokenEnv)
+}
+
+func (t *TLS) validate() error {
+	if len(t.Domains) == 0 {
+		return errors.New("tls.domains: at least one domain is required")
+	}
+	for i, d := range t.Domains {
+		if d == "" || strings.ContainsAny(d, " /:") {
+			return fmt.Errorf("tls.domains[%d]: invalid domain %q", i, d)
+		}
+	}
+	switch t.DNS.Provider {
+	case "cloudflare", "duckdns":
+		if t.DNS.TokenEnv == "" {
+			return fmt.Errorf("tls.dns: token_env is required for %s", t.DNS.Provider)
+		}
+	case "exec":
+		if len(t.DNS.Command) == 0 || t.DNS.Command[0] == "" {
+			return errors.New("tls.dns: command is required for exec")
+		}
+	default:
+		return fmt.Errorf("tls.dns.provider: want cloudflare, duckdns or exec, got %q", t.DNS.Provider)
+	}
+	if t.PropagationSeconds < 0 {
+		return errors.New("tls.propagation_seconds: must not be negative")
+	}
+	if t.DirectoryURL == "" {
+		t.DirectoryURL = DefaultACMEDirectory
+	}
+	if t.PropagationSeconds == 0 {
+		t.PropagationSeconds = DefaultDNSPropagation
+	}
+	return nil
+}
+
+// Voice chooses the speech recognition and synthesis behind the /speech
+// endpoints. Each is a list of providers tried in order, so that e.g. a
+// cloud recognizer can fall back to a local one.
+type Voice struct {
+	STT []SpeechProvider `json:"stt"`
+	TTS []SpeechProvider `json:"tts"`
+}
+
+// SpeechProvider is one speech recognizer or synthesizer.
+type SpeechProvider struct {
+	// Provider is "whisper.cpp", "vosk" or "openai" for recognition, and
+	// "piper", "espeak" or "openai" for synthesis.
+	Provider string `json:"provider"`
+	// Command is the program run, and any arguments put before the
+	// provider's own; by default whisper-cli, vosk-transcriber, piper or
+	// espeak-ng.
+	Command []string `json:"command"`
+	// URL is a whisper.cpp server to send audio to instead of running
+	// Command, e.g. "http://localhost:8081".
+	URL string `json:"url"`
+	// Model is the whisper.cpp ggml model file, the Vosk model directory,
+	// the default Piper voice file or the OpenAI model name.
+	Model string `json:"model"`
+	// VoicesDir holds Piper voices as <voice>.onnx, so that users'
+	// speech.voice can choose one.
+	VoicesDir string `json:"voices_dir"`
+	// Voice is the voice replies are read in when the user has none, for
+	// espeak and openai.
+	Voice string `json:"voice"`
+	// APIKeyEnv names the environment variable holding the OpenAI API key
+	// (default OPENAI_API_KEY).
+	APIKeyEnv string `json:"api_key_env"`
+}
+
+// APIKey returns the OpenAI API key from APIKeyEnv.
+func (p *SpeechProvider) APIKey() string {
+	if p.APIKeyEnv == "" {
+		return os.Getenv("OPENAI_API_KEY")
+	}
+	return os.Getenv(p.APIKeyEnv)
+}
+
+func (v *Voice) validate() error {
+	if len(v.STT) == 0 && len(v.TTS) == 0 {
+		return errors.New("voice: stt or tts is required")
+	}
+	for i, p := range v.STT {
+		switch p.Provider {
+		case "whisper.cpp":
+			if p.URL == "" && p.Model == "" {
+				return fmt.Errorf("voice.stt[%d]: model or url is required for whisper.cpp", i)
+			}
+		case "vosk", "openai":
+		default:
+			return fmt.Errorf("voice.stt[%d].provider: want whisper.cpp, vosk or openai, got %q", i, p.Provider)
+		}
+	}
+	for i, p := range v.TTS {
+		switch p.Provider {
+		case "piper":
+			if p.Model == "" && p.VoicesDir == "" {
+				return fmt.Errorf("voice.tts[%d]: model or voices_dir is required for piper", i)
+			}
+		case "espeak", "openai":
+		default:
+			return fmt.Errorf("voice.tts[%d].provider: want piper, espeak or openai, got %q", i, p.Provider)
+		}
+	}
+	return nil
+}
+
+// Default power settings.
+const (
+	DefaultPowerPoll      = 30
+	DefaultLowPowerFactor = 4
+	DefaultLowBattery     = 20.0
+	DefaultNUTAddress     = "localhost:3493"
+	DefaultPiSugarAddress = "127.0.0.1:8423"
+)
+
+// PasswordValue returns the NUT password from PasswordEnv.
+func (p *Power) PasswordValue() string {
+	if p.PasswordEnv == "" {
+		return ""
+	}
+	return os.Getenv(p.PasswordEnv)
+}
+
+func (p *Power) validate() error {
+	switch p.Source {
+	case "nut":
+		if p.Address == "" {
+			p.Address = DefaultNUTAddress
+		}
+		if p.UPS == "" {
+			p.UPS = "ups"
+		}
+	case "pisugar":
+		if p.Address == "" {
+			p.Address = DefaultPiSugarAddress
+		}
+	case "sysfs":
+	default:
+		return fmt.Errorf("power.source: want nut, pisugar or sysfs, got %q", p.Source)
+	}
+	if p.PollSeconds < 0 || p.LowPowerFactor < 0 || p.LowBattery < 0 || p.LowBattery > 100 {
+		return errors.New("power: poll_seconds, low_power_factor and low_battery must be positive, low_battery at most 100")
+	}
+	if p.PollSeconds == 0 {
+		p.PollSeconds = DefaultPowerPoll
+	}
+	if p.LowPowerFactor == 0 {
+		p.LowPowerFactor = DefaultLowPowerFactor
+	}
+	if p.LowBattery == 0 {
+		p.LowBattery = DefaultLowBattery
+	}
+	return nil
+}
+
+// Connector appends each completed exchange to an outside service, for
+// life logs kept off the Pi: a row of a Google Sheet, a page in a Notion
+// database or an Airtable record. Private conversations are never sent.
+type Connector struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"` // "google_sheets", "notion" or "airtable"
+	// Token is the Notion integration token or Airtable personal access
+	// token. TokenEnv names an environment variable to read it from
+	// instead.
+	Token    string `json:"token"`
+	TokenEnv string `json:"token_env"`
+	// CredentialsFile is the JSON key of the Google service account the
+	// spreadsheet is shared with.
+	CredentialsFile string `json:"credentials_file"`
+	// SpreadsheetID and Sheet, by default the first one, select the
+	// Google Sheet rows are appended to.
+	SpreadsheetID string `json:"spreadsheet_id"`
+	Sheet         string `json:"sheet"`
+	// DatabaseID is the Notion database pages are added to.
+	DatabaseID string `json:"database_id"`
+	// BaseID and Table, a name or ID, are the Airtable table.
+	BaseID string `json:"base_id"`
+	Table  string `json:"table"`
+	// Conversations limits the connector to these conversations; by
+	// default it gets them all.
+	Conversations []string `json:"conversations"`
+	// Fields map an exchange to columns, in order, properties or
+	// fields. Values are text/templates over .ConversationID, .Prompt,
+	// .Reply and .Time, e.g. {{.Time.Format "2006-01-02 15:04"}}. The
+	// default is Time, Prompt and Reply; Notion needs them spelled out,
+	// with the property types.
+	Fields []ConnectorField `json:"fields"`
+}
+
+// ConnectorField is one column, property or field written by a
+// connector.
+type ConnectorField struct {
+	Name  string `json:"name"` // the header, unused for Google Sheets
+	Value string `json:"value"`
+	// Type is the Notion property type: "title", "rich_text" (the
+	// default), "date", "select", "number" or "url".
+	Type string `json:"type"`
+}
+
+// DefaultConnectorFields are written when a connector names none.
+var DefaultConnectorFields = []ConnectorField{
+	{Name: "Time", Value: `{{.Time.Format "2006-01-02 15:04:05"}}`},
+	{Name: "Prompt", Value: "{{.Prompt}}"},
+	{Name: "Reply", Value: "{{.Reply}}"},
+}
+
+// TokenValue returns the API token, resolving TokenEnv.
+func (c *Connector) TokenValue() string {
+	if c.TokenEnv != "" {
+		return os.Getenv(c.TokenEnv)
+	}
+	return c.Token
+}
+
+func (c *Connector) validate() error {
+	what := fmt.Sprintf("connector %q", c.Name)
+	switch c.Kind {
+	case "google_sheets":
+		if c.CredentialsFile == "" || c.SpreadsheetID == "" {
+			return errors.New(what + ": credentials_file and spreadsheet_id are required")
+		}
+	case "notion":
+		if c.DatabaseID == "" {
+			return errors.New(what + ": database_id is required")
+		}
+		if len(c.Fields) == 0 {
+			return errors.New(what + ": fields are required, naming the database's properties")
+		}
+	case "airtable":
+		if c.BaseID == "" || c.Table == "" {
+			return errors.New(what + ": base_id and table are required")
+		}
+	default:
+		return fmt.Errorf("%s: kind: want google_sheets, notion or airtable, got %q", what, c.Kind)
+	}
+	if c.Kind != "google_sheets" && c.TokenValue() == "" {
+		return errors.New(what + ": token or token_env is required")
+	}
+	if len(c.Fields) == 0 {
+		c.Fields = DefaultConnectorFields
+	}
+	for i, f := range c.Fields {
+		if f.Name == "" && c.Kind != "google_sheets" {
+			return fmt.Errorf("%s: fields[%d]: name is required", what, i)
+		}
+		if _, err := template.New(f.Name).Option("missingkey=zero").Parse(f.Value); err != nil {
+			return fmt.Errorf("%s: fields[%d]: %w", what, i, err)
+		}
+		switch f.Type {
+		case "":
+		case "title", "rich_text", "date", "select", "number", "url":
+			if c.Kind != "notion" {
+				return fmt.Errorf("%s: fields[%d]: type is only used by Notion", what, i)
+			}
+		default:
+			return fmt.Errorf("%s: fields[%d]: unknown Notion property type %q", what, i, f.Type)
+		}
+	}
+	return nil
+}
+
+// Script runs a user program at a hook point of every turn, so requests
+// and replies can be inspected or changed without recompiling. The
+// program gets the hook's JSON on stdin and may print a JSON object with
+// the fields it changes; see package scripts.
+type Script struct {
+	Name string `json:"name"`
+	// Hook is "before_prompt", "after_response" or "tool_call".
+	Hook string `json:"hook"`
+	// Command is the program and its arguments, e.g.
+	// ["lua", "/etc/pi-agent/hooks/filter.lua"].
+	Command []string `json:"command"`
+	// TimeoutSeconds bounds each run (default 5).
+	TimeoutSeconds int `json:"timeout_seconds"`
+	// Tools limits a tool_call script to these tools; by default it sees
+	// every call.
+	Tools []string `json:"tools"`
+}
+
+// DefaultScriptTimeout is how long a script may run, in seconds.
+const DefaultScriptTimeout = 5
+
+func (s *Script) validate() error {
+	what := fmt.Sprintf("script %q", s.Name)
+	switch s.Hook {
+	case "before_prompt", "after_response", "tool_call":
+	default:
+		return fmt.Errorf("%s: hook: want before_prompt, after_response or tool_call, got %q", what, s.Hook)
+	}
+	if len(s.Command) == 0 || s.Command[0] == "" {
+		return errors.New(what + ": command is required")
+	}
+	if len(s.Tools) > 0 && s.Hook != "tool_call" {
+		return errors.New(what + ": tools only applies to the tool_call hook")
+	}
+	if s.TimeoutSeconds < 0 {
+		return errors.New(what + ": timeout_seconds must be positive")
+	}
+	if s.TimeoutSeconds == 0 {
+		s.TimeoutSeconds = DefaultScriptTimeout
+	}
+	return nil
+}
+
+// Kubernetes enables the read-only cluster tools.
+type Kubernetes struct {
+	// Kubeconfig is the kubeconfig file used to reach the cluster
+	// (default /etc/rancher/k3s/k3s.yaml, where k3s writes it).
+	Kubeconfig string `json:"kubeconfig"`
+	// Context selects a context from the kubeconfig other than its
+	// current one.
+	Context string `json:"context"`
+	// Namespace is used when a question names none (default "default").
+	Namespace string `json:"namespace"`
+}
+
+// LogWatch configures the log watcher, which alerts on lines matching
+// rules and periodically has the model summarize new errors.
+type LogWatch struct {
+	Sources []LogSource `json:"sources"`
+	// ErrorPattern selects the lines collected for summaries (default
+	// matches error, fail, fatal, panic and critical).
+	ErrorPattern string `json:"error_pattern"`
+	// SummarySchedule is when collected errors are summarized, e.g.
+	// "daily 08:00"; empty disables summaries.
+	SummarySchedule string `json:"summary_schedule"`
+}
+
+// DefaultErrorPattern is the LogWatch.ErrorPattern used when none is set.
+const DefaultErrorPattern = `(?i)\b(error|fail(ed|ure)?|fatal|panic|critical)\b`
+
+// LogSource is a log file or journald unit to watch.
+type LogSource struct {
+	Name string `json:"name"`
+	// Path is a file to tail. Unit is a systemd unit read from journald
+	// instead; exactly one must be set.
+	Path  string    `json:"path"`
+	Unit  string    `json:"unit"`
+	Rules []LogRule `json:"rules"`
+}
+
+// LogRule sends a notification as soon as a line matches.
+type LogRule struct {
+	// Pattern is a regular expression matched against each line.
+	Pattern string `json:"pattern"`
+	// Title is the notification title (default "<source> log alert").
+	Title string `json:"title"`
+	// Priority is "low", "default", "high" (the default) or "urgent".
+	Priority string `json:"priority"`
+	// CooldownMinutes suppresses repeat alerts from the rule (default 30).
+	CooldownMinutes int `json:"cooldown_minutes"`
+}
+
+// QuietHours holds back sounds, notifications and digests during set
+// windows, letting only messages urgent enough through.
+type QuietHours struct {
+	Windows []Window `json:"windows"`
+	// Channels maps "audio" (earcons), "notify" (notifications) and
+	// "digest" (scheduled digests and reports) to the lowest priority
+	// still delivered while quiet: "low", "default", "high", "urgent" or
+	// "none". The defaults are "high", "urgent" and "none". Notifications
+	// held back are sent when the quiet hours end, and digests run then.
+	Channels map[string]string `json:"channels"`
+	// Users replace the windows, and override channels, for messages
+	// addressed to them.
+	Users []QuietUser `json:"users"`
+	// Timezone is the IANA zone the windows are in (default local time).
+	Timezone string `json:"timezone"`
+}
+
+// Window is a daily period, e.g. from "22:30" to "07:00". One that ends
+// before it starts runs past midnight into the next day.
+type Window struct {
+	// Days the window starts on, as "mon" to "sun"; empty means every day.
+	Days  []string `json:"days"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+}
+
+// QuietUser is one user's quiet hours.
+type QuietUser struct {
+	User     string            `json:"user"`
+	Windows  []Window          `json:"windows"`
+	Channels map[string]string `json:"channels"`
+}
+
+// QuietChannels are the channels quiet hours apply to.
+var QuietChannels = []string{"audio", "notify", "digest"}
+
+// ClockMinutes parses a time of day such as "07:30" as minutes after
+// midnight.
+func ClockMinutes(s string) (int, error) {
+	var h, m int
+	if n, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || n != 2 || h < 0 || h > 24 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("invalid time of day %q, want HH:MM", s)
+	}
+	return h*60 + m, nil
+}
+
+func (q *QuietHours) validate() error {
+	if q.Timezone != "" {
+		if _, err := time.LoadLocation(q.Timezone); err != nil {
+			return fmt.Errorf("quiet_hours.timezone: %w", err)
+		}
+	}
+	if err := validateQuiet("quiet_hours", q.Windows, q.Channels); err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for i, u := range q.Users {
+		if u.User == "" || seen[u.User] {
+			return fmt.Errorf("quiet_hours.users[%d]: a unique user is required", i)
+		}
+		seen[u.User] = true
+		if err := validateQuiet(fmt.Sprintf("quiet_hours user %q", u.User), u.Windows, u.Channels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateQuiet(what string, windows []Window, channels map[string]string) error {
+	if err := validateWindows(what, windows); err != nil {
+		return err
+	}
+	for ch, level := range channels {
+		if !slices.Contains(QuietChannels, ch) {
+			return fmt.Errorf("%s: unknown channel %q, want audio, notify or digest", what, ch)
+		}
+		switch level {
+		case "low", "default", "high", "urgent", "none":
+		default:
+			return fmt.Errorf("%s: channel %q: unknown level %q", what, ch, level)
+		}
+	}
+	return nil
+}
+
+func validateWindows(what string, windows []Window) error {
+	for i, w := range windows {
+		start, err := ClockMinutes(w.Start)
+		if err != nil {
+			return fmt.Errorf("%s: windows[%d].start: %w", what, i, err)
+		}
+		end, err := ClockMinutes(w.End)
+		if err != nil {
+			return fmt.Errorf("%s: windows[%d].end: %w", what, i, err)
+		}
+		if start == end {
+			return fmt.Errorf("%s: windows[%d]: start and end are the same", what, i)
+		}
+		for _, d := range w.Days {
+			if _, ok := weekdays[strings.ToLower(d)]; !ok {
+				return fmt.Errorf("%s: windows[%d]: unknown day %q", what, i, d)
+			}
+		}
+	}
+	return nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Weekday parses a day name such as "mon".
+func Weekday(s string) (time.Weekday, bool) {
+	d, ok := weekdays[strings.ToLower(s)]
+	return d, ok
+}
+
+// Hook is an inbound webhook served at POST /hooks/{name}.
+type Hook struct {
+	Name string `json:"name"`
+	// Secret authenticates callers, either verbatim in the X-Hook-Secret
+	// header (or ?secret=) or as the key of an X-Hub-Signature-256 HMAC.
+	Secret string `json:"secret"`
+	// Template is a text/template rendering the JSON payload into the
+	// prompt, e.g. "CI failed on {{.repository.name}}: {{.message}}".
+	// When empty the raw payload is used.
+	Template string `json:"template"`
+	// ConversationID is the conversation the prompt is sent to.
+	ConversationID string `json:"conversation_id"`
+	// Notify sends the agent's reply as a notification as well.
+	Notify bool `json:"notify"`
+	// Persona optionally selects the persona that handles the prompt.
+	Persona string `json:"persona"`
+}
+
+// Load reads the configuration file at path. A missing file yields an
+// empty configuration.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &File{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+	var f File
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	if err := f.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return &f, nil
+}
+
+// variableName matches prompt variable names, dotted identifiers such as
+// temp.living_room.
+var variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z0-9_]+)*$`)
+
+func (f *File) validate() error {
+	seen := make(map[string]bool)
+	for i, h := range f.Hooks {
+		if h.Name == "" {
+			return fmt.Errorf("hooks[%d]: name is required", i)
+		}
+		if seen[h.Name] {
+			return fmt.Errorf("hooks[%d]: duplicate name %q", i, h.Name)
+		}
+		seen[h.Name] = true
+		if h.Secret == "" {
+			return fmt.Errorf("hook %q: secret is required", h.Name)
+		}
+		if h.ConversationID == "" {
+			return fmt.Errorf("hook %q: conversation_id is required", h.Name)
+		}
+		if _, err := h.template(); err != nil {
+			return fmt.Errorf("hook %q: %w", h.Name, err)
+		}
+		if _, ok := f.Persona(h.Persona); h.Persona != "" && !ok {
+			return fmt.Errorf("hook %q: unknown persona %q", h.Name, h.Persona)
+		}
+	}
+	if err := f.Profiles.validate(); err != nil {
+		return err
+	}
+	for channel, minutes := range f.ContextTTLMinutes {
+		if channel == "" || minutes < 0 {
+			return fmt.Errorf("context_ttl_minutes: %q: channel names are required and minutes must not be negative", channel)
+		}
+	}
+	if e := f.EmailDigest; e != nil {
+		if e.Server == "" || e.Username == "" {
+			return errors.New("email_digest: server and username are required")
+		}
+		if e.PasswordValue() == "" {
+			return errors.New("email_digest: password or password_env is required")
+		}
+		if e.Schedule == "" {
+			return errors.New("email_digest: schedule is required")
+		}
+		if len(e.Folders) == 0 {
+			e.Folders = []EmailFolder{{Name: "INBOX"}}
+		}
+		for i, folder := range e.Folders {
+			if folder.Name == "" {
+				return fmt.Errorf("email_digest.folders[%d]: name is required", i)
+			}
+			if folder.MaxMessages <= 0 {
+				e.Folders[i].MaxMessages = 25
+			}
+		}
+		if e.RetentionDays <= 0 {
+			e.RetentionDays = 7
+		}
+	}
+	if k := f.Kubernetes; k != nil {
+		if k.Kubeconfig == "" {
+			k.Kubeconfig = "/etc/rancher/k3s/k3s.yaml"
+		}
+		if k.Namespace == "" {
+			k.Namespace = "default"
+		}
+	}
+	if lw := f.LogWatch; lw != nil {
+		if err := lw.validate(); err != nil {
+			return err
+		}
+	}
+	if l := f.Lists; l != nil {
+		if err := l.validate(); err != nil {
+			return err
+		}
+	}
+	if b := f.Briefing; b != nil {
+		if err := b.validate(); err != nil {
+			return err
+		}
+	}
+	if a := f.Auth; a != nil {
+		if err := a.validate(); err != nil {
+			return err
+		}
+	}
+	if q := f.QuietHours; q != nil {
+		if err := q.validate(); err != nil {
+			return err
+		}
+	}
+	if r := f.Redaction; r != nil {
+		if err := r.validate(); err != nil {
+			return err
+		}
+	}
+	if a := f.Attachments; a != nil {
+		if err := a.validate(); err != nil {
+			return err
+		}
+	}
+	if p := f.Power; p != nil {
+		if err := p.validate(); err != nil {
+			return err
+		}
+	}
+	if t := f.Tunnel; t != nil {
+		if err := t.validate(); err != nil {
+			return err
+		}
+	}
+	if t := f.TLS; t != nil {
+		if err := t.validate(); err != nil {
+			return err
+		}
+	}
+	if v := f.Voice; v != nil {
+		if err := v.validate(); err != nil {
+			return err
+		}
+	}
+	connectors := make(map[string]bool)
+	for i := range f.Connectors {
+		c := &f.Connectors[i]
+		if c.Name == "" {
+			return fmt.Errorf("connectors[%d]: name is required", i)
+		}
+		if connectors[c.Name] {
+			return fmt.Errorf("connectors[%d]: duplicate name %q", i, c.Name)
+		}
+		connectors[c.Name] = true
+		if err := c.validate(); err != nil {
+			return err
+		}
+	}
+	scripts := make(map[string]bool)
+	for i := range f.Scripts {
+		sc := &f.Scripts[i]
+		if sc.Name == "" {
+			return fmt.Errorf("scripts[%d]: name is required", i)
+		}
+		if scripts[sc.Name] {
+			return fmt.Errorf("scripts[%d]: duplicate name %q", i, sc.Name)
+		}
+		scripts[sc.Name] = true
+		if err := sc.validate(); err != nil {
+			return err
+		}
+	}
+	for name, entity := range f.PromptVariables {
+		if !variableName.MatchString(name) {
+			return fmt.Errorf("prompt_variables: invalid name %q", name)
+		}
+		if !strings.Contains(entity, ".") {
+			return fmt.Errorf("prompt_variables %q: %q is not an entity ID", name, entity)
+		}
+	}
+	for kind, policy := range f.ApprovalPolicy {
+		switch policy {
+		case "ask", "allow", "deny":
+		default:
+			return fmt.Errorf("approval_policy %q: want ask, allow or deny, got %q", kind, policy)
+		}
+	}
+	return nil
+}
+
+func (lw *LogWatch) validate() error {
+	if len(lw.Sources) == 0 {
+		return errors.New("log_watch: at least one source is required")
+	}
+	if lw.ErrorPattern == "" {
+		lw.ErrorPattern = DefaultErrorPattern
+	}
+	if _, err := regexp.Compile(lw.ErrorPattern); err != nil {
+		return fmt.Errorf("log_watch.error_pattern: %w", err)
+	}
+	names := make(map[string]bool)
+	for i := range lw.Sources {
+		src := &lw.Sources[i]
+		if src.Name == "" || names[src.Name] {
+			return fmt.Errorf("log_watch.sources[%d]: a unique name is required", i)
+		}
+		names[src.Name] = true
+		if (src.Path == "") == (src.Unit == "") {
+			return fmt.Errorf("log source %q: exactly one of path and unit is required", src.Name)
+		}
+		for j := range src.Rules {
+			r := &src.Rules[j]
+			if _, err := regexp.Compile(r.Pattern); err != nil || r.Pattern == "" {
+				return fmt.Errorf("log source %q: rules[%d]: invalid pattern %q", src.Name, j, r.Pattern)
+			}
+			switch r.Priority {
+			case "":
+				r.Priority = "high"
+			case "low", "default", "high", "urgent":
+			default:
+				return fmt.Errorf("log source %q: rules[%d]: unknown priority %q", src.Name, j, r.Priority)
+			}
+			if r.CooldownMinutes <= 0 {
+				r.CooldownMinutes = 30
+			}
+		}
+	}
+	return nil
+}
+
+func (f *Profiles) validate() error {
+	tiers := make(map[string]bool)
+	for i, t := range f.ModelTiers {
+		if t.Name == "" || t.Model == "" {
+			return fmt.Errorf("model_tiers[%d]: name and model are required", i)
+		}
+		if tiers[t.Name] {
+			return fmt.Errorf("model_tiers[%d]: duplicate name %q", i, t.Name)
+		}
+		tiers[t.Name] = true
+	}
+	checkTier := func(what, tier string) error {
+		if tier != "" && !tiers[tier] {
+			return fmt.Errorf("%s: unknown tier %q", what, tier)
+		}
+		return nil
+	}
+
+	personas := make(map[string]bool)
+	for i, p := range f.Personas {
+		if p.Name == "" {
+			return fmt.Errorf("personas[%d]: name is required", i)
+		}
+		if personas[p.Name] {
+			return fmt.Errorf("personas[%d]: duplicate name %q", i, p.Name)
+		}
+		personas[p.Name] = true
+		what := fmt.Sprintf("persona %q", p.Name)
+		if err := checkTier(what, p.Tier); err != nil {
+			return err
+		}
+		if err := checkTier(what, p.MaxTier); err != nil {
+			return err
+		}
+		if p.Tier != "" && p.MaxTier != "" && f.Tier(p.Tier) > f.Tier(p.MaxTier) {
+			return fmt.Errorf("%s: tier %q is above max_tier %q", what, p.Tier, p.MaxTier)
+		}
+		if p.Verbosity != "" && !slices.Contains(Verbosities, p.Verbosity) {
+			return fmt.Errorf("%s: verbosity must be one of %s", what, strings.Join(Verbosities, ", "))
+		}
+		if p.MaxOutputTokens < 0 {
+			return fmt.Errorf("%s: max_output_tokens must not be negative", what)
+		}
+		if r := p.Restrictions; r != nil {
+			if err := validateWindows(what, r.Windows); err != nil {
+				return err
+			}
+			if r.DailyMessages < 0 || r.DailyTokens < 0 {
+				return fmt.Errorf("%s: daily caps must not be negative", what)
+			}
+			for j, t := range r.BlockedTopics {
+				if strings.TrimSpace(t) == "" {
+					return fmt.Errorf("%s: blocked_topics[%d] is empty", what, j)
+				}
+			}
+		}
+		if p.Tools != nil {
+			if err := p.Tools.validate(what + ": tools"); err != nil {
+				return err
+			}
+		}
+	}
+	for channel, scope := range f.ChannelTools {
+		if channel == "" {
+			return errors.New("channel_tools: channel names are required")
+		}
+		if err := scope.validate(fmt.Sprintf("channel_tools %q", channel)); err != nil {
+			return err
+		}
+	}
+
+	for i, u := range f.Users {
+		if u.Name == "" {
+			return fmt.Errorf("users[%d]: name is required", i)
+		}
+		what := fmt.Sprintf("user %q", u.Name)
+		if u.Persona != "" && !personas[u.Persona] {
+			return fmt.Errorf("%s: unknown persona %q", what, u.Persona)
+		}
+		if err := checkTier(what, u.Tier); err != nil {
+			return err
+		}
+		if u.Speech != nil {
+			if err := u.Speech.validate(what); err != nil {
+				return err
+			}
+		}
+	}
+
+	variants := make(map[string]bool)
+	for i, v := range f.Variants {
+		if v.Name == "" {
+			return fmt.Errorf("variants[%d]: name is required", i)
+		}
+		if variants[v.Name] {
+			return fmt.Errorf("variants[%d]: duplicate name %q", i, v.Name)
+		}
+		variants[v.Name] = true
+		what := fmt.Sprintf("variant %q", v.Name)
+		if v.Persona != "" && !personas[v.Persona] {
+			return fmt.Errorf("%s: unknown persona %q", what, v.Persona)
+		}
+		if err := checkTier(what, v.Tier); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h Hook) template() (*template.Template, error) {
+	return template.New(h.Name).Option("missingkey=zero").Parse(h.Template)
+}
+
+// Render builds the prompt for a payload. Payloads that are not JSON
+// objects are available to the template as {{.}}.
+func (h Hook) Render(payload any) (string, error) {
+	if h.Template == "" {
+		data, err := json.MarshalIndent(payload, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Webhook %q received:\n%s", h.Name, data), nil
+	}
+	tmpl, err := h.template()
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, payload); err != nil {
+		return "", fmt.Errorf("rendering hook %q: %w", h.Name, err)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,185 @@
+// Package connectors appends completed exchanges to services outside the
+// Pi, for people who keep a life log in a Google Sheet, a Notion database
+// or an Airtable base. Each connector maps the prompt and reply onto its
+// columns or properties with templates. Exchanges in private
+// conversations are never sent.
+package connectors
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"pi-agent/internal/config"
+	"pi-agent/internal/store"
+)
+
+// queueSize bounds the replies waiting to be sent.
+const queueSize = 256
+
+// retryDelay is how long a failed append waits before its one retry.
+const retryDelay = 30 * time.Second
+
+// Exchange is a prompt and its reply, as the field templates see it.
+type Exchange struct {
+	ConversationID string
+	Prompt         string
+	Reply          string
+	Time           time.Time
+}
+
+// value is a rendered field.
+type value struct {
+	field config.ConnectorField
+	text  string
+}
+
+// target is the service a connector writes to.
+type target interface {
+	append(ctx context.Context, values []value) error
+}
+
+type connector struct {
+	conf   config.Connector
+	fields []*template.Template
+	target target
+}
+
+// Set sends exchanges to the configured connectors. It implements
+// engine.Observer.
+type Set struct {
+	db         *store.DB
+	connectors []*connector
+	queue      chan Exchange
+}
+
+// New creates the connectors.
+func New(confs []config.Connector, db *store.DB) (*Set, error) {
+	s := &Set{db: db, queue: make(chan Exchange, queueSize)}
+	for _, conf := range confs {
+		c := &connector{conf: conf}
+		for _, f := range conf.Fields {
+			tmpl, err := template.New(f.Name).Option("missingkey=zero").Parse(f.Value)
+			if err != nil {
+				return nil, fmt.Errorf("connector %q: %w", conf.Name, err)
+			}
+			c.fields = append(c.fields, tmpl)
+		}
+		var err error
+		switch conf.Kind {
+		case "google_sheets":
+			c.target, err = newSheet(conf)
+		case "notion":
+			c.target = notion{token: conf.TokenValue(), database: conf.DatabaseID}
+		case "airtable":
+			c.target = airtable{token: conf.TokenValue(), base: conf.BaseID, table: conf.Table}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("connector %q: %w", conf.Name, err)
+		}
+		s.connectors = append(s.connectors, c)
+	}
+	return s, nil
+}
+
+// Delta implements engine.Observer.
+func (s *Set) Delta(conversationID, content string) {}
+
+// Reply implements engine.Observer.
+func (s *Set) Reply(conversationID, content string) {
+	select {
+	case s.queue <- Exchange{ConversationID: conversationID, Reply: content, Time: time.Now()}:
+	default:
+		log.Printf("connectors: queue full, dropping a reply in %s", conversationID)
+	}
+}
+
+// Run sends queued exchanges until ctx is cancelled.
+func (s *Set) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case x := <-s.queue:
+			s.send(ctx, x)
+		}
+	}
+}
+
+func (s *Set) send(ctx context.Context, x Exchange) {
+	var targets []*connector
+	for _, c := range s.connectors {
+		if len(c.conf.Conversations) == 0 || slices.Contains(c.conf.Conversations, x.ConversationID) {
+			targets = append(targets, c)
+		}
+	}
+	if len(targets) == 0 {
+		return
+	}
+	if private, err := s.db.Private(x.ConversationID); err != nil || private {
+		if err != nil {
+			log.Printf("connectors: %v", err)
+		}
+		return
+	}
+	// Encrypted conversations are stored sealed; sinks would keep them in
+	// plain text.
+	if encrypted, err := s.db.Encrypted(x.ConversationID); err != nil || encrypted {
+		if err != nil {
+			log.Printf("connectors: %v", err)
+		}
+		return
+	}
+	x.Prompt = s.prompt(x)
+	for _, c := range targets {
+		values, err := c.render(x)
+		if err == nil {
+			if err = c.target.append(ctx, values); err != nil {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(retryDelay):
+				}
+				err = c.target.append(ctx, values)
+			}
+		}
+		if err != nil {
+			log.Printf("connectors: %s: %v", c.conf.Name, err)
+		}
+	}
+}
+
+// prompt finds the user message the reply answers.
+func (s *Set) prompt(x Exchange) string {
+	msgs, err := s.db.MessagesBefore(x.ConversationID, 0, 8)
+	if err != nil {
+		log.Printf("connectors: %v", err)
+		return ""
+	}
+	replied := false
+	for _, m := range slices.Backward(msgs) {
+		switch {
+		case m.Role == store.RoleAssistant && m.Content == x.Reply:
+			replied = true
+		case m.Role == store.RoleUser && replied:
+			return m.Content
+		}
+	}
+	return ""
+}
+
+func (c *connector) render(x Exchange) ([]value, error) {
+	values := make([]value, len(c.fields))
+	for i, tmpl := range c.fields {
+		var b strings.Builder
+		if err := tmpl.Execute(&b, x); err != nil {
+			return nil, fmt.Errorf("rendering %s: %w", c.conf.Fields[i].Name, err)
+		}
+		values[i] = value{field: c.conf.Fields[i], text: b.String()}
+	}
+	return values, nil
+}
@@ -0,0 +1,167 @@
+package connectors
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"pi-agent/internal/config"
+)
+
+// sheetsScope is the OAuth scope for reading and writing spreadsheets.
+const sheetsScope = "https://www.googleapis.com/auth/spreadsheets"
+
+// maxCell is the most characters a Google Sheets cell holds.
+const maxCell = 50000
+
+// sheet appends a row to a Google Sheet per exchange, signed in as a
+// service account.
+type sheet struct {
+	email    string
+	key      *rsa.PrivateKey
+	tokenURI string
+	id, rng  string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func newSheet(c config.Connector) (*sheet, error) {
+	data, err := os.ReadFile(c.CredentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	var cred struct {
+		Type        string `json:"type"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(data, &cred); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", c.CredentialsFile, err)
+	}
+	if cred.Type != "service_account" {
+		return nil, fmt.Errorf("%s is not a service account key", c.CredentialsFile)
+	}
+	block, _ := pem.Decode([]byte(cred.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("%s: no private key", c.CredentialsFile)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", c.CredentialsFile, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an RSA key", c.CredentialsFile)
+	}
+	if cred.TokenURI == "" {
+		cred.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	rng := "A1" // the first sheet
+	if c.Sheet != "" {
+		rng = "'" + strings.ReplaceAll(c.Sheet, "'", "''") + "'!A1"
+	}
+	return &sheet{email: cred.ClientEmail, key: key, tokenURI: cred.TokenURI, id: c.SpreadsheetID, rng: rng}, nil
+}
+
+func (s *sheet) append(ctx context.Context, values []value) error {
+	token, err := s.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	row := make([]string, len(values))
+	for i, v := range values {
+		row[i] = v.text
+		if r := []rune(v.text); len(r) > maxCell {
+			row[i] = string(r[:maxCell])
+		}
+	}
+	// RAW keeps a reply starting with "=" from being run as a formula.
+	u := sheetsURL + "/spreadsheets/" + url.PathEscape(s.id) + "/values/" + url.PathEscape(s.rng) +
+		":append?valueInputOption=RAW&insertDataOption=INSERT_ROWS"
+	return post(ctx, "google sheets", u, token, nil, map[string]any{"values": [][]string{row}}, nil)
+}
+
+// accessToken returns a cached access token, or signs in with a JWT
+// assertion for a new one.
+func (s *sheet) accessToken(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Until(s.expires) > time.Minute {
+		return s.token, nil
+	}
+	assertion, err := s.assertion(time.Now())
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "assertion": {assertion}}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", s.tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("google sign-in: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("google sign-in error %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", fmt.Errorf("decoding google sign-in response: %w", err)
+	}
+	if tok.AccessToken == "" {
+		return "", errors.New("google sign-in: no access token")
+	}
+	s.token, s.expires = tok.AccessToken, time.Now().Add(time.Duration(tok.ExpiresIn)*time.Second)
+	return s.token, nil
+}
+
+// assertion is a JWT signed with the service account's key, asking for
+// the spreadsheets scope for an hour.
+func (s *sheet) assertion(now time.Time) (string, error) {
+	enc := base64.RawURLEncoding
+	header := enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]any{
+		"iss":   s.email,
+		"scope": sheetsScope,
+		"aud":   s.tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	signed := header + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", fmt.Errorf("signing assertion: %w", err)
+	}
+	return signed + "." + enc.EncodeToString(sig), nil
+}
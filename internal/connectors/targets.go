@@ -0,0 +1,124 @@
+package connectors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// API endpoints, variables so they can point elsewhere.
+var (
+	notionURL   = "https://api.notion.com/v1"
+	airtableURL = "https://api.airtable.com/v0"
+	sheetsURL   = "https://sheets.googleapis.com/v4"
+)
+
+// post sends body as JSON with a bearer token and decodes the reply into
+// out, if non-nil.
+func post(ctx context.Context, service, u, token string, header http.Header, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("marshaling request: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", u, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request: %w", service, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s error %d: %s", service, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding %s response: %w", service, err)
+	}
+	return nil
+}
+
+// notion adds a page to a Notion database per exchange.
+type notion struct {
+	token, database string
+}
+
+// Notion limits rich text to 2,000 characters per text object and 100
+// objects per property.
+const (
+	notionChunk  = 2000
+	notionChunks = 100
+)
+
+func (n notion) append(ctx context.Context, values []value) error {
+	props := make(map[string]any, len(values))
+	for _, v := range values {
+		switch v.field.Type {
+		case "title":
+			props[v.field.Name] = map[string]any{"title": notionText(v.text)}
+		case "", "rich_text":
+			props[v.field.Name] = map[string]any{"rich_text": notionText(v.text)}
+		case "date":
+			props[v.field.Name] = map[string]any{"date": map[string]string{"start": v.text}}
+		case "select":
+			props[v.field.Name] = map[string]any{"select": map[string]string{"name": v.text}}
+		case "number":
+			f, err := strconv.ParseFloat(strings.TrimSpace(v.text), 64)
+			if err != nil {
+				return fmt.Errorf("%s: %q is not a number", v.field.Name, v.text)
+			}
+			props[v.field.Name] = map[string]any{"number": f}
+		case "url":
+			props[v.field.Name] = map[string]any{"url": v.text}
+		}
+	}
+	body := map[string]any{"parent": map[string]string{"database_id": n.database}, "properties": props}
+	header := http.Header{"Notion-Version": {"2022-06-28"}}
+	return post(ctx, "notion", notionURL+"/pages", n.token, header, body, nil)
+}
+
+// notionText splits s into rich text objects, dropping what does not fit.
+func notionText(s string) []any {
+	out := []any{}
+	for r := []rune(s); len(r) > 0 && len(out) < notionChunks; {
+		n := min(len(r), notionChunk)
+		out = append(out, map[string]any{"text": map[string]string{"content": string(r[:n])}})
+		r = r[n:]
+	}
+	return out
+}
+
+// airtable creates a record in an Airtable table per exchange.
+type airtable struct {
+	token, base, table string
+}
+
+func (a airtable) append(ctx context.Context, values []value) error {
+	fields := make(map[string]string, len(values))
+	for _, v := range values {
+		fields[v.field.Name] = v.text
+	}
+	// typecast lets Airtable convert the text to dates, numbers and
+	// select options as the fields require.
+	body := map[string]any{"records": []any{map[string]any{"fields": fields}}, "typecast": true}
+	u := airtableURL + "/" + url.PathEscape(a.base) + "/" + url.PathEscape(a.table)
+	return post(ctx, "airtable", u, a.token, nil, body, nil)
+}
@@ -0,0 +1,194 @@
+package contacts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"pi-agent/internal/store"
+	"pi-agent/internal/tools"
+)
+
+// errPrivate refuses to remember what is said in private conversations,
+// which would then reach the prompts of every other one.
+var errPrivate = errors.New("nothing is remembered from private conversations")
+
+// Book is the household's list of people and names, used to personalise
+// replies and to recognise names the model would otherwise get wrong.
+type Book struct {
+	db *store.DB
+}
+
+// New creates a contact book backed by db.
+func New(db *store.DB) *Book {
+	return &Book{db: db}
+}
+
+// Validate checks a contact before it is stored, tidying its fields.
+func Validate(c *store.Contact) error {
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" {
+		return errors.New("name is required")
+	}
+	nicknames := []string{}
+	for _, n := range c.Nicknames {
+		if n = strings.TrimSpace(n); n != "" && !strings.EqualFold(n, c.Name) {
+			nicknames = append(nicknames, n)
+		}
+	}
+	c.Nicknames = nicknames
+	return nil
+}
+
+// Remember adds a contact or merges the details into an existing one
+// matching the name or any of the nicknames.
+func (b *Book) Remember(in store.Contact) (*store.Contact, bool, error) {
+	if err := Validate(&in); err != nil {
+		return nil, false, err
+	}
+	var existing *store.Contact
+	for _, name := range append([]string{in.Name}, in.Nicknames...) {
+		c, err := b.db.FindContact(name)
+		if err == nil {
+			existing = c
+			break
+		}
+		if !errors.Is(err, store.ErrNotFound) {
+			return nil, false, err
+		}
+	}
+	if existing == nil {
+		if err := b.db.AddContact(&in); err != nil {
+			return nil, false, err
+		}
+		return &in, true, nil
+	}
+
+	// A nickname already on file, such as "Grandma", learning its real
+	// name: the new name becomes primary and the old one a nickname.
+	if !strings.EqualFold(existing.Name, in.Name) {
+		existing.Nicknames = append(existing.Nicknames, existing.Name)
+		existing.Name = in.Name
+	}
+	existing.Nicknames = append(existing.Nicknames, in.Nicknames...)
+	if in.Pronunciation != "" {
+		existing.Pronunciation = in.Pronunciation
+	}
+	if in.Relationship != "" {
+		existing.Relationship = in.Relationship
+	}
+	if in.Notes != "" {
+		existing.Notes = in.Notes
+	}
+	if err := Validate(existing); err != nil {
+		return nil, false, err
+	}
+	existing.Nicknames = dedupe(existing.Nicknames)
+	if err := b.db.UpdateContact(existing); err != nil {
+		return nil, false, err
+	}
+	return existing, false, nil
+}
+
+func dedupe(names []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, n := range names {
+		if k := strings.ToLower(n); !seen[k] {
+			seen[k] = true
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// Summary describes the contacts for the system prompt, or returns an
+// empty string if there are none.
+func (b *Book) Summary() string {
+	contacts, err := b.db.Contacts()
+	if err != nil || len(contacts) == 0 {
+		return ""
+	}
+	lines := []string{"People the user knows (use these names and spellings):"}
+	for _, c := range contacts {
+		lines = append(lines, "- "+describe(c))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func describe(c store.Contact) string {
+	s := c.Name
+	var details []string
+	if c.Relationship != "" {
+		details = append(details, c.Relationship)
+	}
+	if len(c.Nicknames) > 0 {
+		details = append(details, "also called "+strings.Join(c.Nicknames, ", "))
+	}
+	if c.Pronunciation != "" {
+		details = append(details, "pronounced "+c.Pronunciation)
+	}
+	if len(details) > 0 {
+		s += " (" + strings.Join(details, "; ") + ")"
+	}
+	if c.Notes != "" {
+		s += ": " + c.Notes
+	}
+	return s
+}
+
+// Tools returns the tools for remembering and forgetting contacts.
+func (b *Book) Tools() []tools.Tool {
+	return []tools.Tool{
+		tools.New("remember_contact",
+			`Remember a person the user mentions, or add details to one already known, e.g. "remember that Grandma's name is Rita" becomes name "Rita", nicknames ["Grandma"], relationship "grandmother".`,
+			`{"type":"object","properties":{
+				"name":{"type":"string","description":"The person's name"},
+				"nicknames":{"type":"array","items":{"type":"string"},"description":"Other names the household uses"},
+				"relationship":{"type":"string","description":"How they relate to the user, e.g. sister, neighbour, dog"},
+				"pronunciation":{"type":"string","description":"How to say the name, e.g. SHEE-vawn"},
+				"notes":{"type":"string","description":"Anything else worth remembering"}
+			},"required":["name"]}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var c store.Contact
+				if err := tools.Decode(args, &c); err != nil {
+					return "", err
+				}
+				if private, err := b.db.Private(tools.ConversationID(ctx)); err != nil {
+					return "", err
+				} else if private {
+					return "", errPrivate
+				}
+				saved, created, err := b.Remember(c)
+				if err != nil {
+					return "", err
+				}
+				if created {
+					return "Remembered " + describe(*saved) + ".", nil
+				}
+				return "Updated: " + describe(*saved) + ".", nil
+			}),
+		tools.New("forget_contact",
+			"Forget a person the user no longer wants remembered.",
+			`{"type":"object","properties":{"name":{"type":"string","description":"Name or nickname"}},"required":["name"]}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var p struct{ Name string }
+				if err := tools.Decode(args, &p); err != nil {
+					return "", err
+				}
+				c, err := b.db.FindContact(p.Name)
+				if errors.Is(err, store.ErrNotFound) {
+					return fmt.Sprintf("No contact named %q.", p.Name), nil
+				}
+				if err != nil {
+					return "", err
+				}
+				if err := b.db.DeleteContact(c.ID); err != nil {
+					return "", err
+				}
+				return "Forgot " + c.Name + ".", nil
+			}),
+	}
+}
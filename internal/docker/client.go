@@ -0,0 +1,201 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultSocket is where the Docker daemon listens on most installs.
+const DefaultSocket = "/var/run/docker.sock"
+
+// apiVersion is the oldest Engine API version with everything used here,
+// so older daemons still answer.
+const apiVersion = "v1.41"
+
+// maxLogs caps how much log output is read from a container.
+const maxLogs = 64 << 10
+
+// ErrNotFound is returned when no container matches a name or ID.
+var ErrNotFound = errors.New("no such container")
+
+// Container is a container summary as listed by the daemon.
+type Container struct {
+	ID      string   `json:"Id"`
+	Names   []string `json:"Names"`
+	Image   string   `json:"Image"`
+	State   string   `json:"State"`
+	Status  string   `json:"Status"`
+	Created int64    `json:"Created"`
+}
+
+// Name returns the container's primary name without the leading slash.
+func (c Container) Name() string {
+	if len(c.Names) == 0 {
+		return c.ID[:min(12, len(c.ID))]
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+// Client talks to the Docker Engine API over its unix socket.
+type Client struct {
+	http *http.Client
+}
+
+// NewClient creates a client for the daemon listening on socket.
+func NewClient(socket string) *Client {
+	return &Client{http: &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}}
+}
+
+// Containers lists all containers, including stopped ones.
+func (c *Client) Containers(ctx context.Context) ([]Container, error) {
+	var list []Container
+	if err := c.do(ctx, "GET", "/containers/json?all=1", &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Find returns the container with the given name or ID prefix.
+func (c *Client) Find(ctx context.Context, name string) (*Container, error) {
+	name = strings.TrimPrefix(strings.TrimSpace(name), "/")
+	if name == "" {
+		return nil, ErrNotFound
+	}
+	list, err := c.Containers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var byID []Container
+	for _, ct := range list {
+		for _, n := range ct.Names {
+			if strings.EqualFold(strings.TrimPrefix(n, "/"), name) {
+				return &ct, nil
+			}
+		}
+		if strings.HasPrefix(ct.ID, strings.ToLower(name)) {
+			byID = append(byID, ct)
+		}
+	}
+	switch len(byID) {
+	case 0:
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	case 1:
+		return &byID[0], nil
+	default:
+		return nil, fmt.Errorf("%q matches %d containers", name, len(byID))
+	}
+}
+
+// Start, Stop and Restart change a container's state.
+func (c *Client) Start(ctx context.Context, id string) error   { return c.action(ctx, id, "start") }
+func (c *Client) Stop(ctx context.Context, id string) error    { return c.action(ctx, id, "stop") }
+func (c *Client) Restart(ctx context.Context, id string) error { return c.action(ctx, id, "restart") }
+
+func (c *Client) action(ctx context.Context, id, action string) error {
+	// Stopping waits up to ten seconds for the container before killing it.
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	return c.do(ctx, "POST", "/containers/"+url.PathEscape(id)+"/"+action, nil)
+}
+
+// Logs returns the last lines of a container's stdout and stderr.
+func (c *Client) Logs(ctx context.Context, id string, tail int) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	path := fmt.Sprintf("/containers/%s/logs?stdout=1&stderr=1&timestamps=1&tail=%d", url.PathEscape(id), tail)
+	resp, err := c.request(ctx, "GET", path)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxLogs))
+	if err != nil {
+		return "", fmt.Errorf("reading logs: %w", err)
+	}
+	// Containers without a TTY multiplex stdout and stderr into frames.
+	if resp.Header.Get("Content-Type") == "application/vnd.docker.multiplexed-stream" || isMultiplexed(data) {
+		data = demux(data)
+	}
+	return string(data), nil
+}
+
+// isMultiplexed reports whether data starts with a stream frame header,
+// for daemons that don't set the multiplexed content type.
+func isMultiplexed(data []byte) bool {
+	return len(data) >= 8 && data[0] <= 2 && data[1] == 0 && data[2] == 0 && data[3] == 0
+}
+
+// demux strips the 8-byte frame headers from a multiplexed log stream.
+func demux(data []byte) []byte {
+	var out bytes.Buffer
+	for len(data) >= 8 {
+		n := int(binary.BigEndian.Uint32(data[4:8]))
+		data = data[8:]
+		n = min(n, len(data))
+		out.Write(data[:n])
+		data = data[n:]
+	}
+	return out.Bytes()
+}
+
+func (c *Client) do(ctx context.Context, method, path string, out any) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	resp, err := c.request(ctx, method, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding docker response: %w", err)
+	}
+	return nil
+}
+
+// request sends a request and checks its status; the caller closes the
+// body.
+func (c *Client) request(ctx context.Context, method, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, "http://docker/"+apiVersion+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("docker request: %w", err)
+	}
+	if resp.StatusCode/100 == 2 || resp.StatusCode == http.StatusNotModified {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Message string `json:"message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if json.Unmarshal(data, &body) != nil || body.Message == "" {
+		body.Message = strings.TrimSpace(string(data))
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, body.Message)
+	}
+	return nil, fmt.Errorf("docker error %d: %s", resp.StatusCode, body.Message)
+}
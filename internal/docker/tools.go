@@ -0,0 +1,136 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"pi-agent/internal/approval"
+	"pi-agent/internal/store"
+	"pi-agent/internal/tools"
+)
+
+// Kind is the approval kind of container actions.
+const Kind = "docker"
+
+// Action is the payload of a docker approval.
+type Action struct {
+	Container string `json:"container"`
+	Action    string `json:"action"`
+}
+
+// Register makes the client carry out approved container actions on q and
+// returns the Docker tools. Listing containers and reading logs need no
+// approval; starting, stopping and restarting go through q.
+func (c *Client) Register(q *approval.Queue) []tools.Tool {
+	q.Handle(Kind, c.applyApproved)
+	return []tools.Tool{
+		tools.New("docker_list_containers",
+			"List the Docker containers on the home server with their image and state.",
+			tools.NoParams,
+			func(ctx context.Context, _ json.RawMessage) (string, error) {
+				list, err := c.Containers(ctx)
+				if err != nil {
+					return "", err
+				}
+				if len(list) == 0 {
+					return "There are no containers.", nil
+				}
+				var b strings.Builder
+				for _, ct := range list {
+					fmt.Fprintf(&b, "%s (%s) image %s: %s\n", ct.Name(), ct.ID[:min(12, len(ct.ID))], ct.Image, ct.Status)
+				}
+				return b.String(), nil
+			}),
+		tools.New("docker_logs",
+			"Read the most recent log lines of a Docker container.",
+			`{"type":"object","properties":{
+				"container":{"type":"string","description":"container name or ID"},
+				"lines":{"type":"integer","description":"how many lines from the end (default 100)"}
+			},"required":["container"]}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var in struct {
+					Container string `json:"container"`
+					Lines     int    `json:"lines"`
+				}
+				if err := tools.Decode(args, &in); err != nil {
+					return "", err
+				}
+				if in.Lines <= 0 {
+					in.Lines = 100
+				}
+				ct, err := c.Find(ctx, in.Container)
+				if err != nil {
+					return "", err
+				}
+				logs, err := c.Logs(ctx, ct.ID, min(in.Lines, 1000))
+				if err != nil {
+					return "", err
+				}
+				if strings.TrimSpace(logs) == "" {
+					return ct.Name() + " has not logged anything.", nil
+				}
+				return logs, nil
+			}),
+		tools.New("docker_container_action",
+			"Start, stop or restart a Docker container. Depending on the approval policy the user may have to approve it first, in which case the result is posted to the conversation afterwards.",
+			`{"type":"object","properties":{
+				"container":{"type":"string","description":"container name or ID"},
+				"action":{"type":"string","enum":["start","stop","restart"]}
+			},"required":["container","action"]}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var in Action
+				if err := tools.Decode(args, &in); err != nil {
+					return "", err
+				}
+				switch in.Action {
+				case "start", "stop", "restart":
+				default:
+					return "", fmt.Errorf("unknown action %q", in.Action)
+				}
+				ct, err := c.Find(ctx, in.Container)
+				if err != nil {
+					return "", err
+				}
+				in.Container = ct.Name()
+				summary := fmt.Sprintf("%s the %s container (currently %s)", strings.ToUpper(in.Action[:1])+in.Action[1:], in.Container, ct.State)
+				a, err := q.Request(ctx, tools.ConversationID(ctx), Kind, summary, in)
+				if err != nil {
+					return "", err
+				}
+				return approval.Outcome(a), nil
+			}),
+	}
+}
+
+func (c *Client) applyApproved(ctx context.Context, a *store.Approval) (string, error) {
+	var in Action
+	if err := json.Unmarshal(a.Payload, &in); err != nil {
+		return "", err
+	}
+	ct, err := c.Find(ctx, in.Container)
+	if err != nil {
+		return "", err
+	}
+	switch in.Action {
+	case "start":
+		err = c.Start(ctx, ct.ID)
+	case "stop":
+		err = c.Stop(ctx, ct.ID)
+	case "restart":
+		err = c.Restart(ctx, ct.ID)
+	default:
+		err = fmt.Errorf("unknown action %q", in.Action)
+	}
+	if err != nil {
+		return "", err
+	}
+	// Report the state the container settled in, e.g. a restart loop.
+	time.Sleep(time.Second)
+	if ct, err = c.Find(ctx, ct.ID); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s is now %s.", ct.Name(), ct.Status), nil
+}
@@ -0,0 +1,410 @@
+// Package doctor checks that the agent's environment is healthy: its
+// configuration, storage, database, credentials, network path to the model
+// provider, audio and GPIO devices, and the system clock. Every problem
+// comes with a suggestion for fixing it.
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pi-agent/internal/audio"
+	"pi-agent/internal/config"
+	"pi-agent/internal/oauth"
+	"pi-agent/internal/persist"
+	"pi-agent/internal/store"
+	"pi-agent/internal/token"
+	"pi-agent/internal/upstream"
+)
+
+// Check statuses, from best to worst.
+const (
+	OK   = "ok"
+	Skip = "skip"
+	Warn = "warn"
+	Fail = "fail"
+)
+
+// Check is the result of one health check.
+type Check struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	Fix    string `json:"fix,omitempty"` // what to do about a warning or failure
+}
+
+// Options selects what is checked.
+type Options struct {
+	DataDir    string
+	ConfigPath string // default <DataDir>/config.json
+	// QuickDB runs quick_check instead of the full integrity_check, which
+	// reads every page and takes minutes for a large database on an SD
+	// card.
+	QuickDB bool
+	// AudioBackend and AudioDevice are the serve flags of the same name;
+	// the audio check is skipped when the backend is empty.
+	AudioBackend string
+	AudioDevice  string
+	// Offline skips the checks that need the network.
+	Offline bool
+	// Tokens are the credentials to check, default the OAuth tokens in
+	// <DataDir>/token.json. A running server passes its own, since
+	// refreshing rotates the refresh token and a second store would keep
+	// the stale one.
+	Tokens token.Provider
+	// SkipCredentials skips the ChatGPT login and upstream checks, for
+	// other providers.
+	SkipCredentials bool
+}
+
+// endpoints are the hosts the agent must reach.
+var endpoints = []struct{ name, url string }{
+	{"model provider", "https://chatgpt.com/"},
+	{"sign-in", oauth.TokenEndpoint},
+}
+
+// apiEndpoints replace endpoints when authenticating with an API key.
+var apiEndpoints = []struct{ name, url string }{
+	{"model provider", "https://api.openai.com/"},
+}
+
+// maxSkew is how far the clock may be off before OAuth tokens are
+// rejected as not yet valid or already expired.
+const maxSkew = time.Minute
+
+// Run performs the checks.
+func Run(ctx context.Context, o Options) []Check {
+	if o.ConfigPath == "" {
+		o.ConfigPath = filepath.Join(o.DataDir, "config.json")
+	}
+	checks := []Check{
+		checkConfig(o.ConfigPath),
+		checkStorage(o.DataDir),
+		checkDatabase(filepath.Join(o.DataDir, "conversations.db"), o.QuickDB),
+	}
+	var skew *time.Duration
+	switch {
+	case o.SkipCredentials:
+		checks = append(checks, Check{Name: "credentials", Status: Skip, Detail: "not using ChatGPT"})
+	case o.Offline:
+		checks = append(checks,
+			checkToken(ctx, o.Tokens, filepath.Join(o.DataDir, "token.json"), true),
+			Check{Name: "upstream", Status: Skip, Detail: "offline"})
+	default:
+		checks = append(checks, checkToken(ctx, o.Tokens, filepath.Join(o.DataDir, "token.json"), false))
+		eps := endpoints
+		if o.Tokens != nil && o.Tokens.IsAPIKey() {
+			eps = apiEndpoints
+		}
+		for _, e := range eps {
+			c, d := checkEndpoint(ctx, e.name, e.url)
+			checks = append(checks, c)
+			if skew == nil {
+				skew = d
+			}
+		}
+	}
+	checks = append(checks, checkClock(ctx, skew), checkAudio(ctx, o.AudioBackend, o.AudioDevice), checkGPIO())
+	return checks
+}
+
+// Healthy reports whether no check failed.
+func Healthy(checks []Check) bool {
+	for _, c := range checks {
+		if c.Status == Fail {
+			return false
+		}
+	}
+	return true
+}
+
+func checkConfig(path string) Check {
+	c := Check{Name: "config"}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		c.Status, c.Detail = OK, "no "+path+"; using defaults"
+		return c
+	}
+	if _, err := config.Load(path); err != nil {
+		c.Status, c.Detail = Fail, err.Error()
+		c.Fix = "correct the file; pi-agent serve will not start with it"
+		return c
+	}
+	c.Status, c.Detail = OK, path+" is valid"
+	return c
+}
+
+func checkStorage(dir string) Check {
+	c := Check{Name: "storage"}
+	err := persist.Check(dir)
+	switch {
+	case errors.Is(err, persist.ErrReadOnly):
+		c.Status, c.Detail = Fail, err.Error()
+		c.Fix = "pass a -data-dir on a writable partition, e.g. one left out of the read-only overlay"
+	case errors.Is(err, persist.ErrVolatile):
+		c.Status, c.Detail = Warn, err.Error()
+		c.Fix = "pass a -data-dir on a partition that survives reboots, with -cache-dir and -flush-interval to spare it"
+	case err != nil:
+		c.Status, c.Detail = Fail, err.Error()
+		c.Fix = "check the permissions of " + dir
+	default:
+		c.Status, c.Detail = OK, dir+" is writable"
+	}
+	return c
+}
+
+func checkDatabase(path string, quick bool) Check {
+	c := Check{Name: "database"}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		c.Status, c.Detail = OK, "no database yet; pi-agent serve creates it"
+		return c
+	}
+	db, err := store.Open(path)
+	if err != nil {
+		c.Status, c.Detail = Fail, err.Error()
+		c.Fix = "check the permissions of " + filepath.Dir(path) + " and that the disk is not full"
+		return c
+	}
+	defer db.Close()
+	problems, err := db.IntegrityCheck(quick)
+	if err != nil {
+		c.Status, c.Detail = Fail, err.Error()
+		c.Fix = "stop pi-agent and restore " + path + " from a backup"
+		return c
+	}
+	if len(problems) > 0 {
+		c.Status = Fail
+		c.Detail = fmt.Sprintf("%d problems, first: %s", len(problems), problems[0])
+		c.Fix = "stop pi-agent, then recover the data with: sqlite3 " + path + " .recover | sqlite3 recovered.db"
+		return c
+	}
+	size, _ := db.Size()
+	c.Status, c.Detail = OK, fmt.Sprintf("%s passed its integrity check (%d MB)", path, size>>20)
+	return c
+}
+
+func checkToken(ctx context.Context, ts token.Provider, path string, offline bool) Check {
+	c := Check{Name: "credentials"}
+	if ts == nil {
+		var err error
+		if ts, err = token.NewStore(path); err != nil {
+			c.Status, c.Detail = Fail, err.Error()
+			return c
+		}
+	}
+	if ts.IsAPIKey() {
+		return checkAPIKey(ctx, ts, offline)
+	}
+	if !ts.HasCredentials() {
+		c.Status, c.Detail, c.Fix = Fail, "not logged in", "run pi-agent login (add -headless without a browser)"
+		return c
+	}
+	expires := ts.ExpiresAt()
+	if time.Until(expires) > 0 {
+		c.Status = OK
+		c.Detail = fmt.Sprintf("account %s, token valid until %s", ts.AccountID(), expires.Local().Format(time.DateTime))
+		return c
+	}
+	if offline {
+		c.Status, c.Detail = Warn, "the access token has expired; it is refreshed on next use"
+		return c
+	}
+	// Refreshing proves the refresh token still works.
+	if _, err := ts.AccessToken(ctx); err != nil {
+		c.Status, c.Detail = Fail, err.Error()
+		c.Fix = "run pi-agent login to sign in again"
+		return c
+	}
+	c.Status = OK
+	c.Detail = fmt.Sprintf("account %s, token refreshed, valid until %s", ts.AccountID(), ts.ExpiresAt().Local().Format(time.DateTime))
+	return c
+}
+
+// checkAPIKey checks an API key by listing the models it may use.
+func checkAPIKey(ctx context.Context, ts token.Provider, offline bool) Check {
+	c := Check{Name: "credentials", Status: OK, Detail: "using an OpenAI API key"}
+	if offline {
+		return c
+	}
+	key, err := ts.AccessToken(ctx)
+	if err != nil {
+		c.Status, c.Detail = Fail, err.Error()
+		return c
+	}
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.openai.com/v1/models", nil)
+	if err != nil {
+		c.Status, c.Detail = Fail, err.Error()
+		return c
+	}
+	req.Header.Set("Authorization", "Bearer "+key)
+	resp, err := upstream.Client().Do(req)
+	if err != nil {
+		// The upstream check reports the network.
+		c.Status, c.Detail = Warn, "could not verify the API key: "+err.Error()
+		return c
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		c.Status, c.Detail = Fail, "the API key was rejected ("+resp.Status+")"
+		c.Fix = "check -api-key or $" + token.EnvAPIKey
+	case resp.StatusCode != http.StatusOK:
+		c.Status, c.Detail = Warn, "could not verify the API key: "+resp.Status
+	default:
+		c.Detail = "OpenAI API key accepted"
+	}
+	return c
+}
+
+// checkEndpoint requests url and returns how far the local clock is ahead
+// of the server's Date header, or nil without one. Any HTTP response
+// counts as reachable.
+func checkEndpoint(ctx context.Context, name, url string) (Check, *time.Duration) {
+	c := Check{Name: "upstream " + name}
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		c.Status, c.Detail = Fail, err.Error()
+		return c, nil
+	}
+	start := time.Now()
+	resp, err := upstream.Client().Do(req)
+	if err != nil {
+		c.Status, c.Detail = Fail, err.Error()
+		c.Fix = "check the network and DNS (pi-agent serve has net_diagnose), or set -upstream-proxy"
+		return c, nil
+	}
+	resp.Body.Close()
+	elapsed := time.Since(start)
+	c.Status, c.Detail = OK, fmt.Sprintf("%s reachable in %s", req.URL.Host, elapsed.Round(time.Millisecond))
+	if elapsed > 5*time.Second {
+		c.Status = Warn
+		c.Fix = "the link is slow; raise -upstream-connect-timeout if requests time out"
+	}
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return c, nil
+	}
+	// The header was set about halfway through the request.
+	skew := time.Since(date.Add(elapsed / 2))
+	return c, &skew
+}
+
+// checkClock compares the clock with the upstream server's, and with
+// systemd's view of NTP when available. Pis have no real-time clock and
+// boot at the last saved time until NTP syncs.
+func checkClock(ctx context.Context, skew *time.Duration) Check {
+	c := Check{Name: "clock"}
+	now := time.Now()
+	synced := ntpSynchronized(ctx)
+	switch {
+	case skew != nil && (*skew > maxSkew || *skew < -maxSkew):
+		c.Status = Fail
+		c.Detail = fmt.Sprintf("the clock is off by %s from the provider's", skew.Round(time.Second))
+		c.Fix = "enable NTP with sudo timedatectl set-ntp true; signing in fails until the clock is right"
+	case skew == nil && now.Year() < 2025:
+		c.Status, c.Detail = Fail, "the clock says "+now.Format(time.DateTime)
+		c.Fix = "enable NTP with sudo timedatectl set-ntp true, or install fake-hwclock"
+	case synced == "no":
+		c.Status, c.Detail = Warn, "the clock is not synchronized by NTP"
+		c.Fix = "enable NTP with sudo timedatectl set-ntp true"
+	default:
+		c.Status = OK
+		c.Detail = "the clock is correct"
+		if skew == nil {
+			c.Detail = "the clock looks plausible but was not compared with a server"
+		}
+		if synced == "yes" {
+			c.Detail += "; NTP synchronized"
+		}
+	}
+	return c
+}
+
+// ntpSynchronized returns "yes" or "no" from timedatectl, or empty when
+// it is unavailable.
+func ntpSynchronized(ctx context.Context) string {
+	out, err := exec.CommandContext(ctx, "timedatectl", "show", "--property=NTPSynchronized", "--value").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func checkAudio(ctx context.Context, backend, device string) Check {
+	c := Check{Name: "audio"}
+	if backend == "" {
+		c.Status, c.Detail = Skip, "no -audio backend configured"
+		return c
+	}
+	m, err := audio.NewMixer(audio.Backend(backend), device, "")
+	if err != nil {
+		c.Status, c.Detail, c.Fix = Fail, err.Error(), `use -audio "alsa" or "pulse"`
+		return c
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	devices, err := m.Devices(ctx)
+	if err != nil {
+		c.Status, c.Detail = Fail, err.Error()
+		c.Fix = "install alsa-utils (ALSA) or pulseaudio-utils (Pulse), and add the user to the audio group"
+		return c
+	}
+	if len(devices) == 0 {
+		c.Status, c.Detail = Fail, "no output devices found"
+		c.Fix = "check the sound card is connected and enabled, e.g. dtparam=audio=on in /boot/firmware/config.txt"
+		return c
+	}
+	if device != "" && !hasDevice(devices, device) {
+		ids := make([]string, len(devices))
+		for i, d := range devices {
+			ids[i] = d.ID
+		}
+		c.Status, c.Detail = Fail, fmt.Sprintf("device %q not found; available: %s", device, strings.Join(ids, ", "))
+		c.Fix = "set -audio-device to one of the available devices"
+		return c
+	}
+	c.Status, c.Detail = OK, fmt.Sprintf("%d output devices", len(devices))
+	return c
+}
+
+func hasDevice(devices []audio.Device, id string) bool {
+	for _, d := range devices {
+		// ALSA devices may be given with a subdevice, e.g. hw:1,0.
+		if d.ID == id || strings.HasPrefix(id, d.ID+",") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkGPIO reports whether the GPIO character devices exist and can be
+// opened by this user.
+func checkGPIO() Check {
+	c := Check{Name: "gpio"}
+	chips, _ := filepath.Glob("/dev/gpiochip*")
+	if len(chips) == 0 {
+		c.Status, c.Detail = Skip, "no GPIO chips (not a Raspberry Pi?)"
+		return c
+	}
+	for _, chip := range chips {
+		f, err := os.OpenFile(chip, os.O_RDWR, 0)
+		if err != nil {
+			c.Status, c.Detail = Warn, err.Error()
+			c.Fix = "add the user to the gpio group: sudo usermod -aG gpio $USER"
+			return c
+		}
+		f.Close()
+	}
+	c.Status, c.Detail = OK, strings.Join(chips, ", ")
+	return c
+}
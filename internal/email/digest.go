@@ -0,0 +1,162 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"pi-agent/internal/config"
+	"pi-agent/internal/notify"
+	"pi-agent/internal/store"
+)
+
+// maxFetchBytes bounds how much of each message's source is downloaded.
+const maxFetchBytes = 64 << 10
+
+// maxPromptText bounds the body text of each message sent to the model.
+const maxPromptText = 1500
+
+// Digest fetches unread mail and sends a periodic summary. It never
+// modifies the mailbox.
+type Digest struct {
+	cfg      config.EmailDigest
+	db       *store.DB
+	complete func(ctx context.Context, prompt string) (string, error)
+	notifier notify.Notifier
+}
+
+// NewDigest creates a digest job.
+func NewDigest(cfg config.EmailDigest, db *store.DB, complete func(ctx context.Context, prompt string) (string, error), n notify.Notifier) *Digest {
+	return &Digest{cfg: cfg, db: db, complete: complete, notifier: n}
+}
+
+// Run fetches new unread mail, summarizes everything not yet digested and
+// delivers the briefing.
+func (d *Digest) Run(ctx context.Context) error {
+	if err := d.fetch(ctx); err != nil {
+		return err
+	}
+	pending, err := d.db.PendingEmails()
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		log.Printf("email digest: no new mail")
+		return nil
+	}
+
+	briefing, err := d.complete(ctx, d.prompt(pending))
+	if err != nil {
+		return fmt.Errorf("summarizing email: %w", err)
+	}
+	if d.cfg.ConversationID != "" {
+		if err := d.db.AddMessage(d.cfg.ConversationID, store.RoleAssistant, briefing); err != nil {
+			log.Printf("db error saving email digest: %v", err)
+		}
+	}
+	if d.notifier != nil {
+		title := fmt.Sprintf("Email digest: %d new", len(pending))
+		if err := d.notifier.Notify(ctx, notify.Message{Title: title, Body: briefing, Priority: notify.PriorityLow, Tags: []string{"email"}}); err != nil {
+			return err
+		}
+	}
+
+	ids := make([]int64, len(pending))
+	for i, m := range pending {
+		ids[i] = m.ID
+	}
+	if err := d.db.MarkEmailsDigested(ids); err != nil {
+		return err
+	}
+	return d.db.PruneEmails(time.Now().AddDate(0, 0, -d.cfg.RetentionDays))
+}
+
+// fetch downloads unread messages not seen by an earlier run.
+func (d *Digest) fetch(ctx context.Context) error {
+	c, err := dialIMAP(ctx, d.cfg.Server)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if err := c.login(d.cfg.Username, d.cfg.PasswordValue()); err != nil {
+		return err
+	}
+
+	for _, folder := range d.cfg.Folders {
+		validity, err := c.examine(folder.Name)
+		if err != nil {
+			return fmt.Errorf("opening %s: %w", folder.Name, err)
+		}
+		uids, err := c.searchUnseen()
+		if err != nil {
+			return fmt.Errorf("searching %s: %w", folder.Name, err)
+		}
+		var fresh []uint32
+		// Walk newest first so the cap keeps the most recent mail.
+		for i := len(uids) - 1; i >= 0 && len(fresh) < folder.MaxMessages; i-- {
+			seen, err := d.db.HasEmail(folder.Name, validity, uids[i])
+			if err != nil {
+				return err
+			}
+			if !seen {
+				fresh = append(fresh, uids[i])
+			}
+		}
+		if len(fresh) == 0 {
+			continue
+		}
+		raw, err := c.fetch(fresh, maxFetchBytes)
+		if err != nil {
+			return fmt.Errorf("fetching %s: %w", folder.Name, err)
+		}
+		for uid, src := range raw {
+			msg, err := parseMessage(src)
+			if err != nil {
+				log.Printf("email digest: skipping %s/%d: %v", folder.Name, uid, err)
+				continue
+			}
+			if err := d.db.AddEmail(&store.EmailMessage{
+				Folder:      folder.Name,
+				UIDValidity: validity,
+				UID:         uid,
+				From:        msg.From,
+				Subject:     msg.Subject,
+				SentAt:      msg.Date,
+				Text:        msg.Text,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *Digest) prompt(msgs []store.EmailMessage) string {
+	var b strings.Builder
+	b.WriteString(`Write a concise email briefing for a phone notification. Group related messages, lead with anything that needs action or has a deadline, and summarize newsletters and notifications in a line or two. Do not quote long passages.`)
+	for _, folder := range d.cfg.Folders {
+		var section []store.EmailMessage
+		for _, m := range msgs {
+			if m.Folder == folder.Name {
+				section = append(section, m)
+			}
+		}
+		if len(section) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n\n## Folder %s (%d unread)", folder.Name, len(section))
+		if folder.Instructions != "" {
+			fmt.Fprintf(&b, "\nInstructions for this folder: %s", folder.Instructions)
+		}
+		for _, m := range section {
+			text := m.Text
+			if len(text) > maxPromptText {
+				text = text[:maxPromptText] + "…"
+			}
+			fmt.Fprintf(&b, "\n\nFrom: %s\nSubject: %s\nDate: %s\n%s", m.From, m.Subject, m.SentAt.Local().Format("Mon Jan 2 15:04"), text)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,206 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// imapResponse is one server response line. Literals ({n} octet strings)
+// are removed from the line and returned separately, in order.
+type imapResponse struct {
+	line     string
+	literals [][]byte
+}
+
+// imapConn is a minimal IMAP4rev1 client covering what a read-only digest
+// needs: LOGIN, EXAMINE, UID SEARCH and UID FETCH with BODY.PEEK, none of
+// which change message flags.
+type imapConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+}
+
+// maxLiteral bounds the size of a single literal accepted from the server.
+const maxLiteral = 1 << 20
+
+func dialIMAP(ctx context.Context, addr string) (*imapConn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, addr = addr, net.JoinHostPort(addr, "993")
+	}
+	d := tls.Dialer{Config: &tls.Config{ServerName: host}}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(5 * time.Minute))
+	}
+	c := &imapConn{conn: conn, r: bufio.NewReader(conn)}
+	greeting, err := c.read()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting.line, "* OK") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected IMAP greeting %q", greeting.line)
+	}
+	return c, nil
+}
+
+func (c *imapConn) Close() error {
+	c.command("LOGOUT")
+	return c.conn.Close()
+}
+
+// read reads one response, including any literals it carries.
+func (c *imapConn) read() (imapResponse, error) {
+	var resp imapResponse
+	var line strings.Builder
+	for {
+		s, err := c.r.ReadString('\n')
+		if err != nil {
+			return resp, fmt.Errorf("reading IMAP response: %w", err)
+		}
+		s = strings.TrimRight(s, "\r\n")
+		m := literalRe.FindStringSubmatchIndex(s)
+		if m == nil {
+			line.WriteString(s)
+			resp.line = line.String()
+			return resp, nil
+		}
+		n, _ := strconv.Atoi(s[m[2]:m[3]])
+		if n > maxLiteral {
+			return resp, fmt.Errorf("IMAP literal of %d bytes is too large", n)
+		}
+		lit := make([]byte, n)
+		if _, err := io.ReadFull(c.r, lit); err != nil {
+			return resp, fmt.Errorf("reading IMAP literal: %w", err)
+		}
+		line.WriteString(s[:m[0]])
+		resp.literals = append(resp.literals, lit)
+	}
+}
+
+var literalRe = regexp.MustCompile(`\{(\d+)\}$`)
+
+// command sends a command and returns its untagged responses. A tagged
+// response other than OK is reported as an error.
+func (c *imapConn) command(format string, args ...any) ([]imapResponse, error) {
+	c.tag++
+	tag := "a" + strconv.Itoa(c.tag)
+	cmd := fmt.Sprintf(format, args...)
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, cmd); err != nil {
+		return nil, fmt.Errorf("sending IMAP command: %w", err)
+	}
+	var untagged []imapResponse
+	for {
+		resp, err := c.read()
+		if err != nil {
+			return nil, err
+		}
+		if rest, ok := strings.CutPrefix(resp.line, tag+" "); ok {
+			if !strings.HasPrefix(rest, "OK") {
+				verb, _, _ := strings.Cut(cmd, " ")
+				return nil, fmt.Errorf("IMAP %s: %s", verb, rest)
+			}
+			return untagged, nil
+		}
+		untagged = append(untagged, resp)
+	}
+}
+
+func (c *imapConn) login(user, password string) error {
+	if !quotable(user) || !quotable(password) {
+		return errors.New("IMAP LOGIN: user name and password cannot contain line breaks")
+	}
+	_, err := c.command("LOGIN %s %s", quote(user), quote(password))
+	return err
+}
+
+var uidValidityRe = regexp.MustCompile(`\[UIDVALIDITY (\d+)\]`)
+
+// examine opens a folder read-only and returns its UIDVALIDITY.
+func (c *imapConn) examine(folder string) (uint32, error) {
+	if !quotable(folder) {
+		return 0, fmt.Errorf("IMAP EXAMINE: invalid folder name %q", folder)
+	}
+	resps, err := c.command("EXAMINE %s", quote(folder))
+	if err != nil {
+		return 0, err
+	}
+	for _, r := range resps {
+		if m := uidValidityRe.FindStringSubmatch(r.line); m != nil {
+			v, _ := strconv.ParseUint(m[1], 10, 32)
+			return uint32(v), nil
+		}
+	}
+	return 0, nil
+}
+
+// searchUnseen returns the UIDs of unread messages in ascending order.
+func (c *imapConn) searchUnseen() ([]uint32, error) {
+	resps, err := c.command("UID SEARCH UNSEEN")
+	if err != nil {
+		return nil, err
+	}
+	var uids []uint32
+	for _, r := range resps {
+		rest, ok := strings.CutPrefix(r.line, "* SEARCH")
+		if !ok {
+			continue
+		}
+		for _, f := range strings.Fields(rest) {
+			if v, err := strconv.ParseUint(f, 10, 32); err == nil {
+				uids = append(uids, uint32(v))
+			}
+		}
+	}
+	return uids, nil
+}
+
+var fetchUIDRe = regexp.MustCompile(`\bUID (\d+)`)
+
+// fetch returns the first maxBytes of each message's raw source, keyed by
+// UID. BODY.PEEK leaves the \Seen flag untouched.
+func (c *imapConn) fetch(uids []uint32, maxBytes int) (map[uint32][]byte, error) {
+	set := make([]string, len(uids))
+	for i, u := range uids {
+		set[i] = strconv.FormatUint(uint64(u), 10)
+	}
+	resps, err := c.command("UID FETCH %s (UID BODY.PEEK[]<0.%d>)", strings.Join(set, ","), maxBytes)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[uint32][]byte)
+	for _, r := range resps {
+		m := fetchUIDRe.FindStringSubmatch(r.line)
+		if m == nil || len(r.literals) == 0 {
+			continue
+		}
+		uid, _ := strconv.ParseUint(m[1], 10, 32)
+		out[uint32(uid)] = r.literals[0]
+	}
+	return out, nil
+}
+
+// quotable reports whether s can be sent as a quoted string, which
+// cannot span lines; a line break would end the command early.
+func quotable(s string) bool { return !strings.ContainsAny(s, "\r\n\x00") }
+
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,178 @@
+package email
+
+import (
+	"bufio"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIMAPRead(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		line     string
+		literals []string
+	}{
+		{"simple", "* OK ready\r\n", "* OK ready", nil},
+		{"bare newline", "a1 OK done\n", "a1 OK done", nil},
+		{"literal", "* 1 FETCH (UID 7 BODY[]<0> {5}\r\nHello)\r\n", "* 1 FETCH (UID 7 BODY[]<0> )", []string{"Hello"}},
+		{"literal with line breaks", "* 1 FETCH (BODY[] {12}\r\nA: b\r\n\r\nbody UID 9)\r\n", "* 1 FETCH (BODY[]  UID 9)", []string{"A: b\r\n\r\nbody"}},
+		{"two literals", "* LIST {1}\r\na {2}\r\nbc\r\n", "* LIST  ", []string{"a", "bc"}},
+		{"empty literal", "* X {0}\r\n)\r\n", "* X )", []string{""}},
+		{"braces mid-line", "* OK {not a literal} here\r\n", "* OK {not a literal} here", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &imapConn{r: bufio.NewReader(strings.NewReader(tt.in + "trailing"))}
+			resp, err := c.read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var lits []string
+			for _, l := range resp.literals {
+				lits = append(lits, string(l))
+			}
+			if resp.line != tt.line || !reflect.DeepEqual(lits, tt.literals) {
+				t.Errorf("read = %q %q, want %q %q", resp.line, lits, tt.line, tt.literals)
+			}
+		})
+	}
+}
+
+func TestIMAPReadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"end of stream", "* OK no newline", "reading IMAP response: EOF"},
+		{"literal too large", "* 1 FETCH (BODY[] {1048577}\r\n", "IMAP literal of 1048577 bytes is too large"},
+		{"truncated literal", "* 1 FETCH (BODY[] {10}\r\nshort", "reading IMAP literal: unexpected EOF"},
+		{"no line after literal", "* 1 FETCH (BODY[] {2}\r\nab", "reading IMAP response: EOF"},
+	}
+	for _, tt := range tests {
+		c := &imapConn{r: bufio.NewReader(strings.NewReader(tt.in))}
+		if _, err := c.read(); err == nil || err.Error() != tt.want {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := map[string]string{
+		"INBOX":        `"INBOX"`,
+		"Sent Items":   `"Sent Items"`,
+		`pa"ss`:        `"pa\"ss"`,
+		`back\slash`:   `"back\\slash"`,
+		"":             `""`,
+		`\"`:           `"\\\""`,
+		"[Gmail]/Spam": `"[Gmail]/Spam"`,
+	}
+	for in, want := range tests {
+		if got := quote(in); got != want {
+			t.Errorf("quote(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+// imapExchange is a command a scripted server expects, and its reply, in
+// which TAG stands for the command's tag.
+type imapExchange struct {
+	command string // without the tag
+	reply   string
+}
+
+// imapSession returns a connection to a server on the other end of a
+// pipe that plays script.
+func imapSession(t *testing.T, script []imapExchange) *imapConn {
+	t.Helper()
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close(); server.Close() })
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	server.SetDeadline(time.Now().Add(5 * time.Second))
+	go func() {
+		r := bufio.NewReader(server)
+		for _, ex := range script {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			tag, cmd, _ := strings.Cut(strings.TrimSuffix(line, "\r\n"), " ")
+			if cmd != ex.command {
+				t.Errorf("server got %q, want %q", cmd, ex.command)
+				server.Close()
+				return
+			}
+			server.Write([]byte(strings.ReplaceAll(ex.reply, "TAG", tag)))
+		}
+	}()
+	return &imapConn{conn: client, r: bufio.NewReader(client)}
+}
+
+func TestIMAPSession(t *testing.T) {
+	msg1 := "From: Ann <ann@example.com>\r\nSubject: Hi\r\n\r\nHello!"
+	msg2 := "Subject: Invoice\r\n\r\nDue soon"
+	c := imapSession(t, []imapExchange{
+		{`LOGIN "me@example.com" "p\"w"`, "TAG OK LOGIN completed\r\n"},
+		{`EXAMINE "INBOX"`, "* 3 EXISTS\r\n* OK [UIDVALIDITY 1712345678] UIDs valid\r\n* OK [UIDNEXT 42] next\r\nTAG OK [READ-ONLY] EXAMINE completed\r\n"},
+		{"UID SEARCH UNSEEN", "* SEARCH 12 40 41\r\nTAG OK SEARCH completed\r\n"},
+		{"UID FETCH 41,40 (UID BODY.PEEK[]<0.65536>)",
+			"* 2 FETCH (UID 40 BODY[]<0> {" + strconv.Itoa(len(msg1)) + "}\r\n" + msg1 + ")\r\n" +
+				"* 3 FETCH (BODY[]<0> {" + strconv.Itoa(len(msg2)) + "}\r\n" + msg2 + " UID 41)\r\n" +
+				"* 3 FETCH (FLAGS (\\Recent))\r\n" +
+				"TAG OK FETCH completed\r\n"},
+		{`EXAMINE "Missing"`, "TAG NO [NONEXISTENT] Unknown mailbox\r\n"},
+		{"UID SEARCH UNSEEN", "* SEARCH\r\nTAG OK SEARCH completed\r\n"},
+	})
+
+	if err := c.login("me@example.com", `p"w`); err != nil {
+		t.Fatal(err)
+	}
+	validity, err := c.examine("INBOX")
+	if err != nil || validity != 1712345678 {
+		t.Fatalf("examine = %d, %v, want 1712345678", validity, err)
+	}
+	uids, err := c.searchUnseen()
+	if err != nil || !reflect.DeepEqual(uids, []uint32{12, 40, 41}) {
+		t.Fatalf("searchUnseen = %v, %v", uids, err)
+	}
+	raw, err := c.fetch([]uint32{41, 40}, maxFetchBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) != 2 || string(raw[40]) != msg1 || string(raw[41]) != msg2 {
+		t.Errorf("fetch = %q", raw)
+	}
+
+	_, err = c.examine("Missing")
+	if err == nil || err.Error() != "IMAP EXAMINE: NO [NONEXISTENT] Unknown mailbox" {
+		t.Errorf("examine of a missing folder: err = %v", err)
+	}
+	if uids, err := c.searchUnseen(); err != nil || len(uids) != 0 {
+		t.Errorf("empty search = %v, %v", uids, err)
+	}
+}
+
+func TestIMAPLoginRefused(t *testing.T) {
+	c := imapSession(t, []imapExchange{
+		{`LOGIN "me" "wrong"`, "* BYE not today\r\nTAG NO [AUTHENTICATIONFAILED] Invalid credentials\r\n"},
+	})
+	err := c.login("me", "wrong")
+	if err == nil || err.Error() != "IMAP LOGIN: NO [AUTHENTICATIONFAILED] Invalid credentials" {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestIMAPRejectsLineBreaks(t *testing.T) {
+	c := imapSession(t, nil) // the server expects no commands
+	if err := c.login("me", "pw\r\na2 DELETE INBOX"); err == nil {
+		t.Error("login with a line break in the password succeeded")
+	}
+	if _, err := c.examine("INBOX\r\na2 DELETE INBOX"); err == nil {
+		t.Error("examine with a line break in the folder succeeded")
+	}
+}
@@ -0,0 +1,113 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+
+	"pi-agent/internal/rag"
+)
+
+// maxText bounds the extracted body text kept per message.
+const maxText = 4000
+
+// Message is the extracted content of an email.
+type Message struct {
+	From    string
+	Subject string
+	Date    time.Time
+	Text    string
+}
+
+var wordDecoder = mime.WordDecoder{}
+
+// parseMessage extracts the sender, subject, date and readable body text
+// from raw (possibly truncated) message source.
+func parseMessage(raw []byte) (*Message, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	msg := &Message{
+		From:    decodeHeader(m.Header.Get("From")),
+		Subject: decodeHeader(m.Header.Get("Subject")),
+	}
+	if addr, err := mail.ParseAddress(m.Header.Get("From")); err == nil && addr.Name != "" {
+		msg.From = addr.Name + " <" + addr.Address + ">"
+	}
+	msg.Date, _ = m.Header.Date()
+
+	text := bodyText(m.Header.Get("Content-Type"), m.Header.Get("Content-Transfer-Encoding"), m.Body)
+	text = strings.TrimSpace(text)
+	if len(text) > maxText {
+		text = text[:maxText] + "…"
+	}
+	msg.Text = text
+	return msg, nil
+}
+
+func decodeHeader(s string) string {
+	if d, err := wordDecoder.DecodeHeader(s); err == nil {
+		return d
+	}
+	return s
+}
+
+// bodyText returns the readable text of a MIME entity, preferring
+// text/plain parts and falling back to converted HTML.
+func bodyText(contentType, encoding string, body io.Reader) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		var html string
+		for {
+			p, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+			text := bodyText(p.Header.Get("Content-Type"), p.Header.Get("Content-Transfer-Encoding"), p)
+			pt, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+			switch {
+			case text == "":
+			case pt == "text/html":
+				if html == "" {
+					html = text
+				}
+			default:
+				return text
+			}
+		}
+		return html
+	}
+
+	// Truncated fetches can cut an encoded body short; keep whatever
+	// decoded cleanly.
+	data, _ := io.ReadAll(decodeTransfer(encoding, body))
+	switch mediaType {
+	case "text/plain":
+		return string(data)
+	case "text/html":
+		_, text := rag.ExtractHTML(string(data))
+		return text
+	}
+	return ""
+}
+
+func decodeTransfer(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	}
+	return r
+}
@@ -0,0 +1,138 @@
+package energy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"pi-agent/internal/homeassistant"
+)
+
+// Meter kinds.
+const (
+	KindShelly     = "shelly"     // Shelly Gen2+ plug, /rpc/Switch.GetStatus
+	KindTasmota    = "tasmota"    // Tasmota plug, /cm?cmnd=Status 10
+	KindHomeWizard = "homewizard" // HomeWizard P1 meter or plug, /api/v1/data
+	KindHA         = "ha"         // Home Assistant sensors: "sensor.power[,sensor.energy]"
+)
+
+// Meter is a smart plug, P1 meter or sensor reporting power use.
+type Meter struct {
+	Name   string
+	Kind   string
+	Target string // base URL, or sensor entity IDs for KindHA
+}
+
+// ParseMeters parses a comma-separated list of name=kind:target entries,
+// e.g. "fridge=shelly:http://10.0.0.5,house=homewizard:http://10.0.0.6".
+// HA targets use "+" to join the power and energy sensors.
+func ParseMeters(s string) ([]Meter, error) {
+	var meters []Meter
+	for _, entry := range strings.Split(s, ",") {
+		name, spec, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		kind, target, ok2 := strings.Cut(spec, ":")
+		if !ok || !ok2 || name == "" || target == "" {
+			return nil, fmt.Errorf("invalid meter %q, want name=kind:target", entry)
+		}
+		switch kind {
+		case KindShelly, KindTasmota, KindHomeWizard, KindHA:
+		default:
+			return nil, fmt.Errorf("unknown meter kind %q", kind)
+		}
+		meters = append(meters, Meter{Name: name, Kind: kind, Target: strings.TrimRight(target, "/")})
+	}
+	return meters, nil
+}
+
+// sample is a raw meter reading.
+type sample struct {
+	powerW    float64
+	energyKWh float64
+}
+
+func (m Meter) read(ctx context.Context, ha *homeassistant.Client) (sample, error) {
+	switch m.Kind {
+	case KindShelly:
+		var v struct {
+			APower  float64 `json:"apower"`
+			AEnergy struct {
+				Total float64 `json:"total"` // Wh
+			} `json:"aenergy"`
+		}
+		err := getJSON(ctx, m.Target+"/rpc/Switch.GetStatus?id=0", &v)
+		return sample{v.APower, v.AEnergy.Total / 1000}, err
+	case KindTasmota:
+		var v struct {
+			StatusSNS struct {
+				Energy struct {
+					Power float64 `json:"Power"`
+					Total float64 `json:"Total"` // kWh
+				} `json:"ENERGY"`
+			} `json:"StatusSNS"`
+		}
+		err := getJSON(ctx, m.Target+"/cm?cmnd=Status%2010", &v)
+		return sample{v.StatusSNS.Energy.Power, v.StatusSNS.Energy.Total}, err
+	case KindHomeWizard:
+		var v struct {
+			ActivePowerW float64 `json:"active_power_w"`
+			TotalImport  float64 `json:"total_power_import_kwh"`
+		}
+		err := getJSON(ctx, m.Target+"/api/v1/data", &v)
+		return sample{v.ActivePowerW, v.TotalImport}, err
+	case KindHA:
+		if ha == nil {
+			return sample{}, fmt.Errorf("meter %s needs Home Assistant configured", m.Name)
+		}
+		powerID, energyID, _ := strings.Cut(m.Target, "+")
+		var s sample
+		var err error
+		if s.powerW, err = haValue(ctx, ha, powerID); err != nil {
+			return sample{}, err
+		}
+		if energyID != "" {
+			if s.energyKWh, err = haValue(ctx, ha, energyID); err != nil {
+				return sample{}, err
+			}
+		}
+		return s, nil
+	}
+	return sample{}, fmt.Errorf("unknown meter kind %q", m.Kind)
+}
+
+func haValue(ctx context.Context, ha *homeassistant.Client, entityID string) (float64, error) {
+	st, err := ha.State(ctx, entityID)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseFloat(st.State, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s has non-numeric state %q", entityID, st.State)
+	}
+	return v, nil
+}
+
+func getJSON(ctx context.Context, url string, out any) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("creating meter request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("meter request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("meter error: %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding meter response: %w", err)
+	}
+	return nil
+}
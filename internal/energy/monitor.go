@@ -0,0 +1,158 @@
+package energy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"pi-agent/internal/homeassistant"
+	"pi-agent/internal/notify"
+	"pi-agent/internal/store"
+	"pi-agent/internal/tools"
+)
+
+// Monitor samples meters into the database and answers usage questions.
+type Monitor struct {
+	meters   []Meter
+	db       *store.DB
+	ha       *homeassistant.Client // optional; needed for KindHA meters
+	interval time.Duration
+	due      func() bool // optional; see SetPace
+}
+
+// NewMonitor creates a monitor sampling meters at interval.
+func NewMonitor(meters []Meter, db *store.DB, ha *homeassistant.Client, interval time.Duration) *Monitor {
+	return &Monitor{meters: meters, db: db, ha: ha, interval: interval}
+}
+
+// SetPace makes the monitor ask due on each tick whether to sample, so
+// sampling can slow down, e.g. on battery.
+func (m *Monitor) SetPace(due func() bool) {
+	m.due = due
+}
+
+// Run samples all meters until ctx is cancelled.
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		if m.due == nil || m.due() {
+			m.sample(ctx)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Monitor) sample(ctx context.Context) {
+	now := time.Now()
+	for _, meter := range m.meters {
+		s, err := meter.read(ctx, m.ha)
+		if err != nil {
+			log.Printf("energy meter %s: %v", meter.Name, err)
+			continue
+		}
+		reading := store.EnergyReading{Meter: meter.Name, ReadAt: now, PowerW: s.powerW, EnergyKWh: s.energyKWh}
+		if err := m.db.AddEnergyReading(reading); err != nil {
+			log.Printf("energy meter %s: %v", meter.Name, err)
+		}
+	}
+}
+
+// periods maps the period names accepted by the tools to their length.
+var periods = map[string]time.Duration{
+	"1h": time.Hour, "24h": 24 * time.Hour, "7d": 7 * 24 * time.Hour, "30d": 30 * 24 * time.Hour,
+}
+
+// Tools returns model-facing tools for energy use.
+func (m *Monitor) Tools() []tools.Tool {
+	return []tools.Tool{
+		tools.New("current_power", "Get the current power draw of each energy meter.", tools.NoParams,
+			func(ctx context.Context, _ json.RawMessage) (string, error) {
+				var b strings.Builder
+				for _, meter := range m.meters {
+					s, err := meter.read(ctx, m.ha)
+					if err != nil {
+						fmt.Fprintf(&b, "%s: unavailable (%v)\n", meter.Name, err)
+						continue
+					}
+					fmt.Fprintf(&b, "%s: %.0f W\n", meter.Name, s.powerW)
+				}
+				return b.String(), nil
+			}),
+		tools.New("energy_usage", "Get energy consumption, average and peak power per meter over a recent period.",
+			`{"type":"object","properties":{
+				"period":{"type":"string","enum":["1h","24h","7d","30d"]},
+				"meter":{"type":"string","description":"optional meter name; all meters when omitted"}
+			},"required":["period"]}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var in struct {
+					Period string `json:"period"`
+					Meter  string `json:"meter"`
+				}
+				if err := tools.Decode(args, &in); err != nil {
+					return "", err
+				}
+				d, ok := periods[in.Period]
+				if !ok {
+					return "", fmt.Errorf("unknown period %q", in.Period)
+				}
+				now := time.Now()
+				stats, err := m.db.EnergyStats(in.Meter, now.Add(-d), now)
+				if err != nil {
+					return "", err
+				}
+				return formatStats(stats), nil
+			}),
+	}
+}
+
+func formatStats(stats []store.EnergyStats) string {
+	if len(stats) == 0 {
+		return "No readings in this period."
+	}
+	var b strings.Builder
+	for _, st := range stats {
+		fmt.Fprintf(&b, "%s: avg %.0f W, peak %.0f W", st.Meter, st.AvgPowerW, st.PeakPowerW)
+		if st.ConsumedKWh > 0 {
+			fmt.Fprintf(&b, ", %.2f kWh used", st.ConsumedKWh)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// WeeklyReport has the model write a short report comparing the last week
+// with the one before, and delivers it as a notification.
+func (m *Monitor) WeeklyReport(ctx context.Context, complete func(ctx context.Context, prompt string) (string, error), n notify.Notifier) error {
+	now := time.Now()
+	week := 7 * 24 * time.Hour
+	thisWeek, err := m.db.EnergyStats("", now.Add(-week), now)
+	if err != nil {
+		return err
+	}
+	lastWeek, err := m.db.EnergyStats("", now.Add(-2*week), now.Add(-week))
+	if err != nil {
+		return err
+	}
+
+	prompt := fmt.Sprintf(`Write a short weekly household energy report (at most 5 sentences) for a phone notification.
+Highlight the biggest consumers, notable changes from the previous week, and one practical saving tip if the data suggests one.
+
+This week:
+%s
+Previous week:
+%s`, formatStats(thisWeek), formatStats(lastWeek))
+
+	report, err := complete(ctx, prompt)
+	if err != nil {
+		return fmt.Errorf("generating energy report: %w", err)
+	}
+	return n.Notify(ctx, notify.Message{Title: "Weekly energy report", Body: report, Priority: notify.PriorityLow, Tags: []string{"zap"}})
+}
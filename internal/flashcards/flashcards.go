@@ -0,0 +1,506 @@
+// Package flashcards keeps decks of flashcards and quizzes users on them,
+// scheduling each card's next review per user with the SM-2 spaced
+// repetition algorithm: cards answered well come back after growing
+// intervals, and missed cards come back the next day.
+package flashcards
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"pi-agent/internal/store"
+	"pi-agent/internal/tools"
+)
+
+// ErrNoQuiz is returned when the conversation has no quiz in progress.
+var ErrNoQuiz = errors.New("no quiz is in progress")
+
+// Guest is the user reviews are recorded for when a request names none.
+const Guest = "guest"
+
+const (
+	defaultCards = 10 // cards per quiz
+	maxNewCards  = 5  // unseen cards introduced per quiz
+)
+
+// Grades on SM-2's 0–5 scale.
+const (
+	gradeForgot = 0 // "I don't know"
+	gradeWrong  = 1
+	gradeHinted = 3
+	gradeRight  = 4
+)
+
+// quiz is a quiz in progress in a conversation.
+type quiz struct {
+	user    string
+	deck    string
+	cards   []store.Flashcard
+	pos     int
+	hinted  bool
+	retried map[int64]bool // missed cards already asked again
+	right   int
+	asked   int
+}
+
+// Manager stores decks and runs quizzes, one per conversation. Quizzes in
+// progress are held in memory; the review history is in the database.
+type Manager struct {
+	db  *store.DB
+	now func() time.Time
+
+	mu      sync.Mutex
+	quizzes map[string]*quiz
+}
+
+// New returns a manager keeping decks in db.
+func New(db *store.DB) *Manager {
+	return &Manager{db: db, now: time.Now, quizzes: make(map[string]*quiz)}
+}
+
+// Add adds cards to a deck, creating the deck if needed, and returns how
+// many were new. Cards whose front is already in the deck get the new
+// answer.
+func (m *Manager) Add(deck string, cards []store.Flashcard) (int, error) {
+	deck = strings.TrimSpace(deck)
+	if deck == "" {
+		return 0, errors.New("deck is required")
+	}
+	dk, err := m.db.Deck(deck, true)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, c := range cards {
+		c.Front, c.Back = strings.TrimSpace(c.Front), strings.TrimSpace(c.Back)
+		if c.Front == "" || c.Back == "" {
+			return n, errors.New("every card needs a front and a back")
+		}
+		c.DeckID = dk.ID
+		added, err := m.db.AddFlashcard(&c)
+		if err != nil {
+			return n, err
+		}
+		if added {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Start begins a quiz for user on the cards of a deck due for review, up
+// to count of them, and returns the first question.
+func (m *Manager) Start(conv, user, deck string, count int) (string, error) {
+	if user == "" {
+		user = Guest
+	}
+	if count <= 0 {
+		count = defaultCards
+	}
+	dk, err := m.db.Deck(strings.TrimSpace(deck), false)
+	if errors.Is(err, store.ErrNotFound) {
+		return "", fmt.Errorf("there is no %q deck", deck)
+	}
+	if err != nil {
+		return "", err
+	}
+	cards, err := m.db.DueFlashcards(dk.ID, user, m.now(), count, maxNewCards)
+	if err != nil {
+		return "", err
+	}
+	if len(cards) == 0 {
+		return fmt.Sprintf("Nothing in %s is due for review, %s. Come back later!", dk.Name, user), nil
+	}
+	q := &quiz{user: user, deck: dk.Name, cards: cards, retried: make(map[int64]bool)}
+	m.mu.Lock()
+	m.quizzes[conv] = q
+	m.mu.Unlock()
+	return fmt.Sprintf("Quiz time! %d %s from %s. First: %s", len(cards), plural(len(cards), "card"), dk.Name, cards[0].Front), nil
+}
+
+// Active reports whether the conversation has a quiz in progress.
+func (m *Manager) Active(conv string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.quizzes[conv] != nil
+}
+
+// Question repeats the current question.
+func (m *Manager) Question(conv string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	q := m.quizzes[conv]
+	if q == nil {
+		return "", ErrNoQuiz
+	}
+	return q.cards[q.pos].Front, nil
+}
+
+// Hint gives the first letters of the answer. A correct answer after a
+// hint counts for less.
+func (m *Manager) Hint(conv string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	q := m.quizzes[conv]
+	if q == nil {
+		return "", ErrNoQuiz
+	}
+	q.hinted = true
+	answer := []rune(alternatives(q.cards[q.pos].Back)[0])
+	n := max(1, len(answer)/3)
+	return fmt.Sprintf("It starts with %q.", string(answer[:n])), nil
+}
+
+// Answer checks an answer to the current question, records the review
+// and returns the verdict followed by the next question.
+func (m *Manager) Answer(conv, answer string) (string, error) {
+	return m.grade(conv, func(c store.Flashcard, hinted bool) (int, string) {
+		switch {
+		case !matches(answer, c.Back):
+			return gradeWrong, fmt.Sprintf("Not quite, it's %s.", alternatives(c.Back)[0])
+		case hinted:
+			return gradeHinted, "That's right!"
+		}
+		return gradeRight, "Correct!"
+	})
+}
+
+// GiveUp reveals the answer to the current question.
+func (m *Manager) GiveUp(conv string) (string, error) {
+	return m.grade(conv, func(c store.Flashcard, _ bool) (int, string) {
+		return gradeForgot, fmt.Sprintf("It's %s.", alternatives(c.Back)[0])
+	})
+}
+
+// Skip moves on without recording a review.
+func (m *Manager) Skip(conv string) (string, error) {
+	return m.grade(conv, func(store.Flashcard, bool) (int, string) { return -1, "Skipped." })
+}
+
+// grade records the grade f gives the current card, with -1 recording
+// nothing, and moves to the next question. Missed cards are asked once
+// more at the end of the quiz, without being recorded again.
+func (m *Manager) grade(conv string, f func(c store.Flashcard, hinted bool) (grade int, verdict string)) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	q := m.quizzes[conv]
+	if q == nil {
+		return "", ErrNoQuiz
+	}
+	c := q.cards[q.pos]
+	grade, reply := f(c, q.hinted)
+	retry := q.retried[c.ID]
+	if grade >= 0 && !retry {
+		q.asked++
+		if grade >= gradeHinted {
+			q.right++
+		}
+		if err := m.review(c.ID, q.user, grade); err != nil {
+			return "", err
+		}
+	}
+	if grade >= 0 && grade < gradeHinted && !retry {
+		q.retried[c.ID] = true
+		q.cards = append(q.cards, c)
+	}
+
+	q.pos++
+	q.hinted = false
+	if q.pos == len(q.cards) {
+		delete(m.quizzes, conv)
+		return reply + " " + summary(q), nil
+	}
+	next := q.cards[q.pos]
+	if q.retried[next.ID] {
+		return reply + " Let's try one again: " + next.Front, nil
+	}
+	return reply + " Next: " + next.Front, nil
+}
+
+func summary(q *quiz) string {
+	if q.asked == 0 {
+		return "That's the end of the quiz."
+	}
+	s := fmt.Sprintf("That's the end: %d out of %d right.", q.right, q.asked)
+	switch {
+	case q.right == q.asked:
+		s += " Perfect score!"
+	case q.right*2 >= q.asked:
+		s += " Well done!"
+	default:
+		s += " Keep practicing!"
+	}
+	return s
+}
+
+// review applies an SM-2 grade to a user's review state for a card.
+func (m *Manager) review(cardID int64, user string, grade int) error {
+	r, err := m.db.Review(cardID, user)
+	if errors.Is(err, store.ErrNotFound) {
+		r = &store.Review{CardID: cardID, User: user, Ease: 2.5}
+	} else if err != nil {
+		return err
+	}
+	schedule(r, grade, m.now())
+	return m.db.SaveReview(r)
+}
+
+// schedule updates r for an answer graded on SM-2's 0–5 scale at now.
+func schedule(r *store.Review, grade int, now time.Time) {
+	r.Attempts++
+	if grade >= gradeHinted {
+		r.Correct++
+		r.Reps++
+		switch r.Reps {
+		case 1:
+			r.Interval = 1
+		case 2:
+			r.Interval = 6
+		default:
+			r.Interval = int(math.Round(float64(r.Interval) * r.Ease))
+		}
+	} else {
+		r.Reps = 0
+		r.Interval = 1
+	}
+	q := float64(5 - grade)
+	r.Ease = max(1.3, r.Ease+0.1-q*(0.08+q*0.02))
+	r.ReviewedAt = now
+	r.Due = now.AddDate(0, 0, r.Interval)
+}
+
+// Stop ends the conversation's quiz.
+func (m *Manager) Stop(conv string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	q := m.quizzes[conv]
+	if q == nil {
+		return "", ErrNoQuiz
+	}
+	delete(m.quizzes, conv)
+	return "Quiz stopped. " + summary(q), nil
+}
+
+// Scores describes a user's progress in each deck.
+func (m *Manager) Scores(user string) (string, error) {
+	if user == "" {
+		user = Guest
+	}
+	scores, err := m.db.DeckScores(user, m.now())
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, s := range scores {
+		if s.Cards == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "- %s: %d of %d %s seen", s.Deck, s.Seen, s.Cards, plural(s.Cards, "card"))
+		if s.Attempts > 0 {
+			fmt.Fprintf(&b, ", %d%% right (%d of %d)", 100*s.Correct/s.Attempts, s.Correct, s.Attempts)
+		}
+		if due := s.Due + s.Cards - s.Seen; due > 0 {
+			fmt.Fprintf(&b, ", %d to review", due)
+		}
+		b.WriteString("\n")
+	}
+	if b.Len() == 0 {
+		return "There are no flashcard decks yet.", nil
+	}
+	return user + "'s decks:\n" + b.String(), nil
+}
+
+// alternatives splits an answer into its accepted forms, e.g.
+// "colour/color".
+func alternatives(back string) []string {
+	var out []string
+	for _, a := range strings.FieldsFunc(back, func(r rune) bool { return r == '/' || r == ';' }) {
+		if a = strings.TrimSpace(a); a != "" {
+			out = append(out, a)
+		}
+	}
+	if len(out) == 0 {
+		return []string{back}
+	}
+	return out
+}
+
+var numberWords = map[string]string{
+	"zero": "0", "one": "1", "two": "2", "three": "3", "four": "4", "five": "5",
+	"six": "6", "seven": "7", "eight": "8", "nine": "9", "ten": "10",
+	"eleven": "11", "twelve": "12", "thirteen": "13", "fourteen": "14", "fifteen": "15",
+	"sixteen": "16", "seventeen": "17", "eighteen": "18", "nineteen": "19", "twenty": "20",
+}
+
+// normalize lowercases an answer, drops punctuation and articles, and
+// spells small numbers as digits, so that spoken and typed answers
+// compare equal.
+func normalize(s string) []string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r > 127:
+			return r
+		case r == '\'':
+			return -1
+		}
+		return ' '
+	}, strings.ToLower(s))
+	var out []string
+	for _, w := range strings.Fields(s) {
+		switch w {
+		case "a", "an", "the":
+			continue
+		}
+		if d, ok := numberWords[w]; ok {
+			w = d
+		}
+		out = append(out, w)
+	}
+	return out
+}
+
+// matches reports whether an answer gives any accepted form of back, on
+// its own or within a short sentence ("I think it's Paris").
+func matches(answer, back string) bool {
+	got := normalize(answer)
+	for _, alt := range alternatives(back) {
+		want := normalize(alt)
+		if len(want) == 0 {
+			continue
+		}
+		for i := 0; i+len(want) <= len(got); i++ {
+			if strings.Join(got[i:i+len(want)], " ") == strings.Join(want, " ") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
+
+// user returns the user a tool call is for: the one named in the
+// arguments, such as a child a parent is quizzing, or else the user the
+// request is from.
+func user(ctx context.Context, named string) string {
+	if u := strings.TrimSpace(named); u != "" {
+		return u
+	}
+	return tools.User(ctx)
+}
+
+// Tools returns the tools for managing decks and running quizzes.
+func (m *Manager) Tools() []tools.Tool {
+	return []tools.Tool{
+		tools.New("add_flashcards",
+			"Add flashcards to a deck, creating the deck if needed. A card with the same front as an existing one replaces its answer. Separate alternative accepted answers with /.",
+			`{"type":"object","properties":{
+				"deck":{"type":"string"},
+				"cards":{"type":"array","items":{"type":"object","properties":{"front":{"type":"string"},"back":{"type":"string"}},"required":["front","back"]}}
+			},"required":["deck","cards"]}`,
+			m.addTool),
+		tools.New("list_flashcard_decks", "List the flashcard decks with a user's progress and how many cards are due for review.",
+			`{"type":"object","properties":{"user":{"type":"string"}}}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var p struct {
+					User string `json:"user"`
+				}
+				if err := tools.Decode(args, &p); err != nil {
+					return "", err
+				}
+				return m.Scores(user(ctx, p.User))
+			}),
+		tools.New("start_quiz",
+			"Quiz the user on a flashcard deck, asking the cards due for review. Their answers are then checked with quiz_answer.",
+			`{"type":"object","properties":{
+				"deck":{"type":"string"},
+				"count":{"type":"integer","minimum":1,"description":"Cards to ask, default 10"},
+				"user":{"type":"string","description":"Who is being quizzed, if not the current user"}
+			},"required":["deck"]}`,
+			m.startTool),
+		tools.New("quiz_answer",
+			"Check the user's answer to the current quiz question, or reveal it if they give up. Returns the verdict and the next question.",
+			`{"type":"object","properties":{"answer":{"type":"string"},"give_up":{"type":"boolean"}}}`,
+			m.answerTool),
+		tools.New("stop_quiz", "End the quiz in progress.", tools.NoParams,
+			func(ctx context.Context, _ json.RawMessage) (string, error) {
+				return m.Stop(tools.ConversationID(ctx))
+			}),
+		tools.New("delete_flashcard_deck", "Delete a flashcard deck with its cards and everyone's progress in it.",
+			`{"type":"object","properties":{"deck":{"type":"string"}},"required":["deck"]}`,
+			m.deleteTool),
+	}
+}
+
+func (m *Manager) addTool(_ context.Context, args json.RawMessage) (string, error) {
+	var p struct {
+		Deck  string            `json:"deck"`
+		Cards []store.Flashcard `json:"cards"`
+	}
+	if err := tools.Decode(args, &p); err != nil {
+		return "", err
+	}
+	n, err := m.Add(p.Deck, p.Cards)
+	if err != nil {
+		return "", err
+	}
+	if updated := len(p.Cards) - n; updated > 0 {
+		return fmt.Sprintf("Added %d %s to %s and updated %d.", n, plural(n, "card"), p.Deck, updated), nil
+	}
+	return fmt.Sprintf("Added %d %s to %s.", n, plural(n, "card"), p.Deck), nil
+}
+
+func (m *Manager) startTool(ctx context.Context, args json.RawMessage) (string, error) {
+	var p struct {
+		Deck  string `json:"deck"`
+		Count int    `json:"count"`
+		User  string `json:"user"`
+	}
+	if err := tools.Decode(args, &p); err != nil {
+		return "", err
+	}
+	return m.Start(tools.ConversationID(ctx), user(ctx, p.User), p.Deck, p.Count)
+}
+
+func (m *Manager) answerTool(ctx context.Context, args json.RawMessage) (string, error) {
+	var p struct {
+		Answer string `json:"answer"`
+		GiveUp bool   `json:"give_up"`
+	}
+	if err := tools.Decode(args, &p); err != nil {
+		return "", err
+	}
+	conv := tools.ConversationID(ctx)
+	if p.GiveUp {
+		return m.GiveUp(conv)
+	}
+	return m.Answer(conv, p.Answer)
+}
+
+func (m *Manager) deleteTool(_ context.Context, args json.RawMessage) (string, error) {
+	var p struct {
+		Deck string `json:"deck"`
+	}
+	if err := tools.Decode(args, &p); err != nil {
+		return "", err
+	}
+	dk, err := m.db.Deck(p.Deck, false)
+	if err != nil {
+		return "", err
+	}
+	if err := m.db.DeleteDeck(dk.ID); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Deleted %s and its %d %s.", dk.Name, dk.Cards, plural(dk.Cards, "card")), nil
+}
@@ -0,0 +1,43 @@
+// Package gitcmd runs the git command line.
+package gitcmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// timeout bounds each git invocation.
+const timeout = 30 * time.Second
+
+// Run runs git with args in dir, feeding it stdin if non-nil, and returns
+// its standard output. Errors include git's standard error and wrap the
+// *exec.ExitError.
+func Run(ctx context.Context, dir string, stdin []byte, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return string(out), fmt.Errorf("git %s: %w: %s", args[0], err, msg)
+		}
+		return string(out), fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return string(out), nil
+}
+
+// TopLevel returns the root of the work tree containing dir.
+func TopLevel(ctx context.Context, dir string) (string, error) {
+	out, err := Run(ctx, dir, nil, "rev-parse", "--show-toplevel")
+	return strings.TrimSpace(out), err
+}
@@ -0,0 +1,197 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const apiURL = "https://api.github.com"
+
+// Client is a minimal GitHub REST API client authenticated with a
+// personal access token.
+type Client struct {
+	token string
+
+	mu    sync.Mutex
+	login string // cached authenticated user
+}
+
+// NewClient creates a client using the given personal access token.
+func NewClient(token string) *Client {
+	return &Client{token: token}
+}
+
+// Issue is an issue or pull request summary.
+type Issue struct {
+	Number    int       `json:"number"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	State     string    `json:"state"`
+	HTMLURL   string    `json:"html_url"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Comments  int       `json:"comments"`
+	User      struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	PullRequest *struct{} `json:"pull_request"`
+	// RepositoryURL identifies the repo in search results, e.g.
+	// https://api.github.com/repos/owner/name.
+	RepositoryURL string `json:"repository_url"`
+}
+
+// Repo returns the owner/name of the issue's repository.
+func (i Issue) Repo() string {
+	return strings.TrimPrefix(i.RepositoryURL, apiURL+"/repos/")
+}
+
+// Comment is an issue or pull request comment.
+type Comment struct {
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	HTMLURL   string    `json:"html_url"`
+	User      struct {
+		Login string `json:"login"`
+	} `json:"user"`
+}
+
+// Login returns the authenticated user's login.
+func (c *Client) Login(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.login != "" {
+		return c.login, nil
+	}
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := c.do(ctx, "GET", "/user", "", nil, &user); err != nil {
+		return "", err
+	}
+	c.login = user.Login
+	return c.login, nil
+}
+
+// SearchOpen returns open issues or pull requests (kind "issue" or "pr")
+// in repo, or across the authenticated user's repositories when repo is
+// empty. Only items updated since the given time are returned when it is
+// non-zero.
+func (c *Client) SearchOpen(ctx context.Context, repo, kind string, since time.Time) ([]Issue, error) {
+	q := []string{"is:open", "is:" + kind}
+	if repo != "" {
+		q = append(q, "repo:"+repo)
+	} else {
+		login, err := c.Login(ctx)
+		if err != nil {
+			return nil, err
+		}
+		q = append(q, "user:"+login)
+	}
+	if !since.IsZero() {
+		q = append(q, "updated:>="+since.Format("2006-01-02"))
+	}
+	var res struct {
+		Items []Issue `json:"items"`
+	}
+	path := "/search/issues?per_page=30&sort=updated&q=" + url.QueryEscape(strings.Join(q, " "))
+	if err := c.do(ctx, "GET", path, "", nil, &res); err != nil {
+		return nil, err
+	}
+	return res.Items, nil
+}
+
+// Issue returns a single issue or pull request.
+func (c *Client) Issue(ctx context.Context, repo string, number int) (*Issue, error) {
+	var is Issue
+	if err := c.do(ctx, "GET", fmt.Sprintf("/repos/%s/issues/%d", repo, number), "", nil, &is); err != nil {
+		return nil, err
+	}
+	return &is, nil
+}
+
+// Comments returns the most recent comments on an issue or pull request.
+func (c *Client) Comments(ctx context.Context, repo string, number int) ([]Comment, error) {
+	var comments []Comment
+	if err := c.do(ctx, "GET", fmt.Sprintf("/repos/%s/issues/%d/comments?per_page=20", repo, number), "", nil, &comments); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+// Diff returns the unified diff of a pull request.
+func (c *Client) Diff(ctx context.Context, repo string, number int) (string, error) {
+	var diff string
+	err := c.do(ctx, "GET", fmt.Sprintf("/repos/%s/pulls/%d", repo, number), "application/vnd.github.diff", nil, &diff)
+	return diff, err
+}
+
+// AddComment posts a comment on an issue or pull request.
+func (c *Client) AddComment(ctx context.Context, repo string, number int, body string) (*Comment, error) {
+	var comment Comment
+	err := c.do(ctx, "POST", fmt.Sprintf("/repos/%s/issues/%d/comments", repo, number), "", map[string]string{"body": body}, &comment)
+	if err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// do performs an API request. If out is a *string the raw body is stored
+// in it, otherwise the body is decoded as JSON.
+func (c *Client) do(ctx context.Context, method, path, accept string, body, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("marshaling request: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, apiURL+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	if accept == "" {
+		accept = "application/vnd.github+json"
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("github request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		var errResp struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return fmt.Errorf("github error %d: %s", resp.StatusCode, errResp.Message)
+	}
+	if s, ok := out.(*string); ok {
+		data, err := io.ReadAll(resp.Body)
+		*s = string(data)
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding github response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"pi-agent/internal/tools"
+)
+
+// maxDiff caps how much of a pull request diff is returned to the model.
+const maxDiff = 20000
+
+// Tools returns model-facing GitHub tools.
+func (c *Client) Tools() []tools.Tool {
+	return []tools.Tool{
+		tools.New("github_list_open",
+			"List open GitHub issues or pull requests in a repository, or across the user's own repositories when no repo is given.",
+			`{"type":"object","properties":{
+				"kind":{"type":"string","enum":["issue","pr"]},
+				"repo":{"type":"string","description":"owner/name; omit for all of the user's repositories"},
+				"since_days":{"type":"integer","description":"only items updated in the last N days"}
+			},"required":["kind"]}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var in struct {
+					Kind      string `json:"kind"`
+					Repo      string `json:"repo"`
+					SinceDays int    `json:"since_days"`
+				}
+				if err := tools.Decode(args, &in); err != nil {
+					return "", err
+				}
+				var since time.Time
+				if in.SinceDays > 0 {
+					since = time.Now().AddDate(0, 0, -in.SinceDays)
+				}
+				items, err := c.SearchOpen(ctx, in.Repo, in.Kind, since)
+				if err != nil {
+					return "", err
+				}
+				if len(items) == 0 {
+					return "Nothing open.", nil
+				}
+				var b strings.Builder
+				for _, is := range items {
+					fmt.Fprintf(&b, "%s#%d %s (by %s, updated %s, %d comments)\n",
+						is.Repo(), is.Number, is.Title, is.User.Login, is.UpdatedAt.Format("2006-01-02"), is.Comments)
+				}
+				return b.String(), nil
+			}),
+		tools.New("github_read",
+			"Read a GitHub issue or pull request with its description and recent comments.",
+			`{"type":"object","properties":{"repo":{"type":"string"},"number":{"type":"integer"}},"required":["repo","number"]}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var in struct {
+					Repo   string `json:"repo"`
+					Number int    `json:"number"`
+				}
+				if err := tools.Decode(args, &in); err != nil {
+					return "", err
+				}
+				is, err := c.Issue(ctx, in.Repo, in.Number)
+				if err != nil {
+					return "", err
+				}
+				comments, err := c.Comments(ctx, in.Repo, in.Number)
+				if err != nil {
+					return "", err
+				}
+				var b strings.Builder
+				fmt.Fprintf(&b, "#%d %s [%s] by %s\n%s\n\n%s\n", is.Number, is.Title, is.State, is.User.Login, is.HTMLURL, is.Body)
+				for _, cm := range comments {
+					fmt.Fprintf(&b, "\n--- %s on %s:\n%s\n", cm.User.Login, cm.CreatedAt.Format("2006-01-02"), cm.Body)
+				}
+				return b.String(), nil
+			}),
+		tools.New("github_pr_diff", "Get the unified diff of a GitHub pull request.",
+			`{"type":"object","properties":{"repo":{"type":"string"},"number":{"type":"integer"}},"required":["repo","number"]}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var in struct {
+					Repo   string `json:"repo"`
+					Number int    `json:"number"`
+				}
+				if err := tools.Decode(args, &in); err != nil {
+					return "", err
+				}
+				diff, err := c.Diff(ctx, in.Repo, in.Number)
+				if err != nil {
+					return "", err
+				}
+				if len(diff) > maxDiff {
+					diff = diff[:maxDiff] + fmt.Sprintf("\n[diff truncated, %d bytes total]", len(diff))
+				}
+				return diff, nil
+			}),
+		tools.New("github_comment",
+			"Post a comment on a GitHub issue or pull request. Only call this after the user has confirmed the exact comment text.",
+			`{"type":"object","properties":{"repo":{"type":"string"},"number":{"type":"integer"},"body":{"type":"string"}},"required":["repo","number","body"]}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var in struct {
+					Repo   string `json:"repo"`
+					Number int    `json:"number"`
+					Body   string `json:"body"`
+				}
+				if err := tools.Decode(args, &in); err != nil {
+					return "", err
+				}
+				if strings.TrimSpace(in.Body) == "" {
+					return "", fmt.Errorf("comment body is empty")
+				}
+				cm, err := c.AddComment(ctx, in.Repo, in.Number, in.Body)
+				if err != nil {
+					return "", err
+				}
+				return "Comment posted: " + cm.HTMLURL, nil
+			}),
+	}
+}
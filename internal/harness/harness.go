@@ -0,0 +1,100 @@
+// Package harness runs a complete pi-agent in process for end-to-end
+// tests: a fresh database, the engine answering from a scripted mock
+// provider, and the HTTP API on a local test server with a client for it.
+// No network access or credentials are needed.
+//
+//	h := harness.New(t, harness.Options{Mock: &chat.Mock{Steps: []chat.MockStep{{Reply: "Hi!"}}}})
+//	reply, err := h.Client.Chat(ctx, client.Request{Message: "Hello"}, nil)
+package harness
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+
+	"pi-agent/client"
+	"pi-agent/engine"
+	"pi-agent/internal/chat"
+	"pi-agent/internal/policy"
+	"pi-agent/internal/server"
+	"pi-agent/internal/store"
+)
+
+// DefaultConversation is the conversation messages go to when a request
+// names none.
+const DefaultConversation = "test"
+
+// TB is the part of testing.TB the harness uses, so that the harness does
+// not depend on package testing itself; a *testing.T or *testing.B is one.
+type TB interface {
+	Helper()
+	Fatalf(format string, args ...any)
+	Cleanup(func())
+	TempDir() string
+}
+
+// Options configures a Harness. Engine and Server are used as given,
+// except that the engine's provider is always the mock.
+type Options struct {
+	Mock   *chat.Mock // default an empty script that echoes each message
+	Engine engine.Config
+	Server server.Config
+	// AdminPIN, if set, enforces the personas' restrictions as the
+	// server does, with this PIN for overrides.
+	AdminPIN string
+}
+
+// Harness is a running pi-agent and a client connected to it.
+type Harness struct {
+	Mock   *chat.Mock
+	DB     *store.DB
+	Engine *engine.Engine
+	Server *httptest.Server
+	Client *client.Client
+}
+
+// New starts a pi-agent for the duration of a test. It is shut down and
+// its database removed when the test ends.
+func New(tb TB, opts Options) *Harness {
+	tb.Helper()
+	if opts.Mock == nil {
+		opts.Mock = &chat.Mock{}
+	}
+	db, err := store.Open(filepath.Join(tb.TempDir(), "conversations.db"))
+	if err != nil {
+		tb.Fatalf("opening database: %v", err)
+	}
+	tb.Cleanup(func() { db.Close() })
+
+	opts.Engine.Provider = opts.Mock
+	if opts.AdminPIN != "" {
+		if opts.Engine.Policy, err = policy.New(opts.Engine.Profiles.Personas, opts.AdminPIN, db); err != nil {
+			tb.Fatalf("loading restrictions: %v", err)
+		}
+	}
+	eng := engine.New(opts.Engine, nil, db)
+	if opts.Server.ConversationID == "" {
+		opts.Server.ConversationID = DefaultConversation
+	}
+	ts := httptest.NewServer(server.New(opts.Server, eng).Handler())
+	// Registered after the database's cleanup, so it runs first.
+	tb.Cleanup(ts.Close)
+
+	return &Harness{
+		Mock:   opts.Mock,
+		DB:     db,
+		Engine: eng,
+		Server: ts,
+		Client: client.New(ts.URL),
+	}
+}
+
+// Messages returns the stored messages of a conversation, failing the
+// test on error.
+func (h *Harness) Messages(tb TB, conversationID string) []store.Message {
+	tb.Helper()
+	msgs, err := h.DB.Messages(conversationID)
+	if err != nil {
+		tb.Fatalf("loading messages: %v", err)
+	}
+	return msgs
+}
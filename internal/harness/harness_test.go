@@ -0,0 +1,359 @@
+package harness_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"pi-agent/client"
+	"pi-agent/engine"
+	"pi-agent/internal/chat"
+	"pi-agent/internal/config"
+	"pi-agent/internal/harness"
+	"pi-agent/internal/intent"
+	"pi-agent/internal/server"
+	"pi-agent/internal/store"
+)
+
+func TestChat(t *testing.T) {
+	h := harness.New(t, harness.Options{Mock: &chat.Mock{Steps: []chat.MockStep{
+		{Match: "weather", Reply: "It is sunny in Lisbon today."},
+	}}})
+	ctx := context.Background()
+
+	var streamed []string
+	reply, err := h.Client.Chat(ctx, client.Request{Message: "What is the weather like?"}, func(s string) {
+		streamed = append(streamed, s)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "It is sunny in Lisbon today."; reply.Content != want {
+		t.Errorf("reply = %q, want %q", reply.Content, want)
+	}
+	if len(streamed) < 2 || strings.Join(streamed, "") != reply.Content {
+		t.Errorf("streamed %q, want the reply in several pieces", streamed)
+	}
+
+	// The step is used up, so the next message is echoed.
+	reply, err = h.Client.Chat(ctx, client.Request{Message: "And the weather tomorrow?"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "You said: And the weather tomorrow?"; reply.Content != want {
+		t.Errorf("second reply = %q, want %q", reply.Content, want)
+	}
+
+	msgs := h.Messages(t, harness.DefaultConversation)
+	want := []struct {
+		role    store.Role
+		content string
+	}{
+		{store.RoleUser, "What is the weather like?"},
+		{store.RoleAssistant, "It is sunny in Lisbon today."},
+		{store.RoleUser, "And the weather tomorrow?"},
+		{store.RoleAssistant, "You said: And the weather tomorrow?"},
+	}
+	if len(msgs) != len(want) {
+		t.Fatalf("stored %d messages, want %d", len(msgs), len(want))
+	}
+	for i, m := range msgs {
+		if m.Role != want[i].role || m.Content != want[i].content {
+			t.Errorf("message %d = %s %q, want %s %q", i, m.Role, m.Content, want[i].role, want[i].content)
+		}
+	}
+
+	// The second request carried the first exchange as history.
+	reqs := h.Mock.Requests()
+	if len(reqs) != 2 {
+		t.Fatalf("provider got %d requests, want 2", len(reqs))
+	}
+	if n := len(reqs[1].Messages); n < 3 {
+		t.Errorf("second request has %d messages, want the history too", n)
+	}
+}
+
+func TestChatConversations(t *testing.T) {
+	h := harness.New(t, harness.Options{})
+	ctx := context.Background()
+	for _, conv := range []string{"kitchen", "garage"} {
+		if _, err := h.Client.Chat(ctx, client.Request{Message: "hello " + conv, ConversationID: conv}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, conv := range []string{"kitchen", "garage"} {
+		msgs := h.Messages(t, conv)
+		if len(msgs) != 2 || msgs[0].Content != "hello "+conv {
+			t.Errorf("%s: stored %+v, want its own exchange only", conv, msgs)
+		}
+	}
+	if msgs := h.Messages(t, harness.DefaultConversation); len(msgs) != 0 {
+		t.Errorf("default conversation has %d messages, want none", len(msgs))
+	}
+}
+
+func TestChatProviderError(t *testing.T) {
+	h := harness.New(t, harness.Options{Mock: &chat.Mock{ChunkSize: 4, Steps: []chat.MockStep{
+		{Reply: "Partial answer", Error: "model overloaded", ErrorAfter: 2},
+	}}})
+
+	var streamed string
+	reply, err := h.Client.Chat(context.Background(), client.Request{Message: "Tell me a story"}, func(s string) {
+		streamed += s
+	})
+	var e *client.Error
+	if !errors.As(err, &e) || !strings.Contains(e.Message, "model overloaded") {
+		t.Fatalf("err = %v, want the provider's error", err)
+	}
+	if want := "Partial "; streamed != want || reply.Content != want {
+		t.Errorf("streamed %q, reply %q, want %q before the error", streamed, reply.Content, want)
+	}
+}
+
+func TestChatIdempotent(t *testing.T) {
+	h := harness.New(t, harness.Options{Mock: &chat.Mock{Steps: []chat.MockStep{
+		{Reply: "Added milk to the list."},
+		{Reply: "Added milk twice!"},
+	}}})
+	ctx := context.Background()
+	req := client.Request{Message: "Add milk to the shopping list", IdempotencyKey: "retry-1"}
+
+	for i := range 2 {
+		reply, err := h.Client.Chat(ctx, req, nil)
+		if err != nil {
+			t.Fatalf("attempt %d: %v", i+1, err)
+		}
+		if want := "Added milk to the list."; reply.Content != want {
+			t.Errorf("attempt %d: reply = %q, want %q", i+1, reply.Content, want)
+		}
+	}
+	if n := len(h.Mock.Requests()); n != 1 {
+		t.Errorf("provider got %d requests, want 1", n)
+	}
+	if n := len(h.Messages(t, harness.DefaultConversation)); n != 2 {
+		t.Errorf("stored %d messages, want 2", n)
+	}
+
+	// The same key with another message is refused.
+	req.Message = "Add eggs to the shopping list"
+	_, err := h.Client.Chat(ctx, req, nil)
+	var e *client.Error
+	if !errors.As(err, &e) || e.Status != http.StatusUnprocessableEntity {
+		t.Errorf("reused key: err = %v, want 422", err)
+	}
+}
+
+func TestChatIdempotentAfterError(t *testing.T) {
+	h := harness.New(t, harness.Options{Mock: &chat.Mock{ChunkSize: 4, Steps: []chat.MockStep{
+		{Reply: "Partial answer", Error: "model overloaded", ErrorAfter: 2},
+		{Reply: "The whole story."},
+	}}})
+	ctx := context.Background()
+	req := client.Request{Message: "Tell me a story", IdempotencyKey: "retry-1"}
+
+	if _, err := h.Client.Chat(ctx, req, nil); err == nil {
+		t.Fatal("first attempt succeeded, want the provider's error")
+	}
+	// The error came after the 200, so the retry must not replay it.
+	reply, err := h.Client.Chat(ctx, req, nil)
+	if err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if want := "The whole story."; reply.Content != want {
+		t.Errorf("retry: reply = %q, want %q", reply.Content, want)
+	}
+}
+
+func TestEncryptedConversation(t *testing.T) {
+	h := harness.New(t, harness.Options{})
+	ctx := context.Background()
+	key := client.NewConversationKey()
+
+	if _, err := h.Client.Chat(ctx, client.Request{Message: "my PIN is 4711", ConversationID: "diary"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Client.EncryptConversation(ctx, "diary", key); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range h.Messages(t, "diary") {
+		if strings.Contains(m.Content, "4711") {
+			t.Errorf("stored %s message %q in plain text", m.Role, m.Content)
+		}
+	}
+
+	_, err := h.Client.Chat(ctx, client.Request{Message: "what is my PIN?", ConversationID: "diary"}, nil)
+	var e *client.Error
+	if !errors.As(err, &e) || e.Status != http.StatusForbidden {
+		t.Errorf("without the key: err = %v, want 403", err)
+	}
+	_, err = h.Client.Chat(ctx, client.Request{Message: "what is my PIN?", ConversationID: "diary", ConversationKey: client.NewConversationKey()}, nil)
+	if err == nil {
+		t.Error("with the wrong key: no error")
+	}
+
+	reply, err := h.Client.Chat(ctx, client.Request{Message: "what is my PIN?", ConversationID: "diary", ConversationKey: key}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "You said: what is my PIN?"; reply.Content != want {
+		t.Errorf("reply = %q, want %q", reply.Content, want)
+	}
+	// The provider saw the decrypted history.
+	reqs := h.Mock.Requests()
+	last := reqs[len(reqs)-1]
+	var history string
+	for _, m := range last.Messages {
+		history += m.Content + "\n"
+	}
+	if !strings.Contains(history, "my PIN is 4711") {
+		t.Errorf("provider history %q, want the earlier message decrypted", history)
+	}
+
+	if err := h.Client.DecryptConversation(ctx, "diary", key); err != nil {
+		t.Fatal(err)
+	}
+	msgs := h.Messages(t, "diary")
+	if len(msgs) != 4 || msgs[0].Content != "my PIN is 4711" {
+		t.Errorf("after decrypting, stored %+v", msgs)
+	}
+}
+
+func TestIntentToolScope(t *testing.T) {
+	intents := intent.NewRouter()
+	var switched int
+	intents.AddTool("device.power", "control_device", `^turn off the heater$`, func(context.Context, string, map[string]string) (string, error) {
+		switched++
+		return "Heater off.", nil
+	})
+	h := harness.New(t, harness.Options{
+		Engine: engine.Config{Profiles: config.Profiles{Personas: []config.Persona{
+			{Name: "kids", Tools: &config.ToolScope{Deny: []string{"control_device"}}},
+		}}},
+		Server: server.Config{Intents: intents},
+	})
+	ctx := context.Background()
+
+	reply, err := h.Client.Chat(ctx, client.Request{Message: "Turn off the heater", Persona: "kids"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if switched != 0 || !strings.Contains(reply.Content, `tool "control_device" may not be used here (restricted by persona kids)`) {
+		t.Errorf("kids persona: switched %d times, reply %q", switched, reply.Content)
+	}
+	denials, err := h.DB.ToolDenialsSince(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(denials) != 1 || denials[0].Tool != "control_device" || denials[0].Scope != "persona kids" {
+		t.Errorf("denials = %+v, want the intent's tool recorded", denials)
+	}
+
+	if reply, err := h.Client.Chat(ctx, client.Request{Message: "Turn off the heater"}, nil); err != nil || reply.Content != "Heater off." || switched != 1 {
+		t.Errorf("default persona: reply %v, %v, switched %d times", reply, err, switched)
+	}
+}
+
+func TestPersonaFollowsUser(t *testing.T) {
+	personas := []config.Persona{
+		{Name: "kids", MaxTier: "fast", Restrictions: &config.Restrictions{BlockedTopics: []string{"horror films"}}},
+		{Name: "capped", MaxTier: "fast"},
+		{Name: "homework", MaxTier: "fast"},
+		{Name: "default"},
+	}
+	h := harness.New(t, harness.Options{
+		AdminPIN: "1234",
+		Engine: engine.Config{Profiles: config.Profiles{
+			Personas:   personas,
+			ModelTiers: []config.ModelTier{{Name: "fast", Model: "mini"}, {Name: "smart", Model: "large"}},
+			Users:      []config.User{{Name: "sam", Persona: "kids"}, {Name: "alex", Persona: "capped"}},
+		}},
+	})
+	ctx := context.Background()
+
+	tests := []struct {
+		user, persona, pin string
+		want               int // the refusal's status, or 0
+	}{
+		{"sam", "", "", 0},
+		{"sam", "kids", "", 0},
+		{"sam", "default", "", http.StatusForbidden},
+		{"sam", "homework", "", http.StatusForbidden},
+		{"sam", "default", "0000", http.StatusForbidden},
+		{"sam", "default", "1234", 0},
+		{"alex", "homework", "", 0},
+		{"alex", "default", "", http.StatusForbidden},
+		{"alex", "default", "1234", 0},
+		{"robin", "default", "", 0},
+	}
+	for _, tt := range tests {
+		_, err := h.Client.Chat(ctx, client.Request{Message: "hello", User: tt.user, Persona: tt.persona, AdminPIN: tt.pin}, nil)
+		var ce *client.Error
+		got := 0
+		if errors.As(err, &ce) {
+			got = ce.Status
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s as %q with PIN %q: status %d, want %d", tt.user, tt.persona, tt.pin, got, tt.want)
+		}
+	}
+}
+
+func TestPersonaCommandRestricted(t *testing.T) {
+	h := harness.New(t, harness.Options{
+		AdminPIN: "1234",
+		Engine: engine.Config{Profiles: config.Profiles{Personas: []config.Persona{
+			{Name: "kids", Restrictions: &config.Restrictions{BlockedTopics: []string{"horror films"}}},
+			{Name: "work"},
+		}}},
+	})
+	ctx := context.Background()
+	command := func(msg, pin string) string {
+		t.Helper()
+		reply, err := h.Client.Chat(ctx, client.Request{Message: msg, AdminPIN: pin}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return reply.Content
+	}
+
+	if got := command("/persona kids", ""); got != "Switched this conversation to kids." {
+		t.Fatalf("/persona kids: %q", got)
+	}
+	for _, msg := range []string{"/persona work", "/persona default"} {
+		if got, want := command(msg, "0000"), "Sorry, /persona failed: restricted: leaving the kids persona takes the admin PIN"; got != want {
+			t.Errorf("%s: %q, want %q", msg, got, want)
+		}
+	}
+	if got := command("/persona talk about horror films", ""); !strings.Contains(got, `"horror films" is not something the kids persona talks about`) {
+		t.Errorf("blocked topic: %q", got)
+	}
+	if got := command("/persona", ""); got != "This conversation talks to kids." {
+		t.Errorf("after refusals: %q", got)
+	}
+	if got := command("/persona work", "1234"); got != "Switched this conversation to work." {
+		t.Errorf("with the PIN: %q", got)
+	}
+}
+
+func TestRememberPrivate(t *testing.T) {
+	h := harness.New(t, harness.Options{})
+	ctx := context.Background()
+	if err := h.DB.SetPrivate("secret", true); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := h.Client.Chat(ctx, client.Request{Message: "/remember I am planning a surprise party", ConversationID: "secret", User: "sam"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Sorry, /remember failed: nothing is remembered from private conversations"; reply.Content != want {
+		t.Errorf("reply %q, want %q", reply.Content, want)
+	}
+	if memories, err := h.DB.Memories("sam"); err != nil || len(memories) != 0 {
+		t.Errorf("memories = %v, %v; want none", memories, err)
+	}
+}
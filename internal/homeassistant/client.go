@@ -0,0 +1,138 @@
+package homeassistant
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statesTTL is how long the entity list is cached between lookups.
+const statesTTL = 30 * time.Second
+
+// State is a Home Assistant entity state.
+type State struct {
+	EntityID    string         `json:"entity_id"`
+	State       string         `json:"state"`
+	Attributes  map[string]any `json:"attributes"`
+	LastChanged time.Time      `json:"last_changed"`
+}
+
+// Name returns the entity's friendly name, falling back to its ID.
+func (s State) Name() string {
+	if n, ok := s.Attributes["friendly_name"].(string); ok && n != "" {
+		return n
+	}
+	return s.EntityID
+}
+
+// Domain returns the entity domain, e.g. "light" for "light.kitchen".
+func (s State) Domain() string {
+	domain, _, _ := strings.Cut(s.EntityID, ".")
+	return domain
+}
+
+// Client talks to the Home Assistant REST API using a long-lived access
+// token.
+type Client struct {
+	baseURL string
+	token   string
+
+	mu       sync.Mutex
+	states   []State
+	cachedAt time.Time
+}
+
+// NewClient creates a client for the Home Assistant instance at baseURL,
+// e.g. "http://homeassistant.local:8123".
+func NewClient(baseURL, token string) *Client {
+	return &Client{baseURL: strings.TrimRight(baseURL, "/"), token: token}
+}
+
+// States returns all entity states. Results are cached briefly since
+// device lookups by name happen on every command.
+func (c *Client) States(ctx context.Context) ([]State, error) {
+	c.mu.Lock()
+	if c.states != nil && time.Since(c.cachedAt) < statesTTL {
+		states := c.states
+		c.mu.Unlock()
+		return states, nil
+	}
+	c.mu.Unlock()
+
+	var states []State
+	if err := c.do(ctx, "GET", "/api/states", nil, &states); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.states, c.cachedAt = states, time.Now()
+	c.mu.Unlock()
+	return states, nil
+}
+
+// State returns the current state of a single entity.
+func (c *Client) State(ctx context.Context, entityID string) (*State, error) {
+	var st State
+	if err := c.do(ctx, "GET", "/api/states/"+entityID, nil, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// CallService invokes a service such as light.turn_on and returns the
+// states that changed as a result.
+func (c *Client) CallService(ctx context.Context, domain, service string, data map[string]any) ([]State, error) {
+	var changed []State
+	if err := c.do(ctx, "POST", "/api/services/"+domain+"/"+service, data, &changed); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.states = nil // force a refresh so follow-up lookups see the change
+	c.mu.Unlock()
+	return changed, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("marshaling request: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("home assistant request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("home assistant error %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding home assistant response: %w", err)
+	}
+	return nil
+}
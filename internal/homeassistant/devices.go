@@ -0,0 +1,211 @@
+package homeassistant
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"pi-agent/internal/tools"
+)
+
+// controllable lists the entity domains exposed as devices. These cover
+// Zigbee and Z-Wave devices paired through ZHA, Zigbee2MQTT or Z-Wave JS,
+// since Home Assistant presents them all as ordinary entities.
+var controllable = []string{"light", "switch", "fan", "cover", "lock", "climate", "media_player", "scene", "script"}
+
+// Devices returns the controllable entities.
+func (c *Client) Devices(ctx context.Context) ([]State, error) {
+	states, err := c.States(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out []State
+	for _, st := range states {
+		if slices.Contains(controllable, st.Domain()) {
+			out = append(out, st)
+		}
+	}
+	return out, nil
+}
+
+// FindDevice resolves a human name such as "the living room lights" to a
+// controllable entity. See FindEntity for the matching rules.
+func (c *Client) FindDevice(ctx context.Context, name string) (*State, error) {
+	return c.FindEntity(ctx, name, controllable...)
+}
+
+// FindEntity resolves a human name to an entity in one of the given
+// domains. An exact friendly-name or entity ID match wins; otherwise every
+// word of the name must appear in exactly one entity's friendly name.
+func (c *Client) FindEntity(ctx context.Context, name string, domains ...string) (*State, error) {
+	states, err := c.States(ctx)
+	if err != nil {
+		return nil, err
+	}
+	want := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "the ")
+
+	var partial []State
+	for _, st := range states {
+		if !slices.Contains(domains, st.Domain()) {
+			continue
+		}
+		friendly := strings.ToLower(st.Name())
+		if friendly == want || st.EntityID == want {
+			return &st, nil
+		}
+		if containsWords(friendly, want) {
+			partial = append(partial, st)
+		}
+	}
+	switch len(partial) {
+	case 0:
+		return nil, fmt.Errorf("nothing called %q", name)
+	case 1:
+		return &partial[0], nil
+	default:
+		names := make([]string, len(partial))
+		for i, st := range partial {
+			names[i] = st.Name()
+		}
+		return nil, fmt.Errorf("%q matches several entities: %s", name, strings.Join(names, ", "))
+	}
+}
+
+// containsWords reports whether every word of sub appears in s, ignoring
+// plural "s" suffixes.
+func containsWords(s, sub string) bool {
+	have := make(map[string]bool)
+	for _, w := range strings.Fields(s) {
+		have[strings.TrimSuffix(w, "s")] = true
+	}
+	words := strings.Fields(sub)
+	for _, w := range words {
+		if !have[strings.TrimSuffix(w, "s")] {
+			return false
+		}
+	}
+	return len(words) > 0
+}
+
+// Command is a device action.
+type Command struct {
+	Action        string   `json:"action"`                   // turn_on, turn_off, toggle, open, close, lock, unlock, set_temperature
+	BrightnessPct *int     `json:"brightness_pct,omitempty"` // lights only
+	Temperature   *float64 `json:"temperature,omitempty"`    // climate only
+}
+
+// Control applies a command to a device and returns a confirmation
+// describing the resulting state.
+func (c *Client) Control(ctx context.Context, dev *State, cmd Command) (string, error) {
+	domain := dev.Domain()
+	service := cmd.Action
+	data := map[string]any{"entity_id": dev.EntityID}
+
+	switch cmd.Action {
+	case "turn_on", "turn_off", "toggle":
+		if domain == "cover" {
+			service = map[string]string{"turn_on": "open_cover", "turn_off": "close_cover", "toggle": "toggle"}[cmd.Action]
+		}
+		if domain == "scene" || domain == "script" {
+			service = "turn_on"
+		}
+	case "open", "close":
+		if domain != "cover" {
+			return "", fmt.Errorf("%s cannot be opened or closed", dev.Name())
+		}
+		service = cmd.Action + "_cover"
+	case "lock", "unlock":
+		if domain != "lock" {
+			return "", fmt.Errorf("%s is not a lock", dev.Name())
+		}
+	case "set_temperature":
+		if domain != "climate" || cmd.Temperature == nil {
+			return "", fmt.Errorf("set_temperature needs a climate device and a temperature")
+		}
+		data["temperature"] = *cmd.Temperature
+	default:
+		return "", fmt.Errorf("unsupported action %q", cmd.Action)
+	}
+	if cmd.BrightnessPct != nil {
+		if domain != "light" {
+			return "", fmt.Errorf("%s does not support brightness", dev.Name())
+		}
+		service = "turn_on"
+		data["brightness_pct"] = *cmd.BrightnessPct
+	}
+
+	if _, err := c.CallService(ctx, domain, service, data); err != nil {
+		return "", err
+	}
+	st, err := c.State(ctx, dev.EntityID)
+	if err != nil {
+		return "", err
+	}
+	return Describe(st), nil
+}
+
+// Describe summarizes an entity's state in a sentence.
+func Describe(st *State) string {
+	out := fmt.Sprintf("%s is %s", st.Name(), strings.ReplaceAll(st.State, "_", " "))
+	if b, ok := st.Attributes["brightness"].(float64); ok && st.State == "on" {
+		out += fmt.Sprintf(" at %d%% brightness", int(b/255*100+0.5))
+	}
+	if t, ok := st.Attributes["temperature"].(float64); ok && st.Domain() == "climate" {
+		out += fmt.Sprintf(", target %g°", t)
+	}
+	return out + "."
+}
+
+// Tools returns model-facing tools for listing and controlling devices.
+func (c *Client) Tools() []tools.Tool {
+	return []tools.Tool{
+		tools.New("list_devices", "List smart home devices and their current state.",
+			`{"type":"object","properties":{"domain":{"type":"string","description":"optional filter, e.g. light or switch"}}}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var in struct {
+					Domain string `json:"domain"`
+				}
+				if err := tools.Decode(args, &in); err != nil {
+					return "", err
+				}
+				devices, err := c.Devices(ctx)
+				if err != nil {
+					return "", err
+				}
+				var b strings.Builder
+				for _, d := range devices {
+					if in.Domain == "" || d.Domain() == in.Domain {
+						fmt.Fprintf(&b, "%s (%s): %s\n", d.Name(), d.EntityID, d.State)
+					}
+				}
+				if b.Len() == 0 {
+					return "No matching devices.", nil
+				}
+				return b.String(), nil
+			}),
+		tools.New("control_device",
+			"Control a smart home device by name. Reply to the user with the resulting state this tool returns.",
+			`{"type":"object","properties":{
+				"device":{"type":"string","description":"device name or entity ID, e.g. living room lights"},
+				"action":{"type":"string","enum":["turn_on","turn_off","toggle","open","close","lock","unlock","set_temperature"]},
+				"brightness_pct":{"type":"integer","minimum":0,"maximum":100},
+				"temperature":{"type":"number"}
+			},"required":["device","action"]}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var in struct {
+					Device string `json:"device"`
+					Command
+				}
+				if err := tools.Decode(args, &in); err != nil {
+					return "", err
+				}
+				dev, err := c.FindDevice(ctx, in.Device)
+				if err != nil {
+					return "", err
+				}
+				return c.Control(ctx, dev, in.Command)
+			}),
+	}
+}
@@ -0,0 +1,37 @@
+package homeassistant
+
+import (
+	"context"
+	"net/url"
+)
+
+// ShoppingItem is an entry on Home Assistant's shopping list.
+type ShoppingItem struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Complete bool   `json:"complete"`
+}
+
+// ShoppingList returns the items on the shopping list integration's list,
+// checked-off ones included.
+func (c *Client) ShoppingList(ctx context.Context) ([]ShoppingItem, error) {
+	var items []ShoppingItem
+	if err := c.do(ctx, "GET", "/api/shopping_list", nil, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// AddShoppingItem adds an item to the shopping list.
+func (c *Client) AddShoppingItem(ctx context.Context, name string) (*ShoppingItem, error) {
+	var item ShoppingItem
+	if err := c.do(ctx, "POST", "/api/shopping_list/item", map[string]string{"name": name}, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// CompleteShoppingItem checks an item off the shopping list.
+func (c *Client) CompleteShoppingItem(ctx context.Context, id string) error {
+	return c.do(ctx, "POST", "/api/shopping_list/item/"+url.PathEscape(id), map[string]bool{"complete": true}, nil)
+}
@@ -0,0 +1,115 @@
+// Package idle lets the agent save power while nobody is talking to it.
+// After a stretch without chat the governor declares the agent idle:
+// polling loops such as presence, energy meters, document rescans and the
+// MQTT keepalive run less often, and the local model is released from
+// RAM. The first message ends the idle period.
+package idle
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// DefaultFactor is how many times longer polling intervals get while
+// idle.
+const DefaultFactor = 4
+
+// Governor tracks chat activity.
+type Governor struct {
+	after  time.Duration
+	factor int
+
+	mu     sync.Mutex
+	last   time.Time
+	idle   bool
+	onIdle []func(ctx context.Context)
+}
+
+// New creates a governor declaring the agent idle after the given time
+// without chat, and slowing polling by factor while it is.
+func New(after time.Duration, factor int) *Governor {
+	if factor < 1 {
+		factor = 1
+	}
+	return &Governor{after: after, factor: factor, last: time.Now()}
+}
+
+// OnIdle registers fn to run each time the agent becomes idle. Functions
+// must be registered before Run.
+func (g *Governor) OnIdle(fn func(ctx context.Context)) {
+	g.onIdle = append(g.onIdle, fn)
+}
+
+// Touch records activity, ending an idle period.
+func (g *Governor) Touch() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.last = time.Now()
+	if g.idle {
+		g.idle = false
+		log.Printf("idle: activity, back to normal polling")
+	}
+}
+
+// Delta implements engine.Observer; reply fragments count as activity.
+func (g *Governor) Delta(conversationID, content string) { g.Touch() }
+
+// Reply implements engine.Observer.
+func (g *Governor) Reply(conversationID, content string) { g.Touch() }
+
+// Idle reports whether the agent is idle.
+func (g *Governor) Idle() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.idle
+}
+
+// Run checks for inactivity until ctx is cancelled.
+func (g *Governor) Run(ctx context.Context) {
+	ticker := time.NewTicker(max(g.after/4, time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		g.mu.Lock()
+		became := !g.idle && time.Since(g.last) >= g.after
+		if became {
+			g.idle = true
+			log.Printf("idle: no chat for %s, polling %d times less often", g.after, g.factor)
+		}
+		g.mu.Unlock()
+		if became {
+			for _, fn := range g.onIdle {
+				fn(ctx)
+			}
+		}
+	}
+}
+
+// Pace returns a function for a polling loop to call on each tick. It
+// reports whether to poll, which while idle is one tick in the factor.
+func (g *Governor) Pace() func() bool {
+	var ticks int
+	return func() bool {
+		if !g.Idle() {
+			ticks = 0
+			return true
+		}
+		ticks++
+		return (ticks-1)%g.factor == 0
+	}
+}
+
+// Interval returns d, or d lengthened by the factor while idle, for
+// loops that sleep rather than tick.
+func (g *Governor) Interval(d time.Duration) time.Duration {
+	if g.Idle() {
+		return d * time.Duration(g.factor)
+	}
+	return d
+}
@@ -0,0 +1,355 @@
+package importer
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"pi-agent/internal/store"
+)
+
+// Formats accepted by Import. FormatAuto detects the format from the data.
+const (
+	FormatAuto      = "auto"
+	FormatChatGPT   = "chatgpt"   // official data export ZIP, or its conversations.json
+	FormatOpenWebUI = "openwebui" // Open WebUI chat export JSON
+	FormatJSONL     = "jsonl"     // one {"conversation_id","role","content","created_at"} object per line
+)
+
+// Thread is an imported conversation.
+type Thread struct {
+	ID       string
+	Messages []store.Message
+}
+
+// Report summarizes an import.
+type Report struct {
+	Format        string `json:"format"`
+	Conversations int    `json:"conversations"`
+	Messages      int    `json:"messages"`
+	Skipped       int    `json:"skipped"` // conversations already present
+}
+
+// Import parses data in the given format and stores each thread as a
+// conversation. Threads whose conversation already exists are skipped, so
+// importing the same export twice is harmless.
+func Import(db *store.DB, format string, data []byte) (*Report, error) {
+	if format == "" || format == FormatAuto {
+		format = detect(data)
+	}
+	var threads []Thread
+	var err error
+	switch format {
+	case FormatChatGPT:
+		threads, err = parseChatGPT(data)
+	case FormatOpenWebUI:
+		threads, err = parseOpenWebUI(data)
+	case FormatJSONL:
+		threads, err = parseJSONL(data)
+	default:
+		return nil, fmt.Errorf("unknown import format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s export: %w", format, err)
+	}
+
+	report := &Report{Format: format}
+	for _, t := range threads {
+		if len(t.Messages) == 0 {
+			continue
+		}
+		exists, err := db.HasConversation(t.ID)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			report.Skipped++
+			continue
+		}
+		for i := range t.Messages {
+			t.Messages[i].ConversationID = t.ID
+		}
+		if err := db.ImportMessages(t.Messages); err != nil {
+			return nil, err
+		}
+		report.Conversations++
+		report.Messages += len(t.Messages)
+	}
+	return report, nil
+}
+
+func detect(data []byte) string {
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return FormatChatGPT
+	}
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		return FormatJSONL
+	}
+	// Both JSON exports are arrays; ChatGPT threads carry a mapping tree.
+	if bytes.Contains(trimmed[:min(len(trimmed), 4096)], []byte(`"mapping"`)) {
+		return FormatChatGPT
+	}
+	return FormatOpenWebUI
+}
+
+var slugRe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// conversationID builds a readable, stable conversation ID for a thread.
+func conversationID(prefix, title, id string) string {
+	slug := strings.Trim(slugRe.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if len(slug) > 40 {
+		slug = strings.TrimRight(slug[:40], "-")
+	}
+	if len(id) > 8 {
+		id = id[:8]
+	}
+	if slug == "" {
+		return prefix + "-" + id
+	}
+	return prefix + "-" + slug + "-" + id
+}
+
+func unixTime(f float64) time.Time {
+	if f == 0 {
+		return time.Time{}
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+func role(r string) (store.Role, bool) {
+	switch r {
+	case "user":
+		return store.RoleUser, true
+	case "assistant":
+		return store.RoleAssistant, true
+	}
+	return "", false
+}
+
+// ChatGPT export: conversations.json holds an array of threads whose
+// messages form a tree (edits and regenerations branch); the thread shown
+// in the UI is the path from current_node back to the root.
+type chatGPTThread struct {
+	ID             string  `json:"id"`
+	ConversationID string  `json:"conversation_id"`
+	Title          string  `json:"title"`
+	CurrentNode    string  `json:"current_node"`
+	CreateTime     float64 `json:"create_time"`
+	Mapping        map[string]struct {
+		Parent  string `json:"parent"`
+		Message *struct {
+			Author struct {
+				Role string `json:"role"`
+			} `json:"author"`
+			Content struct {
+				ContentType string            `json:"content_type"`
+				Parts       []json.RawMessage `json:"parts"`
+			} `json:"content"`
+			CreateTime float64 `json:"create_time"`
+		} `json:"message"`
+	} `json:"mapping"`
+}
+
+func parseChatGPT(data []byte) ([]Thread, error) {
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		var found bool
+		for _, f := range zr.File {
+			if f.Name != "conversations.json" && !strings.HasSuffix(f.Name, "/conversations.json") {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			data, err = io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+			found = true
+			break
+		}
+		if !found {
+			return nil, errors.New("conversations.json not found in archive")
+		}
+	}
+
+	var raw []chatGPTThread
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	var threads []Thread
+	for _, c := range raw {
+		id := c.ConversationID
+		if id == "" {
+			id = c.ID
+		}
+		t := Thread{ID: conversationID("chatgpt", c.Title, id)}
+		for node := c.CurrentNode; node != ""; node = c.Mapping[node].Parent {
+			n, ok := c.Mapping[node]
+			if !ok {
+				break
+			}
+			m := n.Message
+			if m == nil || m.Content.ContentType != "text" {
+				continue
+			}
+			r, ok := role(m.Author.Role)
+			if !ok {
+				continue
+			}
+			var parts []string
+			for _, p := range m.Content.Parts {
+				var s string
+				if json.Unmarshal(p, &s) == nil && strings.TrimSpace(s) != "" {
+					parts = append(parts, s)
+				}
+			}
+			if len(parts) == 0 {
+				continue
+			}
+			created := unixTime(m.CreateTime)
+			if created.IsZero() {
+				created = unixTime(c.CreateTime)
+			}
+			t.Messages = append(t.Messages, store.Message{Role: r, Content: strings.Join(parts, "\n"), CreatedAt: created})
+		}
+		// The walk went leaf to root.
+		for i, j := 0, len(t.Messages)-1; i < j; i, j = i+1, j-1 {
+			t.Messages[i], t.Messages[j] = t.Messages[j], t.Messages[i]
+		}
+		threads = append(threads, t)
+	}
+	return threads, nil
+}
+
+// Open WebUI exports an array of chats. Newer versions keep a message tree
+// in chat.history with the selected leaf in currentId; older ones only
+// have the flat chat.messages list.
+type openWebUIChat struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	CreatedAt int64  `json:"created_at"`
+	Chat      struct {
+		Title    string             `json:"title"`
+		Messages []openWebUIMessage `json:"messages"`
+		History  struct {
+			CurrentID string                      `json:"currentId"`
+			Messages  map[string]openWebUIMessage `json:"messages"`
+		} `json:"history"`
+	} `json:"chat"`
+}
+
+type openWebUIMessage struct {
+	ParentID  string `json:"parentId"`
+	Role      string `json:"role"`
+	Content   string `json:"content"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+func parseOpenWebUI(data []byte) ([]Thread, error) {
+	var raw []openWebUIChat
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	var threads []Thread
+	for _, c := range raw {
+		title := c.Title
+		if title == "" {
+			title = c.Chat.Title
+		}
+		msgs := c.Chat.Messages
+		if h := c.Chat.History; h.CurrentID != "" && len(h.Messages) > 0 {
+			msgs = nil
+			for id := h.CurrentID; id != ""; id = h.Messages[id].ParentID {
+				m, ok := h.Messages[id]
+				if !ok {
+					break
+				}
+				msgs = append([]openWebUIMessage{m}, msgs...)
+			}
+		}
+		t := Thread{ID: conversationID("openwebui", title, c.ID)}
+		for _, m := range msgs {
+			r, ok := role(m.Role)
+			if !ok || strings.TrimSpace(m.Content) == "" {
+				continue
+			}
+			ts := m.Timestamp
+			if ts == 0 {
+				ts = c.CreatedAt
+			}
+			// Timestamps are seconds in most versions, milliseconds in some.
+			created := time.Unix(ts, 0)
+			if ts > 1e11 {
+				created = time.UnixMilli(ts)
+			}
+			t.Messages = append(t.Messages, store.Message{Role: r, Content: m.Content, CreatedAt: created})
+		}
+		threads = append(threads, t)
+	}
+	return threads, nil
+}
+
+// parseJSONL reads one message per line. Lines are grouped by
+// conversation_id, in file order.
+func parseJSONL(data []byte) ([]Thread, error) {
+	byID := make(map[string]*Thread)
+	var order []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64<<10), 16<<20)
+	for line := 1; sc.Scan(); line++ {
+		text := bytes.TrimSpace(sc.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var m struct {
+			ConversationID string    `json:"conversation_id"`
+			Role           string    `json:"role"`
+			Content        string    `json:"content"`
+			CreatedAt      time.Time `json:"created_at"`
+		}
+		if err := json.Unmarshal(text, &m); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		r, ok := role(m.Role)
+		if !ok {
+			if m.Role != "system" {
+				return nil, fmt.Errorf("line %d: unknown role %q", line, m.Role)
+			}
+			r = store.RoleSystem
+		}
+		if m.ConversationID == "" {
+			m.ConversationID = "imported"
+		}
+		t, ok := byID[m.ConversationID]
+		if !ok {
+			t = &Thread{ID: m.ConversationID}
+			byID[m.ConversationID] = t
+			order = append(order, m.ConversationID)
+		}
+		t.Messages = append(t.Messages, store.Message{Role: r, Content: m.Content, CreatedAt: m.CreatedAt})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	threads := make([]Thread, 0, len(order))
+	for _, id := range order {
+		threads = append(threads, *byID[id])
+	}
+	return threads, nil
+}
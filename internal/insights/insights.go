@@ -0,0 +1,264 @@
+// Package insights has the model review what the agent has recorded —
+// usage, approvals, feedback, sensors, energy, speed tests and power
+// outages — and report on the state of the house and of the agent.
+package insights
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"pi-agent/internal/notify"
+	"pi-agent/internal/store"
+)
+
+const week = 7 * 24 * time.Hour
+
+// Reporter writes the weekly insights report.
+type Reporter struct {
+	db       *store.DB
+	complete func(ctx context.Context, prompt string) (string, error)
+	notifier notify.Notifier
+}
+
+// New creates a reporter that delivers its reports to n.
+func New(db *store.DB, complete func(ctx context.Context, prompt string) (string, error), n notify.Notifier) *Reporter {
+	return &Reporter{db: db, complete: complete, notifier: n}
+}
+
+// Run compares the last week's data with the week before, has the model
+// write a short report flagging anything unusual, and delivers it.
+func (r *Reporter) Run(ctx context.Context) error {
+	now := time.Now()
+	facts, err := r.gather(now)
+	if err != nil {
+		return err
+	}
+	if facts == "" {
+		log.Printf("insights: nothing recorded in the last two weeks")
+		return nil
+	}
+	prompt := `Write a short weekly "state of the house and state of the agent" report (at most 8 sentences) for a phone notification.
+Compare this week with the previous one. Start with anything unusual — a spike or drop in usage, rejected or failed approvals, poor feedback, sensors outside their usual range, slow or failing internet, power outages — each on its own line starting with "⚠". If nothing stands out, say so in one sentence. Do not invent data that is not below.
+
+` + facts
+	report, err := r.complete(ctx, prompt)
+	if err != nil {
+		return fmt.Errorf("generating insights report: %w", err)
+	}
+	return r.notifier.Notify(ctx, notify.Message{Title: "Weekly insights", Body: report, Priority: notify.PriorityLow, Tags: []string{"bar_chart"}})
+}
+
+// gather describes the data of the week before now and the week before
+// that, section by section, leaving out what was not recorded.
+func (r *Reporter) gather(now time.Time) (string, error) {
+	thisWeek, lastWeek := now.Add(-week), now.Add(-2*week)
+	var b strings.Builder
+	section := func(title, body string) {
+		if body != "" {
+			fmt.Fprintf(&b, "%s:\n%s\n", title, body)
+		}
+	}
+
+	usage, err := r.db.PersonaUsageSince(lastWeek.Local().Format("2006-01-02"))
+	if err != nil {
+		return "", err
+	}
+	section("Agent usage (messages, tokens) this week / previous week", formatUsage(usage, thisWeek.Local().Format("2006-01-02")))
+
+	approvals, err := r.db.ApprovalsSince(lastWeek)
+	if err != nil {
+		return "", err
+	}
+	section("Approvals this week / previous week", formatApprovals(approvals, thisWeek))
+
+	feedback, err := r.db.FeedbackSince(lastWeek)
+	if err != nil {
+		return "", err
+	}
+	section("Feedback on replies this week / previous week", formatFeedback(feedback, thisWeek))
+
+	names, err := r.db.SensorNames()
+	if err != nil {
+		return "", err
+	}
+	var sensors strings.Builder
+	for _, name := range names {
+		cur, err := r.db.SensorStats(name, thisWeek, now)
+		if err != nil {
+			return "", err
+		}
+		prev, err := r.db.SensorStats(name, lastWeek, thisWeek)
+		if err != nil {
+			return "", err
+		}
+		if cur.Samples == 0 && prev.Samples == 0 {
+			continue
+		}
+		fmt.Fprintf(&sensors, "%s: %s / %s\n", name, formatSensor(cur), formatSensor(prev))
+	}
+	section("Sensors (min, avg, max) this week / previous week", sensors.String())
+
+	energy, err := r.db.EnergyStats("", thisWeek, now)
+	if err != nil {
+		return "", err
+	}
+	energyBefore, err := r.db.EnergyStats("", lastWeek, thisWeek)
+	if err != nil {
+		return "", err
+	}
+	if len(energy) > 0 || len(energyBefore) > 0 {
+		section("Energy this week", formatEnergy(energy))
+		section("Energy previous week", formatEnergy(energyBefore))
+	}
+
+	speed, err := r.db.SpeedTestStats(thisWeek, now)
+	if err != nil {
+		return "", err
+	}
+	speedBefore, err := r.db.SpeedTestStats(lastWeek, thisWeek)
+	if err != nil {
+		return "", err
+	}
+	if speed.Tests+speedBefore.Tests > 0 {
+		section("Internet speed tests this week / previous week", formatSpeed(speed)+" / "+formatSpeed(speedBefore)+"\n")
+	}
+
+	outages, err := r.db.Outages(50)
+	if err != nil {
+		return "", err
+	}
+	var power strings.Builder
+	for _, o := range outages {
+		if o.StartedAt.Before(thisWeek) {
+			break
+		}
+		fmt.Fprintf(&power, "%s: %s\n", o.StartedAt.Local().Format("Mon 15:04"), formatOutage(o, now))
+	}
+	section("Power outages this week", power.String())
+
+	return b.String(), nil
+}
+
+func formatUsage(usage []store.PersonaUsage, thisWeek string) string {
+	type totals struct{ cur, prev store.PersonaUsage }
+	var order []string
+	byPersona := map[string]*totals{}
+	for _, u := range usage {
+		t, ok := byPersona[u.Persona]
+		if !ok {
+			t = &totals{}
+			byPersona[u.Persona] = t
+			order = append(order, u.Persona)
+		}
+		sum := &t.prev
+		if u.Day >= thisWeek {
+			sum = &t.cur
+		}
+		sum.Messages += u.Messages
+		sum.Tokens += u.Tokens
+	}
+	var b strings.Builder
+	for _, p := range order {
+		t := byPersona[p]
+		name := p
+		if name == "" {
+			name = "default persona"
+		}
+		fmt.Fprintf(&b, "%s: %d, %d / %d, %d\n", name, t.cur.Messages, t.cur.Tokens, t.prev.Messages, t.prev.Tokens)
+	}
+	return b.String()
+}
+
+func formatApprovals(approvals []store.Approval, thisWeek time.Time) string {
+	if len(approvals) == 0 {
+		return ""
+	}
+	cur, prev := map[string]int{}, map[string]int{}
+	for _, a := range approvals {
+		if a.CreatedAt.Before(thisWeek) {
+			prev[a.Status]++
+		} else {
+			cur[a.Status]++
+		}
+	}
+	var b strings.Builder
+	for _, status := range []string{store.ApprovalApproved, store.ApprovalRejected, store.ApprovalFailed, store.ApprovalPending} {
+		if cur[status]+prev[status] > 0 {
+			fmt.Fprintf(&b, "%s: %d / %d\n", status, cur[status], prev[status])
+		}
+	}
+	return b.String()
+}
+
+func formatFeedback(feedback []store.FeedbackRecord, thisWeek time.Time) string {
+	if len(feedback) == 0 {
+		return ""
+	}
+	cur, prev := map[string]int{}, map[string]int{}
+	var comments []string
+	for _, f := range feedback {
+		if f.UpdatedAt.Before(thisWeek) {
+			prev[f.Rating]++
+			continue
+		}
+		cur[f.Rating]++
+		if f.Rating == store.RatingDown && f.Comment != "" && len(comments) < 3 {
+			comments = append(comments, f.Comment)
+		}
+	}
+	s := fmt.Sprintf("thumbs up: %d / %d\nthumbs down: %d / %d\n", cur[store.RatingUp], prev[store.RatingUp], cur[store.RatingDown], prev[store.RatingDown])
+	for _, c := range comments {
+		s += fmt.Sprintf("comment on a thumbs down: %q\n", c)
+	}
+	return s
+}
+
+func formatSensor(st *store.SensorStats) string {
+	if st.Samples == 0 {
+		return "no readings"
+	}
+	return fmt.Sprintf("%.1f, %.1f, %.1f%s", st.Min, st.Avg, st.Max, st.Unit)
+}
+
+func formatEnergy(stats []store.EnergyStats) string {
+	if len(stats) == 0 {
+		return "No readings.\n"
+	}
+	var b strings.Builder
+	for _, st := range stats {
+		fmt.Fprintf(&b, "%s: avg %.0f W, peak %.0f W", st.Meter, st.AvgPowerW, st.PeakPowerW)
+		if st.ConsumedKWh > 0 {
+			fmt.Fprintf(&b, ", %.2f kWh used", st.ConsumedKWh)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func formatSpeed(st store.SpeedTestStats) string {
+	switch {
+	case st.Tests == 0:
+		return "no tests"
+	case st.Tests == st.Failed:
+		return fmt.Sprintf("all %d tests failed", st.Failed)
+	}
+	return fmt.Sprintf("%d tests, %d failed, download avg %.0f Mbps (min %.0f), upload avg %.0f Mbps, latency avg %.0f ms",
+		st.Tests, st.Failed, st.AvgDownloadMbps, st.MinDownloadMbps, st.AvgUploadMbps, st.AvgLatencyMs)
+}
+
+func formatOutage(o store.Outage, now time.Time) string {
+	if o.EndedAt.IsZero() {
+		return fmt.Sprintf("on battery for %s so far", now.Sub(o.StartedAt).Round(time.Minute))
+	}
+	s := fmt.Sprintf("on battery for %s", o.EndedAt.Sub(o.StartedAt).Round(time.Minute))
+	if o.MinCharge >= 0 {
+		s += fmt.Sprintf(", down to %.0f%%", o.MinCharge)
+	}
+	if o.Skipped > 0 {
+		s += fmt.Sprintf(", %d jobs skipped", o.Skipped)
+	}
+	return s
+}
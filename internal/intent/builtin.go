@@ -0,0 +1,227 @@
+package intent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"pi-agent/internal/audio"
+	"pi-agent/internal/flashcards"
+	"pi-agent/internal/homeassistant"
+	"pi-agent/internal/lists"
+	"pi-agent/internal/recipe"
+	"pi-agent/internal/timer"
+)
+
+// AddClock registers "what time is it" and "what's the date" intents.
+func (r *Router) AddClock() {
+	r.Add("time", `^(?:what time is it|what's the time|what is the time|tell me the time)(?: now)?$`,
+		func(context.Context, string, map[string]string) (string, error) {
+			return "It's " + time.Now().Format("3:04 PM") + ".", nil
+		})
+	r.Add("date", `^(?:what's the date|what is the date|what day is it|what's today's date|what is today's date)(?: today)?$`,
+		func(context.Context, string, map[string]string) (string, error) {
+			return "It's " + time.Now().Format("Monday, January 2") + ".", nil
+		})
+}
+
+// AddTimers registers intents for starting, cancelling and checking timers.
+func (r *Router) AddTimers(m *timer.Manager) {
+	r.AddTool("timer.start", "set_timer", `^(?:set|start) (?:a |an )?(?P<n>\S+) (?P<unit>second|minute|hour)s? timer(?: for (?P<label>.+))?$`,
+		func(_ context.Context, conv string, g map[string]string) (string, error) {
+			return startTimer(m, conv, g)
+		})
+	r.AddTool("timer.start", "set_timer", `^(?:set|start) (?:a )?timer for (?P<n>\S+) (?P<unit>second|minute|hour)s?(?: for (?P<label>.+))?$`,
+		func(_ context.Context, conv string, g map[string]string) (string, error) {
+			return startTimer(m, conv, g)
+		})
+	r.AddTool("timer.cancel", "set_timer", `^(?:cancel|stop|clear) (?:the |my |all )?timers?$`,
+		func(_ context.Context, conv string, _ map[string]string) (string, error) {
+			switch n := m.Cancel(conv); n {
+			case 0:
+				return "There are no timers running.", nil
+			case 1:
+				return "Timer cancelled.", nil
+			default:
+				return fmt.Sprintf("Cancelled %d timers.", n), nil
+			}
+		})
+	r.AddTool("timer.status", "list_timers", `^(?:how much time is left|how long is left)(?: on (?:the |my )?timer)?$`,
+		func(_ context.Context, conv string, _ map[string]string) (string, error) {
+			timers := m.List(conv)
+			if len(timers) == 0 {
+				return "There are no timers running.", nil
+			}
+			return timer.Describe(time.Until(timers[0].Due)) + " left.", nil
+		})
+}
+
+func startTimer(m *timer.Manager, conv string, g map[string]string) (string, error) {
+	n, ok := parseNumber(g["n"])
+	if !ok || n <= 0 {
+		return "", fmt.Errorf("invalid timer length %q", g["n"])
+	}
+	unit := map[string]time.Duration{"second": time.Second, "minute": time.Minute, "hour": time.Hour}[g["unit"]]
+	tm := m.Start(conv, g["label"], time.Duration(n)*unit)
+	return fmt.Sprintf("Timer set for %s.", tm.Duration), nil
+}
+
+// AddVolume registers intents for changing the speaker volume.
+func (r *Router) AddVolume(m *audio.Mixer) {
+	r.AddTool("volume.set", "set_volume", `^(?:set |turn )?(?:the )?volume (?:to )?(?P<n>\d+)(?: ?%| percent)?$`,
+		func(ctx context.Context, _ string, g map[string]string) (string, error) {
+			n, _ := strconv.Atoi(g["n"])
+			if err := m.SetVolume(ctx, n); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Volume set to %d%%.", n), nil
+		})
+	r.AddTool("volume.step", "set_volume", `^(?:turn (?:the )?volume (?P<dir>up|down)|(?:turn it|volume) (?P<dir2>up|down)|(?P<dir3>louder|quieter))$`,
+		func(ctx context.Context, _ string, g map[string]string) (string, error) {
+			step := 10
+			if g["dir"] == "down" || g["dir2"] == "down" || g["dir3"] == "quieter" {
+				step = -10
+			}
+			v, err := m.Volume(ctx)
+			if err != nil {
+				return "", err
+			}
+			v = min(max(v+step, 0), 100)
+			if err := m.SetVolume(ctx, v); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Volume is now %d%%.", v), nil
+		})
+}
+
+// AddDevices registers on/off and dimming commands for Home Assistant
+// devices. Commands naming an unknown device are passed on to the model,
+// which can list devices and ask what was meant.
+func (r *Router) AddDevices(ha *homeassistant.Client) {
+	control := func(ctx context.Context, name string, cmd homeassistant.Command) (string, error) {
+		dev, err := ha.FindDevice(ctx, name)
+		if err != nil {
+			return "", ErrPass
+		}
+		return ha.Control(ctx, dev, cmd)
+	}
+	onOff := func(ctx context.Context, _ string, g map[string]string) (string, error) {
+		return control(ctx, g["device"], homeassistant.Command{Action: "turn_" + g["state"]})
+	}
+	r.AddTool("device.power", "control_device", `^(?:switch|turn) (?P<state>on|off) (?P<device>.+)$`, onOff)
+	r.AddTool("device.power", "control_device", `^(?:switch|turn) (?P<device>.+) (?P<state>on|off)$`, onOff)
+	r.AddTool("device.dim", "control_device", `^(?:dim|set|brighten) (?P<device>.+?) (?:to )?(?P<pct>\d+)(?: ?%| percent)$`,
+		func(ctx context.Context, _ string, g map[string]string) (string, error) {
+			pct, _ := strconv.Atoi(g["pct"])
+			if pct > 100 {
+				return "", ErrPass
+			}
+			return control(ctx, g["device"], homeassistant.Command{Action: "turn_on", BrightnessPct: &pct})
+		})
+}
+
+// AddLists registers intents for adding to, removing from and reading
+// named lists. Commands must mention a list ("add milk to the shopping
+// list", "what's on the list") so that other "add ... to ..." requests
+// still reach the model.
+func (r *Router) AddLists(l *lists.Lists) {
+	r.AddTool("list.add", "add_to_list", `^(?:add|put) (?:(?P<qty>\d+) )?(?P<item>.+?) (?:to|on) (?:the |my )?(?:(?P<list>.+?) )?list$`,
+		func(ctx context.Context, _ string, g map[string]string) (string, error) {
+			it, added, err := l.Add(ctx, g["list"], g["item"], g["qty"])
+			if it == nil {
+				return "", err
+			}
+			return lists.AddReply(it, added, err), nil
+		})
+	r.AddTool("list.remove", "remove_from_list", `^(?:remove|take|cross) (?P<item>.+?) (?:from|off)(?: of)? (?:the |my )?(?:(?P<list>.+?) )?list$`,
+		func(ctx context.Context, _ string, g map[string]string) (string, error) {
+			return lists.RemoveReply(lists.Name(g["list"]), g["item"], l.Remove(ctx, g["list"], g["item"]))
+		})
+	show := func(ctx context.Context, _ string, g map[string]string) (string, error) {
+		items, err := l.Items(ctx, g["list"])
+		if items == nil && err != nil && !errors.As(err, new(*lists.SyncError)) {
+			return "", err
+		}
+		return lists.ShowReply(lists.Name(g["list"]), items, err), nil
+	}
+	r.AddTool("list.show", "show_list", `^(?:what's|what is|whats) on (?:the |my )?(?:(?P<list>.+?) )?list$`, show)
+	r.AddTool("list.show", "show_list", `^(?:read|show)(?: me)? (?:the |my )?(?:(?P<list>.+?) )?list$`, show)
+}
+
+// AddRecipes registers the commands for stepping through a recipe in
+// progress. They only apply while the conversation has a recipe loaded;
+// otherwise they pass to the model.
+func (r *Router) AddRecipes(m *recipe.Manager) {
+	step := func(name, pattern string, f func(conv string, g map[string]string) (string, error)) {
+		r.addWhile(m.Active, name, "recipe_step", pattern, func(_ context.Context, conv string, g map[string]string) (string, error) {
+			return f(conv, g)
+		})
+	}
+	step("recipe.next", `^(?:(?:ok(?:ay)?|done|got it),? )?(?:next|next step|what's next|what now|what do i do next)$`,
+		func(conv string, _ map[string]string) (string, error) { return m.Next(conv) })
+	step("recipe.previous", `^(?:previous(?: step)?|go back(?: a step)?|back|last step)$`,
+		func(conv string, _ map[string]string) (string, error) { return m.Previous(conv) })
+	step("recipe.repeat", `^(?:repeat(?: that| the step| step)?|say (?:that|it) again|what was that|what's the step|what step am i on)$`,
+		func(conv string, _ map[string]string) (string, error) { return m.Repeat(conv) })
+	step("recipe.goto", `^(?:go to |what's |what is |read )?step (?P<n>\S+)$`,
+		func(conv string, g map[string]string) (string, error) {
+			n, ok := parseNumber(g["n"])
+			if !ok {
+				return "", ErrPass
+			}
+			return m.Goto(conv, n)
+		})
+	step("recipe.ingredients", `^(?:what are the ingredients|what do i need|read (?:me )?the ingredients|list the ingredients)$`,
+		func(conv string, _ map[string]string) (string, error) { return m.Ingredients(conv) })
+	step("recipe.amount", `^how (?:much|many) (?P<what>.+?)(?: do i need| do i use| does it need| goes in| is it| are there)?$`,
+		func(conv string, g map[string]string) (string, error) { return m.Ingredient(conv, g["what"]) })
+	r.addWhile(m.Active, "recipe.stop", "stop_recipe", `^(?:stop|end|exit|quit|close) (?:the )?recipe$`,
+		func(_ context.Context, conv string, _ map[string]string) (string, error) {
+			if err := m.Stop(conv); err != nil {
+				return "", err
+			}
+			return "Recipe ended.", nil
+		})
+}
+
+// AddQuiz registers the commands for a flashcard quiz in progress. While
+// a quiz runs, anything not matched by an earlier rule is taken as an
+// answer, so AddQuiz should be called last; "stop the quiz" leaves it.
+func (r *Router) AddQuiz(m *flashcards.Manager) {
+	quiz := func(name, tool, pattern string, f func(conv string, g map[string]string) (string, error)) {
+		r.addWhile(m.Active, name, tool, pattern, func(_ context.Context, conv string, g map[string]string) (string, error) {
+			return f(conv, g)
+		})
+	}
+	quiz("quiz.stop", "stop_quiz", `^(?:stop|end|quit|exit|finish) (?:the )?quiz$`,
+		func(conv string, _ map[string]string) (string, error) { return m.Stop(conv) })
+	quiz("quiz.hint", "quiz_answer", `^(?:hint|give me a hint|can i (?:have|get) a hint)$`,
+		func(conv string, _ map[string]string) (string, error) { return m.Hint(conv) })
+	quiz("quiz.skip", "quiz_answer", `^(?:skip|skip it|skip this one|next question)$`,
+		func(conv string, _ map[string]string) (string, error) { return m.Skip(conv) })
+	quiz("quiz.giveup", "quiz_answer", `^(?:i don't know|i dont know|no idea|i give up|pass|tell me)$`,
+		func(conv string, _ map[string]string) (string, error) { return m.GiveUp(conv) })
+	quiz("quiz.repeat", "quiz_answer", `^(?:repeat(?: the question)?|what was the question|say (?:that|it) again)$`,
+		func(conv string, _ map[string]string) (string, error) { return m.Question(conv) })
+	quiz("quiz.answer", "quiz_answer", `^(?:is it |it's |its )?(?P<answer>.+?)\??$`,
+		func(conv string, g map[string]string) (string, error) { return m.Answer(conv, g["answer"]) })
+}
+
+var numberWords = map[string]int{
+	"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5,
+	"six": 6, "seven": 7, "eight": 8, "nine": 9, "ten": 10, "eleven": 11,
+	"twelve": 12, "fifteen": 15, "twenty": 20, "thirty": 30, "forty": 40,
+	"forty-five": 45, "sixty": 60, "ninety": 90,
+}
+
+// parseNumber accepts digits or a common number word.
+func parseNumber(s string) (int, bool) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, true
+	}
+	n, ok := numberWords[strings.ToLower(s)]
+	return n, ok
+}
@@ -0,0 +1,98 @@
+package intent
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// ErrPass is returned by a handler to decline a matched command, letting
+// later rules or the model handle it instead.
+var ErrPass = errors.New("intent: pass")
+
+// Handler answers a matched intent. The groups map holds the pattern's
+// named capture groups.
+type Handler func(ctx context.Context, conversationID string, groups map[string]string) (string, error)
+
+type rule struct {
+	name    string
+	tool    string                 // the tool the intent does the work of, if any
+	active  func(conv string) bool // if set, whether the intent applies at all
+	pattern *regexp.Regexp
+	handle  Handler
+}
+
+// Router matches simple spoken or typed commands against local patterns so
+// they can be answered without a model round-trip.
+type Router struct {
+	rules []rule
+}
+
+// NewRouter creates an empty router.
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Add registers an intent. The pattern is matched against the normalized
+// input (lower case, surrounding punctuation removed) and should be
+// anchored so that only whole commands match. Rules are tried in the order
+// they were added.
+func (r *Router) Add(name, pattern string, h Handler) {
+	r.rules = append(r.rules, rule{name: name, pattern: regexp.MustCompile(pattern), handle: h})
+}
+
+// AddTool registers an intent that does the work of a tool, e.g.
+// "set_volume", so that Route only runs it where the tool may be used.
+func (r *Router) AddTool(name, tool, pattern string, h Handler) {
+	r.rules = append(r.rules, rule{name: name, tool: tool, pattern: regexp.MustCompile(pattern), handle: h})
+}
+
+// addWhile registers a tool's intent that only applies to conversations
+// active reports true for, such as those with a recipe loaded, and passes
+// to later rules in the others.
+func (r *Router) addWhile(active func(conv string) bool, name, tool, pattern string, h Handler) {
+	r.rules = append(r.rules, rule{name: name, tool: tool, active: active, pattern: regexp.MustCompile(pattern), handle: h})
+}
+
+// Route tries to handle text locally. It returns the matched intent name
+// and reply, or an empty name if no intent matched and the input should go
+// to the model. An intent doing the work of a tool first asks permit
+// whether the tool may be used, and fails with its error if not.
+func (r *Router) Route(ctx context.Context, conversationID, text string, permit func(tool string) error) (name, reply string, err error) {
+	norm := normalize(text)
+	for _, rl := range r.rules {
+		m := rl.pattern.FindStringSubmatch(norm)
+		if m == nil {
+			continue
+		}
+		if rl.active != nil && !rl.active(conversationID) {
+			continue
+		}
+		if rl.tool != "" {
+			if err := permit(rl.tool); err != nil {
+				return rl.name, "", err
+			}
+		}
+		groups := make(map[string]string)
+		for i, g := range rl.pattern.SubexpNames() {
+			if g != "" {
+				groups[g] = m[i]
+			}
+		}
+		reply, err := rl.handle(ctx, conversationID, groups)
+		if errors.Is(err, ErrPass) {
+			continue
+		}
+		return rl.name, reply, err
+	}
+	return "", "", nil
+}
+
+func normalize(text string) string {
+	text = strings.ToLower(strings.TrimSpace(text))
+	text = strings.Trim(text, " .!?,")
+	text = strings.TrimPrefix(text, "please ")
+	text = strings.TrimSuffix(text, " please")
+	return strings.Join(strings.Fields(text), " ")
+}
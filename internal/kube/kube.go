@@ -0,0 +1,144 @@
+// Package kube answers questions about a Kubernetes (typically k3s)
+// cluster through read-only kubectl commands.
+package kube
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"pi-agent/internal/config"
+)
+
+// timeout bounds each kubectl invocation.
+const timeout = 30 * time.Second
+
+// maxOutput caps how much kubectl output is returned to the model.
+const maxOutput = 20000
+
+// namePattern matches resource kinds, names, namespaces and containers,
+// which keeps model-supplied values from being read as flags.
+var namePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9.,\-_/]*$`)
+
+// Client runs kubectl against one cluster. It only ever issues get,
+// describe, logs and events, so nothing in the cluster is changed.
+type Client struct {
+	kubectl []string
+	cfg     config.Kubernetes
+}
+
+// NewClient finds kubectl, falling back to the copy built into k3s, and
+// returns a client for the cluster described by cfg.
+func NewClient(cfg config.Kubernetes) (*Client, error) {
+	c := &Client{cfg: cfg}
+	if path, err := exec.LookPath("kubectl"); err == nil {
+		c.kubectl = []string{path}
+	} else if path, err := exec.LookPath("k3s"); err == nil {
+		c.kubectl = []string{path, "kubectl"}
+	} else {
+		return nil, errors.New("kubernetes: neither kubectl nor k3s is installed")
+	}
+	return c, nil
+}
+
+// Get lists resources of a kind, or shows one by name, in the wide
+// table format. An empty namespace uses the configured default; "all"
+// lists every namespace.
+func (c *Client) Get(ctx context.Context, kind, name, namespace string) (string, error) {
+	if err := check(kind, name, namespace); err != nil {
+		return "", err
+	}
+	args := []string{"get", kind}
+	if name != "" {
+		args = append(args, name)
+	}
+	return c.run(ctx, namespace, append(args, "-o", "wide")...)
+}
+
+// Describe shows a resource in detail, including its recent events.
+func (c *Client) Describe(ctx context.Context, kind, name, namespace string) (string, error) {
+	if name == "" {
+		return "", errors.New("a name is required")
+	}
+	if err := check(kind, name, namespace); err != nil {
+		return "", err
+	}
+	return c.run(ctx, namespace, "describe", kind, name)
+}
+
+// Logs returns the last lines logged by a pod's container. With previous
+// set it reads the logs of the last terminated instance, which is where a
+// crash-looping container explains itself.
+func (c *Client) Logs(ctx context.Context, pod, container, namespace string, lines int, previous bool) (string, error) {
+	if err := check(pod, container, namespace); err != nil {
+		return "", err
+	}
+	args := []string{"logs", pod, "--tail=" + strconv.Itoa(lines), "--timestamps"}
+	if container != "" {
+		args = append(args, "-c", container)
+	} else {
+		args = append(args, "--all-containers")
+	}
+	if previous {
+		args = append(args, "--previous")
+	}
+	return c.run(ctx, namespace, args...)
+}
+
+// Events lists recent events, oldest first.
+func (c *Client) Events(ctx context.Context, namespace string) (string, error) {
+	if err := check(namespace); err != nil {
+		return "", err
+	}
+	return c.run(ctx, namespace, "get", "events", "--sort-by=.lastTimestamp")
+}
+
+// check rejects model-supplied values that are not plain names; empty
+// values are optional and pass.
+func check(values ...string) error {
+	for _, v := range values {
+		if v != "" && !namePattern.MatchString(v) {
+			return fmt.Errorf("invalid name %q", v)
+		}
+	}
+	return nil
+}
+
+func (c *Client) run(ctx context.Context, namespace string, args ...string) (string, error) {
+	if namespace == "" {
+		namespace = c.cfg.Namespace
+	}
+	if namespace == "all" {
+		args = append(args, "--all-namespaces")
+	} else {
+		args = append(args, "--namespace", namespace)
+	}
+	args = append(args, "--kubeconfig", c.cfg.Kubeconfig)
+	if c.cfg.Context != "" {
+		args = append(args, "--context", c.cfg.Context)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, c.kubectl[0], append(c.kubectl[1:], args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("kubectl %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("kubectl %s: %w", args[0], err)
+	}
+	if len(out) > maxOutput {
+		// Keep the end, where the newest log lines and events are.
+		out = append([]byte("[earlier output cut]\n"), out[len(out)-maxOutput:]...)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,97 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"pi-agent/internal/tools"
+)
+
+const namespaceParam = `"namespace":{"type":"string","description":"namespace; omit for the default, \"all\" for every namespace"}`
+
+// Tools returns the model-facing cluster tools.
+func (c *Client) Tools() []tools.Tool {
+	return []tools.Tool{
+		tools.New("k8s_get",
+			"List Kubernetes resources of a kind (pods, deployments, services, ingresses, nodes, ...) with their status, like kubectl get -o wide.",
+			`{"type":"object","properties":{
+				"kind":{"type":"string","description":"resource kind, e.g. pods or deployments"},
+				"name":{"type":"string","description":"optional single resource"},
+				`+namespaceParam+`
+			},"required":["kind"]}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var in struct {
+					Kind      string `json:"kind"`
+					Name      string `json:"name"`
+					Namespace string `json:"namespace"`
+				}
+				if err := tools.Decode(args, &in); err != nil {
+					return "", err
+				}
+				return nonEmpty(c.Get(ctx, in.Kind, in.Name, in.Namespace))
+			}),
+		tools.New("k8s_describe",
+			"Describe a Kubernetes resource in detail, including its conditions and recent events, like kubectl describe. Use it to find out why a pod is pending or restarting.",
+			`{"type":"object","properties":{
+				"kind":{"type":"string"},
+				"name":{"type":"string"},
+				`+namespaceParam+`
+			},"required":["kind","name"]}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var in struct {
+					Kind      string `json:"kind"`
+					Name      string `json:"name"`
+					Namespace string `json:"namespace"`
+				}
+				if err := tools.Decode(args, &in); err != nil {
+					return "", err
+				}
+				return nonEmpty(c.Describe(ctx, in.Kind, in.Name, in.Namespace))
+			}),
+		tools.New("k8s_logs",
+			"Read the recent logs of a Kubernetes pod. For a crash-looping pod set previous to read the output of the instance that crashed.",
+			`{"type":"object","properties":{
+				"pod":{"type":"string"},
+				"container":{"type":"string","description":"optional; all containers when omitted"},
+				"lines":{"type":"integer","description":"how many lines from the end (default 100)"},
+				"previous":{"type":"boolean","description":"read the previous, terminated container instead"},
+				`+namespaceParam+`
+			},"required":["pod"]}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var in struct {
+					Pod       string `json:"pod"`
+					Container string `json:"container"`
+					Lines     int    `json:"lines"`
+					Previous  bool   `json:"previous"`
+					Namespace string `json:"namespace"`
+				}
+				if err := tools.Decode(args, &in); err != nil {
+					return "", err
+				}
+				if in.Lines <= 0 {
+					in.Lines = 100
+				}
+				return nonEmpty(c.Logs(ctx, in.Pod, in.Container, in.Namespace, min(in.Lines, 1000), in.Previous))
+			}),
+		tools.New("k8s_events",
+			"List recent Kubernetes events, such as failed scheduling, image pull errors and back-off restarts.",
+			`{"type":"object","properties":{`+namespaceParam+`}}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var in struct {
+					Namespace string `json:"namespace"`
+				}
+				if err := tools.Decode(args, &in); err != nil {
+					return "", err
+				}
+				return nonEmpty(c.Events(ctx, in.Namespace))
+			}),
+	}
+}
+
+func nonEmpty(out string, err error) (string, error) {
+	if err == nil && strings.TrimSpace(out) == "" {
+		return "Nothing found.", nil
+	}
+	return out, err
+}
@@ -0,0 +1,302 @@
+// Package lists keeps named lists, such as the shopping list or a pantry
+// inventory, in the database, and mirrors them to Home Assistant's
+// shopping list or Todoist when configured.
+package lists
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"pi-agent/internal/store"
+	"pi-agent/internal/tools"
+)
+
+// DefaultList is the list items go on when none is named.
+const DefaultList = "shopping"
+
+// SyncError reports that a change was saved but could not be mirrored.
+type SyncError struct {
+	Remote string
+	Err    error
+}
+
+func (e *SyncError) Error() string { return fmt.Sprintf("updating %s: %v", e.Remote, e.Err) }
+func (e *SyncError) Unwrap() error { return e.Err }
+
+// Lists manages the named lists.
+type Lists struct {
+	db      *store.DB
+	remotes map[string]Remote // by list name
+}
+
+// New returns the lists kept in db.
+func New(db *store.DB) *Lists {
+	return &Lists{db: db, remotes: make(map[string]Remote)}
+}
+
+// Mirror mirrors a list to a remote service.
+func (l *Lists) Mirror(list string, r Remote) {
+	l.remotes[Name(list)] = r
+}
+
+// Name normalizes a list name: "the Shopping List" is "shopping".
+func Name(list string) string {
+	list = strings.ToLower(strings.TrimSpace(list))
+	list = strings.TrimPrefix(list, "the ")
+	list = strings.TrimPrefix(list, "my ")
+	list = strings.TrimSuffix(list, " list")
+	if list == "" {
+		return DefaultList
+	}
+	return list
+}
+
+// Add puts an item on a list, or updates its quantity if it is already
+// there, which added reports. A *SyncError means the item was saved but
+// not mirrored.
+func (l *Lists) Add(ctx context.Context, list, item, quantity string) (it *store.ListItem, added bool, err error) {
+	item = strings.TrimSpace(item)
+	if item == "" {
+		return nil, false, errors.New("item is required")
+	}
+	it = &store.ListItem{List: Name(list), Item: item, Quantity: strings.TrimSpace(quantity)}
+	if added, err = l.db.AddListItem(it); err != nil {
+		return nil, false, err
+	}
+	if r, ok := l.remotes[it.List]; ok && it.RemoteID == "" {
+		if err := l.push(ctx, r, it); err != nil {
+			return it, added, err
+		}
+	}
+	return it, added, nil
+}
+
+func (l *Lists) push(ctx context.Context, r Remote, it *store.ListItem) error {
+	name := it.Item
+	if it.Quantity != "" {
+		name += " (" + it.Quantity + ")"
+	}
+	id, err := r.Add(ctx, name)
+	if err != nil {
+		return &SyncError{Remote: r.Name(), Err: err}
+	}
+	it.RemoteID = id
+	return l.db.SetListItemRemote(it.ID, id)
+}
+
+// Remove takes an item off a list, checking it off remotely. It returns
+// store.ErrNotFound if the list does not have it.
+func (l *Lists) Remove(ctx context.Context, list, item string) error {
+	it, err := l.db.ListItem(Name(list), strings.TrimSpace(item))
+	if err != nil {
+		return err
+	}
+	if err := l.db.DeleteListItem(it.ID); err != nil {
+		return err
+	}
+	if r, ok := l.remotes[it.List]; ok && it.RemoteID != "" {
+		if err := r.Complete(ctx, it.RemoteID); err != nil {
+			return &SyncError{Remote: r.Name(), Err: err}
+		}
+	}
+	return nil
+}
+
+// Items returns the items on a list, first bringing in changes made
+// remotely: items added there are added here, items checked off there are
+// removed, and items that failed to sync earlier are sent again. If the
+// remote cannot be reached the local items are returned with a
+// *SyncError.
+func (l *Lists) Items(ctx context.Context, list string) ([]store.ListItem, error) {
+	list = Name(list)
+	var syncErr error
+	if r, ok := l.remotes[list]; ok {
+		syncErr = l.pull(ctx, r, list)
+	}
+	items, err := l.db.ListItems(list)
+	if err != nil {
+		return nil, err
+	}
+	return items, syncErr
+}
+
+func (l *Lists) pull(ctx context.Context, r Remote, list string) error {
+	remote, err := r.Items(ctx)
+	if err != nil {
+		return &SyncError{Remote: r.Name(), Err: err}
+	}
+	local, err := l.db.ListItems(list)
+	if err != nil {
+		return err
+	}
+	open := make(map[string]bool, len(remote))
+	for _, ri := range remote {
+		open[ri.ID] = true
+	}
+	known := make(map[string]bool, len(local))
+	var errs []error
+	for _, it := range local {
+		switch {
+		case it.RemoteID == "":
+			errs = append(errs, l.push(ctx, r, &it))
+		case !open[it.RemoteID]:
+			errs = append(errs, l.db.DeleteListItem(it.ID))
+		}
+		known[it.RemoteID] = true
+	}
+	for _, ri := range remote {
+		if known[ri.ID] || strings.TrimSpace(ri.Name) == "" {
+			continue
+		}
+		it := store.ListItem{List: list, Item: strings.TrimSpace(ri.Name), RemoteID: ri.ID}
+		if _, err := l.db.AddListItem(&it); err != nil {
+			errs = append(errs, err)
+		} else if it.RemoteID != ri.ID {
+			// It was added here under the same name without syncing.
+			errs = append(errs, l.db.SetListItemRemote(it.ID, ri.ID))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// All returns every list with items.
+func (l *Lists) All() ([]store.ListSummary, error) {
+	return l.db.Lists()
+}
+
+// Tools returns the tools for managing lists.
+func (l *Lists) Tools() []tools.Tool {
+	return []tools.Tool{
+		tools.New("add_to_list",
+			"Add an item to a named list, such as the shopping list or the pantry inventory. Adding an item already on the list updates its quantity.",
+			`{"type":"object","properties":{
+				"list":{"type":"string","description":"List name, default shopping"},
+				"item":{"type":"string"},
+				"quantity":{"type":"string","description":"Optional amount, e.g. 2 or 500 g"}
+			},"required":["item"]}`,
+			l.addTool),
+		tools.New("remove_from_list",
+			"Remove an item from a named list, e.g. once it has been bought or used up.",
+			`{"type":"object","properties":{"list":{"type":"string","description":"List name, default shopping"},"item":{"type":"string"}},"required":["item"]}`,
+			l.removeTool),
+		tools.New("show_list",
+			"Show the items on a named list, or, without a name, which lists there are.",
+			`{"type":"object","properties":{"list":{"type":"string"}}}`,
+			l.showTool),
+	}
+}
+
+type listArgs struct {
+	List     string `json:"list"`
+	Item     string `json:"item"`
+	Quantity string `json:"quantity"`
+}
+
+func (l *Lists) addTool(ctx context.Context, args json.RawMessage) (string, error) {
+	var p listArgs
+	if err := tools.Decode(args, &p); err != nil {
+		return "", err
+	}
+	it, added, err := l.Add(ctx, p.List, p.Item, p.Quantity)
+	if it == nil {
+		return "", err
+	}
+	return AddReply(it, added, err), nil
+}
+
+func (l *Lists) removeTool(ctx context.Context, args json.RawMessage) (string, error) {
+	var p listArgs
+	if err := tools.Decode(args, &p); err != nil {
+		return "", err
+	}
+	return RemoveReply(Name(p.List), p.Item, l.Remove(ctx, p.List, p.Item))
+}
+
+func (l *Lists) showTool(ctx context.Context, args json.RawMessage) (string, error) {
+	var p listArgs
+	if err := tools.Decode(args, &p); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(p.List) == "" {
+		all, err := l.All()
+		if err != nil {
+			return "", err
+		}
+		if len(all) == 0 {
+			return "All lists are empty.", nil
+		}
+		parts := make([]string, len(all))
+		for i, s := range all {
+			parts[i] = fmt.Sprintf("%s (%d)", s.Name, s.Items)
+		}
+		return "Lists: " + strings.Join(parts, ", ") + ".", nil
+	}
+	items, err := l.Items(ctx, p.List)
+	if items == nil && err != nil && !errors.As(err, new(*SyncError)) {
+		return "", err
+	}
+	return ShowReply(Name(p.List), items, err), nil
+}
+
+// AddReply describes the outcome of Add in a sentence.
+func AddReply(it *store.ListItem, added bool, err error) string {
+	what := it.Item
+	if it.Quantity != "" {
+		what = it.Quantity + " " + it.Item
+	}
+	reply := fmt.Sprintf("Added %s to the %s list.", what, it.List)
+	if !added {
+		reply = fmt.Sprintf("%s is already on the %s list.", capitalize(it.Item), it.List)
+		if it.Quantity != "" {
+			reply = fmt.Sprintf("%s is already on the %s list (%s).", capitalize(it.Item), it.List, it.Quantity)
+		}
+	}
+	return reply + syncNote(err)
+}
+
+// RemoveReply describes the outcome of Remove in a sentence. Errors other
+// than a missing item or a failed sync are returned.
+func RemoveReply(list, item string, err error) (string, error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return fmt.Sprintf("%s isn't on the %s list.", capitalize(item), list), nil
+	case err != nil && !errors.As(err, new(*SyncError)):
+		return "", err
+	}
+	return fmt.Sprintf("Removed %s from the %s list.", item, list) + syncNote(err), nil
+}
+
+// ShowReply lists a list's items in a sentence.
+func ShowReply(list string, items []store.ListItem, err error) string {
+	if len(items) == 0 {
+		return fmt.Sprintf("The %s list is empty.", list) + syncNote(err)
+	}
+	parts := make([]string, len(items))
+	for i, it := range items {
+		parts[i] = it.Item
+		if it.Quantity != "" {
+			parts[i] = it.Quantity + " " + it.Item
+		}
+	}
+	return fmt.Sprintf("The %s list has %s.", list, strings.Join(parts, ", ")) + syncNote(err)
+}
+
+func syncNote(err error) string {
+	var se *SyncError
+	if !errors.As(err, &se) {
+		return ""
+	}
+	log.Printf("lists: %v", err)
+	return fmt.Sprintf(" (%s could not be updated.)", se.Remote)
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
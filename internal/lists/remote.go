@@ -0,0 +1,141 @@
+package lists
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"pi-agent/internal/homeassistant"
+)
+
+// Remote is a service a list is mirrored to.
+type Remote interface {
+	// Name names the service in messages, e.g. "Todoist".
+	Name() string
+	// Add adds an item and returns its ID there.
+	Add(ctx context.Context, name string) (id string, err error)
+	// Complete checks an item off.
+	Complete(ctx context.Context, id string) error
+	// Items returns the open items.
+	Items(ctx context.Context) ([]RemoteItem, error)
+}
+
+// RemoteItem is an open item in a remote list.
+type RemoteItem struct {
+	ID   string
+	Name string
+}
+
+// HomeAssistant mirrors a list to Home Assistant's shopping list.
+type HomeAssistant struct {
+	Client *homeassistant.Client
+}
+
+func (h HomeAssistant) Name() string { return "Home Assistant" }
+
+func (h HomeAssistant) Add(ctx context.Context, name string) (string, error) {
+	item, err := h.Client.AddShoppingItem(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	return item.ID, nil
+}
+
+func (h HomeAssistant) Complete(ctx context.Context, id string) error {
+	return h.Client.CompleteShoppingItem(ctx, id)
+}
+
+func (h HomeAssistant) Items(ctx context.Context) ([]RemoteItem, error) {
+	items, err := h.Client.ShoppingList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out []RemoteItem
+	for _, it := range items {
+		if !it.Complete {
+			out = append(out, RemoteItem{ID: it.ID, Name: it.Name})
+		}
+	}
+	return out, nil
+}
+
+// todoistURL is the Todoist REST API.
+var todoistURL = "https://api.todoist.com/rest/v2"
+
+// Todoist mirrors a list to a Todoist project, as tasks.
+type Todoist struct {
+	Token     string
+	ProjectID string
+}
+
+func (t Todoist) Name() string { return "Todoist" }
+
+func (t Todoist) Add(ctx context.Context, name string) (string, error) {
+	var task struct {
+		ID string `json:"id"`
+	}
+	err := t.do(ctx, "POST", "/tasks", map[string]string{"content": name, "project_id": t.ProjectID}, &task)
+	return task.ID, err
+}
+
+func (t Todoist) Complete(ctx context.Context, id string) error {
+	return t.do(ctx, "POST", "/tasks/"+url.PathEscape(id)+"/close", nil, nil)
+}
+
+func (t Todoist) Items(ctx context.Context) ([]RemoteItem, error) {
+	var tasks []struct {
+		ID      string `json:"id"`
+		Content string `json:"content"`
+	}
+	if err := t.do(ctx, "GET", "/tasks?project_id="+url.QueryEscape(t.ProjectID), nil, &tasks); err != nil {
+		return nil, err
+	}
+	out := make([]RemoteItem, len(tasks))
+	for i, task := range tasks {
+		out[i] = RemoteItem{ID: task.ID, Name: task.Content}
+	}
+	return out, nil
+}
+
+func (t Todoist) do(ctx context.Context, method, path string, body, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("marshaling request: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, todoistURL+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+t.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("todoist request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("todoist error %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding todoist response: %w", err)
+	}
+	return nil
+}
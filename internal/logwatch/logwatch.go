@@ -0,0 +1,210 @@
+// Package logwatch tails log files and journald units, alerting on lines
+// that match configured rules and having the model summarize new errors
+// on a schedule.
+package logwatch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"pi-agent/internal/config"
+	"pi-agent/internal/notify"
+	"pi-agent/internal/tools"
+)
+
+// maxErrors caps how many error lines are kept between summaries and for
+// the recent errors tool.
+const maxErrors = 500
+
+var priorities = map[string]notify.Priority{
+	"low": notify.PriorityLow, "default": notify.PriorityDefault,
+	"high": notify.PriorityHigh, "urgent": notify.PriorityUrgent,
+}
+
+type rule struct {
+	config.LogRule
+	pattern   *regexp.Regexp
+	lastAlert time.Time
+}
+
+type source struct {
+	config.LogSource
+	rules []*rule
+}
+
+// Entry is an error line seen in a source.
+type Entry struct {
+	Source string    `json:"source"`
+	Line   string    `json:"line"`
+	SeenAt time.Time `json:"seen_at"`
+}
+
+// Watcher watches the configured log sources.
+type Watcher struct {
+	sources  []*source
+	errors   *regexp.Regexp
+	complete func(ctx context.Context, prompt string) (string, error)
+	notifier notify.Notifier
+
+	mu      sync.Mutex
+	recent  []Entry // newest last, at most maxErrors
+	pending int     // entries at the end of recent not yet summarized
+}
+
+// New creates a watcher from a validated configuration.
+func New(cfg config.LogWatch, complete func(ctx context.Context, prompt string) (string, error), n notify.Notifier) (*Watcher, error) {
+	w := &Watcher{complete: complete, notifier: n}
+	var err error
+	if w.errors, err = regexp.Compile(cfg.ErrorPattern); err != nil {
+		return nil, err
+	}
+	for _, src := range cfg.Sources {
+		s := &source{LogSource: src}
+		for _, r := range src.Rules {
+			re, err := regexp.Compile(r.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("log source %q: %w", src.Name, err)
+			}
+			s.rules = append(s.rules, &rule{LogRule: r, pattern: re})
+		}
+		w.sources = append(w.sources, s)
+	}
+	return w, nil
+}
+
+// Run watches every source until ctx is cancelled.
+func (w *Watcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, src := range w.sources {
+		lines := make(chan string, 64)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if src.Unit != "" {
+				tailJournal(ctx, src.Unit, lines)
+			} else {
+				tailFile(ctx, src.Path, lines)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case line := <-lines:
+					w.handle(ctx, src, line)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (w *Watcher) handle(ctx context.Context, src *source, line string) {
+	now := time.Now()
+	for _, r := range src.rules {
+		if !r.pattern.MatchString(line) || now.Sub(r.lastAlert) < time.Duration(r.CooldownMinutes)*time.Minute {
+			continue
+		}
+		r.lastAlert = now
+		title := r.Title
+		if title == "" {
+			title = src.Name + " log alert"
+		}
+		msg := notify.Message{Title: title, Body: line, Priority: priorities[r.Priority], Tags: []string{"scroll"}}
+		if err := w.notifier.Notify(ctx, msg); err != nil {
+			log.Printf("log watch %s: notifying: %v", src.Name, err)
+		}
+	}
+	if !w.errors.MatchString(line) {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.recent = append(w.recent, Entry{Source: src.Name, Line: line, SeenAt: now})
+	if n := len(w.recent) - maxErrors; n > 0 {
+		w.recent = append(w.recent[:0], w.recent[n:]...)
+	}
+	w.pending = min(w.pending+1, len(w.recent))
+}
+
+// Recent returns the error lines seen most recently, oldest first.
+func (w *Watcher) Recent(limit int) []Entry {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	start := max(len(w.recent)-limit, 0)
+	return append([]Entry(nil), w.recent[start:]...)
+}
+
+// Summarize has the model summarize the error lines seen since the last
+// summary and sends the result as a notification. It does nothing if
+// there were none.
+func (w *Watcher) Summarize(ctx context.Context) error {
+	w.mu.Lock()
+	entries := append([]Entry(nil), w.recent[len(w.recent)-w.pending:]...)
+	w.pending = 0
+	w.mu.Unlock()
+	if len(entries) == 0 {
+		return nil
+	}
+
+	prompt := fmt.Sprintf(`These error lines were logged on the home server since the last check.
+Summarize them in at most 5 sentences for a phone notification: group repeats, say which service each problem is in, and point out anything that looks serious or new. Say so plainly if it is just routine noise.
+
+%s`, formatEntries(entries))
+	summary, err := w.complete(ctx, prompt)
+	if err != nil {
+		return fmt.Errorf("summarizing logs: %w", err)
+	}
+	title := fmt.Sprintf("Log summary: %d new errors", len(entries))
+	return w.notifier.Notify(ctx, notify.Message{Title: title, Body: summary, Priority: notify.PriorityDefault, Tags: []string{"scroll"}})
+}
+
+func formatEntries(entries []Entry) string {
+	var b strings.Builder
+	for _, e := range entries {
+		fmt.Fprintf(&b, "[%s %s] %s\n", e.SeenAt.Format("Jan 2 15:04:05"), e.Source, e.Line)
+	}
+	return b.String()
+}
+
+// Tools returns model-facing log tools.
+func (w *Watcher) Tools() []tools.Tool {
+	return []tools.Tool{
+		tools.New("log_recent_errors",
+			"List error lines recently logged by the watched services on the home server, optionally for one source.",
+			`{"type":"object","properties":{
+				"source":{"type":"string","description":"optional log source name"},
+				"limit":{"type":"integer","description":"maximum lines (default 50)"}
+			}}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var in struct {
+					Source string `json:"source"`
+					Limit  int    `json:"limit"`
+				}
+				if err := tools.Decode(args, &in); err != nil {
+					return "", err
+				}
+				if in.Limit <= 0 {
+					in.Limit = 50
+				}
+				var entries []Entry
+				for _, e := range w.Recent(maxErrors) {
+					if in.Source == "" || strings.EqualFold(e.Source, in.Source) {
+						entries = append(entries, e)
+					}
+				}
+				if len(entries) == 0 {
+					return "No errors logged since the server started.", nil
+				}
+				return formatEntries(entries[max(len(entries)-in.Limit, 0):]), nil
+			}),
+	}
+}
@@ -0,0 +1,128 @@
+package logwatch
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// pollInterval is how often tailed files are checked for new lines.
+const pollInterval = 2 * time.Second
+
+// maxLine caps the length of a single log line.
+const maxLine = 16 << 10
+
+// tailFile sends lines appended to path until ctx is cancelled. It starts
+// at the end of the file, and starts over from the beginning when the
+// file is truncated or replaced, as log rotation does.
+func tailFile(ctx context.Context, path string, lines chan<- string) {
+	var f *os.File
+	var r *bufio.Reader
+	var partial []byte
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+	atEnd := true // only the first open skips existing content
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		if f == nil {
+			var err error
+			if f, err = os.Open(path); err == nil {
+				if atEnd {
+					f.Seek(0, io.SeekEnd)
+				}
+				r = bufio.NewReaderSize(f, maxLine)
+			} else if !errors.Is(err, os.ErrNotExist) {
+				log.Printf("log watch %s: %v", path, err)
+			}
+			atEnd = false
+		}
+		for f != nil {
+			chunk, err := r.ReadSlice('\n')
+			partial = append(partial, chunk...)
+			if err == nil || errors.Is(err, bufio.ErrBufferFull) {
+				if len(partial) > 0 && (err == nil || len(partial) >= maxLine) {
+					send(ctx, lines, string(trimNewline(partial)))
+					partial = partial[:0]
+				}
+				continue
+			}
+			break // io.EOF: wait for more
+		}
+		if f != nil && rotated(f, path) {
+			f.Close()
+			f, r, partial = nil, nil, partial[:0]
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// rotated reports whether f no longer is the file at path, or has been
+// truncated below the current read offset.
+func rotated(f *os.File, path string) bool {
+	cur, err := f.Stat()
+	if err != nil {
+		return true
+	}
+	now, err := os.Stat(path)
+	if err != nil || !os.SameFile(cur, now) {
+		return true
+	}
+	off, err := f.Seek(0, io.SeekCurrent)
+	return err == nil && now.Size() < off
+}
+
+// tailJournal follows a systemd unit's journal, restarting journalctl if
+// it exits.
+func tailJournal(ctx context.Context, unit string, lines chan<- string) {
+	for ctx.Err() == nil {
+		cmd := exec.CommandContext(ctx, "journalctl", "--follow", "--lines=0", "--output=cat", "--unit", unit)
+		out, err := cmd.StdoutPipe()
+		if err == nil {
+			err = cmd.Start()
+		}
+		if err != nil {
+			log.Printf("log watch %s: %v", unit, err)
+		} else {
+			sc := bufio.NewScanner(out)
+			sc.Buffer(make([]byte, 0, 4096), maxLine)
+			for sc.Scan() {
+				send(ctx, lines, sc.Text())
+			}
+			if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+				log.Printf("log watch %s: journalctl: %v", unit, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(30 * time.Second):
+		}
+	}
+}
+
+func send(ctx context.Context, lines chan<- string, line string) {
+	select {
+	case lines <- line:
+	case <-ctx.Done():
+	}
+}
+
+func trimNewline(b []byte) []byte {
+	for len(b) > 0 && (b[len(b)-1] == '\n' || b[len(b)-1] == '\r') {
+		b = b[:len(b)-1]
+	}
+	return b
+}
@@ -0,0 +1,152 @@
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"pi-agent/internal/store"
+)
+
+// Policy controls which messages compaction replaces.
+type Policy struct {
+	// Keep is the number of most recent messages left untouched in each
+	// conversation.
+	Keep int `json:"keep"`
+	// MinExcess is how many messages beyond Keep a conversation must have
+	// before it is compacted, so short overflows are left alone.
+	MinExcess int `json:"min_excess"`
+	// HistoryDays is how long deleted messages and earlier versions of
+	// edited ones are kept for history queries before they are purged.
+	HistoryDays int `json:"history_days"`
+}
+
+// DefaultPolicy keeps the last 40 messages, compacts once at least 20
+// more have accumulated, and keeps 30 days of history.
+var DefaultPolicy = Policy{Keep: 40, MinExcess: 20, HistoryDays: 30}
+
+// Report describes the outcome of a compaction run.
+type Report struct {
+	Conversations  int   `json:"conversations"`   // conversations summarized
+	MessagesPruned int   `json:"messages_pruned"` // messages replaced by summaries
+	HistoryPurged  int   `json:"history_purged"`  // deleted messages past HistoryDays
+	BytesBefore    int64 `json:"bytes_before"`
+	BytesAfter     int64 `json:"bytes_after"`
+	BytesReclaimed int64 `json:"bytes_reclaimed"`
+}
+
+// maxTranscript bounds the transcript sent to the summarizer.
+const maxTranscript = 60000
+
+// Compactor summarizes old conversation history and reclaims space.
+type Compactor struct {
+	db       *store.DB
+	complete func(ctx context.Context, prompt string) (string, error)
+}
+
+// NewCompactor creates a compactor that summarizes with complete.
+func NewCompactor(db *store.DB, complete func(ctx context.Context, prompt string) (string, error)) *Compactor {
+	return &Compactor{db: db, complete: complete}
+}
+
+// Compact replaces everything but the most recent messages of each
+// conversation with a model-written summary, purges history older than
+// p.HistoryDays, then optimizes the full-text index and vacuums the
+// database. A conversation whose summary fails is left as it was, and
+// private conversations are not compacted.
+func (c *Compactor) Compact(ctx context.Context, p Policy) (*Report, error) {
+	if p.Keep <= 0 {
+		p.Keep = DefaultPolicy.Keep
+	}
+	if p.MinExcess <= 0 {
+		p.MinExcess = DefaultPolicy.MinExcess
+	}
+	if p.HistoryDays <= 0 {
+		p.HistoryDays = DefaultPolicy.HistoryDays
+	}
+	before, err := c.db.Size()
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{BytesBefore: before}
+
+	convs, err := c.db.Conversations()
+	if err != nil {
+		return nil, err
+	}
+	for _, conv := range convs {
+		// The summarizer may be a cloud model, which private
+		// conversations must not reach; encrypted ones cannot be read
+		// without their keys.
+		if conv.Messages < p.Keep+p.MinExcess || conv.Private || conv.Encrypted {
+			continue
+		}
+		n, err := c.compactConversation(ctx, conv.ID, p.Keep)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			log.Printf("compact %s: %v", conv.ID, err)
+			continue
+		}
+		report.Conversations++
+		report.MessagesPruned += n
+	}
+
+	purged, err := c.db.PurgeTombstones(time.Now().AddDate(0, 0, -p.HistoryDays))
+	if err != nil {
+		return nil, err
+	}
+	report.HistoryPurged = purged
+
+	if err := c.db.Optimize(); err != nil {
+		return nil, err
+	}
+	if report.BytesAfter, err = c.db.Size(); err != nil {
+		return nil, err
+	}
+	report.BytesReclaimed = report.BytesBefore - report.BytesAfter
+	return report, nil
+}
+
+func (c *Compactor) compactConversation(ctx context.Context, convID string, keep int) (int, error) {
+	msgs, err := c.db.Messages(convID)
+	if err != nil {
+		return 0, err
+	}
+	// Pinned messages are kept as they are rather than summarized.
+	pinned, err := c.db.PinnedMessages(convID)
+	if err != nil {
+		return 0, err
+	}
+	old := slices.DeleteFunc(msgs[:len(msgs)-keep], func(m store.Message) bool {
+		return slices.ContainsFunc(pinned, func(p store.Message) bool { return p.ID == m.ID })
+	})
+	if len(old) == 0 {
+		return 0, nil
+	}
+
+	var b strings.Builder
+	for _, m := range old {
+		fmt.Fprintf(&b, "%s: %s\n\n", m.Role, m.Content)
+	}
+	transcript := b.String()
+	if len(transcript) > maxTranscript {
+		// Earlier summaries come first, so keep the start and the most
+		// recent part of what is being replaced.
+		transcript = transcript[:maxTranscript/2] + "\n…\n" + transcript[len(transcript)-maxTranscript/2:]
+	}
+
+	summary, err := c.complete(ctx, `Summarize this conversation history so it can replace the original messages.
+Keep facts, decisions, preferences, names, dates and open tasks; drop small talk. Write at most 300 words.
+
+`+transcript)
+	if err != nil {
+		return 0, fmt.Errorf("summarizing: %w", err)
+	}
+	summary = store.SummaryPrefix + strings.TrimSpace(summary)
+	return c.db.ReplaceMessages(convID, old[len(old)-1].ID, summary)
+}
@@ -0,0 +1,188 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"pi-agent/engine"
+	"pi-agent/internal/store"
+)
+
+// queueSize bounds the messages waiting to be published. Deltas are
+// dropped rather than slowing a reply down when the broker falls behind.
+const queueSize = 512
+
+type message struct {
+	topic   string
+	payload []byte
+	retain  bool
+}
+
+// Mirror publishes the replies of conversations bound to MQTT topics. Each
+// complete reply goes to the binding's topic as plain text, and, if the
+// binding asks for deltas, each fragment to <topic>/delta as it streams
+// and the turn's progress to <topic>/progress as JSON, for displays that
+// show a typing indicator until the reply arrives. It implements
+// engine.Observer and engine.ProgressObserver.
+type Mirror struct {
+	client *Client
+	db     *store.DB
+	queue  chan message
+
+	mu       sync.RWMutex
+	bindings map[string]store.MQTTOutput
+}
+
+// NewMirror returns a mirror publishing through client, with the bindings
+// saved in the database.
+func NewMirror(client *Client, db *store.DB) (*Mirror, error) {
+	outputs, err := db.MQTTOutputs()
+	if err != nil {
+		return nil, err
+	}
+	m := &Mirror{client: client, db: db, queue: make(chan message, queueSize), bindings: make(map[string]store.MQTTOutput)}
+	for _, o := range outputs {
+		m.bindings[o.ConversationID] = o
+	}
+	return m, nil
+}
+
+// Run publishes queued messages until ctx is cancelled.
+func (m *Mirror) Run(ctx context.Context) {
+	defer m.client.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-m.queue:
+			if err := m.client.Publish(ctx, msg.topic, msg.payload, msg.retain); err != nil {
+				log.Printf("mqtt: %v", err)
+			}
+		}
+	}
+}
+
+// Bind mirrors a conversation to a topic, replacing any earlier binding.
+// Encrypted conversations cannot be bound: their replies would be
+// published in plain text.
+func (m *Mirror) Bind(o store.MQTTOutput) (*store.MQTTOutput, error) {
+	if err := validTopic(o.Topic); err != nil {
+		return nil, err
+	}
+	if encrypted, err := m.db.Encrypted(o.ConversationID); err != nil {
+		return nil, err
+	} else if encrypted {
+		return nil, errors.New("encrypted conversations cannot be mirrored")
+	}
+	if !o.Replies && !o.Deltas {
+		return nil, errors.New("nothing to publish: enable replies, deltas or both")
+	}
+	if err := m.db.SetMQTTOutput(&o); err != nil {
+		return nil, err
+	}
+	saved, err := m.db.MQTTOutput(o.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	m.bindings[o.ConversationID] = *saved
+	m.mu.Unlock()
+	return saved, nil
+}
+
+// Unbind stops mirroring a conversation.
+func (m *Mirror) Unbind(conversationID string) error {
+	if err := m.db.DeleteMQTTOutput(conversationID); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	delete(m.bindings, conversationID)
+	m.mu.Unlock()
+	return nil
+}
+
+// validTopic checks that a topic can be published to: not empty, without
+// wildcards, and not reserved by the broker.
+func validTopic(topic string) error {
+	switch {
+	case topic == "":
+		return errors.New("topic is required")
+	case strings.ContainsAny(topic, "+#\x00"):
+		return fmt.Errorf("topic %q: wildcards cannot be published to", topic)
+	case strings.HasPrefix(topic, "$"):
+		return fmt.Errorf("topic %q is reserved by the broker", topic)
+	case len(topic) > 0xFFFF:
+		return errors.New("topic is too long")
+	}
+	return nil
+}
+
+// binding returns a conversation's binding, if it has one and is neither
+// private nor encrypted. A private conversation keeps its binding for when
+// privacy mode is turned off; EncryptConversation drops the binding, but one
+// made before may still be held here.
+func (m *Mirror) binding(conversationID string) (store.MQTTOutput, bool) {
+	m.mu.RLock()
+	o, ok := m.bindings[conversationID]
+	m.mu.RUnlock()
+	if !ok {
+		return o, false
+	}
+	if private, err := m.db.Private(conversationID); err != nil || private {
+		if err != nil {
+			log.Printf("mqtt: %v", err)
+		}
+		return o, false
+	}
+	if encrypted, err := m.db.Encrypted(conversationID); err != nil || encrypted {
+		if err != nil {
+			log.Printf("mqtt: %v", err)
+		}
+		return o, false
+	}
+	return o, true
+}
+
+// Delta implements engine.Observer.
+func (m *Mirror) Delta(conversationID, content string) {
+	if o, ok := m.binding(conversationID); ok && o.Deltas {
+		m.enqueue(message{topic: o.Topic + "/delta", payload: []byte(content)})
+	}
+}
+
+// Reply implements engine.Observer.
+func (m *Mirror) Reply(conversationID, content string) {
+	if o, ok := m.binding(conversationID); ok && o.Replies {
+		m.enqueue(message{topic: o.Topic, payload: []byte(content), retain: o.Retain})
+	}
+}
+
+// Suggestions publishes the follow-up prompts offered with a reply to
+// <topic>/suggestions as a JSON array, for bindings that publish replies.
+func (m *Mirror) Suggestions(conversationID string, list []string) {
+	if o, ok := m.binding(conversationID); ok && o.Replies {
+		payload, _ := json.Marshal(list)
+		m.enqueue(message{topic: o.Topic + "/suggestions", payload: payload, retain: o.Retain})
+	}
+}
+
+// Progress implements engine.ProgressObserver.
+func (m *Mirror) Progress(conversationID string, p engine.Progress) {
+	if o, ok := m.binding(conversationID); ok && o.Deltas {
+		payload, _ := json.Marshal(p)
+		m.enqueue(message{topic: o.Topic + "/progress", payload: payload})
+	}
+}
+
+func (m *Mirror) enqueue(msg message) {
+	select {
+	case m.queue <- msg:
+	default:
+		log.Printf("mqtt: queue full, dropping message for %s", msg.topic)
+	}
+}
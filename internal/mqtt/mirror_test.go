@@ -0,0 +1,89 @@
+package mqtt
+
+import (
+	"path/filepath"
+	"testing"
+
+	"pi-agent/engine"
+	"pi-agent/internal/store"
+)
+
+func newTestMirror(t *testing.T) (*Mirror, *store.DB) {
+	t.Helper()
+	db, err := store.Open(filepath.Join(t.TempDir(), "conversations.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	m, err := NewMirror(nil, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, db
+}
+
+// published drains the mirror's queue.
+func published(m *Mirror) []string {
+	var topics []string
+	for {
+		select {
+		case msg := <-m.queue:
+			topics = append(topics, msg.topic)
+		default:
+			return topics
+		}
+	}
+}
+
+func TestMirrorSkipsEncrypted(t *testing.T) {
+	m, db := newTestMirror(t)
+	if _, err := m.Bind(store.MQTTOutput{ConversationID: "c1", Topic: "pi/c1", Replies: true, Deltas: true}); err != nil {
+		t.Fatal(err)
+	}
+	mirror := func() {
+		m.Delta("c1", "He")
+		m.Progress("c1", engine.Progress{Stage: engine.StageTokens})
+		m.Reply("c1", "Hello")
+		m.Suggestions("c1", []string{"More"})
+	}
+	mirror()
+	if got := published(m); len(got) != 4 {
+		t.Fatalf("published %v, want the delta, progress, reply and suggestions", got)
+	}
+
+	key := make([]byte, store.KeySize)
+	if err := db.EncryptConversation("c1", key); err != nil {
+		t.Fatal(err)
+	}
+	mirror()
+	if got := published(m); len(got) != 0 {
+		t.Errorf("published %v for an encrypted conversation", got)
+	}
+	if _, err := db.MQTTOutput("c1"); err != store.ErrNotFound {
+		t.Errorf("binding after encrypting: err = %v, want ErrNotFound", err)
+	}
+	if _, err := m.Bind(store.MQTTOutput{ConversationID: "c1", Topic: "pi/c1", Replies: true}); err == nil {
+		t.Error("bound an encrypted conversation")
+	}
+}
+
+func TestMirrorSkipsPrivate(t *testing.T) {
+	m, db := newTestMirror(t)
+	if _, err := m.Bind(store.MQTTOutput{ConversationID: "c1", Topic: "pi/c1", Replies: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetPrivate("c1", true); err != nil {
+		t.Fatal(err)
+	}
+	m.Reply("c1", "Hello")
+	if got := published(m); len(got) != 0 {
+		t.Errorf("published %v for a private conversation", got)
+	}
+	if err := db.SetPrivate("c1", false); err != nil {
+		t.Fatal(err)
+	}
+	m.Reply("c1", "Hello")
+	if got := published(m); len(got) != 1 {
+		t.Errorf("published %v once privacy mode is off, want the reply", got)
+	}
+}
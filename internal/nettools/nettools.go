@@ -0,0 +1,300 @@
+// Package nettools runs network diagnostics from the device itself: ping,
+// DNS lookups, traceroute, port checks and a scan of the local network.
+package nettools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxCount caps the number of pings per check.
+const maxCount = 20
+
+// hostPattern keeps model- and API-supplied hosts from being read as
+// command-line flags.
+var hostPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9.:\-_]*$`)
+
+// Toolkit runs the diagnostics, using ping and traceroute where installed.
+type Toolkit struct {
+	ping       string // path of ping; empty falls back to TCP connects
+	traceroute []string
+}
+
+// New finds the diagnostic commands available on the system.
+func New() *Toolkit {
+	t := &Toolkit{}
+	if path, err := exec.LookPath("ping"); err == nil {
+		t.ping = path
+	}
+	if path, err := exec.LookPath("traceroute"); err == nil {
+		t.traceroute = []string{path, "-n", "-q", "1", "-w", "2", "-m", "20"}
+	} else if path, err := exec.LookPath("tracepath"); err == nil {
+		t.traceroute = []string{path, "-n", "-m", "20"}
+	}
+	return t
+}
+
+func checkHost(host string) error {
+	if !hostPattern.MatchString(host) {
+		return fmt.Errorf("invalid host %q", host)
+	}
+	return nil
+}
+
+// PingResult summarizes a ping check. RTTs are in milliseconds.
+type PingResult struct {
+	Host     string  `json:"host"`
+	Method   string  `json:"method"` // "icmp", or "tcp" when ping is not installed
+	Sent     int     `json:"sent"`
+	Received int     `json:"received"`
+	MinRTT   float64 `json:"min_rtt_ms,omitzero"`
+	AvgRTT   float64 `json:"avg_rtt_ms,omitzero"`
+	MaxRTT   float64 `json:"max_rtt_ms,omitzero"`
+}
+
+// Loss returns the fraction of pings that went unanswered.
+func (p PingResult) Loss() float64 {
+	if p.Sent == 0 {
+		return 0
+	}
+	return float64(p.Sent-p.Received) / float64(p.Sent)
+}
+
+func (p PingResult) String() string {
+	if p.Received == 0 {
+		return fmt.Sprintf("%s did not answer any of %d pings.", p.Host, p.Sent)
+	}
+	return fmt.Sprintf("%s: %d/%d answered (%.0f%% loss), round trip min/avg/max %.1f/%.1f/%.1f ms",
+		p.Host, p.Received, p.Sent, p.Loss()*100, p.MinRTT, p.AvgRTT, p.MaxRTT)
+}
+
+var (
+	pingCountRe = regexp.MustCompile(`(\d+) packets transmitted, (\d+) (?:packets )?received`)
+	pingRTTRe   = regexp.MustCompile(`= ([\d.]+)/([\d.]+)/([\d.]+)`)
+)
+
+// Ping sends count echo requests to host. Without a ping binary it times
+// TCP connections to port 443 instead, which most hosts answer.
+func (t *Toolkit) Ping(ctx context.Context, host string, count int) (*PingResult, error) {
+	if err := checkHost(host); err != nil {
+		return nil, err
+	}
+	count = min(max(count, 1), maxCount)
+	if t.ping == "" {
+		return tcpPing(ctx, host, count)
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(count+5)*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, t.ping, "-c", strconv.Itoa(count), "-W", "2", "-i", "0.5", host)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	// ping exits 1 when nothing answered, which is a result, not a failure.
+	var exit *exec.ExitError
+	if err != nil && !(errors.As(err, &exit) && exit.ExitCode() == 1) {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("ping: %s", msg)
+		}
+		return nil, fmt.Errorf("ping: %w", err)
+	}
+	res := &PingResult{Host: host, Method: "icmp", Sent: count}
+	if m := pingCountRe.FindSubmatch(out); m != nil {
+		res.Sent, _ = strconv.Atoi(string(m[1]))
+		res.Received, _ = strconv.Atoi(string(m[2]))
+	}
+	if m := pingRTTRe.FindSubmatch(out); m != nil {
+		res.MinRTT, _ = strconv.ParseFloat(string(m[1]), 64)
+		res.AvgRTT, _ = strconv.ParseFloat(string(m[2]), 64)
+		res.MaxRTT, _ = strconv.ParseFloat(string(m[3]), 64)
+	}
+	return res, nil
+}
+
+func tcpPing(ctx context.Context, host string, count int) (*PingResult, error) {
+	res := &PingResult{Host: host, Method: "tcp", Sent: count}
+	var total float64
+	for range count {
+		p := CheckPort(ctx, host, 443, 2*time.Second)
+		if !p.Open {
+			continue
+		}
+		ms := p.Latency.Seconds() * 1000
+		if res.Received == 0 || ms < res.MinRTT {
+			res.MinRTT = ms
+		}
+		res.MaxRTT = max(res.MaxRTT, ms)
+		total += ms
+		res.Received++
+	}
+	if res.Received > 0 {
+		res.AvgRTT = total / float64(res.Received)
+	}
+	return res, ctx.Err()
+}
+
+// PortResult is the outcome of a TCP port check.
+type PortResult struct {
+	Host    string        `json:"host"`
+	Port    int           `json:"port"`
+	Open    bool          `json:"open"`
+	Latency time.Duration `json:"latency,omitzero"`
+	Error   string        `json:"error,omitempty"`
+}
+
+func (p PortResult) String() string {
+	if p.Open {
+		return fmt.Sprintf("%s port %d is open (connected in %s)", p.Host, p.Port, p.Latency.Round(time.Millisecond))
+	}
+	return fmt.Sprintf("%s port %d is not reachable: %s", p.Host, p.Port, p.Error)
+}
+
+// CheckPort tries to open a TCP connection to host:port.
+func CheckPort(ctx context.Context, host string, port int, timeout time.Duration) PortResult {
+	res := PortResult{Host: host, Port: port}
+	d := net.Dialer{Timeout: timeout}
+	start := time.Now()
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		res.Error = dialError(err)
+		return res
+	}
+	conn.Close()
+	res.Open, res.Latency = true, time.Since(start)
+	return res
+}
+
+// dialError shortens a dial error to its cause, e.g. "connection refused".
+func dialError(err error) string {
+	var op *net.OpError
+	if errors.As(err, &op) && op.Err != nil {
+		err = op.Err
+	}
+	var sys *os.SyscallError
+	if errors.As(err, &sys) {
+		err = sys.Err
+	}
+	var dns *net.DNSError
+	if errors.As(err, &dns) {
+		return "could not resolve " + dns.Name
+	}
+	if errors.Is(err, context.DeadlineExceeded) || strings.Contains(err.Error(), "i/o timeout") {
+		return "timed out"
+	}
+	return err.Error()
+}
+
+// DNSResult holds the answers to a DNS lookup.
+type DNSResult struct {
+	Name     string        `json:"name"`
+	Type     string        `json:"type"`
+	Server   string        `json:"server,omitempty"`
+	Answers  []string      `json:"answers"`
+	Duration time.Duration `json:"duration"`
+}
+
+func (d DNSResult) String() string {
+	via := "the system resolver"
+	if d.Server != "" {
+		via = d.Server
+	}
+	return fmt.Sprintf("%s %s via %s in %s:\n%s", d.Type, d.Name, via, d.Duration.Round(time.Millisecond), strings.Join(d.Answers, "\n"))
+}
+
+// Lookup resolves name as a record type (A, AAAA, CNAME, MX, NS, TXT or
+// PTR; default A) using the system resolver, or server if given.
+func Lookup(ctx context.Context, name, recordType, server string) (*DNSResult, error) {
+	recordType = strings.ToUpper(recordType)
+	if recordType == "" {
+		recordType = "A"
+	}
+	r := net.DefaultResolver
+	if server != "" {
+		if err := checkHost(server); err != nil {
+			return nil, err
+		}
+		addr := server
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			addr = net.JoinHostPort(server, "53")
+		}
+		r = &net.Resolver{PreferGo: true, Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		}}
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	res := &DNSResult{Name: name, Type: recordType, Server: server}
+	start := time.Now()
+	var err error
+	switch recordType {
+	case "A", "AAAA":
+		var ips []net.IP
+		network := map[string]string{"A": "ip4", "AAAA": "ip6"}[recordType]
+		if ips, err = r.LookupIP(ctx, network, name); err == nil {
+			for _, ip := range ips {
+				res.Answers = append(res.Answers, ip.String())
+			}
+		}
+	case "CNAME":
+		var cname string
+		if cname, err = r.LookupCNAME(ctx, name); err == nil {
+			res.Answers = []string{cname}
+		}
+	case "MX":
+		var mxs []*net.MX
+		if mxs, err = r.LookupMX(ctx, name); err == nil {
+			for _, mx := range mxs {
+				res.Answers = append(res.Answers, fmt.Sprintf("%d %s", mx.Pref, mx.Host))
+			}
+		}
+	case "NS":
+		var nss []*net.NS
+		if nss, err = r.LookupNS(ctx, name); err == nil {
+			for _, ns := range nss {
+				res.Answers = append(res.Answers, ns.Host)
+			}
+		}
+	case "TXT":
+		res.Answers, err = r.LookupTXT(ctx, name)
+	case "PTR":
+		res.Answers, err = r.LookupAddr(ctx, name)
+	default:
+		return nil, fmt.Errorf("unsupported record type %q", recordType)
+	}
+	res.Duration = time.Since(start)
+	if err != nil {
+		var dns *net.DNSError
+		if errors.As(err, &dns) && dns.IsNotFound {
+			return nil, fmt.Errorf("%s has no %s records", name, recordType)
+		}
+		return nil, fmt.Errorf("looking up %s: %w", name, err)
+	}
+	return res, nil
+}
+
+// Traceroute returns the route to host, one hop per line.
+func (t *Toolkit) Traceroute(ctx context.Context, host string) (string, error) {
+	if err := checkHost(host); err != nil {
+		return "", err
+	}
+	if t.traceroute == nil {
+		return "", errors.New("neither traceroute nor tracepath is installed")
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, t.traceroute[0], append(t.traceroute[1:], host)...).CombinedOutput()
+	if err != nil && len(out) == 0 {
+		return "", fmt.Errorf("%s: %w", t.traceroute[0], err)
+	}
+	return string(out), nil
+}
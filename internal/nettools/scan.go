@@ -0,0 +1,237 @@
+package nettools
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxScanHosts caps the subnet size ScanLAN probes, which covers a /22.
+const maxScanHosts = 1024
+
+// Device is a host seen on the local network.
+type Device struct {
+	IP        string `json:"ip"`
+	MAC       string `json:"mac"`
+	Interface string `json:"interface"`
+	Hostname  string `json:"hostname,omitempty"`
+}
+
+// Gateway returns the default IPv4 gateway and its interface.
+func Gateway() (ip net.IP, iface string, err error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return nil, "", fmt.Errorf("reading routes: %w", err)
+	}
+	defer f.Close()
+	// Format: Iface Destination Gateway Flags ..., addresses in
+	// little-endian hex.
+	sc := bufio.NewScanner(f)
+	sc.Scan() // header
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		b, err := hex.DecodeString(fields[2])
+		if err != nil || len(b) != 4 {
+			continue
+		}
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(b))
+		return ip, fields[0], nil
+	}
+	if err := sc.Err(); err != nil {
+		return nil, "", err
+	}
+	return nil, "", fmt.Errorf("no default route")
+}
+
+// ScanLAN lists the devices on the directly attached IPv4 networks. It
+// sends a UDP datagram to every address so the kernel resolves their MAC
+// addresses, then reads the ARP table; this needs no privileges and finds
+// devices that ignore pings.
+func ScanLAN(ctx context.Context) ([]Device, error) {
+	var targets []net.IP
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, _ := iface.Addrs()
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok || ipnet.IP.To4() == nil {
+				continue
+			}
+			targets = append(targets, subnetHosts(ipnet)...)
+		}
+	}
+	probe(ctx, targets)
+
+	devices, err := readARP("/proc/net/arp")
+	if err != nil {
+		return nil, err
+	}
+	var wg sync.WaitGroup
+	for i := range devices {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+			defer cancel()
+			if names, err := net.DefaultResolver.LookupAddr(lctx, devices[i].IP); err == nil && len(names) > 0 {
+				devices[i].Hostname = strings.TrimSuffix(names[0], ".")
+			}
+		}()
+	}
+	wg.Wait()
+	return devices, nil
+}
+
+// subnetHosts returns the host addresses of n, or none if it is larger
+// than maxScanHosts.
+func subnetHosts(n *net.IPNet) []net.IP {
+	ones, bits := n.Mask.Size()
+	size := 1 << (bits - ones)
+	if size > maxScanHosts || size < 4 {
+		return nil
+	}
+	base := binary.BigEndian.Uint32(n.IP.To4().Mask(n.Mask))
+	self := binary.BigEndian.Uint32(n.IP.To4())
+	var hosts []net.IP
+	for i := 1; i < size-1; i++ {
+		if v := base + uint32(i); v != self {
+			ip := make(net.IP, 4)
+			binary.BigEndian.PutUint32(ip, v)
+			hosts = append(hosts, ip)
+		}
+	}
+	return hosts
+}
+
+// probe nudges the kernel into ARP-resolving each address and gives the
+// replies a moment to arrive.
+func probe(ctx context.Context, ips []net.IP) {
+	if len(ips) == 0 {
+		return
+	}
+	for _, ip := range ips {
+		conn, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: ip, Port: 9}) // discard
+		if err != nil {
+			continue
+		}
+		conn.Write([]byte{0})
+		conn.Close()
+	}
+	select {
+	case <-time.After(2 * time.Second):
+	case <-ctx.Done():
+	}
+}
+
+func readARP(path string) ([]Device, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading ARP table: %w", err)
+	}
+	defer f.Close()
+	var devices []Device
+	// Format: IP address  HW type  Flags  HW address  Mask  Device
+	sc := bufio.NewScanner(f)
+	sc.Scan() // header
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 6 || fields[2] == "0x0" {
+			continue // incomplete entry
+		}
+		devices = append(devices, Device{IP: fields[0], MAC: fields[3], Interface: fields[5]})
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		a, b := net.ParseIP(devices[i].IP).To4(), net.ParseIP(devices[j].IP).To4()
+		return a != nil && b != nil && binary.BigEndian.Uint32(a) < binary.BigEndian.Uint32(b)
+	})
+	return devices, sc.Err()
+}
+
+// Check is one step of Diagnose.
+type Check struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// Diagnose works outwards from the device: the router, a public address,
+// DNS, and finally target (a host name such as netflix.com) if given. The
+// first failing step shows where the problem is.
+func (t *Toolkit) Diagnose(ctx context.Context, target string) []Check {
+	var checks []Check
+	add := func(name string, ok bool, detail string) {
+		checks = append(checks, Check{Name: name, OK: ok, Detail: detail})
+	}
+
+	if gw, iface, err := Gateway(); err != nil {
+		add("router", false, err.Error())
+	} else if p, err := t.Ping(ctx, gw.String(), 3); err != nil {
+		add("router", false, err.Error())
+	} else if p.Received == 0 && p.Method == "tcp" {
+		// Routers often have nothing listening on 443; ARP replies are
+		// enough to know it is there.
+		devices, _ := readARP("/proc/net/arp")
+		found := false
+		for _, d := range devices {
+			found = found || d.IP == gw.String()
+		}
+		add("router", found, fmt.Sprintf("%s on %s (no ping installed; present in ARP table: %t)", gw, iface, found))
+	} else {
+		add("router", p.Received > 0, p.String())
+	}
+
+	if p, err := t.Ping(ctx, "1.1.1.1", 3); err != nil {
+		add("internet", false, err.Error())
+	} else {
+		add("internet", p.Received > 0, p.String())
+	}
+
+	if d, err := Lookup(ctx, "example.com", "A", ""); err != nil {
+		add("dns", false, err.Error())
+	} else {
+		add("dns", true, fmt.Sprintf("resolved example.com in %s", d.Duration.Round(time.Millisecond)))
+	}
+
+	if target != "" {
+		if err := checkHost(target); err != nil {
+			add(target, false, err.Error())
+		} else if d, err := Lookup(ctx, target, "A", ""); err != nil {
+			add(target, false, err.Error())
+		} else {
+			p := CheckPort(ctx, target, 443, 5*time.Second)
+			add(target, p.Open, fmt.Sprintf("resolved to %s; %s", strings.Join(d.Answers, ", "), p))
+		}
+	}
+	return checks
+}
+
+// Summary describes the result of Diagnose, one check per line.
+func Summary(checks []Check) string {
+	var b strings.Builder
+	for _, c := range checks {
+		mark := "OK"
+		if !c.OK {
+			mark = "FAIL"
+		}
+		fmt.Fprintf(&b, "%s %s: %s\n", mark, c.Name, c.Detail)
+	}
+	return b.String()
+}
@@ -0,0 +1,121 @@
+package nettools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"pi-agent/internal/tools"
+)
+
+// Tools returns the model-facing network diagnostics tools.
+func (t *Toolkit) Tools() []tools.Tool {
+	return []tools.Tool{
+		tools.New("net_diagnose",
+			"Check the home network step by step: the router, the internet, DNS and optionally a specific site. Use it first when the user says the internet or a service seems down.",
+			`{"type":"object","properties":{"target":{"type":"string","description":"optional host name of the service in question, e.g. netflix.com"}}}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var in struct {
+					Target string `json:"target"`
+				}
+				if err := tools.Decode(args, &in); err != nil {
+					return "", err
+				}
+				return Summary(t.Diagnose(ctx, in.Target)), nil
+			}),
+		tools.New("net_ping", "Ping a host and report packet loss and round-trip times.",
+			`{"type":"object","properties":{
+				"host":{"type":"string"},
+				"count":{"type":"integer","description":"number of pings (default 4)"}
+			},"required":["host"]}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var in struct {
+					Host  string `json:"host"`
+					Count int    `json:"count"`
+				}
+				if err := tools.Decode(args, &in); err != nil {
+					return "", err
+				}
+				if in.Count == 0 {
+					in.Count = 4
+				}
+				p, err := t.Ping(ctx, in.Host, in.Count)
+				if err != nil {
+					return "", err
+				}
+				return p.String(), nil
+			}),
+		tools.New("net_dns_lookup", "Look up DNS records for a name, optionally against a specific DNS server.",
+			`{"type":"object","properties":{
+				"name":{"type":"string","description":"host name, or an IP address for PTR"},
+				"type":{"type":"string","enum":["A","AAAA","CNAME","MX","NS","TXT","PTR"]},
+				"server":{"type":"string","description":"optional DNS server, e.g. 1.1.1.1"}
+			},"required":["name"]}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var in struct {
+					Name   string `json:"name"`
+					Type   string `json:"type"`
+					Server string `json:"server"`
+				}
+				if err := tools.Decode(args, &in); err != nil {
+					return "", err
+				}
+				d, err := Lookup(ctx, in.Name, in.Type, in.Server)
+				if err != nil {
+					return "", err
+				}
+				return d.String(), nil
+			}),
+		tools.New("net_traceroute", "Show the network route to a host, hop by hop.",
+			`{"type":"object","properties":{"host":{"type":"string"}},"required":["host"]}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var in struct {
+					Host string `json:"host"`
+				}
+				if err := tools.Decode(args, &in); err != nil {
+					return "", err
+				}
+				return t.Traceroute(ctx, in.Host)
+			}),
+		tools.New("net_port_check", "Check whether a TCP port on a host accepts connections.",
+			`{"type":"object","properties":{
+				"host":{"type":"string"},
+				"port":{"type":"integer"}
+			},"required":["host","port"]}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var in struct {
+					Host string `json:"host"`
+					Port int    `json:"port"`
+				}
+				if err := tools.Decode(args, &in); err != nil {
+					return "", err
+				}
+				if in.Port <= 0 || in.Port > 65535 {
+					return "", fmt.Errorf("invalid port %d", in.Port)
+				}
+				return CheckPort(ctx, in.Host, in.Port, 5*time.Second).String(), nil
+			}),
+		tools.New("net_scan_lan", "List the devices currently on the local network with their IP, MAC address and host name.",
+			tools.NoParams,
+			func(ctx context.Context, _ json.RawMessage) (string, error) {
+				devices, err := ScanLAN(ctx)
+				if err != nil {
+					return "", err
+				}
+				if len(devices) == 0 {
+					return "No devices found.", nil
+				}
+				var b strings.Builder
+				for _, d := range devices {
+					name := d.Hostname
+					if name == "" {
+						name = "(no name)"
+					}
+					fmt.Fprintf(&b, "%s %s %s on %s\n", d.IP, d.MAC, name, d.Interface)
+				}
+				return b.String(), nil
+			}),
+	}
+}
@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Priority orders notifications by urgency, matching ntfy's 1-5 scale.
+type Priority int
+
+const (
+	PriorityLow     Priority = 2
+	PriorityDefault Priority = 3
+	PriorityHigh    Priority = 4
+	PriorityUrgent  Priority = 5
+)
+
+// Message is a notification to deliver to the user.
+type Message struct {
+	Title    string   `json:"title"`
+	Body     string   `json:"body"`
+	Priority Priority `json:"priority"`
+	Tags     []string `json:"tags,omitempty"`
+	// User is who the message is for, if anyone in particular; their own
+	// quiet hours apply to it.
+	User string `json:"user,omitempty"`
+}
+
+// Notifier delivers notifications.
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// Multi delivers to every notifier, returning the combined errors.
+type Multi []Notifier
+
+func (m Multi) Notify(ctx context.Context, msg Message) error {
+	var errs []error
+	for _, n := range m {
+		if err := n.Notify(ctx, msg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Ntfy publishes to an ntfy topic URL such as https://ntfy.sh/my-topic.
+type Ntfy struct {
+	URL   string
+	Token string // optional access token
+}
+
+func (n *Ntfy) Notify(ctx context.Context, msg Message) error {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", n.URL, strings.NewReader(msg.Body))
+	if err != nil {
+		return fmt.Errorf("creating ntfy request: %w", err)
+	}
+	if msg.Title != "" {
+		req.Header.Set("Title", msg.Title)
+	}
+	if msg.Priority != 0 {
+		req.Header.Set("Priority", strconv.Itoa(int(msg.Priority)))
+	}
+	if len(msg.Tags) > 0 {
+		req.Header.Set("Tags", strings.Join(msg.Tags, ","))
+	}
+	if n.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.Token)
+	}
+	return send(req, "ntfy")
+}
+
+func send(req *http.Request, name string) error {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request: %w", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s error %d: %s", name, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -16,6 +16,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"pi-agent/internal/upstream"
 )
 
 const (
@@ -122,7 +124,7 @@ func exchangeCodeForTokens(code, codeVerifier string) (*TokenResponse, error) {
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := upstream.Client().Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("token exchange request: %w", err)
 	}
@@ -164,7 +166,7 @@ func RefreshToken(refreshToken string) (*TokenResponse, error) {
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := upstream.Client().Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("token refresh request: %w", err)
 	}
@@ -254,7 +256,7 @@ func AuthenticateDevice(ctx context.Context) (*Credentials, error) {
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := upstream.Client().Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("device auth request: %w", err)
 	}
@@ -371,7 +373,7 @@ func pollDeviceToken(ctx context.Context, deviceAuthID string) (*Credentials, bo
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := upstream.Client().Do(req)
 	if err != nil {
 		return nil, false, fmt.Errorf("device token request: %w", err)
 	}
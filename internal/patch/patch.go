@@ -0,0 +1,390 @@
+// Package patch applies unified diffs to files on the Pi once approved,
+// keeping the pre-image of every file touched so changes can be rolled
+// back.
+package patch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"pi-agent/internal/approval"
+	"pi-agent/internal/gitcmd"
+	"pi-agent/internal/store"
+	"pi-agent/internal/tools"
+)
+
+// Kind is the approval kind of patches.
+const Kind = "apply_patch"
+
+// ErrModified is returned when rolling back a patch whose files have
+// changed since it was applied.
+var ErrModified = errors.New("files changed since the patch was applied")
+
+// Manager validates, applies and rolls back patches.
+type Manager struct {
+	db    *store.DB
+	queue *approval.Queue
+	roots []string
+}
+
+// New creates a manager whose patches are approved through queue. The
+// apply_patch tool may only change files under roots; the first root is
+// also where relative directories are resolved.
+func New(db *store.DB, queue *approval.Queue, roots []string) *Manager {
+	m := &Manager{db: db, queue: queue, roots: roots}
+	queue.Handle(Kind, m.applyApproved)
+	return m
+}
+
+// Change is a file a patch touches.
+type Change struct {
+	Path    string `json:"path"`
+	From    string `json:"from,omitempty"` // the old name of a renamed file
+	Added   int    `json:"added"`
+	Deleted int    `json:"deleted"`
+	Binary  bool   `json:"binary,omitempty"`
+}
+
+// Plan is the outcome of a dry run.
+type Plan struct {
+	Dir      string   `json:"dir"`
+	Changes  []Change `json:"changes"`
+	ThreeWay bool     `json:"three_way,omitempty"` // applies only with a 3-way merge
+}
+
+// String summarizes the plan, one line per file.
+func (p *Plan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "In %s:", p.Dir)
+	for _, c := range p.Changes {
+		name := c.Path
+		if c.From != "" {
+			name = c.From + " => " + c.Path
+		}
+		if c.Binary {
+			fmt.Fprintf(&b, "\n  %s (binary)", name)
+		} else {
+			fmt.Fprintf(&b, "\n  %s +%d -%d", name, c.Added, c.Deleted)
+		}
+	}
+	if p.ThreeWay {
+		b.WriteString("\n(needs a 3-way merge)")
+	}
+	return b.String()
+}
+
+// DryRun checks that diff applies in dir and describes what it would
+// change, without changing anything.
+func (m *Manager) DryRun(ctx context.Context, dir, diff string) (*Plan, error) {
+	if !strings.HasSuffix(diff, "\n") {
+		diff += "\n"
+	}
+	plan := &Plan{Dir: dir}
+	if _, err := gitcmd.Run(ctx, dir, []byte(diff), "apply", "--check", "-"); err != nil {
+		if !isRepoRoot(ctx, dir) {
+			return nil, fmt.Errorf("the patch does not apply: %w", err)
+		}
+		if _, err := gitcmd.Run(ctx, dir, []byte(diff), "apply", "--3way", "--check", "-"); err != nil {
+			return nil, fmt.Errorf("the patch does not apply, even with a 3-way merge: %w", err)
+		}
+		plan.ThreeWay = true
+	}
+	out, err := gitcmd.Run(ctx, dir, []byte(diff), "apply", "--numstat", "-z", "-")
+	if err != nil {
+		return nil, err
+	}
+	if plan.Changes, err = parseNumstat(out); err != nil {
+		return nil, err
+	}
+	for _, c := range plan.Changes {
+		for _, p := range []string{c.Path, c.From} {
+			if p != "" && !filepath.IsLocal(p) {
+				return nil, fmt.Errorf("the patch touches %s, outside %s", p, dir)
+			}
+		}
+	}
+	return plan, nil
+}
+
+// parseNumstat parses "git apply --numstat -z" output. Renames take the
+// form "added\tdeleted\t\0old\0new\0".
+func parseNumstat(out string) ([]Change, error) {
+	var changes []Change
+	fields := strings.Split(out, "\x00")
+	for i := 0; i < len(fields); i++ {
+		if fields[i] == "" {
+			continue
+		}
+		parts := strings.SplitN(fields[i], "\t", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("unexpected numstat output %q", fields[i])
+		}
+		c := Change{Path: parts[2], Binary: parts[0] == "-"}
+		fmt.Sscan(parts[0], &c.Added)
+		fmt.Sscan(parts[1], &c.Deleted)
+		if c.Path == "" {
+			if i+2 >= len(fields) {
+				return nil, fmt.Errorf("truncated numstat output")
+			}
+			c.From, c.Path = fields[i+1], fields[i+2]
+			i += 2
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+func isRepoRoot(ctx context.Context, dir string) bool {
+	top, err := gitcmd.TopLevel(ctx, dir)
+	if err != nil {
+		return false
+	}
+	a, _ := filepath.EvalSymlinks(top)
+	b, _ := filepath.EvalSymlinks(dir)
+	return a == b
+}
+
+// payload is the payload of an apply_patch approval.
+type payload struct {
+	Dir     string `json:"dir"`
+	Diff    string `json:"diff"`
+	Summary string `json:"summary"`
+}
+
+// Propose dry-runs diff in dir and queues it for approval. The approval's
+// summary includes the dry run.
+func (m *Manager) Propose(ctx context.Context, conversationID, dir, diff, summary string) (*store.Approval, *Plan, error) {
+	plan, err := m.DryRun(ctx, dir, diff)
+	if err != nil {
+		return nil, nil, err
+	}
+	if summary == "" {
+		summary = "Apply a patch"
+	}
+	a, err := m.queue.Request(ctx, conversationID, Kind, summary+"\n\n"+plan.String(), payload{Dir: dir, Diff: diff, Summary: summary})
+	if err != nil {
+		return nil, nil, err
+	}
+	return a, plan, nil
+}
+
+func (m *Manager) applyApproved(ctx context.Context, a *store.Approval) (string, error) {
+	var p payload
+	if err := json.Unmarshal(a.Payload, &p); err != nil {
+		return "", err
+	}
+	applied, err := m.Apply(ctx, a.ID, p.Dir, p.Diff, p.Summary)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Applied as patch %d; it can be rolled back with POST /patches/%d/rollback.", applied.ID, applied.ID), nil
+}
+
+// Apply applies diff in dir, recording the pre-image of each file it
+// touches. If applying fails part way the files are restored.
+func (m *Manager) Apply(ctx context.Context, approvalID int64, dir, diff, summary string) (*store.Patch, error) {
+	plan, err := m.DryRun(ctx, dir, diff)
+	if err != nil {
+		return nil, err
+	}
+	p := &store.Patch{ApprovalID: approvalID, Dir: dir, Diff: diff, Summary: summary}
+	for _, c := range plan.Changes {
+		for _, path := range []string{c.From, c.Path} {
+			if path == "" {
+				continue
+			}
+			f, err := snapshot(dir, path)
+			if err != nil {
+				return nil, err
+			}
+			p.Files = append(p.Files, f)
+		}
+	}
+
+	args := []string{"apply", "-"}
+	if plan.ThreeWay {
+		args = []string{"apply", "--3way", "-"}
+	}
+	if !strings.HasSuffix(diff, "\n") {
+		diff += "\n"
+	}
+	if _, err := gitcmd.Run(ctx, dir, []byte(diff), args...); err != nil {
+		if rerr := restore(dir, p.Files); rerr != nil {
+			return nil, fmt.Errorf("%w; restoring the files also failed: %v", err, rerr)
+		}
+		return nil, err
+	}
+	for i := range p.Files {
+		p.Files[i].AfterHash, _ = hashFile(filepath.Join(dir, p.Files[i].Path))
+	}
+	if err := m.db.AddPatch(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Rollback restores the files a patch touched to their pre-images. Unless
+// force is set it refuses with ErrModified if any of them has changed
+// since the patch was applied.
+func (m *Manager) Rollback(id int64, force bool) (*store.Patch, error) {
+	p, err := m.db.Patch(id)
+	if err != nil {
+		return nil, err
+	}
+	if p.RolledBackAt != nil {
+		return nil, fmt.Errorf("patch %d was already rolled back", id)
+	}
+	if !force {
+		var changed []string
+		for _, f := range p.Files {
+			if h, _ := hashFile(filepath.Join(p.Dir, f.Path)); h != f.AfterHash {
+				changed = append(changed, f.Path)
+			}
+		}
+		if len(changed) > 0 {
+			return nil, fmt.Errorf("%w: %s", ErrModified, strings.Join(changed, ", "))
+		}
+	}
+	if err := restore(p.Dir, p.Files); err != nil {
+		return nil, err
+	}
+	if err := m.db.MarkPatchRolledBack(id); err != nil {
+		return nil, err
+	}
+	return m.db.Patch(id)
+}
+
+// snapshot records the current state of a file.
+func snapshot(dir, path string) (store.PatchFile, error) {
+	f := store.PatchFile{Path: path}
+	full := filepath.Join(dir, path)
+	info, err := os.Lstat(full)
+	if errors.Is(err, fs.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return f, err
+	}
+	if !info.Mode().IsRegular() {
+		return f, fmt.Errorf("%s is not a regular file", path)
+	}
+	if f.Content, err = os.ReadFile(full); err != nil {
+		return f, err
+	}
+	f.Existed, f.Mode = true, uint32(info.Mode().Perm())
+	return f, nil
+}
+
+// restore puts files back to their recorded state.
+func restore(dir string, files []store.PatchFile) error {
+	var errs []error
+	for _, f := range files {
+		full := filepath.Join(dir, f.Path)
+		if !f.Existed {
+			if err := os.Remove(full); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := os.WriteFile(full, f.Content, fs.FileMode(f.Mode)); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := os.Chmod(full, fs.FileMode(f.Mode)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// hashFile returns the SHA-256 of a file, or empty if it does not exist.
+func hashFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ResolveDir checks that dir is one of the manager's roots or inside one.
+// A relative dir is taken relative to the first root.
+func (m *Manager) ResolveDir(dir string) (string, error) {
+	if len(m.roots) == 0 {
+		return "", errors.New("no directories are open to patches")
+	}
+	if dir == "" {
+		dir = "."
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(m.roots[0], dir)
+	}
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, root := range m.roots {
+		r, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(r, real); err == nil && filepath.IsLocal(rel) {
+			return real, nil
+		}
+	}
+	return "", fmt.Errorf("%s is outside the directories open to patches (%s)", dir, strings.Join(m.roots, ", "))
+}
+
+// Tools returns the apply_patch tool.
+func (m *Manager) Tools() []tools.Tool {
+	return []tools.Tool{tools.New(Kind,
+		"Change files on the Raspberry Pi by applying a unified diff. The diff is checked first; with dry_run the check is all that happens, otherwise the change waits for the user's approval and can be rolled back later. Paths in the diff are relative to dir.",
+		`{"type":"object","properties":{
+			"dir":{"type":"string","description":"directory the diff's paths are relative to; relative to the workspace unless absolute"},
+			"diff":{"type":"string"},
+			"summary":{"type":"string","description":"one line describing the change"},
+			"dry_run":{"type":"boolean"}
+		},"required":["diff","summary"]}`,
+		func(ctx context.Context, args json.RawMessage) (string, error) {
+			var in struct {
+				Dir     string `json:"dir"`
+				Diff    string `json:"diff"`
+				Summary string `json:"summary"`
+				DryRun  bool   `json:"dry_run"`
+			}
+			if err := tools.Decode(args, &in); err != nil {
+				return "", err
+			}
+			dir, err := m.ResolveDir(in.Dir)
+			if err != nil {
+				return "", err
+			}
+			if in.DryRun {
+				plan, err := m.DryRun(ctx, dir, in.Diff)
+				if err != nil {
+					return "", err
+				}
+				return "The patch applies cleanly. " + plan.String(), nil
+			}
+			a, plan, err := m.Propose(ctx, tools.ConversationID(ctx), dir, in.Diff, in.Summary)
+			if err != nil {
+				return "", err
+			}
+			return plan.String() + "\n\n" + approval.Outcome(a), nil
+		})}
+}
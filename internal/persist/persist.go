@@ -0,0 +1,208 @@
+// Package persist lets the agent run on a read-only root filesystem, as
+// kiosk Pis with overlayfs do. It checks that the data directory keeps
+// what is written to it, and can run the database from a working copy on
+// a tmpfs, writing it back to the data partition every few minutes and at
+// shutdown, so the SD card sees one write per interval instead of one per
+// message.
+package persist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"pi-agent/internal/store"
+)
+
+// DefaultInterval is how often a buffered database is written back.
+const DefaultInterval = 5 * time.Minute
+
+var (
+	// ErrReadOnly means a directory is on a read-only filesystem.
+	ErrReadOnly = errors.New("on a read-only filesystem")
+	// ErrVolatile means a directory is on a filesystem kept in RAM, whose
+	// contents are lost at reboot.
+	ErrVolatile = errors.New("in RAM; its contents are lost at reboot")
+)
+
+// Filesystem magic numbers from linux/magic.h.
+const (
+	tmpfsMagic   = 0x01021994
+	ramfsMagic   = 0x858458f6
+	overlayMagic = 0x794c7630
+)
+
+// Check reports whether dir, which is created if missing, keeps what is
+// written to it: it returns an error wrapping ErrReadOnly if nothing can
+// be written there and one wrapping ErrVolatile if writes are lost at
+// reboot. An overlayfs counts as volatile, since on a kiosk its upper
+// layer is usually a tmpfs.
+func Check(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return wrap(dir, err)
+	}
+	f, err := os.CreateTemp(dir, ".write-test-")
+	if err != nil {
+		return wrap(dir, err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return nil // cannot tell; it is writable
+	}
+	switch uint32(st.Type) {
+	case tmpfsMagic, ramfsMagic, overlayMagic:
+		return fmt.Errorf("%s is %w", dir, ErrVolatile)
+	}
+	return nil
+}
+
+func wrap(dir string, err error) error {
+	if errors.Is(err, syscall.EROFS) {
+		return fmt.Errorf("%s is %w", dir, ErrReadOnly)
+	}
+	return err
+}
+
+// Status is the state of a buffered database.
+type Status struct {
+	FlushedAt time.Time `json:"flushed_at,omitzero"` // last write-back
+	Flushes   int       `json:"flushes"`
+	Err       error     `json:"-"` // of the last write-back, if it failed
+}
+
+// Buffer runs a database from a working copy and writes it back.
+type Buffer struct {
+	db       *store.DB
+	path     string // the copy on the data partition
+	work     string
+	interval time.Duration
+
+	mu      sync.Mutex
+	version int64 // of the last write-back
+	status  Status
+}
+
+// Open opens the database at path through a working copy in dir, which
+// should be a tmpfs. The copy is made from path, unless one left in dir
+// by an earlier run since boot is newer.
+func Open(path, dir string, interval time.Duration) (*store.DB, *Buffer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, nil, fmt.Errorf("creating %s: %w", dir, err)
+	}
+	work := filepath.Join(dir, filepath.Base(path))
+	if err := prepare(path, work); err != nil {
+		return nil, nil, err
+	}
+	db, err := store.Open(work)
+	if err != nil {
+		return nil, nil, err
+	}
+	b := &Buffer{db: db, path: path, work: work, interval: interval}
+	if b.version, err = db.Version(); err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	return db, b, nil
+}
+
+// prepare makes the working copy at work from the database at path.
+func prepare(path, work string) error {
+	saved, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil // a new database; the first write-back creates path
+	}
+	if err != nil {
+		return err
+	}
+	if cur, err := os.Stat(work); err == nil && cur.ModTime().After(saved.ModTime()) {
+		log.Printf("persist: using %s, which is newer than %s", work, path)
+		return nil
+	}
+	for _, f := range []string{work, work + "-wal", work + "-shm"} {
+		os.Remove(f)
+	}
+	src, err := store.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if err := src.Snapshot(work); err != nil {
+		return fmt.Errorf("copying %s to %s: %w", path, work, err)
+	}
+	return nil
+}
+
+// Run writes the database back every interval while it has changed, and
+// once more when ctx is cancelled.
+func (b *Buffer) Run(ctx context.Context) {
+	log.Printf("persist: running the database from %s, writing it back to %s every %s", b.work, b.path, b.interval)
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := b.Flush(); err == nil {
+				log.Printf("persist: wrote the database back to %s", b.path)
+			}
+			return
+		case <-ticker.C:
+			b.Flush()
+		}
+	}
+}
+
+// Flush writes the database back if it changed since the last time.
+func (b *Buffer) Flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	v, err := b.db.Version()
+	if err == nil && v == b.version && b.status.Err == nil && fileExists(b.path) {
+		return nil
+	}
+	if err == nil {
+		err = b.db.Snapshot(b.path)
+	}
+	if err != nil {
+		if b.status.Err == nil {
+			log.Printf("persist: %v", b.explain(err))
+		}
+		b.status.Err = b.explain(err)
+		return b.status.Err
+	}
+	if b.status.Err != nil {
+		log.Printf("persist: writing %s works again", b.path)
+	}
+	b.version = v
+	b.status.FlushedAt, b.status.Err = time.Now(), nil
+	b.status.Flushes++
+	return nil
+}
+
+// explain turns a failed write-back into an error saying what is at
+// stake.
+func (b *Buffer) explain(err error) error {
+	if cerr := Check(filepath.Dir(b.path)); errors.Is(cerr, ErrReadOnly) {
+		err = cerr
+	}
+	return fmt.Errorf("cannot write the database back: %v; changes are kept only in %s and are lost at reboot", err, b.work)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Status returns the state of the write-back.
+func (b *Buffer) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.status
+}
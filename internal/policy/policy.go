@@ -0,0 +1,258 @@
+// Package policy enforces per-persona restrictions, the parental controls
+// of households where children talk to the assistant: topics a persona
+// refuses to discuss, the hours it may be used, and daily usage caps. An
+// adult with the admin PIN can lift the hours and caps for a while.
+package policy
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"pi-agent/internal/config"
+	"pi-agent/internal/store"
+)
+
+// ErrRestricted marks requests a persona's restrictions refuse.
+var ErrRestricted = errors.New("restricted")
+
+// ErrPIN is returned for an override with a wrong or no PIN, or when no
+// PIN is configured.
+var ErrPIN = errors.New("wrong admin PIN")
+
+// MaxOverride bounds how long an override lasts.
+const MaxOverride = 24 * time.Hour
+
+type window struct {
+	days       [7]bool // by time.Weekday the window starts on
+	start, end int     // minutes after midnight
+}
+
+type restriction struct {
+	topics        []string // normalized, see words
+	windows       []window
+	dailyMessages int
+	dailyTokens   int
+}
+
+// Policy holds the restrictions of the configured personas.
+type Policy struct {
+	db           *store.DB
+	pin          string
+	restrictions map[string]restriction
+	names        []string // restricted personas in configuration order
+
+	mu        sync.Mutex
+	overrides map[string]time.Time
+}
+
+// New returns the restrictions of personas, with usage counted in db. An
+// empty pin disables overrides.
+func New(personas []config.Persona, pin string, db *store.DB) (*Policy, error) {
+	p := &Policy{db: db, pin: pin, restrictions: make(map[string]restriction), overrides: make(map[string]time.Time)}
+	for _, ps := range personas {
+		r := ps.Restrictions
+		if r == nil {
+			continue
+		}
+		res := restriction{dailyMessages: r.DailyMessages, dailyTokens: r.DailyTokens}
+		for _, t := range r.BlockedTopics {
+			res.topics = append(res.topics, words(t))
+		}
+		for _, cw := range r.Windows {
+			var w window
+			var err error
+			if w.start, err = config.ClockMinutes(cw.Start); err != nil {
+				return nil, fmt.Errorf("persona %q: %w", ps.Name, err)
+			}
+			if w.end, err = config.ClockMinutes(cw.End); err != nil {
+				return nil, fmt.Errorf("persona %q: %w", ps.Name, err)
+			}
+			for _, d := range cw.Days {
+				day, ok := config.Weekday(d)
+				if !ok {
+					return nil, fmt.Errorf("persona %q: unknown day %q", ps.Name, d)
+				}
+				w.days[day] = true
+			}
+			if len(cw.Days) == 0 {
+				w.days = [7]bool{true, true, true, true, true, true, true}
+			}
+			res.windows = append(res.windows, w)
+		}
+		p.restrictions[ps.Name] = res
+		p.names = append(p.names, ps.Name)
+	}
+	return p, nil
+}
+
+// Restricted reports whether a persona has restrictions.
+func (p *Policy) Restricted(persona string) bool {
+	_, ok := p.restrictions[persona]
+	return ok
+}
+
+// Check returns an error wrapping ErrRestricted if a message may not be
+// sent to a persona now. Personas without restrictions are always allowed.
+func (p *Policy) Check(persona, message string) error {
+	r, ok := p.restrictions[persona]
+	if !ok {
+		return nil
+	}
+	if topic := r.blocked(message); topic != "" {
+		return fmt.Errorf("%w: %q is not something the %s persona talks about", ErrRestricted, topic, persona)
+	}
+	if _, ok := p.override(persona); !ok {
+		now := time.Now()
+		if !r.open(now) {
+			return fmt.Errorf("%w: the %s persona is not available at this time", ErrRestricted, persona)
+		}
+		if r.dailyMessages > 0 || r.dailyTokens > 0 {
+			u, err := p.db.PersonaUsage(persona, now.Format(time.DateOnly))
+			if err != nil {
+				return err
+			}
+			if r.dailyMessages > 0 && u.Messages >= r.dailyMessages {
+				return fmt.Errorf("%w: the %s persona has reached its limit of %d messages today", ErrRestricted, persona, r.dailyMessages)
+			}
+			if r.dailyTokens > 0 && u.Tokens >= r.dailyTokens {
+				return fmt.Errorf("%w: the %s persona has reached its limit of %d tokens today", ErrRestricted, persona, r.dailyTokens)
+			}
+		}
+	}
+	return nil
+}
+
+// Record counts a completed turn, and the tokens it used, towards a
+// persona's daily caps. Usage of personas without restrictions is not
+// kept.
+func (p *Policy) Record(persona string, tokens int) {
+	if !p.Restricted(persona) {
+		return
+	}
+	if err := p.db.AddPersonaUsage(persona, time.Now().Format(time.DateOnly), 1, tokens); err != nil {
+		log.Printf("policy: %v", err)
+	}
+}
+
+// Override lifts a persona's hours and daily caps for d, if pin is the
+// admin PIN. Blocked topics still apply. It returns when the override
+// ends.
+func (p *Policy) Override(persona, pin string, d time.Duration) (time.Time, error) {
+	if !p.Admin(pin) {
+		return time.Time{}, ErrPIN
+	}
+	if !p.Restricted(persona) {
+		return time.Time{}, fmt.Errorf("persona %q has no restrictions", persona)
+	}
+	if d <= 0 || d > MaxOverride {
+		return time.Time{}, fmt.Errorf("override must last between 1 minute and %s", MaxOverride)
+	}
+	until := time.Now().Add(d)
+	p.mu.Lock()
+	p.overrides[persona] = until
+	p.mu.Unlock()
+	log.Printf("policy: restrictions on %s lifted until %s", persona, until.Format(time.DateTime))
+	return until, nil
+}
+
+// Admin reports whether pin is the admin PIN. It is false for every pin
+// when none is configured.
+func (p *Policy) Admin(pin string) bool {
+	return p.pin != "" && subtle.ConstantTimeCompare([]byte(pin), []byte(p.pin)) == 1
+}
+
+// EndOverride puts a persona's restrictions back in force.
+func (p *Policy) EndOverride(persona string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.overrides, persona)
+}
+
+// override returns when a persona's override ends, if one is in force.
+func (p *Policy) override(persona string) (time.Time, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	until, ok := p.overrides[persona]
+	if ok && !time.Now().Before(until) {
+		delete(p.overrides, persona)
+		return time.Time{}, false
+	}
+	return until, ok
+}
+
+// Status is a restricted persona's current standing.
+type Status struct {
+	Persona       string             `json:"persona"`
+	Available     bool               `json:"available"` // within its hours, or overridden
+	BlockedTopics int                `json:"blocked_topics"`
+	DailyMessages int                `json:"daily_messages,omitempty"`
+	DailyTokens   int                `json:"daily_tokens,omitempty"`
+	Usage         store.PersonaUsage `json:"usage"`
+	OverrideUntil *time.Time         `json:"override_until,omitempty"`
+}
+
+// Status returns the status of each restricted persona.
+func (p *Policy) Status() ([]Status, error) {
+	now := time.Now()
+	var out []Status
+	for _, name := range p.names {
+		r := p.restrictions[name]
+		u, err := p.db.PersonaUsage(name, now.Format(time.DateOnly))
+		if err != nil {
+			return nil, err
+		}
+		st := Status{
+			Persona: name, Available: r.open(now), BlockedTopics: len(r.topics),
+			DailyMessages: r.dailyMessages, DailyTokens: r.dailyTokens, Usage: u,
+		}
+		if until, ok := p.override(name); ok {
+			st.Available, st.OverrideUntil = true, &until
+		}
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+// open reports whether t falls in one of the windows, or there are none.
+func (r restriction) open(t time.Time) bool {
+	if len(r.windows) == 0 {
+		return true
+	}
+	minute := t.Hour()*60 + t.Minute()
+	today := t.Weekday()
+	yesterday := (today + 6) % 7
+	for _, w := range r.windows {
+		switch {
+		case w.start < w.end && w.days[today] && minute >= w.start && minute < w.end,
+			w.start > w.end && w.days[today] && minute >= w.start,
+			w.start > w.end && w.days[yesterday] && minute < w.end:
+			return true
+		}
+	}
+	return false
+}
+
+// blocked returns the first blocked topic a message mentions, or "".
+func (r restriction) blocked(message string) string {
+	text := " " + words(message) + " "
+	for _, t := range r.topics {
+		if strings.Contains(text, " "+t+" ") {
+			return t
+		}
+	}
+	return ""
+}
+
+// words lowercases s and reduces it to its words separated by single
+// spaces, so that topics match whole words regardless of punctuation.
+func words(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
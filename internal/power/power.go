@@ -0,0 +1,311 @@
+// Package power keeps the agent aware of its UPS. While the Pi runs on
+// battery it saves power: scheduled jobs are skipped, indexing waits and
+// meters and presence are polled less often. It notifies when the power
+// goes out and when the battery runs low, and sums up the outage when
+// the power comes back. Outages are stored, and tools and the system
+// prompt report the battery state.
+package power
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"pi-agent/internal/config"
+	"pi-agent/internal/notify"
+	"pi-agent/internal/store"
+	"pi-agent/internal/tools"
+)
+
+// Monitor polls a UPS.
+type Monitor struct {
+	src      Source
+	db       *store.DB
+	notifier notify.Notifier
+	conf     config.Power
+
+	mu      sync.Mutex
+	reading Reading
+	err     error
+	outage  *store.Outage // while on battery
+	warned  bool          // the low battery warning went out for this outage
+	battery chan struct{} // closed while on mains
+}
+
+// New creates a monitor for the configured UPS. An outage still open
+// from before a restart is resumed on the first reading.
+func New(conf config.Power, db *store.DB, notifier notify.Notifier) (*Monitor, error) {
+	src, err := NewSource(&conf)
+	if err != nil {
+		return nil, err
+	}
+	m := &Monitor{src: src, db: db, notifier: notifier, conf: conf, battery: make(chan struct{})}
+	close(m.battery)
+	m.reading.Charge = -1
+	if o, err := db.OpenOutage(); err == nil {
+		m.outage = o
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Run polls the UPS until ctx is cancelled.
+func (m *Monitor) Run(ctx context.Context) {
+	log.Printf("power: watching %s", m.src.Name())
+	ticker := time.NewTicker(time.Duration(m.conf.PollSeconds) * time.Second)
+	defer ticker.Stop()
+	failures := 0
+	for {
+		rctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+		rd, err := m.src.Read(rctx)
+		cancel()
+		if err != nil {
+			// Keep the last state: an unreachable UPS says nothing about
+			// the mains.
+			if failures++; failures == 1 {
+				log.Printf("power: %v", err)
+			}
+			m.mu.Lock()
+			m.err = err
+			m.mu.Unlock()
+		} else {
+			failures = 0
+			m.update(ctx, rd)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// update records a reading and handles the power going and coming back.
+func (m *Monitor) update(ctx context.Context, rd Reading) {
+	m.mu.Lock()
+	was := m.reading.OnBattery
+	m.reading, m.err = rd, nil
+	var msgs []notify.Message
+	switch {
+	case rd.OnBattery && m.outage == nil:
+		m.outage = &store.Outage{StartedAt: rd.ReadAt, StartCharge: rd.Charge}
+		if err := m.db.StartOutage(m.outage); err != nil {
+			log.Printf("power: %v", err)
+		}
+		m.warned = false
+		msgs = append(msgs, notify.Message{Title: "Power outage",
+			Body: "The Pi is running on battery" + chargeText(rd) + ". Scheduled jobs are paused until the power is back.", Priority: notify.PriorityHigh, Tags: []string{"electric_plug"}})
+	case rd.OnBattery:
+		if rd.Charge >= 0 && (m.outage.MinCharge < 0 || rd.Charge < m.outage.MinCharge) {
+			m.outage.MinCharge = rd.Charge
+		}
+		m.outage.EndCharge = rd.Charge
+		if err := m.db.UpdateOutage(m.outage); err != nil {
+			log.Printf("power: %v", err)
+		}
+	case m.outage != nil:
+		m.outage.EndedAt, m.outage.EndCharge = rd.ReadAt, rd.Charge
+		if err := m.db.UpdateOutage(m.outage); err != nil {
+			log.Printf("power: %v", err)
+		}
+		msgs = append(msgs, notify.Message{Title: "Power restored", Body: Summary(m.outage), Priority: notify.PriorityDefault, Tags: []string{"electric_plug"}})
+		m.outage = nil
+	}
+	if rd.OnBattery && !m.warned && (rd.Low || rd.Charge >= 0 && rd.Charge <= m.conf.LowBattery) {
+		m.warned = true
+		msgs = append(msgs, notify.Message{Title: "Battery low",
+			Body: "The Pi's battery is low" + chargeText(rd) + ". It will shut down when the battery runs out.", Priority: notify.PriorityUrgent, Tags: []string{"battery"}})
+	}
+	if now := m.reading.OnBattery; now != was {
+		if now {
+			m.battery = make(chan struct{})
+			log.Printf("power: on battery%s; entering low-power mode", chargeText(rd))
+		} else {
+			close(m.battery)
+			log.Printf("power: mains power is back")
+		}
+	}
+	m.mu.Unlock()
+
+	for _, msg := range msgs {
+		if m.notifier == nil {
+			break
+		}
+		if err := m.notifier.Notify(ctx, msg); err != nil {
+			log.Printf("power: notification failed: %v", err)
+		}
+	}
+}
+
+// OnBattery reports whether the Pi is running on battery.
+func (m *Monitor) OnBattery() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.reading.OnBattery
+}
+
+// Reading returns the last reading and the error of the last poll, if it
+// failed.
+func (m *Monitor) Reading() (Reading, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.reading, m.err
+}
+
+// Wait blocks while the Pi is on battery, returning early with the
+// context's error.
+func (m *Monitor) Wait(ctx context.Context) error {
+	m.mu.Lock()
+	mains := m.battery
+	m.mu.Unlock()
+	select {
+	case <-mains:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Suspend wraps a scheduled job so that runs while on battery are
+// skipped; they are counted in the outage.
+func (m *Monitor) Suspend(name string, job func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		m.mu.Lock()
+		skip := m.reading.OnBattery
+		if skip && m.outage != nil {
+			m.outage.Skipped++
+		}
+		m.mu.Unlock()
+		if skip {
+			log.Printf("power: on battery, skipping %s", name)
+			return nil
+		}
+		return job(ctx)
+	}
+}
+
+// Pace returns a function for a polling loop to call on each tick. It
+// reports whether to poll, which on battery is one tick in
+// LowPowerFactor.
+func (m *Monitor) Pace() func() bool {
+	var ticks int
+	return func() bool {
+		if !m.OnBattery() {
+			ticks = 0
+			return true
+		}
+		ticks++
+		return (ticks-1)%m.conf.LowPowerFactor == 0
+	}
+}
+
+// Context is a system prompt line describing the power state while on
+// battery, so the model can mention it; on mains it is empty.
+func (m *Monitor) Context(context.Context) string {
+	rd, _ := m.Reading()
+	if !rd.OnBattery {
+		return ""
+	}
+	return "Power: the Pi is running on battery after a power outage" + chargeText(rd) + "."
+}
+
+// Summary describes an outage.
+func Summary(o *store.Outage) string {
+	var b strings.Builder
+	end := o.EndedAt
+	if end.IsZero() {
+		fmt.Fprintf(&b, "Running on battery since %s (%s)", o.StartedAt.Local().Format("15:04"), minutes(time.Since(o.StartedAt)))
+	} else {
+		fmt.Fprintf(&b, "Power was out for %s, from %s to %s", minutes(end.Sub(o.StartedAt)),
+			o.StartedAt.Local().Format("Jan 2 15:04"), end.Local().Format("15:04"))
+	}
+	if o.StartCharge >= 0 && o.MinCharge >= 0 && o.MinCharge < o.StartCharge {
+		fmt.Fprintf(&b, "; the battery went from %.0f%% down to %.0f%%", o.StartCharge, o.MinCharge)
+	}
+	b.WriteString(".")
+	switch {
+	case o.Skipped == 1:
+		b.WriteString(" 1 scheduled job was skipped to save power.")
+	case o.Skipped > 1:
+		fmt.Fprintf(&b, " %d scheduled jobs were skipped to save power.", o.Skipped)
+	}
+	return b.String()
+}
+
+func chargeText(rd Reading) string {
+	var parts []string
+	if rd.Charge >= 0 {
+		parts = append(parts, fmt.Sprintf("%.0f%% charged", rd.Charge))
+	}
+	if rd.Runtime > 0 {
+		parts = append(parts, "about "+minutes(rd.Runtime)+" left")
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(parts, ", ") + ")"
+}
+
+// minutes formats d as e.g. "1 h 5 min".
+func minutes(d time.Duration) string {
+	m := int(d.Round(time.Minute).Minutes())
+	if m < 60 {
+		return fmt.Sprintf("%d min", m)
+	}
+	return fmt.Sprintf("%d h %d min", m/60, m%60)
+}
+
+// Tools returns the battery_status and power_outages tools.
+func (m *Monitor) Tools() []tools.Tool {
+	return []tools.Tool{
+		tools.New("battery_status", "Get whether the Pi is on mains power or running on its UPS battery, with the charge.", tools.NoParams,
+			func(ctx context.Context, _ json.RawMessage) (string, error) {
+				rd, err := m.Reading()
+				if err != nil && rd.ReadAt.IsZero() {
+					return "", err
+				}
+				state := "On mains power"
+				if rd.OnBattery {
+					state = "On battery"
+				}
+				out := state + chargeText(rd) + ", as of " + rd.ReadAt.Local().Format("15:04:05") + "."
+				m.mu.Lock()
+				if m.outage != nil {
+					out += " " + Summary(m.outage)
+				}
+				m.mu.Unlock()
+				return out, nil
+			}),
+		tools.New("power_outages", "List recent power outages the Pi rode out on battery.",
+			`{"type":"object","properties":{"limit":{"type":"integer","description":"how many, newest first (default 5)"}}}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var in struct {
+					Limit int `json:"limit"`
+				}
+				if err := tools.Decode(args, &in); err != nil {
+					return "", err
+				}
+				if in.Limit <= 0 {
+					in.Limit = 5
+				}
+				outs, err := m.db.Outages(min(in.Limit, 50))
+				if err != nil {
+					return "", err
+				}
+				if len(outs) == 0 {
+					return "No power outages recorded.", nil
+				}
+				var b strings.Builder
+				for _, o := range outs {
+					b.WriteString(Summary(&o) + "\n")
+				}
+				return b.String(), nil
+			}),
+	}
+}
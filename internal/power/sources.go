@@ -0,0 +1,232 @@
+package power
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"pi-agent/internal/config"
+)
+
+// Reading is the state of the power supply.
+type Reading struct {
+	OnBattery bool          `json:"on_battery"`
+	Low       bool          `json:"low,omitempty"` // the UPS reports a low battery
+	Charge    float64       `json:"charge"`        // percent, -1 if unknown
+	Runtime   time.Duration `json:"runtime,omitempty"`
+	ReadAt    time.Time     `json:"read_at"`
+}
+
+// Source reads the power supply.
+type Source interface {
+	Name() string
+	Read(ctx context.Context) (Reading, error)
+}
+
+// NewSource returns the source configured by c.
+func NewSource(c *config.Power) (Source, error) {
+	switch c.Source {
+	case "nut":
+		return &NUT{Addr: c.Address, UPS: c.UPS, Username: c.Username, Password: c.PasswordValue()}, nil
+	case "pisugar":
+		return &PiSugar{Addr: c.Address}, nil
+	case "sysfs":
+		return NewSysfs(c.Supply)
+	}
+	return nil, fmt.Errorf("unknown power source %q", c.Source)
+}
+
+const dialTimeout = 5 * time.Second
+
+// dial connects to a line-based TCP service, bounded by ctx.
+func dial(ctx context.Context, addr string) (net.Conn, *bufio.Reader, error) {
+	var d net.Dialer
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Now().Add(2 * dialTimeout))
+	return conn, bufio.NewReader(conn), nil
+}
+
+// NUT reads a UPS through a Network UPS Tools server.
+type NUT struct {
+	Addr, UPS          string
+	Username, Password string // optional
+}
+
+func (n *NUT) Name() string { return "nut:" + n.UPS + "@" + n.Addr }
+
+func (n *NUT) Read(ctx context.Context) (Reading, error) {
+	conn, r, err := dial(ctx, n.Addr)
+	if err != nil {
+		return Reading{}, fmt.Errorf("nut: %w", err)
+	}
+	defer conn.Close()
+	cmd := func(line string) (string, error) {
+		if _, err := fmt.Fprintf(conn, "%s\n", line); err != nil {
+			return "", err
+		}
+		reply, err := r.ReadString('\n')
+		reply = strings.TrimSpace(reply)
+		if err == nil && strings.HasPrefix(reply, "ERR ") {
+			err = errors.New(strings.ToLower(reply[4:]))
+		}
+		return reply, err
+	}
+	if n.Username != "" {
+		if _, err := cmd("USERNAME " + n.Username); err != nil {
+			return Reading{}, fmt.Errorf("nut: logging in: %w", err)
+		}
+		if _, err := cmd("PASSWORD " + n.Password); err != nil {
+			return Reading{}, fmt.Errorf("nut: logging in: %w", err)
+		}
+	}
+	if _, err := cmd("LIST VAR " + n.UPS); err != nil {
+		return Reading{}, fmt.Errorf("nut: listing %s: %w", n.UPS, err)
+	}
+	vars := make(map[string]string)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return Reading{}, fmt.Errorf("nut: listing %s: %w", n.UPS, err)
+		}
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "END LIST VAR") {
+			break
+		}
+		// VAR <ups> <name> "<value>"
+		fields := strings.SplitN(line, " ", 4)
+		if len(fields) == 4 && fields[0] == "VAR" {
+			vars[fields[2]] = strings.Trim(fields[3], `"`)
+		}
+	}
+	fmt.Fprintf(conn, "LOGOUT\n")
+
+	status := strings.Fields(vars["ups.status"])
+	rd := Reading{Charge: -1, ReadAt: time.Now()}
+	for _, s := range status {
+		switch s {
+		case "OB":
+			rd.OnBattery = true
+		case "LB":
+			rd.Low = true
+		}
+	}
+	if c, err := strconv.ParseFloat(vars["battery.charge"], 64); err == nil {
+		rd.Charge = c
+	}
+	if secs, err := strconv.ParseFloat(vars["battery.runtime"], 64); err == nil {
+		rd.Runtime = time.Duration(secs) * time.Second
+	}
+	return rd, nil
+}
+
+// PiSugar reads a PiSugar UPS HAT through its power manager's TCP
+// interface.
+type PiSugar struct {
+	Addr string
+}
+
+func (p *PiSugar) Name() string { return "pisugar@" + p.Addr }
+
+func (p *PiSugar) Read(ctx context.Context) (Reading, error) {
+	conn, r, err := dial(ctx, p.Addr)
+	if err != nil {
+		return Reading{}, fmt.Errorf("pisugar: %w", err)
+	}
+	defer conn.Close()
+	// Each command is answered with a "<name>: <value>" line.
+	get := func(name string) (string, error) {
+		if _, err := fmt.Fprintf(conn, "get %s\n", name); err != nil {
+			return "", err
+		}
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		_, v, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			return "", fmt.Errorf("unexpected reply %q", strings.TrimSpace(line))
+		}
+		return strings.TrimSpace(v), nil
+	}
+	rd := Reading{Charge: -1, ReadAt: time.Now()}
+	v, err := get("battery")
+	if err != nil {
+		return Reading{}, fmt.Errorf("pisugar: %w", err)
+	}
+	if c, err := strconv.ParseFloat(v, 64); err == nil {
+		rd.Charge = c
+	}
+	if v, err = get("battery_power_plugged"); err != nil {
+		return Reading{}, fmt.Errorf("pisugar: %w", err)
+	}
+	rd.OnBattery = v != "true"
+	return rd, nil
+}
+
+// Sysfs reads a battery or UPS with a kernel driver.
+type Sysfs struct {
+	dir string
+}
+
+const powerSupplies = "/sys/class/power_supply"
+
+// NewSysfs returns a source for the named power supply, or the first
+// battery or UPS if name is empty.
+func NewSysfs(name string) (*Sysfs, error) {
+	if name != "" {
+		dir := filepath.Join(powerSupplies, name)
+		if _, err := os.Stat(filepath.Join(dir, "status")); err != nil {
+			return nil, fmt.Errorf("power supply %s: %w", name, err)
+		}
+		return &Sysfs{dir: dir}, nil
+	}
+	entries, err := os.ReadDir(powerSupplies)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		dir := filepath.Join(powerSupplies, e.Name())
+		if t := readAttr(dir, "type"); t == "Battery" || t == "UPS" {
+			return &Sysfs{dir: dir}, nil
+		}
+	}
+	return nil, fmt.Errorf("no battery under %s", powerSupplies)
+}
+
+func (s *Sysfs) Name() string { return "sysfs:" + filepath.Base(s.dir) }
+
+func (s *Sysfs) Read(ctx context.Context) (Reading, error) {
+	status := readAttr(s.dir, "status")
+	if status == "" {
+		return Reading{}, fmt.Errorf("reading %s: no status", s.dir)
+	}
+	rd := Reading{OnBattery: status == "Discharging", Charge: -1, ReadAt: time.Now()}
+	if c, err := strconv.ParseFloat(readAttr(s.dir, "capacity"), 64); err == nil {
+		rd.Charge = c
+	}
+	rd.Low = readAttr(s.dir, "capacity_level") == "Critical" || readAttr(s.dir, "capacity_level") == "Low"
+	if secs, err := strconv.Atoi(readAttr(s.dir, "time_to_empty_now")); err == nil && secs > 0 {
+		rd.Runtime = time.Duration(secs) * time.Second
+	}
+	return rd, nil
+}
+
+func readAttr(dir, name string) string {
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
@@ -0,0 +1,93 @@
+package presence
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"pi-agent/internal/notify"
+	"pi-agent/internal/store"
+	"pi-agent/internal/tools"
+)
+
+// Arrivals runs stored arrival actions when a person gets home. Each
+// action's prompt is answered by the model; the answer is posted to the
+// action's conversation and sent as a notification.
+type Arrivals struct {
+	db       *store.DB
+	complete func(ctx context.Context, prompt string) (string, error)
+	notifier notify.Notifier // optional
+}
+
+// NewArrivals creates an arrival action runner. Register Handle with
+// Tracker.OnChange to activate it.
+func NewArrivals(db *store.DB, complete func(ctx context.Context, prompt string) (string, error), n notify.Notifier) *Arrivals {
+	return &Arrivals{db: db, complete: complete, notifier: n}
+}
+
+// Handle runs any pending actions for a person who just arrived.
+func (a *Arrivals) Handle(st Status) {
+	if !st.Home {
+		return
+	}
+	actions, err := a.db.ArrivalActions(st.Name)
+	if err != nil {
+		log.Printf("arrival actions: %v", err)
+		return
+	}
+	for _, act := range actions {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		err := a.run(ctx, st, act)
+		cancel()
+		if err != nil {
+			log.Printf("arrival action %d failed: %v", act.ID, err)
+			continue
+		}
+		if err := a.db.DeleteArrivalAction(act.ID); err != nil {
+			log.Printf("arrival actions: %v", err)
+		}
+	}
+}
+
+func (a *Arrivals) run(ctx context.Context, st Status, act store.ArrivalAction) error {
+	prompt := fmt.Sprintf("%s just arrived home. Earlier they asked: %q. Carry out that request now.", st.Name, act.Prompt)
+	reply, err := a.complete(ctx, prompt)
+	if err != nil {
+		return err
+	}
+	if err := a.db.AddMessage(act.ConversationID, store.RoleAssistant, reply); err != nil {
+		return err
+	}
+	if a.notifier != nil {
+		return a.notifier.Notify(ctx, notify.Message{Title: "Welcome home, " + st.Name, Body: reply, User: st.Name})
+	}
+	return nil
+}
+
+// Tools returns the on_arrival tool.
+func (a *Arrivals) Tools() []tools.Tool {
+	return []tools.Tool{
+		tools.New("on_arrival",
+			`Schedule a request to carry out when a person next arrives home, e.g. "read me my messages when I get home".`,
+			`{"type":"object","properties":{
+				"person":{"type":"string","description":"household member's name"},
+				"request":{"type":"string","description":"what to do on arrival, in the user's words"}
+			},"required":["person","request"]}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var in struct {
+					Person  string `json:"person"`
+					Request string `json:"request"`
+				}
+				if err := tools.Decode(args, &in); err != nil {
+					return "", err
+				}
+				act := &store.ArrivalAction{Person: in.Person, Prompt: in.Request, ConversationID: tools.ConversationID(ctx)}
+				if err := a.db.AddArrivalAction(act); err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("Will do when %s gets home.", in.Person), nil
+			}),
+	}
+}
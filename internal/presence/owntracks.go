@@ -0,0 +1,40 @@
+package presence
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// OwnTracksEvent is the subset of an OwnTracks HTTP-mode payload needed to
+// tell whether the user is home.
+type OwnTracksEvent struct {
+	Type      string   `json:"_type"`     // "location" or "transition"
+	Event     string   `json:"event"`     // transition: "enter" or "leave"
+	Desc      string   `json:"desc"`      // transition: region name
+	InRegions []string `json:"inregions"` // location: regions currently inside
+}
+
+// ParseOwnTracks reports whether an OwnTracks payload puts the user inside
+// the home region. ok is false for payloads that say nothing about it,
+// such as a transition for another region.
+func ParseOwnTracks(body []byte, homeRegion string) (home, ok bool, err error) {
+	var ev OwnTracksEvent
+	if err := json.Unmarshal(body, &ev); err != nil {
+		return false, false, fmt.Errorf("invalid OwnTracks payload: %w", err)
+	}
+	switch ev.Type {
+	case "transition":
+		if !strings.EqualFold(ev.Desc, homeRegion) {
+			return false, false, nil
+		}
+		return ev.Event == "enter", true, nil
+	case "location":
+		if ev.InRegions == nil {
+			return false, false, nil // regions not reported by this client
+		}
+		return slices.ContainsFunc(ev.InRegions, func(r string) bool { return strings.EqualFold(r, homeRegion) }), true, nil
+	}
+	return false, false, nil
+}
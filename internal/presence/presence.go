@@ -0,0 +1,173 @@
+package presence
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"pi-agent/internal/tools"
+)
+
+// Status is whether a person is currently home.
+type Status struct {
+	Name   string    `json:"name"`
+	Home   bool      `json:"home"`
+	Source string    `json:"source"`
+	Since  time.Time `json:"since"`
+}
+
+// Source reports which people it can currently see as home. People a
+// source knows about but cannot see should map to false.
+type Source interface {
+	Name() string
+	Scan(ctx context.Context) (map[string]bool, error)
+}
+
+// Tracker combines presence sources into a per-person home/away status.
+// A person is home if any source reports them home.
+type Tracker struct {
+	sources  []Source
+	interval time.Duration
+	due      func() bool // optional; see SetPace
+
+	mu        sync.Mutex
+	people    map[string]*Status
+	listeners []func(Status)
+}
+
+// NewTracker creates a tracker polling the given sources at interval.
+func NewTracker(interval time.Duration, sources ...Source) *Tracker {
+	return &Tracker{sources: sources, interval: interval, people: make(map[string]*Status)}
+}
+
+// SetPace makes the tracker ask due on each tick whether to poll, so
+// polling can slow down, e.g. on battery.
+func (t *Tracker) SetPace(due func() bool) {
+	t.due = due
+}
+
+// Run polls the sources until ctx is cancelled.
+func (t *Tracker) Run(ctx context.Context) {
+	t.poll(ctx)
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if t.due == nil || t.due() {
+				t.poll(ctx)
+			}
+		}
+	}
+}
+
+func (t *Tracker) poll(ctx context.Context) {
+	home := make(map[string]string) // person -> source that sees them
+	seen := make(map[string]bool)
+	for _, src := range t.sources {
+		res, err := src.Scan(ctx)
+		if err != nil {
+			log.Printf("presence source %s: %v", src.Name(), err)
+			continue
+		}
+		for name, isHome := range res {
+			seen[name] = true
+			if isHome && home[name] == "" {
+				home[name] = src.Name()
+			}
+		}
+	}
+	for name := range seen {
+		t.Set(name, home[name] != "", home[name])
+	}
+}
+
+// OnChange registers fn to be called, in its own goroutine, whenever a
+// known person arrives or leaves. The first status seen for a person is
+// not reported as a change.
+func (t *Tracker) OnChange(fn func(Status)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.listeners = append(t.listeners, fn)
+}
+
+// Set records a person's status, e.g. from a push update. The Since time
+// only changes when the status flips.
+func (t *Tracker) Set(name string, home bool, source string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st, ok := t.people[name]
+	if ok && st.Home == home {
+		if home {
+			st.Source = source
+		}
+		return
+	}
+	next := &Status{Name: name, Home: home, Source: source, Since: time.Now()}
+	t.people[name] = next
+	if ok {
+		log.Printf("presence: %s is now %s", name, awayOrHome(home))
+		for _, fn := range t.listeners {
+			go fn(*next)
+		}
+	}
+}
+
+// Statuses returns everyone's status sorted by name.
+func (t *Tracker) Statuses() []Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]Status, 0, len(t.people))
+	for _, st := range t.people {
+		out = append(out, *st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Summary describes who is home in a sentence suitable for the system
+// prompt, e.g. "Alice is home, Bob is away." It is empty when no one is
+// tracked.
+func (t *Tracker) Summary() string {
+	statuses := t.Statuses()
+	if len(statuses) == 0 {
+		return ""
+	}
+	parts := make([]string, len(statuses))
+	for i, st := range statuses {
+		parts[i] = st.Name + " is " + awayOrHome(st.Home)
+	}
+	return strings.Join(parts, ", ") + "."
+}
+
+func awayOrHome(home bool) string {
+	if home {
+		return "home"
+	}
+	return "away"
+}
+
+// Tools returns the who_is_home tool.
+func (t *Tracker) Tools() []tools.Tool {
+	return []tools.Tool{
+		tools.New("who_is_home", "List household members and whether they are currently home.", tools.NoParams,
+			func(context.Context, json.RawMessage) (string, error) {
+				statuses := t.Statuses()
+				if len(statuses) == 0 {
+					return "No presence information is available.", nil
+				}
+				var b strings.Builder
+				for _, st := range statuses {
+					fmt.Fprintf(&b, "%s: %s since %s\n", st.Name, awayOrHome(st.Home), st.Since.Format(time.RFC1123))
+				}
+				return b.String(), nil
+			}),
+	}
+}
@@ -0,0 +1,82 @@
+package presence
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"pi-agent/internal/homeassistant"
+)
+
+// ARPSource detects phones on the LAN from the kernel ARP table. Phones
+// that sleep their Wi-Fi drop out of the table, so pair this with a longer
+// poll interval or another source where possible.
+type ARPSource struct {
+	path    string
+	devices map[string]string // lower-case MAC -> person
+}
+
+// NewARPSource creates a source mapping MAC addresses to people.
+func NewARPSource(devices map[string]string) *ARPSource {
+	norm := make(map[string]string, len(devices))
+	for mac, name := range devices {
+		norm[strings.ToLower(mac)] = name
+	}
+	return &ARPSource{path: "/proc/net/arp", devices: norm}
+}
+
+func (s *ARPSource) Name() string { return "arp" }
+
+func (s *ARPSource) Scan(context.Context) (map[string]bool, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("reading ARP table: %w", err)
+	}
+	defer f.Close()
+
+	res := make(map[string]bool)
+	for _, name := range s.devices {
+		res[name] = false
+	}
+	// Format: IP address  HW type  Flags  HW address  Mask  Device
+	sc := bufio.NewScanner(f)
+	sc.Scan() // header
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 4 || fields[2] == "0x0" {
+			continue // incomplete entry
+		}
+		if name, ok := s.devices[strings.ToLower(fields[3])]; ok {
+			res[name] = true
+		}
+	}
+	return res, sc.Err()
+}
+
+// HASource reads Home Assistant person entities.
+type HASource struct {
+	client *homeassistant.Client
+}
+
+// NewHASource creates a source backed by Home Assistant person entities.
+func NewHASource(client *homeassistant.Client) *HASource {
+	return &HASource{client: client}
+}
+
+func (s *HASource) Name() string { return "home_assistant" }
+
+func (s *HASource) Scan(ctx context.Context) (map[string]bool, error) {
+	states, err := s.client.States(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]bool)
+	for _, st := range states {
+		if st.Domain() == "person" {
+			res[st.Name()] = st.State == "home"
+		}
+	}
+	return res, nil
+}
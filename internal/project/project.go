@@ -0,0 +1,321 @@
+// Package project binds conversations to local git repositories, giving
+// the model tools to read files, run tests and propose patches that are
+// applied once approved.
+package project
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pi-agent/internal/approval"
+	"pi-agent/internal/gitcmd"
+	"pi-agent/internal/patch"
+	"pi-agent/internal/sandbox"
+	"pi-agent/internal/store"
+	"pi-agent/internal/tools"
+)
+
+// Limits on what the tools return to the model.
+const (
+	maxListed   = 500
+	maxMatches  = 200
+	maxReadSize = 100 << 10
+)
+
+// ErrUnbound is returned by the tools in conversations without a project.
+var ErrUnbound = errors.New("this conversation is not bound to a project")
+
+// Manager binds conversations to repositories and provides the project
+// tools.
+type Manager struct {
+	db          *store.DB
+	patches     *patch.Manager
+	testTimeout time.Duration
+}
+
+// New creates a manager proposing its patches through patches.
+func New(db *store.DB, patches *patch.Manager, testTimeout time.Duration) *Manager {
+	return &Manager{db: db, patches: patches, testTimeout: testTimeout}
+}
+
+// Bind binds a conversation to the git repository containing path. An
+// empty test command is guessed from the files in the repository when
+// tests are run.
+func (m *Manager) Bind(ctx context.Context, conversationID, path, testCommand string) (*store.Project, error) {
+	root, err := gitcmd.TopLevel(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not in a git repository: %w", path, err)
+	}
+	p := &store.Project{ConversationID: conversationID, Path: root, TestCommand: testCommand}
+	if err := m.db.SetProject(p); err != nil {
+		return nil, err
+	}
+	return m.db.Project(conversationID)
+}
+
+// Context tells the model about the project bound to the current
+// conversation, if any. It is a prompt context provider.
+func (m *Manager) Context(ctx context.Context) string {
+	p, err := m.db.Project(tools.ConversationID(ctx))
+	if err != nil {
+		return ""
+	}
+	branch, _ := gitcmd.Run(ctx, p.Path, nil, "branch", "--show-current")
+	return fmt.Sprintf("This conversation is about the git repository at %s (branch %s). "+
+		"Use the project_ tools to look at files and run the tests before suggesting changes. "+
+		"Make changes by proposing a unified diff with project_propose_patch; it is applied only once the user approves it.",
+		p.Path, strings.TrimSpace(branch))
+}
+
+func (m *Manager) project(ctx context.Context) (*store.Project, error) {
+	p, err := m.db.Project(tools.ConversationID(ctx))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrUnbound
+	}
+	return p, err
+}
+
+// Tools returns the project tools.
+func (m *Manager) Tools() []tools.Tool {
+	return []tools.Tool{
+		tools.New("project_status",
+			"Show the project's branch, uncommitted changes and recent commits.",
+			tools.NoParams, m.status),
+		tools.New("project_files",
+			"List the files tracked in the project, optionally under a directory.",
+			`{"type":"object","properties":{"dir":{"type":"string","description":"directory relative to the repository root"}}}`,
+			m.files),
+		tools.New("project_read_file",
+			"Read a file from the project, with line numbers. Ranges are 1-based and inclusive.",
+			`{"type":"object","properties":{
+				"path":{"type":"string","description":"path relative to the repository root"},
+				"start_line":{"type":"integer"},
+				"end_line":{"type":"integer"}
+			},"required":["path"]}`,
+			m.readFile),
+		tools.New("project_search",
+			"Search the project's tracked files for a regular expression (git grep).",
+			`{"type":"object","properties":{"pattern":{"type":"string"}},"required":["pattern"]}`,
+			m.search),
+		tools.New("project_run_tests",
+			"Run the project's tests and return the output.",
+			tools.NoParams, m.runTests),
+		tools.New("project_propose_patch",
+			"Propose a change to the project as a unified diff (as produced by git diff, with a/ and b/ prefixes). The diff is checked, then waits for the user's approval before being applied.",
+			`{"type":"object","properties":{
+				"diff":{"type":"string"},
+				"summary":{"type":"string","description":"one line describing the change"}
+			},"required":["diff","summary"]}`,
+			m.propose),
+	}
+}
+
+func (m *Manager) status(ctx context.Context, _ json.RawMessage) (string, error) {
+	p, err := m.project(ctx)
+	if err != nil {
+		return "", err
+	}
+	status, err := gitcmd.Run(ctx, p.Path, nil, "status", "--short", "--branch")
+	if err != nil {
+		return "", err
+	}
+	log, _ := gitcmd.Run(ctx, p.Path, nil, "log", "--oneline", "-10")
+	return fmt.Sprintf("Repository: %s\n\n%s\nRecent commits:\n%s", p.Path, status, log), nil
+}
+
+func (m *Manager) files(ctx context.Context, args json.RawMessage) (string, error) {
+	var in struct {
+		Dir string `json:"dir"`
+	}
+	if err := tools.Decode(args, &in); err != nil {
+		return "", err
+	}
+	p, err := m.project(ctx)
+	if err != nil {
+		return "", err
+	}
+	gitArgs := []string{"ls-files"}
+	if in.Dir != "" && in.Dir != "." {
+		if !filepath.IsLocal(in.Dir) {
+			return "", fmt.Errorf("%s is outside the repository", in.Dir)
+		}
+		gitArgs = append(gitArgs, "--", in.Dir)
+	}
+	out, err := gitcmd.Run(ctx, p.Path, nil, gitArgs...)
+	if err != nil {
+		return "", err
+	}
+	return truncateLines(out, maxListed), nil
+}
+
+func (m *Manager) readFile(ctx context.Context, args json.RawMessage) (string, error) {
+	var in struct {
+		Path      string `json:"path"`
+		StartLine int    `json:"start_line"`
+		EndLine   int    `json:"end_line"`
+	}
+	if err := tools.Decode(args, &in); err != nil {
+		return "", err
+	}
+	p, err := m.project(ctx)
+	if err != nil {
+		return "", err
+	}
+	path, err := resolve(p.Path, in.Path)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	start, end := max(in.StartLine, 1), len(lines)
+	if in.EndLine > 0 && in.EndLine < end {
+		end = in.EndLine
+	}
+	var b strings.Builder
+	for i := start; i <= end; i++ {
+		if b.Len() > maxReadSize {
+			fmt.Fprintf(&b, "[stopped at line %d of %d; read the rest with start_line]\n", i-1, len(lines))
+			break
+		}
+		fmt.Fprintf(&b, "%5d  %s\n", i, lines[i-1])
+	}
+	return b.String(), nil
+}
+
+func (m *Manager) search(ctx context.Context, args json.RawMessage) (string, error) {
+	var in struct {
+		Pattern string `json:"pattern"`
+	}
+	if err := tools.Decode(args, &in); err != nil {
+		return "", err
+	}
+	p, err := m.project(ctx)
+	if err != nil {
+		return "", err
+	}
+	out, err := gitcmd.Run(ctx, p.Path, nil, "grep", "-n", "-I", "-E", "-e", in.Pattern)
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && exit.ExitCode() == 1 {
+		return "No matches.", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return truncateLines(out, maxMatches), nil
+}
+
+func (m *Manager) runTests(ctx context.Context, _ json.RawMessage) (string, error) {
+	p, err := m.project(ctx)
+	if err != nil {
+		return "", err
+	}
+	command := p.TestCommand
+	if command == "" {
+		if command = guessTestCommand(p.Path); command == "" {
+			return "", errors.New("no test command is set for this project and none could be guessed")
+		}
+	}
+	// Test tools such as go or npm are often installed outside the
+	// minimal PATH, so the agent's own is passed on.
+	env := []string{"HOME=" + os.Getenv("HOME"), "PATH=" + os.Getenv("PATH")}
+	res, err := sandbox.Exec(ctx, p.Path, m.testTimeout, env, "sh", "-c", command)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("$ %s\n%s", command, res), nil
+}
+
+// guessTestCommand picks a test command from the files at the root of a
+// repository.
+func guessTestCommand(root string) string {
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(root, name))
+		return err == nil
+	}
+	switch {
+	case exists("go.mod"):
+		return "go test ./..."
+	case exists("Cargo.toml"):
+		return "cargo test"
+	case exists("package.json"):
+		return "npm test"
+	case exists("pyproject.toml"), exists("pytest.ini"), exists("setup.py"):
+		return "python3 -m pytest -q"
+	case exists("Makefile"):
+		return "make test"
+	}
+	return ""
+}
+
+func (m *Manager) propose(ctx context.Context, args json.RawMessage) (string, error) {
+	var in struct {
+		Diff    string `json:"diff"`
+		Summary string `json:"summary"`
+	}
+	if err := tools.Decode(args, &in); err != nil {
+		return "", err
+	}
+	a, err := m.Propose(ctx, tools.ConversationID(ctx), in.Diff, in.Summary)
+	if err != nil {
+		return "", err
+	}
+	if a.Status != store.ApprovalPending {
+		return approval.Outcome(a), nil
+	}
+	return fmt.Sprintf("The patch applies cleanly and is waiting for approval as request #%d. Once applied it can be rolled back.", a.ID), nil
+}
+
+// Propose checks that diff applies to the conversation's project and
+// queues it for approval.
+func (m *Manager) Propose(ctx context.Context, conversationID, diff, summary string) (*store.Approval, error) {
+	p, err := m.db.Project(conversationID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrUnbound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if summary == "" {
+		summary = "Apply a patch"
+	}
+	a, _, err := m.patches.Propose(ctx, conversationID, p.Path, diff, fmt.Sprintf("%s in %s", summary, filepath.Base(p.Path)))
+	return a, err
+}
+
+// resolve returns the absolute path of rel within root, refusing paths
+// that leave it, including through symlinks.
+func resolve(root, rel string) (string, error) {
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("%s is outside the repository", rel)
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	path, err := filepath.EvalSymlinks(filepath.Join(root, rel))
+	if err != nil {
+		return "", err
+	}
+	if r, err := filepath.Rel(realRoot, path); err != nil || !filepath.IsLocal(r) {
+		return "", fmt.Errorf("%s is outside the repository", rel)
+	}
+	return path, nil
+}
+
+func truncateLines(s string, n int) string {
+	lines := strings.SplitAfter(s, "\n")
+	if len(lines) <= n {
+		return s
+	}
+	return strings.Join(lines[:n], "") + fmt.Sprintf("[%d more lines not shown]\n", len(lines)-n)
+}
@@ -0,0 +1,147 @@
+// Package promptvars fills in {{variables}} in system prompts at request
+// time, such as {{now}}, {{presence.alice}} or {{temp.living_room}}, so
+// the model sees fresh household state without calling a tool.
+package promptvars
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"pi-agent/internal/homeassistant"
+	"pi-agent/internal/presence"
+)
+
+// Unknown replaces variables that cannot be resolved, so the model never
+// sees template syntax.
+const Unknown = "unknown"
+
+// timeout bounds how long resolving the variables of one prompt may take.
+const timeout = 3 * time.Second
+
+var variable = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z0-9_]+)*)\s*\}\}`)
+
+// Source resolves the variables under a name. Key is the rest of the
+// variable name after it, "" for the name itself: a source registered as
+// "presence" is asked for "alice" by {{presence.alice}}.
+type Source func(ctx context.Context, key string) (string, bool)
+
+// Resolver expands variables from registered sources. The zero value
+// knows no variables; New adds the clock.
+type Resolver struct {
+	sources map[string]Source
+}
+
+// New returns a resolver knowing {{now}}, {{date}} and {{time}}.
+func New() *Resolver {
+	r := &Resolver{sources: make(map[string]Source)}
+	clock := func(layout string) Source {
+		return func(_ context.Context, key string) (string, bool) {
+			return time.Now().Format(layout), key == ""
+		}
+	}
+	r.Register("now", clock("Monday, January 2, 2006 15:04 MST"))
+	r.Register("date", clock("Monday, January 2, 2006"))
+	r.Register("time", clock("15:04"))
+	return r
+}
+
+// Register adds a source for a variable name or a dotted prefix of names.
+// The longest registered prefix of a variable wins.
+func (r *Resolver) Register(name string, src Source) {
+	if r.sources == nil {
+		r.sources = make(map[string]Source)
+	}
+	r.sources[name] = src
+}
+
+// Expand replaces the variables in text. It is an engine.Config
+// Variables function.
+func (r *Resolver) Expand(ctx context.Context, text string) string {
+	if !strings.Contains(text, "{{") {
+		return text
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return variable.ReplaceAllStringFunc(text, func(m string) string {
+		v, ok := r.resolve(ctx, variable.FindStringSubmatch(m)[1])
+		if !ok {
+			return Unknown
+		}
+		return v
+	})
+}
+
+func (r *Resolver) resolve(ctx context.Context, name string) (string, bool) {
+	for prefix := name; ; {
+		if src, ok := r.sources[prefix]; ok {
+			return src(ctx, strings.TrimPrefix(name[len(prefix):], "."))
+		}
+		i := strings.LastIndexByte(prefix, '.')
+		if i < 0 {
+			return "", false
+		}
+		prefix = prefix[:i]
+	}
+}
+
+// Entity shows one Home Assistant entity: its state, with the unit if it
+// has one.
+func Entity(ha *homeassistant.Client, entityID string) Source {
+	return func(ctx context.Context, key string) (string, bool) {
+		if key != "" {
+			return "", false
+		}
+		return entityState(ctx, ha, entityID)
+	}
+}
+
+// Entities shows any Home Assistant entity by its ID, registered as "ha"
+// for {{ha.sensor.outdoor_temperature}}.
+func Entities(ha *homeassistant.Client) Source {
+	return func(ctx context.Context, key string) (string, bool) {
+		if !strings.Contains(key, ".") {
+			return "", false
+		}
+		return entityState(ctx, ha, key)
+	}
+}
+
+func entityState(ctx context.Context, ha *homeassistant.Client, entityID string) (string, bool) {
+	// States is cached briefly, so a prompt with several sensors costs at
+	// most one request.
+	states, err := ha.States(ctx)
+	if err != nil {
+		log.Printf("prompt variables: %v", err)
+		return "", false
+	}
+	for _, st := range states {
+		if st.EntityID != entityID {
+			continue
+		}
+		if unit, _ := st.Attributes["unit_of_measurement"].(string); unit != "" && st.State != "unavailable" && st.State != "unknown" {
+			return fmt.Sprintf("%s %s", st.State, unit), true
+		}
+		return st.State, true
+	}
+	return "", false
+}
+
+// Presence shows whether a tracked person is "home" or "away", registered
+// as "presence" for {{presence.alice}}.
+func Presence(t *presence.Tracker) Source {
+	return func(_ context.Context, name string) (string, bool) {
+		for _, st := range t.Statuses() {
+			if strings.EqualFold(st.Name, name) {
+				if st.Home {
+					return "home", true
+				}
+				return "away", true
+			}
+		}
+		return "", false
+	}
+}
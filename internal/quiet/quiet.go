@@ -0,0 +1,365 @@
+// Package quiet implements quiet hours and do-not-disturb: during
+// configured windows, or while do-not-disturb is on, earcons are muted,
+// notifications are held until the quiet period ends, and scheduled
+// digests wait for it, unless they are urgent enough to break through.
+package quiet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"pi-agent/internal/audio"
+	"pi-agent/internal/config"
+	"pi-agent/internal/notify"
+	"pi-agent/internal/tools"
+)
+
+// Channels quiet hours apply to.
+const (
+	ChannelAudio  = "audio"
+	ChannelNotify = "notify"
+	ChannelDigest = "digest"
+)
+
+// holdAll is a level above any priority: nothing on the channel gets
+// through.
+const holdAll notify.Priority = notify.PriorityUrgent + 1
+
+var levels = map[string]notify.Priority{
+	"low": notify.PriorityLow, "default": notify.PriorityDefault,
+	"high": notify.PriorityHigh, "urgent": notify.PriorityUrgent, "none": holdAll,
+}
+
+var defaultLevels = map[string]notify.Priority{
+	ChannelAudio: notify.PriorityHigh, ChannelNotify: notify.PriorityUrgent, ChannelDigest: holdAll,
+}
+
+// maxHeld caps the notifications held during a quiet period; the oldest
+// are dropped beyond it.
+const maxHeld = 100
+
+type window struct {
+	days       [7]bool // by time.Weekday the window starts on
+	start, end int     // minutes after midnight
+}
+
+type schedule struct {
+	windows []window
+	levels  map[string]notify.Priority
+}
+
+// Hours decides whether it is quiet.
+type Hours struct {
+	loc   *time.Location
+	all   schedule
+	users map[string]schedule
+
+	mu       sync.Mutex
+	dndUntil time.Time
+}
+
+// New returns quiet hours as configured; cfg may be nil, leaving only
+// manual do-not-disturb.
+func New(cfg *config.QuietHours) (*Hours, error) {
+	h := &Hours{loc: time.Local, all: schedule{levels: defaultLevels}, users: make(map[string]schedule)}
+	if cfg == nil {
+		return h, nil
+	}
+	if cfg.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		h.loc = loc
+	}
+	var err error
+	if h.all, err = newSchedule(cfg.Windows, cfg.Channels, defaultLevels); err != nil {
+		return nil, err
+	}
+	for _, u := range cfg.Users {
+		s, err := newSchedule(u.Windows, u.Channels, h.all.levels)
+		if err != nil {
+			return nil, fmt.Errorf("user %q: %w", u.User, err)
+		}
+		if len(u.Windows) == 0 {
+			s.windows = h.all.windows
+		}
+		h.users[u.User] = s
+	}
+	return h, nil
+}
+
+func newSchedule(windows []config.Window, channels map[string]string, base map[string]notify.Priority) (schedule, error) {
+	s := schedule{levels: make(map[string]notify.Priority)}
+	for ch, p := range base {
+		s.levels[ch] = p
+	}
+	for ch, level := range channels {
+		p, ok := levels[level]
+		if !ok {
+			return s, fmt.Errorf("channel %q: unknown level %q", ch, level)
+		}
+		s.levels[ch] = p
+	}
+	for _, cw := range windows {
+		var w window
+		var err error
+		if w.start, err = config.ClockMinutes(cw.Start); err != nil {
+			return s, err
+		}
+		if w.end, err = config.ClockMinutes(cw.End); err != nil {
+			return s, err
+		}
+		for _, d := range cw.Days {
+			day, ok := config.Weekday(d)
+			if !ok {
+				return s, fmt.Errorf("unknown day %q", d)
+			}
+			w.days[day] = true
+		}
+		if len(cw.Days) == 0 {
+			w.days = [7]bool{true, true, true, true, true, true, true}
+		}
+		s.windows = append(s.windows, w)
+	}
+	return s, nil
+}
+
+func (h *Hours) schedule(user string) schedule {
+	if s, ok := h.users[user]; ok {
+		return s
+	}
+	return h.all
+}
+
+// Until returns when the quiet period in effect for a user at t ends, or
+// the zero time if it is not quiet then. An empty user means everyone.
+func (h *Hours) Until(user string, t time.Time) time.Time {
+	end := t
+	// Windows may follow each other; follow them to the last.
+	for range 8 {
+		next := h.windowEnd(user, end)
+		if !next.After(end) {
+			break
+		}
+		end = next
+	}
+	h.mu.Lock()
+	if h.dndUntil.After(end) {
+		end = h.dndUntil
+	}
+	h.mu.Unlock()
+	if !end.After(t) {
+		return time.Time{}
+	}
+	return end
+}
+
+// windowEnd returns the latest end of the windows covering t, or t.
+func (h *Hours) windowEnd(user string, t time.Time) time.Time {
+	t = t.In(h.loc)
+	minute := t.Hour()*60 + t.Minute()
+	today := t.Weekday()
+	yesterday := (today + 6) % 7
+	y, m, d := t.Date()
+	at := func(dayOffset, minutes int) time.Time {
+		return time.Date(y, m, d+dayOffset, 0, minutes, 0, 0, h.loc)
+	}
+	end := t
+	for _, w := range h.schedule(user).windows {
+		var e time.Time
+		switch {
+		case w.start < w.end && w.days[today] && minute >= w.start && minute < w.end:
+			e = at(0, w.end)
+		case w.start > w.end && w.days[today] && minute >= w.start:
+			e = at(1, w.end)
+		case w.start > w.end && w.days[yesterday] && minute < w.end:
+			e = at(0, w.end)
+		}
+		if e.After(end) {
+			end = e
+		}
+	}
+	return end
+}
+
+// Allows reports whether a message of priority p, on a channel, for a
+// user, may be delivered now. A zero priority counts as the default.
+func (h *Hours) Allows(channel, user string, p notify.Priority) bool {
+	if h.Until(user, time.Now()).IsZero() {
+		return true
+	}
+	if p == 0 {
+		p = notify.PriorityDefault
+	}
+	return p >= h.schedule(user).levels[channel]
+}
+
+// SetDoNotDisturb makes it quiet for everyone until the given time, on top
+// of the configured windows. A time in the past turns it off.
+func (h *Hours) SetDoNotDisturb(until time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.dndUntil = until
+}
+
+// AllowCue reports whether an earcon may play now. Reminders count as
+// high priority; cues acknowledging the user count as default.
+func (h *Hours) AllowCue(cue audio.Cue) bool {
+	p := notify.PriorityDefault
+	if cue == audio.CueReminder {
+		p = notify.PriorityHigh
+	}
+	return h.Allows(ChannelAudio, "", p)
+}
+
+// Defer wraps a scheduled digest so that a run falling in quiet hours
+// waits until they end, unless the digest's priority lets it through.
+func (h *Hours) Defer(name string, p notify.Priority, job func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		for !h.Allows(ChannelDigest, "", p) {
+			until := h.Until("", time.Now())
+			log.Printf("quiet hours: %s postponed until %s", name, until.Format(time.DateTime))
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Until(until) + time.Second):
+			}
+		}
+		return job(ctx)
+	}
+}
+
+// Notifier wraps next so that notifications not allowed during quiet
+// hours are held, and sent once the quiet period of the user they are for
+// ends.
+func (h *Hours) Notifier(next notify.Notifier) notify.Notifier {
+	return &holdNotifier{hours: h, next: next}
+}
+
+type holdNotifier struct {
+	hours *Hours
+	next  notify.Notifier
+
+	mu    sync.Mutex
+	held  []notify.Message
+	timer *time.Timer
+}
+
+func (n *holdNotifier) Notify(ctx context.Context, msg notify.Message) error {
+	if n.hours.Allows(ChannelNotify, msg.User, msg.Priority) {
+		return n.next.Notify(ctx, msg)
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(n.held) == maxHeld {
+		n.held = n.held[1:]
+	}
+	n.held = append(n.held, msg)
+	n.schedule()
+	log.Printf("quiet hours: holding notification %q", msg.Title)
+	return nil
+}
+
+// schedule sets the timer for the earliest end of a held message's quiet
+// period. It must be called with n.mu held.
+func (n *holdNotifier) schedule() {
+	var earliest time.Time
+	now := time.Now()
+	for _, m := range n.held {
+		if u := n.hours.Until(m.User, now); earliest.IsZero() || u.Before(earliest) {
+			earliest = u
+		}
+	}
+	if n.timer != nil {
+		n.timer.Stop()
+	}
+	n.timer = time.AfterFunc(max(time.Until(earliest), 0)+time.Second, n.flush)
+}
+
+// flush sends the held messages whose quiet period has ended.
+func (n *holdNotifier) flush() {
+	n.mu.Lock()
+	var due, keep []notify.Message
+	now := time.Now()
+	for _, m := range n.held {
+		if n.hours.Until(m.User, now).IsZero() {
+			due = append(due, m)
+		} else {
+			keep = append(keep, m)
+		}
+	}
+	n.held, n.timer = keep, nil
+	if len(keep) > 0 {
+		n.schedule()
+	}
+	n.mu.Unlock()
+
+	for _, m := range due {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := n.next.Notify(ctx, m); err != nil {
+			log.Printf("quiet hours: sending held notification %q: %v", m.Title, err)
+		}
+		cancel()
+	}
+}
+
+// Tools returns tools for turning do-not-disturb on and off and asking
+// whether it is quiet.
+func (h *Hours) Tools() []tools.Tool {
+	return []tools.Tool{
+		tools.New("do_not_disturb",
+			"Turn do-not-disturb on for a number of minutes, holding back sounds and notifications that are not urgent. 0 minutes turns it off.",
+			`{"type":"object","properties":{"minutes":{"type":"integer","minimum":0}},"required":["minutes"]}`,
+			h.doNotDisturb),
+		tools.New("quiet_status",
+			"Tell whether quiet hours or do-not-disturb are in effect, and until when.",
+			tools.NoParams, h.status),
+	}
+}
+
+func (h *Hours) doNotDisturb(_ context.Context, args json.RawMessage) (string, error) {
+	var p struct {
+		Minutes int `json:"minutes"`
+	}
+	if err := json.Unmarshal(args, &p); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	if p.Minutes < 0 || p.Minutes > 7*24*60 {
+		return "", fmt.Errorf("minutes must be between 0 and %d", 7*24*60)
+	}
+	if p.Minutes == 0 {
+		h.SetDoNotDisturb(time.Time{})
+		if until := h.Until("", time.Now()); !until.IsZero() {
+			return "Do-not-disturb is off, but quiet hours last until " + until.In(h.loc).Format("15:04") + ".", nil
+		}
+		return "Do-not-disturb is off.", nil
+	}
+	until := time.Now().Add(time.Duration(p.Minutes) * time.Minute)
+	h.SetDoNotDisturb(until)
+	return "Do-not-disturb is on until " + until.In(h.loc).Format("Mon 15:04") + ".", nil
+}
+
+func (h *Hours) status(context.Context, json.RawMessage) (string, error) {
+	until := h.Until("", time.Now())
+	if until.IsZero() {
+		return "It is not quiet: sounds and notifications are delivered.", nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Quiet until %s.", until.In(h.loc).Format("Mon 15:04"))
+	for _, ch := range config.QuietChannels {
+		level := "nothing"
+		for name, p := range levels {
+			if p == h.all.levels[ch] && p != holdAll {
+				level = name + " priority and above"
+			}
+		}
+		fmt.Fprintf(&b, " %s: %s gets through.", ch, level)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,92 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxFetchBytes bounds how much of a fetched page is read.
+const maxFetchBytes = 5 << 20
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// Page is the extracted content of a fetched URL.
+type Page struct {
+	URL   string
+	Title string
+	Text  string
+}
+
+// Fetch downloads url and extracts its readable text. HTML is reduced to
+// text; plain text and other text/* types are used as is.
+func Fetch(ctx context.Context, url string) (*Page, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "pi-agent")
+	req.Header.Set("Accept", "text/html,text/plain;q=0.9,*/*;q=0.1")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFetchBytes))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", url, err)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	page := &Page{URL: resp.Request.URL.String()}
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		page.Title, page.Text = ExtractHTML(string(body))
+	case strings.HasPrefix(mediaType, "text/"), mediaType == "application/json":
+		page.Text = string(body)
+	default:
+		return nil, fmt.Errorf("fetching %s: unsupported content type %q", url, mediaType)
+	}
+	return page, nil
+}
+
+var (
+	titleRe   = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	dropRe    = regexp.MustCompile(`(?is)<(script|style|noscript|svg|head|nav|footer|form)\b.*?</(script|style|noscript|svg|head|nav|footer|form)>`)
+	commentRe = regexp.MustCompile(`(?s)<!--.*?-->`)
+	blockRe   = regexp.MustCompile(`(?i)</?(p|div|br|li|ul|ol|h[1-6]|tr|table|section|article|header|blockquote|pre)\b[^>]*>`)
+	tagRe     = regexp.MustCompile(`(?s)<[^>]*>`)
+	spaceRe   = regexp.MustCompile(`[ \t\r\f\v]+`)
+	blankRe   = regexp.MustCompile(`\n\s*\n+`)
+)
+
+// ExtractHTML returns the title and readable text of an HTML document.
+// It is a tag stripper rather than a full readability algorithm: scripts,
+// styles and navigation are dropped and block elements become line breaks.
+func ExtractHTML(doc string) (title, text string) {
+	if m := titleRe.FindStringSubmatch(doc); m != nil {
+		title = strings.Join(strings.Fields(html.UnescapeString(tagRe.ReplaceAllString(m[1], ""))), " ")
+	}
+	doc = commentRe.ReplaceAllString(doc, "")
+	doc = dropRe.ReplaceAllString(doc, "")
+	doc = blockRe.ReplaceAllString(doc, "\n")
+	doc = tagRe.ReplaceAllString(doc, "")
+	doc = html.UnescapeString(doc)
+	doc = spaceRe.ReplaceAllString(doc, " ")
+
+	lines := strings.Split(doc, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSpace(l)
+	}
+	text = blankRe.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return title, strings.TrimSpace(text)
+}
@@ -0,0 +1,220 @@
+package rag
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"pi-agent/internal/store"
+)
+
+// Chunking parameters, in characters. Chunks overlap so that a passage
+// split across a boundary is still retrievable as a whole.
+const (
+	chunkSize    = 1200
+	chunkOverlap = 200
+)
+
+// Index is a lexical retrieval index over documents stored in SQLite.
+// Ranking is BM25 over an FTS4 table; there is no embedding model available
+// through the ChatGPT backend, so retrieval is keyword based.
+type Index struct {
+	db *store.DB
+}
+
+// NewIndex creates an index backed by db.
+func NewIndex(db *store.DB) *Index {
+	return &Index{db: db}
+}
+
+// Result is the outcome of indexing a document.
+type Result struct {
+	Document *store.Document
+	store.IndexStats
+}
+
+// Add indexes text under source, replacing any previous version. Unchanged
+// content is detected by hash and skipped, and only modified chunks are
+// reindexed.
+func (x *Index) Add(kind, source, title, note, text string) (*Result, error) {
+	if strings.TrimSpace(text) == "" && note == "" {
+		return nil, fmt.Errorf("nothing to index for %s", source)
+	}
+	if title == "" {
+		title = source
+	}
+	doc := &store.Document{
+		Kind:        kind,
+		Source:      source,
+		Title:       title,
+		Note:        note,
+		ContentHash: Hash(title + "\x00" + note + "\x00" + text),
+	}
+	// The title and note are indexed with the first chunk so that they are
+	// searchable even for long documents.
+	chunks := Chunk(text)
+	head := strings.TrimSpace(title + "\n" + note)
+	if len(chunks) == 0 {
+		chunks = []string{head}
+	} else {
+		chunks[0] = head + "\n\n" + chunks[0]
+	}
+	stats, err := x.db.PutDocument(doc, chunks)
+	if err != nil {
+		return nil, err
+	}
+	if doc, err = x.db.Document(doc.ID); err != nil {
+		return nil, err
+	}
+	return &Result{Document: doc, IndexStats: stats}, nil
+}
+
+// Search returns the chunks best matching query.
+func (x *Index) Search(query string, limit int, f store.DocumentFilter) ([]store.Chunk, error) {
+	q := Query(query)
+	if q == "" {
+		return nil, nil
+	}
+	return x.db.SearchChunks(q, limit, f)
+}
+
+// Retrieve returns the passages most relevant to message for adding to
+// the prompt.
+func (x *Index) Retrieve(message string) ([]store.Chunk, error) {
+	return x.Search(message, 3, store.DocumentFilter{})
+}
+
+// Context formats retrieved passages as a prompt section. Passages are
+// numbered so the model can cite them inline as [1], [2] and so on.
+func Context(chunks []store.Chunk) string {
+	if len(chunks) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("Possibly relevant passages from the user's saved documents (ignore them if they do not help). " +
+		"When you use a passage, cite it inline with its number in square brackets, e.g. [1].")
+	for i, c := range chunks {
+		fmt.Fprintf(&b, "\n\n[%d] %s, saved %s (%s)\n%s", i+1, c.Document.Title,
+			c.Document.CreatedAt.Local().Format("Jan 2 2006"), c.Document.Source, c.Text)
+	}
+	return b.String()
+}
+
+var markerRe = regexp.MustCompile(`\[(\d+)\]`)
+
+// Cite returns the citations for the markers used in reply, in order of
+// marker number. Markers that do not refer to a passage are ignored.
+func Cite(reply string, chunks []store.Chunk) []store.Citation {
+	used := make(map[int]bool)
+	for _, m := range markerRe.FindAllStringSubmatch(reply, -1) {
+		n, _ := strconv.Atoi(m[1])
+		if n >= 1 && n <= len(chunks) {
+			used[n] = true
+		}
+	}
+	var citations []store.Citation
+	for i, c := range chunks {
+		if !used[i+1] {
+			continue
+		}
+		citations = append(citations, store.Citation{
+			Marker:     i + 1,
+			DocumentID: c.DocumentID,
+			ChunkID:    c.ID,
+			Source:     c.Document.Source,
+			Title:      c.Document.Title,
+			Score:      c.Score,
+		})
+	}
+	return citations
+}
+
+// Hash returns the content hash stored with a document.
+func Hash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// Chunk splits text into overlapping chunks, preferring paragraph and
+// sentence boundaries.
+func Chunk(text string) []string {
+	text = strings.TrimSpace(text)
+	var chunks []string
+	for len(text) > chunkSize {
+		cut := boundary(text[:chunkSize])
+		chunks = append(chunks, strings.TrimSpace(text[:cut]))
+		next := max(cut-chunkOverlap, 1)
+		// Start the overlap on a word boundary.
+		if i := strings.IndexFunc(text[next:cut], unicode.IsSpace); i >= 0 {
+			next += i
+		}
+		text = strings.TrimSpace(text[next:])
+	}
+	if text != "" {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
+
+// boundary returns the best place to end a chunk within s.
+func boundary(s string) int {
+	for _, sep := range []string{"\n\n", ". ", "\n", " "} {
+		if i := strings.LastIndex(s, sep); i > len(s)/2 {
+			return i + len(sep)
+		}
+	}
+	return len(s)
+}
+
+var stopWords = map[string]bool{
+	"a": true, "about": true, "an": true, "and": true, "are": true, "as": true,
+	"at": true, "be": true, "by": true, "can": true, "did": true, "do": true,
+	"does": true, "for": true, "from": true, "had": true, "has": true,
+	"have": true, "how": true, "i": true, "in": true, "is": true, "it": true,
+	"me": true, "my": true, "of": true, "on": true, "or": true, "that": true,
+	"the": true, "this": true, "to": true, "was": true, "we": true,
+	"what": true, "when": true, "where": true, "which": true, "who": true,
+	"why": true, "with": true, "you": true, "your": true,
+}
+
+// maxQueryTerms bounds the number of terms in a generated query.
+const maxQueryTerms = 12
+
+// Query turns free text into an FTS query matching any of its significant
+// words.
+func Query(text string) string {
+	var terms []string
+	seen := make(map[string]bool)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		if len(w) < 2 || stopWords[w] || seen[w] {
+			continue
+		}
+		seen[w] = true
+		terms = append(terms, `"`+w+`"`)
+		if len(terms) == maxQueryTerms {
+			break
+		}
+	}
+	return strings.Join(terms, " OR ")
+}
+
+// ParseDate parses a YYYY-MM-DD date in local time. An empty string yields
+// the zero time.
+func ParseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, want YYYY-MM-DD", s)
+	}
+	return t, nil
+}
@@ -0,0 +1,94 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// EnableOCR makes the watcher ingest images and scanned PDFs by running
+// tesseract locally. lang is a tesseract language list such as "eng" or
+// "eng+deu". PDFs with a text layer are read with pdftotext when it is
+// installed; pages without one are rendered with pdftoppm and OCRed.
+func (w *Watcher) EnableOCR(lang string) error {
+	if _, err := exec.LookPath("tesseract"); err != nil {
+		return fmt.Errorf("OCR needs tesseract: %w", err)
+	}
+	if lang == "" {
+		lang = "eng"
+	}
+	ocr := func(ctx context.Context, path string) (string, string, error) {
+		text, err := tesseract(ctx, path, lang)
+		return "", text, err
+	}
+	for _, ext := range []string{".png", ".jpg", ".jpeg", ".tif", ".tiff", ".webp"} {
+		w.extractors[ext] = ocr
+	}
+	if _, err := exec.LookPath("pdftotext"); err == nil {
+		w.extractors[".pdf"] = func(ctx context.Context, path string) (string, string, error) {
+			text, err := readPDF(ctx, path, lang)
+			return "", text, err
+		}
+	}
+	return nil
+}
+
+func tesseract(ctx context.Context, path, lang string) (string, error) {
+	out, err := command(ctx, "tesseract", path, "stdout", "-l", lang)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// readPDF returns the PDF's text layer, falling back to OCR of the
+// rendered pages for scans.
+func readPDF(ctx context.Context, path, lang string) (string, error) {
+	out, err := command(ctx, "pdftotext", "-layout", path, "-")
+	if err != nil {
+		return "", err
+	}
+	if text := string(out); strings.TrimSpace(text) != "" {
+		return text, nil
+	}
+	if _, err := exec.LookPath("pdftoppm"); err != nil {
+		return "", fmt.Errorf("no text layer, and pdftoppm is not installed to OCR it")
+	}
+
+	dir, err := os.MkdirTemp("", "pi-agent-ocr")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	if _, err := command(ctx, "pdftoppm", "-r", "300", "-png", path, filepath.Join(dir, "page")); err != nil {
+		return "", err
+	}
+	pages, _ := filepath.Glob(filepath.Join(dir, "page*.png"))
+	sort.Strings(pages)
+	var b strings.Builder
+	for _, page := range pages {
+		text, err := tesseract(ctx, page, lang)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(text)
+		b.WriteString("\n\n")
+	}
+	return b.String(), nil
+}
+
+func command(ctx context.Context, name string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
@@ -0,0 +1,290 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"pi-agent/internal/store"
+)
+
+// FileKind is the document kind of files ingested from watched directories.
+const FileKind = "file"
+
+// maxFileBytes is the largest file the watcher ingests.
+const maxFileBytes = 10 << 20
+
+// extractor returns the title and text of a file.
+type extractor func(ctx context.Context, path string) (title, text string, err error)
+
+var extractors = map[string]extractor{
+	".txt":  readText,
+	".md":   readText,
+	".org":  readText,
+	".csv":  readText,
+	".json": readText,
+	".html": readHTML,
+	".htm":  readHTML,
+}
+
+func readText(_ context.Context, path string) (string, string, error) {
+	data, err := os.ReadFile(path)
+	return "", string(data), err
+}
+
+func readHTML(_ context.Context, path string) (string, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+	title, text := ExtractHTML(string(data))
+	return title, text, nil
+}
+
+// WatchStatus describes the watcher's progress.
+type WatchStatus struct {
+	Dirs         []string  `json:"dirs"`
+	Indexing     bool      `json:"indexing"`
+	Files        int       `json:"files"`   // supported files found in the last scan
+	Indexed      int       `json:"indexed"` // files (re)indexed in the last scan
+	Removed      int       `json:"removed"` // documents dropped because their file is gone
+	Failed       int       `json:"failed"`  // files that could not be ingested
+	LastScanAt   time.Time `json:"last_scan_at,omitzero"`
+	LastDuration string    `json:"last_duration,omitempty"`
+	LastError    string    `json:"last_error,omitempty"`
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// Watcher polls directories and keeps the index in step with their files.
+// Polling avoids platform-specific notification APIs and copes with sync
+// tools such as Syncthing that replace files wholesale.
+type Watcher struct {
+	index    *Index
+	db       *store.DB
+	dirs     []string
+	interval time.Duration
+
+	extractors map[string]extractor
+	throttles  []func(ctx context.Context) error
+	due        func() bool // optional; see SetPace
+
+	mu     sync.Mutex
+	seen   map[string]fileState
+	status WatchStatus
+}
+
+// NewWatcher creates a watcher for dirs, scanning every interval.
+func NewWatcher(index *Index, db *store.DB, dirs []string, interval time.Duration) *Watcher {
+	w := &Watcher{
+		index:      index,
+		db:         db,
+		dirs:       dirs,
+		interval:   interval,
+		extractors: make(map[string]extractor, len(extractors)),
+		seen:       make(map[string]fileState),
+		status:     WatchStatus{Dirs: dirs},
+	}
+	for ext, fn := range extractors {
+		w.extractors[ext] = fn
+	}
+	return w
+}
+
+// SetPace makes the watcher ask due on each tick whether to rescan, so
+// rescans can slow down, e.g. while the agent is idle.
+func (w *Watcher) SetPace(due func() bool) {
+	w.due = due
+}
+
+// AddThrottle makes the watcher call wait before ingesting each file, so
+// indexing can be held back, e.g. while the CPU is hot. The scan stops if
+// wait returns an error.
+func (w *Watcher) AddThrottle(wait func(ctx context.Context) error) {
+	w.throttles = append(w.throttles, wait)
+}
+
+// Run scans immediately and then every interval until ctx is cancelled.
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	w.Scan(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if w.due == nil || w.due() {
+				w.Scan(ctx)
+			}
+		}
+	}
+}
+
+// Status returns the current indexing status.
+func (w *Watcher) Status() WatchStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status
+}
+
+// Scan walks the watched directories once, ingesting new and modified
+// files and dropping documents whose files were deleted.
+func (w *Watcher) Scan(ctx context.Context) {
+	start := time.Now()
+	w.mu.Lock()
+	w.status.Indexing = true
+	w.mu.Unlock()
+
+	st := WatchStatus{Dirs: w.dirs}
+	present := make(map[string]bool)
+	var lastErr error
+	for _, dir := range w.dirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if strings.HasPrefix(d.Name(), ".") && path != dir {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+			extract, ok := w.extractors[strings.ToLower(filepath.Ext(path))]
+			if !ok {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil || info.Size() > maxFileBytes {
+				return nil
+			}
+			st.Files++
+			present[path] = true
+
+			state := fileState{modTime: info.ModTime(), size: info.Size()}
+			w.mu.Lock()
+			prev, known := w.seen[path]
+			w.mu.Unlock()
+			if known && prev == state {
+				return nil
+			}
+			// After a restart, trust documents indexed since the file was
+			// last modified rather than extracting (possibly OCRing) again.
+			if !known {
+				if doc, err := w.db.DocumentBySource(path); err == nil && !doc.UpdatedAt.Before(state.modTime) {
+					w.mu.Lock()
+					w.seen[path] = state
+					w.mu.Unlock()
+					return nil
+				}
+			}
+			for _, wait := range w.throttles {
+				if err := wait(ctx); err != nil {
+					return err
+				}
+			}
+			if err := w.ingest(ctx, path, extract); err != nil {
+				log.Printf("rag: %s: %v", path, err)
+				st.Failed++
+				lastErr = err
+				return nil
+			}
+			st.Indexed++
+			w.mu.Lock()
+			w.seen[path] = state
+			w.mu.Unlock()
+			return nil
+		})
+		if err != nil {
+			log.Printf("rag: scanning %s: %v", dir, err)
+			lastErr = err
+		}
+	}
+
+	// Only prune after a complete walk, so an unmounted or unreadable
+	// directory does not wipe its documents.
+	if lastErr == nil {
+		removed, err := w.prune(present)
+		if err != nil {
+			lastErr = err
+		}
+		st.Removed = removed
+	}
+
+	st.LastScanAt = start
+	st.LastDuration = time.Since(start).Round(time.Millisecond).String()
+	if lastErr != nil {
+		st.LastError = lastErr.Error()
+	}
+	w.mu.Lock()
+	w.status = st
+	w.mu.Unlock()
+}
+
+func (w *Watcher) ingest(ctx context.Context, path string, extract extractor) error {
+	title, text, err := extract(ctx, path)
+	if err != nil {
+		return err
+	}
+	if title == "" {
+		title = filepath.Base(path)
+	}
+	if strings.TrimSpace(text) == "" {
+		return fmt.Errorf("no text extracted")
+	}
+	res, err := w.index.Add(FileKind, path, title, "", text)
+	if err != nil {
+		return err
+	}
+	if !res.Unchanged {
+		log.Printf("rag: indexed %s (%d chunks added, %d reused, %d removed)", path, res.Added, res.Reused, res.Removed)
+	}
+	return nil
+}
+
+// prune deletes file documents under the watched directories that no
+// longer exist.
+func (w *Watcher) prune(present map[string]bool) (int, error) {
+	docs, err := w.db.Documents(FileKind)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, doc := range docs {
+		if present[doc.Source] || !w.watches(doc.Source) {
+			continue
+		}
+		if err := w.db.DeleteDocument(doc.ID); err != nil {
+			return removed, err
+		}
+		w.mu.Lock()
+		delete(w.seen, doc.Source)
+		w.mu.Unlock()
+		removed++
+	}
+	return removed, nil
+}
+
+func (w *Watcher) watches(path string) bool {
+	for _, dir := range w.dirs {
+		if rel, err := filepath.Rel(dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package recipe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxPageBytes bounds how much of a recipe page is read.
+const maxPageBytes = 5 << 20
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+var ldJSONRe = regexp.MustCompile(`(?is)<script[^>]+type=["']?application/ld\+json["']?[^>]*>(.*?)</script>`)
+
+// Fetch downloads a recipe page and reads the schema.org Recipe in its
+// JSON-LD markup, which most recipe sites publish for search engines.
+func Fetch(ctx context.Context, url string) (*Recipe, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "pi-agent")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPageBytes))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", url, err)
+	}
+	for _, m := range ldJSONRe.FindAllSubmatch(body, -1) {
+		var v any
+		if json.Unmarshal(m[1], &v) != nil {
+			continue
+		}
+		if r := findRecipe(v); r != nil && len(r.Steps) > 0 {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("%s has no recipe markup; pass the ingredients and steps instead", url)
+}
+
+// findRecipe looks for a Recipe object in decoded JSON-LD, which may be
+// the object itself, an array of objects, or an object with an @graph.
+func findRecipe(v any) *Recipe {
+	switch v := v.(type) {
+	case []any:
+		for _, e := range v {
+			if r := findRecipe(e); r != nil {
+				return r
+			}
+		}
+	case map[string]any:
+		if isType(v["@type"], "Recipe") {
+			return parseRecipe(v)
+		}
+		if g, ok := v["@graph"]; ok {
+			return findRecipe(g)
+		}
+	}
+	return nil
+}
+
+func isType(t any, want string) bool {
+	switch t := t.(type) {
+	case string:
+		return t == want
+	case []any:
+		for _, e := range t {
+			if s, _ := e.(string); s == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func parseRecipe(v map[string]any) *Recipe {
+	r := &Recipe{Title: text(v["name"])}
+	switch y := v["recipeYield"].(type) {
+	case []any:
+		if len(y) > 0 {
+			r.Servings = text(y[0])
+		}
+	default:
+		r.Servings = text(y)
+	}
+	if list, ok := v["recipeIngredient"].([]any); ok {
+		for _, in := range list {
+			if s := text(in); s != "" {
+				r.Ingredients = append(r.Ingredients, s)
+			}
+		}
+	}
+	r.Steps = steps(v["recipeInstructions"])
+	return r
+}
+
+// steps flattens recipeInstructions, which sites give as one string, a
+// list of strings, HowToStep objects, or HowToSections of those.
+func steps(v any) []string {
+	var out []string
+	switch v := v.(type) {
+	case string:
+		for line := range strings.SplitSeq(html.UnescapeString(v), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				out = append(out, line)
+			}
+		}
+	case []any:
+		for _, e := range v {
+			out = append(out, steps(e)...)
+		}
+	case map[string]any:
+		if items, ok := v["itemListElement"]; ok {
+			return steps(items)
+		}
+		if s := text(v["text"]); s != "" {
+			out = append(out, s)
+		} else if s := text(v["name"]); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+var tagRe = regexp.MustCompile(`(?s)<[^>]*>`)
+
+// text returns a JSON-LD value as plain text.
+func text(v any) string {
+	switch v := v.(type) {
+	case string:
+		s := html.UnescapeString(tagRe.ReplaceAllString(v, " "))
+		return strings.Join(strings.Fields(s), " ")
+	case float64:
+		return fmt.Sprint(v)
+	}
+	return ""
+}
@@ -0,0 +1,349 @@
+// Package recipe runs cooking sessions: a recipe is loaded into a
+// conversation as structured state, so stepping through it, repeating a
+// step and looking up ingredient amounts can be answered without the
+// model, and timers are started for steps that say how long to wait.
+package recipe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pi-agent/internal/timer"
+	"pi-agent/internal/tools"
+)
+
+// ErrNoRecipe is returned when the conversation has no recipe loaded.
+var ErrNoRecipe = errors.New("no recipe is in progress")
+
+// Recipe is a parsed recipe.
+type Recipe struct {
+	Title       string   `json:"title"`
+	Servings    string   `json:"servings,omitempty"`
+	Ingredients []string `json:"ingredients"` // as written, e.g. "2 cups flour"
+	Steps       []string `json:"steps"`
+}
+
+// session is a recipe being cooked in a conversation.
+type session struct {
+	recipe *Recipe
+	step   int          // index into recipe.Steps
+	timed  map[int]bool // steps whose timers have been started
+}
+
+// Manager keeps one recipe session per conversation. Sessions are held in
+// memory and end with a restart.
+type Manager struct {
+	timers *timer.Manager // optional
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// New returns a manager that starts step timers with timers, which may be
+// nil.
+func New(timers *timer.Manager) *Manager {
+	return &Manager{timers: timers, sessions: make(map[string]*session)}
+}
+
+// Start loads a recipe into a conversation, replacing any in progress,
+// and returns an introduction followed by the first step.
+func (m *Manager) Start(conv string, r *Recipe) (string, error) {
+	if len(r.Steps) == 0 {
+		return "", errors.New("the recipe has no steps")
+	}
+	s := &session{recipe: r, timed: make(map[int]bool)}
+	m.mu.Lock()
+	m.sessions[conv] = s
+	m.mu.Unlock()
+
+	intro := fmt.Sprintf("Let's make %s. There are %d steps", r.Title, len(r.Steps))
+	if len(r.Ingredients) > 0 {
+		intro += fmt.Sprintf(" and %d ingredients", len(r.Ingredients))
+	}
+	return intro + ". " + m.say(conv, s), nil
+}
+
+// Active reports whether the conversation has a recipe in progress.
+func (m *Manager) Active(conv string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sessions[conv] != nil
+}
+
+// Stop ends the conversation's recipe session.
+func (m *Manager) Stop(conv string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sessions[conv] == nil {
+		return ErrNoRecipe
+	}
+	delete(m.sessions, conv)
+	return nil
+}
+
+// Next moves to the next step and returns it.
+func (m *Manager) Next(conv string) (string, error) {
+	return m.move(conv, func(s *session) (string, bool) {
+		if s.step == len(s.recipe.Steps)-1 {
+			return "That was the last step. Enjoy your " + s.recipe.Title + "!", false
+		}
+		s.step++
+		return "", true
+	})
+}
+
+// Previous moves back a step and returns it.
+func (m *Manager) Previous(conv string) (string, error) {
+	return m.move(conv, func(s *session) (string, bool) {
+		if s.step == 0 {
+			return "This is the first step. " + describe(s), false
+		}
+		s.step--
+		return "", true
+	})
+}
+
+// Repeat returns the current step again.
+func (m *Manager) Repeat(conv string) (string, error) {
+	return m.move(conv, func(s *session) (string, bool) { return describe(s), false })
+}
+
+// Goto moves to step n, counting from 1, and returns it.
+func (m *Manager) Goto(conv string, n int) (string, error) {
+	return m.move(conv, func(s *session) (string, bool) {
+		if n < 1 || n > len(s.recipe.Steps) {
+			return fmt.Sprintf("There are only %d steps.", len(s.recipe.Steps)), false
+		}
+		s.step = n - 1
+		return "", true
+	})
+}
+
+// move applies f to the conversation's session. If f reports that the
+// step changed, the new step is announced, starting its timer.
+func (m *Manager) move(conv string, f func(*session) (string, bool)) (string, error) {
+	m.mu.Lock()
+	s := m.sessions[conv]
+	if s == nil {
+		m.mu.Unlock()
+		return "", ErrNoRecipe
+	}
+	reply, moved := f(s)
+	m.mu.Unlock()
+	if moved {
+		return m.say(conv, s), nil
+	}
+	return reply, nil
+}
+
+// say describes the session's current step and, the first time the step
+// is reached, starts a timer for any wait it mentions.
+func (m *Manager) say(conv string, s *session) string {
+	m.mu.Lock()
+	step, text := s.step, describe(s)
+	start := m.timers != nil && !s.timed[step]
+	s.timed[step] = true
+	m.mu.Unlock()
+	if !start {
+		return text
+	}
+	if d, ok := Duration(s.recipe.Steps[step]); ok {
+		tm := m.timers.Start(conv, fmt.Sprintf("%s, step %d", s.recipe.Title, step+1), d)
+		text += fmt.Sprintf(" I've set a timer for %s.", tm.Duration)
+	}
+	return text
+}
+
+func describe(s *session) string {
+	n := len(s.recipe.Steps)
+	if s.step == n-1 {
+		return fmt.Sprintf("Last step: %s", s.recipe.Steps[s.step])
+	}
+	return fmt.Sprintf("Step %d of %d: %s", s.step+1, n, s.recipe.Steps[s.step])
+}
+
+// Ingredient answers "how much" of something the recipe uses, with the
+// ingredient lines that mention it.
+func (m *Manager) Ingredient(conv, what string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.sessions[conv]
+	if s == nil {
+		return "", ErrNoRecipe
+	}
+	what = strings.TrimSpace(strings.TrimPrefix(strings.ToLower(what), "the "))
+	var found []string
+	for _, line := range s.recipe.Ingredients {
+		if mentions(line, what) {
+			found = append(found, line)
+		}
+	}
+	if len(found) == 0 {
+		return fmt.Sprintf("The recipe doesn't list %s.", what), nil
+	}
+	return "You need " + strings.Join(found, ", and ") + ".", nil
+}
+
+// mentions reports whether an ingredient line names what, allowing for a
+// plural on either side ("egg" finds "2 eggs").
+func mentions(line, what string) bool {
+	line = strings.ToLower(line)
+	for _, w := range []string{what, strings.TrimSuffix(what, "s"), strings.TrimSuffix(what, "es")} {
+		if w != "" && regexp.MustCompile(`\b`+regexp.QuoteMeta(w)+`(?:e?s)?\b`).MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// Ingredients lists everything the recipe needs.
+func (m *Manager) Ingredients(conv string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.sessions[conv]
+	if s == nil {
+		return "", ErrNoRecipe
+	}
+	if len(s.recipe.Ingredients) == 0 {
+		return "The recipe doesn't list its ingredients.", nil
+	}
+	return "You need " + strings.Join(s.recipe.Ingredients, ", ") + ".", nil
+}
+
+var durationRe = regexp.MustCompile(`(?i)\b(\d+)(?:\s*(?:-|–|to)\s*\d+)?\s*(hours?|hrs?|minutes?|mins?|seconds?|secs?)\b`)
+
+// Duration finds how long a step says to wait, e.g. "bake for 25-30
+// minutes" is 25 minutes, taking the low end of a range so the cook can
+// check early. Adjacent amounts add up: "1 hour 15 minutes".
+func Duration(step string) (time.Duration, bool) {
+	ms := durationRe.FindAllStringSubmatchIndex(step, -1)
+	var total time.Duration
+	end := -1
+	for _, m := range ms {
+		if end >= 0 && strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(step[end:m[0]]), "and")) != "" {
+			break
+		}
+		n, _ := strconv.Atoi(step[m[2]:m[3]])
+		unit := strings.ToLower(step[m[4]:m[5]])
+		switch unit[0] {
+		case 'h':
+			total += time.Duration(n) * time.Hour
+		case 'm':
+			total += time.Duration(n) * time.Minute
+		case 's':
+			total += time.Duration(n) * time.Second
+		}
+		end = m[1]
+	}
+	return total, total > 0
+}
+
+// Tools returns the tools for starting and navigating recipes.
+func (m *Manager) Tools() []tools.Tool {
+	return []tools.Tool{
+		tools.New("start_recipe",
+			"Start cooking a recipe step by step. Give a recipe page URL, or the recipe itself with its ingredient lines and steps. Steps that mention a wait start a timer.",
+			`{"type":"object","properties":{
+				"url":{"type":"string","description":"A recipe page with schema.org markup"},
+				"title":{"type":"string"},
+				"servings":{"type":"string"},
+				"ingredients":{"type":"array","items":{"type":"string"},"description":"Ingredient lines with amounts, e.g. 2 cups flour"},
+				"steps":{"type":"array","items":{"type":"string"}}
+			}}`,
+			m.startTool),
+		tools.New("recipe_step",
+			"Move through the recipe in progress: next, previous, repeat, or goto a step; or show the whole recipe.",
+			`{"type":"object","properties":{
+				"action":{"type":"string","enum":["next","previous","repeat","goto","show"]},
+				"step":{"type":"integer","minimum":1,"description":"For goto"}
+			},"required":["action"]}`,
+			m.stepTool),
+		tools.New("stop_recipe", "End the recipe in progress.", tools.NoParams,
+			func(ctx context.Context, _ json.RawMessage) (string, error) {
+				if err := m.Stop(tools.ConversationID(ctx)); err != nil {
+					return "", err
+				}
+				return "Recipe ended.", nil
+			}),
+	}
+}
+
+func (m *Manager) startTool(ctx context.Context, args json.RawMessage) (string, error) {
+	var p struct {
+		URL string `json:"url"`
+		Recipe
+	}
+	if err := tools.Decode(args, &p); err != nil {
+		return "", err
+	}
+	r := &p.Recipe
+	if p.URL != "" {
+		var err error
+		if r, err = Fetch(ctx, p.URL); err != nil {
+			return "", err
+		}
+	}
+	if r.Title == "" {
+		r.Title = "the recipe"
+	}
+	return m.Start(tools.ConversationID(ctx), r)
+}
+
+func (m *Manager) stepTool(ctx context.Context, args json.RawMessage) (string, error) {
+	var p struct {
+		Action string `json:"action"`
+		Step   int    `json:"step"`
+	}
+	if err := tools.Decode(args, &p); err != nil {
+		return "", err
+	}
+	conv := tools.ConversationID(ctx)
+	switch p.Action {
+	case "next":
+		return m.Next(conv)
+	case "previous":
+		return m.Previous(conv)
+	case "repeat":
+		return m.Repeat(conv)
+	case "goto":
+		return m.Goto(conv, p.Step)
+	case "show":
+		return m.Show(conv)
+	}
+	return "", fmt.Errorf("unknown action %q", p.Action)
+}
+
+// Show returns the whole recipe, marking the current step.
+func (m *Manager) Show(conv string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.sessions[conv]
+	if s == nil {
+		return "", ErrNoRecipe
+	}
+	var b strings.Builder
+	b.WriteString(s.recipe.Title + "\n")
+	if s.recipe.Servings != "" {
+		b.WriteString("Serves " + s.recipe.Servings + "\n")
+	}
+	b.WriteString("\nIngredients:\n")
+	for _, in := range s.recipe.Ingredients {
+		b.WriteString("- " + in + "\n")
+	}
+	b.WriteString("\nSteps:\n")
+	for i, step := range s.recipe.Steps {
+		mark := ""
+		if i == s.step {
+			mark = " (current)"
+		}
+		fmt.Fprintf(&b, "%d.%s %s\n", i+1, mark, step)
+	}
+	return b.String(), nil
+}
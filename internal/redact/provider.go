@@ -0,0 +1,93 @@
+package redact
+
+import (
+	"context"
+	"strings"
+
+	"pi-agent/internal/chat"
+)
+
+// note tells the model what the placeholders are.
+const note = "Some values in this conversation have been replaced with placeholders such as [REDACTED_PASSWORD_1] to keep them private. Use the placeholder wherever the value is needed; it is filled in before your reply is shown or a tool runs."
+
+// Provider returns a provider that redacts the messages, tool calls and
+// tool outputs of each request before passing it to p, and restores the
+// placeholders in the streamed reply and tool call arguments.
+func (r *Redactor) Provider(p chat.Provider) chat.Provider {
+	return provider{inner: p, r: r}
+}
+
+type provider struct {
+	inner chat.Provider
+	r     *Redactor
+}
+
+// Authorize passes through to the wrapped provider.
+func (p provider) Authorize(ctx context.Context) error {
+	if a, ok := p.inner.(chat.Authorizer); ok {
+		return a.Authorize(ctx)
+	}
+	return nil
+}
+
+// Stream implements chat.Provider.
+func (p provider) Stream(ctx context.Context, req chat.Request) (<-chan chat.StreamDelta, <-chan error) {
+	m := NewMapping()
+	messages := make([]chat.Message, len(req.Messages))
+	for i, msg := range req.Messages {
+		msg.Content = p.r.Redact(m, msg.Content)
+		msg.Arguments = p.r.Redact(m, msg.Arguments)
+		msg.Output = p.r.Redact(m, msg.Output)
+		messages[i] = msg
+	}
+	req.Messages = messages
+	if m.Len() == 0 {
+		return p.inner.Stream(ctx, req)
+	}
+	req.Instructions = strings.TrimSpace(req.Instructions + "\n\n" + note)
+
+	inner, innerErr := p.inner.Stream(ctx, req)
+	deltaCh := make(chan chat.StreamDelta, 64)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(deltaCh)
+		defer close(errCh)
+		// A placeholder can be split across deltas, so the end of the
+		// content from a "[" on is held back until it is complete.
+		var held string
+		flush := func() {
+			if held != "" {
+				deltaCh <- chat.StreamDelta{Content: m.Restore(held)}
+				held = ""
+			}
+		}
+		for delta := range inner {
+			if delta.Content == "" {
+				flush()
+				if delta.ToolCall != nil {
+					call := *delta.ToolCall
+					call.Arguments = m.RestoreJSON(call.Arguments)
+					delta.ToolCall = &call
+				}
+				deltaCh <- delta
+				continue
+			}
+			held += delta.Content
+			cut := len(held)
+			if i := strings.LastIndexByte(held, '['); i >= 0 && !strings.Contains(held[i:], "]") && len(held)-i < maxPlaceholder {
+				cut = i
+			}
+			if cut > 0 {
+				out := delta
+				out.Content = m.Restore(held[:cut])
+				held = held[cut:]
+				deltaCh <- out
+			}
+		}
+		flush()
+		if err := <-innerErr; err != nil {
+			errCh <- err
+		}
+	}()
+	return deltaCh, errCh
+}
@@ -0,0 +1,226 @@
+// Package redact keeps secrets out of requests to cloud models. Values
+// that look like API keys, passwords or card numbers are replaced with
+// placeholders such as [REDACTED_PASSWORD_1] before a request is sent,
+// and the placeholders in the reply are filled back in locally, so the
+// model can refer to a secret, or pass it to a tool, without seeing it.
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"pi-agent/internal/config"
+)
+
+// rule finds one kind of secret.
+type rule struct {
+	kind  string // placeholder label, e.g. "API_KEY"
+	re    *regexp.Regexp
+	check func(string) bool // optional; confirms a match
+}
+
+// builtins are the rules used unless config.Redaction.NoBuiltins is set.
+var builtins = []rule{
+	{kind: "PRIVATE_KEY", re: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{kind: "API_KEY", re: regexp.MustCompile(`\b(?:sk-[A-Za-z0-9_-]{20,}|gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,}|AKIA[0-9A-Z]{16}|xox[abprs]-[A-Za-z0-9-]{10,}|AIza[0-9A-Za-z_-]{35}|glpat-[A-Za-z0-9_-]{20,})`)},
+	{kind: "TOKEN", re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{kind: "PASSWORD", re: regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|passphrase|passcode|secret|token|api[_ -]?key)["']?\s*[:=]\s*(?:"([^"\n]+)"|'([^'\n]+)'|([^\s"',;]+))`)},
+	{kind: "PASSWORD", re: regexp.MustCompile(`(?i)\b(?:password|passphrase|passcode|pin)\s+(?:is|was)\s+["']?([^\s"',;]+?)["']?(?:[.!?]?(?:\s|$))`)},
+	{kind: "CARD_NUMBER", re: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), check: luhn},
+}
+
+// tokenRe finds candidates for the entropy check.
+var tokenRe = regexp.MustCompile(`[A-Za-z0-9+_-]{24,}={0,2}`)
+
+// placeholderRe finds placeholders in replies.
+var placeholderRe = regexp.MustCompile(`\[REDACTED_[A-Z0-9_]+_\d+\]`)
+
+// maxPlaceholder bounds how much of a reply is held back in case it is
+// the start of a placeholder split across deltas.
+const maxPlaceholder = 64
+
+// Redactor replaces secrets according to a set of rules.
+type Redactor struct {
+	rules []rule
+}
+
+// New creates a redactor from its configuration.
+func New(c *config.Redaction) (*Redactor, error) {
+	var r Redactor
+	if !c.NoBuiltins {
+		r.rules = append(r.rules, builtins...)
+	}
+	for _, cr := range c.Rules {
+		re, err := regexp.Compile(cr.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redaction rule %s: %w", cr.Name, err)
+		}
+		r.rules = append(r.rules, rule{kind: strings.ToUpper(cr.Name), re: re})
+	}
+	if c.Entropy >= 0 {
+		threshold := c.Entropy
+		if threshold == 0 {
+			threshold = config.DefaultRedactionEntropy
+		}
+		r.rules = append(r.rules, rule{kind: "SECRET", re: tokenRe, check: func(s string) bool {
+			return mixed(s) && entropy(s) >= threshold
+		}})
+	}
+	return &r, nil
+}
+
+// Mapping holds the placeholders given out while redacting a request and
+// the values they stand for. It never leaves the process.
+type Mapping struct {
+	values  map[string]string // placeholder to value
+	assoc   map[string]string // value to placeholder
+	counter map[string]int
+}
+
+// NewMapping returns an empty mapping.
+func NewMapping() *Mapping {
+	return &Mapping{values: make(map[string]string), assoc: make(map[string]string), counter: make(map[string]int)}
+}
+
+// Len returns the number of secrets redacted.
+func (m *Mapping) Len() int { return len(m.values) }
+
+func (m *Mapping) placeholder(kind, value string) string {
+	if p, ok := m.assoc[value]; ok {
+		return p
+	}
+	m.counter[kind]++
+	p := fmt.Sprintf("[REDACTED_%s_%d]", kind, m.counter[kind])
+	m.values[p] = value
+	m.assoc[value] = p
+	return p
+}
+
+// Redact replaces the secrets in s with placeholders recorded in m. The
+// same value always gets the same placeholder.
+func (r *Redactor) Redact(m *Mapping, s string) string {
+	for _, rl := range r.rules {
+		s = rl.replace(s, func(v string) string { return m.placeholder(rl.kind, v) })
+	}
+	return s
+}
+
+// replace calls f for each match in s, or the first of its groups that
+// matched if the pattern has any, and puts the result in its place.
+func (rl rule) replace(s string, f func(string) string) string {
+	var b strings.Builder
+	last, changed := 0, false
+	for _, loc := range rl.re.FindAllStringSubmatchIndex(s, -1) {
+		start, end := loc[0], loc[1]
+		for g := 2; g+1 < len(loc); g += 2 {
+			if loc[g] >= 0 {
+				start, end = loc[g], loc[g+1]
+				break
+			}
+		}
+		v := s[start:end]
+		if v == "" || placeholderRe.MatchString(v) || rl.check != nil && !rl.check(v) {
+			continue
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(f(v))
+		last, changed = end, true
+	}
+	if !changed {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// Restore fills the placeholders in s back in. Placeholders m did not
+// give out are left as they are.
+func (m *Mapping) Restore(s string) string {
+	if m.Len() == 0 {
+		return s
+	}
+	return placeholderRe.ReplaceAllStringFunc(s, func(p string) string {
+		if v, ok := m.values[p]; ok {
+			return v
+		}
+		return p
+	})
+}
+
+// RestoreJSON is like Restore for JSON text such as tool call arguments,
+// escaping the values for use inside JSON strings.
+func (m *Mapping) RestoreJSON(s string) string {
+	if m.Len() == 0 {
+		return s
+	}
+	return placeholderRe.ReplaceAllStringFunc(s, func(p string) string {
+		v, ok := m.values[p]
+		if !ok {
+			return p
+		}
+		quoted, _ := json.Marshal(v)
+		return string(quoted[1 : len(quoted)-1])
+	})
+}
+
+// luhn reports whether the digits of s pass the Luhn checksum that card
+// numbers carry.
+func luhn(s string) bool {
+	var digits []int
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			digits = append(digits, int(c-'0'))
+		}
+	}
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := range digits {
+		d := digits[len(digits)-1-i]
+		if i%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// mixed reports whether s has upper and lower case letters and digits,
+// as generated keys do and words, hex hashes and slugs mostly do not.
+func mixed(s string) bool {
+	var upper, lower, digit bool
+	for _, c := range s {
+		switch {
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsDigit(c):
+			digit = true
+		}
+	}
+	return upper && lower && digit
+}
+
+// entropy returns the Shannon entropy of s in bits per character.
+func entropy(s string) float64 {
+	counts := make(map[rune]int)
+	n := 0
+	for _, c := range s {
+		counts[c]++
+		n++
+	}
+	var h float64
+	for _, k := range counts {
+		p := float64(k) / float64(n)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
@@ -0,0 +1,153 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"pi-agent/internal/homeassistant"
+	"pi-agent/internal/notify"
+	"pi-agent/internal/store"
+)
+
+// Operators lists the supported comparison operators.
+var Operators = []string{"<", "<=", ">", ">=", "==", "!="}
+
+// sensorDomains are the entity domains a rule may watch.
+var sensorDomains = []string{"sensor", "binary_sensor", "person", "device_tracker", "climate", "cover", "lock", "light", "switch"}
+
+// Engine evaluates stored rules against Home Assistant states and sends a
+// notification when a rule's condition becomes true.
+type Engine struct {
+	db       *store.DB
+	ha       *homeassistant.Client
+	notifier notify.Notifier
+	interval time.Duration
+}
+
+// NewEngine creates a rules engine evaluating every interval.
+func NewEngine(db *store.DB, ha *homeassistant.Client, n notify.Notifier, interval time.Duration) *Engine {
+	return &Engine{db: db, ha: ha, notifier: n, interval: interval}
+}
+
+// Run evaluates rules until ctx is cancelled.
+func (e *Engine) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		if err := e.evaluate(ctx); err != nil {
+			log.Printf("rules: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *Engine) evaluate(ctx context.Context) error {
+	rules, err := e.db.Rules()
+	if err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	states, err := e.ha.States(ctx)
+	if err != nil {
+		return err
+	}
+	byID := make(map[string]string, len(states))
+	for _, st := range states {
+		byID[st.EntityID] = st.State
+	}
+
+	for _, r := range rules {
+		if !r.Enabled {
+			continue
+		}
+		value, ok := byID[r.EntityID]
+		if !ok || value == "unavailable" || value == "unknown" {
+			continue
+		}
+		active := Matches(r.Operator, value, r.Threshold)
+		if active == r.Active {
+			continue
+		}
+		var firedAt *time.Time
+		if active {
+			now := time.Now()
+			firedAt = &now
+			msg := notify.Message{Title: "Rule: " + r.Description, Body: fmt.Sprintf("%s (currently %s)", r.Message, value), Priority: notify.PriorityHigh}
+			if err := e.notifier.Notify(ctx, msg); err != nil {
+				log.Printf("rule %d notification failed: %v", r.ID, err)
+				continue // retry on the next evaluation
+			}
+		}
+		if err := e.db.SetRuleActive(r.ID, active, firedAt); err != nil {
+			log.Printf("rules: %v", err)
+		}
+	}
+	return nil
+}
+
+// Matches compares a state against a threshold. Both sides are compared
+// numerically when they parse as numbers, otherwise as case-insensitive
+// strings where only == and != are meaningful.
+func Matches(op, value, threshold string) bool {
+	v, err1 := strconv.ParseFloat(value, 64)
+	t, err2 := strconv.ParseFloat(threshold, 64)
+	if err1 == nil && err2 == nil {
+		switch op {
+		case "<":
+			return v < t
+		case "<=":
+			return v <= t
+		case ">":
+			return v > t
+		case ">=":
+			return v >= t
+		case "==":
+			return v == t
+		case "!=":
+			return v != t
+		}
+		return false
+	}
+	eq := strings.EqualFold(value, threshold)
+	switch op {
+	case "==":
+		return eq
+	case "!=":
+		return !eq
+	}
+	return false
+}
+
+// Validate checks a rule and resolves its entity, which may be given as a
+// friendly name, to an entity ID.
+func (e *Engine) Validate(ctx context.Context, r *store.Rule) error {
+	if strings.TrimSpace(r.Description) == "" {
+		return fmt.Errorf("description is required")
+	}
+	if !slices.Contains(Operators, r.Operator) {
+		return fmt.Errorf("operator must be one of %s", strings.Join(Operators, " "))
+	}
+	if strings.TrimSpace(r.Threshold) == "" {
+		return fmt.Errorf("threshold is required")
+	}
+	if r.Message == "" {
+		r.Message = r.Description
+	}
+	st, err := e.ha.FindEntity(ctx, r.EntityID, sensorDomains...)
+	if err != nil {
+		return err
+	}
+	r.EntityID = st.EntityID
+	return nil
+}
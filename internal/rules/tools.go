@@ -0,0 +1,87 @@
+package rules
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"pi-agent/internal/store"
+	"pi-agent/internal/tools"
+)
+
+// Tools returns model-facing tools for managing rules.
+func (e *Engine) Tools() []tools.Tool {
+	return []tools.Tool{
+		tools.New("create_rule",
+			"Create an automation rule that notifies the user when a sensor or entity meets a condition, "+
+				`e.g. "when the garage temperature drops below 5°C, warn me" becomes sensor "garage temperature", operator "<", threshold "5".`,
+			`{"type":"object","properties":{
+				"description":{"type":"string","description":"short summary of the rule"},
+				"sensor":{"type":"string","description":"entity ID or friendly name of the sensor to watch"},
+				"operator":{"type":"string","enum":["<","<=",">",">=","==","!="]},
+				"threshold":{"type":"string","description":"number, or a state such as on, off, home"},
+				"message":{"type":"string","description":"notification text when the rule fires"}
+			},"required":["description","sensor","operator","threshold","message"]}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var in struct {
+					Description string `json:"description"`
+					Sensor      string `json:"sensor"`
+					Operator    string `json:"operator"`
+					Threshold   string `json:"threshold"`
+					Message     string `json:"message"`
+				}
+				if err := tools.Decode(args, &in); err != nil {
+					return "", err
+				}
+				r := &store.Rule{
+					Description: in.Description,
+					EntityID:    in.Sensor,
+					Operator:    in.Operator,
+					Threshold:   in.Threshold,
+					Message:     in.Message,
+					Enabled:     true,
+				}
+				if err := e.Validate(ctx, r); err != nil {
+					return "", err
+				}
+				if err := e.db.AddRule(r); err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("Created rule %d: notify when %s %s %s.", r.ID, r.EntityID, r.Operator, r.Threshold), nil
+			}),
+		tools.New("list_rules", "List the automation rules.", tools.NoParams,
+			func(context.Context, json.RawMessage) (string, error) {
+				rules, err := e.db.Rules()
+				if err != nil {
+					return "", err
+				}
+				if len(rules) == 0 {
+					return "There are no rules.", nil
+				}
+				var b strings.Builder
+				for _, r := range rules {
+					status := "enabled"
+					if !r.Enabled {
+						status = "disabled"
+					}
+					fmt.Fprintf(&b, "%d: %s (%s %s %s, %s)\n", r.ID, r.Description, r.EntityID, r.Operator, r.Threshold, status)
+				}
+				return b.String(), nil
+			}),
+		tools.New("delete_rule", "Delete an automation rule by ID.",
+			`{"type":"object","properties":{"id":{"type":"integer"}},"required":["id"]}`,
+			func(_ context.Context, args json.RawMessage) (string, error) {
+				var in struct {
+					ID int64 `json:"id"`
+				}
+				if err := tools.Decode(args, &in); err != nil {
+					return "", err
+				}
+				if err := e.db.DeleteRule(in.ID); err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("Deleted rule %d.", in.ID), nil
+			}),
+	}
+}
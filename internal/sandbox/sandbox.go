@@ -0,0 +1,225 @@
+// Package sandbox runs short scripts written by the model, once approved,
+// in a confined working directory.
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"pi-agent/internal/approval"
+	"pi-agent/internal/store"
+	"pi-agent/internal/tools"
+)
+
+// Kind is the approval kind of code runs.
+const Kind = "run_code"
+
+// maxOutput caps the output kept from a run.
+const maxOutput = 64 << 10
+
+// interpreters maps languages to the command running a script file.
+var interpreters = map[string][]string{
+	"sh":         {"sh"},
+	"shell":      {"sh"},
+	"bash":       {"bash"},
+	"python":     {"python3"},
+	"python3":    {"python3"},
+	"py":         {"python3"},
+	"javascript": {"node"},
+	"js":         {"node"},
+	"node":       {"node"},
+}
+
+// Runner runs scripts in a working directory with a time limit and a
+// minimal environment. When bubblewrap (bwrap) is installed the script
+// also runs without network access and with the rest of the filesystem
+// read-only.
+type Runner struct {
+	dir     string
+	timeout time.Duration
+	bwrap   string
+}
+
+// NewRunner creates a runner using dir as the working directory.
+func NewRunner(dir string, timeout time.Duration) (*Runner, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	bwrap, _ := exec.LookPath("bwrap")
+	return &Runner{dir: dir, timeout: timeout, bwrap: bwrap}, nil
+}
+
+// Dir returns the runner's working directory.
+func (r *Runner) Dir() string { return r.dir }
+
+// Supported reports whether scripts in language can be run.
+func Supported(language string) bool {
+	_, ok := interpreters[strings.ToLower(language)]
+	return ok
+}
+
+// Result is the outcome of a run.
+type Result struct {
+	ExitCode  int           `json:"exit_code"`
+	Output    string        `json:"output"` // stdout and stderr, interleaved
+	Truncated bool          `json:"truncated,omitempty"`
+	TimedOut  bool          `json:"timed_out,omitempty"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// Run runs code as a script in language.
+func (r *Runner) Run(ctx context.Context, language, code string) (*Result, error) {
+	interp, ok := interpreters[strings.ToLower(language)]
+	if !ok {
+		return nil, fmt.Errorf("running %q code is not supported", language)
+	}
+	f, err := os.CreateTemp(r.dir, ".run-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(code); err != nil {
+		f.Close()
+		return nil, err
+	}
+	f.Close()
+
+	args := append(append([]string(nil), interp...), f.Name())
+	if r.bwrap != "" {
+		args = append([]string{r.bwrap,
+			"--ro-bind", "/", "/", "--dev", "/dev", "--proc", "/proc", "--tmpfs", "/tmp",
+			"--bind", r.dir, r.dir, "--chdir", r.dir,
+			"--unshare-all", "--die-with-parent", "--"}, args...)
+	}
+	return Exec(ctx, r.dir, r.timeout, []string{"HOME=" + r.dir}, args...)
+}
+
+// Exec runs a command in dir with a time limit, capped output and a
+// minimal environment, to which env is added and may override. Unlike Run
+// it does not confine the command's view of the filesystem.
+func Exec(ctx context.Context, dir string, timeout time.Duration, env []string, args ...string) (*Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Env = append([]string{"PATH=/usr/local/bin:/usr/bin:/bin", "LANG=C.UTF-8"}, env...)
+	// Run in its own process group so a timeout kills any children too.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error { return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL) }
+	var out limitedBuffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+
+	start := time.Now()
+	err := cmd.Run()
+	res := &Result{Output: out.buf.String(), Truncated: out.truncated, Duration: time.Since(start).Round(time.Millisecond)}
+	var exit *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		res.TimedOut, res.ExitCode = true, -1
+	case errors.As(err, &exit):
+		res.ExitCode = exit.ExitCode()
+	case err != nil:
+		return nil, err
+	}
+	return res, nil
+}
+
+// String formats the result for the model and the conversation.
+func (res *Result) String() string {
+	var b strings.Builder
+	switch {
+	case res.TimedOut:
+		fmt.Fprintf(&b, "Timed out after %s.", res.Duration)
+	default:
+		fmt.Fprintf(&b, "Exit code %d after %s.", res.ExitCode, res.Duration)
+	}
+	if res.Output != "" {
+		fmt.Fprintf(&b, "\n\n```\n%s", strings.TrimRight(res.Output, "\n"))
+		if res.Truncated {
+			b.WriteString("\n[output truncated]")
+		}
+		b.WriteString("\n```")
+	}
+	return b.String()
+}
+
+// limitedBuffer keeps the first maxOutput bytes written to it.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (l *limitedBuffer) Write(p []byte) (int, error) {
+	if room := maxOutput - l.buf.Len(); len(p) > room {
+		l.buf.Write(p[:max(room, 0)])
+		l.truncated = true
+		return len(p), nil
+	}
+	return l.buf.Write(p)
+}
+
+// Script is the payload of a run_code approval.
+type Script struct {
+	Language string `json:"language"`
+	Code     string `json:"code"`
+}
+
+// Register makes the runner carry out approved run_code requests on q and
+// returns the run_code tool, through which the model asks for code to be
+// run.
+func (r *Runner) Register(q *approval.Queue) tools.Tool {
+	q.Handle(Kind, func(ctx context.Context, a *store.Approval) (string, error) {
+		var s Script
+		if err := json.Unmarshal(a.Payload, &s); err != nil {
+			return "", err
+		}
+		res, err := r.Run(ctx, s.Language, s.Code)
+		if err != nil {
+			return "", err
+		}
+		return res.String(), nil
+	})
+	return tools.New(Kind,
+		"Ask to run a short script on the Raspberry Pi. The user must approve it first, so the output is not returned now; it is posted to the conversation once the script has run. Use only when the user asks for something to be run.",
+		`{"type":"object","properties":{
+			"language":{"type":"string","enum":["sh","bash","python","javascript"]},
+			"code":{"type":"string","description":"the complete script"},
+			"summary":{"type":"string","description":"one line saying what the script does"}
+		},"required":["language","code","summary"]}`,
+		func(ctx context.Context, args json.RawMessage) (string, error) {
+			var in struct {
+				Script
+				Summary string `json:"summary"`
+			}
+			if err := tools.Decode(args, &in); err != nil {
+				return "", err
+			}
+			if !Supported(in.Language) {
+				return "", fmt.Errorf("running %q code is not supported", in.Language)
+			}
+			a, err := q.Request(ctx, tools.ConversationID(ctx), Kind, Describe(in.Language, in.Summary, in.Code), in.Script)
+			if err != nil {
+				return "", err
+			}
+			if a.Status == store.ApprovalPending {
+				return fmt.Sprintf("Queued for approval as request #%d. Tell the user it will run once they approve it.", a.ID), nil
+			}
+			return approval.Outcome(a), nil
+		})
+}
+
+// Describe summarizes a script for an approval request.
+func Describe(language, summary, code string) string {
+	if summary == "" {
+		summary = "Run a script"
+	}
+	return fmt.Sprintf("%s (%s, %d lines)", summary, language, strings.Count(strings.TrimRight(code, "\n"), "\n")+1)
+}
@@ -0,0 +1,148 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cron is a parsed five-field cron expression: minute, hour, day of
+// month, month and day of week, each a set of allowed values.
+type cron struct {
+	minute, hour, dom, month, dow bits
+	// anyDay is set when either day field is "*". Otherwise a day
+	// matches when either field does, as in Vixie cron.
+	anyDay bool
+}
+
+// bits is a set of small integers.
+type bits uint64
+
+func (b bits) has(n int) bool { return b&(1<<n) != 0 }
+
+var months = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+func parseCron(fields []string) (*cron, error) {
+	var c cron
+	var err error
+	if c.minute, err = parseField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("minute: %v", err)
+	}
+	if c.hour, err = parseField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("hour: %v", err)
+	}
+	if c.dom, err = parseField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("day of month: %v", err)
+	}
+	if c.month, err = parseField(fields[3], 1, 12, months); err != nil {
+		return nil, fmt.Errorf("month: %v", err)
+	}
+	days := make(map[string]int, len(weekdays))
+	for name, wd := range weekdays {
+		days[name] = int(wd)
+	}
+	if c.dow, err = parseField(fields[4], 0, 7, days); err != nil {
+		return nil, fmt.Errorf("day of week: %v", err)
+	}
+	if c.dow.has(7) { // 7 is Sunday too
+		c.dow |= 1
+	}
+	c.anyDay = strings.HasPrefix(fields[2], "*") || strings.HasPrefix(fields[4], "*")
+	if c.next(time.Now()).IsZero() {
+		return nil, errors.New("never matches a date")
+	}
+	return &c, nil
+}
+
+// parseField parses a comma-separated list of values, ranges (a-b) and
+// steps (*/n, a-b/n) between lo and hi. names maps words to values.
+func parseField(s string, lo, hi int, names map[string]int) (bits, error) {
+	value := func(s string) (int, error) {
+		if n, ok := names[s]; ok {
+			return n, nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < lo || n > hi {
+			return 0, fmt.Errorf("%q is not between %d and %d", s, lo, hi)
+		}
+		return n, nil
+	}
+	var b bits
+	for _, part := range strings.Split(s, ",") {
+		rng, stepText, stepped := strings.Cut(part, "/")
+		step := 1
+		if stepped {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepText)
+			}
+			step = n
+		}
+		first, last := lo, hi
+		if rng != "*" {
+			a, z, isRange := strings.Cut(rng, "-")
+			var err error
+			if first, err = value(a); err != nil {
+				return 0, err
+			}
+			last = first
+			if isRange {
+				if last, err = value(z); err != nil {
+					return 0, err
+				}
+			} else if stepped {
+				last = hi // "5/15" runs from 5 on
+			}
+			if last < first {
+				return 0, fmt.Errorf("empty range %q", rng)
+			}
+		}
+		for n := first; n <= last; n += step {
+			b |= 1 << n
+		}
+	}
+	return b, nil
+}
+
+func (c *cron) dayMatches(t time.Time) bool {
+	if !c.month.has(int(t.Month())) {
+		return false
+	}
+	dom, dow := c.dom.has(t.Day()), c.dow.has(int(t.Weekday()))
+	if c.anyDay {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// next returns the first matching minute strictly after t, or the zero
+// time if there is none within five years (e.g. "0 0 31 2 *").
+func (c *cron) next(t time.Time) time.Time {
+	after := t.Truncate(time.Minute)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	for i := 0; i < 5*366; i++ {
+		if c.dayMatches(day) {
+			for h := 0; h < 24; h++ {
+				if !c.hour.has(h) {
+					continue
+				}
+				for m := 0; m < 60; m++ {
+					if !c.minute.has(m) {
+						continue
+					}
+					at := time.Date(day.Year(), day.Month(), day.Day(), h, m, 0, 0, t.Location())
+					if at.After(after) {
+						return at
+					}
+				}
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return time.Time{}
+}
@@ -0,0 +1,113 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// A Wednesday.
+	now := time.Date(2026, 3, 4, 10, 17, 0, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"* * * * *", "2026-03-04 10:18"},
+		{"*/15 * * * *", "2026-03-04 10:30"},
+		{"17 10 * * *", "2026-03-05 10:17"}, // strictly after
+		{"5/20 * * * *", "2026-03-04 10:25"},
+		{"0-10/5 10 * * *", "2026-03-05 10:00"},
+		{"0,45 9-11 * * *", "2026-03-04 10:45"},
+		{"30 7 * * 1-5", "2026-03-05 07:30"},
+		{"30 7 * * MON-FRI", "2026-03-05 07:30"},
+		{"0 9 * * sat,sun", "2026-03-07 09:00"},
+		{"0 0 * * 7", "2026-03-08 00:00"},
+		{"0 0 * * 0", "2026-03-08 00:00"},
+		{"0 0 1 * *", "2026-04-01 00:00"},
+		{"0 22 * jan,dec *", "2026-12-01 22:00"},
+		{"59 23 31 12 *", "2026-12-31 23:59"},
+		{"0 0 29 2 *", "2028-02-29 00:00"},
+		// With both day fields restricted either may match, as in Vixie
+		// cron: the 13th or any Friday.
+		{"0 12 13 * 5", "2026-03-06 12:00"},
+		{"0 12 5 * fri", "2026-03-05 12:00"},
+		// With either one "*", both must.
+		{"0 0 */2 * mon", "2026-03-09 00:00"},
+		{"0 0 * * tue", "2026-03-10 00:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			spec, err := Parse(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := spec.Next(now).Format("2006-01-02 15:04"); got != tt.want {
+				t.Errorf("Next = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"60 * * * *", `invalid cron schedule "60 * * * *": minute: "60" is not between 0 and 59`},
+		{"-1 * * * *", `invalid cron schedule "-1 * * * *": minute: "" is not between 0 and 59`},
+		{"* 24 * * *", `invalid cron schedule "* 24 * * *": hour: "24" is not between 0 and 23`},
+		{"* * 0 * *", `invalid cron schedule "* * 0 * *": day of month: "0" is not between 1 and 31`},
+		{"* * 32 * *", `invalid cron schedule "* * 32 * *": day of month: "32" is not between 1 and 31`},
+		{"* * * 13 *", `invalid cron schedule "* * * 13 *": month: "13" is not between 1 and 12`},
+		{"* * * foo *", `invalid cron schedule "* * * foo *": month: "foo" is not between 1 and 12`},
+		{"* * * * 8", `invalid cron schedule "* * * * 8": day of week: "8" is not between 0 and 7`},
+		{"* * * * mon-", `invalid cron schedule "* * * * mon-": day of week: "" is not between 0 and 7`},
+		{"1,,2 * * * *", `invalid cron schedule "1,,2 * * * *": minute: "" is not between 0 and 59`},
+		{"*/0 * * * *", `invalid cron schedule "*/0 * * * *": minute: invalid step "0"`},
+		{"*/x * * * *", `invalid cron schedule "*/x * * * *": minute: invalid step "x"`},
+		{"5-1 * * * *", `invalid cron schedule "5-1 * * * *": minute: empty range "5-1"`},
+		{"0 0 31 2 *", `invalid cron schedule "0 0 31 2 *": never matches a date`},
+		{"0 0 30 feb *", `invalid cron schedule "0 0 30 feb *": never matches a date`},
+		{"* * * *", `invalid schedule "* * * *"`},
+		{"* * * * * *", `invalid schedule "* * * * * *"`},
+		{"every 0s", `invalid interval in schedule "every 0s"`},
+		{"daily 25:00", `invalid time in schedule "daily 25:00"`},
+		{"someday 08:00", `invalid day in schedule "someday 08:00"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			_, err := Parse(tt.spec)
+			if err == nil {
+				t.Fatalf("Parse(%q) succeeded, want error %q", tt.spec, tt.want)
+			}
+			if err.Error() != tt.want {
+				t.Errorf("Parse(%q): error %q, want %q", tt.spec, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpecNext(t *testing.T) {
+	now := time.Date(2026, 3, 4, 10, 17, 0, 0, time.UTC) // a Wednesday
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"every 15m", "2026-03-04 10:32"},
+		{"daily 07:30", "2026-03-05 07:30"},
+		{"daily 10:18", "2026-03-04 10:18"},
+		{"wed 10:17", "2026-03-11 10:17"},
+		{"Friday 08:00", "2026-03-06 08:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			spec, err := Parse(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := spec.Next(now).Format("2006-01-02 15:04"); got != tt.want {
+				t.Errorf("Next = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
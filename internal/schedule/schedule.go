@@ -0,0 +1,100 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Spec describes when a job runs. It is parsed from one of:
+//
+//	every 15m        fixed interval
+//	daily 07:30      every day at a local time
+//	mon 08:00        weekly on a day at a local time
+//	30 7 * * 1-5     a five-field cron expression, in local time
+type Spec struct {
+	every   time.Duration
+	weekday time.Weekday
+	weekly  bool
+	hour    int
+	minute  int
+	cron    *cron
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Parse parses a schedule spec.
+func Parse(s string) (Spec, error) {
+	fields := strings.Fields(strings.ToLower(s))
+	if len(fields) == 5 {
+		c, err := parseCron(fields)
+		if err != nil {
+			return Spec{}, fmt.Errorf("invalid cron schedule %q: %v", s, err)
+		}
+		return Spec{cron: c}, nil
+	}
+	if len(fields) != 2 {
+		return Spec{}, fmt.Errorf("invalid schedule %q", s)
+	}
+	if fields[0] == "every" {
+		d, err := time.ParseDuration(fields[1])
+		if err != nil || d <= 0 {
+			return Spec{}, fmt.Errorf("invalid interval in schedule %q", s)
+		}
+		return Spec{every: d}, nil
+	}
+
+	var spec Spec
+	if fields[0] != "daily" {
+		wd, ok := weekdays[fields[0][:min(3, len(fields[0]))]]
+		if !ok {
+			return Spec{}, fmt.Errorf("invalid day in schedule %q", s)
+		}
+		spec.weekday, spec.weekly = wd, true
+	}
+	h, m, ok := strings.Cut(fields[1], ":")
+	hour, err1 := strconv.Atoi(h)
+	minute, err2 := strconv.Atoi(m)
+	if !ok || err1 != nil || err2 != nil || hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return Spec{}, fmt.Errorf("invalid time in schedule %q", s)
+	}
+	spec.hour, spec.minute = hour, minute
+	return spec, nil
+}
+
+// Next returns the first run time strictly after t.
+func (s Spec) Next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+	if s.cron != nil {
+		return s.cron.next(t)
+	}
+	next := time.Date(t.Year(), t.Month(), t.Day(), s.hour, s.minute, 0, 0, t.Location())
+	for !next.After(t) || (s.weekly && next.Weekday() != s.weekday) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// Run calls fn at each scheduled time until ctx is cancelled. Errors are
+// logged under the job name.
+func Run(ctx context.Context, name string, spec Spec, fn func(ctx context.Context) error) {
+	for {
+		next := spec.Next(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+		if err := fn(ctx); err != nil {
+			log.Printf("job %s failed: %v", name, err)
+		}
+	}
+}
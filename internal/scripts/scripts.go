@@ -0,0 +1,164 @@
+// Package scripts runs user programs at the engine's middleware hook
+// points, so prompts, replies and tool calls can be inspected and changed
+// without recompiling the agent. A script is any program, in Lua, Python
+// or shell alike: it reads the hook's JSON object on stdin, such as
+//
+//	{"hook": "tool_call", "conversation_id": "default", "name": "run_code", "arguments": "{...}"}
+//
+// and may print a JSON object with the fields it changes, for example
+// {"arguments": "..."}, or {"reject": "reason"} to refuse the turn or the
+// tool call. Printing nothing changes nothing. Scripts for the same hook
+// run in order, each seeing the changes of the ones before.
+//
+// A before_prompt or after_response script that fails is logged and
+// skipped, so a broken filter does not take chat down; a failing tool_call
+// script refuses the call, so a broken guard does not wave calls through.
+package scripts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"pi-agent/engine"
+	"pi-agent/internal/config"
+)
+
+// maxOutput bounds what a script may print.
+const maxOutput = 1 << 20
+
+// Runner implements engine.Middleware with the configured scripts.
+type Runner struct {
+	hooks map[string][]config.Script
+}
+
+// New checks that the scripts' programs exist and returns a runner.
+func New(confs []config.Script) (*Runner, error) {
+	r := &Runner{hooks: make(map[string][]config.Script)}
+	for _, s := range confs {
+		if _, err := exec.LookPath(s.Command[0]); err != nil {
+			return nil, fmt.Errorf("script %q: %w", s.Name, err)
+		}
+		r.hooks[s.Hook] = append(r.hooks[s.Hook], s)
+	}
+	return r, nil
+}
+
+// BeforePrompt implements engine.Middleware.
+func (r *Runner) BeforePrompt(ctx context.Context, p *engine.Prompt) error {
+	for _, s := range r.hooks["before_prompt"] {
+		if err := run(ctx, s, p); errors.Is(err, engine.ErrRejected) {
+			return err
+		} else if err != nil {
+			log.Printf("scripts: %v", err)
+		}
+	}
+	return nil
+}
+
+// AfterResponse implements engine.Middleware.
+func (r *Runner) AfterResponse(ctx context.Context, resp *engine.Response) error {
+	for _, s := range r.hooks["after_response"] {
+		if err := run(ctx, s, resp); err != nil {
+			log.Printf("scripts: %v", err)
+		}
+	}
+	return nil
+}
+
+// OnToolCall implements engine.Middleware.
+func (r *Runner) OnToolCall(ctx context.Context, u *engine.ToolUse) error {
+	for _, s := range r.hooks["tool_call"] {
+		if len(s.Tools) > 0 && !slices.Contains(s.Tools, u.Name) {
+			continue
+		}
+		if err := run(ctx, s, u); err != nil {
+			return err
+		}
+		if u.Output != "" {
+			return nil // answered; later scripts would review a call that does not run
+		}
+	}
+	return nil
+}
+
+// run passes v to a script and applies the fields it prints to v.
+func run(ctx context.Context, s config.Script, v any) error {
+	in, err := input(s.Hook, v)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(s.TimeoutSeconds)*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, s.Command[0], s.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(in)
+	// Kill what the script started too, which would hold its output open.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error { return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL) }
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &limited{&stdout}, &limited{&stderr}
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("script %q: timed out after %ds", s.Name, s.TimeoutSeconds)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("script %q: %v: %s", s.Name, err, lastLine(msg))
+		}
+		return fmt.Errorf("script %q: %w", s.Name, err)
+	}
+	out := bytes.TrimSpace(stdout.Bytes())
+	if len(out) == 0 {
+		return nil
+	}
+	var verdict struct {
+		Reject string `json:"reject"`
+	}
+	if err := json.Unmarshal(out, &verdict); err != nil {
+		return fmt.Errorf("script %q: output is not a JSON object: %v", s.Name, err)
+	}
+	if verdict.Reject != "" {
+		return fmt.Errorf("%w: %s", engine.ErrRejected, verdict.Reject)
+	}
+	if err := json.Unmarshal(out, v); err != nil {
+		return fmt.Errorf("script %q: %v", s.Name, err)
+	}
+	return nil
+}
+
+// input is v as a JSON object with the hook's name added.
+func input(hook string, v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	fields["hook"] = hook
+	return json.Marshal(fields)
+}
+
+func lastLine(s string) string {
+	return s[strings.LastIndex(s, "\n")+1:]
+}
+
+// limited is a writer dropping what goes past maxOutput.
+type limited struct {
+	buf *bytes.Buffer
+}
+
+func (l *limited) Write(p []byte) (int, error) {
+	if room := maxOutput - l.buf.Len(); room > 0 {
+		l.buf.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
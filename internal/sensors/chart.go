@@ -0,0 +1,186 @@
+package sensors
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"time"
+
+	"pi-agent/internal/store"
+)
+
+// The size of the charts served for sensors.
+const (
+	chartWidth  = 640
+	chartHeight = 320
+)
+
+// Chart layout, in pixels: room for the value labels on the left and the
+// time labels below.
+const (
+	marginLeft   = 56
+	marginRight  = 12
+	marginTop    = 12
+	marginBottom = 24
+	ticks        = 5
+	glyphScale   = 2
+)
+
+var (
+	background = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	gridColor  = color.RGBA{0xe0, 0xe0, 0xe0, 0xff}
+	axisColor  = color.RGBA{0x60, 0x60, 0x60, 0xff}
+	lineColor  = color.RGBA{0x1f, 0x77, 0xb4, 0xff}
+)
+
+// Chart plots readings over [from, to) as a line, with the values on the
+// vertical axis and times below. Without readings the chart has only its
+// axes.
+func Chart(readings []store.SensorReading, from, to time.Time, width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	fill(img, img.Bounds(), background)
+	plot := image.Rect(marginLeft, marginTop, width-marginRight, height-marginBottom)
+
+	lo, hi := valueRange(readings)
+	span := to.Sub(from).Seconds()
+	x := func(t time.Time) int {
+		return plot.Min.X + int(math.Round(t.Sub(from).Seconds()/span*float64(plot.Dx()-1)))
+	}
+	y := func(v float64) int {
+		return plot.Max.Y - 1 - int(math.Round((v-lo)/(hi-lo)*float64(plot.Dy()-1)))
+	}
+
+	for i := 0; i < ticks; i++ {
+		v := lo + (hi-lo)*float64(i)/float64(ticks-1)
+		row := y(v)
+		fill(img, image.Rect(plot.Min.X, row, plot.Max.X, row+1), gridColor)
+		label := formatTick(v, hi-lo)
+		text(img, plot.Min.X-6-textWidth(label), row-glyphHeight*glyphScale/2, label, axisColor)
+	}
+	layout := "15:04"
+	if to.Sub(from) > 24*time.Hour {
+		layout = "01/02"
+	}
+	for i := 0; i < ticks; i++ {
+		t := from.Add(time.Duration(float64(to.Sub(from)) * float64(i) / float64(ticks-1)))
+		col := x(t)
+		fill(img, image.Rect(col, plot.Max.Y, col+1, plot.Max.Y+4), axisColor)
+		label := t.Local().Format(layout)
+		left := min(max(col-textWidth(label)/2, 0), width-textWidth(label))
+		text(img, left, plot.Max.Y+8, label, axisColor)
+	}
+	fill(img, image.Rect(plot.Min.X, plot.Min.Y, plot.Min.X+1, plot.Max.Y), axisColor)
+	fill(img, image.Rect(plot.Min.X, plot.Max.Y-1, plot.Max.X, plot.Max.Y), axisColor)
+
+	for i, r := range readings {
+		if i == 0 {
+			fill(img, image.Rect(x(r.ReadAt)-1, y(r.Value)-1, x(r.ReadAt)+1, y(r.Value)+1), lineColor)
+			continue
+		}
+		prev := readings[i-1]
+		line(img, x(prev.ReadAt), y(prev.Value), x(r.ReadAt), y(r.Value), lineColor)
+	}
+	return img
+}
+
+// valueRange returns the range of values to plot: the readings' with a
+// little room above and below, or one around a flat line.
+func valueRange(readings []store.SensorReading) (lo, hi float64) {
+	if len(readings) == 0 {
+		return 0, 1
+	}
+	lo, hi = readings[0].Value, readings[0].Value
+	for _, r := range readings {
+		lo, hi = min(lo, r.Value), max(hi, r.Value)
+	}
+	if hi == lo {
+		return lo - 1, hi + 1
+	}
+	pad := (hi - lo) * 0.05
+	return lo - pad, hi + pad
+}
+
+// formatTick formats a value label with as many decimals as the range of
+// the chart needs.
+func formatTick(v, span float64) string {
+	decimals := 0
+	switch {
+	case span < 1:
+		decimals = 2
+	case span < 10:
+		decimals = 1
+	}
+	return strconv.FormatFloat(v, 'f', decimals, 64)
+}
+
+func fill(img *image.RGBA, r image.Rectangle, c color.RGBA) {
+	r = r.Intersect(img.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+}
+
+// line draws a two-pixel-wide line between two points.
+func line(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA) {
+	steps := max(abs(x1-x0), abs(y1-y0), 1)
+	for i := 0; i <= steps; i++ {
+		x := x0 + (x1-x0)*i/steps
+		y := y0 + (y1-y0)*i/steps
+		fill(img, image.Rect(x, y, x+2, y+2), c)
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// A small bitmap font for the axis labels: each glyph is five rows of
+// three pixels, the high bit leftmost.
+const (
+	glyphWidth  = 3
+	glyphHeight = 5
+)
+
+var glyphs = map[rune][glyphHeight]uint8{
+	'0': {7, 5, 5, 5, 7},
+	'1': {2, 6, 2, 2, 7},
+	'2': {7, 1, 7, 4, 7},
+	'3': {7, 1, 7, 1, 7},
+	'4': {5, 5, 7, 1, 1},
+	'5': {7, 4, 7, 1, 7},
+	'6': {7, 4, 7, 5, 7},
+	'7': {7, 1, 1, 1, 1},
+	'8': {7, 5, 7, 5, 7},
+	'9': {7, 5, 7, 1, 7},
+	'.': {0, 0, 0, 0, 2},
+	'-': {0, 0, 7, 0, 0},
+	':': {0, 2, 0, 2, 0},
+	'/': {1, 1, 2, 4, 4},
+}
+
+func textWidth(s string) int {
+	return len(s) * (glyphWidth + 1) * glyphScale
+}
+
+// text draws s with its top left corner at x, y. Characters without a
+// glyph are left blank.
+func text(img *image.RGBA, x, y int, s string, c color.RGBA) {
+	for _, ch := range s {
+		g := glyphs[ch]
+		for row, bits := range g {
+			for col := 0; col < glyphWidth; col++ {
+				if bits&(1<<(glyphWidth-1-col)) != 0 {
+					px, py := x+col*glyphScale, y+row*glyphScale
+					fill(img, image.Rect(px, py, px+glyphScale, py+glyphScale), c)
+				}
+			}
+		}
+		x += (glyphWidth + 1) * glyphScale
+	}
+}
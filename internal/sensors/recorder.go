@@ -0,0 +1,189 @@
+// Package sensors keeps the history of Home Assistant sensors: it samples
+// their numeric states into the database, answers questions such as "how
+// cold did the greenhouse get this week" and plots them as charts.
+package sensors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"pi-agent/internal/homeassistant"
+	"pi-agent/internal/store"
+	"pi-agent/internal/tools"
+)
+
+// ErrUnknownSensor is returned for sensors that are not recorded.
+var ErrUnknownSensor = errors.New("unknown sensor")
+
+// Periods maps the period names accepted by the tools and charts to their
+// length.
+var Periods = map[string]time.Duration{
+	"1h": time.Hour, "24h": 24 * time.Hour, "7d": 7 * 24 * time.Hour, "30d": 30 * 24 * time.Hour,
+}
+
+// Recorder samples sensors into the database.
+type Recorder struct {
+	sensors   map[string]string // names to entity IDs
+	db        *store.DB
+	ha        *homeassistant.Client
+	interval  time.Duration
+	due       func() bool // optional; see SetPace
+	publicURL string      // optional; see SetPublicURL
+}
+
+// NewRecorder creates a recorder sampling the given sensors, by name, at
+// interval.
+func NewRecorder(sensors map[string]string, db *store.DB, ha *homeassistant.Client, interval time.Duration) *Recorder {
+	return &Recorder{sensors: sensors, db: db, ha: ha, interval: interval}
+}
+
+// SetPace makes the recorder ask due on each tick whether to sample, so
+// sampling can slow down, e.g. on battery.
+func (r *Recorder) SetPace(due func() bool) {
+	r.due = due
+}
+
+// SetPublicURL sets the base URL of the chart links the tools give, e.g.
+// "https://pi.example.org"; without it they are paths on the server.
+func (r *Recorder) SetPublicURL(u string) {
+	r.publicURL = strings.TrimRight(u, "/")
+}
+
+// Names returns the recorded sensors' names in order.
+func (r *Recorder) Names() []string {
+	names := make([]string, 0, len(r.sensors))
+	for name := range r.sensors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Run samples all sensors until ctx is cancelled.
+func (r *Recorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		if r.due == nil || r.due() {
+			r.sample(ctx)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sample stores the sensors' current states. States that are not numbers,
+// including "unavailable", are skipped.
+func (r *Recorder) sample(ctx context.Context) {
+	states, err := r.ha.States(ctx)
+	if err != nil {
+		log.Printf("sensor history: %v", err)
+		return
+	}
+	byID := make(map[string]homeassistant.State, len(states))
+	for _, st := range states {
+		byID[st.EntityID] = st
+	}
+	now := time.Now()
+	for name, entity := range r.sensors {
+		st, ok := byID[entity]
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseFloat(st.State, 64)
+		if err != nil {
+			continue
+		}
+		unit, _ := st.Attributes["unit_of_measurement"].(string)
+		if err := r.db.AddSensorReading(store.SensorReading{Sensor: name, ReadAt: now, Value: v, Unit: unit}); err != nil {
+			log.Printf("sensor history %s: %v", name, err)
+		}
+	}
+}
+
+// Chart plots a sensor over a period ending now.
+func (r *Recorder) Chart(name, period string) (image.Image, error) {
+	if _, ok := r.sensors[name]; !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownSensor, name)
+	}
+	d, ok := Periods[period]
+	if !ok {
+		return nil, fmt.Errorf("unknown period %q", period)
+	}
+	to := time.Now()
+	from := to.Add(-d)
+	readings, err := r.db.SensorReadings(name, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return Chart(readings, from, to, chartWidth, chartHeight), nil
+}
+
+// ChartURL returns the link to a sensor's chart over a period.
+func (r *Recorder) ChartURL(name, period string) string {
+	return r.publicURL + "/charts/" + url.PathEscape(name) + ".png?period=" + period
+}
+
+// Tools returns model-facing tools for sensor history.
+func (r *Recorder) Tools() []tools.Tool {
+	names, _ := json.Marshal(r.Names())
+	return []tools.Tool{
+		tools.New("sensor_history", "Get the minimum, maximum and average of a household sensor, such as a temperature, over a recent period, with a link to a chart of it.",
+			`{"type":"object","properties":{
+				"sensor":{"type":"string","enum":`+string(names)+`},
+				"period":{"type":"string","enum":["1h","24h","7d","30d"]}
+			},"required":["sensor","period"]}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var in struct {
+					Sensor string `json:"sensor"`
+					Period string `json:"period"`
+				}
+				if err := tools.Decode(args, &in); err != nil {
+					return "", err
+				}
+				if _, ok := r.sensors[in.Sensor]; !ok {
+					return "", fmt.Errorf("%w %q; known sensors: %s", ErrUnknownSensor, in.Sensor, strings.Join(r.Names(), ", "))
+				}
+				d, ok := Periods[in.Period]
+				if !ok {
+					return "", fmt.Errorf("unknown period %q", in.Period)
+				}
+				now := time.Now()
+				st, err := r.db.SensorStats(in.Sensor, now.Add(-d), now)
+				if err != nil {
+					return "", err
+				}
+				return formatStats(st, in.Period, r.ChartURL(in.Sensor, in.Period)), nil
+			}),
+	}
+}
+
+func formatStats(st *store.SensorStats, period, chart string) string {
+	if st.Samples == 0 {
+		return fmt.Sprintf("No readings of %s in the last %s.", st.Sensor, period)
+	}
+	value := func(v float64) string {
+		return strings.TrimSpace(strconv.FormatFloat(v, 'f', -1, 64) + " " + st.Unit)
+	}
+	layout := "15:04"
+	if Periods[period] > 24*time.Hour {
+		layout = "Mon Jan 2 15:04"
+	}
+	return fmt.Sprintf("%s over the last %s: min %s at %s, max %s at %s, average %s (%d readings).\nChart: %s",
+		st.Sensor, period,
+		value(st.Min), st.MinAt.Local().Format(layout),
+		value(st.Max), st.MaxAt.Local().Format(layout),
+		strings.TrimSpace(strconv.FormatFloat(st.Avg, 'f', 1, 64)+" "+st.Unit), st.Samples, chart)
+}
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Ways request bodies appear in the access log.
+const (
+	BodiesOmit     = "omit"     // not at all, only their size
+	BodiesHash     = "hash"     // strings replaced by a short SHA-256, so repeats can be spotted
+	BodiesTruncate = "truncate" // strings cut to their first few characters
+	BodiesFull     = "full"     // verbatim, for debugging on a trusted machine
+)
+
+// maxLoggedBody bounds how much of a request body is kept for the log.
+const maxLoggedBody = 64 << 10
+
+// secretFields are JSON and form fields and query parameters whose values
+// never appear in the log, whatever the body mode.
+var secretFields = map[string]bool{
+	"pin": true, "admin_pin": true, "password": true, "secret": true, "token": true, "key": true, "auth": true, "p256dh": true,
+}
+
+// AccessLog writes one JSON object per request: method, path, route,
+// status, size, duration and client, and the request body redacted as
+// configured.
+type AccessLog struct {
+	Out      io.Writer
+	Bodies   string // BodiesOmit (the default), BodiesHash, BodiesTruncate or BodiesFull
+	Truncate int    // characters kept by BodiesTruncate (default 32)
+
+	mu sync.Mutex
+}
+
+// ValidBodies reports whether mode is a body mode the access log knows.
+func ValidBodies(mode string) bool {
+	switch mode {
+	case "", BodiesOmit, BodiesHash, BodiesTruncate, BodiesFull:
+		return true
+	}
+	return false
+}
+
+type accessEntry struct {
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Route      string    `json:"route,omitempty"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	DurationMs int64     `json:"duration_ms"`
+	Remote     string    `json:"remote,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	BodyBytes  int64     `json:"body_bytes,omitempty"`
+	Body       any       `json:"body,omitempty"`
+}
+
+// wrap logs each request served by next.
+func (l *AccessLog) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		var body *capture
+		if r.Body != nil && r.Body != http.NoBody {
+			body = &capture{ReadCloser: r.Body}
+			r.Body = body
+		}
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		e := accessEntry{
+			Time: start.UTC(), Method: r.Method, Path: redactQuery(r.URL), Route: r.Pattern,
+			Status: sw.status, Bytes: sw.bytes, DurationMs: time.Since(start).Milliseconds(),
+			Remote: r.RemoteAddr, UserAgent: r.UserAgent(),
+		}
+		if e.Status == 0 {
+			e.Status = http.StatusOK
+		}
+		if body != nil {
+			e.BodyBytes = body.n
+			e.Body = l.redactBody(r.Header.Get("Content-Type"), body.buf.Bytes(), body.n > int64(body.buf.Len()))
+		}
+		var line bytes.Buffer
+		enc := json.NewEncoder(&line)
+		enc.SetEscapeHTML(false)
+		enc.Encode(e)
+		l.mu.Lock()
+		l.Out.Write(line.Bytes())
+		l.mu.Unlock()
+	})
+}
+
+// redactBody renders a request body for the log. JSON and form bodies keep
+// their shape, with each string redacted; other bodies are redacted whole.
+func (l *AccessLog) redactBody(contentType string, data []byte, cut bool) any {
+	if len(data) == 0 || l.Bodies == "" || l.Bodies == BodiesOmit {
+		return nil
+	}
+	var v any
+	if !cut && json.Unmarshal(data, &v) == nil {
+		return l.redactValue("", v)
+	}
+	if mt, _, _ := mime.ParseMediaType(contentType); mt == "application/x-www-form-urlencoded" {
+		// Pairs that do not parse are left out rather than logged whole.
+		q, _ := url.ParseQuery(string(data))
+		form := make(map[string]any, len(q))
+		for k, vs := range q {
+			var v any = vs[0]
+			if len(vs) > 1 {
+				all := make([]any, len(vs))
+				for i, x := range vs {
+					all[i] = x
+				}
+				v = all
+			}
+			form[k] = l.redactValue(k, v)
+		}
+		return form
+	}
+	if !utf8.Valid(data) {
+		return l.redactString(fmt.Sprintf("%d bytes of binary data", len(data)))
+	}
+	return l.redactString(string(data))
+}
+
+func (l *AccessLog) redactValue(field string, v any) any {
+	if secretFields[strings.ToLower(field)] {
+		return "[redacted]"
+	}
+	switch v := v.(type) {
+	case string:
+		return l.redactString(v)
+	case map[string]any:
+		for k, x := range v {
+			v[k] = l.redactValue(k, x)
+		}
+	case []any:
+		for i, x := range v {
+			v[i] = l.redactValue(field, x)
+		}
+	}
+	return v
+}
+
+func (l *AccessLog) redactString(s string) string {
+	switch l.Bodies {
+	case BodiesHash:
+		sum := sha256.Sum256([]byte(s))
+		return fmt.Sprintf("sha256:%s (%d chars)", hex.EncodeToString(sum[:6]), utf8.RuneCountInString(s))
+	case BodiesTruncate:
+		n := l.Truncate
+		if n <= 0 {
+			n = 32
+		}
+		if utf8.RuneCountInString(s) <= n {
+			return s
+		}
+		return string([]rune(s)[:n]) + "…"
+	}
+	return s
+}
+
+// redactQuery returns the request path with the values of secret query
+// parameters, such as a hook's ?secret=, replaced.
+func redactQuery(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.Path
+	}
+	q := u.Query()
+	for k := range q {
+		if secretFields[strings.ToLower(k)] {
+			q[k] = []string{"redacted"}
+		}
+	}
+	return u.Path + "?" + q.Encode()
+}
+
+// capture keeps the start of a request body as the handler reads it.
+type capture struct {
+	io.ReadCloser
+	buf bytes.Buffer
+	n   int64
+}
+
+func (c *capture) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	if room := maxLoggedBody - c.buf.Len(); room > 0 {
+		c.buf.Write(p[:min(n, room)])
+	}
+	return n, err
+}
+
+// statusWriter records the status and size of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (s *statusWriter) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusWriter) Write(p []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(p)
+	s.bytes += int64(n)
+	return n, err
+}
+
+func (s *statusWriter) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (s *statusWriter) Unwrap() http.ResponseWriter { return s.ResponseWriter }
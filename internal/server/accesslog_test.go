@@ -0,0 +1,38 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAccessLogRedactsForms(t *testing.T) {
+	for _, mode := range []string{BodiesTruncate, BodiesFull} {
+		t.Run(mode, func(t *testing.T) {
+			var out bytes.Buffer
+			l := &AccessLog{Out: &out, Bodies: mode}
+			h := l.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.ParseForm()
+			}))
+			r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader("user=sam&password=hunter2&next=%2Fchat"))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if strings.Contains(out.String(), "hunter2") {
+				t.Fatalf("password logged: %s", out.String())
+			}
+			var e struct{ Body map[string]any }
+			if err := json.Unmarshal(out.Bytes(), &e); err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]any{"user": "sam", "password": "[redacted]", "next": "/chat"}
+			if !reflect.DeepEqual(e.Body, want) {
+				t.Errorf("body = %v, want %v", e.Body, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"pi-agent/internal/importer"
+	"pi-agent/internal/maintenance"
+)
+
+// maxImportBytes bounds the size of an uploaded export.
+const maxImportBytes = 512 << 20
+
+func (s *Server) handleCompact(w http.ResponseWriter, r *http.Request) {
+	policy := maintenance.DefaultPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	report, err := s.cfg.Compactor.Compact(r.Context(), policy)
+	if err != nil {
+		log.Printf("compact error: %v", err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleImport loads an export sent as the raw request body. The format is
+// given by ?format= and detected when omitted.
+func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportBytes))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, "export too large")
+		return
+	}
+	report, err := importer.Import(s.db, r.URL.Query().Get("format"), data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	report, err := s.cfg.Vault.Export()
+	if err != nil {
+		log.Printf("export error: %v", err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// LAN are the networks "lan" stands for in an allowlist: loopback,
+// private, link-local and carrier-grade NAT ranges, the last covering
+// Tailscale.
+var LAN = []netip.Prefix{
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+}
+
+// ParseNets parses a comma-separated allowlist of CIDRs and addresses,
+// where "lan" stands for LAN. An empty list or "any" returns nil, which
+// allows everyone.
+func ParseNets(s string) ([]netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "any" {
+		return nil, nil
+	}
+	var nets []netip.Prefix
+	for part := range strings.SplitSeq(s, ",") {
+		part = strings.TrimSpace(part)
+		switch {
+		case part == "lan":
+			nets = append(nets, LAN...)
+		case strings.Contains(part, "/"):
+			p, err := netip.ParsePrefix(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid network %q", part)
+			}
+			nets = append(nets, p.Masked())
+		default:
+			a, err := netip.ParseAddr(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q", part)
+			}
+			nets = append(nets, netip.PrefixFrom(a, a.BitLen()))
+		}
+	}
+	return nets, nil
+}
+
+// OnlyLAN reports whether every network in an allowlist lies within LAN.
+func OnlyLAN(nets []netip.Prefix) bool {
+	for _, n := range nets {
+		inside := false
+		for _, lan := range LAN {
+			if lan.Bits() <= n.Bits() && lan.Contains(n.Addr()) {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			return false
+		}
+	}
+	return len(nets) > 0
+}
+
+// allowlist refuses TCP clients outside nets. Requests without an IP
+// address, those on the Unix socket, pass: filesystem permissions guard
+// it. Forwarded-for headers are not trusted, so behind a reverse proxy
+// the proxy's address is the one checked.
+func allowlist(nets []netip.Prefix, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ap, err := netip.ParseAddrPort(r.RemoteAddr); err == nil && !allowed(nets, ap.Addr().Unmap().WithZone("")) {
+			writeError(w, http.StatusForbidden, "forbidden")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func allowed(nets []netip.Prefix, a netip.Addr) bool {
+	for _, n := range nets {
+		if n.Contains(a) {
+			return true
+		}
+	}
+	return false
+}
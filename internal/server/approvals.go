@@ -0,0 +1,60 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"pi-agent/internal/store"
+)
+
+func (s *Server) handleListApprovals(w http.ResponseWriter, r *http.Request) {
+	list, err := s.db.Approvals(r.URL.Query().Get("status"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if list == nil {
+		list = []store.Approval{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleGetApproval(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	a, err := s.db.Approval(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, a)
+}
+
+// handleDecideApproval approves or rejects a pending request. Approved
+// requests are carried out before the response is sent.
+func (s *Server) handleDecideApproval(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Approve *bool `json:"approve"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Approve == nil {
+		writeError(w, http.StatusBadRequest, `body must be {"approve": true} or {"approve": false}`)
+		return
+	}
+	a, err := s.cfg.Approvals.Decide(r.Context(), id, *req.Approve)
+	if errors.Is(err, store.ErrDecided) {
+		writeError(w, http.StatusConflict, "already decided")
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, a)
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+
+	"pi-agent/internal/attachments"
+)
+
+// handleUploadAttachment stores the raw request body as an attachment of
+// the signed-in user, or of ?user= without auth. The file name is given
+// by ?name= and the type by Content-Type. Chat requests then refer to it
+// by the returned ID.
+func (s *Server) handleUploadAttachment(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(r)
+	if user == "" {
+		user = r.URL.Query().Get("user")
+	}
+	a, err := s.cfg.Attachments.Save(user, r.URL.Query().Get("name"), r.Header.Get("Content-Type"), r.Body)
+	switch {
+	case errors.Is(err, attachments.ErrTooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	case errors.Is(err, attachments.ErrQuota):
+		writeError(w, http.StatusInsufficientStorage, err.Error())
+		return
+	case err != nil:
+		log.Printf("attachment error: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	writeJSON(w, http.StatusCreated, a)
+}
+
+func (s *Server) handleGetAttachment(w http.ResponseWriter, r *http.Request) {
+	a, f, err := s.cfg.Attachments.Open(r.PathValue("id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	defer f.Close()
+	if a.ContentType != "" {
+		w.Header().Set("Content-Type", a.ContentType)
+	}
+	if a.Name != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": a.Name}))
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, a.Name, a.CreatedAt, f)
+}
+
+// handleStorage reports the space attachments take, overall and per
+// user, against their quotas.
+func (s *Server) handleStorage(w http.ResponseWriter, r *http.Request) {
+	usage, err := s.cfg.Attachments.Usage()
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, usage)
+}
+
+// handleStorageGC deletes unreferenced attachments now rather than at
+// the next scheduled run.
+func (s *Server) handleStorageGC(w http.ResponseWriter, r *http.Request) {
+	report, err := s.cfg.Attachments.GC(r.Context())
+	if err != nil {
+		log.Printf("attachment gc error: %v", err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
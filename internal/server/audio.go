@@ -0,0 +1,85 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+
+	"pi-agent/internal/audio"
+)
+
+func (s *Server) handleAudioDevices(w http.ResponseWriter, r *http.Request) {
+	devices, err := s.cfg.Mixer.Devices(r.Context())
+	if err != nil {
+		log.Printf("audio error: %v", err)
+		writeError(w, http.StatusInternalServerError, "listing audio devices failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"selected": s.cfg.Mixer.Device(),
+		"devices":  devices,
+	})
+}
+
+func (s *Server) handleAudioSetDevice(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Device string `json:"device"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if err := s.cfg.Mixer.SetDevice(r.Context(), req.Device); err != nil {
+		log.Printf("audio error: %v", err)
+		writeError(w, http.StatusInternalServerError, "selecting audio device failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"selected": req.Device})
+}
+
+func (s *Server) handleAudioVolume(w http.ResponseWriter, r *http.Request) {
+	v, err := s.cfg.Mixer.Volume(r.Context())
+	if err != nil {
+		log.Printf("audio error: %v", err)
+		writeError(w, http.StatusInternalServerError, "reading volume failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"percent": v})
+}
+
+func (s *Server) handleAudioSetVolume(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Percent *int `json:"percent"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if req.Percent == nil || *req.Percent < 0 || *req.Percent > 100 {
+		writeError(w, http.StatusBadRequest, "percent must be between 0 and 100")
+		return
+	}
+	if err := s.cfg.Mixer.SetVolume(r.Context(), *req.Percent); err != nil {
+		log.Printf("audio error: %v", err)
+		writeError(w, http.StatusInternalServerError, "setting volume failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"percent": *req.Percent})
+}
+
+// handleAudioCue plays a cue on demand, letting external voice front-ends
+// (e.g. a wake word detector) share the agent's sound set.
+func (s *Server) handleAudioCue(w http.ResponseWriter, r *http.Request) {
+	cue := audio.Cue(r.PathValue("cue"))
+	if !slices.Contains(audio.Cues, cue) {
+		writeError(w, http.StatusNotFound, "unknown cue")
+		return
+	}
+	if err := s.cfg.Earcons.Play(cue); err != nil {
+		log.Printf("earcon error: %v", err)
+		writeError(w, http.StatusInternalServerError, "playing cue failed")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
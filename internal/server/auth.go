@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"pi-agent/internal/auth"
+)
+
+// publicPaths are served without a login: they are either harmless or
+// authenticate requests themselves, with a signed token or shared secret.
+var publicPaths = []string{"/health", "/login", "/auth/", "/shared/", "/hooks/", "/presence/owntracks", "/presence/webhook", "/push/sw.js"}
+
+type userKey struct{}
+
+// requestUser returns the user a request was authenticated as, or "".
+func requestUser(r *http.Request) string {
+	u, _ := r.Context().Value(userKey{}).(string)
+	return u
+}
+
+// authenticate requires a login for TCP requests outside publicPaths.
+// Requests on the Unix socket pass, as with the allowlist. Browsers
+// asking for a page are sent to /login; API clients get 401.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := netip.ParseAddrPort(r.RemoteAddr); err != nil || public(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		user, via := s.cfg.Auth.User(r)
+		if user == "" {
+			if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+				http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+				return
+			}
+			writeError(w, http.StatusUnauthorized, "login required")
+			return
+		}
+		// Browsers send the session cookie with requests other sites
+		// make, so changes must come from a page of ours.
+		if via == "session" && !safeMethod(r.Method) && crossSite(r) {
+			writeError(w, http.StatusForbidden, "cross-site request refused")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, user)))
+	})
+}
+
+func public(path string) bool {
+	for _, p := range publicPaths {
+		if path == p || strings.HasSuffix(p, "/") && strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func safeMethod(m string) bool {
+	return m == http.MethodGet || m == http.MethodHead || m == http.MethodOptions
+}
+
+// crossSite reports whether a request came from another site, by the
+// Sec-Fetch-Site header browsers send or, failing that, the Origin.
+func crossSite(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return false
+	case "":
+	default:
+		return true
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	u, err := url.Parse(origin)
+	return err != nil || !strings.EqualFold(u.Host, r.Host)
+}
+
+func (s *Server) handleLoginPage(w http.ResponseWriter, r *http.Request) {
+	s.renderLogin(w, http.StatusOK, r.URL.Query().Get("next"), "")
+}
+
+func (s *Server) renderLogin(w http.ResponseWriter, status int, next, msg string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(status)
+	err := loginPage.Execute(w, map[string]any{
+		"Next": auth.SafeRedirect(next), "Error": msg,
+		"Passwords": s.cfg.Auth.Passwords(), "OIDC": s.cfg.Auth.OIDC(),
+	})
+	if err != nil {
+		log.Printf("rendering login page: %v", err)
+	}
+}
+
+// handleLogin logs in with a user name and password, from the login form
+// or as JSON {"user", "password"}.
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	form := !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+	var req struct {
+		User     string `json:"user"`
+		Password string `json:"password"`
+		Next     string `json:"next"`
+	}
+	if form {
+		req.User, req.Password, req.Next = r.PostFormValue("user"), r.PostFormValue("password"), r.PostFormValue("next")
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	err := s.cfg.Auth.Login(w, r, req.User, req.Password)
+	switch {
+	case errors.Is(err, auth.ErrLogin) && form:
+		s.renderLogin(w, http.StatusUnauthorized, req.Next, err.Error())
+	case errors.Is(err, auth.ErrLogin):
+		writeError(w, http.StatusUnauthorized, err.Error())
+	case err != nil:
+		log.Printf("login: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+	case form:
+		http.Redirect(w, r, auth.SafeRedirect(req.Next), http.StatusSeeOther)
+	default:
+		writeJSON(w, http.StatusOK, map[string]string{"user": req.User})
+	}
+}
+
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if crossSite(r) {
+		writeError(w, http.StatusForbidden, "cross-site request refused")
+		return
+	}
+	if err := s.cfg.Auth.Logout(w, r); err != nil {
+		log.Printf("logout: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleMe returns who the request is logged in as.
+func (s *Server) handleMe(w http.ResponseWriter, r *http.Request) {
+	user, via := s.cfg.Auth.User(r)
+	if user == "" {
+		writeError(w, http.StatusUnauthorized, "login required")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"user": user, "via": via})
+}
+
+func (s *Server) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if err := s.cfg.Auth.OIDCLogin(w, r, r.URL.Query().Get("next")); err != nil {
+		log.Printf("oidc: %v", err)
+		s.renderLogin(w, http.StatusBadGateway, r.URL.Query().Get("next"), "The login provider is unavailable.")
+	}
+}
+
+func (s *Server) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	next, err := s.cfg.Auth.OIDCCallback(w, r)
+	if err != nil {
+		log.Printf("oidc: %v", err)
+		s.renderLogin(w, http.StatusUnauthorized, "", "Login failed: "+err.Error())
+		return
+	}
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Log in to pi-agent</title>
+<style>
+body { font: 16px/1.5 system-ui, sans-serif; max-width: 22em; margin: 4em auto; padding: 0 1em; color: #222; background: #fafafa; }
+label, input, button, a.button { display: block; width: 100%; box-sizing: border-box; margin: 0.5em 0; }
+input, button, a.button { padding: 0.5em; font: inherit; border-radius: 6px; border: 1px solid #ccc; }
+button, a.button { background: #2563eb; color: #fff; border: none; text-align: center; text-decoration: none; cursor: pointer; }
+.error { color: #b91c1c; }
+</style>
+</head>
+<body>
+<h1>pi-agent</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{if .Passwords}}<form method="post" action="/auth/login">
+<input type="hidden" name="next" value="{{.Next}}">
+<label>User <input name="user" autocomplete="username" required autofocus></label>
+<label>Password <input name="password" type="password" autocomplete="current-password" required></label>
+<button type="submit">Log in</button>
+</form>{{end}}
+{{if .OIDC}}<a class="button" href="/auth/oidc/login?next={{.Next}}">Log in with single sign-on</a>{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"io"
+	"net/http"
+)
+
+// handleListAutomations reports on the automations from the automations
+// file, and on the last reload if it failed.
+func (s *Server) handleListAutomations(w http.ResponseWriter, r *http.Request) {
+	list, reloadErr := s.cfg.Automations.List()
+	resp := map[string]any{"automations": list}
+	if reloadErr != "" {
+		resp["reload_error"] = reloadErr
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleAutomationWebhook runs a webhook automation, authenticated like
+// the hooks. The run happens in the background.
+func (s *Server) handleAutomationWebhook(w http.ResponseWriter, r *http.Request) {
+	secret, ok := s.cfg.Automations.WebhookSecret(r.PathValue("name"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "reading body failed")
+		return
+	}
+	if !hookAuthorized(secret, r, body) {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if !s.cfg.Automations.Fire(r.PathValue("name"), body) {
+		writeError(w, http.StatusNotFound, "not found") // removed by a reload meanwhile
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "accepted"})
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"pi-agent/internal/bookmarks"
+	"pi-agent/internal/store"
+)
+
+func (s *Server) handleListBookmarks(w http.ResponseWriter, r *http.Request) {
+	docs, err := s.cfg.Bookmarks.List()
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if docs == nil {
+		docs = []store.Document{}
+	}
+	writeJSON(w, http.StatusOK, docs)
+}
+
+func (s *Server) handleSaveBookmark(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URL  string `json:"url"`
+		Note string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if strings.TrimSpace(req.URL) == "" {
+		writeError(w, http.StatusBadRequest, "url is required")
+		return
+	}
+	doc, err := s.cfg.Bookmarks.Save(r.Context(), req.URL, req.Note)
+	if errors.Is(err, bookmarks.ErrInvalidURL) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("bookmark error: %v", err)
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, doc)
+}
+
+func (s *Server) handleDeleteBookmark(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if err := s.cfg.Bookmarks.Delete(id); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleRAGStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.cfg.Indexer.Status())
+}
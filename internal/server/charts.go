@@ -0,0 +1,49 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"log"
+	"net/http"
+	"strings"
+
+	"pi-agent/internal/sensors"
+)
+
+// handleChart serves a PNG chart of a recorded sensor, e.g.
+// /charts/greenhouse.png?period=7d, for pages and chat clients to embed.
+// The period is one of 1h, 24h (the default), 7d and 30d.
+func (s *Server) handleChart(w http.ResponseWriter, r *http.Request) {
+	name, ok := strings.CutSuffix(r.PathValue("file"), ".png")
+	if !ok {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "24h"
+	}
+	if _, ok := sensors.Periods[period]; !ok {
+		writeError(w, http.StatusBadRequest, "period must be 1h, 24h, 7d or 30d")
+		return
+	}
+	img, err := s.cfg.Sensors.Chart(name, period)
+	if errors.Is(err, sensors.ErrUnknownSensor) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("chart %s: %v", name, err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"pi-agent/internal/codeblock"
+	"pi-agent/internal/sandbox"
+	"pi-agent/internal/store"
+)
+
+// codeBlock returns the block addressed by the {id} and {n} path values,
+// writing an error response if there is none.
+func (s *Server) codeBlock(w http.ResponseWriter, r *http.Request) (*store.Message, *codeblock.Block, bool) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+	n, err := strconv.Atoi(r.PathValue("n"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid block number")
+		return nil, nil, false
+	}
+	msg, err := s.db.Message(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return nil, nil, false
+	}
+	blocks := codeblock.Parse(msg.Content)
+	if msg.Role != store.RoleAssistant || n < 0 || n >= len(blocks) {
+		writeError(w, http.StatusNotFound, "no such code block")
+		return nil, nil, false
+	}
+	return msg, &blocks[n], true
+}
+
+func (s *Server) handleListCode(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	msg, err := s.db.Message(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	type block struct {
+		codeblock.Block
+		Code string `json:"code"`
+	}
+	out := []block{}
+	if msg.Role == store.RoleAssistant {
+		for _, b := range codeblock.Parse(msg.Content) {
+			out = append(out, block{b, b.Code})
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleSaveCode writes a code block to a file in the workspace.
+func (s *Server) handleSaveCode(w http.ResponseWriter, r *http.Request) {
+	_, b, ok := s.codeBlock(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Path      string `json:"path"`
+		Overwrite bool   `json:"overwrite"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+	}
+	if req.Path == "" {
+		req.Path = b.Filename
+	}
+	if !filepath.IsLocal(req.Path) {
+		writeError(w, http.StatusBadRequest, "path must be relative and inside the workspace")
+		return
+	}
+	path := filepath.Join(s.cfg.Workspace, req.Path)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	mode := 0o644
+	if b.Language == "sh" || b.Language == "bash" || strings.HasPrefix(b.Code, "#!") {
+		mode = 0o755
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !req.Overwrite {
+		flags |= os.O_EXCL
+	}
+	f, err := os.OpenFile(path, flags, os.FileMode(mode))
+	if errors.Is(err, os.ErrExist) {
+		writeError(w, http.StatusConflict, fmt.Sprintf("%s exists; set overwrite to replace it", req.Path))
+		return
+	}
+	if err == nil {
+		_, err = f.WriteString(b.Code)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"path": path, "bytes": len(b.Code)})
+}
+
+// handleRunCode queues a code block to be run in the sandbox once
+// approved.
+func (s *Server) handleRunCode(w http.ResponseWriter, r *http.Request) {
+	msg, b, ok := s.codeBlock(w, r)
+	if !ok {
+		return
+	}
+	if !sandbox.Supported(b.Language) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("running %q code is not supported", b.Language))
+		return
+	}
+	summary := sandbox.Describe(b.Language, "Run "+b.Filename, b.Code)
+	a, err := s.cfg.Approvals.Request(r.Context(), msg.ConversationID, sandbox.Kind, summary, sandbox.Script{Language: b.Language, Code: b.Code})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, a)
+}
@@ -0,0 +1,325 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"pi-agent/internal/store"
+)
+
+// Command is a slash command, such as "/reset", that the server answers
+// itself wherever chat messages arrive: the chat API, the FIFOs and voice
+// front ends, which may send "slash reset" for "/reset".
+type Command struct {
+	Name        string // without the slash, e.g. "model"
+	Args        string // what follows the name, for /help, e.g. "<model>"
+	Description string
+	Run         func(ctx context.Context, call CommandCall) (string, error)
+}
+
+// CommandCall is a command as sent to a conversation.
+type CommandCall struct {
+	ConversationID string
+	User           string // the user sending it, if known
+	Args           string // the text after the name, trimmed
+	AdminPIN       string // sent with it, to leave a restricted persona
+}
+
+// Commands routes slash commands to their handlers. The server registers
+// the built-in ones; others can be added with Register or through
+// Config.Commands.
+type Commands struct {
+	mu       sync.RWMutex
+	commands map[string]Command
+}
+
+// commandPattern matches a command and its arguments: a name of letters,
+// digits, dashes and underscores, so that paths such as "/etc/hosts" are
+// left to the model.
+var commandPattern = regexp.MustCompile(`^/([A-Za-z][A-Za-z0-9_-]*)(?:\s+(.*))?$`)
+
+// NewCommands returns an empty command registry.
+func NewCommands() *Commands {
+	return &Commands{commands: make(map[string]Command)}
+}
+
+// Register adds commands, replacing any already registered under the same
+// name.
+func (c *Commands) Register(cmds ...Command) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cmd := range cmds {
+		c.commands[strings.ToLower(cmd.Name)] = cmd
+	}
+}
+
+// List returns the registered commands by name.
+func (c *Commands) List() []Command {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make([]Command, 0, len(c.commands))
+	for _, cmd := range c.commands {
+		out = append(out, cmd)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Route runs the command a message gives, if it is one. It returns the
+// command's name and reply, or an empty name if the message is not a
+// command. Unknown commands are answered with a hint rather than sent to
+// the model. Voice transcripts may spell the slash out as "slash".
+func (c *Commands) Route(ctx context.Context, call CommandCall, message string, voice bool) (name, reply string, err error) {
+	message = strings.TrimSpace(message)
+	if voice {
+		if rest, ok := cutPrefixFold(message, "slash "); ok {
+			message = "/" + strings.TrimSpace(rest)
+		}
+	}
+	m := commandPattern.FindStringSubmatch(message)
+	if m == nil {
+		return "", "", nil
+	}
+	name = strings.ToLower(m[1])
+	c.mu.RLock()
+	cmd, ok := c.commands[name]
+	c.mu.RUnlock()
+	if !ok {
+		if voice {
+			return "", "", nil
+		}
+		return name, fmt.Sprintf("Unknown command /%s. Send /help for the list.", name), nil
+	}
+	call.Args = strings.TrimSpace(m[2])
+	reply, err = cmd.Run(ctx, call)
+	return name, reply, err
+}
+
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix) {
+		return s[len(prefix):], true
+	}
+	return s, false
+}
+
+// builtinCommands are the commands every server answers.
+func (s *Server) builtinCommands() []Command {
+	return []Command{
+		{Name: "help", Description: "list the commands", Run: s.commandHelp},
+		{Name: "reset", Description: "start the conversation over, forgetting its history", Run: s.commandReset},
+		{Name: "continue", Description: "bring back the history of a conversation that was idle too long", Run: s.commandContinue},
+		{Name: "model", Args: "[<model or tier> | default]", Description: "show or switch the conversation's model", Run: s.commandModel},
+		{Name: "persona", Args: "[<persona> | default]", Description: "show or switch the conversation's persona", Run: s.commandPersona},
+		{Name: "remember", Args: "<fact>", Description: "have the agent remember something in every conversation", Run: s.commandRemember},
+		{Name: "forget", Args: "<text>", Description: "forget what you asked to remember that mentions the text", Run: s.commandForget},
+		{Name: "pin", Args: "[<text>]", Description: "always keep the text, or else the last message, in this conversation's context", Run: s.commandPin},
+		{Name: "unpin", Description: "unpin this conversation's pinned messages", Run: s.commandUnpin},
+	}
+}
+
+func (s *Server) commandHelp(ctx context.Context, call CommandCall) (string, error) {
+	var b strings.Builder
+	b.WriteString("Commands:")
+	for _, cmd := range s.commands.List() {
+		b.WriteString("\n/" + cmd.Name)
+		if cmd.Args != "" {
+			b.WriteString(" " + cmd.Args)
+		}
+		if cmd.Description != "" {
+			b.WriteString(" - " + cmd.Description)
+		}
+	}
+	return b.String(), nil
+}
+
+func (s *Server) commandReset(ctx context.Context, call CommandCall) (string, error) {
+	n, err := s.db.DeleteConversationMessages(call.ConversationID)
+	if err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return "The conversation is already empty.", nil
+	}
+	return fmt.Sprintf("Started over; %d messages were cleared.", n), nil
+}
+
+func (s *Server) commandContinue(ctx context.Context, call CommandCall) (string, error) {
+	n, err := s.db.ContinueContext(call.ConversationID)
+	if err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return "Nothing to continue; the whole conversation is in context.", nil
+	}
+	return fmt.Sprintf("Picking up where we left off, with %d earlier messages.", n), nil
+}
+
+// expireContext starts a conversation's context afresh if it has been idle
+// for longer than the channel's context TTL.
+func (s *Server) expireContext(convID, channel string) {
+	ttl := s.cfg.ContextTTL[channel]
+	if ttl <= 0 {
+		return
+	}
+	if _, err := s.db.ExpireContext(convID, ttl); err != nil {
+		log.Printf("db error: %v", err)
+	}
+}
+
+func (s *Server) commandModel(ctx context.Context, call CommandCall) (string, error) {
+	cp, err := s.conversationProfile(call.ConversationID)
+	if err != nil {
+		return "", err
+	}
+	p, err := s.engine.Profile(cp.Persona, call.User)
+	if err != nil {
+		p, _ = s.engine.Profile("", call.User)
+	}
+	switch call.Args {
+	case "":
+		model := p.Model
+		if cp.Model != "" {
+			if m, err := s.engine.ResolveModel(p, cp.Model); err == nil {
+				model = m
+			}
+		}
+		return "This conversation uses " + model + ".", nil
+	}
+	if err := s.engine.Check(p, call.Args); err != nil {
+		return "", err
+	}
+	switch call.Args {
+	case "default":
+		cp.Model = ""
+		if err := s.db.SetConversationProfile(cp); err != nil {
+			return "", err
+		}
+		return "Back to the default model, " + p.Model + ".", nil
+	}
+	model, err := s.engine.ResolveModel(p, call.Args)
+	if err != nil {
+		return "", err
+	}
+	cp.Model = call.Args
+	if err := s.db.SetConversationProfile(cp); err != nil {
+		return "", err
+	}
+	return "Switched this conversation to " + model + ".", nil
+}
+
+func (s *Server) commandPersona(ctx context.Context, call CommandCall) (string, error) {
+	cp, err := s.conversationProfile(call.ConversationID)
+	if err != nil {
+		return "", err
+	}
+	cur, err := s.engine.Profile(cp.Persona, call.User)
+	if call.Args == "" {
+		if err != nil || cur.Persona == "" {
+			return "This conversation has no persona.", nil
+		}
+		return "This conversation talks to " + cur.Persona + ".", nil
+	}
+	if err != nil {
+		cur, _ = s.engine.Profile("", call.User)
+	}
+	if err := s.engine.Check(cur, call.Args); err != nil {
+		return "", err
+	}
+	if call.Args == "default" {
+		if err := s.engine.CheckSwitch(cur, "", call.AdminPIN); err != nil {
+			return "", err
+		}
+		cp.Persona = ""
+		if err := s.db.SetConversationProfile(cp); err != nil {
+			return "", err
+		}
+		return "Back to the default persona.", nil
+	}
+	p, err := s.engine.Profile(call.Args, call.User)
+	if err != nil {
+		return "", err
+	}
+	if err := s.engine.CheckSwitch(cur, p.Persona, call.AdminPIN); err != nil {
+		return "", err
+	}
+	cp.Persona = p.Persona
+	if err := s.db.SetConversationProfile(cp); err != nil {
+		return "", err
+	}
+	return "Switched this conversation to " + p.Persona + ".", nil
+}
+
+func (s *Server) commandRemember(ctx context.Context, call CommandCall) (string, error) {
+	if call.Args == "" {
+		return "", errors.New("say what to remember, e.g. /remember I am vegetarian")
+	}
+	// Memories go into the prompts of every conversation.
+	if private, err := s.db.Private(call.ConversationID); err != nil {
+		return "", err
+	} else if private {
+		return "", errors.New("nothing is remembered from private conversations")
+	}
+	if err := s.db.AddMemory(&store.Memory{User: call.User, Content: call.Args}); err != nil {
+		return "", err
+	}
+	return "I'll remember that.", nil
+}
+
+func (s *Server) commandForget(ctx context.Context, call CommandCall) (string, error) {
+	if call.Args == "" {
+		return "", errors.New("say what to forget, e.g. /forget vegetarian")
+	}
+	n, err := s.db.ForgetMemories(call.User, call.Args)
+	if err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return "I don't remember anything about " + call.Args + ".", nil
+	}
+	return fmt.Sprintf("Forgotten (%d).", n), nil
+}
+
+// conversationProfile returns the persona and model a conversation was
+// switched to, empty if it was not.
+func (s *Server) conversationProfile(convID string) (*store.ConversationProfile, error) {
+	cp, err := s.db.ConversationProfile(convID)
+	if errors.Is(err, store.ErrNotFound) {
+		return &store.ConversationProfile{ConversationID: convID}, nil
+	}
+	return cp, err
+}
+
+// conversationPersona returns the persona a conversation was switched to
+// with /persona, or "" if it was not or the persona no longer exists.
+func (s *Server) conversationPersona(convID string) string {
+	cp, err := s.conversationProfile(convID)
+	if err != nil {
+		log.Printf("db error: %v", err)
+		return ""
+	}
+	if cp.Persona == "" {
+		return ""
+	}
+	if _, err := s.engine.Profile(cp.Persona, ""); err != nil {
+		return ""
+	}
+	return cp.Persona
+}
+
+// respondCommand streams a command's reply using the same framing, SSE or
+// NDJSON, as a model response. Commands and their replies are not stored
+// in the conversation.
+func (s *Server) respondCommand(w http.ResponseWriter, r *http.Request, convID, name, reply string, err error) {
+	if err != nil {
+		log.Printf("command /%s: %v", name, err)
+		reply = "Sorry, /" + name + " failed: " + err.Error()
+	}
+	writeLocalReply(w, r, convID, reply, "command", name)
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pi-agent/engine"
+	"pi-agent/internal/policy"
+	"pi-agent/internal/store"
+)
+
+// handleCompare answers one message with two or more configured variants
+// at once. Both replies stream back as one SSE stream whose events name
+// their variant; nothing is added to the conversation. The results are
+// stored as a comparison so a winner can be picked later.
+func (s *Server) handleCompare(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Message        string   `json:"message"`
+		ConversationID string   `json:"conversation_id"`
+		Variants       []string `json:"variants"` // default the first two configured
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if strings.TrimSpace(req.Message) == "" {
+		writeError(w, http.StatusBadRequest, "message is required")
+		return
+	}
+	if len(req.Variants) == 0 {
+		req.Variants = s.engine.Variants()[:2]
+	}
+	if len(req.Variants) < 2 {
+		writeError(w, http.StatusBadRequest, "at least two variants are required")
+		return
+	}
+	convID := req.ConversationID
+	if convID == "" {
+		convID = s.cfg.ConversationID
+	}
+
+	turns := make([]*engine.Turn, len(req.Variants))
+	results := make([]store.ComparisonResult, len(req.Variants))
+	seen := make(map[string]bool)
+	for i, name := range req.Variants {
+		if seen[name] {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("variant %q given twice", name))
+			return
+		}
+		seen[name] = true
+		p, err := s.engine.VariantProfile(name)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		t, err := s.engine.Prepare(r.Context(), convID, req.Message, p)
+		if errors.Is(err, policy.ErrRestricted) {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		if errors.Is(err, engine.ErrAuth) {
+			log.Printf("token error: %v", err)
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if errors.Is(err, engine.ErrPrivate) {
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		if err != nil {
+			log.Printf("db error: %v", err)
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		turns[i] = t
+		results[i] = store.ComparisonResult{Variant: name, Model: p.Model}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	// The variants stream concurrently; events are written whole so they
+	// interleave cleanly.
+	var mu sync.Mutex
+	send := func(event map[string]any) {
+		data, _ := json.Marshal(event)
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+	}
+	var wg sync.WaitGroup
+	for i, t := range turns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := &results[i]
+			start := time.Now()
+			reply, err := s.engine.Run(r.Context(), t, func(content string) {
+				send(map[string]any{"variant": res.Variant, "content": content})
+			})
+			res.DurationMs = time.Since(start).Milliseconds()
+			res.Content, res.Fallback = reply, t.Fallback()
+			if err != nil {
+				res.Error = err.Error()
+				send(map[string]any{"variant": res.Variant, "error": res.Error})
+				return
+			}
+			done := map[string]any{"variant": res.Variant, "done": true, "model": res.Model, "duration_ms": res.DurationMs}
+			if res.Fallback != "" {
+				done["fallback"] = res.Fallback
+			}
+			send(done)
+		}()
+	}
+	wg.Wait()
+
+	c := &store.Comparison{ConversationID: convID, Prompt: req.Message, Results: results}
+	if err := s.db.AddComparison(c); err != nil {
+		log.Printf("db error saving comparison: %v", err)
+	} else {
+		send(map[string]any{"comparison_id": c.ID})
+	}
+	fmt.Fprintf(w, "data: [DONE]\n\n")
+	flusher.Flush()
+}
+
+// handleListComparisons returns recent comparisons, newest first. With
+// ?limit=N it returns at most N (default 50).
+func (s *Server) handleListComparisons(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, 500)
+	}
+	list, err := s.db.Comparisons(limit)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if list == nil {
+		list = []store.Comparison{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// handleGetComparison returns a comparison with each variant's reply.
+func (s *Server) handleGetComparison(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	c, err := s.db.Comparison(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+// handlePickWinner records which variant gave the better reply: the body
+// names it as "winner", or "tie", with an optional "comment".
+func (s *Server) handlePickWinner(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Winner  string `json:"winner"`
+		Comment string `json:"comment"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if req.Winner == "" {
+		writeError(w, http.StatusBadRequest, "winner is required")
+		return
+	}
+	err := s.db.SetComparisonWinner(id, req.Winner, req.Comment)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "no such comparison, or winner is not one of its variants")
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	c, err := s.db.Comparison(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+// handleComparisonStats returns each variant's wins over the judged
+// comparisons.
+func (s *Server) handleComparisonStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := s.db.ComparisonStats()
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if stats == nil {
+		stats = []store.VariantStats{}
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// minCompress is the smallest response worth compressing.
+const minCompress = 1024
+
+// writeCachedJSON writes v with an ETag derived from its encoding, and
+// answers 304 Not Modified when the client already has it, so clients on
+// slow links don't download unchanged history again.
+func writeCachedJSON(w http.ResponseWriter, r *http.Request, v any) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	etag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if matchETag(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(buf.Bytes())
+}
+
+func matchETag(header, etag string) bool {
+	for tag := range strings.SplitSeq(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	gzipPool  = sync.Pool{New: func() any { w, _ := gzip.NewWriterLevel(nil, gzip.BestSpeed); return w }}
+	flatePool = sync.Pool{New: func() any { w, _ := flate.NewWriter(nil, flate.BestSpeed); return w }}
+)
+
+// compress gzips or deflates JSON responses for clients that accept it.
+// Other content, such as audio and the chat event stream, passes through
+// untouched.
+func compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := acceptedEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// acceptedEncoding picks gzip or deflate from an Accept-Encoding header.
+func acceptedEncoding(header string) string {
+	var deflate bool
+	for part := range strings.SplitSeq(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.ReplaceAll(params, " ", "") == "q=0" {
+			continue
+		}
+		switch strings.ToLower(name) {
+		case "gzip":
+			return "gzip"
+		case "deflate":
+			deflate = true
+		}
+	}
+	if deflate {
+		return "deflate"
+	}
+	return ""
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	decided  bool
+	w        io.WriteCloser // nil when passing through
+	status   int
+	buf      []byte // held until minCompress bytes decide the matter
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if c.decided || c.status != 0 {
+		c.ResponseWriter.WriteHeader(status)
+		return
+	}
+	c.status = status
+	h := c.Header()
+	if status == http.StatusNoContent || status == http.StatusNotModified || h.Get("Content-Encoding") != "" ||
+		!strings.HasPrefix(h.Get("Content-Type"), "application/json") {
+		c.passThrough()
+	}
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if c.status == 0 {
+		if c.Header().Get("Content-Type") == "" {
+			c.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.decided {
+		if c.w != nil {
+			return c.w.Write(p)
+		}
+		return c.ResponseWriter.Write(p)
+	}
+	c.buf = append(c.buf, p...)
+	if len(c.buf) >= minCompress {
+		c.startCompressing()
+	}
+	return len(p), nil
+}
+
+func (c *compressWriter) passThrough() {
+	c.decided = true
+	c.ResponseWriter.WriteHeader(c.status)
+}
+
+func (c *compressWriter) startCompressing() {
+	c.decided = true
+	h := c.Header()
+	h.Set("Content-Encoding", c.encoding)
+	h.Del("Content-Length")
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		// The encoded bytes differ from the identity ones the tag names.
+		h.Set("ETag", "W/"+etag)
+	}
+	c.ResponseWriter.WriteHeader(c.status)
+	if c.encoding == "gzip" {
+		gz := gzipPool.Get().(*gzip.Writer)
+		gz.Reset(c.ResponseWriter)
+		c.w = pooled{gz, &gzipPool}
+	} else {
+		fl := flatePool.Get().(*flate.Writer)
+		fl.Reset(c.ResponseWriter)
+		c.w = pooled{fl, &flatePool}
+	}
+	c.w.Write(c.buf)
+	c.buf = nil
+}
+
+// Flush sends buffered output, compressing it if it started out large
+// enough.
+func (c *compressWriter) Flush() {
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	if !c.decided {
+		c.passThrough()
+		c.ResponseWriter.Write(c.buf)
+		c.buf = nil
+	}
+	if f, ok := c.w.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close finishes the response.
+func (c *compressWriter) Close() error {
+	if !c.decided {
+		if c.status == 0 {
+			return nil // nothing was written
+		}
+		c.passThrough()
+		_, err := c.ResponseWriter.Write(c.buf)
+		return err
+	}
+	if c.w != nil {
+		return c.w.Close()
+	}
+	return nil
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (c *compressWriter) Unwrap() http.ResponseWriter { return c.ResponseWriter }
+
+type flushWriteCloser interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+// pooled returns its writer to the pool once closed.
+type pooled struct {
+	flushWriteCloser
+	pool *sync.Pool
+}
+
+func (p pooled) Close() error {
+	err := p.flushWriteCloser.Close()
+	p.pool.Put(p.flushWriteCloser)
+	return err
+}
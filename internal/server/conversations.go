@@ -0,0 +1,239 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"pi-agent/internal/config"
+	"pi-agent/internal/store"
+)
+
+func (s *Server) handleListConversations(w http.ResponseWriter, r *http.Request) {
+	convs, err := s.db.Conversations()
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if convs == nil {
+		convs = []store.Conversation{}
+	}
+	writeCachedJSON(w, r, convs)
+}
+
+// message is a stored message as served by the API.
+type message struct {
+	ID          int64           `json:"id"`
+	Role        store.Role      `json:"role"`
+	Content     string          `json:"content"`
+	AudioRef    string          `json:"audio_ref,omitempty"`
+	Fallback    string          `json:"fallback,omitempty"`
+	Speaker     string          `json:"speaker,omitempty"`
+	Attachments []string        `json:"attachments,omitempty"`
+	Origin      string          `json:"origin,omitempty"` // the conversation it was merged from
+	Feedback    *store.Feedback `json:"feedback,omitempty"`
+	Pinned      bool            `json:"pinned,omitempty"` // always sent with the conversation
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// apiMessage returns m as served by the API, without what is stored
+// apart from it.
+func apiMessage(m store.Message) message {
+	return message{ID: m.ID, Role: m.Role, Content: m.Content, AudioRef: m.AudioRef, Fallback: m.Fallback, Speaker: m.Speaker, CreatedAt: m.CreatedAt}
+}
+
+// handleListMessages returns a conversation's messages. With ?limit=N
+// only the newest N are returned, and ?before=ID pages back from there.
+// ?as_of= returns the conversation as it was at an RFC 3339 time or a
+// duration ago, e.g. 24h: with messages deleted or compacted away since,
+// and edited ones as they read then.
+func (s *Server) handleListMessages(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var msgs []store.Message
+	var err error
+	if q.Has("as_of") {
+		asOf, perr := parseSince(q.Get("as_of"))
+		if perr != nil {
+			writeError(w, http.StatusBadRequest, "as_of must be an RFC 3339 time or a duration such as 24h")
+			return
+		}
+		msgs, err = s.db.MessagesAsOf(r.PathValue("id"), asOf)
+	} else if q.Has("limit") || q.Has("before") {
+		limit, err1 := strconv.Atoi(q.Get("limit"))
+		before, err2 := strconv.ParseInt(q.Get("before"), 10, 64)
+		if q.Get("limit") == "" {
+			limit, err1 = 50, nil
+		}
+		if q.Get("before") == "" {
+			before, err2 = 0, nil
+		}
+		if err1 != nil || err2 != nil || limit <= 0 {
+			writeError(w, http.StatusBadRequest, "limit and before must be positive integers")
+			return
+		}
+		msgs, err = s.db.MessagesBefore(r.PathValue("id"), before, min(limit, 500))
+	} else {
+		msgs, err = s.db.Messages(r.PathValue("id"))
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if len(msgs) == 0 {
+		if ok, err := s.db.HasConversation(r.PathValue("id")); err != nil || !ok {
+			writeError(w, http.StatusNotFound, "no such conversation")
+			return
+		}
+	}
+	feedback, err := s.db.ConversationFeedback(r.PathValue("id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	attached, err := s.db.MessageAttachments(r.PathValue("id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	origins, err := s.db.MessageOrigins(r.PathValue("id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	pinned, err := s.db.PinnedMessages(r.PathValue("id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	out := make([]message, len(msgs))
+	for i, m := range msgs {
+		out[i] = apiMessage(m)
+		out[i].Attachments, out[i].Origin = attached[m.ID], origins[m.ID]
+		out[i].Pinned = slices.ContainsFunc(pinned, func(p store.Message) bool { return p.ID == m.ID })
+		if f, ok := feedback[m.ID]; ok {
+			out[i].Feedback = &f
+		}
+	}
+	writeCachedJSON(w, r, out)
+}
+
+// privacy is a conversation's privacy mode as served by the API.
+type privacy struct {
+	ConversationID string `json:"conversation_id"`
+	Private        bool   `json:"private"`
+}
+
+func (s *Server) handleGetPrivate(w http.ResponseWriter, r *http.Request) {
+	private, err := s.db.Private(r.PathValue("id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, privacy{ConversationID: r.PathValue("id"), Private: private})
+}
+
+// handleSetPrivate turns a conversation's privacy mode on or off with
+// {"private":true}. Private conversations are only answered by local
+// providers, and are left out of compaction and vault exports.
+func (s *Server) handleSetPrivate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Private *bool `json:"private"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Private == nil {
+		writeError(w, http.StatusBadRequest, `body must be {"private":true} or {"private":false}`)
+		return
+	}
+	if err := s.db.SetPrivate(r.PathValue("id"), *req.Private); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, privacy{ConversationID: r.PathValue("id"), Private: *req.Private})
+}
+
+func (s *Server) handleGetReplyLength(w http.ResponseWriter, r *http.Request) {
+	l, err := s.db.ReplyLength(r.PathValue("id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, l)
+}
+
+// handleSetReplyLength overrides how long the persona's replies are in a
+// conversation with e.g. {"verbosity":"terse","max_output_tokens":120}.
+// The verbosity, "terse", "normal" or "detailed", is enforced in the
+// prompt; max_output_tokens, or the verbosity's own cap, is passed to the
+// model as a hard limit.
+func (s *Server) handleSetReplyLength(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Verbosity       string `json:"verbosity"`
+		MaxOutputTokens int    `json:"max_output_tokens"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if req.Verbosity != "" && !slices.Contains(config.Verbosities, req.Verbosity) {
+		writeError(w, http.StatusBadRequest, "verbosity must be one of "+strings.Join(config.Verbosities, ", "))
+		return
+	}
+	if req.MaxOutputTokens < 0 {
+		writeError(w, http.StatusBadRequest, "max_output_tokens must not be negative")
+		return
+	}
+	if req.Verbosity == "" && req.MaxOutputTokens == 0 {
+		writeError(w, http.StatusBadRequest, "set verbosity, max_output_tokens or both, or DELETE to use the persona's")
+		return
+	}
+	l := store.ReplyLength{ConversationID: r.PathValue("id"), Verbosity: req.Verbosity, MaxOutputTokens: req.MaxOutputTokens}
+	if err := s.db.SetReplyLength(&l); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	saved, err := s.db.ReplyLength(l.ConversationID)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, saved)
+}
+
+func (s *Server) handleDeleteReplyLength(w http.ResponseWriter, r *http.Request) {
+	if err := s.db.DeleteReplyLength(r.PathValue("id")); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleMergeConversation moves the messages of another conversation into
+// this one with {"from":"<id>"}, e.g. when a topic was split between a
+// phone and the web UI. Messages are interleaved by when they were sent
+// and keep the conversation they came from as their "origin".
+func (s *Server) handleMergeConversation(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		From string `json:"from"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.From == "" {
+		writeError(w, http.StatusBadRequest, `body must be {"from":"<conversation id>"}`)
+		return
+	}
+	if req.From == r.PathValue("id") {
+		writeError(w, http.StatusBadRequest, "cannot merge a conversation into itself")
+		return
+	}
+	merge, err := s.db.MergeConversations(r.PathValue("id"), req.From)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "no such conversation: "+req.From)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, merge)
+}
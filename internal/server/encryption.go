@@ -0,0 +1,157 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pi-agent/internal/store"
+)
+
+// ConversationKeyHeader carries the key of an encrypted conversation,
+// base64 encoded. The server holds it in memory only while serving the
+// request.
+const ConversationKeyHeader = "X-Conversation-Key"
+
+var errNoKey = errors.New("conversation is encrypted; send its key in the " + ConversationKeyHeader + " header")
+
+// conversationKey decodes the request's conversation key, if any.
+func conversationKey(r *http.Request) ([]byte, error) {
+	v := strings.TrimSpace(r.Header.Get(ConversationKeyHeader))
+	if v == "" {
+		return nil, nil
+	}
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if key, err := enc.DecodeString(v); err == nil && len(key) == store.KeySize {
+			return key, nil
+		}
+	}
+	return nil, errors.New(ConversationKeyHeader + " must be a base64-encoded 32-byte key")
+}
+
+// unlock opens an encrypted conversation for the rest of the request
+// with the key the request carries, writing an error and returning false
+// if it carries none or the wrong one. Other conversations need no key.
+// The returned function, to be deferred, forgets the key.
+func (s *Server) unlock(w http.ResponseWriter, r *http.Request, conversationID string) (func(), bool) {
+	encrypted, err := s.db.Encrypted(conversationID)
+	if err != nil {
+		writeStoreError(w, err)
+		return nil, false
+	}
+	if !encrypted {
+		return func() {}, true
+	}
+	key, err := conversationKey(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	if key == nil {
+		writeError(w, http.StatusForbidden, errNoKey.Error())
+		return nil, false
+	}
+	release, err := s.db.Unlock(conversationID, key)
+	if err != nil {
+		writeStoreError(w, err)
+		return nil, false
+	}
+	return release, true
+}
+
+// withConversationKey unlocks the conversation named by the {id} path
+// value while next serves the request.
+func (s *Server) withConversationKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		release, ok := s.unlock(w, r, r.PathValue("id"))
+		if !ok {
+			return
+		}
+		defer release()
+		next(w, r)
+	}
+}
+
+// withMessageKey unlocks the conversation of the message named by the
+// {id} path value while next serves the request.
+func (s *Server) withMessageKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			// Left to next to reject.
+			next(w, r)
+			return
+		}
+		conv, err := s.db.MessageConversation(id)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		release, ok := s.unlock(w, r, conv)
+		if !ok {
+			return
+		}
+		defer release()
+		next(w, r)
+	}
+}
+
+// encryption is a conversation's encryption mode as served by the API.
+type encryption struct {
+	ConversationID string `json:"conversation_id"`
+	Encrypted      bool   `json:"encrypted"`
+}
+
+func (s *Server) handleGetEncryption(w http.ResponseWriter, r *http.Request) {
+	encrypted, err := s.db.Encrypted(r.PathValue("id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, encryption{ConversationID: r.PathValue("id"), Encrypted: encrypted})
+}
+
+// handleEncrypt encrypts a conversation with the key in the
+// X-Conversation-Key header, sealing the messages it already has. From
+// then on its messages can only be read or added by requests carrying the
+// key; it is left out of compaction, exports and transcripts, and cannot
+// be merged or shared.
+func (s *Server) handleEncrypt(w http.ResponseWriter, r *http.Request) {
+	key, ok := requireKey(w, r)
+	if !ok {
+		return
+	}
+	if err := s.db.EncryptConversation(r.PathValue("id"), key); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, encryption{ConversationID: r.PathValue("id"), Encrypted: true})
+}
+
+// handleDecrypt stores an encrypted conversation as plain text again,
+// given its key.
+func (s *Server) handleDecrypt(w http.ResponseWriter, r *http.Request) {
+	key, ok := requireKey(w, r)
+	if !ok {
+		return
+	}
+	if err := s.db.DecryptConversation(r.PathValue("id"), key); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, encryption{ConversationID: r.PathValue("id"), Encrypted: false})
+}
+
+func requireKey(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	key, err := conversationKey(r)
+	if err == nil && key == nil {
+		err = errors.New(ConversationKeyHeader + " is required")
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return key, true
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/url"
+	"time"
+
+	"pi-agent/internal/store"
+)
+
+// exports are the data sets served as CSV by GET /export/{file}, by file
+// name. Each returns the header and rows of its records since a time;
+// the query string may narrow them further.
+var exports = map[string]func(db *store.DB, since time.Time, q url.Values) ([]string, [][]string, error){
+	"usage.csv": func(db *store.DB, since time.Time, q url.Values) ([]string, [][]string, error) {
+		day := ""
+		if !since.IsZero() {
+			day = since.Local().Format("2006-01-02")
+		}
+		list, err := db.PersonaUsageSince(day)
+		return store.PersonaUsageCSV, rows(list, store.PersonaUsage.CSV), err
+	},
+	"energy.csv": func(db *store.DB, since time.Time, q url.Values) ([]string, [][]string, error) {
+		list, err := db.EnergyReadings(q.Get("meter"), since)
+		return store.EnergyReadingCSV, rows(list, store.EnergyReading.CSV), err
+	},
+	"sensors.csv": func(db *store.DB, since time.Time, q url.Values) ([]string, [][]string, error) {
+		list, err := db.SensorReadings(q.Get("sensor"), since, time.Now())
+		return store.SensorReadingCSV, rows(list, store.SensorReading.CSV), err
+	},
+	"audit.csv": func(db *store.DB, since time.Time, q url.Values) ([]string, [][]string, error) {
+		list, err := db.ApprovalsSince(since)
+		return store.ApprovalCSV, rows(list, store.Approval.CSV), err
+	},
+	"tool-denials.csv": func(db *store.DB, since time.Time, q url.Values) ([]string, [][]string, error) {
+		list, err := db.ToolDenialsSince(since)
+		return store.ToolDenialCSV, rows(list, store.ToolDenial.CSV), err
+	},
+}
+
+// handleExportCSV serves usage accounting, energy and sensor history or
+// the audit logs as CSV, for spreadsheets and CSV data sources:
+//
+//	GET /export/usage.csv         messages and tokens per persona and day
+//	GET /export/energy.csv        energy meter readings; ?meter= for one meter
+//	GET /export/sensors.csv       recorded sensor readings; ?sensor= for one sensor
+//	GET /export/audit.csv         the approvals asked for and how they were decided
+//	GET /export/tool-denials.csv  tool calls a persona or channel may not make
+//
+// ?since= limits the rows to those since an RFC 3339 time or a duration
+// ago, e.g. 720h.
+func (s *Server) handleExportCSV(w http.ResponseWriter, r *http.Request) {
+	file := r.PathValue("file")
+	export, ok := exports[file]
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown export; want usage.csv, energy.csv, sensors.csv, audit.csv or tool-denials.csv")
+		return
+	}
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		var err error
+		if since, err = parseSince(v); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	header, records, err := export(s.db, since, r.URL.Query())
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+file+`"`)
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	cw.WriteAll(records)
+}
+
+func rows[T any](list []T, row func(T) []string) [][]string {
+	out := make([][]string, len(list))
+	for i, v := range list {
+		out[i] = row(v)
+	}
+	return out
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"pi-agent/internal/store"
+)
+
+func (s *Server) handleGetFeedback(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	f, err := s.db.Feedback(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, f)
+}
+
+// handleSetFeedback records a thumbs up or down and/or a comment on a
+// message, replacing earlier feedback.
+func (s *Server) handleSetFeedback(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Rating  string `json:"rating"`
+		Comment string `json:"comment"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if req.Rating != "" && req.Rating != store.RatingUp && req.Rating != store.RatingDown {
+		writeError(w, http.StatusBadRequest, `rating must be "up", "down" or empty`)
+		return
+	}
+	if req.Rating == "" && req.Comment == "" {
+		writeError(w, http.StatusBadRequest, "rating or comment is required")
+		return
+	}
+	f := &store.Feedback{MessageID: id, Rating: req.Rating, Comment: req.Comment}
+	if err := s.db.SetFeedback(f); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, f)
+}
+
+func (s *Server) handleDeleteFeedback(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if err := s.db.DeleteFeedback(id); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleExportFeedback exports feedback with the rated messages and their
+// prompts, as JSON lines or, with ?format=csv, CSV. ?since= limits it to
+// feedback given since an RFC 3339 time or a duration ago, e.g. 720h.
+func (s *Server) handleExportFeedback(w http.ResponseWriter, r *http.Request) {
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		var err error
+		if since, err = parseSince(v); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	records, err := s.db.FeedbackSince(since)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	switch r.URL.Query().Get("format") {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="feedback.csv"`)
+		cw := csv.NewWriter(w)
+		cw.Write(store.FeedbackCSV)
+		for _, rec := range records {
+			cw.Write(rec.CSV())
+		}
+		cw.Flush()
+	case "", "jsonl":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		for _, rec := range records {
+			enc.Encode(rec)
+		}
+	default:
+		writeError(w, http.StatusBadRequest, `format must be "jsonl" or "csv"`)
+	}
+}
+
+// parseSince parses an RFC 3339 time or a duration before now.
+func parseSince(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return time.Time{}, errInvalidSince
+	}
+	return time.Now().Add(-d), nil
+}
+
+var errInvalidSince = errors.New("since must be an RFC 3339 time or a duration such as 720h")
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"pi-agent/internal/store"
+)
+
+// The /grafana endpoints implement the SimpleJSON data source protocol,
+// which the Grafana JSON and Infinity data sources also speak, over the
+// time series of store.SeriesNames: dashboards chart messages, sensors,
+// energy, persona usage and speed tests without Prometheus. Point the
+// data source at http://<agent>/grafana.
+
+// grafanaQuery is the body of POST /grafana/query.
+type grafanaQuery struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	MaxDataPoints int `json:"maxDataPoints"`
+	Targets       []struct {
+		Target string `json:"target"`
+		Type   string `json:"type"` // "timeserie", the default, or "table"
+	} `json:"targets"`
+}
+
+// handleGrafanaTest answers the data source's connection test.
+func (s *Server) handleGrafanaTest(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleGrafanaSearch lists the series whose names contain the target,
+// e.g. {"target":"sensor."}.
+func (s *Server) handleGrafanaSearch(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Target string `json:"target"`
+	}
+	json.NewDecoder(r.Body).Decode(&req) // an empty body lists everything
+	names, err := s.db.SeriesNames()
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	out := []string{}
+	for _, n := range names {
+		if strings.Contains(n, req.Target) {
+			out = append(out, n)
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleGrafanaQuery returns each target's points in the range, averaged
+// down to at most maxDataPoints, as [value, unix milliseconds] pairs or
+// as a table of time and value.
+func (s *Server) handleGrafanaQuery(w http.ResponseWriter, r *http.Request) {
+	var req grafanaQuery
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if req.Range.To.IsZero() {
+		req.Range.To = time.Now()
+	}
+	if req.Range.From.IsZero() {
+		req.Range.From = req.Range.To.Add(-24 * time.Hour)
+	}
+	out := []any{}
+	for _, t := range req.Targets {
+		points, err := s.db.Series(t.Target, req.Range.From, req.Range.To)
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusBadRequest, "unknown target "+t.Target)
+			return
+		}
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		points = downsample(points, req.Range.From, req.Range.To, req.MaxDataPoints)
+		if t.Type == "table" {
+			rows := make([][]any, len(points))
+			for i, p := range points {
+				rows[i] = []any{p.Time.UnixMilli(), p.Value}
+			}
+			out = append(out, map[string]any{
+				"type":    "table",
+				"columns": []map[string]string{{"text": "Time", "type": "time"}, {"text": t.Target, "type": "number"}},
+				"rows":    rows,
+			})
+			continue
+		}
+		datapoints := make([][2]float64, len(points))
+		for i, p := range points {
+			datapoints[i] = [2]float64{p.Value, float64(p.Time.UnixMilli())}
+		}
+		out = append(out, map[string]any{"target": t.Target, "datapoints": datapoints})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleGrafanaAnnotations answers annotation queries; the agent has no
+// annotations of its own.
+func (s *Server) handleGrafanaAnnotations(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, []any{})
+}
+
+// downsample averages points into at most maxPoints buckets of equal
+// length over [from, to), each at the time of its first point. Zero keeps
+// every point.
+func downsample(points []store.Point, from, to time.Time, maxPoints int) []store.Point {
+	if maxPoints <= 0 || len(points) <= maxPoints {
+		return points
+	}
+	width := to.Sub(from) / time.Duration(maxPoints)
+	if width <= 0 {
+		return points
+	}
+	var out []store.Point
+	var sum float64
+	var n int
+	bucket := -1
+	for _, p := range points {
+		b := int(p.Time.Sub(from) / width)
+		if b != bucket && n > 0 {
+			out[len(out)-1].Value = sum / float64(n)
+			sum, n = 0, 0
+		}
+		if b != bucket {
+			out = append(out, store.Point{Time: p.Time})
+			bucket = b
+		}
+		sum += p.Value
+		n++
+	}
+	if n > 0 {
+		out[len(out)-1].Value = sum / float64(n)
+	}
+	return out
+}
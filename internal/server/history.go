@@ -0,0 +1,63 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// handleEditMessage replaces a message's content with {"content":"..."}.
+// What it said before is kept and listed by GET /messages/{id}/revisions.
+func (s *Server) handleEditMessage(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		writeError(w, http.StatusBadRequest, "content is required")
+		return
+	}
+	m, err := s.db.EditMessage(id, req.Content)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, message{ID: m.ID, Role: m.Role, Content: m.Content, AudioRef: m.AudioRef, Fallback: m.Fallback, Speaker: m.Speaker, CreatedAt: m.CreatedAt})
+}
+
+// handleDeleteMessage deletes a message. It is left out of the
+// conversation from then on but still shown by ?as_of= queries for
+// earlier times.
+func (s *Server) handleDeleteMessage(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if err := s.db.DeleteMessage(id); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListRevisions returns the earlier versions of a message, oldest
+// first, including what compaction replaced with a summary.
+func (s *Server) handleListRevisions(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	revs, err := s.db.MessageRevisions(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, revs)
+}
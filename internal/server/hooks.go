@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"pi-agent/internal/notify"
+)
+
+// hookTimeout bounds the model turn started by a webhook.
+const hookTimeout = 5 * time.Minute
+
+// handleHook turns an inbound webhook payload into a prompt for the hook's
+// conversation. The turn runs in the background so senders are not held
+// waiting on the model; the reply lands in the conversation and, if the
+// hook asks for it, in a notification.
+func (s *Server) handleHook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := s.hooks[r.PathValue("name")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "reading body failed")
+		return
+	}
+	if !hookAuthorized(hook.Secret, r, body) {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var payload any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		payload = string(body)
+	}
+	prompt, err := hook.Render(payload)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	p, err := s.engine.Profile(hook.Persona, "")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+		defer cancel()
+		reply, err := s.engine.Converse(ctx, hook.ConversationID, prompt, p)
+		if err != nil {
+			log.Printf("hook %s: %v", hook.Name, err)
+			return
+		}
+		if hook.Notify && s.cfg.Notifier != nil && reply != "" {
+			if err := s.cfg.Notifier.Notify(ctx, notify.Message{Title: hook.Name, Body: reply}); err != nil {
+				log.Printf("hook %s notification failed: %v", hook.Name, err)
+			}
+		}
+	}()
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "accepted"})
+}
+
+// hookAuthorized checks a hook secret, given verbatim in X-Hook-Secret or
+// ?secret=, or as a GitHub-style X-Hub-Signature-256 HMAC of the body.
+func hookAuthorized(secret string, r *http.Request, body []byte) bool {
+	if sig, ok := strings.CutPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256="); ok {
+		want, err := hex.DecodeString(sig)
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		return hmac.Equal(mac.Sum(nil), want)
+	}
+	given := r.Header.Get("X-Hook-Secret")
+	if given == "" {
+		given = r.URL.Query().Get("secret")
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte(secret)) == 1
+}
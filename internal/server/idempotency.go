@@ -0,0 +1,172 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"pi-agent/internal/store"
+)
+
+// DefaultIdempotencyTTL is how long Idempotency-Keys are remembered by
+// default.
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// Limits on remembered requests: keys in progress for longer than
+// idempotencyAbandoned are assumed to belong to a request that never
+// finished, and responses longer than maxIdempotentResponse are not kept.
+const (
+	idempotencyAbandoned  = 15 * time.Minute
+	maxIdempotencyKey     = 255
+	maxIdempotentResponse = 1 << 20
+)
+
+// idempotent serves retries of a request sent with the same
+// Idempotency-Key header the response to the first, so that a client
+// retrying over a flaky link, or a webhook redelivered, does not post the
+// message or run the model twice. Keys are per user and path. A retry
+// arriving while the first request is still being served is refused with
+// 409, and a key reused for a different body with 422. Requests without
+// the header are served as usual.
+func (s *Server) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		// Responses from encrypted conversations would be kept in plain
+		// text, so requests carrying a key to one are not remembered.
+		if key == "" || r.Header.Get(ConversationKeyHeader) != "" {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			writeError(w, http.StatusBadRequest, "Idempotency-Key is too long")
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "reading body: "+err.Error())
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+
+		ttl := s.cfg.IdempotencyTTL
+		if ttl <= 0 {
+			ttl = DefaultIdempotencyTTL
+		}
+		k := &store.IdempotencyKey{
+			Scope:       requestUser(r) + " " + r.Method + " " + r.URL.Path,
+			Key:         key,
+			RequestHash: hex.EncodeToString(sum[:]),
+			ExpiresAt:   time.Now().Add(ttl),
+		}
+		existing, err := s.db.ClaimIdempotencyKey(k, time.Now().Add(-idempotencyAbandoned))
+		if errors.Is(err, store.ErrNotFound) {
+			// The other request released the key as we looked.
+			existing, err = s.db.ClaimIdempotencyKey(k, time.Now().Add(-idempotencyAbandoned))
+		}
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		switch {
+		case existing == nil:
+		case existing.RequestHash != k.RequestHash:
+			writeError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+			return
+		case existing.Status == 0:
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusConflict, "a request with this Idempotency-Key is still in progress")
+			return
+		default:
+			if existing.ContentType != "" {
+				w.Header().Set("Content-Type", existing.ContentType)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(existing.Status)
+			w.Write(existing.Body)
+			return
+		}
+
+		rec := &recordingWriter{ResponseWriter: w}
+		defer func() {
+			// Only successes are remembered, so that a retry after an
+			// error, such as a wrong hook secret or a stream that failed
+			// after its 200, is served afresh; nor are responses too long
+			// to keep.
+			if rec.status < 200 || rec.status >= 300 || rec.failed || rec.overflow {
+				if err := s.db.ReleaseIdempotencyKey(k.Scope, k.Key); err != nil {
+					log.Printf("idempotency: %v", err)
+				}
+				return
+			}
+			if err := s.db.CompleteIdempotencyKey(k.Scope, k.Key, rec.status, rec.contentType, rec.body.Bytes()); err != nil {
+				log.Printf("idempotency: %v", err)
+			}
+		}()
+		next(rec, r)
+	}
+}
+
+// recordingWriter passes a response through while keeping a copy.
+type recordingWriter struct {
+	http.ResponseWriter
+	status      int
+	contentType string
+	body        bytes.Buffer
+	overflow    bool
+	failed      bool // see failResponse
+}
+
+// failResponse marks a response whose error was reported in the body,
+// after its status was sent, so that it is not remembered for its
+// Idempotency-Key.
+func failResponse(w http.ResponseWriter) {
+	for {
+		switch x := w.(type) {
+		case *recordingWriter:
+			x.failed = true
+			return
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = x.Unwrap()
+		default:
+			return
+		}
+	}
+}
+
+func (rw *recordingWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+		rw.contentType = rw.Header().Get("Content-Type")
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingWriter) Write(p []byte) (int, error) {
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if !rw.overflow {
+		if rw.body.Len()+len(p) > maxIdempotentResponse {
+			rw.overflow = true
+			rw.body.Reset()
+		} else {
+			rw.body.Write(p)
+		}
+	}
+	return rw.ResponseWriter.Write(p)
+}
+
+func (rw *recordingWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rw *recordingWriter) Unwrap() http.ResponseWriter { return rw.ResponseWriter }
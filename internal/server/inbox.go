@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"pi-agent/internal/store"
+)
+
+// maxDeviceLen bounds device IDs, which clients choose themselves.
+const maxDeviceLen = 128
+
+func validDevice(device string) bool {
+	return device != "" && len(device) <= maxDeviceLen && strings.TrimSpace(device) == device
+}
+
+// handleInbox returns the conversations with assistant messages the device
+// named by ?device= has not seen, with the total unread count, so replies
+// from schedules and webhooks wait like mail instead of scrolling away.
+func (s *Server) handleInbox(w http.ResponseWriter, r *http.Request) {
+	device := r.URL.Query().Get("device")
+	if !validDevice(device) {
+		writeError(w, http.StatusBadRequest, "device is required")
+		return
+	}
+	entries, err := s.db.Inbox(device)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if entries == nil {
+		entries = []store.InboxEntry{}
+	}
+	unread := 0
+	for _, e := range entries {
+		unread += e.Unread
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"device": device, "unread": unread, "conversations": entries})
+}
+
+// handleMarkRead moves a device's read marker in a conversation up to a
+// message, or to the latest message when message_id is omitted.
+func (s *Server) handleMarkRead(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Device    string `json:"device"`
+		MessageID int64  `json:"message_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if !validDevice(req.Device) || req.MessageID < 0 {
+		writeError(w, http.StatusBadRequest, "device is required and message_id must not be negative")
+		return
+	}
+	read, err := s.db.MarkRead(req.Device, r.PathValue("id"), req.MessageID)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"device": req.Device, "conversation_id": r.PathValue("id"), "last_read_id": read})
+}
+
+// handleMarkAllRead marks every conversation read on a device.
+func (s *Server) handleMarkAllRead(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Device string `json:"device"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if !validDevice(req.Device) {
+		writeError(w, http.StatusBadRequest, "device is required")
+		return
+	}
+	if err := s.db.MarkAllRead(req.Device); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"pi-agent/internal/audio"
+	"pi-agent/internal/store"
+)
+
+// respondLocal stores and streams the reply to a locally handled intent
+// using the same framing, SSE or NDJSON, as a model response.
+func (s *Server) respondLocal(w http.ResponseWriter, r *http.Request, user store.Message, name, reply string, err error) {
+	if err != nil {
+		log.Printf("intent %s error: %v", name, err)
+		s.engine.PlayCue(audio.CueError)
+		reply = "Sorry, I couldn't do that: " + err.Error()
+	}
+
+	user.Role = store.RoleUser
+	if err := s.db.InsertMessage(&user); err != nil {
+		log.Printf("db error: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if err := s.db.AddMessage(user.ConversationID, store.RoleAssistant, reply); err != nil {
+		log.Printf("db error saving response: %v", err)
+	} else {
+		s.engine.Replied(user.ConversationID, reply)
+	}
+
+	writeLocalReply(w, r, user.ConversationID, reply, "intent", name)
+}
+
+// writeLocalReply streams a reply that did not come from the model as a
+// single delta. NDJSON's done object names what answered it under key,
+// e.g. "intent".
+func writeLocalReply(w http.ResponseWriter, r *http.Request, convID, reply, key, name string) {
+	if acceptsNDJSON(r) {
+		out := newNDJSONWriter(w)
+		out.write(map[string]any{"type": "delta", "content": reply})
+		out.write(map[string]any{"type": "done", "conversation_id": convID, "content": reply, key: name})
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	chunk, _ := json.Marshal(map[string]string{"content": reply})
+	fmt.Fprintf(w, "data: %s\n\n", chunk)
+	fmt.Fprintf(w, "data: [DONE]\n\n")
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"pi-agent/internal/store"
+)
+
+// listenUnix listens on a Unix socket readable and writable only by the
+// owner and group, so filesystem permissions decide who may use the API.
+// A stale socket left by an earlier run is replaced.
+func listenUnix(path string) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another process", path)
+		}
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o660); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// fifoTimeout bounds a single FIFO request.
+const fifoTimeout = 5 * time.Minute
+
+// fifoReply is written to the out FIFO for each request line.
+type fifoReply struct {
+	ConversationID string `json:"conversation_id"`
+	Reply          string `json:"reply,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// startFIFO serves the line protocol: each line written to <dir>/in is a
+// chat message, optionally prefixed with a conversation ID and a tab, and
+// each reply is written to <dir>/out as one JSON object per line. Replies
+// are dropped when nothing is reading the out FIFO.
+func (s *Server) startFIFO(dir string) error {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return err
+	}
+	in, out := filepath.Join(dir, "in"), filepath.Join(dir, "out")
+	for _, p := range []string{in, out} {
+		if err := mkfifo(p); err != nil {
+			return err
+		}
+	}
+	go func() {
+		for {
+			// Opening blocks until a writer appears; EOF means the
+			// writer closed, so reopen and wait for the next one.
+			f, err := os.Open(in)
+			if err != nil {
+				log.Printf("fifo: %v", err)
+				time.Sleep(time.Second)
+				continue
+			}
+			sc := bufio.NewScanner(f)
+			sc.Buffer(make([]byte, 64<<10), 1<<20)
+			for sc.Scan() {
+				s.handleFIFOLine(out, sc.Text())
+			}
+			f.Close()
+		}
+	}()
+	return nil
+}
+
+func mkfifo(path string) error {
+	fi, err := os.Stat(path)
+	if err == nil {
+		if fi.Mode()&os.ModeNamedPipe == 0 {
+			return fmt.Errorf("%s exists and is not a FIFO", path)
+		}
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := syscall.Mkfifo(path, 0o660); err != nil {
+		return fmt.Errorf("creating FIFO %s: %w", path, err)
+	}
+	return nil
+}
+
+func (s *Server) handleFIFOLine(out, line string) {
+	convID, message, ok := strings.Cut(line, "\t")
+	if !ok {
+		convID, message = s.cfg.ConversationID, line
+	}
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), fifoTimeout)
+	defer cancel()
+	resp := fifoReply{ConversationID: convID}
+	reply, err := s.localOrConverse(ctx, convID, message)
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	resp.Reply = reply
+
+	f, err := os.OpenFile(out, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		log.Printf("fifo: dropping reply, no reader: %v", err)
+		return
+	}
+	defer f.Close()
+	data, _ := json.Marshal(resp)
+	f.Write(append(data, '\n'))
+}
+
+// localOrConverse answers a message with a local intent if one matches,
+// and with a full model turn otherwise.
+func (s *Server) localOrConverse(ctx context.Context, convID, message string) (string, error) {
+	if name, reply, err := s.commands.Route(ctx, CommandCall{ConversationID: convID}, message, false); name != "" {
+		return reply, err
+	}
+	s.expireContext(convID, "fifo")
+	p, err := s.engine.Profile(s.conversationPersona(convID), "")
+	if err != nil {
+		return "", err
+	}
+	p.Channel = "fifo"
+	if s.cfg.Intents != nil {
+		permit := func(tool string) error { return s.engine.AllowTool(convID, p, tool) }
+		if name, reply, err := s.cfg.Intents.Route(ctx, convID, message, permit); name != "" {
+			if err != nil {
+				return "", err
+			}
+			if err := s.db.AddMessage(convID, store.RoleUser, message); err != nil {
+				return "", err
+			}
+			if err := s.db.AddMessage(convID, store.RoleAssistant, reply); err != nil {
+				return "", err
+			}
+			return reply, nil
+		}
+	}
+	return s.engine.Converse(ctx, convID, message, p)
+}
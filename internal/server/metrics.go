@@ -0,0 +1,66 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"pi-agent/internal/store"
+)
+
+// handleMetrics serves gauges in the Prometheus text format, so the
+// household dashboard can chart them next to everything else.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if s.cfg.Thermal != nil {
+		st := s.cfg.Thermal.Status()
+		hot := 0.0
+		if st.Hot {
+			hot = 1
+		}
+		gauge(w, "pi_agent_cpu_temperature_celsius", "CPU temperature at the last reading.", st.Celsius)
+		gauge(w, "pi_agent_thermal_paused", "Whether background work is paused because the CPU is hot.", hot)
+		counter(w, "pi_agent_thermal_pauses_total", "Times background work was paused because the CPU was hot.", float64(st.Pauses))
+	}
+	if s.cfg.Buffer != nil {
+		st := s.cfg.Buffer.Status()
+		failing := 0.0
+		if st.Err != nil {
+			failing = 1
+		}
+		if !st.FlushedAt.IsZero() {
+			gauge(w, "pi_agent_db_flushed_timestamp_seconds", "Time the buffered database was last written back to the data partition.", float64(st.FlushedAt.Unix()))
+		}
+		gauge(w, "pi_agent_db_flush_failing", "Whether the last write-back of the buffered database failed.", failing)
+		counter(w, "pi_agent_db_flushes_total", "Write-backs of the buffered database.", float64(st.Flushes))
+	}
+	t, err := s.db.LatestSpeedTest()
+	if errors.Is(err, store.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	day, err := s.db.SpeedTestStats(now.Add(-24*time.Hour), now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	gauge(w, "pi_agent_speed_test_download_mbps", "Download speed measured by the last successful speed test.", t.DownloadMbps)
+	gauge(w, "pi_agent_speed_test_upload_mbps", "Upload speed measured by the last successful speed test.", t.UploadMbps)
+	gauge(w, "pi_agent_speed_test_latency_ms", "Latency measured by the last successful speed test.", t.LatencyMs)
+	gauge(w, "pi_agent_speed_test_timestamp_seconds", "When the last successful speed test ran.", float64(t.TestedAt.Unix()))
+	gauge(w, "pi_agent_speed_test_failures_24h", "Speed tests that failed in the last 24 hours.", float64(day.Failed))
+}
+
+func counter(w io.Writer, name, help string, v float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %g\n", name, help, name, name, v)
+}
+
+func gauge(w io.Writer, name, help string, v float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", name, help, name, name, v)
+}
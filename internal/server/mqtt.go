@@ -0,0 +1,55 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"pi-agent/internal/store"
+)
+
+func (s *Server) handleGetMQTTOutput(w http.ResponseWriter, r *http.Request) {
+	o, err := s.db.MQTTOutput(r.PathValue("id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, o)
+}
+
+// handleSetMQTTOutput mirrors a conversation's replies to an MQTT topic.
+// Complete replies are published, and retained, unless the body turns
+// "replies" or "retain" off; "deltas" also publishes fragments as they
+// stream.
+func (s *Server) handleSetMQTTOutput(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Topic   string `json:"topic"`
+		Replies *bool  `json:"replies"`
+		Deltas  bool   `json:"deltas"`
+		Retain  *bool  `json:"retain"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	o := store.MQTTOutput{ConversationID: r.PathValue("id"), Topic: req.Topic, Replies: true, Deltas: req.Deltas, Retain: true}
+	if req.Replies != nil {
+		o.Replies = *req.Replies
+	}
+	if req.Retain != nil {
+		o.Retain = *req.Retain
+	}
+	saved, err := s.cfg.MQTT.Bind(o)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, saved)
+}
+
+func (s *Server) handleDeleteMQTTOutput(w http.ResponseWriter, r *http.Request) {
+	if err := s.cfg.MQTT.Unbind(r.PathValue("id")); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"pi-agent/engine"
+	"pi-agent/internal/codeblock"
+)
+
+// ndjsonType is the media type of newline-delimited JSON.
+const ndjsonType = "application/x-ndjson"
+
+// acceptsNDJSON reports whether a chat client asked for newline-delimited
+// JSON rather than SSE.
+func acceptsNDJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), ndjsonType)
+}
+
+// ndjsonWriter writes one JSON object per line, flushing each.
+type ndjsonWriter struct {
+	enc     *json.Encoder
+	flusher http.Flusher
+}
+
+func newNDJSONWriter(w http.ResponseWriter) *ndjsonWriter {
+	w.Header().Set("Content-Type", ndjsonType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	f, _ := w.(http.Flusher)
+	return &ndjsonWriter{enc: json.NewEncoder(w), flusher: f}
+}
+
+func (n *ndjsonWriter) write(v map[string]any) {
+	n.enc.Encode(v) // Encode ends each object with a newline
+	if n.flusher != nil {
+		n.flusher.Flush()
+	}
+}
+
+// streamNDJSON runs a turn and streams it as newline-delimited JSON, for
+// clients that would rather not parse SSE framing:
+//
+//	{"type":"progress","stage":"model_started","round":1,"tokens_so_far":0}
+//	{"type":"delta","content":"Hel"}
+//	{"type":"tool","call_id":"call_1","name":"clock","arguments":"{}","output":"12:00","duration_ms":3}
+//	{"type":"usage","input_tokens":812,"output_tokens":41}
+//	{"type":"done","conversation_id":"default","content":"Hello ...","message_id":7}
+//	{"type":"suggestions","suggestions":["Tell me more","Why?"]}
+//
+// Suggestions, if enabled, follow done. A failed turn ends with
+// {"type":"error","error":"..."} instead of done.
+func (s *Server) streamNDJSON(w http.ResponseWriter, r *http.Request, req ChatRequest, t *engine.Turn) {
+	out := newNDJSONWriter(w)
+	t.OnProgress(func(p engine.Progress) {
+		event := map[string]any{"type": "progress", "stage": p.Stage, "tokens_so_far": p.Tokens}
+		if p.Round != 0 {
+			event["round"] = p.Round
+		}
+		if p.Tool != "" {
+			event["tool"] = p.Tool
+		}
+		out.write(event)
+	})
+	t.OnTool(func(ev engine.ToolEvent) {
+		out.write(map[string]any{
+			"type": "tool", "call_id": ev.CallID, "name": ev.Name,
+			"arguments": ev.Arguments, "output": ev.Output, "duration_ms": ev.Duration.Milliseconds(),
+		})
+	})
+	reply, err := s.engine.Run(r.Context(), t, func(content string) {
+		out.write(map[string]any{"type": "delta", "content": content})
+	})
+	if err != nil {
+		failResponse(w)
+		out.write(map[string]any{"type": "error", "error": err.Error()})
+		return
+	}
+	if u := t.Usage(); u.InputTokens+u.OutputTokens > 0 {
+		out.write(map[string]any{"type": "usage", "input_tokens": u.InputTokens, "output_tokens": u.OutputTokens})
+	}
+	done := map[string]any{"type": "done", "conversation_id": t.ConversationID(), "content": reply}
+	if id := t.ReplyID(); id != 0 {
+		done["message_id"] = id
+	}
+	if fallback := t.Fallback(); fallback != "" {
+		done["fallback"] = fallback
+	}
+	if speaker := t.Speaker(); speaker != "" {
+		done["speaker"] = speaker
+	}
+	if cites := t.Citations(); len(cites) > 0 {
+		done["citations"] = cites
+	}
+	if blocks := codeblock.Parse(reply); len(blocks) > 0 && t.ReplyID() != 0 {
+		done["code_blocks"] = blocks
+	}
+	out.write(done)
+	if list := s.suggestions(r, req, t, reply); len(list) > 0 {
+		out.write(map[string]any{"type": "suggestions", "suggestions": list})
+	}
+}
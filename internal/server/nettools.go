@@ -0,0 +1,72 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"pi-agent/internal/nettools"
+)
+
+func (s *Server) handlePing(w http.ResponseWriter, r *http.Request) {
+	count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+	if count == 0 {
+		count = 4
+	}
+	p, err := s.cfg.Net.Ping(r.Context(), r.URL.Query().Get("host"), count)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (s *Server) handleDNSLookup(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("name") == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	d, err := nettools.Lookup(r.Context(), q.Get("name"), q.Get("type"), q.Get("server"))
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, d)
+}
+
+func (s *Server) handleTraceroute(w http.ResponseWriter, r *http.Request) {
+	host := r.URL.Query().Get("host")
+	out, err := s.cfg.Net.Traceroute(r.Context(), host)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"host": host, "output": out})
+}
+
+func (s *Server) handlePortCheck(w http.ResponseWriter, r *http.Request) {
+	host := r.URL.Query().Get("host")
+	port, err := strconv.Atoi(r.URL.Query().Get("port"))
+	if host == "" || err != nil || port <= 0 || port > 65535 {
+		writeError(w, http.StatusBadRequest, "host and a valid port are required")
+		return
+	}
+	writeJSON(w, http.StatusOK, nettools.CheckPort(r.Context(), host, port, 5*time.Second))
+}
+
+func (s *Server) handleScanLAN(w http.ResponseWriter, r *http.Request) {
+	devices, err := nettools.ScanLAN(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if devices == nil {
+		devices = []nettools.Device{}
+	}
+	writeJSON(w, http.StatusOK, devices)
+}
+
+func (s *Server) handleDiagnose(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.cfg.Net.Diagnose(r.Context(), r.URL.Query().Get("target")))
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"pi-agent/internal/patch"
+	"pi-agent/internal/store"
+)
+
+func (s *Server) handleListPatches(w http.ResponseWriter, r *http.Request) {
+	list, err := s.db.Patches()
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if list == nil {
+		list = []store.Patch{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleGetPatch(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	p, err := s.db.Patch(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// handleProposePatch dry-runs a diff and, unless dry_run is set, queues it
+// for approval.
+func (s *Server) handleProposePatch(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Dir            string `json:"dir"`
+		Diff           string `json:"diff"`
+		Summary        string `json:"summary"`
+		DryRun         bool   `json:"dry_run"`
+		ConversationID string `json:"conversation_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if strings.TrimSpace(req.Diff) == "" {
+		writeError(w, http.StatusBadRequest, "diff is required")
+		return
+	}
+	dir, err := s.cfg.Patches.ResolveDir(req.Dir)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.DryRun {
+		plan, err := s.cfg.Patches.DryRun(r.Context(), dir, req.Diff)
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, plan)
+		return
+	}
+	a, plan, err := s.cfg.Patches.Propose(r.Context(), req.ConversationID, dir, req.Diff, req.Summary)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]any{"approval": a, "plan": plan})
+}
+
+func (s *Server) handleRollbackPatch(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Force bool `json:"force"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+	}
+	p, err := s.cfg.Patches.Rollback(id, req.Force)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		writeStoreError(w, err)
+	case errors.Is(err, patch.ErrModified):
+		writeError(w, http.StatusConflict, err.Error()+`; send {"force": true} to roll back anyway`)
+	case err != nil:
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, p)
+	}
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"pi-agent/internal/store"
+)
+
+// handlePinMessage pins a message so that it is always sent with its
+// conversation, e.g. a standing instruction such as "we are planning the
+// Italy trip in this thread", however long the conversation grows.
+func (s *Server) handlePinMessage(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	m, err := s.db.PinMessage(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	out := apiMessage(*m)
+	out.Pinned = true
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleUnpinMessage(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if err := s.db.UnpinMessage(id); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleListPins(w http.ResponseWriter, r *http.Request) {
+	msgs, err := s.db.PinnedMessages(r.PathValue("id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	out := make([]message, len(msgs))
+	for i, m := range msgs {
+		out[i] = apiMessage(m)
+		out[i].Pinned = true
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// commandPin pins the text it is given as a message of its own, or else
+// the conversation's latest message.
+func (s *Server) commandPin(ctx context.Context, call CommandCall) (string, error) {
+	if call.Args != "" {
+		m := &store.Message{ConversationID: call.ConversationID, Role: store.RoleUser, Content: call.Args, Speaker: call.User}
+		if err := s.db.InsertMessage(m); err != nil {
+			return "", err
+		}
+		if _, err := s.db.PinMessage(m.ID); err != nil {
+			return "", err
+		}
+		return "Pinned; I'll keep that in mind for the rest of this conversation.", nil
+	}
+	latest, err := s.db.MessagesBefore(call.ConversationID, 0, 1)
+	if err != nil {
+		return "", err
+	}
+	if len(latest) == 0 {
+		return "Nothing to pin yet. Send /pin <text> to pin a note.", nil
+	}
+	if _, err := s.db.PinMessage(latest[0].ID); err != nil {
+		return "", err
+	}
+	return "Pinned the last message.", nil
+}
+
+func (s *Server) commandUnpin(ctx context.Context, call CommandCall) (string, error) {
+	n, err := s.db.UnpinConversation(call.ConversationID)
+	if err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return "Nothing is pinned in this conversation.", nil
+	}
+	return fmt.Sprintf("Unpinned %d messages.", n), nil
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"pi-agent/internal/policy"
+)
+
+func (s *Server) handlePolicyStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := s.cfg.Policy.Status()
+	if err != nil {
+		log.Printf("db error: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if status == nil {
+		status = []policy.Status{}
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleOverride lifts a persona's hours and daily caps for the given
+// number of minutes (default 60). The body must carry the admin PIN.
+func (s *Server) handleOverride(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		PIN     string `json:"pin"`
+		Minutes int    `json:"minutes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if req.Minutes == 0 {
+		req.Minutes = 60
+	}
+	persona := r.PathValue("persona")
+	until, err := s.cfg.Policy.Override(persona, req.PIN, time.Duration(req.Minutes)*time.Minute)
+	if errors.Is(err, policy.ErrPIN) {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"persona": persona, "until": until})
+}
+
+func (s *Server) handleEndOverride(w http.ResponseWriter, r *http.Request) {
+	s.cfg.Policy.EndOverride(r.PathValue("persona"))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"pi-agent/internal/presence"
+)
+
+func (s *Server) handlePresence(w http.ResponseWriter, r *http.Request) {
+	statuses := s.cfg.Presence.Statuses()
+	if statuses == nil {
+		statuses = []presence.Status{}
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// handleOwnTracks accepts OwnTracks HTTP-mode reports. The person is the
+// OwnTracks username (sent as X-Limit-U and as the basic auth user), and
+// the basic auth password must match the geofence secret.
+func (s *Server) handleOwnTracks(w http.ResponseWriter, r *http.Request) {
+	if !s.geofenceAuthorized(r) {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	person := r.Header.Get("X-Limit-U")
+	if user, _, ok := r.BasicAuth(); ok && person == "" {
+		person = user
+	}
+	if person == "" {
+		person = r.URL.Query().Get("user")
+	}
+	if person == "" {
+		writeError(w, http.StatusBadRequest, "cannot tell which user this report is for")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "reading body failed")
+		return
+	}
+	home, ok, err := presence.ParseOwnTracks(body, s.cfg.GeofenceHome)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if ok {
+		s.cfg.Presence.Set(person, home, "owntracks")
+	}
+	// OwnTracks expects a JSON array of messages to deliver back.
+	writeJSON(w, http.StatusOK, []any{})
+}
+
+// handlePresenceWebhook accepts generic location updates, e.g. from a
+// Home Assistant automation: {"person": "alice", "state": "home"}.
+// Zone states other than "home" count as away.
+func (s *Server) handlePresenceWebhook(w http.ResponseWriter, r *http.Request) {
+	if !s.geofenceAuthorized(r) {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	var req struct {
+		Person string `json:"person"`
+		State  string `json:"state"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if req.Person == "" || req.State == "" {
+		writeError(w, http.StatusBadRequest, "person and state are required")
+		return
+	}
+	state := strings.ToLower(req.State)
+	home := state == "home" || state == "arrived" || state == "enter"
+	s.cfg.Presence.Set(req.Person, home, "webhook")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// geofenceAuthorized checks the geofence secret, given either as the basic
+// auth password or a token query parameter.
+func (s *Server) geofenceAuthorized(r *http.Request) bool {
+	if s.cfg.GeofenceSecret == "" {
+		return false
+	}
+	given := r.URL.Query().Get("token")
+	if _, pass, ok := r.BasicAuth(); ok {
+		given = pass
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte(s.cfg.GeofenceSecret)) == 1
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"pi-agent/internal/store"
+)
+
+// serviceWorker shows pushed notifications. Push subscriptions do not
+// depend on the worker's scope, so a page anywhere can register it from
+// /push/sw.js and subscribe with the key from GET /push/key.
+const serviceWorker = `self.addEventListener("push", (event) => {
+  let msg = {};
+  try { msg = event.data ? event.data.json() : {}; } catch (e) { msg = { body: event.data.text() }; }
+  event.waitUntil(self.registration.showNotification(msg.title || "pi-agent", {
+    body: msg.body || "",
+    tag: (msg.tags || []).join(",") || undefined,
+    requireInteraction: msg.priority >= 5,
+  }));
+});
+
+self.addEventListener("notificationclick", (event) => {
+  event.notification.close();
+  event.waitUntil(clients.openWindow("/"));
+});
+`
+
+func (s *Server) handlePushKey(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"public_key": s.cfg.Push.PublicKey()})
+}
+
+func (s *Server) handleServiceWorker(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/javascript")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write([]byte(serviceWorker))
+}
+
+// handleSubscribe saves a browser's push subscription, in the shape
+// PushSubscription.toJSON() gives it, optionally with the device and user
+// it belongs to.
+func (s *Server) handleSubscribe(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Endpoint string `json:"endpoint"`
+		Keys     struct {
+			P256DH string `json:"p256dh"`
+			Auth   string `json:"auth"`
+		} `json:"keys"`
+		Device string `json:"device"`
+		User   string `json:"user"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	sub := store.PushSubscription{Endpoint: req.Endpoint, P256DH: req.Keys.P256DH, Auth: req.Keys.Auth, Device: req.Device, User: req.User}
+	if err := s.cfg.Push.Subscribe(&sub); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) handleUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Endpoint string `json:"endpoint"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if err := s.db.DeletePushSubscription(req.Endpoint); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"pi-agent/engine"
+	"pi-agent/internal/policy"
+	"pi-agent/internal/store"
+)
+
+func (s *Server) handleGetRelay(w http.ResponseWriter, r *http.Request) {
+	relay, err := s.db.Relay(r.PathValue("id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, relay)
+}
+
+// handleSetRelay puts a conversation in translation relay mode between
+// two participants, e.g.
+//
+//	{"participants":[{"label":"Ana","language":"Portuguese"},{"label":"Tom","language":"English"}]}
+//
+// From then on each message sent to the conversation is translated for
+// the other participant instead of answered. Chat requests say who is
+// speaking with "speaker"; without it the language decides.
+func (s *Server) handleSetRelay(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Participants []store.RelayParticipant `json:"participants"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if len(req.Participants) != 2 {
+		writeError(w, http.StatusBadRequest, "a relay needs exactly two participants")
+		return
+	}
+	relay := store.Relay{ConversationID: r.PathValue("id")}
+	for i, p := range req.Participants {
+		p.Label, p.Language = strings.TrimSpace(p.Label), strings.TrimSpace(p.Language)
+		if p.Label == "" || p.Language == "" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("participants[%d]: label and language are required", i))
+			return
+		}
+		relay.Participants[i] = p
+	}
+	if strings.EqualFold(relay.Participants[0].Label, relay.Participants[1].Label) {
+		writeError(w, http.StatusBadRequest, "participants need different labels")
+		return
+	}
+	if _, err := s.db.Room(relay.ConversationID); err == nil {
+		writeError(w, http.StatusConflict, "the conversation is a room")
+		return
+	} else if !errors.Is(err, store.ErrNotFound) {
+		writeStoreError(w, err)
+		return
+	}
+	if err := s.db.SetRelay(&relay); err != nil {
+		log.Printf("db error: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	saved, err := s.db.Relay(relay.ConversationID)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, saved)
+}
+
+func (s *Server) handleDeleteRelay(w http.ResponseWriter, r *http.Request) {
+	if err := s.db.DeleteRelay(r.PathValue("id")); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// relayChat answers a chat request in a relay conversation with a
+// streamed translation. The stream is the usual SSE or NDJSON one, with
+// the label of the participant the translation is for in a "speaker"
+// field: an {"speaker"} event before [DONE], or on the done object.
+func (s *Server) relayChat(w http.ResponseWriter, r *http.Request, relay *store.Relay, user store.Message, p engine.Profile) {
+	// The translation is read to the listener, not the sender, so the
+	// sender's voice settings do not apply; a listener known in advance
+	// who is also a configured user gets theirs.
+	w.Header().Del("X-Speech-Voice")
+	w.Header().Del("X-Speech-Language")
+	for i, pt := range relay.Participants {
+		if strings.EqualFold(pt.Label, strings.TrimSpace(user.Speaker)) {
+			for _, u := range s.engine.Users() {
+				if strings.EqualFold(u.Name, relay.Participants[1-i].Label) {
+					setSpeechHeaders(w, u.Speech)
+				}
+			}
+		}
+	}
+
+	ndjson := acceptsNDJSON(r)
+	var out *ndjsonWriter
+	var flusher http.Flusher
+	started := false
+	start := func() {
+		if started {
+			return
+		}
+		started = true
+		if ndjson {
+			out = newNDJSONWriter(w)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		flusher, _ = w.(http.Flusher)
+	}
+	reply, listener, err := s.engine.Relay(r.Context(), relay, user, p, func(content string) {
+		start()
+		if ndjson {
+			out.write(map[string]any{"type": "delta", "content": content})
+			return
+		}
+		chunk, _ := json.Marshal(map[string]string{"content": content})
+		fmt.Fprintf(w, "data: %s\n\n", chunk)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	})
+	if err != nil && !started {
+		switch {
+		case errors.Is(err, policy.ErrRestricted):
+			writeError(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, engine.ErrAuth):
+			writeError(w, http.StatusUnauthorized, err.Error())
+		case errors.Is(err, engine.ErrPrivate):
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+		default:
+			log.Printf("relay error: %v", err)
+			writeError(w, http.StatusBadGateway, err.Error())
+		}
+		return
+	}
+	start()
+	if err != nil {
+		failResponse(w)
+	}
+	if ndjson {
+		if err != nil {
+			out.write(map[string]any{"type": "error", "error": err.Error()})
+			return
+		}
+		out.write(map[string]any{"type": "done", "conversation_id": user.ConversationID, "content": reply, "speaker": listener})
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(w, "data: {\"error\":%q}\n\n", err.Error())
+	} else {
+		if listener != "" {
+			event, _ := json.Marshal(map[string]string{"speaker": listener})
+			fmt.Fprintf(w, "data: %s\n\n", event)
+		}
+		fmt.Fprintf(w, "data: [DONE]\n\n")
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"pi-agent/internal/store"
+)
+
+func (s *Server) handleListRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := s.db.Rooms()
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if rooms == nil {
+		rooms = []store.Room{}
+	}
+	writeJSON(w, http.StatusOK, rooms)
+}
+
+func (s *Server) handleGetRoom(w http.ResponseWriter, r *http.Request) {
+	room, err := s.db.Room(r.PathValue("id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, room)
+}
+
+// handleSetRoom makes a conversation a group chat, e.g.
+//
+//	{"name":"Family","members":["alice","bob","grandma"],"personas":["chef","tutor"]}
+//
+// From then on chat requests to it are stored with their sender, the
+// logged-in user or else "user" or "speaker", and the model sees who said
+// what. Members, if given, are the only ones who may post. Personas
+// answer when addressed as "@chef" or "chef, ..."; the first answers
+// otherwise.
+func (s *Server) handleSetRoom(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name     string   `json:"name"`
+		Members  []string `json:"members"`
+		Personas []string `json:"personas"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	room := store.Room{ConversationID: r.PathValue("id"), Name: strings.TrimSpace(req.Name)}
+	for i, m := range req.Members {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("members[%d] is empty", i))
+			return
+		}
+		if !slices.ContainsFunc(room.Members, func(o string) bool { return strings.EqualFold(o, m) }) {
+			room.Members = append(room.Members, m)
+		}
+	}
+	for _, p := range req.Personas {
+		profile, err := s.engine.Profile(strings.TrimSpace(p), "")
+		if err != nil || profile.Persona == "" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown persona %q", p))
+			return
+		}
+		if !slices.Contains(room.Personas, profile.Persona) {
+			room.Personas = append(room.Personas, profile.Persona)
+		}
+	}
+	if _, err := s.db.Relay(room.ConversationID); err == nil {
+		writeError(w, http.StatusConflict, "the conversation is a translation relay")
+		return
+	} else if !errors.Is(err, store.ErrNotFound) {
+		writeStoreError(w, err)
+		return
+	}
+	if err := s.db.SetRoom(&room); err != nil {
+		log.Printf("db error: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	saved, err := s.db.Room(room.ConversationID)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, saved)
+}
+
+func (s *Server) handleDeleteRoom(w http.ResponseWriter, r *http.Request) {
+	if err := s.db.DeleteRoom(r.PathValue("id")); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
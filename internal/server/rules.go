@@ -0,0 +1,126 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"pi-agent/internal/store"
+)
+
+func (s *Server) handleListRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := s.db.Rules()
+	if err != nil {
+		log.Printf("db error: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if rules == nil {
+		rules = []store.Rule{}
+	}
+	writeJSON(w, http.StatusOK, rules)
+}
+
+func (s *Server) handleGetRule(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	rule, err := s.db.Rule(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rule)
+}
+
+func (s *Server) handleCreateRule(w http.ResponseWriter, r *http.Request) {
+	rule := store.Rule{Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if err := s.cfg.Rules.Validate(r.Context(), &rule); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.db.AddRule(&rule); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, rule)
+}
+
+func (s *Server) handleUpdateRule(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	rule, err := s.db.Rule(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	// Decode over the existing rule so partial updates keep other fields.
+	if err := json.NewDecoder(r.Body).Decode(rule); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	rule.ID = id
+	if err := s.cfg.Rules.Validate(r.Context(), rule); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.db.UpdateRule(rule); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rule)
+}
+
+func (s *Server) handleDeleteRule(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if err := s.db.DeleteRule(id); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pathID parses the {id} path value, writing a 400 response if invalid.
+func pathID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid id")
+		return 0, false
+	}
+	return id, true
+}
+
+// writeStoreError maps store errors to HTTP responses.
+func writeStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if errors.Is(err, store.ErrLocked) || errors.Is(err, store.ErrWrongKey) {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if errors.Is(err, store.ErrEncrypted) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if errors.Is(err, store.ErrReadOnly) {
+		log.Printf("db error: %v", err)
+		writeError(w, http.StatusServiceUnavailable, store.ErrReadOnly.Error())
+		return
+	}
+	log.Printf("db error: %v", err)
+	writeError(w, http.StatusInternalServerError, "internal error")
+}
@@ -1,69 +1,460 @@
 package server
 
 import (
-	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/netip"
+	"path/filepath"
+	"runtime/debug"
 	"strings"
+	"time"
 
-	"pi-agent/internal/chat"
+	"pi-agent/engine"
+	"pi-agent/internal/approval"
+	"pi-agent/internal/attachments"
+	"pi-agent/internal/audio"
+	"pi-agent/internal/auth"
+	"pi-agent/internal/automation"
+	"pi-agent/internal/bookmarks"
+	"pi-agent/internal/codeblock"
+	"pi-agent/internal/config"
+	"pi-agent/internal/intent"
+	"pi-agent/internal/maintenance"
+	"pi-agent/internal/mqtt"
+	"pi-agent/internal/nettools"
+	"pi-agent/internal/notify"
+	"pi-agent/internal/patch"
+	"pi-agent/internal/persist"
+	"pi-agent/internal/policy"
+	"pi-agent/internal/presence"
+	"pi-agent/internal/project"
+	"pi-agent/internal/rag"
+	"pi-agent/internal/rules"
+	"pi-agent/internal/sandbox"
+	"pi-agent/internal/sensors"
+	"pi-agent/internal/speech"
+	"pi-agent/internal/state"
 	"pi-agent/internal/store"
-	"pi-agent/internal/token"
+	"pi-agent/internal/thermal"
+	"pi-agent/internal/vault"
+	"pi-agent/internal/webpush"
 )
 
 // Config holds server configuration.
 type Config struct {
-	Addr           string // listen address, e.g. ":8080"
-	Model          string // OpenAI model, e.g. "gpt-4o"
-	SystemPrompt   string // optional system prompt
-	ConversationID string // default conversation ID
+	Addr           string      // listen address, e.g. ":8080"; empty disables TCP
+	TLS            *tls.Config // optional; serves Addr over HTTPS
+	Socket         string      // optional Unix socket path also serving the API
+	FIFODir        string      // optional directory holding the in/out FIFOs of the line protocol
+	ConversationID string      // default conversation ID
+
+	Mixer   *audio.Mixer   // optional; enables the /audio endpoints
+	Earcons *audio.Earcons // optional; enables POST /audio/cues/{cue}
+	Intents *intent.Router // optional; answers simple commands locally
+	Rules   *rules.Engine  // optional; enables the /rules endpoints
+
+	SpeechToText speech.SpeechToText // optional; enables POST /speech/transcribe
+	TextToSpeech speech.TextToSpeech // optional; enables POST /speech/synthesize
+
+	Presence       *presence.Tracker // optional; enables the /presence endpoints
+	GeofenceSecret string            // shared secret for location webhooks; empty disables them
+	GeofenceHome   string            // OwnTracks region name that counts as home
+
+	Hooks    []config.Hook   // inbound webhooks served at /hooks/{name}
+	Notifier notify.Notifier // optional; delivers hook replies
+
+	Automations *automation.Manager // optional; enables GET /automations and POST /hooks/automations/{name}
+
+	Bookmarks *bookmarks.Bookmarks // optional; enables the /bookmarks endpoints
+	Indexer   *rag.Watcher         // optional; enables GET /rag/status
+
+	Compactor *maintenance.Compactor // optional; enables POST /admin/compact
+	Vault     *vault.Exporter        // optional; enables POST /admin/export
+
+	Attachments *attachments.Store // optional; enables the /attachments and /admin/storage endpoints
+	Thermal     *thermal.Monitor   // optional; adds CPU temperature to /metrics
+	Buffer      *persist.Buffer    // optional; adds database write-backs to /metrics
+
+	Approvals *approval.Queue  // optional; enables the /approvals endpoints
+	Runner    *sandbox.Runner  // optional; with Approvals, enables running code blocks
+	Workspace string           // directory code blocks are saved to; empty disables saving
+	Projects  *project.Manager // optional; enables the /conversations/{id}/project endpoints
+	Patches   *patch.Manager   // optional; with Approvals, enables the /patches endpoints
+
+	Net *nettools.Toolkit // optional; enables the /nettools endpoints
+
+	MQTT *mqtt.Mirror // optional; enables the /conversations/{id}/mqtt endpoints
+
+	State   *state.State      // optional; enables GET /state
+	Sensors *sensors.Recorder // optional; enables GET /charts/{sensor}.png
+
+	// Suggestions offers two or three follow-up prompts after each chat
+	// reply; requests may turn them off with "suggestions":false.
+	Suggestions bool
+
+	// ContextTTL maps channels to how long a conversation may be idle
+	// before its history is no longer sent; see ChatRequest.Channel.
+	ContextTTL map[string]time.Duration
+
+	// Commands are slash commands answered besides the built-in /help,
+	// /reset, /continue, /model, /persona, /remember, /forget, /pin and
+	// /unpin, replacing those of the same name.
+	Commands []Command
+
+	Policy *policy.Policy  // optional; enables the /policy endpoints
+	Push   *webpush.Sender // optional; enables the /push endpoints
+
+	AccessLog *AccessLog     // optional; logs every request
+	Allow     []netip.Prefix // optional; TCP clients outside these networks are refused
+	Auth      *auth.Manager  // optional; TCP clients must log in
+
+	ShareKey  []byte // optional; signs read-only share links for conversations
+	PublicURL string // base URL for share links; default from the request's Host
+
+	// IdempotencyTTL is how long responses to requests sent with an
+	// Idempotency-Key are kept for retries; 0 means DefaultIdempotencyTTL.
+	IdempotencyTTL time.Duration
 }
 
 // Server is the HTTP server for the pi-agent.
 type Server struct {
-	cfg Config
-	ts  *token.Store
-	db  *store.DB
-	mux *http.ServeMux
+	cfg      Config
+	engine   *engine.Engine
+	db       *store.DB
+	mux      *http.ServeMux
+	hooks    map[string]config.Hook
+	commands *Commands
+	started  time.Time
 }
 
-// New creates a new Server.
-func New(cfg Config, ts *token.Store, db *store.DB) *Server {
+// New creates a new Server answering chats with the given engine.
+func New(cfg Config, eng *engine.Engine) *Server {
 	s := &Server{
-		cfg: cfg,
-		ts:  ts,
-		db:  db,
-		mux: http.NewServeMux(),
+		cfg:     cfg,
+		engine:  eng,
+		db:      eng.DB(),
+		mux:     http.NewServeMux(),
+		started: time.Now(),
+	}
+	s.commands = NewCommands()
+	s.commands.Register(s.builtinCommands()...)
+	s.commands.Register(cfg.Commands...)
+	s.hooks = make(map[string]config.Hook, len(cfg.Hooks))
+	for _, h := range cfg.Hooks {
+		s.hooks[h.Name] = h
 	}
-	s.mux.HandleFunc("POST /chat", s.handleChat)
+	s.mux.HandleFunc("POST /chat", s.idempotent(s.handleChat))
 	s.mux.HandleFunc("GET /health", s.handleHealth)
+	s.mux.HandleFunc("GET /speech", s.handleSpeech)
+	if cfg.SpeechToText != nil {
+		s.mux.HandleFunc("POST /speech/transcribe", s.handleTranscribe)
+	}
+	if cfg.TextToSpeech != nil {
+		s.mux.HandleFunc("POST /speech/synthesize", s.handleSynthesize)
+	}
+	s.mux.HandleFunc("GET /metrics", s.handleMetrics)
+	s.mux.HandleFunc("POST /transcripts", s.handleTranscripts)
+	s.mux.HandleFunc("POST /admin/import", s.handleImport)
+	s.mux.HandleFunc("GET /conversations", s.handleListConversations)
+	s.mux.HandleFunc("GET /conversations/{id}/messages", s.withConversationKey(s.handleListMessages))
+	s.mux.HandleFunc("PUT /conversations/{id}/read", s.handleMarkRead)
+	s.mux.HandleFunc("GET /conversations/{id}/relay", s.handleGetRelay)
+	s.mux.HandleFunc("PUT /conversations/{id}/relay", s.handleSetRelay)
+	s.mux.HandleFunc("DELETE /conversations/{id}/relay", s.handleDeleteRelay)
+	s.mux.HandleFunc("GET /rooms", s.handleListRooms)
+	s.mux.HandleFunc("GET /conversations/{id}/room", s.handleGetRoom)
+	s.mux.HandleFunc("PUT /conversations/{id}/room", s.handleSetRoom)
+	s.mux.HandleFunc("DELETE /conversations/{id}/room", s.handleDeleteRoom)
+	s.mux.HandleFunc("GET /conversations/{id}/private", s.handleGetPrivate)
+	s.mux.HandleFunc("PUT /conversations/{id}/private", s.handleSetPrivate)
+	s.mux.HandleFunc("GET /conversations/{id}/encryption", s.handleGetEncryption)
+	s.mux.HandleFunc("PUT /conversations/{id}/encryption", s.handleEncrypt)
+	s.mux.HandleFunc("DELETE /conversations/{id}/encryption", s.handleDecrypt)
+	s.mux.HandleFunc("GET /conversations/{id}/length", s.handleGetReplyLength)
+	s.mux.HandleFunc("PUT /conversations/{id}/length", s.handleSetReplyLength)
+	s.mux.HandleFunc("DELETE /conversations/{id}/length", s.handleDeleteReplyLength)
+	s.mux.HandleFunc("POST /conversations/{id}/merge", s.handleMergeConversation)
+	s.mux.HandleFunc("GET /inbox", s.handleInbox)
+	s.mux.HandleFunc("POST /inbox/read", s.handleMarkAllRead)
+	if cfg.Auth != nil {
+		s.mux.HandleFunc("GET /login", s.handleLoginPage)
+		s.mux.HandleFunc("POST /auth/login", s.handleLogin)
+		s.mux.HandleFunc("POST /auth/logout", s.handleLogout)
+		s.mux.HandleFunc("GET /auth/me", s.handleMe)
+		s.mux.HandleFunc("GET /auth/oidc/login", s.handleOIDCLogin)
+		s.mux.HandleFunc("GET /auth/oidc/callback", s.handleOIDCCallback)
+	}
+	if len(cfg.ShareKey) > 0 {
+		s.mux.HandleFunc("POST /conversations/{id}/share", s.handleShareConversation)
+		s.mux.HandleFunc("GET /shared/{token}", s.handleShared)
+	}
+	if cfg.State != nil {
+		s.mux.HandleFunc("GET /state", s.handleState)
+	}
+	if cfg.Sensors != nil {
+		s.mux.HandleFunc("GET /charts/{file}", s.handleChart)
+	}
+	if cfg.MQTT != nil {
+		s.mux.HandleFunc("GET /conversations/{id}/mqtt", s.handleGetMQTTOutput)
+		s.mux.HandleFunc("PUT /conversations/{id}/mqtt", s.handleSetMQTTOutput)
+		s.mux.HandleFunc("DELETE /conversations/{id}/mqtt", s.handleDeleteMQTTOutput)
+	}
+	if cfg.Push != nil {
+		s.mux.HandleFunc("GET /push/key", s.handlePushKey)
+		s.mux.HandleFunc("GET /push/sw.js", s.handleServiceWorker)
+		s.mux.HandleFunc("POST /push/subscriptions", s.handleSubscribe)
+		s.mux.HandleFunc("DELETE /push/subscriptions", s.handleUnsubscribe)
+	}
+	if cfg.Policy != nil {
+		s.mux.HandleFunc("GET /policy", s.handlePolicyStatus)
+		s.mux.HandleFunc("POST /policy/{persona}/override", s.handleOverride)
+		s.mux.HandleFunc("DELETE /policy/{persona}/override", s.handleEndOverride)
+	}
+	if len(eng.Variants()) >= 2 {
+		s.mux.HandleFunc("POST /compare", s.handleCompare)
+		s.mux.HandleFunc("GET /comparisons", s.handleListComparisons)
+		s.mux.HandleFunc("GET /comparisons/stats", s.handleComparisonStats)
+		s.mux.HandleFunc("GET /comparisons/{id}", s.handleGetComparison)
+		s.mux.HandleFunc("POST /comparisons/{id}/winner", s.handlePickWinner)
+	}
+	s.mux.HandleFunc("GET /contacts", s.handleListContacts)
+	s.mux.HandleFunc("POST /contacts", s.handleCreateContact)
+	s.mux.HandleFunc("GET /contacts/{id}", s.handleGetContact)
+	s.mux.HandleFunc("PUT /contacts/{id}", s.handleUpdateContact)
+	s.mux.HandleFunc("DELETE /contacts/{id}", s.handleDeleteContact)
+	if cfg.Mixer != nil {
+		s.mux.HandleFunc("GET /audio/devices", s.handleAudioDevices)
+		s.mux.HandleFunc("PUT /audio/device", s.handleAudioSetDevice)
+		s.mux.HandleFunc("GET /audio/volume", s.handleAudioVolume)
+		s.mux.HandleFunc("PUT /audio/volume", s.handleAudioSetVolume)
+	}
+	if cfg.Earcons != nil {
+		s.mux.HandleFunc("POST /audio/cues/{cue}", s.handleAudioCue)
+	}
+	if cfg.Rules != nil {
+		s.mux.HandleFunc("GET /rules", s.handleListRules)
+		s.mux.HandleFunc("POST /rules", s.handleCreateRule)
+		s.mux.HandleFunc("GET /rules/{id}", s.handleGetRule)
+		s.mux.HandleFunc("PUT /rules/{id}", s.handleUpdateRule)
+		s.mux.HandleFunc("DELETE /rules/{id}", s.handleDeleteRule)
+	}
+	if cfg.Presence != nil {
+		s.mux.HandleFunc("GET /presence", s.handlePresence)
+		if cfg.GeofenceSecret != "" {
+			s.mux.HandleFunc("POST /presence/owntracks", s.handleOwnTracks)
+			s.mux.HandleFunc("POST /presence/webhook", s.handlePresenceWebhook)
+		}
+	}
+	if cfg.Bookmarks != nil {
+		s.mux.HandleFunc("GET /bookmarks", s.handleListBookmarks)
+		s.mux.HandleFunc("POST /bookmarks", s.handleSaveBookmark)
+		s.mux.HandleFunc("DELETE /bookmarks/{id}", s.handleDeleteBookmark)
+	}
+	if cfg.Indexer != nil {
+		s.mux.HandleFunc("GET /rag/status", s.handleRAGStatus)
+	}
+	if cfg.Compactor != nil {
+		s.mux.HandleFunc("POST /admin/compact", s.handleCompact)
+	}
+	if cfg.Vault != nil {
+		s.mux.HandleFunc("POST /admin/export", s.handleExport)
+	}
+	if cfg.Attachments != nil {
+		s.mux.HandleFunc("POST /attachments", s.handleUploadAttachment)
+		s.mux.HandleFunc("GET /attachments/{id}", s.handleGetAttachment)
+		s.mux.HandleFunc("GET /admin/storage", s.handleStorage)
+		s.mux.HandleFunc("POST /admin/storage/gc", s.handleStorageGC)
+	}
+	s.mux.HandleFunc("PUT /messages/{id}", s.withMessageKey(s.handleEditMessage))
+	s.mux.HandleFunc("DELETE /messages/{id}", s.handleDeleteMessage)
+	s.mux.HandleFunc("GET /messages/{id}/revisions", s.withMessageKey(s.handleListRevisions))
+	s.mux.HandleFunc("GET /messages/{id}/feedback", s.handleGetFeedback)
+	s.mux.HandleFunc("PUT /messages/{id}/feedback", s.handleSetFeedback)
+	s.mux.HandleFunc("DELETE /messages/{id}/feedback", s.handleDeleteFeedback)
+	s.mux.HandleFunc("GET /feedback/export", s.handleExportFeedback)
+	s.mux.HandleFunc("PUT /messages/{id}/pin", s.withMessageKey(s.handlePinMessage))
+	s.mux.HandleFunc("DELETE /messages/{id}/pin", s.handleUnpinMessage)
+	s.mux.HandleFunc("GET /conversations/{id}/pins", s.withConversationKey(s.handleListPins))
+	s.mux.HandleFunc("GET /export/{file}", s.handleExportCSV)
+	s.mux.HandleFunc("GET /grafana", s.handleGrafanaTest)
+	s.mux.HandleFunc("POST /grafana/search", s.handleGrafanaSearch)
+	s.mux.HandleFunc("POST /grafana/query", s.handleGrafanaQuery)
+	s.mux.HandleFunc("POST /grafana/annotations", s.handleGrafanaAnnotations)
+	s.mux.HandleFunc("GET /messages/{id}/code", s.withMessageKey(s.handleListCode))
+	if cfg.Workspace != "" {
+		s.mux.HandleFunc("POST /messages/{id}/code/{n}/save", s.withMessageKey(s.handleSaveCode))
+	}
+	if cfg.Approvals != nil {
+		s.mux.HandleFunc("GET /approvals", s.handleListApprovals)
+		s.mux.HandleFunc("GET /approvals/{id}", s.handleGetApproval)
+		s.mux.HandleFunc("POST /approvals/{id}", s.handleDecideApproval)
+		if cfg.Runner != nil {
+			s.mux.HandleFunc("POST /messages/{id}/code/{n}/run", s.withMessageKey(s.handleRunCode))
+		}
+		if cfg.Patches != nil {
+			s.mux.HandleFunc("GET /patches", s.handleListPatches)
+			s.mux.HandleFunc("POST /patches", s.handleProposePatch)
+			s.mux.HandleFunc("GET /patches/{id}", s.handleGetPatch)
+			s.mux.HandleFunc("POST /patches/{id}/rollback", s.handleRollbackPatch)
+		}
+	}
+	if cfg.Projects != nil {
+		s.mux.HandleFunc("GET /conversations/{id}/project", s.handleGetProject)
+		s.mux.HandleFunc("PUT /conversations/{id}/project", s.handleSetProject)
+		s.mux.HandleFunc("DELETE /conversations/{id}/project", s.handleDeleteProject)
+	}
+	if len(s.hooks) > 0 {
+		s.mux.HandleFunc("POST /hooks/{name}", s.idempotent(s.handleHook))
+	}
+	if cfg.Automations != nil {
+		s.mux.HandleFunc("GET /automations", s.handleListAutomations)
+		s.mux.HandleFunc("POST /hooks/automations/{name}", s.idempotent(s.handleAutomationWebhook))
+	}
+	if cfg.Net != nil {
+		s.mux.HandleFunc("GET /nettools/diagnose", s.handleDiagnose)
+		s.mux.HandleFunc("GET /nettools/ping", s.handlePing)
+		s.mux.HandleFunc("GET /nettools/dns", s.handleDNSLookup)
+		s.mux.HandleFunc("GET /nettools/traceroute", s.handleTraceroute)
+		s.mux.HandleFunc("GET /nettools/port", s.handlePortCheck)
+		s.mux.HandleFunc("GET /nettools/devices", s.handleScanLAN)
+	}
 	s.mux.HandleFunc("/", s.handleNotFound)
 	return s
 }
 
-// ListenAndServe starts the HTTP server.
+// Handler returns the HTTP API, as served by ListenAndServe.
+func (s *Server) Handler() http.Handler {
+	h := compress(s.mux)
+	if s.cfg.Auth != nil {
+		h = s.authenticate(h)
+	}
+	if s.cfg.Allow != nil {
+		h = allowlist(s.cfg.Allow, h)
+	}
+	if s.cfg.AccessLog != nil {
+		h = s.cfg.AccessLog.wrap(h)
+	}
+	return h
+}
+
+// ListenAndServe starts the HTTP server on the TCP address and Unix
+// socket, and the FIFO interface, as configured. It returns when any of
+// them fails.
 func (s *Server) ListenAndServe() error {
-	log.Printf("listening on %s", s.cfg.Addr)
-	return http.ListenAndServe(s.cfg.Addr, s.mux)
+	errc := make(chan error, 3)
+	if s.cfg.Socket != "" {
+		l, err := listenUnix(s.cfg.Socket)
+		if err != nil {
+			return err
+		}
+		log.Printf("listening on unix:%s", s.cfg.Socket)
+		go func() { errc <- http.Serve(l, s.Handler()) }()
+	}
+	if s.cfg.FIFODir != "" {
+		if err := s.startFIFO(s.cfg.FIFODir); err != nil {
+			return err
+		}
+		log.Printf("reading requests from %s", filepath.Join(s.cfg.FIFODir, "in"))
+	}
+	if s.cfg.Addr != "" {
+		srv := &http.Server{Addr: s.cfg.Addr, Handler: s.Handler(), TLSConfig: s.cfg.TLS}
+		if s.cfg.TLS != nil {
+			log.Printf("listening on %s (HTTPS)", s.cfg.Addr)
+			go func() { errc <- srv.ListenAndServeTLS("", "") }()
+		} else {
+			log.Printf("listening on %s", s.cfg.Addr)
+			go func() { errc <- srv.ListenAndServe() }()
+		}
+	} else if s.cfg.Socket == "" && s.cfg.FIFODir == "" {
+		return errors.New("no listen address, socket or FIFO configured")
+	}
+	return <-errc
 }
 
 // ChatRequest is the JSON body for POST /chat.
 type ChatRequest struct {
 	Message        string `json:"message"`
 	ConversationID string `json:"conversation_id,omitempty"`
+	// Persona and User select the system prompt and model; see
+	// config.Profiles.
+	Persona string `json:"persona,omitempty"`
+	User    string `json:"user,omitempty"`
+	// AudioRef marks the message as a voice transcript and points at the
+	// recording, e.g. a path or URL kept by the voice pipeline.
+	AudioRef string `json:"audio_ref,omitempty"`
+	// Speaker is the label of the participant sending the message in a
+	// translation relay, or the name of the person posting in a room
+	// when it is not the user. Logged-in users always post as themselves.
+	Speaker string `json:"speaker,omitempty"`
+	// Attachments are the IDs of files uploaded to POST /attachments that
+	// the message refers to.
+	Attachments []string `json:"attachments,omitempty"`
+	// Channel names the front end the message came from, e.g. "telegram",
+	// and selects its context TTL. It defaults to "voice" for messages
+	// with an AudioRef and "web" otherwise.
+	Channel string `json:"channel,omitempty"`
+	// Suggestions set to false skips the follow-up suggestions the server
+	// offers with -suggestions.
+	Suggestions *bool `json:"suggestions,omitempty"`
+	// Account names the stored ChatGPT account to answer with, as listed
+	// by "pi-agent accounts"; empty uses the default account.
+	Account string `json:"account,omitempty"`
+	// AdminPIN lets a user whose default persona is restricted talk to
+	// another persona; see engine.CheckPersona.
+	AdminPIN string `json:"admin_pin,omitempty"`
 }
 
+// channel returns the channel the request came from.
+func (req *ChatRequest) channel() string {
+	switch {
+	case req.Channel != "":
+		return req.Channel
+	case req.AudioRef != "":
+		return "voice"
+	}
+	return "web"
+}
+
+// health is the body of GET /health.
+type health struct {
+	Status        string            `json:"status"` // "ok", or "unavailable" while a check fails
+	Version       string            `json:"version,omitempty"`
+	StartedAt     time.Time         `json:"started_at"`
+	UptimeSeconds int64             `json:"uptime_seconds"`
+	Checks        map[string]string `json:"checks"` // "ok" or what is wrong, by check
+}
+
+// handleHealth reports whether the server is up and ready to answer:
+// 200 once its database accepts writes, 503 while it does not, so that
+// watchdogs and service managers need only the status code.
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	h := health{Status: "ok", StartedAt: s.started.UTC().Truncate(time.Second), UptimeSeconds: int64(time.Since(s.started).Seconds()), Checks: map[string]string{"database": "ok"}}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		h.Version = info.Main.Version
+	}
+	status := http.StatusOK
+	if err := s.db.Ping(); err != nil {
+		h.Status, h.Checks["database"], status = "unavailable", err.Error(), http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, h)
 }
 
 func (s *Server) handleNotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, "not found")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusNotFound)
-	json.NewEncoder(w).Encode(map[string]string{"error": "not found"})
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
 }
 
 func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
@@ -77,37 +468,135 @@ func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if u := requestUser(r); u != "" {
+		req.User = u
+	}
+
 	convID := req.ConversationID
 	if convID == "" {
 		convID = s.cfg.ConversationID
 	}
+	release, ok := s.unlock(w, r, convID)
+	if !ok {
+		return
+	}
+	defer release()
+	chosen := req.Persona != ""
+	// In a room, messages are attributed to who sent them and answered
+	// by the persona they address.
+	room, err := s.db.Room(convID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("db error: %v", err)
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+	if room != nil {
+		if u := requestUser(r); u != "" || req.Speaker == "" {
+			req.Speaker = req.User
+		}
+		if !room.Admits(req.Speaker) {
+			msg := engine.ErrNotMember.Error()
+			if req.Speaker == "" {
+				msg = "room messages need a user or speaker"
+			}
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, msg), http.StatusForbidden)
+			return
+		}
+		if req.Persona == "" {
+			req.Persona = engine.RoomPersona(room, req.Message)
+		}
+	}
 
-	// Get a valid access token (auto-refreshes if expired).
-	accessToken, err := s.ts.AccessToken(r.Context())
+	// Slash commands are answered here, before any model is involved.
+	if name, reply, err := s.commands.Route(r.Context(), CommandCall{ConversationID: convID, User: req.User, AdminPIN: req.AdminPIN}, req.Message, req.AudioRef != ""); name != "" {
+		s.respondCommand(w, r, convID, name, reply, err)
+		return
+	}
+	s.expireContext(convID, req.channel())
+	if req.Persona == "" && room == nil {
+		req.Persona = s.conversationPersona(convID)
+	}
+	// A persona the conversation was switched to passed CheckSwitch then.
+	if chosen {
+		if err := s.engine.CheckPersona(req.User, req.Persona, req.AdminPIN); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusForbidden)
+			return
+		}
+	}
+	p, err := s.engine.Profile(req.Persona, req.User)
 	if err != nil {
-		log.Printf("token error: %v", err)
-		http.Error(w, fmt.Sprintf(`{"error":"authentication error: %s"}`, err), http.StatusUnauthorized)
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
 		return
 	}
+	p.Channel, p.Account = req.channel(), req.Account
+
+	if err := s.engine.Check(p, req.Message); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusForbidden)
+		return
+	}
+	setSpeechHeaders(w, p.Speech)
+
+	if len(req.Attachments) > 0 {
+		if s.cfg.Attachments == nil {
+			http.Error(w, `{"error":"attachments are not enabled"}`, http.StatusBadRequest)
+			return
+		}
+		if err := s.cfg.Attachments.Check(req.Attachments); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+	}
+	user := store.Message{ConversationID: convID, Content: req.Message, AudioRef: req.AudioRef, Speaker: req.Speaker, Attachments: req.Attachments}
 
-	// Store the user message.
-	if err := s.db.AddMessage(convID, store.RoleUser, req.Message); err != nil {
+	// Relay conversations are translated rather than answered.
+	relay, err := s.db.Relay(convID)
+	if err == nil {
+		s.relayChat(w, r, relay, user, p)
+		return
+	}
+	if !errors.Is(err, store.ErrNotFound) {
 		log.Printf("db error: %v", err)
 		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
 		return
 	}
 
-	// Build the messages list from conversation history.
-	history, err := s.db.Messages(convID)
+	// Answer simple commands locally without a model round-trip.
+	if s.cfg.Intents != nil {
+		permit := func(tool string) error { return s.engine.AllowTool(convID, p, tool) }
+		name, reply, err := s.cfg.Intents.Route(r.Context(), convID, req.Message, permit)
+		if name != "" {
+			s.respondLocal(w, r, user, name, reply, err)
+			return
+		}
+	}
+
+	t, err := s.engine.Start(r.Context(), user, p)
+	if errors.Is(err, policy.ErrRestricted) {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, engine.ErrAuth) {
+		log.Printf("token error: %v", err)
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusUnauthorized)
+		return
+	}
+	if errors.Is(err, engine.ErrPrivate) {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, engine.ErrNotMember) {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		log.Printf("db error: %v", err)
 		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
 		return
 	}
 
-	var messages []chat.Message
-	for _, m := range history {
-		messages = append(messages, chat.Message{Role: string(m.Role), Content: m.Content})
+	if acceptsNDJSON(r) {
+		s.streamNDJSON(w, r, req, t)
+		return
 	}
 
 	// Stream the response back as SSE.
@@ -122,42 +611,49 @@ func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx, cancel := context.WithCancel(r.Context())
-	defer cancel()
-
-	accountID := s.ts.AccountID()
-	deltaCh, errCh := chat.StreamCompletion(ctx, accessToken, accountID, s.cfg.Model, s.cfg.SystemPrompt, messages)
-
-	var fullResponse strings.Builder
-	for delta := range deltaCh {
-		if delta.Done {
-			fmt.Fprintf(w, "data: [DONE]\n\n")
-			flusher.Flush()
-			break
-		}
-		fullResponse.WriteString(delta.Content)
-
-		chunk, _ := json.Marshal(map[string]string{"content": delta.Content})
+	// Progress events let clients show a typing indicator while a slow
+	// model thinks or a tool runs.
+	t.OnProgress(func(p engine.Progress) {
+		event, _ := json.Marshal(map[string]any{"progress": p})
+		fmt.Fprintf(w, "data: %s\n\n", event)
+		flusher.Flush()
+	})
+	reply, err := s.engine.Run(r.Context(), t, func(content string) {
+		chunk, _ := json.Marshal(map[string]string{"content": content})
 		fmt.Fprintf(w, "data: %s\n\n", chunk)
 		flusher.Flush()
+	})
+	if err != nil {
+		failResponse(w)
+		fmt.Fprintf(w, "data: {\"error\":%q}\n\n", err.Error())
+		flusher.Flush()
+		return
 	}
-
-	// Check for stream errors.
-	select {
-	case err := <-errCh:
-		if err != nil {
-			log.Printf("stream error: %v", err)
-			fmt.Fprintf(w, "data: {\"error\":%q}\n\n", err.Error())
-			flusher.Flush()
-			return
-		}
-	default:
+	if fallback := t.Fallback(); fallback != "" {
+		// The primary provider failed and a local model answered; clients
+		// can flag the reply and offer to retry later.
+		event, _ := json.Marshal(map[string]any{"fallback": fallback})
+		fmt.Fprintf(w, "data: %s\n\n", event)
 	}
-
-	// Store the assistant response.
-	if resp := fullResponse.String(); resp != "" {
-		if err := s.db.AddMessage(convID, store.RoleAssistant, resp); err != nil {
-			log.Printf("db error saving response: %v", err)
-		}
+	if speaker := t.Speaker(); speaker != "" {
+		event, _ := json.Marshal(map[string]string{"speaker": speaker})
+		fmt.Fprintf(w, "data: %s\n\n", event)
+	}
+	if cites := t.Citations(); len(cites) > 0 {
+		event, _ := json.Marshal(map[string]any{"citations": cites})
+		fmt.Fprintf(w, "data: %s\n\n", event)
+	}
+	if blocks := codeblock.Parse(reply); len(blocks) > 0 && t.ReplyID() != 0 {
+		// Blocks can be saved or run through /messages/{id}/code/{n}.
+		event, _ := json.Marshal(map[string]any{"message_id": t.ReplyID(), "code_blocks": blocks})
+		fmt.Fprintf(w, "data: %s\n\n", event)
+	}
+	flusher.Flush()
+	if list := s.suggestions(r, req, t, reply); len(list) > 0 {
+		// Follow-up prompts clients can offer as chips.
+		event, _ := json.Marshal(map[string]any{"suggestions": list})
+		fmt.Fprintf(w, "data: %s\n\n", event)
 	}
+	fmt.Fprintf(w, "data: [DONE]\n\n")
+	flusher.Flush()
 }
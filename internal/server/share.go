@@ -0,0 +1,200 @@
+package server
+
+import (
+	"cmp"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"pi-agent/internal/store"
+)
+
+// Share links expire after defaultShareTTL unless another lifetime up to
+// maxShareTTL is asked for.
+const (
+	defaultShareTTL = 7 * 24 * time.Hour
+	maxShareTTL     = 90 * 24 * time.Hour
+)
+
+// shareClaims is the signed part of a share link. A link shows the
+// conversation as it was when shared: messages added later stay private.
+type shareClaims struct {
+	ConversationID string `json:"c"`
+	LastMessageID  int64  `json:"m"`
+	Expires        int64  `json:"e"`
+}
+
+var errBadShare = errors.New("invalid or expired share link")
+
+// signShare returns the token for a share link: the claims and their
+// HMAC, each base64url encoded.
+func (s *Server) signShare(c shareClaims) string {
+	payload, _ := json.Marshal(c)
+	mac := hmac.New(sha256.New, s.cfg.ShareKey)
+	mac.Write(payload)
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func (s *Server) verifyShare(token string) (shareClaims, error) {
+	var c shareClaims
+	enc := base64.RawURLEncoding
+	p, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return c, errBadShare
+	}
+	payload, err := enc.DecodeString(p)
+	if err != nil {
+		return c, errBadShare
+	}
+	given, err := enc.DecodeString(sig)
+	if err != nil {
+		return c, errBadShare
+	}
+	mac := hmac.New(sha256.New, s.cfg.ShareKey)
+	mac.Write(payload)
+	if !hmac.Equal(mac.Sum(nil)[:16], given) {
+		return c, errBadShare
+	}
+	if err := json.Unmarshal(payload, &c); err != nil || time.Now().Unix() >= c.Expires {
+		return c, errBadShare
+	}
+	return c, nil
+}
+
+// handleShareConversation creates a read-only link to a conversation. The
+// body may set "expires_in" to a duration such as "72h".
+func (s *Server) handleShareConversation(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ExpiresIn string `json:"expires_in"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+	}
+	ttl := defaultShareTTL
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 || d > maxShareTTL {
+			writeError(w, http.StatusBadRequest, "expires_in must be a duration up to 2160h (90 days)")
+			return
+		}
+		ttl = d
+	}
+
+	id := r.PathValue("id")
+	if encrypted, err := s.db.Encrypted(id); err != nil || encrypted {
+		writeStoreError(w, cmp.Or(err, store.ErrEncrypted))
+		return
+	}
+	msgs, err := s.db.MessagesBefore(id, 0, 1)
+	if err != nil {
+		log.Printf("db error: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if len(msgs) == 0 {
+		writeError(w, http.StatusNotFound, "conversation not found")
+		return
+	}
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	path := "/shared/" + s.signShare(shareClaims{ConversationID: id, LastMessageID: msgs[0].ID, Expires: expires.Unix()})
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"url":        s.publicURL(r) + path,
+		"path":       path,
+		"expires_at": expires,
+	})
+}
+
+// publicURL returns the base URL links to this server are built from.
+func (s *Server) publicURL(r *http.Request) string {
+	if s.cfg.PublicURL != "" {
+		return strings.TrimSuffix(s.cfg.PublicURL, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// handleShared shows a shared conversation without authentication, as an
+// HTML page or, when the client accepts it, as JSON.
+func (s *Server) handleShared(w http.ResponseWriter, r *http.Request) {
+	claims, err := s.verifyShare(r.PathValue("token"))
+	if err != nil {
+		http.Error(w, "This link is invalid or has expired.", http.StatusNotFound)
+		return
+	}
+	// Links made before a conversation was encrypted stop working.
+	encrypted, err := s.db.Encrypted(claims.ConversationID)
+	if err != nil {
+		log.Printf("db error: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if encrypted {
+		http.Error(w, "This link is invalid or has expired.", http.StatusNotFound)
+		return
+	}
+	all, err := s.db.Messages(claims.ConversationID)
+	if err != nil {
+		log.Printf("db error: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	var msgs []message
+	for _, m := range all {
+		// System messages are compaction summaries, not part of the chat.
+		if m.ID <= claims.LastMessageID && m.Role != store.RoleSystem {
+			msgs = append(msgs, message{ID: m.ID, Role: m.Role, Content: m.Content, Fallback: m.Fallback, CreatedAt: m.CreatedAt})
+		}
+	}
+	expires := time.Unix(claims.Expires, 0)
+
+	w.Header().Set("X-Robots-Tag", "noindex")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		writeCachedJSON(w, r, map[string]any{"conversation_id": claims.ConversationID, "expires_at": expires, "messages": msgs})
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	err = sharedPage.Execute(w, map[string]any{"ID": claims.ConversationID, "Expires": expires, "Messages": msgs})
+	if err != nil {
+		log.Printf("rendering shared conversation: %v", err)
+	}
+}
+
+var sharedPage = template.Must(template.New("shared").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Shared conversation</title>
+<style>
+body { font: 16px/1.5 system-ui, sans-serif; max-width: 46em; margin: 2em auto; padding: 0 1em; color: #222; background: #fafafa; }
+header { color: #666; font-size: 0.9em; margin-bottom: 2em; }
+.msg { margin: 1em 0; padding: 0.75em 1em; border-radius: 8px; white-space: pre-wrap; overflow-wrap: anywhere; }
+.user { background: #dbeafe; margin-left: 15%; }
+.assistant { background: #fff; border: 1px solid #e5e5e5; margin-right: 15%; }
+.meta { display: block; color: #888; font-size: 0.8em; margin-bottom: 0.25em; white-space: normal; }
+</style>
+</head>
+<body>
+<header>A read-only conversation with pi-agent. This link expires {{.Expires.Format "Jan 2, 2006 15:04 MST"}}.</header>
+{{range .Messages}}<div class="msg {{.Role}}"><span class="meta">{{if eq .Role "user"}}User{{else}}Assistant{{end}} · {{.CreatedAt.Format "Jan 2 15:04"}}{{if .Fallback}} · answered by {{.Fallback}}{{end}}</span>{{.Content}}</div>
+{{else}}<p>This conversation has no messages.</p>
+{{end}}</body>
+</html>
+`))
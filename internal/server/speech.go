@@ -0,0 +1,162 @@
+package server
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"pi-agent/internal/config"
+	"pi-agent/internal/speech"
+)
+
+// maxRecordingBytes bounds the recordings POST /speech/transcribe takes,
+// a few minutes of 16 kHz WAV.
+const maxRecordingBytes = 25 << 20
+
+// setSpeechHeaders tells a voice front end which voice and language to
+// read a chat reply in. They are set before the reply streams so that
+// synthesis can start with the first sentence.
+func setSpeechHeaders(w http.ResponseWriter, sp *config.Speech) {
+	if sp == nil {
+		return
+	}
+	if sp.Voice != "" {
+		w.Header().Set("X-Speech-Voice", sp.Voice)
+	}
+	if l := sp.TTSLanguage(); l != "" {
+		w.Header().Set("X-Speech-Language", l)
+	}
+}
+
+// speechSettings is a user's voice settings as GET /speech reports them.
+type speechSettings struct {
+	User      string   `json:"user"`
+	Languages []string `json:"languages"`
+	Voice     string   `json:"voice,omitempty"`
+	Language  string   `json:"language,omitempty"`
+}
+
+// handleSpeech reports voice settings for speech recognition and
+// synthesis. With ?user= it returns that user's; without, every user's
+// along with all the languages spoken in the household, for recognizers
+// that cannot tell the speaker apart before transcribing.
+func (s *Server) handleSpeech(w http.ResponseWriter, r *http.Request) {
+	var users []speechSettings
+	var languages []string
+	name := strings.TrimSpace(r.URL.Query().Get("user"))
+	for _, u := range s.engine.Users() {
+		if u.Speech == nil || name != "" && !strings.EqualFold(u.Name, name) {
+			continue
+		}
+		users = append(users, speechSettings{
+			User:      u.Name,
+			Languages: u.Speech.Languages,
+			Voice:     u.Speech.Voice,
+			Language:  u.Speech.TTSLanguage(),
+		})
+		for _, l := range u.Speech.Languages {
+			if !slices.ContainsFunc(languages, func(x string) bool { return strings.EqualFold(x, l) }) {
+				languages = append(languages, l)
+			}
+		}
+	}
+	if name != "" {
+		if len(users) == 0 {
+			writeError(w, http.StatusNotFound, "no speech settings for "+name)
+			return
+		}
+		writeJSON(w, http.StatusOK, users[0])
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"users": users, "languages": languages})
+}
+
+// userSpeech returns the named user's voice settings, or nil.
+func (s *Server) userSpeech(name string) *config.Speech {
+	for _, u := range s.engine.Users() {
+		if strings.EqualFold(u.Name, name) {
+			return u.Speech
+		}
+	}
+	return nil
+}
+
+// handleTranscribe turns the recording in the body into text. The user's
+// languages, from ?user= or the login, are the recognizer's hints unless
+// ?language= names the one spoken.
+func (s *Server) handleTranscribe(w http.ResponseWriter, r *http.Request) {
+	audio, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRecordingBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, "recording is too large")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(audio) == 0 {
+		writeError(w, http.StatusBadRequest, "a recording is required")
+		return
+	}
+	rec := speech.Recording{Audio: audio}
+	user := cmp.Or(requestUser(r), r.URL.Query().Get("user"))
+	if l := r.URL.Query().Get("language"); l != "" {
+		rec.Languages = []string{l}
+	} else if sp := s.userSpeech(user); sp != nil {
+		rec.Languages = sp.Languages
+	}
+	t, err := s.cfg.SpeechToText.Transcribe(r.Context(), rec)
+	if err != nil {
+		log.Printf("speech recognition: %v", err)
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+// synthesizeRequest is the body of POST /speech/synthesize.
+type synthesizeRequest struct {
+	Text string `json:"text"`
+	// User chooses the voice and language from the user's settings;
+	// Voice and Language override them.
+	User     string `json:"user,omitempty"`
+	Voice    string `json:"voice,omitempty"`
+	Language string `json:"language,omitempty"`
+}
+
+// handleSynthesize reads text aloud, answering with the audio.
+func (s *Server) handleSynthesize(w http.ResponseWriter, r *http.Request) {
+	var req synthesizeRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		writeError(w, http.StatusBadRequest, "text is required")
+		return
+	}
+	u := speech.Utterance{Text: req.Text, Voice: req.Voice, Language: req.Language}
+	if sp := s.userSpeech(cmp.Or(requestUser(r), req.User)); sp != nil {
+		u.Voice = cmp.Or(u.Voice, sp.Voice)
+		u.Language = cmp.Or(u.Language, sp.TTSLanguage())
+	}
+	a, err := s.cfg.TextToSpeech.Synthesize(r.Context(), u)
+	if err != nil {
+		log.Printf("speech synthesis: %v", err)
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	if a.Fallback != "" {
+		w.Header().Set("X-Speech-Fallback", a.Fallback)
+	}
+	w.Header().Set("Content-Type", a.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(a.Data)))
+	w.Write(a.Data)
+}
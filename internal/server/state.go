@@ -0,0 +1,15 @@
+package server
+
+import "net/http"
+
+// handleState serves a snapshot of what the agent knows right now, e.g.
+//
+//	{"time":"...","sensors":{"temp":{"entity":"sensor.living_room","state":"21.5","unit":"°C"}},
+//	 "presence":[...],"timers":[...],"unread":{"phone":2},
+//	 "connectivity":{"home_assistant":true,"failed_speed_tests_24h":0},"token":{"logged_in":true,...}}
+//
+// Sections whose source is not configured are left out; sources that
+// could not be read are listed under "errors".
+func (s *Server) handleState(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.cfg.State.Snapshot(r.Context()))
+}
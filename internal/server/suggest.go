@@ -0,0 +1,35 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"pi-agent/engine"
+)
+
+// suggestTimeout bounds the model call for follow-up suggestions, which
+// hold back the end of the response.
+const suggestTimeout = 20 * time.Second
+
+// suggestions returns follow-up prompts for the reply of a chat turn if
+// the server offers them and the request did not turn them off, and
+// mirrors them to the conversation's MQTT topic. Failures are logged and
+// give none.
+func (s *Server) suggestions(r *http.Request, req ChatRequest, t *engine.Turn, reply string) []string {
+	if !s.cfg.Suggestions || (req.Suggestions != nil && !*req.Suggestions) || reply == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), suggestTimeout)
+	defer cancel()
+	list, err := s.engine.Suggest(ctx, t, reply)
+	if err != nil {
+		log.Printf("suggestions: %v", err)
+		return nil
+	}
+	if s.cfg.MQTT != nil && len(list) > 0 {
+		s.cfg.MQTT.Suggestions(t.ConversationID(), list)
+	}
+	return list
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"pi-agent/internal/store"
+)
+
+// TranscriptRequest is the JSON body for POST /transcripts. It records
+// voice interactions handled outside /chat, such as those answered on the
+// device, so they appear in conversation history like typed ones.
+type TranscriptRequest struct {
+	ConversationID string `json:"conversation_id,omitempty"`
+	Messages       []struct {
+		Role     store.Role `json:"role"`
+		Content  string     `json:"content"`
+		AudioRef string     `json:"audio_ref,omitempty"`
+	} `json:"messages"`
+}
+
+func (s *Server) handleTranscripts(w http.ResponseWriter, r *http.Request) {
+	var req TranscriptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if len(req.Messages) == 0 {
+		writeError(w, http.StatusBadRequest, "messages are required")
+		return
+	}
+	convID := req.ConversationID
+	if convID == "" {
+		convID = s.cfg.ConversationID
+	}
+	for i, m := range req.Messages {
+		if m.Role != store.RoleUser && m.Role != store.RoleAssistant {
+			writeError(w, http.StatusBadRequest, "role must be user or assistant")
+			return
+		}
+		if strings.TrimSpace(m.Content) == "" {
+			writeError(w, http.StatusBadRequest, "content is required")
+			return
+		}
+		req.Messages[i].Content = strings.TrimSpace(m.Content)
+	}
+
+	for _, m := range req.Messages {
+		msg := store.Message{ConversationID: convID, Role: m.Role, Content: m.Content, AudioRef: m.AudioRef}
+		if err := s.db.InsertMessage(&msg); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusCreated, map[string]int{"stored": len(req.Messages)})
+}
@@ -0,0 +1,77 @@
+package speech
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// OpenAI's audio endpoints and the models and voice used when none is
+// configured.
+const (
+	openAITranscriptions = "https://api.openai.com/v1/audio/transcriptions"
+	openAISpeech         = "https://api.openai.com/v1/audio/speech"
+
+	defaultOpenAISTTModel = "gpt-4o-mini-transcribe"
+	defaultOpenAITTSModel = "gpt-4o-mini-tts"
+	defaultOpenAIVoice    = "alloy"
+)
+
+// openAIVoices are the voices the speech endpoint offers, so that users'
+// voices meant for other synthesizers are not sent to it.
+var openAIVoices = []string{"alloy", "ash", "ballad", "coral", "echo", "fable", "nova", "onyx", "sage", "shimmer", "verse"}
+
+// openAISTT transcribes recordings with OpenAI's transcription API.
+type openAISTT struct {
+	key   string
+	model string
+}
+
+func (o openAISTT) Transcribe(ctx context.Context, r Recording) (*Transcript, error) {
+	lang := language(r.Languages)
+	body, contentType, err := multipartBody(r.Audio, map[string]string{
+		"model":    cmp.Or(o.model, defaultOpenAISTTModel),
+		"language": lang,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Text string `json:"text"`
+	}
+	if err := post(ctx, openAITranscriptions, o.key, contentType, body, &out); err != nil {
+		return nil, fmt.Errorf("openai: %w", err)
+	}
+	return &Transcript{Text: strings.TrimSpace(out.Text), Language: lang}, nil
+}
+
+// openAITTS reads text with OpenAI's speech API.
+type openAITTS struct {
+	key   string
+	model string
+	voice string
+}
+
+func (o openAITTS) Synthesize(ctx context.Context, u Utterance) (*Audio, error) {
+	voice := cmp.Or(o.voice, defaultOpenAIVoice)
+	if slices.Contains(openAIVoices, u.Voice) {
+		voice = u.Voice
+	}
+	body, err := json.Marshal(map[string]string{
+		"model":           cmp.Or(o.model, defaultOpenAITTSModel),
+		"input":           u.Text,
+		"voice":           voice,
+		"response_format": "wav",
+	})
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	if err := post(ctx, openAISpeech, o.key, "application/json", body, &data); err != nil {
+		return nil, fmt.Errorf("openai: %w", err)
+	}
+	return &Audio{Data: data, ContentType: "audio/wav"}, nil
+}
@@ -0,0 +1,72 @@
+package speech
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// piper reads text with a Piper voice: the user's, if it is in the
+// voices directory, and otherwise the configured model.
+type piper struct {
+	command []string
+	model   string
+	voices  string
+}
+
+func (p piper) Synthesize(ctx context.Context, u Utterance) (*Audio, error) {
+	model := p.model
+	if p.voices != "" && u.Voice != "" && !strings.ContainsAny(u.Voice, `/\`) {
+		path := filepath.Join(p.voices, u.Voice+".onnx")
+		if _, err := os.Stat(path); err == nil {
+			model = path
+		}
+	}
+	if model == "" {
+		return nil, fmt.Errorf("piper: no voice %q in %s and no default model", u.Voice, p.voices)
+	}
+	out, remove, err := tempFile(nil, ".wav")
+	if err != nil {
+		return nil, err
+	}
+	defer remove()
+	if _, err := run(ctx, p.command, u.Text, "--model", model, "--output_file", out); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("piper: no audio produced")
+	}
+	return &Audio{Data: data, ContentType: "audio/wav"}, nil
+}
+
+// espeak reads text with eSpeak NG, in the configured voice or else the
+// one for the text's language. It sounds robotic but runs anywhere,
+// which makes it the last fallback.
+type espeak struct {
+	command []string
+	voice   string
+}
+
+func (e espeak) Synthesize(ctx context.Context, u Utterance) (*Audio, error) {
+	args := []string{"--stdin", "--stdout"}
+	if v := e.voice; v != "" {
+		args = append(args, "-v", v)
+	} else if u.Language != "" {
+		args = append(args, "-v", strings.ToLower(u.Language))
+	}
+	data, err := run(ctx, e.command, u.Text, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("espeak: no audio produced")
+	}
+	return &Audio{Data: data, ContentType: "audio/wav"}, nil
+}
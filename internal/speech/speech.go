@@ -0,0 +1,236 @@
+// Package speech turns recordings into text and replies into audio through
+// interchangeable backends, as package chat does for models: whisper.cpp,
+// Vosk and OpenAI for recognition, and Piper, eSpeak and OpenAI for
+// synthesis, each tried in turn when the one before fails.
+package speech
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"pi-agent/internal/config"
+)
+
+// SpeechToText is a speech recognizer.
+type SpeechToText interface {
+	Transcribe(ctx context.Context, r Recording) (*Transcript, error)
+}
+
+// TextToSpeech is a speech synthesizer.
+type TextToSpeech interface {
+	Synthesize(ctx context.Context, u Utterance) (*Audio, error)
+}
+
+// Recording is audio to transcribe, best as 16 kHz mono WAV, which every
+// recognizer takes.
+type Recording struct {
+	Audio []byte
+	// Languages are BCP 47 tags of the languages the speaker may be
+	// using, most likely first; empty leaves it to the recognizer.
+	Languages []string
+}
+
+// Transcript is what a recognizer heard.
+type Transcript struct {
+	Text     string `json:"text"`
+	Language string `json:"language,omitempty"` // if the recognizer reports it
+	// Fallback names the provider that answered because the ones before
+	// it failed, or is empty.
+	Fallback string `json:"fallback,omitempty"`
+}
+
+// Utterance is text to read aloud.
+type Utterance struct {
+	Text string
+	// Voice names the voice to read in, e.g. a Piper voice such as
+	// "de_DE-thorsten-medium"; synthesizers without it use their own.
+	Voice string
+	// Language is the BCP 47 tag of the text's language, if known.
+	Language string
+}
+
+// Audio is synthesized speech.
+type Audio struct {
+	Data        []byte
+	ContentType string // e.g. "audio/wav"
+	// Fallback is as for Transcript.
+	Fallback string
+}
+
+// STTFailover is a SpeechToText that uses Fallback when Primary fails.
+type STTFailover struct {
+	Primary  SpeechToText
+	Fallback SpeechToText
+	Name     string // the fallback's name, e.g. "vosk"
+}
+
+// Transcribe implements SpeechToText.
+func (f STTFailover) Transcribe(ctx context.Context, r Recording) (*Transcript, error) {
+	t, err := f.Primary.Transcribe(ctx, r)
+	if err == nil || ctx.Err() != nil {
+		return t, err
+	}
+	log.Printf("speech recognition failed, using %s: %v", f.Name, err)
+	t, ferr := f.Fallback.Transcribe(ctx, r)
+	if ferr != nil {
+		return nil, fmt.Errorf("%w (fallback %s: %v)", err, f.Name, ferr)
+	}
+	if t.Fallback == "" {
+		t.Fallback = f.Name
+	}
+	return t, nil
+}
+
+// TTSFailover is a TextToSpeech that uses Fallback when Primary fails.
+type TTSFailover struct {
+	Primary  TextToSpeech
+	Fallback TextToSpeech
+	Name     string // the fallback's name, e.g. "espeak"
+}
+
+// Synthesize implements TextToSpeech.
+func (f TTSFailover) Synthesize(ctx context.Context, u Utterance) (*Audio, error) {
+	a, err := f.Primary.Synthesize(ctx, u)
+	if err == nil || ctx.Err() != nil {
+		return a, err
+	}
+	log.Printf("speech synthesis failed, using %s: %v", f.Name, err)
+	a, ferr := f.Fallback.Synthesize(ctx, u)
+	if ferr != nil {
+		return nil, fmt.Errorf("%w (fallback %s: %v)", err, f.Name, ferr)
+	}
+	if a.Fallback == "" {
+		a.Fallback = f.Name
+	}
+	return a, nil
+}
+
+// New returns the configured recognizer and synthesizer, either of which
+// is nil if none is configured. Providers later in each list are the
+// earlier ones' fallbacks.
+func New(cfg config.Voice) (SpeechToText, TextToSpeech, error) {
+	var stt SpeechToText
+	for i := len(cfg.STT) - 1; i >= 0; i-- {
+		p, err := newSTT(cfg.STT[i])
+		if err != nil {
+			return nil, nil, fmt.Errorf("voice.stt[%d]: %w", i, err)
+		}
+		if stt != nil {
+			p = STTFailover{Primary: p, Fallback: stt, Name: cfg.STT[i+1].Provider}
+		}
+		stt = p
+	}
+	var tts TextToSpeech
+	for i := len(cfg.TTS) - 1; i >= 0; i-- {
+		p, err := newTTS(cfg.TTS[i])
+		if err != nil {
+			return nil, nil, fmt.Errorf("voice.tts[%d]: %w", i, err)
+		}
+		if tts != nil {
+			p = TTSFailover{Primary: p, Fallback: tts, Name: cfg.TTS[i+1].Provider}
+		}
+		tts = p
+	}
+	return stt, tts, nil
+}
+
+func newSTT(cfg config.SpeechProvider) (SpeechToText, error) {
+	switch cfg.Provider {
+	case "whisper.cpp":
+		if cfg.URL != "" {
+			return whisperServer{url: strings.TrimSuffix(cfg.URL, "/")}, nil
+		}
+		return whisper{command: command(cfg.Command, "whisper-cli"), model: cfg.Model}, nil
+	case "vosk":
+		return vosk{command: command(cfg.Command, "vosk-transcriber"), model: cfg.Model}, nil
+	case "openai":
+		if cfg.APIKey() == "" {
+			return nil, errors.New("openai: no API key in the environment")
+		}
+		return openAISTT{key: cfg.APIKey(), model: cfg.Model}, nil
+	}
+	return nil, fmt.Errorf("unknown speech recognizer %q", cfg.Provider)
+}
+
+func newTTS(cfg config.SpeechProvider) (TextToSpeech, error) {
+	switch cfg.Provider {
+	case "piper":
+		return piper{command: command(cfg.Command, "piper"), model: cfg.Model, voices: cfg.VoicesDir}, nil
+	case "espeak":
+		return espeak{command: command(cfg.Command, "espeak-ng"), voice: cfg.Voice}, nil
+	case "openai":
+		if cfg.APIKey() == "" {
+			return nil, errors.New("openai: no API key in the environment")
+		}
+		return openAITTS{key: cfg.APIKey(), model: cfg.Model, voice: cfg.Voice}, nil
+	}
+	return nil, fmt.Errorf("unknown speech synthesizer %q", cfg.Provider)
+}
+
+// command returns the configured program and arguments, or def.
+func command(configured []string, def string) []string {
+	if len(configured) > 0 {
+		return configured
+	}
+	return []string{def}
+}
+
+// run runs a command with extra arguments appended and returns its
+// standard output, reporting its standard error on failure.
+func run(ctx context.Context, cmdline []string, stdin string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, cmdline[0], append(append([]string(nil), cmdline[1:]...), args...)...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", filepath.Base(cmdline[0]), err, lastLine(stderr.String()))
+	}
+	return out, nil
+}
+
+// lastLine returns the last non-empty line of a program's output, where
+// the reason it failed usually is.
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	return s[strings.LastIndexByte(s, '\n')+1:]
+}
+
+// tempFile writes data to a temporary file for programs that only read
+// files, and returns its path and a function removing it.
+func tempFile(data []byte, ext string) (string, func(), error) {
+	f, err := os.CreateTemp("", "pi-agent-speech-*"+ext)
+	if err != nil {
+		return "", nil, err
+	}
+	remove := func() { os.Remove(f.Name()) }
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		remove()
+		return "", nil, err
+	}
+	if err := f.Close(); err != nil {
+		remove()
+		return "", nil, err
+	}
+	return f.Name(), remove, nil
+}
+
+// language returns the primary subtag of the only language given, e.g.
+// "pt" for ["pt-BR"], or "" if there are none or several, for recognizers
+// that take one ISO 639-1 code or detect the language themselves.
+func language(tags []string) string {
+	if len(tags) != 1 {
+		return ""
+	}
+	primary, _, _ := strings.Cut(tags[0], "-")
+	return strings.ToLower(primary)
+}
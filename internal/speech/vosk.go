@@ -0,0 +1,39 @@
+package speech
+
+import (
+	"context"
+	"strings"
+)
+
+// vosk runs the vosk-transcriber program from Vosk's Python package on
+// each recording, with a model directory or, without one, the model it
+// downloads for the language.
+type vosk struct {
+	command []string
+	model   string
+}
+
+func (v vosk) Transcribe(ctx context.Context, r Recording) (*Transcript, error) {
+	path, remove, err := tempFile(r.Audio, ".wav")
+	if err != nil {
+		return nil, err
+	}
+	defer remove()
+	args := []string{"-i", path}
+	lang := language(r.Languages)
+	switch {
+	case v.model != "":
+		args = append(args, "-m", v.model)
+	case lang != "":
+		args = append(args, "-l", lang)
+	}
+	out, err := run(ctx, v.command, "", args...)
+	if err != nil {
+		return nil, err
+	}
+	t := &Transcript{Text: strings.Join(strings.Fields(string(out)), " ")}
+	if v.model == "" {
+		t.Language = lang
+	}
+	return t, nil
+}
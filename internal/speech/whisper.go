@@ -0,0 +1,125 @@
+package speech
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// whisper runs whisper.cpp's command line program on each recording.
+type whisper struct {
+	command []string
+	model   string
+}
+
+func (w whisper) Transcribe(ctx context.Context, r Recording) (*Transcript, error) {
+	path, remove, err := tempFile(r.Audio, ".wav")
+	if err != nil {
+		return nil, err
+	}
+	defer remove()
+	// With several languages whisper works out which one is spoken.
+	lang := language(r.Languages)
+	out, err := run(ctx, w.command, "", "-m", w.model, "-f", path, "-nt", "-np", "-l", cmp.Or(lang, "auto"))
+	if err != nil {
+		return nil, err
+	}
+	return &Transcript{Text: strings.Join(strings.Fields(string(out)), " "), Language: lang}, nil
+}
+
+// whisperServer sends recordings to a running whisper.cpp server, which
+// keeps the model loaded between them.
+type whisperServer struct {
+	url string
+}
+
+var httpClient = &http.Client{Timeout: 2 * time.Minute}
+
+func (w whisperServer) Transcribe(ctx context.Context, r Recording) (*Transcript, error) {
+	lang := language(r.Languages)
+	body, contentType, err := multipartBody(r.Audio, map[string]string{
+		"response_format": "json",
+		"language":        cmp.Or(lang, "auto"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Text string `json:"text"`
+	}
+	if err := post(ctx, w.url+"/inference", "", contentType, body, &out); err != nil {
+		return nil, fmt.Errorf("whisper.cpp: %w", err)
+	}
+	return &Transcript{Text: strings.TrimSpace(out.Text), Language: lang}, nil
+}
+
+// multipartBody builds a form uploading audio as its "file" field along
+// with fields.
+func multipartBody(audio []byte, fields map[string]string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		if v == "" {
+			continue
+		}
+		if err := mw.WriteField(k, v); err != nil {
+			return nil, "", err
+		}
+	}
+	fw, err := mw.CreateFormFile("file", "audio.wav")
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := fw.Write(audio); err != nil {
+		return nil, "", err
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), mw.FormDataContentType(), nil
+}
+
+// post sends a request and decodes a JSON response into v, or, if v is a
+// *[]byte, stores the raw response there.
+func post(ctx context.Context, url, apiKey, contentType string, body []byte, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(data, &e) == nil && e.Error.Message != "" {
+			return fmt.Errorf("%s: %s", resp.Status, e.Error.Message)
+		}
+		return fmt.Errorf("%s: %s", resp.Status, lastLine(string(data)))
+	}
+	if b, ok := v.(*[]byte); ok {
+		*b = data
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,207 @@
+// Package speedtest measures internet bandwidth with the speedtest.net CLI
+// or iperf3 and keeps the results for trend questions.
+package speedtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"pi-agent/internal/store"
+)
+
+// timeout bounds a single test; a full speedtest.net run takes about 30s.
+const timeout = 2 * time.Minute
+
+// Tester runs speed tests and stores their results.
+type Tester struct {
+	db     *store.DB
+	method string // "speedtest" or "iperf3"
+	target string // iperf3 server as host[:port]
+
+	mu sync.Mutex // one test at a time; concurrent tests skew each other
+}
+
+// New creates a tester from a spec: "speedtest" for speedtest.net, using
+// Ookla's speedtest CLI or speedtest-cli, or "iperf3:host[:port]" for an
+// iperf3 server, e.g. one on the other side of a VPN.
+func New(db *store.DB, spec string) (*Tester, error) {
+	method, target, _ := strings.Cut(spec, ":")
+	switch method {
+	case "speedtest":
+		if target != "" {
+			return nil, fmt.Errorf("invalid speed test %q: speedtest takes no target", spec)
+		}
+	case "iperf3":
+		if target == "" {
+			return nil, fmt.Errorf("invalid speed test %q: want iperf3:host[:port]", spec)
+		}
+		if _, err := exec.LookPath("iperf3"); err != nil {
+			return nil, fmt.Errorf("speed test: iperf3 is not installed")
+		}
+	default:
+		return nil, fmt.Errorf("invalid speed test %q: want speedtest or iperf3:host[:port]", spec)
+	}
+	return &Tester{db: db, method: method, target: target}, nil
+}
+
+// Run measures bandwidth now and stores the result. Failures are stored
+// too, so that outages are visible later, and returned as the error.
+func (t *Tester) Run(ctx context.Context) (*store.SpeedTest, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	res := &store.SpeedTest{TestedAt: time.Now(), Method: t.method}
+	var err error
+	if t.method == "iperf3" {
+		err = t.iperf(ctx, res)
+	} else {
+		err = ookla(ctx, res)
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	if dbErr := t.db.AddSpeedTest(res); dbErr != nil {
+		log.Printf("speed test: %v", dbErr)
+	}
+	return res, err
+}
+
+// ookla runs Ookla's speedtest CLI, falling back to the Python
+// speedtest-cli, which most distributions package.
+func ookla(ctx context.Context, res *store.SpeedTest) error {
+	if _, err := exec.LookPath("speedtest"); err == nil {
+		out, err := run(ctx, "speedtest", "--format=json", "--accept-license", "--accept-gdpr")
+		if err != nil {
+			return err
+		}
+		var r struct {
+			Ping struct {
+				Latency float64 `json:"latency"`
+			} `json:"ping"`
+			Download struct {
+				Bandwidth float64 `json:"bandwidth"` // bytes per second
+			} `json:"download"`
+			Upload struct {
+				Bandwidth float64 `json:"bandwidth"`
+			} `json:"upload"`
+			Server struct {
+				Name     string `json:"name"`
+				Location string `json:"location"`
+			} `json:"server"`
+		}
+		if err := json.Unmarshal(out, &r); err != nil {
+			return fmt.Errorf("parsing speedtest output: %w", err)
+		}
+		res.DownloadMbps = r.Download.Bandwidth * 8 / 1e6
+		res.UploadMbps = r.Upload.Bandwidth * 8 / 1e6
+		res.LatencyMs = r.Ping.Latency
+		res.Server = strings.TrimSpace(r.Server.Name + " " + r.Server.Location)
+		return nil
+	}
+	if _, err := exec.LookPath("speedtest-cli"); err != nil {
+		return fmt.Errorf("neither speedtest nor speedtest-cli is installed")
+	}
+	out, err := run(ctx, "speedtest-cli", "--json", "--secure")
+	if err != nil {
+		return err
+	}
+	var r struct {
+		Download float64 `json:"download"` // bits per second
+		Upload   float64 `json:"upload"`
+		Ping     float64 `json:"ping"`
+		Server   struct {
+			Sponsor string `json:"sponsor"`
+			Name    string `json:"name"`
+		} `json:"server"`
+	}
+	if err := json.Unmarshal(out, &r); err != nil {
+		return fmt.Errorf("parsing speedtest-cli output: %w", err)
+	}
+	res.DownloadMbps = r.Download / 1e6
+	res.UploadMbps = r.Upload / 1e6
+	res.LatencyMs = r.Ping
+	res.Server = strings.TrimSpace(r.Server.Sponsor + " " + r.Server.Name)
+	return nil
+}
+
+// iperf measures upload, then download in reverse mode, against the
+// configured iperf3 server. Latency is the TCP connect time.
+func (t *Tester) iperf(ctx context.Context, res *store.SpeedTest) error {
+	host, port := t.target, "5201"
+	if h, p, err := net.SplitHostPort(t.target); err == nil {
+		host, port = h, p
+	}
+	res.Server = net.JoinHostPort(host, port)
+
+	start := time.Now()
+	conn, err := (&net.Dialer{Timeout: 5 * time.Second}).DialContext(ctx, "tcp", res.Server)
+	if err != nil {
+		return fmt.Errorf("connecting to iperf3 server: %w", err)
+	}
+	res.LatencyMs = time.Since(start).Seconds() * 1000
+	conn.Close()
+
+	for _, reverse := range []bool{false, true} {
+		args := []string{"-c", host, "-p", port, "-J", "-t", "10"}
+		if reverse {
+			args = append(args, "-R")
+		}
+		out, err := run(ctx, "iperf3", args...)
+		var r struct {
+			Error string `json:"error"`
+			End   struct {
+				SumReceived struct {
+					BitsPerSecond float64 `json:"bits_per_second"`
+				} `json:"sum_received"`
+			} `json:"end"`
+		}
+		// iperf3 reports errors in its JSON and exits non-zero.
+		if jsonErr := json.Unmarshal(out, &r); jsonErr == nil && r.Error != "" {
+			return fmt.Errorf("iperf3: %s", r.Error)
+		} else if err != nil {
+			return err
+		} else if jsonErr != nil {
+			return fmt.Errorf("parsing iperf3 output: %w", jsonErr)
+		}
+		if reverse {
+			res.DownloadMbps = r.End.SumReceived.BitsPerSecond / 1e6
+		} else {
+			res.UploadMbps = r.End.SumReceived.BitsPerSecond / 1e6
+		}
+	}
+	return nil
+}
+
+func run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return out, fmt.Errorf("%s: %w: %s", name, err, msg)
+		}
+		return out, fmt.Errorf("%s: %w", name, err)
+	}
+	return out, nil
+}
+
+// Describe formats a result for the model or a notification.
+func Describe(t *store.SpeedTest) string {
+	when := t.TestedAt.Local().Format("Jan 2 15:04")
+	if t.Error != "" {
+		return fmt.Sprintf("%s: test failed: %s", when, t.Error)
+	}
+	return fmt.Sprintf("%s: %.1f Mbps down, %.1f Mbps up, %.0f ms latency (%s %s)",
+		when, t.DownloadMbps, t.UploadMbps, t.LatencyMs, t.Method, t.Server)
+}
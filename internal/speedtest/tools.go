@@ -0,0 +1,76 @@
+package speedtest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"pi-agent/internal/store"
+	"pi-agent/internal/tools"
+)
+
+// periods maps the period names accepted by the history tool to their
+// length in days.
+var periods = map[string]int{"24h": 1, "7d": 7, "30d": 30, "90d": 90}
+
+// Tools returns model-facing speed test tools.
+func (t *Tester) Tools() []tools.Tool {
+	return []tools.Tool{
+		tools.New("speed_test_run",
+			"Measure the internet connection's download and upload speed and latency now. Takes about half a minute.",
+			tools.NoParams,
+			func(ctx context.Context, _ json.RawMessage) (string, error) {
+				res, err := t.Run(ctx)
+				if err != nil {
+					return "", err
+				}
+				return Describe(res), nil
+			}),
+		tools.New("speed_test_history",
+			"Summarize scheduled internet speed tests over a period and compare them with the period before, e.g. to tell whether the connection has got worse.",
+			`{"type":"object","properties":{"period":{"type":"string","enum":["24h","7d","30d","90d"]}},"required":["period"]}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var in struct {
+					Period string `json:"period"`
+				}
+				if err := tools.Decode(args, &in); err != nil {
+					return "", err
+				}
+				days, ok := periods[in.Period]
+				if !ok {
+					return "", fmt.Errorf("unknown period %q", in.Period)
+				}
+				now := time.Now()
+				start := now.AddDate(0, 0, -days)
+				cur, err := t.db.SpeedTestStats(start, now)
+				if err != nil {
+					return "", err
+				}
+				prev, err := t.db.SpeedTestStats(start.AddDate(0, 0, -days), start)
+				if err != nil {
+					return "", err
+				}
+				var b strings.Builder
+				fmt.Fprintf(&b, "Last %s: %s\n", in.Period, formatStats(cur))
+				fmt.Fprintf(&b, "Previous %s: %s\n", in.Period, formatStats(prev))
+				return b.String(), nil
+			}),
+	}
+}
+
+func formatStats(st store.SpeedTestStats) string {
+	if st.Tests == 0 {
+		return "no tests."
+	}
+	if st.Tests == st.Failed {
+		return fmt.Sprintf("all %d tests failed.", st.Tests)
+	}
+	s := fmt.Sprintf("%d tests, avg %.1f Mbps down (lowest %.1f), %.1f Mbps up, %.0f ms latency",
+		st.Tests, st.AvgDownloadMbps, st.MinDownloadMbps, st.AvgUploadMbps, st.AvgLatencyMs)
+	if st.Failed > 0 {
+		s += fmt.Sprintf("; %d failed", st.Failed)
+	}
+	return s + "."
+}
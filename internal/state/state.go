@@ -0,0 +1,256 @@
+// Package state gathers what the agent knows about the household right
+// now into one snapshot: sensor readings, who is home, pending timers,
+// unread replies, connectivity, power and the health of the provider
+// login. The snapshot is served as GET /state for dashboards and can be
+// summarized into the system prompt.
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"pi-agent/internal/homeassistant"
+	"pi-agent/internal/power"
+	"pi-agent/internal/presence"
+	"pi-agent/internal/speedtest"
+	"pi-agent/internal/store"
+	"pi-agent/internal/thermal"
+	"pi-agent/internal/timer"
+	"pi-agent/internal/token"
+)
+
+// timeout bounds how long reading the sources of one snapshot may take.
+const timeout = 3 * time.Second
+
+// Config lists the sources of a snapshot. DB is required; the others are
+// optional and their sections are left out when nil.
+type Config struct {
+	DB *store.DB
+	HA *homeassistant.Client
+	// Sensors maps names to the Home Assistant entities shown under them,
+	// e.g. the prompt variables. It requires HA.
+	Sensors  map[string]string
+	Presence *presence.Tracker
+	Timers   *timer.Manager
+	Power    *power.Monitor
+	Thermal  *thermal.Monitor
+	Tokens   token.Provider
+}
+
+// Snapshot is the state at one moment.
+type Snapshot struct {
+	Time     time.Time         `json:"time"`
+	Sensors  map[string]Sensor `json:"sensors,omitempty"`
+	Presence []presence.Status `json:"presence,omitempty"`
+	// Timers are the pending timers and reminders, soonest first.
+	Timers []timer.Timer `json:"timers,omitempty"`
+	// Unread counts the replies each device has not seen, for devices
+	// that have marked anything read.
+	Unread       map[string]int  `json:"unread"`
+	Connectivity Connectivity    `json:"connectivity"`
+	Power        *power.Reading  `json:"power,omitempty"`
+	Thermal      *thermal.Status `json:"thermal,omitempty"`
+	Token        *Token          `json:"token,omitempty"`
+	// Errors holds, by section, the sources that could not be read.
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// Sensor is a Home Assistant entity's state.
+type Sensor struct {
+	Entity      string    `json:"entity"`
+	State       string    `json:"state"`
+	Unit        string    `json:"unit,omitempty"`
+	LastChanged time.Time `json:"last_changed,omitempty"`
+}
+
+// Connectivity is how well the agent reaches the outside world.
+type Connectivity struct {
+	// HomeAssistant reports whether Home Assistant answered; it is nil
+	// without HA.
+	HomeAssistant *bool `json:"home_assistant,omitempty"`
+	// SpeedTest is the last successful speed test, if any.
+	SpeedTest *store.SpeedTest `json:"speed_test,omitempty"`
+	// FailedSpeedTests counts the speed tests that failed in the last
+	// 24 hours.
+	FailedSpeedTests int `json:"failed_speed_tests_24h"`
+}
+
+// Token is the health of the provider login.
+type Token struct {
+	LoggedIn  bool       `json:"logged_in"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Expired tokens are refreshed on their next use; one that stays
+	// expired means the refresh is failing.
+	Expired bool `json:"expired"`
+}
+
+// State takes snapshots from its sources.
+type State struct {
+	cfg Config
+}
+
+// New returns a State reading the configured sources.
+func New(cfg Config) *State {
+	return &State{cfg: cfg}
+}
+
+// Snapshot reads every source. A source that fails is noted in Errors
+// and the rest of the snapshot is still filled in.
+func (s *State) Snapshot(ctx context.Context) *Snapshot {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	snap := &Snapshot{Time: time.Now()}
+	fail := func(section string, err error) {
+		if snap.Errors == nil {
+			snap.Errors = make(map[string]string)
+		}
+		snap.Errors[section] = err.Error()
+	}
+
+	if ha := s.cfg.HA; ha != nil {
+		states, err := ha.States(ctx)
+		reachable := err == nil
+		snap.Connectivity.HomeAssistant = &reachable
+		if err != nil && len(s.cfg.Sensors) > 0 {
+			fail("sensors", err)
+		}
+		if err == nil && len(s.cfg.Sensors) > 0 {
+			snap.Sensors = sensors(states, s.cfg.Sensors)
+		}
+	}
+	if s.cfg.Presence != nil {
+		snap.Presence = s.cfg.Presence.Statuses()
+	}
+	if s.cfg.Timers != nil {
+		snap.Timers = s.cfg.Timers.List("")
+	}
+	unread, err := s.cfg.DB.UnreadCounts()
+	if err != nil {
+		fail("unread", err)
+	}
+	snap.Unread = unread
+	if unread == nil {
+		snap.Unread = map[string]int{}
+	}
+
+	t, err := s.cfg.DB.LatestSpeedTest()
+	switch {
+	case err == nil:
+		snap.Connectivity.SpeedTest = t
+	case !errors.Is(err, store.ErrNotFound):
+		fail("connectivity", err)
+	}
+	now := time.Now()
+	if day, err := s.cfg.DB.SpeedTestStats(now.Add(-24*time.Hour), now); err != nil {
+		fail("connectivity", err)
+	} else {
+		snap.Connectivity.FailedSpeedTests = day.Failed
+	}
+
+	if s.cfg.Power != nil {
+		rd, err := s.cfg.Power.Reading()
+		if err != nil {
+			fail("power", err)
+		}
+		if !rd.ReadAt.IsZero() {
+			snap.Power = &rd
+		}
+	}
+	if s.cfg.Thermal != nil {
+		st := s.cfg.Thermal.Status()
+		snap.Thermal = &st
+	}
+	if s.cfg.Tokens != nil {
+		tok := &Token{LoggedIn: s.cfg.Tokens.HasCredentials()}
+		if exp := s.cfg.Tokens.ExpiresAt(); !exp.IsZero() {
+			tok.ExpiresAt = &exp
+			tok.Expired = exp.Before(now)
+		}
+		snap.Token = tok
+	}
+	return snap
+}
+
+func sensors(states []homeassistant.State, entities map[string]string) map[string]Sensor {
+	byID := make(map[string]homeassistant.State, len(states))
+	for _, st := range states {
+		byID[st.EntityID] = st
+	}
+	out := make(map[string]Sensor, len(entities))
+	for name, entity := range entities {
+		st, ok := byID[entity]
+		if !ok {
+			out[name] = Sensor{Entity: entity, State: "unknown"}
+			continue
+		}
+		unit, _ := st.Attributes["unit_of_measurement"].(string)
+		out[name] = Sensor{Entity: entity, State: st.State, Unit: unit, LastChanged: st.LastChanged}
+	}
+	return out
+}
+
+// Context summarizes a snapshot for the system prompt: sensors, timers,
+// unread replies and connectivity or login trouble. Presence and power
+// have prompt lines of their own and are left out. It is an
+// engine.ContextProvider.
+func (s *State) Context(ctx context.Context) string {
+	snap := s.Snapshot(ctx)
+	var lines []string
+	if len(snap.Sensors) > 0 {
+		names := make([]string, 0, len(snap.Sensors))
+		for name := range snap.Sensors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		parts := make([]string, len(names))
+		for i, name := range names {
+			sn := snap.Sensors[name]
+			parts[i] = strings.TrimSpace(name + " " + sn.State + " " + sn.Unit)
+		}
+		lines = append(lines, "Sensors: "+strings.Join(parts, ", ")+".")
+	}
+	if len(snap.Timers) > 0 {
+		parts := make([]string, len(snap.Timers))
+		for i, t := range snap.Timers {
+			label := t.Duration + " timer"
+			if t.Label != "" {
+				label += " for " + t.Label
+			}
+			parts[i] = label + " due at " + t.Due.Local().Format("15:04")
+		}
+		lines = append(lines, "Pending timers: "+strings.Join(parts, ", ")+".")
+	}
+	if unread := mostUnread(snap.Unread); unread > 0 {
+		lines = append(lines, fmt.Sprintf("Unread replies: %d.", unread))
+	}
+	var trouble []string
+	if ha := snap.Connectivity.HomeAssistant; ha != nil && !*ha {
+		trouble = append(trouble, "Home Assistant is unreachable")
+	}
+	if n := snap.Connectivity.FailedSpeedTests; n > 0 {
+		trouble = append(trouble, fmt.Sprintf("%d speed tests failed in the last day", n))
+	}
+	if t := snap.Token; t != nil && t.LoggedIn && t.Expired {
+		trouble = append(trouble, "the provider login has expired")
+	}
+	if len(trouble) > 0 {
+		lines = append(lines, "Problems: "+strings.Join(trouble, "; ")+".")
+	}
+	if t := snap.Connectivity.SpeedTest; t != nil {
+		lines = append(lines, "Last speed test: "+speedtest.Describe(t)+".")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// mostUnread is the most replies any one device has not seen.
+func mostUnread(byDevice map[string]int) int {
+	most := 0
+	for _, n := range byDevice {
+		most = max(most, n)
+	}
+	return most
+}
@@ -0,0 +1,164 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const approvalsSchema = `
+	CREATE TABLE IF NOT EXISTS approvals (
+		id              INTEGER PRIMARY KEY AUTOINCREMENT,
+		conversation_id TEXT    NOT NULL DEFAULT '',
+		kind            TEXT    NOT NULL,
+		summary         TEXT    NOT NULL,
+		payload         TEXT    NOT NULL,
+		status          TEXT    NOT NULL DEFAULT 'pending',
+		result          TEXT    NOT NULL DEFAULT '',
+		created_at      TEXT    NOT NULL DEFAULT (datetime('now')),
+		decided_at      TEXT
+	);
+	CREATE INDEX IF NOT EXISTS idx_approvals_status ON approvals(status);
+	`
+
+// Approval states.
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved" // approved and carried out
+	ApprovalRejected = "rejected"
+	ApprovalFailed   = "failed" // approved, but carrying it out failed
+)
+
+// ErrDecided is returned when deciding an approval that is no longer
+// pending.
+var ErrDecided = errors.New("already decided")
+
+// Approval is an action the agent wants to take that waits for a person
+// to allow or refuse it, such as running code or changing files.
+type Approval struct {
+	ID             int64           `json:"id"`
+	ConversationID string          `json:"conversation_id,omitempty"`
+	Kind           string          `json:"kind"`
+	Summary        string          `json:"summary"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Result         string          `json:"result,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DecidedAt      *time.Time      `json:"decided_at,omitempty"`
+}
+
+const approvalColumns = "id, conversation_id, kind, summary, payload, status, result, created_at, decided_at"
+
+// AddApproval stores a pending approval and sets its ID and status.
+func (d *DB) AddApproval(a *Approval) error {
+	res, err := d.exec(
+		"INSERT INTO approvals (conversation_id, kind, summary, payload) VALUES (?, ?, ?, ?)",
+		a.ConversationID, a.Kind, a.Summary, string(a.Payload),
+	)
+	if err != nil {
+		return fmt.Errorf("inserting approval: %w", err)
+	}
+	a.ID, _ = res.LastInsertId()
+	a.Status = ApprovalPending
+	return nil
+}
+
+// ClaimApproval moves a pending approval to status, so that it is carried
+// out at most once. It returns ErrDecided if it is not pending.
+func (d *DB) ClaimApproval(id int64, status string) error {
+	res, err := d.exec(
+		"UPDATE approvals SET status = ?, decided_at = datetime('now') WHERE id = ? AND status = ?",
+		status, id, ApprovalPending,
+	)
+	if err != nil {
+		return fmt.Errorf("updating approval: %w", err)
+	}
+	if err := checkAffected(res); err != nil {
+		if _, err := d.Approval(id); err != nil {
+			return err
+		}
+		return ErrDecided
+	}
+	return nil
+}
+
+// FinishApproval records the outcome of carrying out an approval.
+func (d *DB) FinishApproval(id int64, status, result string) error {
+	res, err := d.exec("UPDATE approvals SET status = ?, result = ? WHERE id = ?", status, result, id)
+	if err != nil {
+		return fmt.Errorf("updating approval: %w", err)
+	}
+	return checkAffected(res)
+}
+
+// Approval returns a single approval.
+func (d *DB) Approval(id int64) (*Approval, error) {
+	list, err := d.queryApprovals("SELECT "+approvalColumns+" FROM approvals WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, ErrNotFound
+	}
+	return &list[0], nil
+}
+
+// Approvals returns approvals with the given status, or all if status is
+// empty, newest first.
+func (d *DB) Approvals(status string) ([]Approval, error) {
+	if status == "" {
+		return d.queryApprovals("SELECT " + approvalColumns + " FROM approvals ORDER BY id DESC")
+	}
+	return d.queryApprovals("SELECT "+approvalColumns+" FROM approvals WHERE status = ? ORDER BY id DESC", status)
+}
+
+// ApprovalsSince returns the approvals asked for since a time, oldest
+// first: the audit log of what the agent asked to do and what was
+// decided.
+func (d *DB) ApprovalsSince(since time.Time) ([]Approval, error) {
+	return d.queryApprovals("SELECT "+approvalColumns+" FROM approvals WHERE created_at >= ? ORDER BY id", since.UTC().Format(timeFormat))
+}
+
+// ApprovalCSV is the header of Approval.CSV rows. The payload is left
+// out; the summary describes it.
+var ApprovalCSV = strings.Split("id,created_at,decided_at,conversation_id,kind,summary,status,result", ",")
+
+// CSV returns the approval as a row of values matching ApprovalCSV.
+func (a Approval) CSV() []string {
+	decided := ""
+	if a.DecidedAt != nil {
+		decided = a.DecidedAt.Format(time.RFC3339)
+	}
+	return []string{
+		fmt.Sprint(a.ID), a.CreatedAt.Format(time.RFC3339), decided, a.ConversationID, a.Kind, a.Summary, a.Status, a.Result,
+	}
+}
+
+func (d *DB) queryApprovals(query string, args ...any) ([]Approval, error) {
+	rows, err := d.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying approvals: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Approval
+	for rows.Next() {
+		var a Approval
+		var payload, createdAt string
+		var decidedAt sql.NullString
+		if err := rows.Scan(&a.ID, &a.ConversationID, &a.Kind, &a.Summary, &payload, &a.Status, &a.Result, &createdAt, &decidedAt); err != nil {
+			return nil, fmt.Errorf("scanning approval: %w", err)
+		}
+		a.Payload = json.RawMessage(payload)
+		a.CreatedAt, _ = time.Parse(timeFormat, createdAt)
+		if decidedAt.Valid {
+			t, _ := time.Parse(timeFormat, decidedAt.String)
+			a.DecidedAt = &t
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+const arrivalsSchema = `
+	CREATE TABLE IF NOT EXISTS arrival_actions (
+		id              INTEGER PRIMARY KEY AUTOINCREMENT,
+		person          TEXT    NOT NULL COLLATE NOCASE,
+		prompt          TEXT    NOT NULL,
+		conversation_id TEXT    NOT NULL,
+		created_at      TEXT    NOT NULL DEFAULT (datetime('now'))
+	);
+	`
+
+// ArrivalAction is a one-shot request to run when a person gets home,
+// e.g. "read me my messages when I get home".
+type ArrivalAction struct {
+	ID             int64     `json:"id"`
+	Person         string    `json:"person"`
+	Prompt         string    `json:"prompt"`
+	ConversationID string    `json:"conversation_id"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// AddArrivalAction stores an arrival action and sets its ID.
+func (d *DB) AddArrivalAction(a *ArrivalAction) error {
+	res, err := d.exec(
+		"INSERT INTO arrival_actions (person, prompt, conversation_id) VALUES (?, ?, ?)",
+		a.Person, a.Prompt, a.ConversationID,
+	)
+	if err != nil {
+		return fmt.Errorf("inserting arrival action: %w", err)
+	}
+	a.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// ArrivalActions returns the pending actions for a person. An empty name
+// returns all pending actions.
+func (d *DB) ArrivalActions(person string) ([]ArrivalAction, error) {
+	rows, err := d.query(
+		"SELECT id, person, prompt, conversation_id, created_at FROM arrival_actions WHERE ? = '' OR person = ? ORDER BY id",
+		person, person,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying arrival actions: %w", err)
+	}
+	defer rows.Close()
+
+	var actions []ArrivalAction
+	for rows.Next() {
+		var a ArrivalAction
+		var createdAt string
+		if err := rows.Scan(&a.ID, &a.Person, &a.Prompt, &a.ConversationID, &createdAt); err != nil {
+			return nil, fmt.Errorf("scanning arrival action: %w", err)
+		}
+		a.CreatedAt, _ = time.Parse(timeFormat, createdAt)
+		actions = append(actions, a)
+	}
+	return actions, rows.Err()
+}
+
+// DeleteArrivalAction removes an arrival action.
+func (d *DB) DeleteArrivalAction(id int64) error {
+	res, err := d.exec("DELETE FROM arrival_actions WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("deleting arrival action: %w", err)
+	}
+	return checkAffected(res)
+}
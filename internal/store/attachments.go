@@ -0,0 +1,178 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const attachmentsSchema = `
+	CREATE TABLE IF NOT EXISTS attachments (
+		id           TEXT PRIMARY KEY,
+		user         TEXT NOT NULL DEFAULT '' COLLATE NOCASE,
+		name         TEXT NOT NULL DEFAULT '',
+		content_type TEXT NOT NULL DEFAULT '',
+		size         INTEGER NOT NULL,
+		created_at   TEXT NOT NULL DEFAULT (datetime('now'))
+	);
+	CREATE INDEX IF NOT EXISTS idx_attachments_user ON attachments(user);
+	CREATE TABLE IF NOT EXISTS message_attachments (
+		message_id    INTEGER NOT NULL,
+		attachment_id TEXT NOT NULL,
+		PRIMARY KEY (message_id, attachment_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_message_attachments_attachment ON message_attachments(attachment_id);
+	`
+
+// Attachment is an uploaded image, recording or file. Its content is kept
+// on disk by package attachments; messages refer to it by ID.
+type Attachment struct {
+	ID          string    `json:"id"`
+	User        string    `json:"user,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	Size        int64     `json:"size"`
+	References  int       `json:"references"` // messages referring to it
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// AttachmentUsage sums the attachments of one user.
+type AttachmentUsage struct {
+	User        string `json:"user"`
+	Attachments int    `json:"attachments"`
+	Bytes       int64  `json:"bytes"`
+}
+
+// AddAttachment records an uploaded attachment. a.ID must be set.
+func (d *DB) AddAttachment(a *Attachment) error {
+	a.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	_, err := d.exec("INSERT INTO attachments (id, user, name, content_type, size, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		a.ID, a.User, a.Name, a.ContentType, a.Size, a.CreatedAt.Format(timeFormat))
+	if err != nil {
+		return fmt.Errorf("adding attachment: %w", err)
+	}
+	return nil
+}
+
+// Attachment returns an attachment with its reference count, or
+// ErrNotFound.
+func (d *DB) Attachment(id string) (*Attachment, error) {
+	rows, err := d.query(attachmentQuery+" WHERE a.id = ? GROUP BY a.id", id)
+	if err != nil {
+		return nil, fmt.Errorf("querying attachment: %w", err)
+	}
+	out, err := scanAttachments(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, ErrNotFound
+	}
+	return &out[0], nil
+}
+
+// DeleteAttachment removes an attachment's record and the references to
+// it.
+func (d *DB) DeleteAttachment(id string) error {
+	if _, err := d.exec("DELETE FROM message_attachments WHERE attachment_id = ?", id); err != nil {
+		return fmt.Errorf("deleting attachment references: %w", err)
+	}
+	res, err := d.exec("DELETE FROM attachments WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("deleting attachment: %w", err)
+	}
+	return checkAffected(res)
+}
+
+// MessageAttachments returns the IDs of the attachments of each message
+// in a conversation that has any.
+func (d *DB) MessageAttachments(conversationID string) (map[int64][]string, error) {
+	rows, err := d.query(`SELECT ma.message_id, ma.attachment_id FROM message_attachments ma
+		JOIN messages m ON m.id = ma.message_id WHERE m.conversation_id = ? ORDER BY ma.message_id, ma.rowid`, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("querying message attachments: %w", err)
+	}
+	defer rows.Close()
+	out := make(map[int64][]string)
+	for rows.Next() {
+		var id int64
+		var att string
+		if err := rows.Scan(&id, &att); err != nil {
+			return nil, fmt.Errorf("scanning message attachment: %w", err)
+		}
+		out[id] = append(out[id], att)
+	}
+	return out, rows.Err()
+}
+
+// AttachmentBytes returns the total size of all attachments.
+func (d *DB) AttachmentBytes() (int64, error) {
+	var n int64
+	if err := d.queryRow("SELECT COALESCE(SUM(size), 0) FROM attachments").Scan(&n); err != nil {
+		return 0, fmt.Errorf("querying attachment usage: %w", err)
+	}
+	return n, nil
+}
+
+// UserAttachmentBytes returns the total size of a user's attachments.
+func (d *DB) UserAttachmentBytes(user string) (int64, error) {
+	var n int64
+	if err := d.queryRow("SELECT COALESCE(SUM(size), 0) FROM attachments WHERE user = ?", user).Scan(&n); err != nil {
+		return 0, fmt.Errorf("querying attachment usage: %w", err)
+	}
+	return n, nil
+}
+
+// AttachmentUsage returns the attachments and bytes stored per user, most
+// bytes first.
+func (d *DB) AttachmentUsage() ([]AttachmentUsage, error) {
+	rows, err := d.query("SELECT user, COUNT(*), SUM(size) FROM attachments GROUP BY user ORDER BY SUM(size) DESC")
+	if err != nil {
+		return nil, fmt.Errorf("querying attachment usage: %w", err)
+	}
+	defer rows.Close()
+	var out []AttachmentUsage
+	for rows.Next() {
+		var u AttachmentUsage
+		if err := rows.Scan(&u.User, &u.Attachments, &u.Bytes); err != nil {
+			return nil, fmt.Errorf("scanning attachment usage: %w", err)
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+// OrphanedAttachments returns the attachments uploaded before the cutoff
+// that no stored message refers to, oldest first. References from
+// deleted messages count until their tombstones are purged, so history
+// queries still find the attachments; see PurgeTombstones.
+func (d *DB) OrphanedAttachments(before time.Time) ([]Attachment, error) {
+	rows, err := d.query(attachmentQuery+" WHERE a.created_at < ? GROUP BY a.id HAVING COUNT(m.id) = 0 ORDER BY a.created_at",
+		before.UTC().Format(timeFormat))
+	if err != nil {
+		return nil, fmt.Errorf("querying orphaned attachments: %w", err)
+	}
+	return scanAttachments(rows)
+}
+
+// attachmentQuery selects attachments with their reference counts, for
+// grouping by a.id.
+const attachmentQuery = `SELECT a.id, a.user, a.name, a.content_type, a.size, COUNT(m.id), a.created_at
+	FROM attachments a
+	LEFT JOIN message_attachments ma ON ma.attachment_id = a.id
+	LEFT JOIN messages m ON m.id = ma.message_id`
+
+func scanAttachments(rows *sql.Rows) ([]Attachment, error) {
+	defer rows.Close()
+	var out []Attachment
+	for rows.Next() {
+		var a Attachment
+		var createdAt string
+		if err := rows.Scan(&a.ID, &a.User, &a.Name, &a.ContentType, &a.Size, &a.References, &createdAt); err != nil {
+			return nil, fmt.Errorf("scanning attachment: %w", err)
+		}
+		a.CreatedAt, _ = time.Parse(timeFormat, createdAt)
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
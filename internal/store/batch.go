@@ -0,0 +1,183 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// maxStatements caps the prepared statement cache. Queries are constant
+// strings, so in practice every statement the package uses fits.
+const maxStatements = 256
+
+// Write batching: queued writes are committed together once batchSize are
+// waiting or batchWindow has passed since the first, so a burst of small
+// inserts costs one fsync instead of one each. On an SD card that is most
+// of the cost of a write.
+const (
+	batchSize   = 64
+	batchWindow = 10 * time.Millisecond
+)
+
+// ErrClosed is returned for writes queued after the database was closed.
+var ErrClosed = errors.New("database closed")
+
+// stmt returns a prepared statement for query, preparing it on first use.
+func (d *DB) stmt(query string) (*sql.Stmt, error) {
+	d.stmtMu.RLock()
+	s, ok := d.stmts[query]
+	d.stmtMu.RUnlock()
+	if ok {
+		return s, nil
+	}
+	d.stmtMu.Lock()
+	defer d.stmtMu.Unlock()
+	if s, ok := d.stmts[query]; ok {
+		return s, nil
+	}
+	s, err := d.db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(d.stmts) < maxStatements {
+		d.stmts[query] = s
+	}
+	return s, nil
+}
+
+func (d *DB) exec(query string, args ...any) (sql.Result, error) {
+	s, err := d.stmt(query)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.Exec(args...)
+	return res, readOnly(err)
+}
+
+func (d *DB) query(query string, args ...any) (*sql.Rows, error) {
+	s, err := d.stmt(query)
+	if err != nil {
+		return nil, err
+	}
+	return s.Query(args...)
+}
+
+func (d *DB) queryRow(query string, args ...any) *sql.Row {
+	s, err := d.stmt(query)
+	if err != nil {
+		// Let the unprepared query report the same error through Scan.
+		return d.db.QueryRow(query, args...)
+	}
+	return s.QueryRow(args...)
+}
+
+// txExec runs query in tx with the cached prepared statement.
+func (d *DB) txExec(tx *sql.Tx, query string, args ...any) (sql.Result, error) {
+	s, err := d.stmt(query)
+	if err != nil {
+		return nil, err
+	}
+	return tx.Stmt(s).Exec(args...)
+}
+
+// write is a queued write and the channel its result is sent on.
+type write struct {
+	fn   func(tx *sql.Tx) error
+	done chan error
+}
+
+// batched runs fn in the transaction of the next write batch and waits
+// for the batch to commit. Each write runs under its own savepoint, so a
+// failing write is rolled back alone and the rest of the batch commits.
+func (d *DB) batched(fn func(tx *sql.Tx) error) error {
+	w := write{fn: fn, done: make(chan error, 1)}
+	d.closeMu.RLock()
+	if d.closed {
+		d.closeMu.RUnlock()
+		return ErrClosed
+	}
+	d.writes <- w
+	d.closeMu.RUnlock()
+	return <-w.done
+}
+
+// Ping queues an empty write and waits for it to commit, showing that the
+// writer is running and the database accepts writes.
+func (d *DB) Ping() error {
+	return d.batched(func(tx *sql.Tx) error { return nil })
+}
+
+// writer commits queued writes until the queue is closed.
+func (d *DB) writer() {
+	defer close(d.writerDone)
+	for first := range d.writes {
+		batch := []write{first}
+		timeout := time.After(batchWindow)
+	collect:
+		for len(batch) < batchSize {
+			select {
+			case w, ok := <-d.writes:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, w)
+			case <-timeout:
+				break collect
+			}
+		}
+		d.commit(batch)
+	}
+}
+
+func (d *DB) commit(batch []write) {
+	fail := func(err error) {
+		err = readOnly(err)
+		for _, w := range batch {
+			w.done <- err
+		}
+	}
+	tx, err := d.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		fail(fmt.Errorf("beginning transaction: %w", err))
+		return
+	}
+	errs := make([]error, len(batch))
+	for i, w := range batch {
+		if _, err := tx.Exec("SAVEPOINT write"); err != nil {
+			tx.Rollback()
+			fail(err)
+			return
+		}
+		if errs[i] = w.fn(tx); errs[i] != nil {
+			_, err = tx.Exec("ROLLBACK TO write")
+		}
+		if err == nil {
+			_, err = tx.Exec("RELEASE write")
+		}
+		if err != nil {
+			tx.Rollback()
+			fail(err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		fail(fmt.Errorf("committing writes: %w", err))
+		return
+	}
+	for i, w := range batch {
+		w.done <- readOnly(errs[i])
+	}
+}
+
+// closeWriter stops accepting writes and waits for queued ones to commit.
+func (d *DB) closeWriter() {
+	d.closeMu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.writes)
+	}
+	d.closeMu.Unlock()
+	<-d.writerDone
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+const citationsSchema = `
+	CREATE TABLE IF NOT EXISTS message_citations (
+		message_id  INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+		marker      INTEGER NOT NULL,
+		document_id INTEGER NOT NULL,
+		chunk_id    INTEGER NOT NULL,
+		source      TEXT    NOT NULL,
+		title       TEXT    NOT NULL,
+		score       REAL    NOT NULL,
+		PRIMARY KEY (message_id, marker)
+	);
+	`
+
+// Citation links an inline marker such as [2] in a reply to the retrieved
+// chunk it refers to. Source and title are copied so that citations stay
+// readable after the document is reindexed or deleted.
+type Citation struct {
+	Marker     int     `json:"marker"`
+	DocumentID int64   `json:"document_id"`
+	ChunkID    int64   `json:"chunk_id"`
+	Source     string  `json:"source"`
+	Title      string  `json:"title"`
+	Score      float64 `json:"score"`
+}
+
+// AddCitedMessage inserts a message together with its citations and sets
+// its ID and creation time.
+func (d *DB) AddCitedMessage(m *Message, citations []Citation) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	content, sealed, err := d.sealFor(m.ConversationID, m.Content)
+	if err != nil {
+		return fmt.Errorf("inserting message: %w", err)
+	}
+	m.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	res, err := tx.Exec(
+		"INSERT INTO messages (conversation_id, role, content, fallback, speaker, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		m.ConversationID, string(m.Role), content, m.Fallback, m.Speaker, m.CreatedAt.Format(timeFormat),
+	)
+	if err != nil {
+		return fmt.Errorf("inserting message: %w", err)
+	}
+	m.ID, _ = res.LastInsertId()
+	for _, c := range citations {
+		if _, err := tx.Exec(
+			"INSERT INTO message_citations (message_id, marker, document_id, chunk_id, source, title, score) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			m.ID, c.Marker, c.DocumentID, c.ChunkID, c.Source, c.Title, c.Score,
+		); err != nil {
+			return fmt.Errorf("inserting citation: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	d.added(*m, sealed)
+	return nil
+}
+
+// Citations returns a message's citations ordered by marker.
+func (d *DB) Citations(messageID int64) ([]Citation, error) {
+	rows, err := d.query(
+		"SELECT marker, document_id, chunk_id, source, title, score FROM message_citations WHERE message_id = ? ORDER BY marker",
+		messageID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying citations: %w", err)
+	}
+	defer rows.Close()
+
+	var citations []Citation
+	for rows.Next() {
+		var c Citation
+		if err := rows.Scan(&c.Marker, &c.DocumentID, &c.ChunkID, &c.Source, &c.Title, &c.Score); err != nil {
+			return nil, fmt.Errorf("scanning citation: %w", err)
+		}
+		citations = append(citations, c)
+	}
+	return citations, rows.Err()
+}
@@ -0,0 +1,192 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const comparisonsSchema = `
+	CREATE TABLE IF NOT EXISTS comparisons (
+		id              INTEGER PRIMARY KEY AUTOINCREMENT,
+		conversation_id TEXT NOT NULL,
+		prompt          TEXT NOT NULL,
+		winner          TEXT NOT NULL DEFAULT '',
+		comment         TEXT NOT NULL DEFAULT '',
+		created_at      TEXT NOT NULL DEFAULT (datetime('now'))
+	);
+	CREATE TABLE IF NOT EXISTS comparison_results (
+		comparison_id INTEGER NOT NULL REFERENCES comparisons(id) ON DELETE CASCADE,
+		variant       TEXT    NOT NULL,
+		model         TEXT    NOT NULL,
+		content       TEXT    NOT NULL,
+		error         TEXT    NOT NULL DEFAULT '',
+		fallback      TEXT    NOT NULL DEFAULT '',
+		duration_ms   INTEGER NOT NULL,
+		PRIMARY KEY (comparison_id, variant)
+	);
+	`
+
+// Comparison is one input answered by several variants side by side, and
+// the variant the user picked as the best answer.
+type Comparison struct {
+	ID             int64              `json:"id"`
+	ConversationID string             `json:"conversation_id"`
+	Prompt         string             `json:"prompt"`
+	Results        []ComparisonResult `json:"results,omitempty"`
+	Winner         string             `json:"winner,omitempty"` // empty until picked; "tie" for a draw
+	Comment        string             `json:"comment,omitempty"`
+	CreatedAt      time.Time          `json:"created_at"`
+}
+
+// ComparisonResult is one variant's answer in a comparison.
+type ComparisonResult struct {
+	Variant    string `json:"variant"`
+	Model      string `json:"model"`
+	Content    string `json:"content"`
+	Error      string `json:"error,omitempty"`
+	Fallback   string `json:"fallback,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// Tie is the winner of a comparison with no better answer.
+const Tie = "tie"
+
+// AddComparison stores a comparison and its results and sets its ID.
+func (d *DB) AddComparison(c *Comparison) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	c.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	res, err := tx.Exec(
+		"INSERT INTO comparisons (conversation_id, prompt, created_at) VALUES (?, ?, ?)",
+		c.ConversationID, c.Prompt, c.CreatedAt.Format(timeFormat),
+	)
+	if err != nil {
+		return fmt.Errorf("inserting comparison: %w", err)
+	}
+	c.ID, _ = res.LastInsertId()
+	for _, r := range c.Results {
+		if _, err := tx.Exec(
+			"INSERT INTO comparison_results (comparison_id, variant, model, content, error, fallback, duration_ms) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			c.ID, r.Variant, r.Model, r.Content, r.Error, r.Fallback, r.DurationMs,
+		); err != nil {
+			return fmt.Errorf("inserting comparison result: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Comparison returns a comparison with its results.
+func (d *DB) Comparison(id int64) (*Comparison, error) {
+	var c Comparison
+	var createdAt string
+	err := d.queryRow(
+		"SELECT id, conversation_id, prompt, winner, comment, created_at FROM comparisons WHERE id = ?", id,
+	).Scan(&c.ID, &c.ConversationID, &c.Prompt, &c.Winner, &c.Comment, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying comparison: %w", err)
+	}
+	c.CreatedAt, _ = time.Parse(timeFormat, createdAt)
+
+	rows, err := d.query(
+		"SELECT variant, model, content, error, fallback, duration_ms FROM comparison_results WHERE comparison_id = ? ORDER BY rowid", id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying comparison results: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r ComparisonResult
+		if err := rows.Scan(&r.Variant, &r.Model, &r.Content, &r.Error, &r.Fallback, &r.DurationMs); err != nil {
+			return nil, fmt.Errorf("scanning comparison result: %w", err)
+		}
+		c.Results = append(c.Results, r)
+	}
+	return &c, rows.Err()
+}
+
+// Comparisons returns the most recent comparisons, newest first, without
+// their results.
+func (d *DB) Comparisons(limit int) ([]Comparison, error) {
+	rows, err := d.query(
+		"SELECT id, conversation_id, prompt, winner, comment, created_at FROM comparisons ORDER BY id DESC LIMIT ?", limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying comparisons: %w", err)
+	}
+	defer rows.Close()
+	var out []Comparison
+	for rows.Next() {
+		var c Comparison
+		var createdAt string
+		if err := rows.Scan(&c.ID, &c.ConversationID, &c.Prompt, &c.Winner, &c.Comment, &createdAt); err != nil {
+			return nil, fmt.Errorf("scanning comparison: %w", err)
+		}
+		c.CreatedAt, _ = time.Parse(timeFormat, createdAt)
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// SetComparisonWinner records the variant picked as the best answer, or
+// Tie. The winner must be one of the comparison's variants.
+func (d *DB) SetComparisonWinner(id int64, winner, comment string) error {
+	res, err := d.exec(
+		`UPDATE comparisons SET winner = ?, comment = ? WHERE id = ?
+		 AND (? = 'tie' OR EXISTS (SELECT 1 FROM comparison_results WHERE comparison_id = ? AND variant = ?))`,
+		winner, comment, id, winner, id, winner,
+	)
+	if err != nil {
+		return fmt.Errorf("saving comparison winner: %w", err)
+	}
+	return checkAffected(res)
+}
+
+// VariantStats summarizes how a variant fared in judged comparisons.
+type VariantStats struct {
+	Variant       string    `json:"variant"`
+	Judged        int       `json:"judged"` // comparisons it took part in that have a winner
+	Wins          int       `json:"wins"`
+	Ties          int       `json:"ties"`
+	Errors        int       `json:"errors"`
+	AvgDurationMs int64     `json:"avg_duration_ms"`
+	LastUsed      time.Time `json:"last_used"`
+}
+
+// ComparisonStats returns per-variant win counts over the judged
+// comparisons, variants with the most wins first.
+func (d *DB) ComparisonStats() ([]VariantStats, error) {
+	rows, err := d.query(`
+		SELECT r.variant, COUNT(*),
+		       COUNT(*) FILTER (WHERE c.winner = r.variant),
+		       COUNT(*) FILTER (WHERE c.winner = 'tie'),
+		       COUNT(*) FILTER (WHERE r.error != ''),
+		       CAST(AVG(r.duration_ms) AS INTEGER), MAX(c.created_at)
+		FROM comparison_results r JOIN comparisons c ON c.id = r.comparison_id
+		WHERE c.winner != ''
+		GROUP BY r.variant
+		ORDER BY 3 DESC, r.variant`)
+	if err != nil {
+		return nil, fmt.Errorf("querying comparison stats: %w", err)
+	}
+	defer rows.Close()
+	var out []VariantStats
+	for rows.Next() {
+		var s VariantStats
+		var lastUsed string
+		if err := rows.Scan(&s.Variant, &s.Judged, &s.Wins, &s.Ties, &s.Errors, &s.AvgDurationMs, &lastUsed); err != nil {
+			return nil, fmt.Errorf("scanning comparison stats: %w", err)
+		}
+		s.LastUsed, _ = time.Parse(timeFormat, lastUsed)
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const contactsSchema = `
+	CREATE TABLE IF NOT EXISTS contacts (
+		id            INTEGER PRIMARY KEY AUTOINCREMENT,
+		name          TEXT    NOT NULL UNIQUE COLLATE NOCASE,
+		nicknames     TEXT    NOT NULL DEFAULT '[]',
+		pronunciation TEXT    NOT NULL DEFAULT '',
+		relationship  TEXT    NOT NULL DEFAULT '',
+		notes         TEXT    NOT NULL DEFAULT '',
+		created_at    TEXT    NOT NULL DEFAULT (datetime('now'))
+	);
+	`
+
+// Contact is a person (or pet, or place) the household talks about, with
+// the names and hints needed to recognise and pronounce them.
+type Contact struct {
+	ID            int64     `json:"id"`
+	Name          string    `json:"name"`
+	Nicknames     []string  `json:"nicknames"`
+	Pronunciation string    `json:"pronunciation"`
+	Relationship  string    `json:"relationship"`
+	Notes         string    `json:"notes"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+const contactColumns = "id, name, nicknames, pronunciation, relationship, notes, created_at"
+
+// AddContact stores a contact and sets its ID.
+func (d *DB) AddContact(c *Contact) error {
+	nicknames, _ := json.Marshal(nonNil(c.Nicknames))
+	res, err := d.exec(
+		"INSERT INTO contacts (name, nicknames, pronunciation, relationship, notes) VALUES (?, ?, ?, ?, ?)",
+		c.Name, string(nicknames), c.Pronunciation, c.Relationship, c.Notes,
+	)
+	if err != nil {
+		return fmt.Errorf("inserting contact: %w", err)
+	}
+	c.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// UpdateContact replaces a contact's details.
+func (d *DB) UpdateContact(c *Contact) error {
+	nicknames, _ := json.Marshal(nonNil(c.Nicknames))
+	res, err := d.exec(
+		"UPDATE contacts SET name = ?, nicknames = ?, pronunciation = ?, relationship = ?, notes = ? WHERE id = ?",
+		c.Name, string(nicknames), c.Pronunciation, c.Relationship, c.Notes, c.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("updating contact: %w", err)
+	}
+	return checkAffected(res)
+}
+
+// DeleteContact removes a contact.
+func (d *DB) DeleteContact(id int64) error {
+	res, err := d.exec("DELETE FROM contacts WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("deleting contact: %w", err)
+	}
+	return checkAffected(res)
+}
+
+// Contact returns a single contact.
+func (d *DB) Contact(id int64) (*Contact, error) {
+	contacts, err := d.queryContacts("SELECT "+contactColumns+" FROM contacts WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(contacts) == 0 {
+		return nil, ErrNotFound
+	}
+	return &contacts[0], nil
+}
+
+// FindContact returns the contact whose name or one of whose nicknames
+// matches name, ignoring case.
+func (d *DB) FindContact(name string) (*Contact, error) {
+	contacts, err := d.Contacts()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range contacts {
+		if strings.EqualFold(c.Name, name) {
+			return &c, nil
+		}
+	}
+	for _, c := range contacts {
+		for _, n := range c.Nicknames {
+			if strings.EqualFold(n, name) {
+				return &c, nil
+			}
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Contacts returns all contacts ordered by name.
+func (d *DB) Contacts() ([]Contact, error) {
+	return d.queryContacts("SELECT " + contactColumns + " FROM contacts ORDER BY name")
+}
+
+func (d *DB) queryContacts(query string, args ...any) ([]Contact, error) {
+	rows, err := d.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying contacts: %w", err)
+	}
+	defer rows.Close()
+
+	var contacts []Contact
+	for rows.Next() {
+		var c Contact
+		var nicknames, createdAt string
+		if err := rows.Scan(&c.ID, &c.Name, &nicknames, &c.Pronunciation, &c.Relationship, &c.Notes, &createdAt); err != nil {
+			return nil, fmt.Errorf("scanning contact: %w", err)
+		}
+		json.Unmarshal([]byte(nicknames), &c.Nicknames)
+		c.Nicknames = nonNil(c.Nicknames)
+		c.CreatedAt, _ = time.Parse(timeFormat, createdAt)
+		contacts = append(contacts, c)
+	}
+	return contacts, rows.Err()
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
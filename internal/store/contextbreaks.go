@@ -0,0 +1,97 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// A context break keeps a conversation's older messages out of what the
+// model is sent, without deleting them: after_id is the last message
+// before the break. updated_at is when the break was set or lifted.
+const contextBreaksSchema = `
+	CREATE TABLE IF NOT EXISTS context_breaks (
+		conversation_id TEXT PRIMARY KEY,
+		after_id        INTEGER NOT NULL DEFAULT 0,
+		updated_at      TEXT NOT NULL DEFAULT (datetime('now'))
+	);
+	`
+
+// ExpireContext starts a conversation's context afresh if its last
+// message is older than ttl, unless the context was broken or continued
+// within ttl. It reports whether it did.
+func (d *DB) ExpireContext(conversationID string, ttl time.Duration) (bool, error) {
+	var lastID int64
+	var lastAt string
+	err := d.queryRow("SELECT id, created_at FROM messages WHERE conversation_id = ? AND deleted_at = '' ORDER BY id DESC LIMIT 1",
+		conversationID).Scan(&lastID, &lastAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("querying last message: %w", err)
+	}
+	now := time.Now()
+	if last, _ := time.Parse(timeFormat, lastAt); now.Sub(last) < ttl {
+		return false, nil
+	}
+	var afterID int64
+	var updatedAt string
+	err = d.queryRow("SELECT after_id, updated_at FROM context_breaks WHERE conversation_id = ?", conversationID).Scan(&afterID, &updatedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("querying context break: %w", err)
+	}
+	if err == nil {
+		updated, _ := time.Parse(timeFormat, updatedAt)
+		if afterID >= lastID || now.Sub(updated) < ttl {
+			return false, nil
+		}
+	}
+	return true, d.setContextBreak(conversationID, lastID, now)
+}
+
+// ContextStart returns the ID of the last message before a
+// conversation's context break, or 0 if it has none.
+func (d *DB) ContextStart(conversationID string) (int64, error) {
+	var afterID int64
+	err := d.queryRow("SELECT after_id FROM context_breaks WHERE conversation_id = ?", conversationID).Scan(&afterID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("querying context break: %w", err)
+	}
+	return afterID, nil
+}
+
+// ContinueContext lifts a conversation's context break, so the messages
+// before it are sent again and the context does not expire until it has
+// been idle for its time to live once more. It returns how many messages
+// are back in context.
+func (d *DB) ContinueContext(conversationID string) (int, error) {
+	afterID, err := d.ContextStart(conversationID)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	if afterID > 0 {
+		err := d.queryRow("SELECT COUNT(*) FROM messages WHERE conversation_id = ? AND deleted_at = '' AND id <= ?",
+			conversationID, afterID).Scan(&n)
+		if err != nil {
+			return 0, fmt.Errorf("counting messages: %w", err)
+		}
+	}
+	return n, d.setContextBreak(conversationID, 0, time.Now())
+}
+
+func (d *DB) setContextBreak(conversationID string, afterID int64, at time.Time) error {
+	_, err := d.exec(
+		`INSERT INTO context_breaks (conversation_id, after_id, updated_at) VALUES (?, ?, ?)
+		 ON CONFLICT (conversation_id) DO UPDATE SET after_id = excluded.after_id, updated_at = excluded.updated_at`,
+		conversationID, afterID, at.UTC().Format(timeFormat))
+	if err != nil {
+		return fmt.Errorf("saving context break: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const conversationProfilesSchema = `
+	CREATE TABLE IF NOT EXISTS conversation_profiles (
+		conversation_id TEXT PRIMARY KEY,
+		persona         TEXT NOT NULL DEFAULT '',
+		model           TEXT NOT NULL DEFAULT '',
+		updated_at      TEXT NOT NULL DEFAULT (datetime('now'))
+	);
+	`
+
+// ConversationProfile is the persona and model a conversation was
+// switched to, e.g. with the /persona and /model commands.
+type ConversationProfile struct {
+	ConversationID string `json:"conversation_id"`
+	// Persona answers requests that name none; empty keeps the user's.
+	Persona string `json:"persona"`
+	// Model replaces the persona's, within its max tier; empty keeps it.
+	Model     string    `json:"model"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SetConversationProfile saves a conversation's persona and model,
+// replacing any earlier ones. Setting both empty removes the profile.
+func (d *DB) SetConversationProfile(p *ConversationProfile) error {
+	var err error
+	if p.Persona == "" && p.Model == "" {
+		_, err = d.exec("DELETE FROM conversation_profiles WHERE conversation_id = ?", p.ConversationID)
+	} else {
+		_, err = d.exec(
+			`INSERT INTO conversation_profiles (conversation_id, persona, model, updated_at) VALUES (?, ?, ?, ?)
+			 ON CONFLICT (conversation_id) DO UPDATE SET persona = excluded.persona, model = excluded.model, updated_at = excluded.updated_at`,
+			p.ConversationID, p.Persona, p.Model, time.Now().UTC().Format(timeFormat),
+		)
+	}
+	if err != nil {
+		return fmt.Errorf("saving conversation profile: %w", err)
+	}
+	return nil
+}
+
+// ConversationProfile returns a conversation's persona and model, or
+// ErrNotFound if it has not been switched from the defaults.
+func (d *DB) ConversationProfile(conversationID string) (*ConversationProfile, error) {
+	var p ConversationProfile
+	var updatedAt string
+	err := d.queryRow(
+		"SELECT conversation_id, persona, model, updated_at FROM conversation_profiles WHERE conversation_id = ?",
+		conversationID,
+	).Scan(&p.ConversationID, &p.Persona, &p.Model, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying conversation profile: %w", err)
+	}
+	p.UpdatedAt, _ = time.Parse(timeFormat, updatedAt)
+	return &p, nil
+}
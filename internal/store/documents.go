@@ -0,0 +1,367 @@
+package store
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Documents are split into chunks for retrieval. Chunk text lives in an
+// FTS4 table whose docid is the chunk ID; FTS4 ships with the default
+// go-sqlite3 build, unlike FTS5.
+const documentsSchema = `
+	CREATE TABLE IF NOT EXISTS documents (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind         TEXT    NOT NULL,
+		source       TEXT    NOT NULL UNIQUE,
+		title        TEXT    NOT NULL,
+		note         TEXT    NOT NULL DEFAULT '',
+		content_hash TEXT    NOT NULL,
+		created_at   TEXT    NOT NULL DEFAULT (datetime('now')),
+		updated_at   TEXT    NOT NULL DEFAULT (datetime('now'))
+	);
+	CREATE TABLE IF NOT EXISTS chunks (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		document_id INTEGER NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+		seq         INTEGER NOT NULL,
+		hash        TEXT    NOT NULL DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS idx_chunks_document ON chunks(document_id, seq);
+	CREATE VIRTUAL TABLE IF NOT EXISTS chunks_fts USING fts4(text);
+	`
+
+// Document is an indexed source such as a bookmarked page or a file.
+type Document struct {
+	ID          int64     `json:"id"`
+	Kind        string    `json:"kind"`
+	Source      string    `json:"source"`
+	Title       string    `json:"title"`
+	Note        string    `json:"note,omitempty"`
+	ContentHash string    `json:"content_hash"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Chunk is a retrieved piece of a document with its relevance score.
+type Chunk struct {
+	ID         int64
+	DocumentID int64
+	Seq        int
+	Text       string
+	Score      float64
+	Document   Document
+}
+
+// DocumentFilter restricts a chunk search.
+type DocumentFilter struct {
+	Kind  string    // only documents of this kind
+	Since time.Time // only documents created at or after this time
+	Until time.Time // only documents created before this time
+}
+
+const documentColumns = "d.id, d.kind, d.source, d.title, d.note, d.content_hash, d.created_at, d.updated_at"
+
+// IndexStats reports what a PutDocument call changed.
+type IndexStats struct {
+	Unchanged bool `json:"unchanged"` // content hash matched; nothing was written
+	Added     int  `json:"added"`     // chunks newly indexed
+	Reused    int  `json:"reused"`    // chunks kept because their text was unchanged
+	Removed   int  `json:"removed"`   // chunks no longer present
+}
+
+// PutDocument inserts or updates the document with the same source,
+// setting doc.ID. If the stored content hash matches, nothing is written.
+// Otherwise chunks are diffed by hash and only new or modified chunks are
+// indexed; unchanged chunks keep their IDs and index entries.
+func (d *DB) PutDocument(doc *Document, chunks []string) (IndexStats, error) {
+	var stats IndexStats
+	tx, err := d.db.Begin()
+	if err != nil {
+		return stats, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int64
+	var hash string
+	err = tx.QueryRow("SELECT id, content_hash FROM documents WHERE source = ?", doc.Source).Scan(&id, &hash)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		res, err := tx.Exec(
+			"INSERT INTO documents (kind, source, title, note, content_hash) VALUES (?, ?, ?, ?, ?)",
+			doc.Kind, doc.Source, doc.Title, doc.Note, doc.ContentHash,
+		)
+		if err != nil {
+			return stats, fmt.Errorf("inserting document: %w", err)
+		}
+		id, _ = res.LastInsertId()
+	case err != nil:
+		return stats, fmt.Errorf("looking up document: %w", err)
+	case hash == doc.ContentHash:
+		doc.ID = id
+		stats.Unchanged = true
+		return stats, nil
+	default:
+		if _, err := tx.Exec(
+			"UPDATE documents SET kind = ?, title = ?, note = ?, content_hash = ?, updated_at = datetime('now') WHERE id = ?",
+			doc.Kind, doc.Title, doc.Note, doc.ContentHash, id,
+		); err != nil {
+			return stats, fmt.Errorf("updating document: %w", err)
+		}
+	}
+
+	// Map existing chunk hashes to their IDs. Identical chunks may occur
+	// more than once, so each hash holds a list.
+	existing := make(map[string][]int64)
+	rows, err := tx.Query("SELECT id, hash FROM chunks WHERE document_id = ?", id)
+	if err != nil {
+		return stats, fmt.Errorf("querying chunks: %w", err)
+	}
+	for rows.Next() {
+		var chunkID int64
+		var h string
+		if err := rows.Scan(&chunkID, &h); err != nil {
+			rows.Close()
+			return stats, fmt.Errorf("scanning chunk: %w", err)
+		}
+		existing[h] = append(existing[h], chunkID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return stats, err
+	}
+
+	for seq, text := range chunks {
+		h := chunkHash(text)
+		if ids := existing[h]; len(ids) > 0 {
+			existing[h] = ids[1:]
+			if _, err := tx.Exec("UPDATE chunks SET seq = ? WHERE id = ?", seq, ids[0]); err != nil {
+				return stats, fmt.Errorf("updating chunk: %w", err)
+			}
+			stats.Reused++
+			continue
+		}
+		res, err := tx.Exec("INSERT INTO chunks (document_id, seq, hash) VALUES (?, ?, ?)", id, seq, h)
+		if err != nil {
+			return stats, fmt.Errorf("inserting chunk: %w", err)
+		}
+		chunkID, _ := res.LastInsertId()
+		if _, err := tx.Exec("INSERT INTO chunks_fts (docid, text) VALUES (?, ?)", chunkID, text); err != nil {
+			return stats, fmt.Errorf("indexing chunk: %w", err)
+		}
+		stats.Added++
+	}
+	for _, ids := range existing {
+		for _, chunkID := range ids {
+			if err := deleteChunk(tx, chunkID); err != nil {
+				return stats, err
+			}
+			stats.Removed++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return stats, fmt.Errorf("committing document: %w", err)
+	}
+	doc.ID = id
+	return stats, nil
+}
+
+func chunkHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+func deleteChunk(tx *sql.Tx, id int64) error {
+	if _, err := tx.Exec("DELETE FROM chunks_fts WHERE docid = ?", id); err != nil {
+		return fmt.Errorf("deleting chunk index: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM chunks WHERE id = ?", id); err != nil {
+		return fmt.Errorf("deleting chunk: %w", err)
+	}
+	return nil
+}
+
+func deleteChunks(tx *sql.Tx, documentID int64) error {
+	if _, err := tx.Exec("DELETE FROM chunks_fts WHERE docid IN (SELECT id FROM chunks WHERE document_id = ?)", documentID); err != nil {
+		return fmt.Errorf("deleting chunk index: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM chunks WHERE document_id = ?", documentID); err != nil {
+		return fmt.Errorf("deleting chunks: %w", err)
+	}
+	return nil
+}
+
+// DeleteDocument removes a document and its chunks.
+func (d *DB) DeleteDocument(id int64) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := deleteChunks(tx, id); err != nil {
+		return err
+	}
+	res, err := tx.Exec("DELETE FROM documents WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("deleting document: %w", err)
+	}
+	if err := checkAffected(res); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Documents lists documents of a kind (or all kinds when empty), newest
+// first.
+func (d *DB) Documents(kind string) ([]Document, error) {
+	rows, err := d.query(
+		"SELECT "+documentColumns+" FROM documents d WHERE ? = '' OR d.kind = ? ORDER BY d.created_at DESC, d.id DESC",
+		kind, kind,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying documents: %w", err)
+	}
+	defer rows.Close()
+
+	var docs []Document
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, *doc)
+	}
+	return docs, rows.Err()
+}
+
+// Document returns the document with the given ID.
+func (d *DB) Document(id int64) (*Document, error) {
+	row := d.queryRow("SELECT "+documentColumns+" FROM documents d WHERE d.id = ?", id)
+	doc, err := scanDocument(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return doc, err
+}
+
+// DocumentBySource returns the document indexed from source.
+func (d *DB) DocumentBySource(source string) (*Document, error) {
+	row := d.queryRow("SELECT "+documentColumns+" FROM documents d WHERE d.source = ?", source)
+	doc, err := scanDocument(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return doc, err
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanDocument(row scanner) (*Document, error) {
+	var doc Document
+	var createdAt, updatedAt string
+	if err := row.Scan(&doc.ID, &doc.Kind, &doc.Source, &doc.Title, &doc.Note, &doc.ContentHash, &createdAt, &updatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("scanning document: %w", err)
+	}
+	doc.CreatedAt, _ = time.Parse(timeFormat, createdAt)
+	doc.UpdatedAt, _ = time.Parse(timeFormat, updatedAt)
+	return &doc, nil
+}
+
+// maxCandidates bounds how many matching chunks are ranked per search.
+const maxCandidates = 500
+
+// SearchChunks runs a full-text query (FTS4 syntax, e.g. "go OR generics")
+// and returns the best matching chunks ranked by BM25.
+func (d *DB) SearchChunks(query string, limit int, f DocumentFilter) ([]Chunk, error) {
+	since, until := "", "9999"
+	if !f.Since.IsZero() {
+		since = f.Since.UTC().Format(timeFormat)
+	}
+	if !f.Until.IsZero() {
+		until = f.Until.UTC().Format(timeFormat)
+	}
+	rows, err := d.query(`
+		SELECT c.id, c.document_id, c.seq, chunks_fts.text, matchinfo(chunks_fts, 'pcnalx'), `+documentColumns+`
+		FROM chunks_fts
+		JOIN chunks c ON c.id = chunks_fts.docid
+		JOIN documents d ON d.id = c.document_id
+		WHERE chunks_fts MATCH ? AND (? = '' OR d.kind = ?) AND d.created_at >= ? AND d.created_at < ?
+		LIMIT ?`,
+		query, f.Kind, f.Kind, since, until, maxCandidates,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("searching chunks: %w", err)
+	}
+	defer rows.Close()
+
+	var chunks []Chunk
+	for rows.Next() {
+		var c Chunk
+		var info []byte
+		var createdAt, updatedAt string
+		doc := &c.Document
+		if err := rows.Scan(&c.ID, &c.DocumentID, &c.Seq, &c.Text, &info,
+			&doc.ID, &doc.Kind, &doc.Source, &doc.Title, &doc.Note, &doc.ContentHash, &createdAt, &updatedAt); err != nil {
+			return nil, fmt.Errorf("scanning chunk: %w", err)
+		}
+		doc.CreatedAt, _ = time.Parse(timeFormat, createdAt)
+		doc.UpdatedAt, _ = time.Parse(timeFormat, updatedAt)
+		c.Score = bm25(info)
+		chunks = append(chunks, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].Score > chunks[j].Score })
+	if len(chunks) > limit {
+		chunks = chunks[:limit]
+	}
+	return chunks, nil
+}
+
+// bm25 scores a row from FTS4 matchinfo 'pcnalx' output, which is a
+// sequence of native-endian uint32s: phrase count, column count, row
+// count, average tokens per column, tokens in this row per column, then
+// three hit counts per phrase and column.
+func bm25(info []byte) float64 {
+	const k1, b = 1.2, 0.75
+	v := make([]uint32, len(info)/4)
+	for i := range v {
+		v[i] = binary.NativeEndian.Uint32(info[i*4:])
+	}
+	if len(v) < 3 {
+		return 0
+	}
+	p, c, n := int(v[0]), int(v[1]), float64(v[2])
+	avg, length := v[3:3+c], v[3+c:3+2*c]
+	x := v[3+2*c:]
+
+	var score float64
+	for i := 0; i < p; i++ {
+		for col := 0; col < c; col++ {
+			base := 3 * (i*c + col)
+			if base+2 >= len(x) {
+				break
+			}
+			tf, df := float64(x[base]), float64(x[base+2])
+			if tf == 0 {
+				continue
+			}
+			idf := math.Log((n-df+0.5)/(df+0.5) + 1)
+			norm := 1 - b + b*float64(length[col])/math.Max(float64(avg[col]), 1)
+			score += idf * tf * (k1 + 1) / (tf + k1*norm)
+		}
+	}
+	return score
+}
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// Extracted email text stays in this table on the local disk only; it is
+// pruned once it has been digested and is older than the retention period.
+const emailSchema = `
+	CREATE TABLE IF NOT EXISTS email_messages (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		folder       TEXT    NOT NULL,
+		uid_validity INTEGER NOT NULL,
+		uid          INTEGER NOT NULL,
+		sender       TEXT    NOT NULL,
+		subject      TEXT    NOT NULL,
+		sent_at      TEXT    NOT NULL,
+		text         TEXT    NOT NULL,
+		digested     INTEGER NOT NULL DEFAULT 0,
+		created_at   TEXT    NOT NULL DEFAULT (datetime('now')),
+		UNIQUE (folder, uid_validity, uid)
+	);
+	`
+
+// EmailMessage is an unread email fetched for the digest.
+type EmailMessage struct {
+	ID          int64
+	Folder      string
+	UIDValidity uint32
+	UID         uint32
+	From        string
+	Subject     string
+	SentAt      time.Time
+	Text        string
+}
+
+// HasEmail reports whether a message has already been fetched.
+func (d *DB) HasEmail(folder string, uidValidity, uid uint32) (bool, error) {
+	var n int
+	err := d.queryRow(
+		"SELECT COUNT(*) FROM email_messages WHERE folder = ? AND uid_validity = ? AND uid = ?",
+		folder, uidValidity, uid,
+	).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("querying email: %w", err)
+	}
+	return n > 0, nil
+}
+
+// AddEmail stores a fetched message awaiting the next digest.
+func (d *DB) AddEmail(m *EmailMessage) error {
+	res, err := d.exec(
+		"INSERT OR IGNORE INTO email_messages (folder, uid_validity, uid, sender, subject, sent_at, text) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		m.Folder, m.UIDValidity, m.UID, m.From, m.Subject, m.SentAt.UTC().Format(timeFormat), m.Text,
+	)
+	if err != nil {
+		return fmt.Errorf("inserting email: %w", err)
+	}
+	m.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// PendingEmails returns the messages not yet included in a digest, oldest
+// first.
+func (d *DB) PendingEmails() ([]EmailMessage, error) {
+	rows, err := d.query(
+		"SELECT id, folder, uid_validity, uid, sender, subject, sent_at, text FROM email_messages WHERE digested = 0 ORDER BY sent_at, id",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying emails: %w", err)
+	}
+	defer rows.Close()
+
+	var msgs []EmailMessage
+	for rows.Next() {
+		var m EmailMessage
+		var sentAt string
+		if err := rows.Scan(&m.ID, &m.Folder, &m.UIDValidity, &m.UID, &m.From, &m.Subject, &sentAt, &m.Text); err != nil {
+			return nil, fmt.Errorf("scanning email: %w", err)
+		}
+		m.SentAt, _ = time.Parse(timeFormat, sentAt)
+		msgs = append(msgs, m)
+	}
+	return msgs, rows.Err()
+}
+
+// MarkEmailsDigested flags messages as included in a digest.
+func (d *DB) MarkEmailsDigested(ids []int64) error {
+	for _, id := range ids {
+		if _, err := d.exec("UPDATE email_messages SET digested = 1 WHERE id = ?", id); err != nil {
+			return fmt.Errorf("updating email: %w", err)
+		}
+	}
+	return nil
+}
+
+// PruneEmails clears the extracted text of digested messages fetched
+// before cutoff. The row is kept so the message is not fetched again.
+func (d *DB) PruneEmails(cutoff time.Time) error {
+	_, err := d.exec(
+		"UPDATE email_messages SET text = '', sender = '', subject = '' WHERE digested = 1 AND created_at < ?",
+		cutoff.UTC().Format(timeFormat),
+	)
+	if err != nil {
+		return fmt.Errorf("pruning emails: %w", err)
+	}
+	return nil
+}
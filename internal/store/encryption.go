@@ -0,0 +1,347 @@
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An encrypted conversation's message content is stored sealed with
+// AES-256-GCM under a key the client holds. The database keeps only a
+// check value to recognise the key; the key itself is held in memory
+// while a request that supplied it is being served (see Unlock).
+const encryptedSchema = `
+	CREATE TABLE IF NOT EXISTS encrypted_conversations (
+		conversation_id TEXT PRIMARY KEY,
+		key_check       TEXT NOT NULL,
+		created_at      TEXT NOT NULL DEFAULT (datetime('now'))
+	);
+	`
+
+// KeySize is the length of a conversation key.
+const KeySize = 32
+
+// sealedPrefix marks sealed content, followed by the base64 nonce and
+// ciphertext.
+const sealedPrefix = "pi-agent:sealed:1:"
+
+var (
+	// ErrLocked is returned when writing to an encrypted conversation
+	// whose key was not supplied.
+	ErrLocked = errors.New("conversation is encrypted and its key was not supplied")
+	// ErrWrongKey is returned for a key that does not open the
+	// conversation.
+	ErrWrongKey = errors.New("wrong conversation key")
+	// ErrEncrypted is returned for operations encrypted conversations do
+	// not support.
+	ErrEncrypted = errors.New("not supported for encrypted conversations")
+)
+
+// keyring holds the keys of the encrypted conversations being used, with
+// how many requests are using each.
+type keyring struct {
+	mu   sync.Mutex
+	keys map[string]*heldKey
+}
+
+type heldKey struct {
+	aead cipher.AEAD
+	refs int
+}
+
+func (k *keyring) get(conversationID string) cipher.AEAD {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if h := k.keys[conversationID]; h != nil {
+		return h.aead
+	}
+	return nil
+}
+
+func (k *keyring) hold(conversationID string, aead cipher.AEAD) func() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.keys == nil {
+		k.keys = make(map[string]*heldKey)
+	}
+	h := k.keys[conversationID]
+	if h == nil {
+		h = &heldKey{aead: aead}
+		k.keys[conversationID] = h
+	}
+	h.refs++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			k.mu.Lock()
+			defer k.mu.Unlock()
+			if h.refs--; h.refs == 0 {
+				delete(k.keys, conversationID)
+			}
+		})
+	}
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("conversation key must be %d bytes", KeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// keyCheck identifies a conversation's key without revealing it.
+func keyCheck(conversationID string, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("pi-agent conversation key\x00" + conversationID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// seal encrypts content for a conversation. The conversation ID is bound
+// in, so sealed content cannot be moved to another conversation.
+func seal(aead cipher.AEAD, conversationID, content string) string {
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	out := aead.Seal(nonce, nonce, []byte(content), []byte(conversationID))
+	return sealedPrefix + base64.RawStdEncoding.EncodeToString(out)
+}
+
+func unseal(aead cipher.AEAD, conversationID, sealed string) (string, error) {
+	data, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(sealed, sealedPrefix))
+	if err != nil || len(data) < aead.NonceSize() {
+		return "", errors.New("malformed sealed content")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(conversationID))
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// Encrypted reports whether a conversation is encrypted.
+func (d *DB) Encrypted(conversationID string) (bool, error) {
+	_, err := d.keyCheckOf(conversationID)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (d *DB) keyCheckOf(conversationID string) (string, error) {
+	var check string
+	err := d.queryRow("SELECT key_check FROM encrypted_conversations WHERE conversation_id = ?", conversationID).Scan(&check)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("querying encryption: %w", err)
+	}
+	return check, nil
+}
+
+// Unlock holds a conversation's key in memory until the returned function
+// is called, so that its messages are sealed as they are stored and
+// opened as they are read. It returns ErrWrongKey if key is not the
+// conversation's and ErrNotFound if the conversation is not encrypted.
+func (d *DB) Unlock(conversationID string, key []byte) (release func(), err error) {
+	check, err := d.keyCheckOf(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(check), []byte(keyCheck(conversationID, key))) {
+		return nil, ErrWrongKey
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return d.keys.hold(conversationID, aead), nil
+}
+
+// sealFor returns content as it is to be stored in a conversation, and
+// whether it is sealed, as it is if the conversation is encrypted. It
+// returns ErrLocked if the conversation is encrypted and not unlocked.
+func (d *DB) sealFor(conversationID, content string) (string, bool, error) {
+	if aead := d.keys.get(conversationID); aead != nil {
+		return seal(aead, conversationID, content), true, nil
+	}
+	encrypted, err := d.Encrypted(conversationID)
+	if err != nil {
+		return "", false, err
+	}
+	if encrypted {
+		return "", false, ErrLocked
+	}
+	return content, false, nil
+}
+
+// open returns stored content as plain text if it is not sealed or its
+// conversation is unlocked, and empty otherwise, so that nothing sealed
+// leaves the store.
+func (d *DB) open(conversationID, content string) string {
+	if !strings.HasPrefix(content, sealedPrefix) {
+		return content
+	}
+	aead := d.keys.get(conversationID)
+	if aead == nil {
+		return ""
+	}
+	plain, err := unseal(aead, conversationID, content)
+	if err != nil {
+		return ""
+	}
+	return plain
+}
+
+// unsealed returns content if it is not sealed and empty otherwise. Reads
+// spanning conversations, such as the inbox and feedback exports, use it
+// rather than open: the keys held are those of whichever requests are
+// running, not of whoever is reading.
+func unsealed(content string) string {
+	if strings.HasPrefix(content, sealedPrefix) {
+		return ""
+	}
+	return content
+}
+
+// EncryptConversation turns on encryption for a conversation with key,
+// sealing the messages and revisions it already has and dropping its
+// MQTT binding, which would publish its replies in plain text.
+func (d *DB) EncryptConversation(conversationID string, key []byte) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	if encrypted, err := d.Encrypted(conversationID); err != nil {
+		return err
+	} else if encrypted {
+		return errors.New("conversation is already encrypted")
+	}
+	err = d.recrypt(conversationID, func(content string) (string, error) {
+		if strings.HasPrefix(content, sealedPrefix) {
+			return content, nil
+		}
+		return seal(aead, conversationID, content), nil
+	}, func(tx *sql.Tx) error {
+		if _, err := tx.Exec("INSERT INTO encrypted_conversations (conversation_id, key_check, created_at) VALUES (?, ?, ?)",
+			conversationID, keyCheck(conversationID, key), time.Now().UTC().Format(timeFormat)); err != nil {
+			return err
+		}
+		_, err := tx.Exec("DELETE FROM mqtt_outputs WHERE conversation_id = ?", conversationID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("encrypting conversation: %w", err)
+	}
+	return nil
+}
+
+// DecryptConversation turns off encryption for a conversation, storing
+// its messages and revisions as plain text again. It returns ErrWrongKey
+// if key is not the conversation's and ErrNotFound if it is not
+// encrypted.
+func (d *DB) DecryptConversation(conversationID string, key []byte) error {
+	check, err := d.keyCheckOf(conversationID)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(check), []byte(keyCheck(conversationID, key))) {
+		return ErrWrongKey
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	err = d.recrypt(conversationID, func(content string) (string, error) {
+		if !strings.HasPrefix(content, sealedPrefix) {
+			return content, nil
+		}
+		return unseal(aead, conversationID, content)
+	}, func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM encrypted_conversations WHERE conversation_id = ?", conversationID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("decrypting conversation: %w", err)
+	}
+	return nil
+}
+
+// recrypt rewrites the content of a conversation's messages, deleted
+// ones included, and their revisions with convert, then runs done, all
+// in one transaction.
+func (d *DB) recrypt(conversationID string, convert func(string) (string, error), done func(*sql.Tx) error) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, q := range []struct{ sel, upd string }{
+		{"SELECT id, content FROM messages WHERE conversation_id = ?", "UPDATE messages SET content = ? WHERE id = ?"},
+		{"SELECT r.id, r.content FROM message_revisions r JOIN messages m ON m.id = r.message_id WHERE m.conversation_id = ?", "UPDATE message_revisions SET content = ? WHERE id = ?"},
+	} {
+		rows, err := tx.Query(q.sel, conversationID)
+		if err != nil {
+			return err
+		}
+		type row struct {
+			id      int64
+			content string
+		}
+		var todo []row
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.id, &r.content); err != nil {
+				rows.Close()
+				return err
+			}
+			todo = append(todo, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, r := range todo {
+			content, err := convert(r.content)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(q.upd, content, r.id); err != nil {
+				return err
+			}
+		}
+	}
+	if err := done(tx); err != nil {
+		return err
+	}
+	err = tx.Commit()
+	d.tails.invalidate(conversationID)
+	return err
+}
+
+// MessageConversation returns the conversation a message belongs to,
+// deleted or not.
+func (d *DB) MessageConversation(id int64) (string, error) {
+	var conv string
+	err := d.queryRow("SELECT conversation_id FROM messages WHERE id = ?", id).Scan(&conv)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("querying message: %w", err)
+	}
+	return conv, nil
+}
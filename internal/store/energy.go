@@ -0,0 +1,126 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const energySchema = `
+	CREATE TABLE IF NOT EXISTS energy_readings (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		meter      TEXT    NOT NULL,
+		read_at    TEXT    NOT NULL,
+		power_w    REAL    NOT NULL,
+		energy_kwh REAL
+	);
+	CREATE INDEX IF NOT EXISTS idx_energy_meter_time
+		ON energy_readings(meter, read_at);
+	`
+
+// EnergyReading is a single sample from an energy meter. EnergyKWh is the
+// meter's cumulative counter, or zero if the meter only reports power.
+type EnergyReading struct {
+	Meter     string
+	ReadAt    time.Time
+	PowerW    float64
+	EnergyKWh float64
+}
+
+// EnergyStats summarizes a meter's readings over a time range.
+type EnergyStats struct {
+	Meter       string
+	Samples     int
+	AvgPowerW   float64
+	PeakPowerW  float64
+	ConsumedKWh float64 // from the cumulative counter; zero without one
+}
+
+// AddEnergyReading stores a meter sample. Samples from meters polled at
+// the same time are committed together.
+func (d *DB) AddEnergyReading(r EnergyReading) error {
+	var energy any
+	if r.EnergyKWh > 0 {
+		energy = r.EnergyKWh
+	}
+	err := d.batched(func(tx *sql.Tx) error {
+		_, err := d.txExec(tx,
+			"INSERT INTO energy_readings (meter, read_at, power_w, energy_kwh) VALUES (?, ?, ?, ?)",
+			r.Meter, r.ReadAt.UTC().Format(timeFormat), r.PowerW, energy,
+		)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("inserting energy reading: %w", err)
+	}
+	return nil
+}
+
+// EnergyStats returns per-meter statistics for readings in [from, to). An
+// empty meter name includes all meters.
+func (d *DB) EnergyStats(meter string, from, to time.Time) ([]EnergyStats, error) {
+	rows, err := d.query(`
+		SELECT meter, COUNT(*), AVG(power_w), MAX(power_w),
+		       COALESCE(MAX(energy_kwh) - MIN(energy_kwh), 0)
+		FROM energy_readings
+		WHERE read_at >= ? AND read_at < ? AND (? = '' OR meter = ?)
+		GROUP BY meter ORDER BY meter`,
+		from.UTC().Format(timeFormat), to.UTC().Format(timeFormat), meter, meter,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying energy stats: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []EnergyStats
+	for rows.Next() {
+		var st EnergyStats
+		if err := rows.Scan(&st.Meter, &st.Samples, &st.AvgPowerW, &st.PeakPowerW, &st.ConsumedKWh); err != nil {
+			return nil, fmt.Errorf("scanning energy stats: %w", err)
+		}
+		stats = append(stats, st)
+	}
+	return stats, rows.Err()
+}
+
+// EnergyReadings returns the readings taken since a time, oldest first.
+// An empty meter name includes all meters.
+func (d *DB) EnergyReadings(meter string, since time.Time) ([]EnergyReading, error) {
+	rows, err := d.query(`
+		SELECT meter, read_at, power_w, COALESCE(energy_kwh, 0) FROM energy_readings
+		WHERE read_at >= ? AND (? = '' OR meter = ?)
+		ORDER BY read_at, id`,
+		since.UTC().Format(timeFormat), meter, meter,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying energy readings: %w", err)
+	}
+	defer rows.Close()
+
+	var out []EnergyReading
+	for rows.Next() {
+		var r EnergyReading
+		var readAt string
+		if err := rows.Scan(&r.Meter, &readAt, &r.PowerW, &r.EnergyKWh); err != nil {
+			return nil, fmt.Errorf("scanning energy reading: %w", err)
+		}
+		r.ReadAt, _ = time.Parse(timeFormat, readAt)
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// EnergyReadingCSV is the header of EnergyReading.CSV rows.
+var EnergyReadingCSV = strings.Split("read_at,meter,power_w,energy_kwh", ",")
+
+// CSV returns the reading as a row of values matching EnergyReadingCSV;
+// energy_kwh is empty for meters that only report power.
+func (r EnergyReading) CSV() []string {
+	energy := ""
+	if r.EnergyKWh > 0 {
+		energy = strconv.FormatFloat(r.EnergyKWh, 'f', -1, 64)
+	}
+	return []string{r.ReadAt.Format(time.RFC3339), r.Meter, strconv.FormatFloat(r.PowerW, 'f', -1, 64), energy}
+}
@@ -0,0 +1,163 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const feedbackSchema = `
+	CREATE TABLE IF NOT EXISTS message_feedback (
+		message_id INTEGER PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+		rating     TEXT NOT NULL DEFAULT '',
+		comment    TEXT NOT NULL DEFAULT '',
+		updated_at TEXT NOT NULL DEFAULT (datetime('now'))
+	);
+	`
+
+// Ratings a message's feedback may give.
+const (
+	RatingUp   = "up"
+	RatingDown = "down"
+)
+
+// Feedback is the user's reaction to a message: a thumbs up or down, a
+// comment, or both.
+type Feedback struct {
+	MessageID int64     `json:"message_id"`
+	Rating    string    `json:"rating,omitempty"` // RatingUp, RatingDown or empty
+	Comment   string    `json:"comment,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SetFeedback records feedback on a message, replacing any given before.
+func (d *DB) SetFeedback(f *Feedback) error {
+	if f.Rating != "" && f.Rating != RatingUp && f.Rating != RatingDown {
+		return fmt.Errorf("rating must be %q, %q or empty", RatingUp, RatingDown)
+	}
+	f.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	_, err := d.exec(
+		`INSERT INTO message_feedback (message_id, rating, comment, updated_at)
+		 SELECT id, ?, ?, ? FROM messages WHERE id = ? AND deleted_at = ''
+		 ON CONFLICT (message_id) DO UPDATE SET rating = excluded.rating, comment = excluded.comment, updated_at = excluded.updated_at`,
+		f.Rating, f.Comment, f.UpdatedAt.Format(timeFormat), f.MessageID,
+	)
+	if err != nil {
+		return fmt.Errorf("saving feedback: %w", err)
+	}
+	// The insert selects nothing when the message does not exist.
+	if _, err := d.Feedback(f.MessageID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Feedback returns the feedback on a message.
+func (d *DB) Feedback(messageID int64) (*Feedback, error) {
+	var f Feedback
+	var updatedAt string
+	err := d.queryRow(
+		"SELECT message_id, rating, comment, updated_at FROM message_feedback WHERE message_id = ?", messageID,
+	).Scan(&f.MessageID, &f.Rating, &f.Comment, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying feedback: %w", err)
+	}
+	f.UpdatedAt, _ = time.Parse(timeFormat, updatedAt)
+	return &f, nil
+}
+
+// DeleteFeedback removes the feedback on a message.
+func (d *DB) DeleteFeedback(messageID int64) error {
+	res, err := d.exec("DELETE FROM message_feedback WHERE message_id = ?", messageID)
+	if err != nil {
+		return fmt.Errorf("deleting feedback: %w", err)
+	}
+	return checkAffected(res)
+}
+
+// ConversationFeedback returns the feedback on a conversation's messages,
+// keyed by message ID.
+func (d *DB) ConversationFeedback(conversationID string) (map[int64]Feedback, error) {
+	rows, err := d.query(
+		`SELECT f.message_id, f.rating, f.comment, f.updated_at
+		 FROM message_feedback f JOIN messages m ON m.id = f.message_id
+		 WHERE m.conversation_id = ?`, conversationID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying feedback: %w", err)
+	}
+	defer rows.Close()
+	out := make(map[int64]Feedback)
+	for rows.Next() {
+		var f Feedback
+		var updatedAt string
+		if err := rows.Scan(&f.MessageID, &f.Rating, &f.Comment, &updatedAt); err != nil {
+			return nil, fmt.Errorf("scanning feedback: %w", err)
+		}
+		f.UpdatedAt, _ = time.Parse(timeFormat, updatedAt)
+		out[f.MessageID] = f
+	}
+	return out, rows.Err()
+}
+
+// FeedbackRecord is feedback together with the message it is about and
+// the user message that prompted it, for analysis.
+type FeedbackRecord struct {
+	Feedback
+	ConversationID string    `json:"conversation_id"`
+	Role           Role      `json:"role"`
+	Prompt         string    `json:"prompt"` // the preceding user message
+	Content        string    `json:"content"`
+	Fallback       string    `json:"fallback,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// FeedbackSince returns the feedback given or changed at or after since,
+// oldest first. The messages of encrypted conversations are left empty.
+func (d *DB) FeedbackSince(since time.Time) ([]FeedbackRecord, error) {
+	rows, err := d.query(`
+		SELECT f.message_id, f.rating, f.comment, f.updated_at,
+		       m.conversation_id, m.role, m.content, m.fallback, m.created_at,
+		       COALESCE((SELECT p.content FROM messages p
+		                 WHERE p.conversation_id = m.conversation_id AND p.id < m.id AND p.role = 'user' AND p.deleted_at = ''
+		                 ORDER BY p.id DESC LIMIT 1), '')
+		FROM message_feedback f JOIN messages m ON m.id = f.message_id
+		WHERE f.updated_at >= ?
+		ORDER BY f.updated_at, f.message_id`,
+		since.UTC().Format(timeFormat),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying feedback: %w", err)
+	}
+	defer rows.Close()
+	var out []FeedbackRecord
+	for rows.Next() {
+		var r FeedbackRecord
+		var updatedAt, createdAt string
+		if err := rows.Scan(&r.MessageID, &r.Rating, &r.Comment, &updatedAt,
+			&r.ConversationID, &r.Role, &r.Content, &r.Fallback, &createdAt, &r.Prompt); err != nil {
+			return nil, fmt.Errorf("scanning feedback: %w", err)
+		}
+		r.Content, r.Prompt = unsealed(r.Content), unsealed(r.Prompt)
+		r.UpdatedAt, _ = time.Parse(timeFormat, updatedAt)
+		r.CreatedAt, _ = time.Parse(timeFormat, createdAt)
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// FeedbackCSV is the header of FeedbackRecord.CSV rows.
+var FeedbackCSV = strings.Split("message_id,conversation_id,role,rating,comment,prompt,content,fallback,created_at,updated_at", ",")
+
+// CSV returns the record as a row of values matching FeedbackCSV.
+func (r FeedbackRecord) CSV() []string {
+	return []string{
+		fmt.Sprint(r.MessageID), r.ConversationID, string(r.Role), r.Rating, r.Comment, r.Prompt, r.Content, r.Fallback,
+		r.CreatedAt.Format(time.RFC3339), r.UpdatedAt.Format(time.RFC3339),
+	}
+}
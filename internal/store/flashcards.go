@@ -0,0 +1,246 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const flashcardsSchema = `
+	CREATE TABLE IF NOT EXISTS flashcard_decks (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		name       TEXT NOT NULL UNIQUE COLLATE NOCASE,
+		created_at TEXT NOT NULL DEFAULT (datetime('now'))
+	);
+	CREATE TABLE IF NOT EXISTS flashcards (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		deck_id    INTEGER NOT NULL REFERENCES flashcard_decks(id) ON DELETE CASCADE,
+		front      TEXT NOT NULL,
+		back       TEXT NOT NULL,
+		created_at TEXT NOT NULL DEFAULT (datetime('now')),
+		UNIQUE (deck_id, front)
+	);
+	CREATE TABLE IF NOT EXISTS flashcard_reviews (
+		card_id     INTEGER NOT NULL REFERENCES flashcards(id) ON DELETE CASCADE,
+		user        TEXT NOT NULL COLLATE NOCASE,
+		ease        REAL NOT NULL,
+		interval    INTEGER NOT NULL,
+		reps        INTEGER NOT NULL,
+		due         TEXT NOT NULL,
+		correct     INTEGER NOT NULL DEFAULT 0,
+		attempts    INTEGER NOT NULL DEFAULT 0,
+		reviewed_at TEXT NOT NULL,
+		PRIMARY KEY (card_id, user)
+	);
+	CREATE INDEX IF NOT EXISTS idx_flashcard_reviews_due ON flashcard_reviews(user, due);
+	`
+
+// Deck is a named set of flashcards.
+type Deck struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Cards int    `json:"cards"`
+}
+
+// Flashcard is a question and its answer.
+type Flashcard struct {
+	ID     int64  `json:"id"`
+	DeckID int64  `json:"deck_id"`
+	Front  string `json:"front"`
+	Back   string `json:"back"`
+}
+
+// Review is a user's spaced-repetition state for a card.
+type Review struct {
+	CardID     int64     `json:"card_id"`
+	User       string    `json:"user"`
+	Ease       float64   `json:"ease"`
+	Interval   int       `json:"interval"` // days
+	Reps       int       `json:"reps"`     // correct answers in a row
+	Due        time.Time `json:"due"`
+	Correct    int       `json:"correct"`
+	Attempts   int       `json:"attempts"`
+	ReviewedAt time.Time `json:"reviewed_at"`
+}
+
+// DeckScore sums a user's answers in a deck.
+type DeckScore struct {
+	Deck     string `json:"deck"`
+	Cards    int    `json:"cards"`
+	Seen     int    `json:"seen"`
+	Due      int    `json:"due"`
+	Correct  int    `json:"correct"`
+	Attempts int    `json:"attempts"`
+}
+
+// Deck returns a deck by name, creating it if create is set and it does
+// not exist.
+func (d *DB) Deck(name string, create bool) (*Deck, error) {
+	dk := Deck{Name: name}
+	err := d.queryRow(`SELECT d.id, d.name, (SELECT COUNT(*) FROM flashcards WHERE deck_id = d.id)
+		FROM flashcard_decks d WHERE d.name = ?`, name).Scan(&dk.ID, &dk.Name, &dk.Cards)
+	switch {
+	case err == nil:
+		return &dk, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, fmt.Errorf("querying deck: %w", err)
+	case !create:
+		return nil, ErrNotFound
+	}
+	res, err := d.exec("INSERT INTO flashcard_decks (name, created_at) VALUES (?, ?)", name, time.Now().UTC().Format(timeFormat))
+	if err != nil {
+		return nil, fmt.Errorf("creating deck: %w", err)
+	}
+	dk.ID, _ = res.LastInsertId()
+	return &dk, nil
+}
+
+// Decks returns every deck, by name.
+func (d *DB) Decks() ([]Deck, error) {
+	rows, err := d.query(`SELECT d.id, d.name, COUNT(c.id) FROM flashcard_decks d
+		LEFT JOIN flashcards c ON c.deck_id = d.id GROUP BY d.id ORDER BY d.name`)
+	if err != nil {
+		return nil, fmt.Errorf("querying decks: %w", err)
+	}
+	defer rows.Close()
+	var out []Deck
+	for rows.Next() {
+		var dk Deck
+		if err := rows.Scan(&dk.ID, &dk.Name, &dk.Cards); err != nil {
+			return nil, fmt.Errorf("scanning deck: %w", err)
+		}
+		out = append(out, dk)
+	}
+	return out, rows.Err()
+}
+
+// DeleteDeck removes a deck with its cards and their review history.
+func (d *DB) DeleteDeck(id int64) error {
+	res, err := d.exec("DELETE FROM flashcard_decks WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("deleting deck: %w", err)
+	}
+	return checkAffected(res)
+}
+
+// AddFlashcard adds a card to a deck and sets its ID. A card with the same
+// front replaces the old answer, keeping its review history, and added
+// reports false.
+func (d *DB) AddFlashcard(c *Flashcard) (added bool, err error) {
+	var id int64
+	err = d.queryRow("SELECT id FROM flashcards WHERE deck_id = ? AND front = ?", c.DeckID, c.Front).Scan(&id)
+	switch {
+	case err == nil:
+		c.ID = id
+		if _, err := d.exec("UPDATE flashcards SET back = ? WHERE id = ?", c.Back, id); err != nil {
+			return false, fmt.Errorf("updating flashcard: %w", err)
+		}
+		return false, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return false, fmt.Errorf("querying flashcard: %w", err)
+	}
+	res, err := d.exec("INSERT INTO flashcards (deck_id, front, back, created_at) VALUES (?, ?, ?, ?)",
+		c.DeckID, c.Front, c.Back, time.Now().UTC().Format(timeFormat))
+	if err != nil {
+		return false, fmt.Errorf("adding flashcard: %w", err)
+	}
+	c.ID, _ = res.LastInsertId()
+	return true, nil
+}
+
+// DueFlashcards returns up to limit cards of a deck for a user to review
+// at now: overdue cards first, most overdue first, then cards the user
+// has never seen, in the order they were added, up to newLimit of them.
+func (d *DB) DueFlashcards(deckID int64, user string, now time.Time, limit, newLimit int) ([]Flashcard, error) {
+	rows, err := d.query(`SELECT c.id, c.deck_id, c.front, c.back FROM flashcards c
+		JOIN flashcard_reviews r ON r.card_id = c.id AND r.user = ?
+		WHERE c.deck_id = ? AND r.due <= ? ORDER BY r.due LIMIT ?`,
+		user, deckID, now.UTC().Format(timeFormat), limit)
+	if err != nil {
+		return nil, fmt.Errorf("querying due flashcards: %w", err)
+	}
+	due, err := scanFlashcards(rows)
+	if err != nil || len(due) >= limit {
+		return due, err
+	}
+	rows, err = d.query(`SELECT c.id, c.deck_id, c.front, c.back FROM flashcards c
+		WHERE c.deck_id = ? AND NOT EXISTS (SELECT 1 FROM flashcard_reviews r WHERE r.card_id = c.id AND r.user = ?)
+		ORDER BY c.id LIMIT ?`,
+		deckID, user, min(limit-len(due), newLimit))
+	if err != nil {
+		return nil, fmt.Errorf("querying new flashcards: %w", err)
+	}
+	fresh, err := scanFlashcards(rows)
+	return append(due, fresh...), err
+}
+
+// Review returns a user's review state for a card, or ErrNotFound if they
+// have not seen it.
+func (d *DB) Review(cardID int64, user string) (*Review, error) {
+	r := Review{CardID: cardID}
+	var due, reviewed string
+	err := d.queryRow(`SELECT user, ease, interval, reps, due, correct, attempts, reviewed_at
+		FROM flashcard_reviews WHERE card_id = ? AND user = ?`, cardID, user).
+		Scan(&r.User, &r.Ease, &r.Interval, &r.Reps, &due, &r.Correct, &r.Attempts, &reviewed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying review: %w", err)
+	}
+	r.Due, _ = time.Parse(timeFormat, due)
+	r.ReviewedAt, _ = time.Parse(timeFormat, reviewed)
+	return &r, nil
+}
+
+// SaveReview stores a user's review state for a card.
+func (d *DB) SaveReview(r *Review) error {
+	_, err := d.exec(`INSERT INTO flashcard_reviews (card_id, user, ease, interval, reps, due, correct, attempts, reviewed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (card_id, user) DO UPDATE SET ease = excluded.ease, interval = excluded.interval,
+			reps = excluded.reps, due = excluded.due, correct = excluded.correct,
+			attempts = excluded.attempts, reviewed_at = excluded.reviewed_at`,
+		r.CardID, r.User, r.Ease, r.Interval, r.Reps, r.Due.UTC().Format(timeFormat),
+		r.Correct, r.Attempts, r.ReviewedAt.UTC().Format(timeFormat))
+	if err != nil {
+		return fmt.Errorf("saving review: %w", err)
+	}
+	return nil
+}
+
+// DeckScores returns a user's progress in every deck as of now.
+func (d *DB) DeckScores(user string, now time.Time) ([]DeckScore, error) {
+	rows, err := d.query(`SELECT d.name, COUNT(c.id), COUNT(r.card_id),
+			COALESCE(SUM(r.due <= ?), 0), COALESCE(SUM(r.correct), 0), COALESCE(SUM(r.attempts), 0)
+		FROM flashcard_decks d
+		LEFT JOIN flashcards c ON c.deck_id = d.id
+		LEFT JOIN flashcard_reviews r ON r.card_id = c.id AND r.user = ?
+		GROUP BY d.id ORDER BY d.name`, now.UTC().Format(timeFormat), user)
+	if err != nil {
+		return nil, fmt.Errorf("querying deck scores: %w", err)
+	}
+	defer rows.Close()
+	var out []DeckScore
+	for rows.Next() {
+		var s DeckScore
+		if err := rows.Scan(&s.Deck, &s.Cards, &s.Seen, &s.Due, &s.Correct, &s.Attempts); err != nil {
+			return nil, fmt.Errorf("scanning deck score: %w", err)
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+func scanFlashcards(rows *sql.Rows) ([]Flashcard, error) {
+	defer rows.Close()
+	var out []Flashcard
+	for rows.Next() {
+		var c Flashcard
+		if err := rows.Scan(&c.ID, &c.DeckID, &c.Front, &c.Back); err != nil {
+			return nil, fmt.Errorf("scanning flashcard: %w", err)
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
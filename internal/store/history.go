@@ -0,0 +1,198 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Messages are not deleted or overwritten in place: deleting one sets its
+// deleted_at, leaving a tombstone, and editing one first copies what it
+// said into message_revisions, so MessagesAsOf can show a conversation as
+// it was at any time until the tombstones and revisions are purged.
+const revisionsSchema = `
+	CREATE TABLE IF NOT EXISTS message_revisions (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		message_id  INTEGER NOT NULL,
+		role        TEXT    NOT NULL,
+		content     TEXT    NOT NULL,
+		audio_ref   TEXT    NOT NULL DEFAULT '',
+		replaced_at TEXT    NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_message_revisions_message
+		ON message_revisions(message_id, replaced_at);
+	`
+
+// EditMessage replaces the content of a message, keeping what it said
+// before as a revision. It returns ErrNotFound if the message does not
+// exist or was deleted.
+func (d *DB) EditMessage(id int64, content string) (*Message, error) {
+	m, err := d.Message(id)
+	if err != nil {
+		return nil, err
+	}
+	stored, _, err := d.sealFor(m.ConversationID, content)
+	if err != nil {
+		return nil, fmt.Errorf("editing message: %w", err)
+	}
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := saveRevision(tx, id, time.Now()); err != nil {
+		return nil, err
+	}
+	res, err := tx.Exec("UPDATE messages SET content = ? WHERE id = ? AND deleted_at = ''", stored, id)
+	if err != nil {
+		return nil, fmt.Errorf("editing message: %w", err)
+	}
+	if err := checkAffected(res); err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	d.tails.invalidate(m.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	m.Content = content
+	return m, nil
+}
+
+// DeleteMessage marks a message deleted. It stays in the database as a
+// tombstone for history queries until PurgeTombstones removes it.
+func (d *DB) DeleteMessage(id int64) error {
+	m, err := d.Message(id)
+	if err != nil {
+		return err
+	}
+	res, err := d.exec("UPDATE messages SET deleted_at = ? WHERE id = ? AND deleted_at = ''",
+		time.Now().UTC().Format(timeFormat), id)
+	if err != nil {
+		return fmt.Errorf("deleting message: %w", err)
+	}
+	d.tails.invalidate(m.ConversationID)
+	return checkAffected(res)
+}
+
+// DeleteConversationMessages marks all messages of a conversation
+// deleted, as DeleteMessage does, so that it starts over. It returns how
+// many were deleted.
+func (d *DB) DeleteConversationMessages(conversationID string) (int64, error) {
+	res, err := d.exec("UPDATE messages SET deleted_at = ? WHERE conversation_id = ? AND deleted_at = ''",
+		time.Now().UTC().Format(timeFormat), conversationID)
+	d.tails.invalidate(conversationID)
+	if err != nil {
+		return 0, fmt.Errorf("deleting messages: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// saveRevision records what a message says before it is changed at t.
+func saveRevision(tx *sql.Tx, id int64, t time.Time) error {
+	_, err := tx.Exec(`INSERT INTO message_revisions (message_id, role, content, audio_ref, replaced_at)
+		SELECT id, role, content, audio_ref, ? FROM messages WHERE id = ?`, t.UTC().Format(timeFormat), id)
+	if err != nil {
+		return fmt.Errorf("saving revision: %w", err)
+	}
+	return nil
+}
+
+// MessagesAsOf returns the messages a conversation had at time t, as they
+// read then: messages deleted since are included, and edited or compacted
+// ones have their earlier content.
+func (d *DB) MessagesAsOf(conversationID string, t time.Time) ([]Message, error) {
+	at := t.UTC().Format(timeFormat)
+	// The first revision replaced after t holds what the message said at
+	// t; without one, it has not changed since.
+	return d.queryMessages(`
+		SELECT m.id, m.conversation_id,
+		       COALESCE(r.role, m.role), COALESCE(r.content, m.content), COALESCE(r.audio_ref, m.audio_ref),
+		       m.fallback, m.speaker, m.created_at
+		FROM messages m
+		LEFT JOIN message_revisions r ON r.id = (
+			SELECT id FROM message_revisions WHERE message_id = m.id AND replaced_at > ?
+			ORDER BY replaced_at, id LIMIT 1)
+		WHERE m.conversation_id = ? AND m.created_at <= ? AND (m.deleted_at = '' OR m.deleted_at > ?)
+		ORDER BY m.id`,
+		at, conversationID, at, at,
+	)
+}
+
+// MessageRevision is what a message said before it was edited or
+// replaced by a compaction summary.
+type MessageRevision struct {
+	Role       Role      `json:"role"`
+	Content    string    `json:"content"`
+	AudioRef   string    `json:"audio_ref,omitempty"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+// MessageRevisions returns the earlier versions of a message, oldest
+// first. It returns ErrNotFound if there is no such message, deleted or
+// not.
+func (d *DB) MessageRevisions(id int64) ([]MessageRevision, error) {
+	var conv string
+	err := d.queryRow("SELECT conversation_id FROM messages WHERE id = ?", id).Scan(&conv)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying message: %w", err)
+	}
+	rows, err := d.query("SELECT role, content, audio_ref, replaced_at FROM message_revisions WHERE message_id = ? ORDER BY replaced_at, id", id)
+	if err != nil {
+		return nil, fmt.Errorf("querying revisions: %w", err)
+	}
+	defer rows.Close()
+	out := []MessageRevision{}
+	for rows.Next() {
+		var rev MessageRevision
+		var replacedAt string
+		if err := rows.Scan(&rev.Role, &rev.Content, &rev.AudioRef, &replacedAt); err != nil {
+			return nil, fmt.Errorf("scanning revision: %w", err)
+		}
+		rev.Content = d.open(conv, rev.Content)
+		rev.ReplacedAt, _ = time.Parse(timeFormat, replacedAt)
+		out = append(out, rev)
+	}
+	return out, rows.Err()
+}
+
+// PurgeTombstones removes the messages deleted before the cutoff, with
+// their citations, feedback, transcripts and attachment references, and
+// the revisions replaced before it. History queries for times before the
+// cutoff are incomplete afterwards. It returns the number of messages
+// removed.
+func (d *DB) PurgeTombstones(before time.Time) (int, error) {
+	cutoff := before.UTC().Format(timeFormat)
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec("DELETE FROM messages WHERE deleted_at != '' AND deleted_at < ?", cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("purging messages: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	if _, err := tx.Exec("DELETE FROM message_revisions WHERE replaced_at < ?", cutoff); err != nil {
+		return 0, fmt.Errorf("purging revisions: %w", err)
+	}
+	if n > 0 {
+		for _, table := range messageRefs {
+			if table == "read_markers" {
+				// Markers are positions, which stay valid.
+				continue
+			}
+			if _, err := tx.Exec("DELETE FROM " + table + " WHERE message_id NOT IN (SELECT id FROM messages)"); err != nil {
+				return 0, fmt.Errorf("purging %s: %w", table, err)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
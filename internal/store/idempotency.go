@@ -0,0 +1,101 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const idempotencySchema = `
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		scope        TEXT NOT NULL,
+		key          TEXT NOT NULL,
+		request_hash TEXT NOT NULL,
+		status       INTEGER NOT NULL DEFAULT 0,
+		content_type TEXT NOT NULL DEFAULT '',
+		body         BLOB,
+		created_at   TEXT NOT NULL DEFAULT (datetime('now')),
+		expires_at   TEXT NOT NULL,
+		PRIMARY KEY (scope, key)
+	);
+	CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires ON idempotency_keys(expires_at);
+	`
+
+// IdempotencyKey is a client-chosen key for a request, remembered with
+// the response so that a retry gets the response again instead of
+// repeating the request. Status is 0 while the first request is still
+// being served.
+type IdempotencyKey struct {
+	Scope       string // who sent it and where, e.g. "alice POST /chat"
+	Key         string
+	RequestHash string // of the request body, so a key reused for another request can be refused
+	Status      int
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// ClaimIdempotencyKey records k as in progress and returns nil, or
+// returns the unexpired record already holding its scope and key. A
+// record still in progress from before abandonedBefore, left by a
+// request that never finished, counts as expired. Expired records are
+// removed.
+func (d *DB) ClaimIdempotencyKey(k *IdempotencyKey, abandonedBefore time.Time) (*IdempotencyKey, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+	if _, err := d.exec(
+		"DELETE FROM idempotency_keys WHERE expires_at <= ? OR (status = 0 AND created_at <= ?)",
+		now.Format(timeFormat), abandonedBefore.UTC().Format(timeFormat),
+	); err != nil {
+		return nil, fmt.Errorf("deleting idempotency keys: %w", err)
+	}
+	k.CreatedAt = now
+	res, err := d.exec(
+		"INSERT INTO idempotency_keys (scope, key, request_hash, created_at, expires_at) VALUES (?, ?, ?, ?, ?) ON CONFLICT DO NOTHING",
+		k.Scope, k.Key, k.RequestHash, k.CreatedAt.Format(timeFormat), k.ExpiresAt.UTC().Format(timeFormat),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("saving idempotency key: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 1 {
+		return nil, err
+	}
+	existing := IdempotencyKey{Scope: k.Scope, Key: k.Key}
+	var createdAt, expiresAt string
+	err = d.queryRow(
+		"SELECT request_hash, status, content_type, body, created_at, expires_at FROM idempotency_keys WHERE scope = ? AND key = ?",
+		k.Scope, k.Key,
+	).Scan(&existing.RequestHash, &existing.Status, &existing.ContentType, &existing.Body, &createdAt, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Released between the insert and now; the caller may retry.
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying idempotency key: %w", err)
+	}
+	existing.CreatedAt, _ = time.Parse(timeFormat, createdAt)
+	existing.ExpiresAt, _ = time.Parse(timeFormat, expiresAt)
+	return &existing, nil
+}
+
+// CompleteIdempotencyKey stores the response to a claimed key's request.
+func (d *DB) CompleteIdempotencyKey(scope, key string, status int, contentType string, body []byte) error {
+	res, err := d.exec(
+		"UPDATE idempotency_keys SET status = ?, content_type = ?, body = ? WHERE scope = ? AND key = ?",
+		status, contentType, body, scope, key,
+	)
+	if err != nil {
+		return fmt.Errorf("updating idempotency key: %w", err)
+	}
+	return checkAffected(res)
+}
+
+// ReleaseIdempotencyKey forgets a key, so that the next request with it
+// is served afresh.
+func (d *DB) ReleaseIdempotencyKey(scope, key string) error {
+	if _, err := d.exec("DELETE FROM idempotency_keys WHERE scope = ? AND key = ?", scope, key); err != nil {
+		return fmt.Errorf("deleting idempotency key: %w", err)
+	}
+	return nil
+}
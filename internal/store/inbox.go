@@ -0,0 +1,144 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+const readMarkersSchema = `
+	CREATE TABLE IF NOT EXISTS read_markers (
+		device          TEXT NOT NULL,
+		conversation_id TEXT NOT NULL,
+		message_id      INTEGER NOT NULL,
+		updated_at      TEXT NOT NULL DEFAULT (datetime('now')),
+		PRIMARY KEY (device, conversation_id)
+	);
+	`
+
+// previewChars bounds the preview of the latest unread message.
+const previewChars = 200
+
+// InboxEntry is a conversation with assistant messages a device has not
+// seen.
+type InboxEntry struct {
+	ConversationID string    `json:"conversation_id"`
+	Unread         int       `json:"unread"`
+	LastReadID     int64     `json:"last_read_id"` // 0 if the device has read nothing
+	LatestID       int64     `json:"latest_id"`
+	Preview        string    `json:"preview"` // the start of the latest unread message
+	LatestAt       time.Time `json:"latest_at"`
+}
+
+// MarkRead records that a device has seen a conversation up to and
+// including a message, or up to its latest message if messageID is 0.
+// Markers only move forward. It returns the message the device has now
+// read up to.
+func (d *DB) MarkRead(device, conversationID string, messageID int64) (int64, error) {
+	if messageID == 0 {
+		if err := d.queryRow("SELECT COALESCE(MAX(id), 0) FROM messages WHERE conversation_id = ? AND deleted_at = ''", conversationID).Scan(&messageID); err != nil {
+			return 0, fmt.Errorf("querying messages: %w", err)
+		}
+		if messageID == 0 {
+			return 0, ErrNotFound
+		}
+	} else {
+		var n int
+		if err := d.queryRow("SELECT COUNT(*) FROM messages WHERE conversation_id = ? AND id = ? AND deleted_at = ''", conversationID, messageID).Scan(&n); err != nil {
+			return 0, fmt.Errorf("querying messages: %w", err)
+		}
+		if n == 0 {
+			return 0, ErrNotFound
+		}
+	}
+	_, err := d.exec(
+		`INSERT INTO read_markers (device, conversation_id, message_id, updated_at) VALUES (?, ?, ?, datetime('now'))
+		 ON CONFLICT (device, conversation_id) DO UPDATE SET message_id = MAX(message_id, excluded.message_id), updated_at = excluded.updated_at`,
+		device, conversationID, messageID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("saving read marker: %w", err)
+	}
+	var read int64
+	err = d.queryRow("SELECT message_id FROM read_markers WHERE device = ? AND conversation_id = ?", device, conversationID).Scan(&read)
+	if err != nil {
+		return 0, fmt.Errorf("querying read marker: %w", err)
+	}
+	return read, nil
+}
+
+// MarkAllRead records that a device has seen every conversation up to its
+// latest message.
+func (d *DB) MarkAllRead(device string) error {
+	_, err := d.exec(
+		`INSERT INTO read_markers (device, conversation_id, message_id, updated_at)
+		 SELECT ?, conversation_id, MAX(id), datetime('now') FROM messages WHERE deleted_at = '' GROUP BY conversation_id
+		 ON CONFLICT (device, conversation_id) DO UPDATE SET message_id = MAX(message_id, excluded.message_id), updated_at = excluded.updated_at`,
+		device,
+	)
+	if err != nil {
+		return fmt.Errorf("saving read markers: %w", err)
+	}
+	return nil
+}
+
+// Inbox returns the conversations with assistant messages a device has not
+// seen, most recent first. Everything is unread for a device that has
+// marked nothing read. Encrypted conversations have no preview.
+func (d *DB) Inbox(device string) ([]InboxEntry, error) {
+	rows, err := d.query(`
+		SELECT u.conversation_id, u.unread, u.last_read, l.id, substr(l.content, 1, ?), l.created_at
+		FROM (
+			SELECT m.conversation_id, COUNT(*) AS unread, MAX(m.id) AS latest, COALESCE(r.message_id, 0) AS last_read
+			FROM messages m
+			LEFT JOIN read_markers r ON r.device = ? AND r.conversation_id = m.conversation_id
+			WHERE m.role = ? AND m.id > COALESCE(r.message_id, 0) AND m.deleted_at = ''
+			GROUP BY m.conversation_id
+		) u JOIN messages l ON l.id = u.latest
+		ORDER BY l.id DESC`,
+		previewChars, device, string(RoleAssistant),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying inbox: %w", err)
+	}
+	defer rows.Close()
+	var out []InboxEntry
+	for rows.Next() {
+		var e InboxEntry
+		var latestAt string
+		if err := rows.Scan(&e.ConversationID, &e.Unread, &e.LastReadID, &e.LatestID, &e.Preview, &latestAt); err != nil {
+			return nil, fmt.Errorf("scanning inbox entry: %w", err)
+		}
+		e.Preview = unsealed(e.Preview)
+		e.LatestAt, _ = time.Parse(timeFormat, latestAt)
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// UnreadCounts returns how many assistant messages each device that has
+// marked anything read has not seen yet, by device.
+func (d *DB) UnreadCounts() (map[string]int, error) {
+	rows, err := d.query(`
+		SELECT dev.device, (
+			SELECT COUNT(*) FROM messages m
+			LEFT JOIN read_markers r ON r.device = dev.device AND r.conversation_id = m.conversation_id
+			WHERE m.role = ? AND m.id > COALESCE(r.message_id, 0) AND m.deleted_at = ''
+		)
+		FROM (SELECT DISTINCT device FROM read_markers) dev`,
+		string(RoleAssistant),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying unread counts: %w", err)
+	}
+	defer rows.Close()
+	out := make(map[string]int)
+	for rows.Next() {
+		var device string
+		var n int
+		if err := rows.Scan(&device, &n); err != nil {
+			return nil, fmt.Errorf("scanning unread count: %w", err)
+		}
+		out[device] = n
+	}
+	return out, rows.Err()
+}
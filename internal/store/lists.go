@@ -0,0 +1,147 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const listsSchema = `
+	CREATE TABLE IF NOT EXISTS list_items (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		list       TEXT NOT NULL COLLATE NOCASE,
+		item       TEXT NOT NULL COLLATE NOCASE,
+		quantity   TEXT NOT NULL DEFAULT '',
+		remote_id  TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL DEFAULT (datetime('now')),
+		UNIQUE (list, item)
+	);
+	`
+
+// ListItem is an entry on a named list, such as the shopping list or the
+// pantry inventory.
+type ListItem struct {
+	ID       int64  `json:"id"`
+	List     string `json:"list"`
+	Item     string `json:"item"`
+	Quantity string `json:"quantity,omitempty"`
+	// RemoteID is the item's ID in the service the list is synchronized
+	// with, if any.
+	RemoteID  string    `json:"remote_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ListSummary is a list's name and size.
+type ListSummary struct {
+	Name  string `json:"name"`
+	Items int    `json:"items"`
+}
+
+const listItemColumns = "id, list, item, quantity, remote_id, created_at"
+
+// AddListItem adds an item to a list and sets its ID. If the list
+// already has it, its quantity is updated when one is given, it is
+// filled in from the stored item, and added reports false.
+func (d *DB) AddListItem(it *ListItem) (added bool, err error) {
+	existing, err := d.ListItem(it.List, it.Item)
+	switch {
+	case err == nil:
+		if it.Quantity != "" && it.Quantity != existing.Quantity {
+			if _, err := d.exec("UPDATE list_items SET quantity = ? WHERE id = ?", it.Quantity, existing.ID); err != nil {
+				return false, fmt.Errorf("updating list item: %w", err)
+			}
+			existing.Quantity = it.Quantity
+		}
+		*it = *existing
+		return false, nil
+	case !errors.Is(err, ErrNotFound):
+		return false, err
+	}
+	it.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	res, err := d.exec(
+		"INSERT INTO list_items (list, item, quantity, remote_id, created_at) VALUES (?, ?, ?, ?, ?)",
+		it.List, it.Item, it.Quantity, it.RemoteID, it.CreatedAt.Format(timeFormat),
+	)
+	if err != nil {
+		return false, fmt.Errorf("adding list item: %w", err)
+	}
+	it.ID, _ = res.LastInsertId()
+	return true, nil
+}
+
+// ListItem returns an item on a list.
+func (d *DB) ListItem(list, item string) (*ListItem, error) {
+	rows, err := d.query("SELECT "+listItemColumns+" FROM list_items WHERE list = ? AND item = ?", list, item)
+	if err != nil {
+		return nil, fmt.Errorf("querying list item: %w", err)
+	}
+	items, err := scanListItems(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, ErrNotFound
+	}
+	return &items[0], nil
+}
+
+// ListItems returns the items on a list, oldest first.
+func (d *DB) ListItems(list string) ([]ListItem, error) {
+	rows, err := d.query("SELECT "+listItemColumns+" FROM list_items WHERE list = ? ORDER BY id", list)
+	if err != nil {
+		return nil, fmt.Errorf("querying list items: %w", err)
+	}
+	return scanListItems(rows)
+}
+
+// Lists returns every list with items, by name.
+func (d *DB) Lists() ([]ListSummary, error) {
+	rows, err := d.query("SELECT list, COUNT(*) FROM list_items GROUP BY list ORDER BY list")
+	if err != nil {
+		return nil, fmt.Errorf("querying lists: %w", err)
+	}
+	defer rows.Close()
+	var out []ListSummary
+	for rows.Next() {
+		var s ListSummary
+		if err := rows.Scan(&s.Name, &s.Items); err != nil {
+			return nil, fmt.Errorf("scanning list: %w", err)
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// SetListItemRemote records an item's ID in the synchronized service.
+func (d *DB) SetListItemRemote(id int64, remoteID string) error {
+	res, err := d.exec("UPDATE list_items SET remote_id = ? WHERE id = ?", remoteID, id)
+	if err != nil {
+		return fmt.Errorf("updating list item: %w", err)
+	}
+	return checkAffected(res)
+}
+
+// DeleteListItem removes an item from a list.
+func (d *DB) DeleteListItem(id int64) error {
+	res, err := d.exec("DELETE FROM list_items WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("deleting list item: %w", err)
+	}
+	return checkAffected(res)
+}
+
+func scanListItems(rows *sql.Rows) ([]ListItem, error) {
+	defer rows.Close()
+	var out []ListItem
+	for rows.Next() {
+		var it ListItem
+		var createdAt string
+		if err := rows.Scan(&it.ID, &it.List, &it.Item, &it.Quantity, &it.RemoteID, &createdAt); err != nil {
+			return nil, fmt.Errorf("scanning list item: %w", err)
+		}
+		it.CreatedAt, _ = time.Parse(timeFormat, createdAt)
+		out = append(out, it)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,152 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Conversation summarizes a stored conversation.
+type Conversation struct {
+	ID            string    `json:"id"`
+	Messages      int       `json:"messages"`
+	FirstAt       time.Time `json:"first_at"`
+	LastMessageAt time.Time `json:"last_message_at"`
+	Private       bool      `json:"private,omitempty"`   // see SetPrivate
+	Encrypted     bool      `json:"encrypted,omitempty"` // see EncryptConversation
+}
+
+// Conversations lists all conversations, most recently active first.
+func (d *DB) Conversations() ([]Conversation, error) {
+	rows, err := d.query(`
+		SELECT m.conversation_id, COUNT(*), MIN(m.created_at), MAX(m.created_at), p.conversation_id IS NOT NULL, e.conversation_id IS NOT NULL
+		FROM messages m
+		LEFT JOIN private_conversations p ON p.conversation_id = m.conversation_id
+		LEFT JOIN encrypted_conversations e ON e.conversation_id = m.conversation_id
+		WHERE m.deleted_at = ''
+		GROUP BY m.conversation_id ORDER BY MAX(m.id) DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("querying conversations: %w", err)
+	}
+	defer rows.Close()
+
+	var convs []Conversation
+	for rows.Next() {
+		var c Conversation
+		var first, last string
+		if err := rows.Scan(&c.ID, &c.Messages, &first, &last, &c.Private, &c.Encrypted); err != nil {
+			return nil, fmt.Errorf("scanning conversation: %w", err)
+		}
+		c.FirstAt, _ = time.Parse(timeFormat, first)
+		c.LastMessageAt, _ = time.Parse(timeFormat, last)
+		convs = append(convs, c)
+	}
+	return convs, rows.Err()
+}
+
+// ReplaceMessages replaces the messages of a conversation up to and
+// including messageID with a single summary message, which takes the place
+// of the last replaced message so history order is preserved. The others
+// are left as tombstones and the last one's content as a revision, so
+// MessagesAsOf still shows what was said before compaction.
+func (d *DB) ReplaceMessages(conversationID string, messageID int64, summary string) (int, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	summary, _, err = d.sealFor(conversationID, summary)
+	if err != nil {
+		return 0, fmt.Errorf("storing summary: %w", err)
+	}
+	now := time.Now()
+	res, err := tx.Exec(`UPDATE messages SET deleted_at = ? WHERE conversation_id = ? AND id < ? AND deleted_at = ''
+		AND id NOT IN (SELECT message_id FROM pinned_messages)`,
+		now.UTC().Format(timeFormat), conversationID, messageID)
+	if err != nil {
+		return 0, fmt.Errorf("deleting messages: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	if err := saveRevision(tx, messageID, now); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM transcripts WHERE message_id = ?", messageID); err != nil {
+		return 0, fmt.Errorf("deleting transcripts: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM message_attachments WHERE message_id = ?", messageID); err != nil {
+		return 0, fmt.Errorf("deleting attachment references: %w", err)
+	}
+	res, err = tx.Exec(
+		"UPDATE messages SET role = ?, content = ?, audio_ref = '' WHERE conversation_id = ? AND id = ? AND deleted_at = ''",
+		string(RoleSystem), summary, conversationID, messageID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("storing summary: %w", err)
+	}
+	if err := checkAffected(res); err != nil {
+		return 0, err
+	}
+	err = tx.Commit()
+	d.tails.invalidate(conversationID)
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+// Size returns the database size in bytes.
+func (d *DB) Size() (int64, error) {
+	var pages, pageSize int64
+	if err := d.queryRow("PRAGMA page_count").Scan(&pages); err != nil {
+		return 0, err
+	}
+	if err := d.queryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, err
+	}
+	return pages * pageSize, nil
+}
+
+// Optimize merges the full-text index segments and reclaims free space
+// with VACUUM.
+func (d *DB) Optimize() error {
+	if _, err := d.exec("INSERT INTO chunks_fts(chunks_fts) VALUES('optimize')"); err != nil {
+		return fmt.Errorf("optimizing index: %w", err)
+	}
+	if _, err := d.exec("VACUUM"); err != nil {
+		return fmt.Errorf("vacuuming database: %w", err)
+	}
+	// Fold the WAL back into the main file so the reclaimed space shows.
+	var busy, logPages, checkpointed int
+	err := d.queryRow("PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &logPages, &checkpointed)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("checkpointing database: %w", err)
+	}
+	return nil
+}
+
+// IntegrityCheck runs PRAGMA integrity_check, or the faster quick_check,
+// and returns the problems found; none means the database is sound.
+func (d *DB) IntegrityCheck(quick bool) ([]string, error) {
+	pragma := "PRAGMA integrity_check"
+	if quick {
+		pragma = "PRAGMA quick_check"
+	}
+	rows, err := d.query(pragma)
+	if err != nil {
+		return nil, fmt.Errorf("checking integrity: %w", err)
+	}
+	defer rows.Close()
+	var problems []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, fmt.Errorf("checking integrity: %w", err)
+		}
+		if s != "ok" {
+			problems = append(problems, s)
+		}
+	}
+	return problems, rows.Err()
+}
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const memoriesSchema = `
+	CREATE TABLE IF NOT EXISTS memories (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		user       TEXT NOT NULL DEFAULT '',
+		content    TEXT NOT NULL,
+		created_at TEXT NOT NULL DEFAULT (datetime('now'))
+	);
+	CREATE INDEX IF NOT EXISTS idx_memories_user ON memories(user);
+	`
+
+// Memory is something a user asked the agent to remember, e.g. with
+// /remember. Memories without a user belong to the whole household.
+type Memory struct {
+	ID        int64     `json:"id"`
+	User      string    `json:"user,omitempty"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AddMemory saves a memory and sets its ID.
+func (d *DB) AddMemory(m *Memory) error {
+	res, err := d.exec("INSERT INTO memories (user, content, created_at) VALUES (?, ?, ?)",
+		m.User, m.Content, time.Now().UTC().Format(timeFormat))
+	if err != nil {
+		return fmt.Errorf("saving memory: %w", err)
+	}
+	m.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// Memories returns a user's memories and the household's, oldest first.
+func (d *DB) Memories(user string) ([]Memory, error) {
+	rows, err := d.query("SELECT id, user, content, created_at FROM memories WHERE user = ? OR user = '' ORDER BY id", user)
+	if err != nil {
+		return nil, fmt.Errorf("querying memories: %w", err)
+	}
+	defer rows.Close()
+	var out []Memory
+	for rows.Next() {
+		var m Memory
+		var createdAt string
+		if err := rows.Scan(&m.ID, &m.User, &m.Content, &createdAt); err != nil {
+			return nil, fmt.Errorf("scanning memory: %w", err)
+		}
+		m.CreatedAt, _ = time.Parse(timeFormat, createdAt)
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// ForgetMemories deletes the memories of a user, and the household's,
+// that contain text, ignoring case. It returns how many were deleted.
+func (d *DB) ForgetMemories(user, text string) (int64, error) {
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(text) + "%"
+	res, err := d.exec(`DELETE FROM memories WHERE (user = ? OR user = '') AND content LIKE ? ESCAPE '\'`, user, pattern)
+	if err != nil {
+		return 0, fmt.Errorf("deleting memories: %w", err)
+	}
+	return res.RowsAffected()
+}
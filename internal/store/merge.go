@@ -0,0 +1,151 @@
+package store
+
+import (
+	"fmt"
+	"slices"
+)
+
+const originsSchema = `
+	CREATE TABLE IF NOT EXISTS message_origins (
+		message_id      INTEGER PRIMARY KEY,
+		conversation_id TEXT NOT NULL
+	);
+	`
+
+// messageRefs are the tables holding message IDs, which are renumbered
+// with the messages when a merge has to reorder them.
+var messageRefs = []string{"message_citations", "message_feedback", "transcripts", "message_attachments", "message_origins", "message_revisions", "read_markers", "pinned_messages"}
+
+// Merge describes a merge of two conversations.
+type Merge struct {
+	ConversationID string `json:"conversation_id"`
+	From           string `json:"from"`
+	Moved          int    `json:"moved"`    // messages taken from From
+	Messages       int    `json:"messages"` // messages in the merged conversation
+	Renumbered     bool   `json:"renumbered"`
+}
+
+// MergeConversations moves the messages of conversation from into
+// conversation into, interleaved by when they were sent, and records the
+// conversation each message came from; see MessageOrigins. Messages are
+// ordered by ID, so if the timestamps disagree with it, e.g. after an
+// import, the merged messages get new IDs along with their citations,
+// feedback, transcripts, attachments, revisions, read markers and pins.
+// If from was private, the merged conversation is too. It returns
+// ErrNotFound if from has no messages, and ErrEncrypted if either
+// conversation is encrypted, as sealed messages are bound to theirs.
+func (d *DB) MergeConversations(into, from string) (*Merge, error) {
+	for _, id := range []string{into, from} {
+		if encrypted, err := d.Encrypted(id); err != nil {
+			return nil, err
+		} else if encrypted {
+			return nil, fmt.Errorf("merging %s: %w", id, ErrEncrypted)
+		}
+	}
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT id, conversation_id FROM messages WHERE conversation_id IN (?, ?)
+		ORDER BY created_at, id`, into, from)
+	if err != nil {
+		return nil, fmt.Errorf("querying messages: %w", err)
+	}
+	var ids []int64
+	m := &Merge{ConversationID: into, From: from}
+	for rows.Next() {
+		var id int64
+		var conv string
+		if err := rows.Scan(&id, &conv); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scanning message: %w", err)
+		}
+		ids = append(ids, id)
+		if conv == from {
+			m.Moved++
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if m.Moved == 0 {
+		return nil, ErrNotFound
+	}
+	m.Messages = len(ids)
+
+	// Messages merged before keep their first origin.
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO message_origins (message_id, conversation_id)
+		SELECT id, conversation_id FROM messages WHERE conversation_id IN (?, ?)`, into, from); err != nil {
+		return nil, fmt.Errorf("recording origins: %w", err)
+	}
+
+	if slices.IsSorted(ids) {
+		if _, err := tx.Exec("UPDATE messages SET conversation_id = ? WHERE conversation_id = ?", into, from); err != nil {
+			return nil, fmt.Errorf("moving messages: %w", err)
+		}
+	} else {
+		// New IDs are above every existing one, so they never collide
+		// with IDs still to be renumbered.
+		m.Renumbered = true
+		for _, old := range ids {
+			res, err := tx.Exec(`INSERT INTO messages (conversation_id, role, content, audio_ref, fallback, speaker, created_at, deleted_at)
+				SELECT ?, role, content, audio_ref, fallback, speaker, created_at, deleted_at FROM messages WHERE id = ?`, into, old)
+			if err != nil {
+				return nil, fmt.Errorf("copying message: %w", err)
+			}
+			id, _ := res.LastInsertId()
+			for _, table := range messageRefs {
+				if _, err := tx.Exec("UPDATE "+table+" SET message_id = ? WHERE message_id = ?", id, old); err != nil {
+					return nil, fmt.Errorf("renumbering %s: %w", table, err)
+				}
+			}
+			if _, err := tx.Exec("DELETE FROM messages WHERE id = ?", old); err != nil {
+				return nil, fmt.Errorf("deleting message: %w", err)
+			}
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE pinned_messages SET conversation_id = ? WHERE conversation_id = ?", into, from); err != nil {
+		return nil, fmt.Errorf("moving pins: %w", err)
+	}
+	// Devices' places in the old conversation no longer apply.
+	if _, err := tx.Exec("DELETE FROM read_markers WHERE conversation_id = ?", from); err != nil {
+		return nil, fmt.Errorf("deleting read markers: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO private_conversations (conversation_id, created_at)
+		SELECT ?, created_at FROM private_conversations WHERE conversation_id = ?`, into, from); err != nil {
+		return nil, fmt.Errorf("saving privacy mode: %w", err)
+	}
+	err = tx.Commit()
+	d.tails.invalidate(into)
+	d.tails.invalidate(from)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// MessageOrigins returns, for the messages of a conversation that were
+// merged into it, the conversation each was first sent in.
+func (d *DB) MessageOrigins(conversationID string) (map[int64]string, error) {
+	rows, err := d.query(`SELECT o.message_id, o.conversation_id FROM message_origins o
+		JOIN messages m ON m.id = o.message_id
+		WHERE m.conversation_id = ? AND o.conversation_id != m.conversation_id`, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("querying message origins: %w", err)
+	}
+	defer rows.Close()
+	out := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var origin string
+		if err := rows.Scan(&id, &origin); err != nil {
+			return nil, fmt.Errorf("scanning message origin: %w", err)
+		}
+		out[id] = origin
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const mqttSchema = `
+	CREATE TABLE IF NOT EXISTS mqtt_outputs (
+		conversation_id TEXT PRIMARY KEY,
+		topic           TEXT NOT NULL,
+		replies         INTEGER NOT NULL DEFAULT 1,
+		deltas          INTEGER NOT NULL DEFAULT 0,
+		retain          INTEGER NOT NULL DEFAULT 1,
+		created_at      TEXT NOT NULL DEFAULT (datetime('now'))
+	);
+	`
+
+// MQTTOutput binds a conversation to an MQTT topic its assistant replies
+// are mirrored to.
+type MQTTOutput struct {
+	ConversationID string    `json:"conversation_id"`
+	Topic          string    `json:"topic"`
+	Replies        bool      `json:"replies"` // publish each complete reply to Topic
+	Deltas         bool      `json:"deltas"`  // publish reply fragments to Topic/delta, and progress to Topic/progress, as they stream
+	Retain         bool      `json:"retain"`  // retain the last reply for subscribers that connect later
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// SetMQTTOutput binds a conversation to a topic, replacing any earlier
+// binding.
+func (d *DB) SetMQTTOutput(o *MQTTOutput) error {
+	_, err := d.exec(
+		`INSERT INTO mqtt_outputs (conversation_id, topic, replies, deltas, retain) VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT (conversation_id) DO UPDATE SET topic = excluded.topic, replies = excluded.replies,
+		 deltas = excluded.deltas, retain = excluded.retain`,
+		o.ConversationID, o.Topic, o.Replies, o.Deltas, o.Retain,
+	)
+	if err != nil {
+		return fmt.Errorf("saving MQTT output: %w", err)
+	}
+	return nil
+}
+
+// MQTTOutput returns the topic a conversation is bound to.
+func (d *DB) MQTTOutput(conversationID string) (*MQTTOutput, error) {
+	var o MQTTOutput
+	var createdAt string
+	err := d.queryRow(
+		"SELECT conversation_id, topic, replies, deltas, retain, created_at FROM mqtt_outputs WHERE conversation_id = ?", conversationID,
+	).Scan(&o.ConversationID, &o.Topic, &o.Replies, &o.Deltas, &o.Retain, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying MQTT output: %w", err)
+	}
+	o.CreatedAt, _ = time.Parse(timeFormat, createdAt)
+	return &o, nil
+}
+
+// MQTTOutputs returns every conversation's MQTT binding.
+func (d *DB) MQTTOutputs() ([]MQTTOutput, error) {
+	rows, err := d.query("SELECT conversation_id, topic, replies, deltas, retain, created_at FROM mqtt_outputs ORDER BY conversation_id")
+	if err != nil {
+		return nil, fmt.Errorf("querying MQTT outputs: %w", err)
+	}
+	defer rows.Close()
+	var out []MQTTOutput
+	for rows.Next() {
+		var o MQTTOutput
+		var createdAt string
+		if err := rows.Scan(&o.ConversationID, &o.Topic, &o.Replies, &o.Deltas, &o.Retain, &createdAt); err != nil {
+			return nil, fmt.Errorf("scanning MQTT output: %w", err)
+		}
+		o.CreatedAt, _ = time.Parse(timeFormat, createdAt)
+		out = append(out, o)
+	}
+	return out, rows.Err()
+}
+
+// DeleteMQTTOutput unbinds a conversation from its topic.
+func (d *DB) DeleteMQTTOutput(conversationID string) error {
+	res, err := d.exec("DELETE FROM mqtt_outputs WHERE conversation_id = ?", conversationID)
+	if err != nil {
+		return fmt.Errorf("deleting MQTT output: %w", err)
+	}
+	return checkAffected(res)
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+const notificationsSchema = `
+	CREATE TABLE IF NOT EXISTS notifications (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		user       TEXT NOT NULL DEFAULT '',
+		title      TEXT NOT NULL,
+		body       TEXT NOT NULL,
+		priority   INTEGER NOT NULL DEFAULT 0,
+		created_at TEXT NOT NULL DEFAULT (datetime('now'))
+	);
+	CREATE INDEX IF NOT EXISTS idx_notifications_created ON notifications(created_at);
+	`
+
+// Notification is a notification that was sent, kept for the daily
+// briefing.
+type Notification struct {
+	ID        int64     `json:"id"`
+	User      string    `json:"user,omitempty"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	Priority  int       `json:"priority,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AddNotification records a notification.
+func (d *DB) AddNotification(n *Notification) error {
+	res, err := d.exec(
+		"INSERT INTO notifications (user, title, body, priority) VALUES (?, ?, ?, ?)",
+		n.User, n.Title, n.Body, n.Priority,
+	)
+	if err != nil {
+		return fmt.Errorf("saving notification: %w", err)
+	}
+	n.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// NotificationsSince returns the notifications recorded after since for a
+// user, including those not tied to a user, oldest first.
+func (d *DB) NotificationsSince(user string, since time.Time) ([]Notification, error) {
+	rows, err := d.query(
+		`SELECT id, user, title, body, priority, created_at FROM notifications
+		 WHERE created_at > ? AND (user = '' OR user = ? COLLATE NOCASE) ORDER BY id`,
+		since.UTC().Format(timeFormat), user,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying notifications: %w", err)
+	}
+	defer rows.Close()
+	var out []Notification
+	for rows.Next() {
+		var n Notification
+		var createdAt string
+		if err := rows.Scan(&n.ID, &n.User, &n.Title, &n.Body, &n.Priority, &createdAt); err != nil {
+			return nil, fmt.Errorf("scanning notification: %w", err)
+		}
+		n.CreatedAt, _ = time.Parse(timeFormat, createdAt)
+		out = append(out, n)
+	}
+	return out, rows.Err()
+}
+
+// DeleteNotificationsBefore removes notifications recorded before t.
+func (d *DB) DeleteNotificationsBefore(t time.Time) (int64, error) {
+	res, err := d.exec("DELETE FROM notifications WHERE created_at < ?", t.UTC().Format(timeFormat))
+	if err != nil {
+		return 0, fmt.Errorf("deleting notifications: %w", err)
+	}
+	return res.RowsAffected()
+}
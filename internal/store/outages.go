@@ -0,0 +1,97 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+const outagesSchema = `
+	CREATE TABLE IF NOT EXISTS power_outages (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		started_at   TEXT    NOT NULL,
+		ended_at     TEXT    NOT NULL DEFAULT '',
+		start_charge REAL    NOT NULL DEFAULT -1,
+		end_charge   REAL    NOT NULL DEFAULT -1,
+		min_charge   REAL    NOT NULL DEFAULT -1,
+		skipped      INTEGER NOT NULL DEFAULT 0
+	);
+	`
+
+// Outage is a period the agent ran on battery. Charges are percentages,
+// -1 if the UPS does not report them.
+type Outage struct {
+	ID          int64     `json:"id"`
+	StartedAt   time.Time `json:"started_at"`
+	EndedAt     time.Time `json:"ended_at,omitzero"` // zero while it lasts
+	StartCharge float64   `json:"start_charge"`
+	EndCharge   float64   `json:"end_charge"`
+	MinCharge   float64   `json:"min_charge"`
+	Skipped     int       `json:"skipped"` // scheduled jobs skipped to save power
+}
+
+// StartOutage records the start of an outage and sets its ID.
+func (d *DB) StartOutage(o *Outage) error {
+	res, err := d.exec("INSERT INTO power_outages (started_at, start_charge, end_charge, min_charge) VALUES (?, ?, ?, ?)",
+		o.StartedAt.UTC().Format(timeFormat), o.StartCharge, o.StartCharge, o.StartCharge)
+	if err != nil {
+		return fmt.Errorf("saving outage: %w", err)
+	}
+	o.ID, _ = res.LastInsertId()
+	o.EndCharge, o.MinCharge = o.StartCharge, o.StartCharge
+	return nil
+}
+
+// UpdateOutage saves the charge, lowest charge, skipped jobs and, once
+// set, the end of an outage.
+func (d *DB) UpdateOutage(o *Outage) error {
+	var ended string
+	if !o.EndedAt.IsZero() {
+		ended = o.EndedAt.UTC().Format(timeFormat)
+	}
+	res, err := d.exec("UPDATE power_outages SET ended_at = ?, end_charge = ?, min_charge = ?, skipped = ? WHERE id = ?",
+		ended, o.EndCharge, o.MinCharge, o.Skipped, o.ID)
+	if err != nil {
+		return fmt.Errorf("saving outage: %w", err)
+	}
+	return checkAffected(res)
+}
+
+// OpenOutage returns the outage still in progress, e.g. when the agent
+// restarted on battery, or ErrNotFound.
+func (d *DB) OpenOutage() (*Outage, error) {
+	outs, err := d.queryOutages("SELECT " + outageColumns + " FROM power_outages WHERE ended_at = '' ORDER BY id DESC LIMIT 1")
+	if err != nil {
+		return nil, err
+	}
+	if len(outs) == 0 {
+		return nil, ErrNotFound
+	}
+	return &outs[0], nil
+}
+
+// Outages returns the most recent outages, newest first.
+func (d *DB) Outages(limit int) ([]Outage, error) {
+	return d.queryOutages("SELECT "+outageColumns+" FROM power_outages ORDER BY id DESC LIMIT ?", limit)
+}
+
+const outageColumns = "id, started_at, ended_at, start_charge, end_charge, min_charge, skipped"
+
+func (d *DB) queryOutages(query string, args ...any) ([]Outage, error) {
+	rows, err := d.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying outages: %w", err)
+	}
+	defer rows.Close()
+	var out []Outage
+	for rows.Next() {
+		var o Outage
+		var started, ended string
+		if err := rows.Scan(&o.ID, &started, &ended, &o.StartCharge, &o.EndCharge, &o.MinCharge, &o.Skipped); err != nil {
+			return nil, fmt.Errorf("scanning outage: %w", err)
+		}
+		o.StartedAt, _ = time.Parse(timeFormat, started)
+		o.EndedAt, _ = time.Parse(timeFormat, ended)
+		out = append(out, o)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const patchesSchema = `
+	CREATE TABLE IF NOT EXISTS patches (
+		id             INTEGER PRIMARY KEY AUTOINCREMENT,
+		approval_id    INTEGER NOT NULL DEFAULT 0,
+		dir            TEXT    NOT NULL,
+		diff           TEXT    NOT NULL,
+		summary        TEXT    NOT NULL DEFAULT '',
+		applied_at     TEXT    NOT NULL DEFAULT (datetime('now')),
+		rolled_back_at TEXT
+	);
+	CREATE TABLE IF NOT EXISTS patch_files (
+		patch_id   INTEGER NOT NULL REFERENCES patches(id) ON DELETE CASCADE,
+		path       TEXT    NOT NULL,
+		existed    INTEGER NOT NULL,
+		mode       INTEGER NOT NULL DEFAULT 0,
+		content    BLOB,
+		after_hash TEXT    NOT NULL DEFAULT '',
+		PRIMARY KEY (patch_id, path)
+	);
+	`
+
+// Patch is a diff applied to files on the Pi, kept with the pre-image of
+// every file it touched so that it can be rolled back.
+type Patch struct {
+	ID           int64       `json:"id"`
+	ApprovalID   int64       `json:"approval_id,omitempty"`
+	Dir          string      `json:"dir"`
+	Diff         string      `json:"diff"`
+	Summary      string      `json:"summary"`
+	AppliedAt    time.Time   `json:"applied_at"`
+	RolledBackAt *time.Time  `json:"rolled_back_at,omitempty"`
+	Files        []PatchFile `json:"files,omitempty"`
+}
+
+// PatchFile is the pre-image of a file a patch touched, relative to the
+// patch's directory. AfterHash is the SHA-256 of the file as the patch
+// left it, or empty if the patch deleted it.
+type PatchFile struct {
+	Path      string `json:"path"`
+	Existed   bool   `json:"existed"`
+	Mode      uint32 `json:"mode,omitempty"`
+	Content   []byte `json:"-"`
+	AfterHash string `json:"after_hash,omitempty"`
+}
+
+// AddPatch records an applied patch with its files and sets its ID.
+func (d *DB) AddPatch(p *Patch) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec("INSERT INTO patches (approval_id, dir, diff, summary) VALUES (?, ?, ?, ?)",
+		p.ApprovalID, p.Dir, p.Diff, p.Summary)
+	if err != nil {
+		return fmt.Errorf("inserting patch: %w", err)
+	}
+	id, _ := res.LastInsertId()
+	for _, f := range p.Files {
+		if _, err := tx.Exec(
+			"INSERT INTO patch_files (patch_id, path, existed, mode, content, after_hash) VALUES (?, ?, ?, ?, ?, ?)",
+			id, f.Path, f.Existed, f.Mode, f.Content, f.AfterHash,
+		); err != nil {
+			return fmt.Errorf("inserting patch file: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	p.ID = id
+	return nil
+}
+
+// MarkPatchRolledBack records that a patch was rolled back.
+func (d *DB) MarkPatchRolledBack(id int64) error {
+	res, err := d.exec("UPDATE patches SET rolled_back_at = datetime('now') WHERE id = ? AND rolled_back_at IS NULL", id)
+	if err != nil {
+		return fmt.Errorf("updating patch: %w", err)
+	}
+	return checkAffected(res)
+}
+
+// Patch returns a patch with its files' pre-images.
+func (d *DB) Patch(id int64) (*Patch, error) {
+	list, err := d.queryPatches("SELECT id, approval_id, dir, diff, summary, applied_at, rolled_back_at FROM patches WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, ErrNotFound
+	}
+	p := &list[0]
+	rows, err := d.query("SELECT path, existed, mode, content, after_hash FROM patch_files WHERE patch_id = ? ORDER BY path", id)
+	if err != nil {
+		return nil, fmt.Errorf("querying patch files: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var f PatchFile
+		if err := rows.Scan(&f.Path, &f.Existed, &f.Mode, &f.Content, &f.AfterHash); err != nil {
+			return nil, fmt.Errorf("scanning patch file: %w", err)
+		}
+		p.Files = append(p.Files, f)
+	}
+	return p, rows.Err()
+}
+
+// Patches returns applied patches, newest first, without their files.
+func (d *DB) Patches() ([]Patch, error) {
+	return d.queryPatches("SELECT id, approval_id, dir, diff, summary, applied_at, rolled_back_at FROM patches ORDER BY id DESC")
+}
+
+func (d *DB) queryPatches(query string, args ...any) ([]Patch, error) {
+	rows, err := d.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying patches: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Patch
+	for rows.Next() {
+		var p Patch
+		var appliedAt string
+		var rolledBackAt sql.NullString
+		if err := rows.Scan(&p.ID, &p.ApprovalID, &p.Dir, &p.Diff, &p.Summary, &appliedAt, &rolledBackAt); err != nil {
+			return nil, fmt.Errorf("scanning patch: %w", err)
+		}
+		p.AppliedAt, _ = time.Parse(timeFormat, appliedAt)
+		if rolledBackAt.Valid {
+			t, _ := time.Parse(timeFormat, rolledBackAt.String)
+			p.RolledBackAt = &t
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
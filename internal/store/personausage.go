@@ -0,0 +1,82 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const personaUsageSchema = `
+	CREATE TABLE IF NOT EXISTS persona_usage (
+		persona  TEXT NOT NULL,
+		day      TEXT NOT NULL,
+		messages INTEGER NOT NULL DEFAULT 0,
+		tokens   INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (persona, day)
+	);
+	`
+
+// PersonaUsage is how much a persona was used on a day, counted for its
+// daily caps.
+type PersonaUsage struct {
+	Persona  string `json:"persona"`
+	Day      string `json:"day"` // YYYY-MM-DD in local time
+	Messages int    `json:"messages"`
+	Tokens   int    `json:"tokens"`
+}
+
+// AddPersonaUsage adds messages and tokens to a persona's usage on a day.
+func (d *DB) AddPersonaUsage(persona, day string, messages, tokens int) error {
+	_, err := d.exec(
+		`INSERT INTO persona_usage (persona, day, messages, tokens) VALUES (?, ?, ?, ?)
+		 ON CONFLICT (persona, day) DO UPDATE SET messages = messages + excluded.messages, tokens = tokens + excluded.tokens`,
+		persona, day, messages, tokens,
+	)
+	if err != nil {
+		return fmt.Errorf("saving persona usage: %w", err)
+	}
+	return nil
+}
+
+// PersonaUsage returns a persona's usage on a day, which is zero if it was
+// not used.
+func (d *DB) PersonaUsage(persona, day string) (PersonaUsage, error) {
+	u := PersonaUsage{Persona: persona, Day: day}
+	err := d.queryRow(
+		"SELECT messages, tokens FROM persona_usage WHERE persona = ? AND day = ?", persona, day,
+	).Scan(&u.Messages, &u.Tokens)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return u, fmt.Errorf("querying persona usage: %w", err)
+	}
+	return u, nil
+}
+
+// PersonaUsageSince returns every persona's usage on the days from since,
+// YYYY-MM-DD, on, or on all days if it is empty; oldest first.
+func (d *DB) PersonaUsageSince(since string) ([]PersonaUsage, error) {
+	rows, err := d.query(
+		"SELECT persona, day, messages, tokens FROM persona_usage WHERE day >= ? ORDER BY day, persona", since,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying persona usage: %w", err)
+	}
+	defer rows.Close()
+	var out []PersonaUsage
+	for rows.Next() {
+		var u PersonaUsage
+		if err := rows.Scan(&u.Persona, &u.Day, &u.Messages, &u.Tokens); err != nil {
+			return nil, fmt.Errorf("scanning persona usage: %w", err)
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+// PersonaUsageCSV is the header of PersonaUsage.CSV rows.
+var PersonaUsageCSV = strings.Split("day,persona,messages,tokens", ",")
+
+// CSV returns the usage as a row of values matching PersonaUsageCSV.
+func (u PersonaUsage) CSV() []string {
+	return []string{u.Day, u.Persona, fmt.Sprint(u.Messages), fmt.Sprint(u.Tokens)}
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+const pinsSchema = `
+	CREATE TABLE IF NOT EXISTS pinned_messages (
+		message_id      INTEGER PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+		conversation_id TEXT NOT NULL,
+		pinned_at       TEXT NOT NULL DEFAULT (datetime('now'))
+	);
+	CREATE INDEX IF NOT EXISTS idx_pinned_conversation ON pinned_messages(conversation_id);
+	`
+
+// PinMessage pins a message so that it is always sent with its
+// conversation's history, however long the conversation grows, and is
+// kept when the conversation is compacted. Pinning it again does nothing.
+func (d *DB) PinMessage(id int64) (*Message, error) {
+	m, err := d.Message(id)
+	if err != nil {
+		return nil, err
+	}
+	_, err = d.exec("INSERT OR IGNORE INTO pinned_messages (message_id, conversation_id, pinned_at) VALUES (?, ?, ?)",
+		m.ID, m.ConversationID, time.Now().UTC().Format(timeFormat))
+	if err != nil {
+		return nil, fmt.Errorf("pinning message: %w", err)
+	}
+	return m, nil
+}
+
+// UnpinMessage unpins a message, or returns ErrNotFound if it was not
+// pinned.
+func (d *DB) UnpinMessage(id int64) error {
+	res, err := d.exec("DELETE FROM pinned_messages WHERE message_id = ?", id)
+	if err != nil {
+		return fmt.Errorf("unpinning message: %w", err)
+	}
+	return checkAffected(res)
+}
+
+// UnpinConversation unpins all of a conversation's messages and returns
+// how many were pinned.
+func (d *DB) UnpinConversation(conversationID string) (int64, error) {
+	res, err := d.exec("DELETE FROM pinned_messages WHERE conversation_id = ?", conversationID)
+	if err != nil {
+		return 0, fmt.Errorf("unpinning messages: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// PinnedMessages returns a conversation's pinned messages, oldest first.
+// Deleted messages are not returned.
+func (d *DB) PinnedMessages(conversationID string) ([]Message, error) {
+	rows, err := d.query(`
+		SELECT m.id, m.conversation_id, m.role, m.content, m.audio_ref, m.fallback, m.speaker, m.created_at
+		FROM pinned_messages p JOIN messages m ON m.id = p.message_id
+		WHERE p.conversation_id = ? AND m.deleted_at = ''
+		ORDER BY m.id`,
+		conversationID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying pinned messages: %w", err)
+	}
+	defer rows.Close()
+	var msgs []Message
+	for rows.Next() {
+		m, err := d.scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, *m)
+	}
+	return msgs, rows.Err()
+}
@@ -0,0 +1,39 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+const privateSchema = `
+	CREATE TABLE IF NOT EXISTS private_conversations (
+		conversation_id TEXT PRIMARY KEY,
+		created_at      TEXT NOT NULL DEFAULT (datetime('now'))
+	);
+	`
+
+// SetPrivate turns a conversation's privacy mode on or off. A private
+// conversation is only answered by local providers and is left out of
+// summaries and exports.
+func (d *DB) SetPrivate(conversationID string, private bool) error {
+	var err error
+	if private {
+		_, err = d.exec("INSERT OR IGNORE INTO private_conversations (conversation_id, created_at) VALUES (?, ?)",
+			conversationID, time.Now().UTC().Format(timeFormat))
+	} else {
+		_, err = d.exec("DELETE FROM private_conversations WHERE conversation_id = ?", conversationID)
+	}
+	if err != nil {
+		return fmt.Errorf("saving privacy mode: %w", err)
+	}
+	return nil
+}
+
+// Private reports whether a conversation is in privacy mode.
+func (d *DB) Private(conversationID string) (bool, error) {
+	var n int
+	if err := d.queryRow("SELECT COUNT(*) FROM private_conversations WHERE conversation_id = ?", conversationID).Scan(&n); err != nil {
+		return false, fmt.Errorf("querying privacy mode: %w", err)
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const projectsSchema = `
+	CREATE TABLE IF NOT EXISTS projects (
+		conversation_id TEXT PRIMARY KEY,
+		path            TEXT NOT NULL,
+		test_command    TEXT NOT NULL DEFAULT '',
+		created_at      TEXT NOT NULL DEFAULT (datetime('now'))
+	);
+	`
+
+// Project binds a conversation to a local git repository the agent may
+// read, test and propose changes to.
+type Project struct {
+	ConversationID string    `json:"conversation_id"`
+	Path           string    `json:"path"`
+	TestCommand    string    `json:"test_command"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// SetProject binds a conversation to a repository, replacing any earlier
+// binding.
+func (d *DB) SetProject(p *Project) error {
+	_, err := d.exec(
+		`INSERT INTO projects (conversation_id, path, test_command) VALUES (?, ?, ?)
+		 ON CONFLICT (conversation_id) DO UPDATE SET path = excluded.path, test_command = excluded.test_command`,
+		p.ConversationID, p.Path, p.TestCommand,
+	)
+	if err != nil {
+		return fmt.Errorf("saving project: %w", err)
+	}
+	return nil
+}
+
+// Project returns the repository a conversation is bound to.
+func (d *DB) Project(conversationID string) (*Project, error) {
+	var p Project
+	var createdAt string
+	err := d.queryRow(
+		"SELECT conversation_id, path, test_command, created_at FROM projects WHERE conversation_id = ?", conversationID,
+	).Scan(&p.ConversationID, &p.Path, &p.TestCommand, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying project: %w", err)
+	}
+	p.CreatedAt, _ = time.Parse(timeFormat, createdAt)
+	return &p, nil
+}
+
+// DeleteProject unbinds a conversation from its repository.
+func (d *DB) DeleteProject(conversationID string) error {
+	res, err := d.exec("DELETE FROM projects WHERE conversation_id = ?", conversationID)
+	if err != nil {
+		return fmt.Errorf("deleting project: %w", err)
+	}
+	return checkAffected(res)
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+const pushSchema = `
+	CREATE TABLE IF NOT EXISTS push_subscriptions (
+		endpoint   TEXT PRIMARY KEY,
+		p256dh     TEXT NOT NULL,
+		auth       TEXT NOT NULL,
+		device     TEXT NOT NULL DEFAULT '',
+		user       TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL DEFAULT (datetime('now'))
+	);
+	`
+
+// PushSubscription is a browser's Web Push subscription: the push service
+// endpoint and the keys messages to it are encrypted with.
+type PushSubscription struct {
+	Endpoint  string    `json:"endpoint"`
+	P256DH    string    `json:"p256dh"`
+	Auth      string    `json:"auth"`
+	Device    string    `json:"device,omitempty"`
+	User      string    `json:"user,omitempty"` // if set, only that user's notifications and general ones are sent
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AddPushSubscription saves a subscription, replacing the keys of an
+// existing one with the same endpoint.
+func (d *DB) AddPushSubscription(s *PushSubscription) error {
+	_, err := d.exec(
+		`INSERT INTO push_subscriptions (endpoint, p256dh, auth, device, user) VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT (endpoint) DO UPDATE SET p256dh = excluded.p256dh, auth = excluded.auth,
+		 device = excluded.device, user = excluded.user`,
+		s.Endpoint, s.P256DH, s.Auth, s.Device, s.User,
+	)
+	if err != nil {
+		return fmt.Errorf("saving push subscription: %w", err)
+	}
+	return nil
+}
+
+// PushSubscriptions returns every saved subscription.
+func (d *DB) PushSubscriptions() ([]PushSubscription, error) {
+	rows, err := d.query("SELECT endpoint, p256dh, auth, device, user, created_at FROM push_subscriptions ORDER BY created_at")
+	if err != nil {
+		return nil, fmt.Errorf("querying push subscriptions: %w", err)
+	}
+	defer rows.Close()
+	var out []PushSubscription
+	for rows.Next() {
+		var s PushSubscription
+		var createdAt string
+		if err := rows.Scan(&s.Endpoint, &s.P256DH, &s.Auth, &s.Device, &s.User, &createdAt); err != nil {
+			return nil, fmt.Errorf("scanning push subscription: %w", err)
+		}
+		s.CreatedAt, _ = time.Parse(timeFormat, createdAt)
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// DeletePushSubscription removes a subscription.
+func (d *DB) DeletePushSubscription(endpoint string) error {
+	res, err := d.exec("DELETE FROM push_subscriptions WHERE endpoint = ?", endpoint)
+	if err != nil {
+		return fmt.Errorf("deleting push subscription: %w", err)
+	}
+	return checkAffected(res)
+}
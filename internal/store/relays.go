@@ -0,0 +1,80 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const relaysSchema = `
+	CREATE TABLE IF NOT EXISTS relays (
+		conversation_id TEXT PRIMARY KEY,
+		a_label         TEXT NOT NULL,
+		a_language      TEXT NOT NULL,
+		b_label         TEXT NOT NULL,
+		b_language      TEXT NOT NULL,
+		created_at      TEXT NOT NULL DEFAULT (datetime('now'))
+	);
+	`
+
+// Relay puts a conversation in translation relay mode: each message from
+// one participant is translated for the other instead of answered.
+type Relay struct {
+	ConversationID string              `json:"conversation_id"`
+	Participants   [2]RelayParticipant `json:"participants"`
+	CreatedAt      time.Time           `json:"created_at"`
+}
+
+// RelayParticipant is one side of a relay.
+type RelayParticipant struct {
+	// Label names the participant, e.g. "Grandma"; messages they send are
+	// stored with it as their speaker.
+	Label string `json:"label"`
+	// Language is the language they speak, as a name or a tag.
+	Language string `json:"language"`
+}
+
+// SetRelay puts a conversation in relay mode, replacing any earlier
+// participants.
+func (d *DB) SetRelay(r *Relay) error {
+	a, b := r.Participants[0], r.Participants[1]
+	_, err := d.exec(
+		`INSERT INTO relays (conversation_id, a_label, a_language, b_label, b_language, created_at) VALUES (?, ?, ?, ?, ?, ?)
+		 ON CONFLICT (conversation_id) DO UPDATE SET a_label = excluded.a_label, a_language = excluded.a_language,
+		 b_label = excluded.b_label, b_language = excluded.b_language`,
+		r.ConversationID, a.Label, a.Language, b.Label, b.Language, time.Now().UTC().Format(timeFormat),
+	)
+	if err != nil {
+		return fmt.Errorf("saving relay: %w", err)
+	}
+	return nil
+}
+
+// Relay returns a conversation's relay, or ErrNotFound if it is not in
+// relay mode.
+func (d *DB) Relay(conversationID string) (*Relay, error) {
+	r := Relay{ConversationID: conversationID}
+	a, b := &r.Participants[0], &r.Participants[1]
+	var createdAt string
+	err := d.queryRow(
+		"SELECT a_label, a_language, b_label, b_language, created_at FROM relays WHERE conversation_id = ?", conversationID,
+	).Scan(&a.Label, &a.Language, &b.Label, &b.Language, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying relay: %w", err)
+	}
+	r.CreatedAt, _ = time.Parse(timeFormat, createdAt)
+	return &r, nil
+}
+
+// DeleteRelay takes a conversation out of relay mode.
+func (d *DB) DeleteRelay(conversationID string) error {
+	res, err := d.exec("DELETE FROM relays WHERE conversation_id = ?", conversationID)
+	if err != nil {
+		return fmt.Errorf("deleting relay: %w", err)
+	}
+	return checkAffected(res)
+}
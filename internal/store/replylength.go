@@ -0,0 +1,71 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const replyLengthsSchema = `
+	CREATE TABLE IF NOT EXISTS reply_lengths (
+		conversation_id   TEXT PRIMARY KEY,
+		verbosity         TEXT NOT NULL DEFAULT '',
+		max_output_tokens INTEGER NOT NULL DEFAULT 0,
+		updated_at        TEXT NOT NULL DEFAULT (datetime('now'))
+	);
+	`
+
+// ReplyLength overrides the reply length a conversation's persona sets,
+// e.g. to keep a voice conversation short.
+type ReplyLength struct {
+	ConversationID string `json:"conversation_id"`
+	// Verbosity is a preset such as "terse"; empty keeps the persona's.
+	Verbosity string `json:"verbosity"`
+	// MaxOutputTokens caps each reply; zero keeps the persona's or the
+	// verbosity's cap.
+	MaxOutputTokens int       `json:"max_output_tokens"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// SetReplyLength sets a conversation's reply length, replacing any
+// earlier setting.
+func (d *DB) SetReplyLength(l *ReplyLength) error {
+	_, err := d.exec(
+		`INSERT INTO reply_lengths (conversation_id, verbosity, max_output_tokens, updated_at) VALUES (?, ?, ?, ?)
+		 ON CONFLICT (conversation_id) DO UPDATE SET verbosity = excluded.verbosity, max_output_tokens = excluded.max_output_tokens, updated_at = excluded.updated_at`,
+		l.ConversationID, l.Verbosity, l.MaxOutputTokens, time.Now().UTC().Format(timeFormat),
+	)
+	if err != nil {
+		return fmt.Errorf("saving reply length: %w", err)
+	}
+	return nil
+}
+
+// ReplyLength returns a conversation's reply length, or ErrNotFound if it
+// has none of its own.
+func (d *DB) ReplyLength(conversationID string) (*ReplyLength, error) {
+	var l ReplyLength
+	var updatedAt string
+	err := d.queryRow(
+		"SELECT conversation_id, verbosity, max_output_tokens, updated_at FROM reply_lengths WHERE conversation_id = ?",
+		conversationID,
+	).Scan(&l.ConversationID, &l.Verbosity, &l.MaxOutputTokens, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying reply length: %w", err)
+	}
+	l.UpdatedAt, _ = time.Parse(timeFormat, updatedAt)
+	return &l, nil
+}
+
+// DeleteReplyLength returns a conversation to its persona's reply length.
+func (d *DB) DeleteReplyLength(conversationID string) error {
+	res, err := d.exec("DELETE FROM reply_lengths WHERE conversation_id = ?", conversationID)
+	if err != nil {
+		return fmt.Errorf("deleting reply length: %w", err)
+	}
+	return checkAffected(res)
+}
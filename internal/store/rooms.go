@@ -0,0 +1,108 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const roomsSchema = `
+	CREATE TABLE IF NOT EXISTS rooms (
+		conversation_id TEXT PRIMARY KEY,
+		name            TEXT NOT NULL DEFAULT '',
+		members         TEXT NOT NULL DEFAULT '[]',
+		personas        TEXT NOT NULL DEFAULT '[]',
+		created_at      TEXT NOT NULL DEFAULT (datetime('now'))
+	);
+	`
+
+// Room makes a conversation a group chat: several people, and possibly
+// several personas, take part, and each message is stored with its
+// speaker.
+type Room struct {
+	ConversationID string `json:"conversation_id"`
+	Name           string `json:"name"`
+	// Members are the people who may post, by user name or speaker
+	// label. Empty admits anyone who says who they are.
+	Members []string `json:"members"`
+	// Personas answer in the room, each when addressed by name; the first
+	// answers otherwise. Empty uses the speaker's usual persona.
+	Personas  []string  `json:"personas"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Admits reports whether speaker may post in the room.
+func (r *Room) Admits(speaker string) bool {
+	if speaker == "" {
+		return false
+	}
+	return len(r.Members) == 0 || slices.ContainsFunc(r.Members, func(m string) bool { return strings.EqualFold(m, speaker) })
+}
+
+// SetRoom makes a conversation a room, replacing any earlier members and
+// personas.
+func (d *DB) SetRoom(r *Room) error {
+	members, _ := json.Marshal(nonNil(r.Members))
+	personas, _ := json.Marshal(nonNil(r.Personas))
+	_, err := d.exec(
+		`INSERT INTO rooms (conversation_id, name, members, personas, created_at) VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT (conversation_id) DO UPDATE SET name = excluded.name, members = excluded.members, personas = excluded.personas`,
+		r.ConversationID, r.Name, string(members), string(personas), time.Now().UTC().Format(timeFormat),
+	)
+	if err != nil {
+		return fmt.Errorf("saving room: %w", err)
+	}
+	return nil
+}
+
+// Room returns a conversation's room, or ErrNotFound if it is not one.
+func (d *DB) Room(conversationID string) (*Room, error) {
+	rooms, err := d.queryRooms("SELECT conversation_id, name, members, personas, created_at FROM rooms WHERE conversation_id = ?", conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if len(rooms) == 0 {
+		return nil, ErrNotFound
+	}
+	return &rooms[0], nil
+}
+
+// Rooms returns all rooms ordered by name.
+func (d *DB) Rooms() ([]Room, error) {
+	return d.queryRooms("SELECT conversation_id, name, members, personas, created_at FROM rooms ORDER BY name, conversation_id")
+}
+
+// DeleteRoom makes a room a plain conversation again. Its messages keep
+// their speakers.
+func (d *DB) DeleteRoom(conversationID string) error {
+	res, err := d.exec("DELETE FROM rooms WHERE conversation_id = ?", conversationID)
+	if err != nil {
+		return fmt.Errorf("deleting room: %w", err)
+	}
+	return checkAffected(res)
+}
+
+func (d *DB) queryRooms(query string, args ...any) ([]Room, error) {
+	rows, err := d.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying rooms: %w", err)
+	}
+	defer rows.Close()
+
+	var rooms []Room
+	for rows.Next() {
+		var r Room
+		var members, personas, createdAt string
+		if err := rows.Scan(&r.ConversationID, &r.Name, &members, &personas, &createdAt); err != nil {
+			return nil, fmt.Errorf("scanning room: %w", err)
+		}
+		json.Unmarshal([]byte(members), &r.Members)
+		json.Unmarshal([]byte(personas), &r.Personas)
+		r.Members, r.Personas = nonNil(r.Members), nonNil(r.Personas)
+		r.CreatedAt, _ = time.Parse(timeFormat, createdAt)
+		rooms = append(rooms, r)
+	}
+	return rooms, rows.Err()
+}
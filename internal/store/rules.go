@@ -0,0 +1,149 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const rulesSchema = `
+	CREATE TABLE IF NOT EXISTS rules (
+		id            INTEGER PRIMARY KEY AUTOINCREMENT,
+		description   TEXT    NOT NULL,
+		entity_id     TEXT    NOT NULL,
+		operator      TEXT    NOT NULL,
+		threshold     TEXT    NOT NULL,
+		message       TEXT    NOT NULL,
+		enabled       INTEGER NOT NULL DEFAULT 1,
+		active        INTEGER NOT NULL DEFAULT 0,
+		last_fired_at TEXT,
+		created_at    TEXT    NOT NULL DEFAULT (datetime('now'))
+	);
+	`
+
+// ErrNotFound is returned when a requested record does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Rule is an automation that notifies the user when an entity's state
+// meets a condition. Active records whether the condition held at the last
+// evaluation, so a rule fires once per transition rather than on every
+// check.
+type Rule struct {
+	ID          int64      `json:"id"`
+	Description string     `json:"description"`
+	EntityID    string     `json:"entity_id"`
+	Operator    string     `json:"operator"`
+	Threshold   string     `json:"threshold"`
+	Message     string     `json:"message"`
+	Enabled     bool       `json:"enabled"`
+	Active      bool       `json:"active"`
+	LastFiredAt *time.Time `json:"last_fired_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+const ruleColumns = "id, description, entity_id, operator, threshold, message, enabled, active, last_fired_at, created_at"
+
+// AddRule inserts a rule and sets its ID.
+func (d *DB) AddRule(r *Rule) error {
+	res, err := d.exec(
+		"INSERT INTO rules (description, entity_id, operator, threshold, message, enabled) VALUES (?, ?, ?, ?, ?, ?)",
+		r.Description, r.EntityID, r.Operator, r.Threshold, r.Message, r.Enabled,
+	)
+	if err != nil {
+		return fmt.Errorf("inserting rule: %w", err)
+	}
+	r.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// UpdateRule replaces a rule's definition. Changing a rule resets its
+// active state so it is evaluated afresh.
+func (d *DB) UpdateRule(r *Rule) error {
+	res, err := d.exec(
+		"UPDATE rules SET description = ?, entity_id = ?, operator = ?, threshold = ?, message = ?, enabled = ?, active = 0 WHERE id = ?",
+		r.Description, r.EntityID, r.Operator, r.Threshold, r.Message, r.Enabled, r.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("updating rule: %w", err)
+	}
+	return checkAffected(res)
+}
+
+// DeleteRule removes a rule.
+func (d *DB) DeleteRule(id int64) error {
+	res, err := d.exec("DELETE FROM rules WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("deleting rule: %w", err)
+	}
+	return checkAffected(res)
+}
+
+// SetRuleActive records the outcome of evaluating a rule. firedAt is set
+// when the rule fired during this evaluation.
+func (d *DB) SetRuleActive(id int64, active bool, firedAt *time.Time) error {
+	var err error
+	if firedAt != nil {
+		_, err = d.exec("UPDATE rules SET active = ?, last_fired_at = ? WHERE id = ?", active, firedAt.UTC().Format(timeFormat), id)
+	} else {
+		_, err = d.exec("UPDATE rules SET active = ? WHERE id = ?", active, id)
+	}
+	if err != nil {
+		return fmt.Errorf("updating rule state: %w", err)
+	}
+	return nil
+}
+
+// Rule returns a single rule.
+func (d *DB) Rule(id int64) (*Rule, error) {
+	rules, err := d.queryRules("SELECT "+ruleColumns+" FROM rules WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, ErrNotFound
+	}
+	return &rules[0], nil
+}
+
+// Rules returns all rules ordered by ID.
+func (d *DB) Rules() ([]Rule, error) {
+	return d.queryRules("SELECT " + ruleColumns + " FROM rules ORDER BY id")
+}
+
+func (d *DB) queryRules(query string, args ...any) ([]Rule, error) {
+	rows, err := d.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []Rule
+	for rows.Next() {
+		var r Rule
+		var firedAt sql.NullString
+		var createdAt string
+		if err := rows.Scan(&r.ID, &r.Description, &r.EntityID, &r.Operator, &r.Threshold, &r.Message,
+			&r.Enabled, &r.Active, &firedAt, &createdAt); err != nil {
+			return nil, fmt.Errorf("scanning rule: %w", err)
+		}
+		r.CreatedAt, _ = time.Parse(timeFormat, createdAt)
+		if firedAt.Valid {
+			t, _ := time.Parse(timeFormat, firedAt.String)
+			r.LastFiredAt = &t
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+func checkAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const sensorReadingsSchema = `
+	CREATE TABLE IF NOT EXISTS sensor_readings (
+		id      INTEGER PRIMARY KEY AUTOINCREMENT,
+		sensor  TEXT NOT NULL,
+		read_at TEXT NOT NULL,
+		value   REAL NOT NULL,
+		unit    TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS idx_sensor_readings_time
+		ON sensor_readings(sensor, read_at);
+	`
+
+// SensorReading is a sampled value of a sensor kept for its history.
+type SensorReading struct {
+	Sensor string    `json:"sensor"`
+	ReadAt time.Time `json:"read_at"`
+	Value  float64   `json:"value"`
+	Unit   string    `json:"unit,omitempty"`
+}
+
+// SensorStats summarizes a sensor's readings over a time range.
+type SensorStats struct {
+	Sensor  string
+	Samples int
+	Min     float64
+	MinAt   time.Time
+	Max     float64
+	MaxAt   time.Time
+	Avg     float64
+	Unit    string // of the latest reading
+}
+
+// AddSensorReading stores a sensor sample. Samples from sensors polled at
+// the same time are committed together.
+func (d *DB) AddSensorReading(r SensorReading) error {
+	err := d.batched(func(tx *sql.Tx) error {
+		_, err := d.txExec(tx,
+			"INSERT INTO sensor_readings (sensor, read_at, value, unit) VALUES (?, ?, ?, ?)",
+			r.Sensor, r.ReadAt.UTC().Format(timeFormat), r.Value, r.Unit,
+		)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("inserting sensor reading: %w", err)
+	}
+	return nil
+}
+
+// SensorReadings returns a sensor's readings in [from, to), oldest first.
+// An empty sensor name includes all sensors.
+func (d *DB) SensorReadings(sensor string, from, to time.Time) ([]SensorReading, error) {
+	rows, err := d.query(`
+		SELECT sensor, read_at, value, unit FROM sensor_readings
+		WHERE (? = '' OR sensor = ?) AND read_at >= ? AND read_at < ?
+		ORDER BY read_at, id`,
+		sensor, sensor, from.UTC().Format(timeFormat), to.UTC().Format(timeFormat),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying sensor readings: %w", err)
+	}
+	defer rows.Close()
+
+	var out []SensorReading
+	for rows.Next() {
+		var r SensorReading
+		var readAt string
+		if err := rows.Scan(&r.Sensor, &readAt, &r.Value, &r.Unit); err != nil {
+			return nil, fmt.Errorf("scanning sensor reading: %w", err)
+		}
+		r.ReadAt, _ = time.Parse(timeFormat, readAt)
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// SensorStats returns the minimum, maximum and average of a sensor's
+// readings in [from, to), with when the extremes were read. Samples is
+// zero if there are none.
+func (d *DB) SensorStats(sensor string, from, to time.Time) (*SensorStats, error) {
+	st := &SensorStats{Sensor: sensor}
+	args := []any{sensor, from.UTC().Format(timeFormat), to.UTC().Format(timeFormat)}
+	const where = "WHERE sensor = ? AND read_at >= ? AND read_at < ?"
+	var avg sql.NullFloat64
+	err := d.queryRow("SELECT COUNT(*), AVG(value) FROM sensor_readings "+where, args...).Scan(&st.Samples, &avg)
+	if err != nil {
+		return nil, fmt.Errorf("querying sensor stats: %w", err)
+	}
+	if st.Samples == 0 {
+		return st, nil
+	}
+	st.Avg = avg.Float64
+	var minAt, maxAt string
+	if err := d.queryRow("SELECT value, read_at FROM sensor_readings "+where+" ORDER BY value, read_at LIMIT 1", args...).Scan(&st.Min, &minAt); err != nil {
+		return nil, fmt.Errorf("querying sensor minimum: %w", err)
+	}
+	if err := d.queryRow("SELECT value, read_at FROM sensor_readings "+where+" ORDER BY value DESC, read_at LIMIT 1", args...).Scan(&st.Max, &maxAt); err != nil {
+		return nil, fmt.Errorf("querying sensor maximum: %w", err)
+	}
+	if err := d.queryRow("SELECT unit FROM sensor_readings "+where+" ORDER BY read_at DESC, id DESC LIMIT 1", args...).Scan(&st.Unit); err != nil {
+		return nil, fmt.Errorf("querying sensor unit: %w", err)
+	}
+	st.MinAt, _ = time.Parse(timeFormat, minAt)
+	st.MaxAt, _ = time.Parse(timeFormat, maxAt)
+	return st, nil
+}
+
+// SensorReadingCSV is the header of SensorReading.CSV rows.
+var SensorReadingCSV = strings.Split("read_at,sensor,value,unit", ",")
+
+// CSV returns the reading as a row of values matching SensorReadingCSV.
+func (r SensorReading) CSV() []string {
+	return []string{r.ReadAt.Format(time.RFC3339), r.Sensor, strconv.FormatFloat(r.Value, 'f', -1, 64), r.Unit}
+}
+
+// SensorNames returns the names of the sensors with readings, in order.
+func (d *DB) SensorNames() ([]string, error) {
+	return d.distinct("SELECT DISTINCT sensor FROM sensor_readings ORDER BY sensor")
+}
+
+// DeleteSensorReadingsBefore removes readings taken before t and returns
+// how many were removed.
+func (d *DB) DeleteSensorReadingsBefore(t time.Time) (int64, error) {
+	res, err := d.exec("DELETE FROM sensor_readings WHERE read_at < ?", t.UTC().Format(timeFormat))
+	if err != nil {
+		return 0, fmt.Errorf("deleting sensor readings: %w", err)
+	}
+	return res.RowsAffected()
+}
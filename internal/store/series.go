@@ -0,0 +1,136 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Point is a value of a time series at a time.
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// The time series whose names do not depend on what is recorded.
+var fixedSeries = []string{"messages.hourly", "speedtest.download", "speedtest.upload", "speedtest.latency"}
+
+// SeriesNames returns the names of the time series Series can read, in
+// order:
+//
+//	messages.hourly            messages stored per hour
+//	sensor.<name>              a recorded sensor's readings
+//	energy.<meter>             an energy meter's power in watts
+//	usage.<persona>.messages   a persona's messages per day
+//	usage.<persona>.tokens     a persona's tokens per day
+//	speedtest.download         speed test download in Mbps
+//	speedtest.upload           speed test upload in Mbps
+//	speedtest.latency          speed test latency in milliseconds
+func (d *DB) SeriesNames() ([]string, error) {
+	names := append([]string(nil), fixedSeries...)
+	for _, q := range []struct{ query, prefix string }{
+		{"SELECT DISTINCT sensor FROM sensor_readings ORDER BY sensor", "sensor."},
+		{"SELECT DISTINCT meter FROM energy_readings ORDER BY meter", "energy."},
+	} {
+		list, err := d.distinct(q.query)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range list {
+			names = append(names, q.prefix+v)
+		}
+	}
+	personas, err := d.distinct("SELECT DISTINCT persona FROM persona_usage ORDER BY persona")
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range personas {
+		names = append(names, "usage."+p+".messages", "usage."+p+".tokens")
+	}
+	return names, nil
+}
+
+func (d *DB) distinct(query string) ([]string, error) {
+	rows, err := d.query(query)
+	if err != nil {
+		return nil, fmt.Errorf("querying names: %w", err)
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, fmt.Errorf("scanning name: %w", err)
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// Series returns the points of a time series in [from, to), oldest first;
+// see SeriesNames. It returns ErrNotFound for names it does not know.
+func (d *DB) Series(name string, from, to time.Time) ([]Point, error) {
+	args := []any{from.UTC().Format(timeFormat), to.UTC().Format(timeFormat)}
+	var query string
+	switch kind, rest, _ := strings.Cut(name, "."); {
+	case name == "messages.hourly":
+		query = `SELECT strftime('%Y-%m-%d %H:00:00', created_at) AS hour, COUNT(*) FROM messages
+			WHERE created_at >= ? AND created_at < ? AND deleted_at = '' GROUP BY hour ORDER BY hour`
+	case kind == "speedtest" && (rest == "download" || rest == "upload" || rest == "latency"):
+		column := map[string]string{"download": "download_mbps", "upload": "upload_mbps", "latency": "latency_ms"}[rest]
+		query = "SELECT tested_at, " + column + " FROM speed_tests WHERE tested_at >= ? AND tested_at < ? AND error = '' ORDER BY tested_at, id"
+	case kind == "sensor" && rest != "":
+		query = "SELECT read_at, value FROM sensor_readings WHERE read_at >= ? AND read_at < ? AND sensor = ? ORDER BY read_at, id"
+		args = append(args, rest)
+	case kind == "energy" && rest != "":
+		query = "SELECT read_at, power_w FROM energy_readings WHERE read_at >= ? AND read_at < ? AND meter = ? ORDER BY read_at, id"
+		args = append(args, rest)
+	case kind == "usage":
+		i := strings.LastIndexByte(rest, '.')
+		if i <= 0 || (rest[i+1:] != "messages" && rest[i+1:] != "tokens") {
+			return nil, ErrNotFound
+		}
+		// Days are local dates; the range is compared as dates too.
+		return d.usageSeries(rest[:i], rest[i+1:], from, to)
+	default:
+		return nil, ErrNotFound
+	}
+	rows, err := d.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying series %s: %w", name, err)
+	}
+	defer rows.Close()
+	var out []Point
+	for rows.Next() {
+		var p Point
+		var at string
+		if err := rows.Scan(&at, &p.Value); err != nil {
+			return nil, fmt.Errorf("scanning series %s: %w", name, err)
+		}
+		p.Time, _ = time.Parse(timeFormat, at)
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (d *DB) usageSeries(persona, column string, from, to time.Time) ([]Point, error) {
+	rows, err := d.query(
+		"SELECT day, "+column+" FROM persona_usage WHERE persona = ? AND day >= ? AND day <= ? ORDER BY day",
+		persona, from.Local().Format("2006-01-02"), to.Local().Format("2006-01-02"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying persona usage: %w", err)
+	}
+	defer rows.Close()
+	var out []Point
+	for rows.Next() {
+		var p Point
+		var day string
+		if err := rows.Scan(&day, &p.Value); err != nil {
+			return nil, fmt.Errorf("scanning persona usage: %w", err)
+		}
+		p.Time, _ = time.ParseInLocation("2006-01-02", day, time.Local)
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,77 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const sessionsSchema = `
+	CREATE TABLE IF NOT EXISTS sessions (
+		id         TEXT PRIMARY KEY,
+		user       TEXT NOT NULL,
+		method     TEXT NOT NULL,
+		created_at TEXT NOT NULL DEFAULT (datetime('now')),
+		expires_at TEXT NOT NULL
+	);
+	`
+
+// Session is a browser login. Its ID is a hash of the cookie value, so a
+// copy of the database does not hand out logins.
+type Session struct {
+	ID        string    `json:"-"`
+	User      string    `json:"user"`
+	Method    string    `json:"method"` // how the user logged in: "password" or "oidc"
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// AddSession saves a session.
+func (d *DB) AddSession(s *Session) error {
+	s.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	_, err := d.exec(
+		"INSERT INTO sessions (id, user, method, created_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+		s.ID, s.User, s.Method, s.CreatedAt.Format(timeFormat), s.ExpiresAt.UTC().Format(timeFormat),
+	)
+	if err != nil {
+		return fmt.Errorf("saving session: %w", err)
+	}
+	return nil
+}
+
+// Session returns an unexpired session.
+func (d *DB) Session(id string) (*Session, error) {
+	s := Session{ID: id}
+	var createdAt, expiresAt string
+	err := d.queryRow(
+		"SELECT user, method, created_at, expires_at FROM sessions WHERE id = ? AND expires_at > ?",
+		id, time.Now().UTC().Format(timeFormat),
+	).Scan(&s.User, &s.Method, &createdAt, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying session: %w", err)
+	}
+	s.CreatedAt, _ = time.Parse(timeFormat, createdAt)
+	s.ExpiresAt, _ = time.Parse(timeFormat, expiresAt)
+	return &s, nil
+}
+
+// DeleteSession ends a session.
+func (d *DB) DeleteSession(id string) error {
+	if _, err := d.exec("DELETE FROM sessions WHERE id = ?", id); err != nil {
+		return fmt.Errorf("deleting session: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredSessions removes sessions that have expired.
+func (d *DB) DeleteExpiredSessions() (int64, error) {
+	res, err := d.exec("DELETE FROM sessions WHERE expires_at <= ?", time.Now().UTC().Format(timeFormat))
+	if err != nil {
+		return 0, fmt.Errorf("deleting sessions: %w", err)
+	}
+	return res.RowsAffected()
+}
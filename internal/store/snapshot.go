@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// ErrReadOnly is returned for writes the filesystem refuses, e.g. after
+// the kernel remounted a failing SD card read-only.
+var ErrReadOnly = errors.New("database is read-only; is its filesystem mounted read-only?")
+
+// readOnly wraps err in ErrReadOnly if SQLite failed because the database
+// cannot be written.
+func readOnly(err error) error {
+	var se sqlite3.Error
+	if errors.As(err, &se) && se.Code == sqlite3.ErrReadonly {
+		return fmt.Errorf("%w (%v)", ErrReadOnly, err)
+	}
+	return err
+}
+
+// Snapshot writes a consistent copy of the database to path with VACUUM
+// INTO, replacing the file atomically so a crash leaves the old copy or
+// the new one.
+func (d *DB) Snapshot(path string) error {
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	if _, err := d.db.Exec("VACUUM INTO ?", tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("copying database: %w", err)
+	}
+	if err := syncFile(tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("copying database: %w", err)
+	}
+	// A journal left by opening the old copy in place would be replayed
+	// over the new one.
+	os.Remove(path + "-wal")
+	os.Remove(path + "-shm")
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("copying database: %w", err)
+	}
+	return syncFile(filepath.Dir(path))
+}
+
+func syncFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// Version returns a number that changes whenever a write is committed,
+// so a caller can tell whether the database changed between two calls.
+func (d *DB) Version() (int64, error) {
+	d.versionMu.Lock()
+	defer d.versionMu.Unlock()
+	// PRAGMA data_version only counts commits made by other connections,
+	// so it is read on one that never writes.
+	if d.version == nil {
+		conn, err := d.db.Conn(context.Background())
+		if err != nil {
+			return 0, err
+		}
+		d.version = conn
+	}
+	var v int64
+	if err := d.version.QueryRowContext(context.Background(), "PRAGMA data_version").Scan(&v); err != nil {
+		return 0, fmt.Errorf("reading data version: %w", err)
+	}
+	return v, nil
+}
+
+// closeVersion releases Version's connection.
+func (d *DB) closeVersion() {
+	d.versionMu.Lock()
+	defer d.versionMu.Unlock()
+	if d.version != nil {
+		d.version.Close()
+		d.version = nil
+	}
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const speedTestsSchema = `
+	CREATE TABLE IF NOT EXISTS speed_tests (
+		id            INTEGER PRIMARY KEY AUTOINCREMENT,
+		tested_at     TEXT    NOT NULL,
+		method        TEXT    NOT NULL,
+		server        TEXT    NOT NULL DEFAULT '',
+		download_mbps REAL    NOT NULL DEFAULT 0,
+		upload_mbps   REAL    NOT NULL DEFAULT 0,
+		latency_ms    REAL    NOT NULL DEFAULT 0,
+		error         TEXT    NOT NULL DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS idx_speed_tests_time ON speed_tests(tested_at);
+	`
+
+// SpeedTest is one bandwidth measurement. Failed tests are kept with
+// their error so outages show up in the history.
+type SpeedTest struct {
+	ID           int64     `json:"id"`
+	TestedAt     time.Time `json:"tested_at"`
+	Method       string    `json:"method"`
+	Server       string    `json:"server,omitempty"`
+	DownloadMbps float64   `json:"download_mbps"`
+	UploadMbps   float64   `json:"upload_mbps"`
+	LatencyMs    float64   `json:"latency_ms"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// SpeedTestStats summarizes the successful tests in a time range.
+type SpeedTestStats struct {
+	Tests           int
+	Failed          int
+	AvgDownloadMbps float64
+	MinDownloadMbps float64
+	AvgUploadMbps   float64
+	AvgLatencyMs    float64
+}
+
+// AddSpeedTest stores a measurement and sets its ID.
+func (d *DB) AddSpeedTest(t *SpeedTest) error {
+	res, err := d.exec(
+		"INSERT INTO speed_tests (tested_at, method, server, download_mbps, upload_mbps, latency_ms, error) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		t.TestedAt.UTC().Format(timeFormat), t.Method, t.Server, t.DownloadMbps, t.UploadMbps, t.LatencyMs, t.Error,
+	)
+	if err != nil {
+		return fmt.Errorf("inserting speed test: %w", err)
+	}
+	t.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// LatestSpeedTest returns the most recent successful measurement.
+func (d *DB) LatestSpeedTest() (*SpeedTest, error) {
+	var t SpeedTest
+	var testedAt string
+	err := d.queryRow(`
+		SELECT id, tested_at, method, server, download_mbps, upload_mbps, latency_ms
+		FROM speed_tests WHERE error = '' ORDER BY tested_at DESC, id DESC LIMIT 1`,
+	).Scan(&t.ID, &testedAt, &t.Method, &t.Server, &t.DownloadMbps, &t.UploadMbps, &t.LatencyMs)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying speed test: %w", err)
+	}
+	t.TestedAt, _ = time.Parse(timeFormat, testedAt)
+	return &t, nil
+}
+
+// SpeedTestStats summarizes measurements in [from, to).
+func (d *DB) SpeedTestStats(from, to time.Time) (SpeedTestStats, error) {
+	var st SpeedTestStats
+	err := d.queryRow(`
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE error != ''),
+		       COALESCE(AVG(download_mbps) FILTER (WHERE error = ''), 0),
+		       COALESCE(MIN(download_mbps) FILTER (WHERE error = ''), 0),
+		       COALESCE(AVG(upload_mbps) FILTER (WHERE error = ''), 0),
+		       COALESCE(AVG(latency_ms) FILTER (WHERE error = ''), 0)
+		FROM speed_tests WHERE tested_at >= ? AND tested_at < ?`,
+		from.UTC().Format(timeFormat), to.UTC().Format(timeFormat),
+	).Scan(&st.Tests, &st.Failed, &st.AvgDownloadMbps, &st.MinDownloadMbps, &st.AvgUploadMbps, &st.AvgLatencyMs)
+	if err != nil {
+		return st, fmt.Errorf("querying speed test stats: %w", err)
+	}
+	return st, nil
+}
@@ -2,7 +2,11 @@ package store
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"math"
+	"slices"
+	"sync"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -23,18 +27,51 @@ type Message struct {
 	ConversationID string
 	Role           Role
 	Content        string
-	CreatedAt      time.Time
+	// AudioRef points at the recording a spoken message was transcribed
+	// from, e.g. a file path or URL. Empty for typed messages.
+	AudioRef string
+	// Fallback names the fallback provider that wrote an assistant
+	// message because the primary one failed. Empty otherwise.
+	Fallback string
+	// Speaker labels the participant who sent a message in a translation
+	// relay, or whom a translation is for; in a room, the person who sent
+	// a message, or the persona that answered. Empty otherwise.
+	Speaker string
+	// Attachments are the IDs of attachments sent with a message. They
+	// are stored by InsertMessage but not loaded with the message; see
+	// MessageAttachments.
+	Attachments []string
+	CreatedAt   time.Time
 }
 
 // DB wraps a SQLite database for conversation storage.
 type DB struct {
-	db *sql.DB
+	db    *sql.DB
+	tails *tailCache
+
+	stmtMu sync.RWMutex
+	stmts  map[string]*sql.Stmt
+
+	writes     chan write
+	writerDone chan struct{}
+	closeMu    sync.RWMutex
+	closed     bool
+
+	versionMu sync.Mutex
+	version   *sql.Conn // see Version
+
+	keys keyring // of unlocked encrypted conversations
 }
 
 // Open opens (or creates) a SQLite database at the given path and runs
 // the schema migration.
+//
+// The connection is tuned for SD cards: WAL with synchronous=NORMAL syncs
+// only at checkpoints, and a busy timeout plus immediate write
+// transactions make concurrent writers wait their turn instead of failing
+// with "database is locked".
 func Open(path string) (*DB, error) {
-	db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL")
+	db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=5000&_txlock=immediate")
 	if err != nil {
 		return nil, fmt.Errorf("opening database: %w", err)
 	}
@@ -44,11 +81,26 @@ func Open(path string) (*DB, error) {
 		return nil, err
 	}
 
-	return &DB{db: db}, nil
+	d := &DB{
+		db:         db,
+		tails:      newTailCache(),
+		stmts:      make(map[string]*sql.Stmt),
+		writes:     make(chan write),
+		writerDone: make(chan struct{}),
+	}
+	go d.writer()
+	return d, nil
 }
 
-func migrate(db *sql.DB) error {
-	const schema = `
+// timeFormat is the layout SQLite's datetime() produces. Timestamps are
+// stored in UTC.
+const timeFormat = "2006-01-02 15:04:05"
+
+// schemas are applied in order every time the database is opened, so each
+// statement must be idempotent.
+var schemas = []string{messagesSchema, energySchema, sensorReadingsSchema, rulesSchema, arrivalsSchema, documentsSchema, emailSchema, contactsSchema, citationsSchema, approvalsSchema, toolDenialsSchema, idempotencySchema, projectsSchema, patchesSchema, speedTestsSchema, feedbackSchema, comparisonsSchema, transcriptsSchema, mqttSchema, personaUsageSchema, readMarkersSchema, pushSchema, sessionsSchema, notificationsSchema, listsSchema, flashcardsSchema, relaysSchema, roomsSchema, replyLengthsSchema, conversationProfilesSchema, memoriesSchema, contextBreaksSchema, pinsSchema, privateSchema, encryptedSchema, attachmentsSchema, originsSchema, revisionsSchema, outagesSchema}
+
+const messagesSchema = `
 	CREATE TABLE IF NOT EXISTS messages (
 		id              INTEGER PRIMARY KEY AUTOINCREMENT,
 		conversation_id TEXT    NOT NULL,
@@ -59,30 +111,251 @@ func migrate(db *sql.DB) error {
 	CREATE INDEX IF NOT EXISTS idx_messages_conversation
 		ON messages(conversation_id, id);
 	`
-	if _, err := db.Exec(schema); err != nil {
-		return fmt.Errorf("running migration: %w", err)
+
+// column is a column added to a table after it was first released.
+type column struct {
+	table, name, definition string
+}
+
+// columns are added to existing databases that predate them.
+var columns = []column{
+	{"chunks", "hash", "TEXT NOT NULL DEFAULT ''"},
+	{"messages", "audio_ref", "TEXT NOT NULL DEFAULT ''"},
+	{"messages", "fallback", "TEXT NOT NULL DEFAULT ''"},
+	{"messages", "speaker", "TEXT NOT NULL DEFAULT ''"},
+	{"messages", "deleted_at", "TEXT NOT NULL DEFAULT ''"},
+}
+
+func migrate(db *sql.DB) error {
+	for _, schema := range schemas {
+		if _, err := db.Exec(schema); err != nil {
+			return fmt.Errorf("running migration: %w", err)
+		}
+	}
+	for _, c := range columns {
+		if err := addColumn(db, c); err != nil {
+			return fmt.Errorf("running migration: %w", err)
+		}
 	}
 	return nil
 }
 
+// addColumn adds a column unless the table already has it.
+func addColumn(db *sql.DB, c column) error {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", c.table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == c.name {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.name, c.definition))
+	return err
+}
+
 // AddMessage inserts a message into a conversation.
 func (d *DB) AddMessage(conversationID string, role Role, content string) error {
-	_, err := d.db.Exec(
-		"INSERT INTO messages (conversation_id, role, content) VALUES (?, ?, ?)",
-		conversationID, string(role), content,
-	)
+	return d.InsertMessage(&Message{ConversationID: conversationID, Role: role, Content: content})
+}
+
+// InsertMessage inserts a message, including its audio reference, and sets
+// its ID and creation time. Concurrent inserts are committed together.
+func (d *DB) InsertMessage(m *Message) error {
+	content, sealed, err := d.sealFor(m.ConversationID, m.Content)
+	if err != nil {
+		return fmt.Errorf("inserting message: %w", err)
+	}
+	m.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	err = d.batched(func(tx *sql.Tx) error {
+		res, err := d.txExec(tx,
+			"INSERT INTO messages (conversation_id, role, content, audio_ref, fallback, speaker, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			m.ConversationID, string(m.Role), content, m.AudioRef, m.Fallback, m.Speaker, m.CreatedAt.Format(timeFormat),
+		)
+		if err != nil {
+			return err
+		}
+		m.ID, _ = res.LastInsertId()
+		for _, id := range m.Attachments {
+			if _, err := d.txExec(tx, "INSERT OR IGNORE INTO message_attachments (message_id, attachment_id) VALUES (?, ?)", m.ID, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		return fmt.Errorf("inserting message: %w", err)
 	}
+	d.added(*m, sealed)
 	return nil
 }
 
+// added updates the tail cache for a stored message. Encrypted
+// conversations are not cached, so that their plain text is not kept
+// beyond the requests holding their keys.
+func (d *DB) added(m Message, sealed bool) {
+	if sealed {
+		d.tails.invalidate(m.ConversationID)
+	} else {
+		d.tails.added(m)
+	}
+}
+
+// ImportMessages inserts messages in one transaction, keeping their
+// original timestamps where set.
+func (d *DB) ImportMessages(msgs []Message) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+	for _, m := range msgs {
+		createdAt := time.Now()
+		if !m.CreatedAt.IsZero() {
+			createdAt = m.CreatedAt
+		}
+		content, _, err := d.sealFor(m.ConversationID, m.Content)
+		if err != nil {
+			return fmt.Errorf("inserting message: %w", err)
+		}
+		if _, err := tx.Exec(
+			"INSERT INTO messages (conversation_id, role, content, audio_ref, created_at) VALUES (?, ?, ?, ?, ?)",
+			m.ConversationID, string(m.Role), content, m.AudioRef, createdAt.UTC().Format(timeFormat),
+		); err != nil {
+			return fmt.Errorf("inserting message: %w", err)
+		}
+	}
+	err = tx.Commit()
+	for _, m := range msgs {
+		d.tails.invalidate(m.ConversationID)
+	}
+	return err
+}
+
+// HasConversation reports whether a conversation has any messages.
+func (d *DB) HasConversation(conversationID string) (bool, error) {
+	var n int
+	if err := d.queryRow("SELECT COUNT(*) FROM messages WHERE conversation_id = ? AND deleted_at = ''", conversationID).Scan(&n); err != nil {
+		return false, fmt.Errorf("querying conversation: %w", err)
+	}
+	return n > 0, nil
+}
+
 // Messages returns all messages for a conversation, ordered chronologically.
 func (d *DB) Messages(conversationID string) ([]Message, error) {
-	rows, err := d.db.Query(
-		"SELECT id, conversation_id, role, content, created_at FROM messages WHERE conversation_id = ? ORDER BY id",
+	return d.queryMessages(
+		"SELECT id, conversation_id, role, content, audio_ref, fallback, speaker, created_at FROM messages WHERE conversation_id = ? AND deleted_at = '' ORDER BY id",
+		conversationID,
+	)
+}
+
+// MessagesBefore returns up to limit messages of a conversation older than
+// the message with ID before (or the newest, if before is zero), ordered
+// chronologically, for paging back through long histories.
+func (d *DB) MessagesBefore(conversationID string, before int64, limit int) ([]Message, error) {
+	if before <= 0 {
+		before = math.MaxInt64
+	}
+	msgs, err := d.queryMessages(
+		"SELECT id, conversation_id, role, content, audio_ref, fallback, speaker, created_at FROM messages WHERE conversation_id = ? AND id < ? AND deleted_at = '' ORDER BY id DESC LIMIT ?",
+		conversationID, before, limit,
+	)
+	slices.Reverse(msgs)
+	return msgs, err
+}
+
+// SummaryPrefix starts the message that compaction leaves in place of the
+// messages it summarized.
+const SummaryPrefix = "Summary of earlier conversation: "
+
+// RecentMessages returns the newest messages of a conversation whose
+// content fits in maxChars, ordered chronologically; the newest message is
+// always included. When older messages are left out and the conversation
+// starts with a compaction summary, the summary is included first so the
+// model keeps the gist of what came before. Rows are read newest first and
+// only until the budget is spent, so the cost does not grow with the
+// length of the conversation, and the result is cached for the next turn.
+func (d *DB) RecentMessages(conversationID string, maxChars int) ([]Message, error) {
+	if encrypted, err := d.Encrypted(conversationID); err != nil {
+		return nil, err
+	} else if encrypted {
+		t, err := d.loadTail(conversationID, maxChars)
+		if err != nil {
+			return nil, err
+		}
+		return t.messages(), nil
+	}
+	msgs, gen, ok := d.tails.get(conversationID, maxChars)
+	if ok {
+		return msgs, nil
+	}
+	t, err := d.loadTail(conversationID, maxChars)
+	if err != nil {
+		return nil, err
+	}
+	d.tails.put(t, gen)
+	return t.messages(), nil
+}
+
+func (d *DB) loadTail(conversationID string, maxChars int) (*tail, error) {
+	rows, err := d.query(
+		"SELECT id, conversation_id, role, content, audio_ref, fallback, speaker, created_at FROM messages WHERE conversation_id = ? AND deleted_at = '' ORDER BY id DESC",
+		conversationID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying messages: %w", err)
+	}
+	t := &tail{conversationID: conversationID, maxChars: maxChars}
+	truncated := false
+	for rows.Next() {
+		m, err := d.scanMessage(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if len(t.msgs) > 0 && t.used+len(m.Content) > maxChars {
+			truncated = true
+			break
+		}
+		t.used += len(m.Content)
+		t.msgs = append(t.msgs, *m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	slices.Reverse(t.msgs)
+	if !truncated {
+		if len(t.msgs) > 0 {
+			t.first = t.msgs[0]
+		}
+		return t, nil
+	}
+
+	first, err := d.queryMessages(
+		"SELECT id, conversation_id, role, content, audio_ref, fallback, speaker, created_at FROM messages WHERE conversation_id = ? AND deleted_at = '' ORDER BY id LIMIT 1",
 		conversationID,
 	)
+	if err != nil {
+		return nil, err
+	}
+	if len(first) == 1 {
+		t.first = first[0]
+	}
+	return t, nil
+}
+
+func (d *DB) queryMessages(query string, args ...any) ([]Message, error) {
+	rows, err := d.query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("querying messages: %w", err)
 	}
@@ -90,18 +363,54 @@ func (d *DB) Messages(conversationID string) ([]Message, error) {
 
 	var msgs []Message
 	for rows.Next() {
-		var m Message
-		var createdAt string
-		if err := rows.Scan(&m.ID, &m.ConversationID, &m.Role, &m.Content, &createdAt); err != nil {
-			return nil, fmt.Errorf("scanning message: %w", err)
+		m, err := d.scanMessage(rows)
+		if err != nil {
+			return nil, err
 		}
-		m.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
-		msgs = append(msgs, m)
+		msgs = append(msgs, *m)
 	}
 	return msgs, rows.Err()
 }
 
+// scanMessage reads a message row, opening its content if sealed.
+func (d *DB) scanMessage(row scanner) (*Message, error) {
+	var m Message
+	var createdAt string
+	if err := row.Scan(&m.ID, &m.ConversationID, &m.Role, &m.Content, &m.AudioRef, &m.Fallback, &m.Speaker, &createdAt); err != nil {
+		return nil, fmt.Errorf("scanning message: %w", err)
+	}
+	m.Content = d.open(m.ConversationID, m.Content)
+	m.CreatedAt, _ = time.Parse(timeFormat, createdAt)
+	return &m, nil
+}
+
+// Message returns a single message.
+func (d *DB) Message(id int64) (*Message, error) {
+	var m Message
+	var createdAt string
+	err := d.queryRow(
+		"SELECT id, conversation_id, role, content, audio_ref, fallback, speaker, created_at FROM messages WHERE id = ? AND deleted_at = ''", id,
+	).Scan(&m.ID, &m.ConversationID, &m.Role, &m.Content, &m.AudioRef, &m.Fallback, &m.Speaker, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying message: %w", err)
+	}
+	m.Content = d.open(m.ConversationID, m.Content)
+	m.CreatedAt, _ = time.Parse(timeFormat, createdAt)
+	return &m, nil
+}
+
 // Close closes the database connection.
 func (d *DB) Close() error {
+	d.closeWriter()
+	d.closeVersion()
+	d.stmtMu.Lock()
+	for _, s := range d.stmts {
+		s.Close()
+	}
+	d.stmts = nil
+	d.stmtMu.Unlock()
 	return d.db.Close()
 }
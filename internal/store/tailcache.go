@@ -0,0 +1,117 @@
+package store
+
+import (
+	"container/list"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// tailCacheSize is how many conversation tails are kept in memory.
+const tailCacheSize = 32
+
+// tail is the cached result of RecentMessages for one conversation. The
+// conversation's first message is kept alongside so that a compaction
+// summary can still be pinned once it falls out of the budget.
+type tail struct {
+	conversationID string
+	maxChars       int
+	first          Message // zero for an empty conversation
+	msgs           []Message
+	used           int // characters in msgs
+}
+
+// messages returns the history RecentMessages reports for t.
+func (t *tail) messages() []Message {
+	if len(t.msgs) > 0 && t.first.ID < t.msgs[0].ID && strings.HasPrefix(t.first.Content, SummaryPrefix) {
+		return append([]Message{t.first}, t.msgs...)
+	}
+	return slices.Clone(t.msgs)
+}
+
+// add appends m and drops the oldest messages that no longer fit.
+func (t *tail) add(m Message) {
+	if len(t.msgs) == 0 && t.first.ID == 0 {
+		t.first = m
+	}
+	t.msgs = append(t.msgs, m)
+	t.used += len(m.Content)
+	drop := 0
+	for len(t.msgs)-drop > 1 && t.used > t.maxChars {
+		t.used -= len(t.msgs[drop].Content)
+		drop++
+	}
+	t.msgs = slices.Delete(t.msgs, 0, drop)
+}
+
+// tailCache is an LRU cache of conversation tails. Inserts are appended
+// to the cached tail; other writes to a conversation drop it.
+type tailCache struct {
+	mu    sync.Mutex
+	order *list.List // of *tail, most recently used first
+	byID  map[string]*list.Element
+	gen   uint64 // counts writes, so a tail loaded during one is not cached
+}
+
+func newTailCache() *tailCache {
+	return &tailCache{order: list.New(), byID: make(map[string]*list.Element)}
+}
+
+// get returns the cached history, or on a miss the generation to pass to
+// put once it has been loaded.
+func (c *tailCache) get(conversationID string, maxChars int) ([]Message, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.byID[conversationID]
+	if !ok || e.Value.(*tail).maxChars != maxChars {
+		return nil, c.gen, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*tail).messages(), c.gen, true
+}
+
+func (c *tailCache) put(t *tail, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	if e, ok := c.byID[t.conversationID]; ok {
+		c.order.Remove(e)
+	}
+	c.byID[t.conversationID] = c.order.PushFront(t)
+	for c.order.Len() > tailCacheSize {
+		old := c.order.Remove(c.order.Back()).(*tail)
+		delete(c.byID, old.conversationID)
+	}
+}
+
+// added records a newly inserted message.
+func (c *tailCache) added(m Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	e, ok := c.byID[m.ConversationID]
+	if !ok {
+		return
+	}
+	t := e.Value.(*tail)
+	if n := len(t.msgs); n > 0 && t.msgs[n-1].ID > m.ID {
+		// Concurrent inserts finished out of order; reload next time.
+		c.order.Remove(e)
+		delete(c.byID, m.ConversationID)
+		return
+	}
+	t.add(m)
+}
+
+// invalidate drops a conversation's cached tail.
+func (c *tailCache) invalidate(conversationID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	if e, ok := c.byID[conversationID]; ok {
+		c.order.Remove(e)
+		delete(c.byID, conversationID)
+	}
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const toolDenialsSchema = `
+	CREATE TABLE IF NOT EXISTS tool_denials (
+		id              INTEGER PRIMARY KEY AUTOINCREMENT,
+		denied_at       TEXT NOT NULL DEFAULT (datetime('now')),
+		conversation_id TEXT NOT NULL DEFAULT '',
+		user            TEXT NOT NULL DEFAULT '',
+		persona         TEXT NOT NULL DEFAULT '',
+		channel         TEXT NOT NULL DEFAULT '',
+		tool            TEXT NOT NULL,
+		scope           TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_tool_denials_denied ON tool_denials(denied_at);
+	`
+
+// ToolDenial records a tool call refused because the persona or channel
+// of the turn may not use the tool.
+type ToolDenial struct {
+	ID             int64     `json:"id"`
+	DeniedAt       time.Time `json:"denied_at"`
+	ConversationID string    `json:"conversation_id,omitempty"`
+	User           string    `json:"user,omitempty"`
+	Persona        string    `json:"persona,omitempty"`
+	Channel        string    `json:"channel,omitempty"`
+	Tool           string    `json:"tool"`
+	Scope          string    `json:"scope"` // what refused it, e.g. "persona kids" or "channel telegram"
+}
+
+// AddToolDenial stores a denial and sets its ID and time.
+func (d *DB) AddToolDenial(t *ToolDenial) error {
+	t.DeniedAt = time.Now().UTC().Truncate(time.Second)
+	res, err := d.exec(
+		"INSERT INTO tool_denials (denied_at, conversation_id, user, persona, channel, tool, scope) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		t.DeniedAt.Format(timeFormat), t.ConversationID, t.User, t.Persona, t.Channel, t.Tool, t.Scope,
+	)
+	if err != nil {
+		return fmt.Errorf("inserting tool denial: %w", err)
+	}
+	t.ID, err = res.LastInsertId()
+	return err
+}
+
+// ToolDenialsSince returns the tool calls refused since a time, oldest
+// first.
+func (d *DB) ToolDenialsSince(since time.Time) ([]ToolDenial, error) {
+	rows, err := d.query(
+		"SELECT id, denied_at, conversation_id, user, persona, channel, tool, scope FROM tool_denials WHERE denied_at >= ? ORDER BY id",
+		since.UTC().Format(timeFormat),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying tool denials: %w", err)
+	}
+	defer rows.Close()
+	var out []ToolDenial
+	for rows.Next() {
+		var t ToolDenial
+		var deniedAt string
+		if err := rows.Scan(&t.ID, &deniedAt, &t.ConversationID, &t.User, &t.Persona, &t.Channel, &t.Tool, &t.Scope); err != nil {
+			return nil, fmt.Errorf("scanning tool denial: %w", err)
+		}
+		t.DeniedAt, _ = time.Parse(timeFormat, deniedAt)
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// ToolDenialCSV is the header of ToolDenial.CSV rows.
+var ToolDenialCSV = strings.Split("id,denied_at,conversation_id,user,persona,channel,tool,scope", ",")
+
+// CSV returns the denial as a row of values matching ToolDenialCSV.
+func (t ToolDenial) CSV() []string {
+	return []string{fmt.Sprint(t.ID), t.DeniedAt.Format(time.RFC3339), t.ConversationID, t.User, t.Persona, t.Channel, t.Tool, t.Scope}
+}
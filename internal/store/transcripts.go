@@ -0,0 +1,92 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+const transcriptsSchema = `
+	CREATE TABLE IF NOT EXISTS transcripts (
+		message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+		round      INTEGER NOT NULL,
+		request    BLOB    NOT NULL,
+		status     INTEGER NOT NULL,
+		response   BLOB    NOT NULL,
+		truncated  INTEGER NOT NULL DEFAULT 0,
+		created_at TEXT    NOT NULL DEFAULT (datetime('now')),
+		PRIMARY KEY (message_id, round)
+	);
+	`
+
+// Exchange is one recorded upstream request and its raw response, kept
+// for debugging the reply stored as MessageID.
+type Exchange struct {
+	MessageID int64     `json:"message_id"`
+	Round     int       `json:"round"` // 0 for the first request, then one per round of tool calls
+	Request   []byte    `json:"request"`
+	Status    int       `json:"status"`
+	Response  []byte    `json:"response"`
+	Truncated bool      `json:"truncated,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AddTranscript stores the upstream exchanges that produced a message,
+// numbering their rounds in order.
+func (d *DB) AddTranscript(messageID int64, exchanges []Exchange) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+	now := time.Now().UTC().Format(timeFormat)
+	for i, x := range exchanges {
+		// Empty bodies are stored as empty blobs rather than NULL.
+		req, resp := append([]byte{}, x.Request...), append([]byte{}, x.Response...)
+		if _, err := tx.Exec(
+			"INSERT OR REPLACE INTO transcripts (message_id, round, request, status, response, truncated, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			messageID, i, req, x.Status, resp, x.Truncated, now,
+		); err != nil {
+			return fmt.Errorf("inserting transcript: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Transcript returns the exchanges recorded for a message, in order, or
+// ErrNotFound if none were.
+func (d *DB) Transcript(messageID int64) ([]Exchange, error) {
+	rows, err := d.query(
+		"SELECT message_id, round, request, status, response, truncated, created_at FROM transcripts WHERE message_id = ? ORDER BY round", messageID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying transcript: %w", err)
+	}
+	defer rows.Close()
+	var out []Exchange
+	for rows.Next() {
+		var x Exchange
+		var createdAt string
+		if err := rows.Scan(&x.MessageID, &x.Round, &x.Request, &x.Status, &x.Response, &x.Truncated, &createdAt); err != nil {
+			return nil, fmt.Errorf("scanning transcript: %w", err)
+		}
+		x.CreatedAt, _ = time.Parse(timeFormat, createdAt)
+		out = append(out, x)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, ErrNotFound
+	}
+	return out, nil
+}
+
+// DeleteTranscriptsBefore removes transcripts recorded before t and
+// returns how many exchanges were removed.
+func (d *DB) DeleteTranscriptsBefore(t time.Time) (int64, error) {
+	res, err := d.exec("DELETE FROM transcripts WHERE created_at < ?", t.UTC().Format(timeFormat))
+	if err != nil {
+		return 0, fmt.Errorf("deleting transcripts: %w", err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,225 @@
+// Package thermal pauses background work while the CPU runs hot. A Pi
+// in a case, doing embedding indexing, summaries or local inference on
+// all cores, soon reaches the temperature at which the firmware throttles
+// the clock and everything, chat included, slows down. The monitor reads
+// the SoC temperature and, above a limit, holds back background jobs
+// until it has cooled below a lower one; chat requests are not held.
+package thermal
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultZone is the sysfs file with the SoC temperature in millidegrees
+// Celsius.
+const DefaultZone = "/sys/class/thermal/thermal_zone0/temp"
+
+// Default limits: the Pi firmware starts throttling at 80°C.
+const (
+	DefaultPause  = 75.0
+	DefaultResume = 65.0
+)
+
+// Status is the monitor's latest reading.
+type Status struct {
+	Celsius float64   `json:"celsius"`
+	Hot     bool      `json:"hot"` // background work is paused
+	Since   time.Time `json:"since,omitempty"`
+	ReadAt  time.Time `json:"read_at"`
+	// Pauses counts the times background work was paused.
+	Pauses int `json:"pauses"`
+}
+
+// Monitor watches the CPU temperature.
+type Monitor struct {
+	zone          string
+	pause, resume float64
+	interval      time.Duration
+	led           string // sysfs LED directory, or empty
+
+	mu       sync.Mutex
+	status   Status
+	cool     chan struct{} // closed when it is not hot
+	trigger  string        // the LED's trigger before it was taken over
+	readErrs int
+}
+
+// New creates a monitor reading zone every interval, pausing background
+// work at or above pause °C and resuming at or below resume °C.
+func New(zone string, pause, resume float64, interval time.Duration) (*Monitor, error) {
+	if resume >= pause {
+		return nil, fmt.Errorf("resume temperature %.1f°C must be below the pause temperature %.1f°C", resume, pause)
+	}
+	m := &Monitor{zone: zone, pause: pause, resume: resume, interval: interval, cool: make(chan struct{})}
+	close(m.cool)
+	c, err := m.read()
+	if err != nil {
+		return nil, err
+	}
+	m.update(c)
+	return m, nil
+}
+
+// SetLED makes the monitor blink an LED, named as under /sys/class/leds
+// (e.g. ACT or led0 for the Pi's activity LED), while background work is
+// paused. The LED's own trigger is restored when it cools down.
+func (m *Monitor) SetLED(name string) error {
+	dir := filepath.Join("/sys/class/leds", name)
+	if _, err := os.Stat(filepath.Join(dir, "trigger")); err != nil {
+		return fmt.Errorf("LED %s: %w", name, err)
+	}
+	m.mu.Lock()
+	m.led = dir
+	hot := m.status.Hot
+	m.mu.Unlock()
+	if hot {
+		m.setLED(true)
+	}
+	return nil
+}
+
+// Run reads the temperature every interval until ctx is cancelled.
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			m.setLED(false)
+			return
+		case <-ticker.C:
+		}
+		c, err := m.read()
+		if err != nil {
+			// A zone that stops reading would otherwise keep jobs
+			// paused, or running hot, forever; log once and carry on
+			// with the last reading.
+			if m.readErrs++; m.readErrs == 1 {
+				log.Printf("thermal: %v", err)
+			}
+			continue
+		}
+		m.readErrs = 0
+		m.update(c)
+	}
+}
+
+func (m *Monitor) read() (float64, error) {
+	b, err := os.ReadFile(m.zone)
+	if err != nil {
+		return 0, fmt.Errorf("reading temperature: %w", err)
+	}
+	milli, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, fmt.Errorf("reading temperature from %s: %w", m.zone, err)
+	}
+	return float64(milli) / 1000, nil
+}
+
+// update records a reading and pauses or resumes background work.
+func (m *Monitor) update(c float64) {
+	now := time.Now()
+	m.mu.Lock()
+	m.status.Celsius, m.status.ReadAt = c, now
+	changed := false
+	switch {
+	case !m.status.Hot && c >= m.pause:
+		m.status.Hot, m.status.Since, changed = true, now, true
+		m.status.Pauses++
+		m.cool = make(chan struct{})
+		log.Printf("thermal: CPU at %.1f°C, pausing background work until it is below %.1f°C", c, m.resume)
+	case m.status.Hot && c <= m.resume:
+		m.status.Hot, m.status.Since, changed = false, now, true
+		close(m.cool)
+		log.Printf("thermal: CPU at %.1f°C, resuming background work", c)
+	}
+	hot := m.status.Hot
+	m.mu.Unlock()
+	if changed {
+		m.setLED(hot)
+	}
+}
+
+// setLED blinks the LED while hot and restores its trigger otherwise.
+func (m *Monitor) setLED(hot bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.led == "" {
+		return
+	}
+	path := filepath.Join(m.led, "trigger")
+	if hot {
+		if m.trigger == "" {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				log.Printf("thermal: %v", err)
+				return
+			}
+			m.trigger = activeTrigger(string(b))
+		}
+		if err := os.WriteFile(path, []byte("timer"), 0); err != nil {
+			log.Printf("thermal: %v", err)
+		}
+		return
+	}
+	if m.trigger != "" {
+		if err := os.WriteFile(path, []byte(m.trigger), 0); err != nil {
+			log.Printf("thermal: %v", err)
+		}
+		m.trigger = ""
+	}
+}
+
+// activeTrigger returns the bracketed entry of a sysfs trigger list such
+// as "none [mmc0] timer heartbeat".
+func activeTrigger(list string) string {
+	for _, t := range strings.Fields(list) {
+		if strings.HasPrefix(t, "[") && strings.HasSuffix(t, "]") {
+			return t[1 : len(t)-1]
+		}
+	}
+	return "none"
+}
+
+// Status returns the latest reading.
+func (m *Monitor) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+// Wait blocks while background work is paused, returning early with the
+// context's error.
+func (m *Monitor) Wait(ctx context.Context) error {
+	m.mu.Lock()
+	cool := m.cool
+	m.mu.Unlock()
+	select {
+	case <-cool:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Defer wraps a background job so that a run starting while the CPU is
+// hot waits until it has cooled down.
+func (m *Monitor) Defer(name string, job func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if s := m.Status(); s.Hot {
+			log.Printf("thermal: %s postponed, CPU at %.1f°C", name, s.Celsius)
+		}
+		if err := m.Wait(ctx); err != nil {
+			return err
+		}
+		return job(ctx)
+	}
+}
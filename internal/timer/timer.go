@@ -0,0 +1,159 @@
+package timer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"pi-agent/internal/tools"
+)
+
+// Timer is a pending countdown attached to a conversation.
+type Timer struct {
+	ID             int       `json:"id"`
+	ConversationID string    `json:"conversation_id"`
+	Label          string    `json:"label"`
+	Duration       string    `json:"duration"`
+	Due            time.Time `json:"due"`
+}
+
+// Manager runs in-memory timers and invokes a callback when one fires.
+// Timers do not survive a restart.
+type Manager struct {
+	onFire func(Timer)
+
+	mu     sync.Mutex
+	nextID int
+	timers map[int]*entry
+}
+
+type entry struct {
+	timer Timer
+	t     *time.Timer
+}
+
+// NewManager creates a timer manager. onFire is called in its own
+// goroutine when a timer elapses.
+func NewManager(onFire func(Timer)) *Manager {
+	return &Manager{onFire: onFire, timers: make(map[int]*entry)}
+}
+
+// Start schedules a timer for the conversation.
+func (m *Manager) Start(conversationID, label string, d time.Duration) Timer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextID++
+	tm := Timer{
+		ID:             m.nextID,
+		ConversationID: conversationID,
+		Label:          label,
+		Duration:       Describe(d),
+		Due:            time.Now().Add(d),
+	}
+	e := &entry{timer: tm}
+	e.t = time.AfterFunc(d, func() {
+		m.mu.Lock()
+		delete(m.timers, tm.ID)
+		m.mu.Unlock()
+		m.onFire(tm)
+	})
+	m.timers[tm.ID] = e
+	return tm
+}
+
+// Cancel stops all timers in the conversation and returns how many were
+// cancelled.
+func (m *Manager) Cancel(conversationID string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for id, e := range m.timers {
+		if e.timer.ConversationID == conversationID && e.t.Stop() {
+			delete(m.timers, id)
+			n++
+		}
+	}
+	return n
+}
+
+// List returns the pending timers for a conversation, soonest first. An
+// empty conversation ID lists all timers.
+func (m *Manager) List(conversationID string) []Timer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []Timer
+	for _, e := range m.timers {
+		if conversationID == "" || e.timer.ConversationID == conversationID {
+			out = append(out, e.timer)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Due.Before(out[j].Due) })
+	return out
+}
+
+// Describe formats a duration the way people say it, e.g. "1 hour 5 minutes".
+func Describe(d time.Duration) string {
+	d = d.Round(time.Second)
+	parts := []struct {
+		unit string
+		size time.Duration
+	}{{"hour", time.Hour}, {"minute", time.Minute}, {"second", time.Second}}
+
+	var out string
+	for _, p := range parts {
+		n := int(d / p.size)
+		if n == 0 {
+			continue
+		}
+		d -= time.Duration(n) * p.size
+		if out != "" {
+			out += " "
+		}
+		out += fmt.Sprintf("%d %s", n, p.unit)
+		if n != 1 {
+			out += "s"
+		}
+	}
+	if out == "" {
+		return "0 seconds"
+	}
+	return out
+}
+
+// Tools returns model-facing tools for setting and listing timers.
+func (m *Manager) Tools() []tools.Tool {
+	return []tools.Tool{
+		tools.New("set_timer", "Start a countdown timer. The user is alerted when it finishes.",
+			`{"type":"object","properties":{"seconds":{"type":"integer","minimum":1},"label":{"type":"string","description":"what the timer is for"}},"required":["seconds"]}`,
+			func(ctx context.Context, args json.RawMessage) (string, error) {
+				var in struct {
+					Seconds int    `json:"seconds"`
+					Label   string `json:"label"`
+				}
+				if err := tools.Decode(args, &in); err != nil {
+					return "", err
+				}
+				if in.Seconds <= 0 {
+					return "", fmt.Errorf("seconds must be positive")
+				}
+				tm := m.Start(tools.ConversationID(ctx), in.Label, time.Duration(in.Seconds)*time.Second)
+				return fmt.Sprintf("Timer %d set for %s, due at %s.", tm.ID, tm.Duration, tm.Due.Format(time.Kitchen)), nil
+			}),
+		tools.New("list_timers", "List the running timers and their remaining time.", tools.NoParams,
+			func(ctx context.Context, _ json.RawMessage) (string, error) {
+				timers := m.List(tools.ConversationID(ctx))
+				if len(timers) == 0 {
+					return "No timers are running.", nil
+				}
+				out := ""
+				for _, tm := range timers {
+					out += fmt.Sprintf("Timer %d (%s): %s left\n", tm.ID, tm.Label, Describe(time.Until(tm.Due)))
+				}
+				return out, nil
+			}),
+	}
+}
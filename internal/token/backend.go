@@ -0,0 +1,280 @@
+package token
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"pi-agent/internal/oauth"
+)
+
+// Backends are the ways a Store can keep its credentials: a plain JSON
+// file, the system keyring (the Secret Service on Linux, the Keychain on
+// macOS), or a file encrypted with the passphrase in $EnvPassphrase.
+var Backends = []string{"file", "keyring", "encrypted-file"}
+
+// EnvBackend is the environment variable naming the default backend, and
+// EnvPassphrase the one the encrypted-file backend's passphrase is read
+// from.
+const (
+	EnvBackend    = "PI_AGENT_TOKEN_BACKEND"
+	EnvPassphrase = "PI_AGENT_TOKEN_PASSPHRASE"
+)
+
+// backend reads and writes a Store's serialized credentials. load returns
+// an error satisfying errors.Is(err, os.ErrNotExist) when nothing has been
+// saved yet.
+type backend interface {
+	load() ([]byte, error)
+	save(data []byte) error
+}
+
+// OpenStore creates a token store keeping its credentials with the named
+// backend, one of Backends; empty is "file". path is the credentials file,
+// which the other backends read credentials saved before they were chosen
+// from, and delete once they have saved their own.
+func OpenStore(path, backendName string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("creating token directory: %w", err)
+	}
+	var b backend
+	switch backendName {
+	case "", "file":
+		b = fileBackend(path)
+	case "keyring":
+		// Without a usable keyring, e.g. on a headless machine with no
+		// D-Bus session, the file store stands in.
+		k, err := newKeyring(path)
+		if err == nil {
+			if _, err = k.load(); errors.Is(err, os.ErrNotExist) {
+				err = nil
+			}
+		}
+		if err != nil {
+			log.Printf("token: %v; keeping credentials in %s", err, path)
+			b = fileBackend(path)
+		} else {
+			b = migrating{k, fileBackend(path)}
+		}
+	case "encrypted-file":
+		passphrase := os.Getenv(EnvPassphrase)
+		if passphrase == "" {
+			return nil, fmt.Errorf("encrypted-file: $%s is empty", EnvPassphrase)
+		}
+		b = migrating{&encryptedFile{path: path + ".enc", passphrase: passphrase}, fileBackend(path)}
+	default:
+		return nil, fmt.Errorf("unknown token backend %q (available: %s)", backendName, strings.Join(Backends, " "))
+	}
+	s := &Store{b: b, accounts: make(map[string]*oauth.Credentials)}
+	// Loading the file is best-effort, as it may not exist yet; the other
+	// backends fail rather than let a login replace credentials they
+	// could not read, e.g. with the wrong passphrase.
+	if err := s.load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		if _, ok := b.(fileBackend); !ok {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// fileBackend keeps the credentials in a JSON file only its owner can read.
+type fileBackend string
+
+func (f fileBackend) load() ([]byte, error) { return os.ReadFile(string(f)) }
+
+func (f fileBackend) save(data []byte) error { return os.WriteFile(string(f), data, 0600) }
+
+// migrating is a backend that falls back to reading an old one until it
+// has saved credentials of its own, and then removes the old one's.
+type migrating struct {
+	backend
+	old fileBackend
+}
+
+func (m migrating) load() ([]byte, error) {
+	data, err := m.backend.load()
+	if errors.Is(err, os.ErrNotExist) {
+		return m.old.load()
+	}
+	return data, err
+}
+
+func (m migrating) save(data []byte) error {
+	if err := m.backend.save(data); err != nil {
+		return err
+	}
+	if err := os.Remove(string(m.old)); err == nil {
+		log.Printf("token: moved the credentials out of %s", string(m.old))
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// keyringService is the service the credentials are stored under in the
+// system keyring; the attribute or account distinguishes data
+// directories.
+const keyringService = "pi-agent"
+
+// keyring keeps the credentials in the system keyring through its command
+// line tool: secret-tool (libsecret) on Linux and security on macOS.
+type keyring struct {
+	account string // the credentials file's absolute path
+	tool    string
+}
+
+func newKeyring(path string) (*keyring, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	tool := "secret-tool"
+	if runtime.GOOS == "darwin" {
+		tool = "security"
+		// The path is quoted in a command read by "security -i".
+		if strings.ContainsAny(abs, "\"\\\n") {
+			return nil, fmt.Errorf("keyring: cannot name %q in the Keychain", abs)
+		}
+	}
+	if _, err := exec.LookPath(tool); err != nil {
+		return nil, fmt.Errorf("keyring: %w", err)
+	}
+	return &keyring{account: abs, tool: tool}, nil
+}
+
+func (k *keyring) load() ([]byte, error) {
+	var cmd *exec.Cmd
+	if k.tool == "security" {
+		cmd = exec.Command("security", "find-generic-password", "-s", keyringService, "-a", k.account, "-w")
+	} else {
+		cmd = exec.Command("secret-tool", "lookup", "service", keyringService, "path", k.account)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		// Both tools exit with a failure and say nothing useful when
+		// there is no such item.
+		var exit *exec.ExitError
+		if errors.As(err, &exit) && (k.tool == "secret-tool" && stderr.Len() == 0 || strings.Contains(stderr.String(), "could not be found")) {
+			return nil, os.ErrNotExist
+		}
+		return nil, fmt.Errorf("keyring: %s: %w: %s", k.tool, err, strings.TrimSpace(stderr.String()))
+	}
+	out = bytes.TrimSpace(out)
+	if len(out) == 0 {
+		return nil, os.ErrNotExist
+	}
+	return out, nil
+}
+
+func (k *keyring) save(data []byte) error {
+	var cmd *exec.Cmd
+	if k.tool == "security" {
+		// Commands read from standard input keep the secret out of ps.
+		cmd = exec.Command("security", "-i")
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a \"%s\" -X %s\n", keyringService, k.account, hex.EncodeToString(data)))
+	} else {
+		cmd = exec.Command("secret-tool", "store", "--label=pi-agent credentials", "service", keyringService, "path", k.account)
+		cmd.Stdin = bytes.NewReader(data)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("keyring: %s: %w: %s", k.tool, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Encrypted files start with encryptedMagic, then the PBKDF2 salt and the
+// AES-GCM nonce, then the sealed credentials.
+const (
+	encryptedMagic = "pi-agent tokens 1\n"
+	saltSize       = 16
+	kdfIterations  = 200_000
+)
+
+// encryptedFile keeps the credentials in a file sealed with AES-256-GCM
+// under a key derived from a passphrase. The key is derived once per salt,
+// and the salt is kept across saves.
+type encryptedFile struct {
+	path       string
+	passphrase string
+	salt       []byte
+	aead       cipher.AEAD
+}
+
+func (e *encryptedFile) aeadFor(salt []byte) (cipher.AEAD, error) {
+	if e.aead != nil && bytes.Equal(salt, e.salt) {
+		return e.aead, nil
+	}
+	key, err := pbkdf2.Key(sha256.New, e.passphrase, salt, kdfIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if e.aead, err = cipher.NewGCM(block); err != nil {
+		return nil, err
+	}
+	e.salt = salt
+	return e.aead, nil
+}
+
+func (e *encryptedFile) load() ([]byte, error) {
+	data, err := os.ReadFile(e.path)
+	if err != nil {
+		return nil, err
+	}
+	sealed, ok := bytes.CutPrefix(data, []byte(encryptedMagic))
+	if !ok || len(sealed) < saltSize {
+		return nil, fmt.Errorf("%s: not an encrypted credentials file", e.path)
+	}
+	salt, sealed := sealed[:saltSize], sealed[saltSize:]
+	aead, err := e.aeadFor(bytes.Clone(salt))
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("%s: truncated", e.path)
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(encryptedMagic))
+	if err != nil {
+		return nil, fmt.Errorf("%s: wrong passphrase in $%s, or the file is damaged", e.path, EnvPassphrase)
+	}
+	return plain, nil
+}
+
+func (e *encryptedFile) save(data []byte) error {
+	salt := e.salt
+	if salt == nil {
+		salt = make([]byte, saltSize)
+		rand.Read(salt)
+	}
+	aead, err := e.aeadFor(salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	out := append([]byte(encryptedMagic), salt...)
+	out = append(out, nonce...)
+	out = aead.Seal(out, nonce, data, []byte(encryptedMagic))
+	tmp := e.path + ".tmp"
+	if err := os.WriteFile(tmp, out, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, e.path)
+}
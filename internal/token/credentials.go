@@ -0,0 +1,53 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// EnvAPIKey is the environment variable an OpenAI API key is read from.
+const EnvAPIKey = "OPENAI_API_KEY"
+
+// Provider supplies the credentials requests to OpenAI authenticate with:
+// a ChatGPT subscription's OAuth tokens, kept by a Store, or a platform
+// API key.
+type Provider interface {
+	// AccessToken returns the bearer token for the next request.
+	AccessToken(ctx context.Context) (string, error)
+	// AccountID returns the ChatGPT account ID, or "" for API keys.
+	AccountID() string
+	HasCredentials() bool
+	// ExpiresAt returns when the current token expires, or the zero time
+	// if it does not.
+	ExpiresAt() time.Time
+	// IsAPIKey reports whether the credential is an API key, which is
+	// only valid against api.openai.com.
+	IsAPIKey() bool
+}
+
+// Open returns the API key if one is given and otherwise the OAuth
+// credentials stored at path with the named backend (see OpenStore).
+func Open(path, backend, apiKey string) (Provider, error) {
+	if apiKey != "" {
+		return APIKey(apiKey), nil
+	}
+	return OpenStore(path, backend)
+}
+
+// APIKey is an OpenAI platform API key. It needs no refreshing and never
+// expires.
+type APIKey string
+
+// AccessToken returns the key.
+func (k APIKey) AccessToken(context.Context) (string, error) {
+	if k == "" {
+		return "", errors.New("empty API key")
+	}
+	return string(k), nil
+}
+
+func (k APIKey) AccountID() string    { return "" }
+func (k APIKey) HasCredentials() bool { return k != "" }
+func (k APIKey) ExpiresAt() time.Time { return time.Time{} }
+func (k APIKey) IsAPIKey() bool       { return true }
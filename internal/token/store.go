@@ -1,83 +1,196 @@
 package token
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"slices"
 	"sync"
 	"time"
 
 	"pi-agent/internal/oauth"
 )
 
-// Store manages persisting and refreshing OAuth credentials on disk.
+// DefaultAccount is the name credentials are saved under when no account
+// is named, and the name given to those in a file written before accounts
+// existed.
+const DefaultAccount = "default"
+
+// ErrNoAccount is returned for an account that has no credentials stored.
+var ErrNoAccount = errors.New("no such account")
+
+// Store manages persisting and refreshing OAuth credentials on disk. It
+// holds any number of named accounts, e.g. a personal and a work ChatGPT
+// subscription; its Provider methods use the default one, and Account
+// returns a Provider for another.
 type Store struct {
-	path string
-	mu   sync.Mutex
-	cred *oauth.Credentials
+	b        backend
+	mu       sync.Mutex
+	def      string
+	accounts map[string]*oauth.Credentials
+}
+
+// storeFile is the credentials file's format.
+type storeFile struct {
+	Default  string                        `json:"default"`
+	Accounts map[string]*oauth.Credentials `json:"accounts"`
 }
 
 // NewStore creates a token store that reads/writes credentials to the given
 // file path. The parent directory is created if it does not exist.
 func NewStore(path string) (*Store, error) {
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return nil, fmt.Errorf("creating token directory: %w", err)
-	}
-	s := &Store{path: path}
-	_ = s.load() // best-effort load; may not exist yet
-	return s, nil
+	return OpenStore(path, "file")
 }
 
 func (s *Store) load() error {
-	data, err := os.ReadFile(s.path)
+	data, err := s.b.load()
 	if err != nil {
 		return err
 	}
-	var cred oauth.Credentials
-	if err := json.Unmarshal(data, &cred); err != nil {
+	var f storeFile
+	if err := json.Unmarshal(data, &f); err != nil {
 		return err
 	}
-	s.cred = &cred
+	if f.Accounts == nil {
+		// A single set of credentials, from before accounts.
+		var cred oauth.Credentials
+		if err := json.Unmarshal(data, &cred); err != nil {
+			return err
+		}
+		f = storeFile{Default: DefaultAccount, Accounts: map[string]*oauth.Credentials{DefaultAccount: &cred}}
+	}
+	s.def, s.accounts = f.Default, f.Accounts
 	return nil
 }
 
 func (s *Store) save() error {
-	data, err := json.MarshalIndent(s.cred, "", "  ")
+	data, err := json.MarshalIndent(storeFile{Default: s.def, Accounts: s.accounts}, "", "  ")
 	if err != nil {
 		return fmt.Errorf("marshaling credentials: %w", err)
 	}
-	if err := os.WriteFile(s.path, data, 0600); err != nil {
+	if err := s.b.save(data); err != nil {
 		return fmt.Errorf("writing credentials: %w", err)
 	}
 	return nil
 }
 
-// HasCredentials returns true if credentials have been loaded or stored.
+// HasCredentials returns true if the default account has credentials.
 func (s *Store) HasCredentials() bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return s.cred != nil
+	return s.accounts[s.def] != nil
 }
 
-// Save persists new credentials to disk.
+// Save persists new credentials for the default account to disk.
 func (s *Store) Save(cred *oauth.Credentials) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.cred = cred
+	return s.put(cmp.Or(s.def, DefaultAccount), cred)
+}
+
+// SaveAccount persists new credentials for the named account, adding it
+// if it is new. The first account saved becomes the default.
+func (s *Store) SaveAccount(name string, cred *oauth.Credentials) error {
+	if name == "" {
+		return errors.New("account name is empty")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.put(name, cred)
+}
+
+// put stores and saves an account's credentials; s.mu must be held.
+func (s *Store) put(name string, cred *oauth.Credentials) error {
+	s.accounts[name] = cred
+	if s.accounts[s.def] == nil {
+		s.def = name
+	}
 	return s.save()
 }
 
-// AccountID returns the ChatGPT account ID, or empty string if not available.
-func (s *Store) AccountID() string {
+// Accounts returns the names of the stored accounts, sorted.
+func (s *Store) Accounts() []string {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if s.cred == nil {
+	names := make([]string, 0, len(s.accounts))
+	for name := range s.accounts {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Default returns the name of the default account, or "" if there are no
+// accounts.
+func (s *Store) Default() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.accounts[s.def] == nil {
 		return ""
 	}
-	return s.cred.AccountID
+	return s.def
+}
+
+// SetDefault makes the named account the default.
+func (s *Store) SetDefault(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.accounts[name] == nil {
+		return fmt.Errorf("%w: %q", ErrNoAccount, name)
+	}
+	s.def = name
+	return s.save()
+}
+
+// Remove deletes the named account's credentials. If it was the default,
+// the first remaining account in name order becomes the default.
+func (s *Store) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.accounts[name] == nil {
+		return fmt.Errorf("%w: %q", ErrNoAccount, name)
+	}
+	delete(s.accounts, name)
+	if s.def == name {
+		s.def = ""
+		for other := range s.accounts {
+			if s.def == "" || other < s.def {
+				s.def = other
+			}
+		}
+	}
+	return s.save()
+}
+
+// Account returns a Provider for the named account's credentials, which
+// are refreshed and saved like the default account's.
+func (s *Store) Account(name string) (*Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.accounts[name] == nil {
+		return nil, fmt.Errorf("%w: %q", ErrNoAccount, name)
+	}
+	return &Account{s: s, name: name}, nil
+}
+
+// IsAPIKey returns false: a Store holds OAuth tokens.
+func (s *Store) IsAPIKey() bool { return false }
+
+// AccountID returns the ChatGPT account ID, or empty string if not available.
+func (s *Store) AccountID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accountID(s.def)
+}
+
+// ExpiresAt returns when the current access token expires, or the zero
+// time if there are no credentials. Expired tokens are refreshed on use.
+func (s *Store) ExpiresAt() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.expiresAt(s.def)
 }
 
 // AccessToken returns a valid access token, refreshing automatically if
@@ -85,29 +198,93 @@ func (s *Store) AccountID() string {
 func (s *Store) AccessToken(ctx context.Context) (string, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.accessToken(s.def)
+}
+
+// accountID, expiresAt and accessToken are the Provider methods of the
+// named account; s.mu must be held.
+func (s *Store) accountID(name string) string {
+	if cred := s.accounts[name]; cred != nil {
+		return cred.AccountID
+	}
+	return ""
+}
+
+func (s *Store) expiresAt(name string) time.Time {
+	if cred := s.accounts[name]; cred != nil {
+		return time.Unix(cred.ExpiresAt, 0)
+	}
+	return time.Time{}
+}
 
-	if s.cred == nil {
-		return "", fmt.Errorf("no credentials stored; authenticate first")
+func (s *Store) accessToken(name string) (string, error) {
+	cred := s.accounts[name]
+	if cred == nil {
+		if name == "" || name == s.def {
+			return "", fmt.Errorf("no credentials stored; authenticate first")
+		}
+		return "", fmt.Errorf("%w: %q", ErrNoAccount, name)
 	}
 
-	if !s.cred.IsExpired() {
-		return s.cred.AccessToken, nil
+	if !cred.IsExpired() {
+		return cred.AccessToken, nil
 	}
 
-	tokenResp, err := oauth.RefreshToken(s.cred.RefreshToken)
+	tokenResp, err := oauth.RefreshToken(cred.RefreshToken)
 	if err != nil {
 		return "", fmt.Errorf("refreshing token: %w", err)
 	}
 
-	s.cred.AccessToken = tokenResp.AccessToken
+	cred.AccessToken = tokenResp.AccessToken
 	if tokenResp.RefreshToken != "" {
-		s.cred.RefreshToken = tokenResp.RefreshToken
+		cred.RefreshToken = tokenResp.RefreshToken
 	}
-	s.cred.ExpiresAt = time.Now().Unix() + int64(tokenResp.ExpiresIn)
+	cred.ExpiresAt = time.Now().Unix() + int64(tokenResp.ExpiresIn)
 
 	if err := s.save(); err != nil {
 		return "", fmt.Errorf("saving refreshed token: %w", err)
 	}
 
-	return s.cred.AccessToken, nil
+	return cred.AccessToken, nil
 }
+
+// Account is one named account in a Store.
+type Account struct {
+	s    *Store
+	name string
+}
+
+// Name returns the account's name.
+func (a *Account) Name() string { return a.name }
+
+// AccessToken returns a valid access token for the account, refreshing it
+// if it has expired.
+func (a *Account) AccessToken(ctx context.Context) (string, error) {
+	a.s.mu.Lock()
+	defer a.s.mu.Unlock()
+	return a.s.accessToken(a.name)
+}
+
+// AccountID returns the account's ChatGPT account ID.
+func (a *Account) AccountID() string {
+	a.s.mu.Lock()
+	defer a.s.mu.Unlock()
+	return a.s.accountID(a.name)
+}
+
+// HasCredentials reports whether the account is still stored.
+func (a *Account) HasCredentials() bool {
+	a.s.mu.Lock()
+	defer a.s.mu.Unlock()
+	return a.s.accounts[a.name] != nil
+}
+
+// ExpiresAt returns when the account's access token expires.
+func (a *Account) ExpiresAt() time.Time {
+	a.s.mu.Lock()
+	defer a.s.mu.Unlock()
+	return a.s.expiresAt(a.name)
+}
+
+// IsAPIKey returns false: accounts hold OAuth tokens.
+func (a *Account) IsAPIKey() bool { return false }
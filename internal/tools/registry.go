@@ -0,0 +1,136 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Tool is a function the model can call during a conversation.
+type Tool interface {
+	// Name is the function name exposed to the model.
+	Name() string
+	// Description tells the model when to use the tool.
+	Description() string
+	// Parameters is the JSON schema of the arguments object.
+	Parameters() json.RawMessage
+	// Call runs the tool with the model-supplied arguments and returns
+	// the text result fed back to the model.
+	Call(ctx context.Context, args json.RawMessage) (string, error)
+}
+
+// Func is the signature of a tool implementation.
+type Func func(ctx context.Context, args json.RawMessage) (string, error)
+
+type funcTool struct {
+	name        string
+	description string
+	parameters  json.RawMessage
+	fn          Func
+}
+
+func (t *funcTool) Name() string                { return t.name }
+func (t *funcTool) Description() string         { return t.description }
+func (t *funcTool) Parameters() json.RawMessage { return t.parameters }
+func (t *funcTool) Call(ctx context.Context, args json.RawMessage) (string, error) {
+	return t.fn(ctx, args)
+}
+
+// New returns a Tool backed by fn. The parameters string must be a JSON
+// schema object.
+func New(name, description, parameters string, fn Func) Tool {
+	return &funcTool{
+		name:        name,
+		description: description,
+		parameters:  json.RawMessage(parameters),
+		fn:          fn,
+	}
+}
+
+// NoParams is the parameter schema for tools that take no arguments.
+const NoParams = `{"type":"object","properties":{}}`
+
+// Registry holds the set of tools available to the model.
+type Registry struct {
+	mu    sync.RWMutex
+	tools map[string]Tool
+}
+
+// NewRegistry creates an empty tool registry.
+func NewRegistry() *Registry {
+	return &Registry{tools: make(map[string]Tool)}
+}
+
+// Register adds tools to the registry, replacing any with the same name.
+func (r *Registry) Register(tools ...Tool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range tools {
+		r.tools[t.Name()] = t
+	}
+}
+
+// Tools returns all registered tools sorted by name.
+func (r *Registry) Tools() []Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]Tool, 0, len(r.tools))
+	for _, t := range r.tools {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name() < out[j].Name() })
+	return out
+}
+
+// Call runs the named tool.
+func (r *Registry) Call(ctx context.Context, name string, args json.RawMessage) (string, error) {
+	r.mu.RLock()
+	t, ok := r.tools[name]
+	r.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("unknown tool %q", name)
+	}
+	return t.Call(ctx, args)
+}
+
+// Decode unmarshals tool arguments into v, treating empty arguments as an
+// empty object.
+func Decode(args json.RawMessage, v any) error {
+	if len(args) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(args, v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+type conversationKey struct{}
+
+// WithConversation returns a context carrying the ID of the conversation a
+// tool call belongs to.
+func WithConversation(ctx context.Context, conversationID string) context.Context {
+	return context.WithValue(ctx, conversationKey{}, conversationID)
+}
+
+// ConversationID returns the conversation a tool call belongs to, or empty
+// if unknown.
+func ConversationID(ctx context.Context) string {
+	id, _ := ctx.Value(conversationKey{}).(string)
+	return id
+}
+
+type userKey struct{}
+
+// WithUser returns a context carrying the user a tool call is made for.
+func WithUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// User returns the user a tool call is made for, or empty if unknown.
+func User(ctx context.Context) string {
+	u, _ := ctx.Value(userKey{}).(string)
+	return u
+}
@@ -0,0 +1,107 @@
+// Package tunnel keeps an SSH reverse tunnel open from a server with a
+// public address to the agent, for remote access without forwarding a
+// port.
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"pi-agent/internal/config"
+)
+
+// How long to wait before restarting ssh after it exits, doubling up to
+// the maximum while it keeps failing.
+const (
+	minBackoff = 5 * time.Second
+	maxBackoff = 5 * time.Minute
+)
+
+// Tunnel runs ssh with a remote forward to the agent's listen address.
+type Tunnel struct {
+	cfg   config.Tunnel
+	local string // host:port forwarded to
+}
+
+// New creates a tunnel forwarding to addr, the agent's listen address.
+func New(cfg config.Tunnel, addr string) (*Tunnel, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("tunnel: %w", err)
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+	if cfg.RemotePort == 0 {
+		if cfg.RemotePort, err = strconv.Atoi(port); err != nil {
+			return nil, fmt.Errorf("tunnel: port %q: %w", port, err)
+		}
+	}
+	return &Tunnel{cfg: cfg, local: net.JoinHostPort(host, port)}, nil
+}
+
+// args returns the ssh arguments. ssh never prompts, keeps the connection
+// alive and exits if the forward fails, so that Run starts it again.
+func (t *Tunnel) args() []string {
+	args := []string{
+		"-N", "-T",
+		"-o", "BatchMode=yes",
+		"-o", "StrictHostKeyChecking=yes",
+		"-o", "ExitOnForwardFailure=yes",
+		"-o", "ServerAliveInterval=30",
+		"-o", "ServerAliveCountMax=3",
+		"-R", fmt.Sprintf("%d:%s", t.cfg.RemotePort, t.local),
+	}
+	if t.cfg.IdentityFile != "" {
+		args = append(args, "-i", t.cfg.IdentityFile, "-o", "IdentitiesOnly=yes")
+	}
+	if t.cfg.KnownHosts != "" {
+		args = append(args, "-o", "UserKnownHostsFile="+t.cfg.KnownHosts)
+	}
+	dest := t.cfg.SSH
+	if user, hostport, _ := strings.Cut(dest, "@"); strings.Contains(hostport, ":") {
+		if host, port, err := net.SplitHostPort(hostport); err == nil {
+			args = append(args, "-p", port)
+			dest = user + "@" + host
+		}
+	}
+	// "--" keeps a destination starting with "-" from being read as an
+	// option.
+	return append(args, "--", dest)
+}
+
+// Run keeps the tunnel open until ctx is done, restarting ssh whenever it
+// exits.
+func (t *Tunnel) Run(ctx context.Context) {
+	log.Printf("tunnel: forwarding port %d on %s to %s", t.cfg.RemotePort, t.cfg.SSH, t.local)
+	backoff := minBackoff
+	for ctx.Err() == nil {
+		started := time.Now()
+		cmd := exec.CommandContext(ctx, "ssh", t.args()...)
+		out, err := cmd.CombinedOutput()
+		if ctx.Err() != nil {
+			return
+		}
+		msg := strings.TrimSpace(string(out))
+		if err != nil && msg == "" {
+			msg = err.Error()
+		}
+		// A tunnel that stayed up for a while dropped rather than failed.
+		if time.Since(started) > maxBackoff {
+			backoff = minBackoff
+		}
+		log.Printf("tunnel to %s closed, retrying in %s: %s", t.cfg.SSH, backoff, msg)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
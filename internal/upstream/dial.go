@@ -0,0 +1,200 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// staleFor is how long an expired DNS answer may still be used when a
+// fresh lookup fails.
+const staleFor = time.Hour
+
+// IP family preferences for Options.IPFamily.
+const (
+	FamilyAuto       = ""            // IPv6 first, as the resolver orders them
+	FamilyPreferIPv4 = "prefer-ipv4" // IPv4 first, IPv6 as the fallback
+	FamilyIPv4       = "ipv4"        // IPv4 only
+	FamilyIPv6       = "ipv6"        // IPv6 only
+)
+
+// dnsCache remembers lookups so that a weak link does not pay for DNS on
+// every new connection, and keeps answering from stale entries while the
+// resolver is unreachable.
+type dnsCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*dnsEntry
+}
+
+type dnsEntry struct {
+	mu      sync.Mutex // held while the entry is being refreshed
+	ips     []net.IP
+	expires time.Time
+}
+
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]net.IP, error) {
+	c.mu.Lock()
+	e, ok := c.entries[host]
+	if !ok {
+		e = &dnsEntry{}
+		c.entries[host] = e
+	}
+	c.mu.Unlock()
+
+	// Concurrent dials to the same host wait for one lookup.
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := time.Now()
+	if e.ips != nil && now.Before(e.expires) {
+		return e.ips, nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err == nil && len(addrs) == 0 {
+		err = fmt.Errorf("no addresses for %s", host)
+	}
+	if err != nil {
+		if e.ips != nil && now.Before(e.expires.Add(staleFor)) {
+			return e.ips, nil
+		}
+		return nil, err
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, a := range addrs {
+		ips[i] = a.IP
+	}
+	e.ips, e.expires = ips, now.Add(c.ttl)
+	return ips, nil
+}
+
+// dialer connects to host names through the cache, racing the preferred
+// address family against the other one as in RFC 8305 ("happy
+// eyeballs"): the fallback starts after fallbackDelay or as soon as the
+// preferred addresses have all failed.
+type dialer struct {
+	net           *net.Dialer
+	cache         *dnsCache // nil disables caching
+	family        string
+	fallbackDelay time.Duration
+}
+
+func (d *dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return d.net.DialContext(ctx, network, addr)
+	}
+	if d.cache == nil && d.family == FamilyAuto {
+		return d.net.DialContext(ctx, network, addr)
+	}
+
+	var ips []net.IP
+	if d.cache != nil {
+		ips, err = d.cache.lookup(ctx, host)
+	} else {
+		var addrs []net.IPAddr
+		addrs, err = net.DefaultResolver.LookupIPAddr(ctx, host)
+		for _, a := range addrs {
+			ips = append(ips, a.IP)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	primary, fallback := d.split(ips)
+	if len(primary) == 0 {
+		primary, fallback = fallback, nil
+	}
+	if len(primary) == 0 {
+		return nil, fmt.Errorf("no %s addresses for %s", d.family, host)
+	}
+	return d.race(ctx, network, port, primary, fallback)
+}
+
+// split orders ips by the configured family preference.
+func (d *dialer) split(ips []net.IP) (primary, fallback []net.IP) {
+	var v4, v6 []net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+	switch d.family {
+	case FamilyIPv4:
+		return v4, nil
+	case FamilyIPv6:
+		return v6, nil
+	case FamilyPreferIPv4:
+		return v4, v6
+	default:
+		return v6, v4
+	}
+}
+
+func (d *dialer) race(ctx context.Context, network, port string, primary, fallback []net.IP) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result, 2)
+	serial := func(ips []net.IP) {
+		var errs []error
+		for _, ip := range ips {
+			conn, err := d.net.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				results <- result{conn: conn}
+				return
+			}
+			errs = append(errs, err)
+		}
+		results <- result{err: errors.Join(errs...)}
+	}
+
+	go serial(primary)
+	pending := 1
+	var timer <-chan time.Time
+	if len(fallback) > 0 {
+		timer = time.After(d.fallbackDelay)
+	}
+	var errs []error
+	for {
+		select {
+		case <-timer:
+			timer = nil
+			go serial(fallback)
+			pending++
+			continue
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				// Close a connection the other attempt may still make.
+				go func() {
+					for range pending {
+						if late := <-results; late.conn != nil {
+							late.conn.Close()
+						}
+					}
+				}()
+				return r.conn, nil
+			}
+			errs = append(errs, r.err)
+			if timer != nil {
+				timer = nil
+				go serial(fallback)
+				pending++
+				continue
+			}
+			if pending == 0 {
+				return nil, errors.Join(errs...)
+			}
+		}
+	}
+}
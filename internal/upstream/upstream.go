@@ -0,0 +1,162 @@
+// Package upstream provides the shared HTTP client for calls to the model
+// provider and its OAuth endpoints. It is tuned for Pis on slow or flaky
+// networks and can reach them through an HTTP or SOCKS5 proxy.
+package upstream
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Options tunes the shared client. Zero values use the defaults.
+type Options struct {
+	// ConnectTimeout bounds the TCP connect and TLS handshake (default 15s).
+	ConnectTimeout time.Duration
+	// ReadTimeout is how long a connection may go without receiving any
+	// data, which catches stalled streams without limiting how long a
+	// streamed reply may take overall (default 2m).
+	ReadTimeout time.Duration
+	// KeepAlive is the TCP keep-alive probe interval (default 30s).
+	KeepAlive time.Duration
+	// IdleTimeout is how long unused connections stay pooled (default
+	// 90s). Connections are reused across requests, saving a TLS
+	// handshake, which takes seconds on a weak link.
+	IdleTimeout time.Duration
+	// DisableHTTP2 forces HTTP/1.1, for proxies and middleboxes that
+	// mishandle HTTP/2 streams.
+	DisableHTTP2 bool
+	// DNSCacheTTL is how long name lookups are cached (default 5m;
+	// negative disables the cache).
+	DNSCacheTTL time.Duration
+	// IPFamily is one of the Family constants.
+	IPFamily string
+	// FallbackDelay is how long to wait on the preferred address family
+	// before also trying the other one (default 300ms).
+	FallbackDelay time.Duration
+	// Proxy is an http://, https:// or socks5:// URL. When empty the
+	// HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables apply.
+	Proxy string
+}
+
+var (
+	mu     sync.RWMutex
+	client = mustNew(Options{})
+)
+
+// Configure replaces the shared client.
+func Configure(o Options) error {
+	c, err := New(o)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	client = c
+	mu.Unlock()
+	return nil
+}
+
+// Client returns the shared client.
+func Client() *http.Client {
+	mu.RLock()
+	defer mu.RUnlock()
+	return client
+}
+
+func mustNew(o Options) *http.Client {
+	c, err := New(o)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// New creates a client with the given options.
+func New(o Options) (*http.Client, error) {
+	if o.ConnectTimeout <= 0 {
+		o.ConnectTimeout = 15 * time.Second
+	}
+	if o.ReadTimeout <= 0 {
+		o.ReadTimeout = 2 * time.Minute
+	}
+	if o.KeepAlive <= 0 {
+		o.KeepAlive = 30 * time.Second
+	}
+	if o.IdleTimeout <= 0 {
+		o.IdleTimeout = 90 * time.Second
+	}
+	if o.DNSCacheTTL == 0 {
+		o.DNSCacheTTL = 5 * time.Minute
+	}
+	if o.FallbackDelay <= 0 {
+		o.FallbackDelay = 300 * time.Millisecond
+	}
+	switch o.IPFamily {
+	case FamilyAuto, FamilyPreferIPv4, FamilyIPv4, FamilyIPv6:
+	default:
+		return nil, fmt.Errorf("invalid IP family %q", o.IPFamily)
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if o.Proxy != "" {
+		u, err := url.Parse(o.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("invalid proxy URL %q: want http, https or socks5", o.Proxy)
+		}
+		proxy = http.ProxyURL(u)
+	}
+
+	d := &dialer{
+		net:           &net.Dialer{Timeout: o.ConnectTimeout, KeepAlive: o.KeepAlive, FallbackDelay: o.FallbackDelay},
+		family:        o.IPFamily,
+		fallbackDelay: o.FallbackDelay,
+	}
+	if o.DNSCacheTTL > 0 {
+		d.cache = &dnsCache{ttl: o.DNSCacheTTL, entries: make(map[string]*dnsEntry)}
+	}
+	t := &http.Transport{
+		Proxy: proxy,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := d.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return &idleConn{Conn: conn, timeout: o.ReadTimeout}, nil
+		},
+		TLSHandshakeTimeout:   o.ConnectTimeout,
+		ResponseHeaderTimeout: o.ReadTimeout,
+		ExpectContinueTimeout: time.Second,
+		IdleConnTimeout:       o.IdleTimeout,
+		MaxIdleConns:          16,
+		MaxIdleConnsPerHost:   4,
+		ForceAttemptHTTP2:     !o.DisableHTTP2,
+	}
+	if o.DisableHTTP2 {
+		// A non-nil empty map turns off the transport's HTTP/2 upgrade.
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return &http.Client{Transport: t}, nil
+}
+
+// idleConn fails reads after the connection has been silent for timeout.
+type idleConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *idleConn) Read(p []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(p)
+}
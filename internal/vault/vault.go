@@ -0,0 +1,239 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"pi-agent/internal/bookmarks"
+	"pi-agent/internal/store"
+)
+
+// Report summarizes an export run.
+type Report struct {
+	Written   int `json:"written"`
+	Unchanged int `json:"unchanged"`
+}
+
+// Exporter writes conversations, contacts and bookmarks as Markdown notes
+// with YAML frontmatter, laid out for an Obsidian vault:
+//
+//	Conversations/<id>.md
+//	People/<name>.md
+//	Bookmarks/<title> (<id>).md
+//
+// Files are only rewritten when their content changes, so sync tools see
+// no churn between runs.
+type Exporter struct {
+	db  *store.DB
+	dir string
+}
+
+// NewExporter creates an exporter writing into dir.
+func NewExporter(db *store.DB, dir string) *Exporter {
+	return &Exporter{db: db, dir: dir}
+}
+
+// Run exports every interval until ctx is cancelled.
+func (e *Exporter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := e.Export(); err != nil {
+			log.Printf("vault export error: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Export writes all notes once.
+func (e *Exporter) Export() (*Report, error) {
+	var r Report
+	convs, err := e.db.Conversations()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range convs {
+		// Vaults are synced and indexed by other tools, so private and
+		// encrypted conversations stay in the database, and a note
+		// exported before the conversation was made so is removed.
+		if c.Private || c.Encrypted {
+			if err := os.Remove(e.path("Conversations", c.ID)); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			continue
+		}
+		msgs, err := e.db.Messages(c.ID)
+		if err != nil {
+			return nil, err
+		}
+		if err := e.write(&r, "Conversations", c.ID, conversationNote(c, msgs)); err != nil {
+			return nil, err
+		}
+	}
+
+	contacts, err := e.db.Contacts()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range contacts {
+		if err := e.write(&r, "People", c.Name, contactNote(c)); err != nil {
+			return nil, err
+		}
+	}
+
+	docs, err := e.db.Documents(bookmarks.Kind)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range docs {
+		// Titles repeat across sites, so the ID keeps names unique.
+		name := fmt.Sprintf("%s (%d)", d.Title, d.ID)
+		if err := e.write(&r, "Bookmarks", name, bookmarkNote(d)); err != nil {
+			return nil, err
+		}
+	}
+	return &r, nil
+}
+
+var unsafeRe = regexp.MustCompile(`[\\/:*?"<>|#^\[\]\x00-\x1f]+`)
+
+// path returns the file of a note, named safely for any file system.
+func (e *Exporter) path(folder, name string) string {
+	name = strings.TrimSpace(unsafeRe.ReplaceAllString(name, "-"))
+	if len(name) > 100 {
+		name = name[:100]
+	}
+	if name == "" || strings.HasPrefix(name, ".") {
+		name = "untitled" + name
+	}
+	return filepath.Join(e.dir, folder, name+".md")
+}
+
+// write stores a note unless the file already has the same content.
+func (e *Exporter) write(r *Report, folder, name string, content []byte) error {
+	path := e.path(folder, name)
+	if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, content) {
+		r.Unchanged++
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// Write to a temporary file first so a sync tool never sees a
+	// half-written note.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".export-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	r.Written++
+	return nil
+}
+
+// frontmatter renders YAML frontmatter from ordered key/value pairs.
+// Values are written as quoted strings, lists, or verbatim when already
+// YAML scalars such as numbers.
+func frontmatter(pairs ...any) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	for i := 0; i+1 < len(pairs); i += 2 {
+		fmt.Fprintf(&b, "%s: ", pairs[i])
+		switch v := pairs[i+1].(type) {
+		case string:
+			b.WriteString(quote(v))
+		case []string:
+			b.WriteString("[")
+			for j, s := range v {
+				if j > 0 {
+					b.WriteString(", ")
+				}
+				b.WriteString(quote(s))
+			}
+			b.WriteString("]")
+		case time.Time:
+			b.WriteString(v.Local().Format(time.RFC3339))
+		default:
+			fmt.Fprint(&b, v)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("---\n\n")
+	return b.String()
+}
+
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+func conversationNote(c store.Conversation, msgs []store.Message) []byte {
+	var b strings.Builder
+	b.WriteString(frontmatter(
+		"conversation_id", c.ID,
+		"created", c.FirstAt,
+		"updated", c.LastMessageAt,
+		"messages", c.Messages,
+		"tags", []string{"pi-agent", "conversation"},
+	))
+	fmt.Fprintf(&b, "# %s\n", c.ID)
+	for _, m := range msgs {
+		heading := map[store.Role]string{store.RoleUser: "You", store.RoleAssistant: "Assistant", store.RoleSystem: "Summary"}[m.Role]
+		fmt.Fprintf(&b, "\n## %s · %s\n\n%s\n", heading, m.CreatedAt.Local().Format("2006-01-02 15:04"), strings.TrimSpace(m.Content))
+	}
+	return []byte(b.String())
+}
+
+func contactNote(c store.Contact) []byte {
+	var b strings.Builder
+	b.WriteString(frontmatter(
+		"aliases", c.Nicknames,
+		"relationship", c.Relationship,
+		"pronunciation", c.Pronunciation,
+		"tags", []string{"pi-agent", "person"},
+	))
+	fmt.Fprintf(&b, "# %s\n", c.Name)
+	if c.Notes != "" {
+		fmt.Fprintf(&b, "\n%s\n", c.Notes)
+	}
+	return []byte(b.String())
+}
+
+func bookmarkNote(d store.Document) []byte {
+	var b strings.Builder
+	b.WriteString(frontmatter(
+		"url", d.Source,
+		"saved", d.CreatedAt,
+		"tags", []string{"pi-agent", "bookmark"},
+	))
+	fmt.Fprintf(&b, "# [%s](%s)\n", d.Title, d.Source)
+	if d.Note != "" {
+		fmt.Fprintf(&b, "\n%s\n", d.Note)
+	}
+	return []byte(b.String())
+}
@@ -0,0 +1,211 @@
+// Package watchdog feeds the hardware watchdog (/dev/watchdog) while the
+// agent is healthy. Once the device is open the board reboots unless it
+// is written to within the timeout, so a hung agent on a headless Pi
+// recovers by itself: the watchdog keeps feeding only while every check,
+// such as a database write or an HTTP request to the server, keeps
+// passing, and stops when one has been failing or stuck for too long.
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// DefaultTimeout is the hardware timeout asked for; 15 seconds is the
+// most the Raspberry Pi's watchdog supports.
+const DefaultTimeout = 15 * time.Second
+
+// DefaultStall is how long a check may go without passing before feeding
+// stops.
+const DefaultStall = 2 * time.Minute
+
+// ioctls from linux/watchdog.h.
+const (
+	wdiocSetTimeout = 0xc0045706
+	wdiocGetTimeout = 0x80045707
+)
+
+// Check reports whether part of the agent is working. A check that does
+// not return counts as failing.
+type Check func(ctx context.Context) error
+
+type check struct {
+	name string
+	fn   Check
+
+	mu      sync.Mutex
+	running bool
+	lastOK  time.Time
+	err     error
+}
+
+// Watchdog feeds an open watchdog device.
+type Watchdog struct {
+	device  string
+	f       *os.File
+	timeout time.Duration
+	stall   time.Duration
+	checks  []*check
+}
+
+// Open opens and so arms a watchdog device, asking for the given
+// timeout. Checks failing for longer than stall stop the feeding.
+func Open(device string, timeout, stall time.Duration) (*Watchdog, error) {
+	f, err := os.OpenFile(device, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("opening watchdog: %w", err)
+	}
+	w := &Watchdog{device: device, f: f, timeout: timeout, stall: stall}
+	// Not every driver supports every timeout; use the one in effect.
+	secs := int32(timeout / time.Second)
+	if err := ioctl(f, wdiocSetTimeout, &secs); err != nil {
+		if err := ioctl(f, wdiocGetTimeout, &secs); err != nil {
+			log.Printf("watchdog: cannot read the timeout of %s, assuming %s: %v", device, timeout, err)
+			secs = int32(timeout / time.Second)
+		}
+	}
+	if secs > 0 {
+		w.timeout = time.Duration(secs) * time.Second
+	}
+	return w, nil
+}
+
+func ioctl(f *os.File, req uintptr, arg *int32) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, uintptr(unsafe.Pointer(arg))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Add registers a check. Checks must be added before Run.
+func (w *Watchdog) Add(name string, fn Check) {
+	w.checks = append(w.checks, &check{name: name, fn: fn, lastOK: time.Now()})
+}
+
+// Run feeds the watchdog three times per timeout while the checks pass.
+// When ctx is done it disarms the watchdog and closes the device, so a
+// deliberate shutdown does not reboot the board.
+func (w *Watchdog) Run(ctx context.Context) error {
+	interval := w.timeout / 3
+	log.Printf("watchdog: feeding %s every %s (timeout %s)", w.device, interval, w.timeout)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	healthy := true
+	for {
+		if err := w.healthy(); err != nil {
+			if healthy {
+				log.Printf("watchdog: %v; no longer feeding %s, the board resets in %s", err, w.device, w.timeout)
+			}
+			healthy = false
+		} else {
+			if !healthy {
+				log.Printf("watchdog: checks pass again; feeding %s", w.device)
+			}
+			healthy = true
+			if _, err := w.f.Write([]byte{0}); err != nil {
+				return fmt.Errorf("feeding watchdog: %w", err)
+			}
+		}
+		w.start(ctx)
+		select {
+		case <-ctx.Done():
+			return w.disarm()
+		case <-ticker.C:
+		}
+	}
+}
+
+// start runs the checks that are not still running from a previous tick.
+func (w *Watchdog) start(ctx context.Context) {
+	for _, c := range w.checks {
+		c.mu.Lock()
+		if c.running {
+			c.mu.Unlock()
+			continue
+		}
+		c.running = true
+		c.mu.Unlock()
+		go func() {
+			ctx, cancel := context.WithTimeout(ctx, w.stall)
+			defer cancel()
+			err := c.fn(ctx)
+			c.mu.Lock()
+			c.running = false
+			if c.err = err; err == nil {
+				c.lastOK = time.Now()
+			}
+			c.mu.Unlock()
+		}()
+	}
+}
+
+// healthy returns an error naming a check that has not passed within the
+// stall period.
+func (w *Watchdog) healthy() error {
+	for _, c := range w.checks {
+		c.mu.Lock()
+		since, err, running := time.Since(c.lastOK), c.err, c.running
+		c.mu.Unlock()
+		if since <= w.stall {
+			continue
+		}
+		if err == nil && running {
+			err = errors.New("stuck")
+		}
+		return fmt.Errorf("%s has not passed for %s: %v", c.name, since.Round(time.Second), err)
+	}
+	return nil
+}
+
+// disarm writes the magic character that stops the watchdog on close.
+// Drivers built with nowayout ignore it and reset the board anyway.
+func (w *Watchdog) disarm() error {
+	_, err := w.f.Write([]byte("V"))
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("disarming watchdog: %w", err)
+	}
+	log.Printf("watchdog: disarmed %s", w.device)
+	return nil
+}
+
+// HTTP returns a check requesting url. Any response passes, including
+// refusals by the allowlist or login: the server is answering.
+func HTTP(url string) Check {
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+}
+
+// ListenURL returns the URL of path on a server listening on addr, as
+// given to -addr, to reach it from the same machine.
+func ListenURL(addr, path string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port) + path, nil
+}
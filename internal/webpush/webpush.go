@@ -0,0 +1,331 @@
+// Package webpush delivers notifications to browsers and phones with the
+// Web Push protocol: messages are encrypted for each subscription
+// (RFC 8291) and sent to its push service, authenticated with a VAPID key
+// (RFC 8292), so they arrive even when no tab is open.
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"pi-agent/internal/notify"
+	"pi-agent/internal/store"
+)
+
+// ttl is how long a push service keeps a message for a device that is
+// offline.
+const ttl = 24 * time.Hour
+
+// maxPayload is the largest plaintext that fits the 4096 bytes every push
+// service accepts, after the record header, padding delimiter and tag.
+const maxPayload = 4096 - 16 - 1 - 86
+
+var b64 = base64.RawURLEncoding
+
+// Sender sends notifications to every saved push subscription. It
+// implements notify.Notifier.
+type Sender struct {
+	db      *store.DB
+	key     *ecdsa.PrivateKey
+	subject string // VAPID contact, mailto: or https:
+	client  *http.Client
+}
+
+// NewSender returns a sender signing with key. The subject is a mailto:
+// or https: URL push services can use to contact the operator.
+func NewSender(db *store.DB, key *ecdsa.PrivateKey, subject string) (*Sender, error) {
+	if !strings.HasPrefix(subject, "mailto:") && !strings.HasPrefix(subject, "https://") {
+		return nil, fmt.Errorf("VAPID subject %q must be a mailto: or https: URL", subject)
+	}
+	return &Sender{db: db, key: key, subject: subject, client: &http.Client{Timeout: 15 * time.Second}}, nil
+}
+
+// LoadKey reads the VAPID key from a PEM file, creating one if the file
+// does not exist.
+func LoadKey(path string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM key", path)
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if key.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("%s: VAPID keys must be P-256", path)
+	}
+	return key, nil
+}
+
+// PublicKey returns the VAPID public key as browsers take it for
+// PushManager.subscribe's applicationServerKey: the uncompressed point,
+// base64url-encoded.
+func (s *Sender) PublicKey() string {
+	pub, _ := s.key.PublicKey.ECDH()
+	return b64.EncodeToString(pub.Bytes())
+}
+
+// Subscribe saves a subscription after checking its endpoint and keys.
+func (s *Sender) Subscribe(sub *store.PushSubscription) error {
+	u, err := url.Parse(sub.Endpoint)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return errors.New("endpoint must be an https URL")
+	}
+	if _, err := subscriberKey(sub.P256DH); err != nil {
+		return err
+	}
+	if auth, err := b64.DecodeString(strings.TrimRight(sub.Auth, "=")); err != nil || len(auth) != 16 {
+		return errors.New("keys.auth must be a 16-byte base64url secret")
+	}
+	return s.db.AddPushSubscription(sub)
+}
+
+// payload is the JSON a service worker receives in its push event.
+type payload struct {
+	Title    string   `json:"title"`
+	Body     string   `json:"body"`
+	Priority int      `json:"priority,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+// Notify sends msg to the subscriptions of its user, and to those not
+// tied to a user. Subscriptions the push service reports gone are
+// deleted.
+func (s *Sender) Notify(ctx context.Context, msg notify.Message) error {
+	subs, err := s.db.PushSubscriptions()
+	if err != nil {
+		return err
+	}
+	body := payload{Title: msg.Title, Body: msg.Body, Priority: int(msg.Priority), Tags: msg.Tags}.encode()
+	var errs []error
+	for _, sub := range subs {
+		if sub.User != "" && msg.User != "" && !strings.EqualFold(sub.User, msg.User) {
+			continue
+		}
+		gone, err := s.send(ctx, sub, body, urgency(msg.Priority))
+		if gone {
+			log.Printf("webpush: subscription %s is gone, deleting it", sub.Endpoint)
+			if err := s.db.DeletePushSubscription(sub.Endpoint); err != nil {
+				log.Printf("webpush: %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// encode marshals the payload, cutting the body down to fit a push
+// message; the full text is in the conversation.
+func (p payload) encode() []byte {
+	body, _ := json.Marshal(p)
+	full, n := p.Body, len(p.Body)
+	for len(body) > maxPayload && n > 0 {
+		n = max(0, n*maxPayload/len(body)-len("…"))
+		for n > 0 && !utf8.RuneStart(full[n]) {
+			n--
+		}
+		p.Body = full[:n] + "…"
+		body, _ = json.Marshal(p)
+	}
+	return body
+}
+
+// urgency maps a priority to the Urgency header push services use to
+// decide whether to wake a device.
+func urgency(p notify.Priority) string {
+	switch {
+	case p == 0:
+		return "normal"
+	case p <= notify.PriorityLow:
+		return "low"
+	case p >= notify.PriorityHigh:
+		return "high"
+	}
+	return "normal"
+}
+
+// send delivers one encrypted message. It reports gone when the push
+// service no longer knows the subscription.
+func (s *Sender) send(ctx context.Context, sub store.PushSubscription, body []byte, urgency string) (gone bool, err error) {
+	uaPublic, err := subscriberKey(sub.P256DH)
+	if err != nil {
+		return false, err
+	}
+	auth, err := b64.DecodeString(strings.TrimRight(sub.Auth, "="))
+	if err != nil {
+		return false, fmt.Errorf("subscription auth secret: %w", err)
+	}
+	record, err := encrypt(body, uaPublic, auth)
+	if err != nil {
+		return false, err
+	}
+	u, err := url.Parse(sub.Endpoint)
+	if err != nil {
+		return false, err
+	}
+	token, err := s.vapidToken(u.Scheme + "://" + u.Host)
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", sub.Endpoint, bytes.NewReader(record))
+	if err != nil {
+		return false, fmt.Errorf("creating push request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(ttl/time.Second)))
+	req.Header.Set("Urgency", urgency)
+	req.Header.Set("Authorization", "vapid t="+token+", k="+s.PublicKey())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("push request to %s: %w", u.Host, err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return true, nil
+	case resp.StatusCode/100 != 2:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return false, fmt.Errorf("push service %s error %d: %s", u.Host, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return false, nil
+}
+
+// vapidToken signs the ES256 JWT identifying the sender to a push service.
+func (s *Sender) vapidToken(audience string) (string, error) {
+	header := b64.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, _ := json.Marshal(map[string]any{
+		"aud": audience,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": s.subject,
+	})
+	signed := header + "." + b64.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	r, sig, err := ecdsa.Sign(rand.Reader, s.key, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("signing VAPID token: %w", err)
+	}
+	raw := make([]byte, 64)
+	r.FillBytes(raw[:32])
+	sig.FillBytes(raw[32:])
+	return signed + "." + b64.EncodeToString(raw), nil
+}
+
+func subscriberKey(p256dh string) (*ecdh.PublicKey, error) {
+	raw, err := b64.DecodeString(strings.TrimRight(p256dh, "="))
+	if err != nil {
+		return nil, errors.New("keys.p256dh must be base64url")
+	}
+	key, err := ecdh.P256().NewPublicKey(raw)
+	if err != nil {
+		return nil, errors.New("keys.p256dh is not a P-256 public key")
+	}
+	return key, nil
+}
+
+// encrypt builds a single aes128gcm record for a subscriber (RFC 8291).
+func encrypt(plaintext []byte, uaPublic *ecdh.PublicKey, authSecret []byte) ([]byte, error) {
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	return encryptWith(plaintext, uaPublic, authSecret, asPrivate, salt)
+}
+
+// encryptWith is encrypt with the sender's ephemeral key and the salt
+// given.
+func encryptWith(plaintext []byte, uaPublic *ecdh.PublicKey, authSecret []byte, asPrivate *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	secret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+
+	prkKey, err := hkdf.Extract(sha256.New, secret, authSecret)
+	if err != nil {
+		return nil, err
+	}
+	keyInfo := "WebPush: info\x00" + string(uaPublic.Bytes()) + string(asPublic)
+	ikm, err := hkdf.Expand(sha256.New, prkKey, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// The header: salt, record size, and the sender's public key as the
+	// key ID. The plaintext ends with the last-record delimiter.
+	out := make([]byte, 0, 16+4+1+len(asPublic)+len(plaintext)+1+gcm.Overhead())
+	out = append(out, salt...)
+	out = binary.BigEndian.AppendUint32(out, 4096)
+	out = append(out, byte(len(asPublic)))
+	out = append(out, asPublic...)
+	padded := append(append(make([]byte, 0, len(plaintext)+1), plaintext...), 0x02)
+	return gcm.Seal(out, nonce, padded, nil), nil
+}
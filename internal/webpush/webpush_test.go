@@ -0,0 +1,419 @@
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"pi-agent/internal/notify"
+	"pi-agent/internal/store"
+)
+
+func decode(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := b64.DecodeString(s)
+	if err != nil {
+		t.Fatalf("decoding %q: %v", s, err)
+	}
+	return b
+}
+
+// TestEncryptRFC8291 checks encryption against the example in RFC 8291,
+// section 5.
+func TestEncryptRFC8291(t *testing.T) {
+	plaintext := []byte("When I grow up, I want to be a watermelon")
+	asPrivate, err := ecdh.P256().NewPrivateKey(decode(t, "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := asPrivate.PublicKey().Bytes(), decode(t, "BP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A8"); !bytes.Equal(got, want) {
+		t.Fatalf("application server public key = %x, want %x", got, want)
+	}
+	uaPrivate, err := ecdh.P256().NewPrivateKey(decode(t, "q1dXpw3UpT5VOmu_cf_v6ih07Aems3njxI-JWgLcM94"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	uaPublic, err := subscriberKey("BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !uaPublic.Equal(uaPrivate.PublicKey()) {
+		t.Fatal("user agent key pair does not match")
+	}
+	auth := decode(t, "BTBZMqHH6r4Tts7J_aSIgg")
+	salt := decode(t, "DGv6ra1nlYgDCS1FRnbzlw")
+
+	got, err := encryptWith(plaintext, uaPublic, auth, asPrivate, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := decode(t, "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN")
+	if !bytes.Equal(got, want) {
+		t.Errorf("record\n%x\nwant\n%x", got, want)
+	}
+	if dec, err := decrypt(got, uaPrivate, auth); err != nil || !bytes.Equal(dec, plaintext) {
+		t.Errorf("decrypt = %q, %v", dec, err)
+	}
+}
+
+// decrypt opens an aes128gcm record as the user agent does.
+func decrypt(record []byte, uaPrivate *ecdh.PrivateKey, auth []byte) ([]byte, error) {
+	if len(record) < 21 || len(record) < 21+int(record[20]) {
+		return nil, errors.New("short header")
+	}
+	salt, rs, idlen := record[:16], binary.BigEndian.Uint32(record[16:20]), int(record[20])
+	if rs != 4096 {
+		return nil, errors.New("unexpected record size")
+	}
+	asPublic, err := ecdh.P256().NewPublicKey(record[21 : 21+idlen])
+	if err != nil {
+		return nil, err
+	}
+	secret, err := uaPrivate.ECDH(asPublic)
+	if err != nil {
+		return nil, err
+	}
+	prkKey, _ := hkdf.Extract(sha256.New, secret, auth)
+	ikm, _ := hkdf.Expand(sha256.New, prkKey, "WebPush: info\x00"+string(uaPrivate.PublicKey().Bytes())+string(asPublic.Bytes()), 32)
+	prk, _ := hkdf.Extract(sha256.New, ikm, salt)
+	cek, _ := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	nonce, _ := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	padded, err := gcm.Open(nil, nonce, record[21+idlen:], nil)
+	if err != nil {
+		return nil, err
+	}
+	padded = bytes.TrimRight(padded, "\x00")
+	if len(padded) == 0 || padded[len(padded)-1] != 0x02 {
+		return nil, errors.New("missing last-record delimiter")
+	}
+	return padded[:len(padded)-1], nil
+}
+
+func TestEncryptRandomized(t *testing.T) {
+	uaPrivate, _ := ecdh.P256().GenerateKey(rand.Reader)
+	auth := make([]byte, 16)
+	rand.Read(auth)
+	msg := bytes.Repeat([]byte("x"), maxPayload)
+	a, err := encrypt(msg, uaPrivate.PublicKey(), auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := encrypt(msg, uaPrivate.PublicKey(), auth)
+	if bytes.Equal(a[:16], b[:16]) || bytes.Equal(a[21:86], b[21:86]) {
+		t.Error("salt or sender key reused between messages")
+	}
+	if len(a) > 4096 {
+		t.Errorf("record of the largest payload is %d bytes, over 4096", len(a))
+	}
+	if dec, err := decrypt(a, uaPrivate, auth); err != nil || !bytes.Equal(dec, msg) {
+		t.Errorf("round trip failed: %v", err)
+	}
+	auth[0] ^= 1
+	if _, err := decrypt(a, uaPrivate, auth); err == nil {
+		t.Error("decrypted with the wrong auth secret")
+	}
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// TestVAPIDToken checks the JWT of RFC 8292, section 2.
+func TestVAPIDToken(t *testing.T) {
+	key := newKey(t)
+	s, err := NewSender(nil, key, "mailto:ops@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.vapidToken("https://push.example.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("token %q has %d parts", token, len(parts))
+	}
+	var header map[string]string
+	if err := json.Unmarshal(decode(t, parts[0]), &header); err != nil || header["alg"] != "ES256" || header["typ"] != "JWT" {
+		t.Errorf("header %s", decode(t, parts[0]))
+	}
+	var claims struct {
+		Aud string `json:"aud"`
+		Exp int64  `json:"exp"`
+		Sub string `json:"sub"`
+	}
+	if err := json.Unmarshal(decode(t, parts[1]), &claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Aud != "https://push.example.net" || claims.Sub != "mailto:ops@example.com" {
+		t.Errorf("claims %+v", claims)
+	}
+	// Push services reject tokens valid for more than 24 hours.
+	if exp := time.Unix(claims.Exp, 0); exp.Before(time.Now()) || exp.After(time.Now().Add(24*time.Hour)) {
+		t.Errorf("exp %v is not within the next 24 hours", exp)
+	}
+	sig := decode(t, parts[2])
+	if len(sig) != 64 {
+		t.Fatalf("signature is %d bytes, want 64 (r || s)", len(sig))
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !ecdsa.Verify(&key.PublicKey, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		t.Error("signature does not verify")
+	}
+
+	// k= is the uncompressed public key.
+	pub := decode(t, s.PublicKey())
+	if len(pub) != 65 || pub[0] != 0x04 {
+		t.Errorf("public key %x is not an uncompressed P-256 point", pub)
+	}
+}
+
+func TestNewSenderSubject(t *testing.T) {
+	for subject, ok := range map[string]bool{
+		"mailto:ops@example.com":    true,
+		"https://example.com/about": true,
+		"http://example.com":        false,
+		"ops@example.com":           false,
+		"":                          false,
+	} {
+		if _, err := NewSender(nil, newKey(t), subject); (err == nil) != ok {
+			t.Errorf("NewSender(%q): err = %v", subject, err)
+		}
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vapid.pem")
+	key, err := LoadKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := LoadKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Equal(again) {
+		t.Error("the saved key was not loaded back")
+	}
+	bad := filepath.Join(t.TempDir(), "bad.pem")
+	writeFile(t, bad, "not a key")
+	if _, err := LoadKey(bad); err == nil {
+		t.Error("loaded a file without a PEM key")
+	}
+}
+
+func TestPayloadEncode(t *testing.T) {
+	short := payload{Title: "Hi", Body: "Short"}.encode()
+	if string(short) != `{"title":"Hi","body":"Short"}` {
+		t.Errorf("short payload %s", short)
+	}
+	for _, body := range []string{strings.Repeat("a", 10000), strings.Repeat("€", 3000), strings.Repeat("\"", 3000)} {
+		enc := payload{Title: "Long", Body: body, Tags: []string{"x"}}.encode()
+		if len(enc) > maxPayload {
+			t.Errorf("payload of %d bytes, over %d", len(enc), maxPayload)
+		}
+		var p payload
+		if err := json.Unmarshal(enc, &p); err != nil {
+			t.Fatal(err)
+		}
+		if !utf8.ValidString(p.Body) || !strings.HasSuffix(p.Body, "…") || !strings.HasPrefix(body, strings.TrimSuffix(p.Body, "…")) {
+			t.Errorf("cut body %.40q…", p.Body)
+		}
+		if len(enc) < maxPayload-64 {
+			t.Errorf("payload cut to %d bytes, far below %d", len(enc), maxPayload)
+		}
+	}
+}
+
+func TestUrgency(t *testing.T) {
+	for p, want := range map[notify.Priority]string{
+		0:                      "normal",
+		1:                      "low",
+		notify.PriorityLow:     "low",
+		notify.PriorityDefault: "normal",
+		notify.PriorityHigh:    "high",
+		notify.PriorityUrgent:  "high",
+	} {
+		if got := urgency(p); got != want {
+			t.Errorf("urgency(%d) = %s, want %s", p, got, want)
+		}
+	}
+}
+
+// subscriber is a browser's subscription: its keys, and what its push
+// service received.
+type subscriber struct {
+	private *ecdh.PrivateKey
+	auth    []byte
+	sub     store.PushSubscription
+}
+
+func newSubscriber(t *testing.T, endpoint, user string) *subscriber {
+	priv, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := make([]byte, 16)
+	rand.Read(auth)
+	return &subscriber{priv, auth, store.PushSubscription{
+		Endpoint: endpoint,
+		P256DH:   b64.EncodeToString(priv.PublicKey().Bytes()),
+		Auth:     b64.EncodeToString(auth),
+		User:     user,
+	}}
+}
+
+func TestSubscribeValidation(t *testing.T) {
+	db, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s, _ := NewSender(db, newKey(t), "mailto:ops@example.com")
+	good := newSubscriber(t, "https://push.example.net/abc", "").sub
+
+	tests := []struct {
+		name string
+		edit func(*store.PushSubscription)
+		want string
+	}{
+		{"valid", func(*store.PushSubscription) {}, ""},
+		{"padded keys", func(s *store.PushSubscription) { s.Auth += "==" }, ""},
+		{"http endpoint", func(s *store.PushSubscription) { s.Endpoint = "http://push.example.net/abc" }, "endpoint must be an https URL"},
+		{"no host", func(s *store.PushSubscription) { s.Endpoint = "https:///abc" }, "endpoint must be an https URL"},
+		{"bad p256dh encoding", func(s *store.PushSubscription) { s.P256DH = "not base64!" }, "keys.p256dh must be base64url"},
+		{"p256dh not a point", func(s *store.PushSubscription) { s.P256DH = b64.EncodeToString(make([]byte, 65)) }, "keys.p256dh is not a P-256 public key"},
+		{"short auth", func(s *store.PushSubscription) { s.Auth = b64.EncodeToString(make([]byte, 8)) }, "keys.auth must be a 16-byte base64url secret"},
+	}
+	for _, tt := range tests {
+		sub := good
+		tt.edit(&sub)
+		got := ""
+		if err := s.Subscribe(&sub); err != nil {
+			got = err.Error()
+		}
+		if got != tt.want {
+			t.Errorf("%s: err = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNotify(t *testing.T) {
+	db, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var mu sync.Mutex
+	received := map[string]*http.Request{}
+	bodies := map[string][]byte{}
+	push := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received[r.URL.Path], bodies[r.URL.Path] = r, body
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/gone":
+			w.WriteHeader(http.StatusGone)
+		case "/broken":
+			http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer push.Close()
+
+	key := newKey(t)
+	s, _ := NewSender(db, key, "mailto:ops@example.com")
+	s.client = push.Client()
+	subs := map[string]*subscriber{}
+	for _, name := range []string{"alice", "everyone", "bob", "gone", "broken"} {
+		user := ""
+		if name == "alice" || name == "bob" {
+			user = name
+		}
+		subs[name] = newSubscriber(t, push.URL+"/"+name, user)
+		if err := db.AddPushSubscription(&subs[name].sub); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = s.Notify(context.Background(), notify.Message{Title: "Door", Body: "The front door is open", Priority: notify.PriorityHigh, User: "Alice", Tags: []string{"door"}})
+	if err == nil || !strings.Contains(err.Error(), "error 429: quota exceeded") {
+		t.Errorf("err = %v, want the broken endpoint's error", err)
+	}
+
+	if _, ok := received["/bob"]; ok {
+		t.Error("bob's subscription got alice's notification")
+	}
+	for _, name := range []string{"alice", "everyone"} {
+		r := received["/"+name]
+		if r == nil {
+			t.Fatalf("%s got nothing", name)
+		}
+		for h, want := range map[string]string{"Content-Encoding": "aes128gcm", "TTL": "86400", "Urgency": "high", "Content-Type": "application/octet-stream"} {
+			if got := r.Header.Get(h); got != want {
+				t.Errorf("%s: %s = %q, want %q", name, h, got, want)
+			}
+		}
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "vapid t=") || !strings.HasSuffix(auth, ", k="+s.PublicKey()) {
+			t.Errorf("%s: Authorization %q", name, auth)
+		}
+		plain, err := decrypt(bodies["/"+name], subs[name].private, subs[name].auth)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if want := `{"title":"Door","body":"The front door is open","priority":4,"tags":["door"]}`; string(plain) != want {
+			t.Errorf("%s: payload %s, want %s", name, plain, want)
+		}
+	}
+
+	left, err := db.PushSubscriptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 4 {
+		t.Errorf("%d subscriptions left, want 4", len(left))
+	}
+	for _, sub := range left {
+		if strings.HasSuffix(sub.Endpoint, "/gone") {
+			t.Error("the gone subscription was kept")
+		}
+	}
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
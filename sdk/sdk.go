@@ -0,0 +1,157 @@
+// Package sdk is the stable API for extending pi-agent with custom tools
+// and model providers.
+//
+// Extensions register themselves from an init function and are compiled
+// into a custom binary that runs the stock command line:
+//
+//	package main
+//
+//	import (
+//		"pi-agent/cli"
+//
+//		_ "example.com/mytools"
+//	)
+//
+//	func main() { cli.Main() }
+//
+// Registered tools are offered to the model alongside the built-in ones,
+// replacing any built-in tool of the same name. A registered provider is
+// selected with "pi-agent serve -provider <name>", and receives the pairs
+// given with -provider-opts.
+//
+// This package follows semantic versioning: within a major version,
+// existing names keep their meaning and signatures. The internal packages
+// it refers to carry no such promise and must not be relied on directly.
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"pi-agent/internal/chat"
+	"pi-agent/internal/tools"
+)
+
+// Version is the version of the SDK API.
+const Version = "1.0.0"
+
+// Tool is a function the model can call during a conversation.
+type Tool = tools.Tool
+
+// ToolFunc is the signature of a tool implementation.
+type ToolFunc = tools.Func
+
+// NoParams is the parameter schema for tools that take no arguments.
+const NoParams = tools.NoParams
+
+// NewTool returns a Tool backed by fn. The parameters string must be a JSON
+// schema object.
+func NewTool(name, description, parameters string, fn ToolFunc) Tool {
+	return tools.New(name, description, parameters, fn)
+}
+
+// DecodeArgs unmarshals tool arguments into v, treating empty arguments as
+// an empty object.
+func DecodeArgs(args json.RawMessage, v any) error {
+	return tools.Decode(args, v)
+}
+
+// ConversationID returns the conversation a tool call belongs to, or empty
+// if unknown.
+func ConversationID(ctx context.Context) string {
+	return tools.ConversationID(ctx)
+}
+
+// Provider is a model backend that streams completions. Providers that
+// need credentials may also implement Authorizer, and ones that run
+// locally Localer.
+type Provider = chat.Provider
+
+// Authorizer lets a provider reject a turn before any of the reply has
+// been streamed, e.g. when its credentials have expired.
+type Authorizer = chat.Authorizer
+
+// Localer lets a provider that runs on this machine or its LAN say so;
+// only such providers answer private conversations.
+type Localer = chat.Localer
+
+// Request is a single completion call.
+type Request = chat.Request
+
+// Message is an item of a Request's conversation: a chat message, a
+// function call, or a function call's output.
+type Message = chat.Message
+
+// ToolDef is a function definition offered to the model in a Request.
+type ToolDef = chat.Tool
+
+// ToolCall is a function call requested by the model.
+type ToolCall = chat.ToolCall
+
+// StreamDelta is a content fragment or completed tool call from a
+// streaming response.
+type StreamDelta = chat.StreamDelta
+
+// ProviderFactory creates a provider from the options given on the command
+// line.
+type ProviderFactory func(opts map[string]string) (Provider, error)
+
+var (
+	mu        sync.Mutex
+	toolList  []Tool
+	providers = make(map[string]ProviderFactory)
+)
+
+// RegisterTool adds tools to every agent built into this binary.
+func RegisterTool(t ...Tool) {
+	mu.Lock()
+	defer mu.Unlock()
+	toolList = append(toolList, t...)
+}
+
+// RegisterProvider makes a provider available under name. It panics if
+// the name is empty or already registered.
+func RegisterProvider(name string, f ProviderFactory) {
+	mu.Lock()
+	defer mu.Unlock()
+	if name == "" || f == nil {
+		panic("sdk: RegisterProvider needs a name and a factory")
+	}
+	if _, dup := providers[name]; dup {
+		panic(fmt.Sprintf("sdk: provider %q registered twice", name))
+	}
+	providers[name] = f
+}
+
+// Tools returns the registered tools.
+func Tools() []Tool {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]Tool(nil), toolList...)
+}
+
+// Providers returns the names of the registered providers, sorted.
+func Providers() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewProvider creates the provider registered under name.
+func NewProvider(name string, opts map[string]string) (Provider, error) {
+	mu.Lock()
+	f, ok := providers[name]
+	mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q", name)
+	}
+	return f(opts)
+}